@@ -0,0 +1,76 @@
+package main
+
+import (
+	"log"
+	"os"
+
+	"classmate-central/internal/database"
+	"classmate-central/internal/logger"
+	"classmate-central/internal/server"
+
+	"github.com/joho/godotenv"
+	"go.uber.org/zap"
+)
+
+func main() {
+	// Load environment variables
+	if err := godotenv.Load(); err != nil {
+		log.Println("No .env file found, using environment variables")
+	}
+
+	// Initialize logger
+	env := os.Getenv("ENV")
+	if env == "" {
+		env = "development"
+	}
+	if err := logger.Init(env); err != nil {
+		log.Fatalf("Failed to initialize logger: %v", err)
+	}
+	defer logger.Logger.Sync()
+
+	logger.Info("Starting application", zap.String("environment", env))
+
+	// Initialize database
+	db, err := database.NewDatabase()
+	if err != nil {
+		logger.Fatal("Failed to connect to database", logger.ErrorField(err))
+	}
+	defer db.Close()
+
+	logger.Info("Database connected successfully")
+
+	// Run migrations
+	if err := db.RunMigrations(); err != nil {
+		logger.Warn("Failed to run migrations", logger.ErrorField(err))
+		logger.Info("Continuing with existing database schema...")
+	} else {
+		logger.Info("Database migrations completed")
+	}
+
+	// Wire repositories, services, handlers and routes
+	srv, err := server.New(db.DB)
+	if err != nil {
+		logger.Fatal("Failed to set up the API", logger.ErrorField(err))
+	}
+
+	// Background jobs
+	srv.Scheduler.Start()
+	defer srv.Scheduler.Stop()
+
+	// Start server
+	host := os.Getenv("SERVER_HOST")
+	if host == "" {
+		host = "0.0.0.0"
+	}
+
+	port := os.Getenv("SERVER_PORT")
+	if port == "" {
+		port = "8080"
+	}
+	addr := host + ":" + port
+	logger.Info("Server starting", zap.String("addr", addr))
+
+	if err := srv.Router.Run(addr); err != nil {
+		logger.Fatal("Failed to start server", logger.ErrorField(err))
+	}
+}
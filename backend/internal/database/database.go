@@ -92,6 +92,34 @@ func (d *Database) RunMigrations() error {
 		"migrations/025_add_unique_idx_deduction.up.sql",
 		"migrations/026_add_email_verification.up.sql",
 		"migrations/027_add_branches.up.sql",
+		"migrations/028_add_cash_shifts.up.sql",
+		"migrations/029_debt_lifecycle.up.sql",
+		"migrations/030_money_precision.up.sql",
+		"migrations/031_multi_currency.up.sql",
+		"migrations/032_installment_plans.up.sql",
+		"migrations/033_payment_intents.up.sql",
+		"migrations/034_fiscal_receipts.up.sql",
+		"migrations/035_user_sessions.up.sql",
+		"migrations/036_user_context_version.up.sql",
+		"migrations/037_branch_scoped_roles.up.sql",
+		"migrations/038_permission_data_scopes.up.sql",
+		"migrations/039_two_factor_auth.up.sql",
+		"migrations/040_account_security_tokens.up.sql",
+		"migrations/041_login_security.up.sql",
+		"migrations/042_oidc_sso.up.sql",
+		"migrations/043_row_level_security.up.sql",
+		"migrations/044_audit_log.up.sql",
+		"migrations/045_soft_delete.up.sql",
+		"migrations/046_company_data_jobs.up.sql",
+		"migrations/047_personal_data_erasure.up.sql",
+		"migrations/048_branch_transfers.up.sql",
+		"migrations/049_saas_plans.up.sql",
+		"migrations/050_platform_console.up.sql",
+		"migrations/051_payment_intent_review.up.sql",
+		"migrations/052_row_level_security_fail_closed.up.sql",
+		"migrations/053_tenant_import_dry_runs.up.sql",
+		"migrations/054_refund_balance_sign.up.sql",
+		"migrations/055_two_factor_attempts.up.sql",
 	}
 
 	log.Printf("📋 Total migrations to process: %d", len(migrations))
@@ -128,8 +156,8 @@ func (d *Database) RunMigrations() error {
 			return fmt.Errorf("error reading migration file %s: %w", migrationFile, err)
 		}
 
-		// Execute migration
-		_, err = d.DB.Exec(string(migrationSQL))
+		// Execute migration; backfills touch every company, so row-level security is bypassed
+		_, err = System(d.DB).Exec(string(migrationSQL))
 		if err != nil {
 			log.Printf("❌ Error executing migration %s: %v", migrationFile, err)
 			// Continue with other migrations instead of failing completely
@@ -0,0 +1,127 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+)
+
+// Querier runs statements. *sql.DB, *sql.Tx and the handles returned by Tenant and System
+// implement it.
+type Querier interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// setScopeQuery sets the row-level security scope of a connection for the statements that follow
+const setScopeQuery = `SELECT set_config('app.company_id', $1, false), set_config('app.rls_bypass', $2, false)`
+
+// Scoped runs each statement on a pooled connection whose row-level security scope is set first.
+// The policies of migration 052 hide every row of a tenant table unless the connection is scoped
+// to the row's company or explicitly bypasses them, so a statement that was not scoped fails closed.
+type Scoped struct {
+	db        *sql.DB
+	companyID string
+	bypass    bool
+}
+
+// Tenant returns a handle whose statements only see and write rows of the company. Requests use it
+// with the company of the signed-in user; an empty company sees nothing.
+func Tenant(db *sql.DB, companyID string) *Scoped {
+	return &Scoped{db: db, companyID: companyID}
+}
+
+// System returns a handle whose statements see all companies. It is meant for work that is not
+// done on behalf of one tenant: background jobs, sign-in before the company is known, provider
+// webhooks and the platform console.
+func System(db *sql.DB) *Scoped {
+	return &Scoped{db: db, bypass: true}
+}
+
+// conn checks out a connection and applies the scope. The setting stays on the connection until
+// the next scoped checkout overwrites it; transactions opened with WithActor clear it locally.
+func (s *Scoped) conn() (*sql.Conn, error) {
+	ctx := context.Background()
+	conn, err := s.db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	bypass := ""
+	if s.bypass {
+		bypass = "on"
+	}
+	if _, err := conn.ExecContext(ctx, setScopeQuery, s.companyID, bypass); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("error setting tenant scope: %w", err)
+	}
+	return conn, nil
+}
+
+// release returns the connection to the pool once the rows or transaction using it are done
+func release(conn *sql.Conn) {
+	// Close waits until the open rows or transaction let go of the connection
+	go conn.Close()
+}
+
+func (s *Scoped) Exec(query string, args ...interface{}) (sql.Result, error) {
+	conn, err := s.conn()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	return conn.ExecContext(context.Background(), query, args...)
+}
+
+func (s *Scoped) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	conn, err := s.conn()
+	if err != nil {
+		return nil, err
+	}
+	defer release(conn)
+	return conn.QueryContext(context.Background(), query, args...)
+}
+
+// QueryRow does not run the statement if the scope cannot be applied: Scan then fails with
+// context.Canceled and the cause is logged
+func (s *Scoped) QueryRow(query string, args ...interface{}) *sql.Row {
+	conn, err := s.conn()
+	if err != nil {
+		log.Printf("⚠️  %v", err)
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		return s.db.QueryRowContext(ctx, query, args...)
+	}
+	defer release(conn)
+	return conn.QueryRowContext(context.Background(), query, args...)
+}
+
+// Begin starts a transaction in the scope. WithActor and SetActor narrow it to one company.
+func (s *Scoped) Begin() (*sql.Tx, error) {
+	return s.BeginTx(context.Background(), nil)
+}
+
+// BeginTx starts a transaction with the given options in the scope
+func (s *Scoped) BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error) {
+	conn, err := s.conn()
+	if err != nil {
+		return nil, err
+	}
+	tx, err := conn.BeginTx(ctx, opts)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	release(conn)
+	return tx, nil
+}
+
+// TenantOrSystem returns Tenant for a company and System for an empty companyID. It is meant for
+// maintenance methods where an empty companyID stands for all companies.
+func TenantOrSystem(db *sql.DB, companyID string) *Scoped {
+	if companyID == "" {
+		return System(db)
+	}
+	return Tenant(db, companyID)
+}
@@ -0,0 +1,88 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// ErrNoTenant is returned by WithTenant when no company is given
+var ErrNoTenant = errors.New("company ID is required for a tenant transaction")
+
+// Actor identifies who makes a change. The audit triggers of migration 044 read it from the
+// transaction; a zero UserID marks a change made by the system.
+type Actor struct {
+	CompanyID string
+	UserID    int
+	IP        string
+	RequestID string
+	// ImpersonatedBy is the platform admin acting as UserID through an impersonation session
+	ImpersonatedBy int
+}
+
+// WithTenant runs fn in a transaction that can only see and write rows of the company.
+// The row-level security policies of migrations 043 and 052 compare company_id with the
+// transaction-local app.company_id setting, so a query that forgets its company filter
+// still returns nothing from other tenants. fn's error rolls the transaction back.
+func WithTenant(db *sql.DB, companyID string, fn func(tx *sql.Tx) error) error {
+	return WithActor(db, Actor{CompanyID: companyID}, fn)
+}
+
+// WithActor is WithTenant for changes: the audit log entries written by the transaction
+// carry the actor's user, IP and request ID.
+func WithActor(db *sql.DB, actor Actor, fn func(tx *sql.Tx) error) error {
+	if actor.CompanyID == "" {
+		return ErrNoTenant
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting tenant transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := SetActor(tx, actor); err != nil {
+		return err
+	}
+	if err := fn(tx); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing tenant transaction: %w", err)
+	}
+	return nil
+}
+
+// SetActor applies the tenant and actor settings to a transaction the caller already opened.
+// It also lifts a System scope left on the connection, so the transaction only sees the company.
+func SetActor(tx *sql.Tx, actor Actor) error {
+	if actor.CompanyID == "" {
+		return ErrNoTenant
+	}
+	userID, impersonatedBy := "", ""
+	if actor.UserID != 0 {
+		userID = strconv.Itoa(actor.UserID)
+	}
+	if actor.ImpersonatedBy != 0 {
+		impersonatedBy = strconv.Itoa(actor.ImpersonatedBy)
+	}
+	_, err := tx.Exec(`
+		SELECT set_config('app.company_id', $1, true), set_config('app.user_id', $2, true),
+			set_config('app.client_ip', $3, true), set_config('app.request_id', $4, true),
+			set_config('app.impersonated_by', $5, true), set_config('app.rls_bypass', '', true)`,
+		actor.CompanyID, userID, actor.IP, actor.RequestID, impersonatedBy)
+	if err != nil {
+		return fmt.Errorf("error setting tenant: %w", err)
+	}
+	return nil
+}
+
+// SuppressAudit stops the audit triggers for the rest of the transaction. Bulk operations
+// use it and record a single summary entry instead of one per row.
+func SuppressAudit(tx *sql.Tx) error {
+	if _, err := tx.Exec(`SELECT set_config('app.audit_suppress', 'on', true)`); err != nil {
+		return fmt.Errorf("error suppressing audit: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+package database
+
+import (
+	"database/sql"
+	"testing"
+
+	"classmate-central/internal/testutil"
+)
+
+// TestWithTenant_RowLevelSecurity checks that the policies hide other companies' rows from a
+// query that has no company filter at all, and every row from a query that has no scope
+func TestWithTenant_RowLevelSecurity(t *testing.T) {
+	db := testutil.SetupTestDB(t)
+	defer db.Close()
+	defer testutil.CleanupTestDB(t, db)
+
+	var bypass bool
+	if err := db.QueryRow(`SELECT rolsuper OR rolbypassrls FROM pg_roles WHERE rolname = current_user`).Scan(&bypass); err != nil {
+		t.Fatal(err)
+	}
+	if bypass {
+		t.Skip("row-level security does not apply to superusers or BYPASSRLS roles; run as the application role")
+	}
+
+	for _, id := range []string{"rls-company-a", "rls-company-b"} {
+		if _, err := System(db).Exec(`INSERT INTO companies (id, name) VALUES ($1, $1)`, id); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := System(db).Exec(`INSERT INTO students (id, name, email, company_id) VALUES ($1, $1, $1 || '@example.com', $2)`, id+"-student", id); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var visible []string
+	err := WithTenant(db, "rls-company-b", func(tx *sql.Tx) error {
+		rows, err := tx.Query(`SELECT id FROM students ORDER BY id`)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var id string
+			if err := rows.Scan(&id); err != nil {
+				return err
+			}
+			visible = append(visible, id)
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(visible) != 1 || visible[0] != "rls-company-b-student" {
+		t.Errorf("visible students = %v, want only rls-company-b-student", visible)
+	}
+
+	err = WithTenant(db, "rls-company-b", func(tx *sql.Tx) error {
+		_, err := tx.Exec(`INSERT INTO students (id, name, email, company_id) VALUES ('rls-foreign', 'x', 'rls-foreign@example.com', 'rls-company-a')`)
+		return err
+	})
+	if err == nil {
+		t.Error("expected the policy to reject a row for another company")
+	}
+
+	if err := WithTenant(db, "", func(tx *sql.Tx) error { return nil }); err != ErrNoTenant {
+		t.Errorf("err = %v, want ErrNoTenant", err)
+	}
+
+	// Outside a transaction the scope comes from Tenant and System; without a company nothing is visible
+	countStudents := func(q Querier) int {
+		var n int
+		if err := q.QueryRow(`SELECT COUNT(*) FROM students WHERE id LIKE 'rls-company-%'`).Scan(&n); err != nil {
+			t.Fatal(err)
+		}
+		return n
+	}
+	if n := countStudents(Tenant(db, "")); n != 0 {
+		t.Errorf("students visible without a tenant = %d, want 0", n)
+	}
+	if n := countStudents(Tenant(db, "rls-company-a")); n != 1 {
+		t.Errorf("students visible to rls-company-a = %d, want 1", n)
+	}
+	if n := countStudents(System(db)); n != 2 {
+		t.Errorf("students visible to the system scope = %d, want 2", n)
+	}
+
+	// A transaction narrowed to one company does not inherit the bypass of the connection
+	tx, err := System(db).Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+	if err := SetActor(tx, Actor{CompanyID: "rls-company-a"}); err != nil {
+		t.Fatal(err)
+	}
+	if n := countStudents(tx); n != 1 {
+		t.Errorf("students visible to a narrowed system transaction = %d, want 1", n)
+	}
+}
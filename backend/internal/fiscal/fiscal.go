@@ -0,0 +1,58 @@
+// Package fiscal registers fiscal receipts with a fiscal data operator (OFD). Every cash and card
+// payment or refund has to be registered; the operator returns the fiscal number and a QR code that
+// lets the customer check the receipt.
+package fiscal
+
+import (
+	"errors"
+	"os"
+	"time"
+
+	"classmate-central/internal/money"
+)
+
+// Operation is the kind of a receipt
+type Operation string
+
+const (
+	OperationSale   Operation = "sale"
+	OperationRefund Operation = "refund"
+)
+
+// ErrRejected is returned when the operator refuses a receipt as invalid. Retrying will not help.
+var ErrRejected = errors.New("receipt rejected by fiscal operator")
+
+// Receipt is a receipt to register
+type Receipt struct {
+	Reference     string // our receipt ID; operators deduplicate on it
+	Operation     Operation
+	Amount        money.Money
+	PaymentMethod string // cash, card
+	Description   string
+	BranchID      string // selects the cash register at the operator
+}
+
+// Registration is the operator's answer for a registered receipt
+type Registration struct {
+	FiscalNumber string
+	QRCode       string // content of the QR code printed on the receipt
+	URL          string // public link to the receipt at the operator
+	RegisteredAt time.Time
+}
+
+// Operator is implemented by every fiscal operator adapter
+type Operator interface {
+	Name() string
+	// Register registers the receipt. Errors other than ErrRejected are treated as temporary.
+	Register(receipt Receipt) (*Registration, error)
+}
+
+// NewOperatorFromEnv returns the operator selected by FISCAL_OPERATOR, or nil when fiscalization is off
+func NewOperatorFromEnv() Operator {
+	switch os.Getenv("FISCAL_OPERATOR") {
+	case "stub":
+		return NewStubOperator()
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,48 @@
+package fiscal
+
+import (
+	"errors"
+	"testing"
+
+	"classmate-central/internal/money"
+)
+
+func TestStubOperator_RegistersOncePerReference(t *testing.T) {
+	o := NewStubOperator()
+	receipt := Receipt{Reference: "1", Operation: OperationSale, Amount: money.MustParse("5000", money.KZT), PaymentMethod: "cash"}
+
+	first, err := o.Register(receipt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.FiscalNumber == "" || first.QRCode == "" || first.URL == "" {
+		t.Errorf("incomplete registration: %+v", first)
+	}
+
+	again, err := o.Register(receipt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.FiscalNumber != first.FiscalNumber {
+		t.Errorf("duplicate registration: %s then %s", first.FiscalNumber, again.FiscalNumber)
+	}
+}
+
+func TestStubOperator_Failures(t *testing.T) {
+	o := NewStubOperator()
+	receipt := Receipt{Reference: "2", Operation: OperationSale, Amount: money.MustParse("100", money.KZT)}
+
+	o.FailNext(1)
+	if _, err := o.Register(receipt); err == nil || errors.Is(err, ErrRejected) {
+		t.Errorf("expected a temporary error, got %v", err)
+	}
+	if _, err := o.Register(receipt); err != nil {
+		t.Errorf("expected success after the failure, got %v", err)
+	}
+
+	receipt.Reference = "3"
+	receipt.Amount = money.New(0, money.KZT)
+	if _, err := o.Register(receipt); !errors.Is(err, ErrRejected) {
+		t.Errorf("expected ErrRejected for zero amount, got %v", err)
+	}
+}
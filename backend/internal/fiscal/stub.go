@@ -0,0 +1,60 @@
+package fiscal
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// StubOperator registers receipts in memory. It is meant for tests and local development;
+// FailNext makes it answer like an unavailable operator.
+type StubOperator struct {
+	mu         sync.Mutex
+	seq        int
+	failures   int
+	registered map[string]*Registration
+}
+
+func NewStubOperator() *StubOperator {
+	return &StubOperator{registered: make(map[string]*Registration)}
+}
+
+func (o *StubOperator) Name() string { return "stub" }
+
+func (o *StubOperator) Register(receipt Receipt) (*Registration, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if o.failures > 0 {
+		o.failures--
+		return nil, fmt.Errorf("stub operator unavailable")
+	}
+	if !receipt.Amount.IsPositive() {
+		return nil, fmt.Errorf("%w: amount must be positive", ErrRejected)
+	}
+
+	// Registering the same receipt again returns the first registration
+	if reg, ok := o.registered[receipt.Reference]; ok {
+		copied := *reg
+		return &copied, nil
+	}
+
+	o.seq++
+	number := fmt.Sprintf("STUB%010d", o.seq)
+	reg := &Registration{
+		FiscalNumber: number,
+		QRCode:       fmt.Sprintf("https://ofd.stub.local/check?fn=%s&s=%s", number, receipt.Amount.String()),
+		URL:          "https://ofd.stub.local/receipts/" + number,
+		RegisteredAt: time.Now(),
+	}
+	o.registered[receipt.Reference] = reg
+	copied := *reg
+	return &copied, nil
+}
+
+// FailNext makes the next n registrations fail with a temporary error
+func (o *StubOperator) FailNext(n int) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.failures = n
+}
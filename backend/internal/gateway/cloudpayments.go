@@ -0,0 +1,232 @@
+package gateway
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"classmate-central/internal/money"
+)
+
+const cloudPaymentsAPIURL = "https://api.cloudpayments.ru"
+
+// CloudPayments talks to a CloudPayments-style API: HTTP basic auth with the public ID and API secret,
+// hosted order pages, and notifications signed with an HMAC-SHA256 of the body in Content-HMAC.
+type CloudPayments struct {
+	publicID  string
+	apiSecret string
+	baseURL   string
+	client    *http.Client
+}
+
+// NewCloudPayments creates the adapter; an empty baseURL uses the production API
+func NewCloudPayments(publicID, apiSecret, baseURL string) *CloudPayments {
+	if baseURL == "" {
+		baseURL = cloudPaymentsAPIURL
+	}
+	return &CloudPayments{
+		publicID:  publicID,
+		apiSecret: apiSecret,
+		baseURL:   baseURL,
+		client:    &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+func (p *CloudPayments) Name() string { return "cloudpayments" }
+
+type cloudPaymentsResponse struct {
+	Success bool            `json:"Success"`
+	Message string          `json:"Message"`
+	Model   json.RawMessage `json:"Model"`
+}
+
+type cloudPaymentsOrder struct {
+	ID  string `json:"Id"`
+	URL string `json:"Url"`
+}
+
+type cloudPaymentsTransaction struct {
+	TransactionID int64       `json:"TransactionId"`
+	Amount        json.Number `json:"Amount"`
+	Currency      string      `json:"Currency"`
+	InvoiceID     string      `json:"InvoiceId"`
+	Status        string      `json:"Status"`
+}
+
+func (p *CloudPayments) CreatePayment(req PaymentRequest) (*Payment, error) {
+	body := map[string]interface{}{
+		"Amount":      json.Number(req.Amount.String()),
+		"Currency":    string(req.Amount.Currency()),
+		"Description": req.Description,
+		"InvoiceId":   req.Reference,
+		"AccountId":   req.AccountID,
+	}
+	if req.Email != "" {
+		body["Email"] = req.Email
+	}
+	if req.ReturnURL != "" {
+		body["SuccessRedirectUrl"] = req.ReturnURL
+	}
+
+	var order cloudPaymentsOrder
+	if err := p.call("/orders/create", body, &order); err != nil {
+		return nil, err
+	}
+	return &Payment{
+		Reference:         req.Reference,
+		ProviderPaymentID: order.ID,
+		PaymentURL:        order.URL,
+		Status:            StatusPending,
+		Amount:            req.Amount,
+	}, nil
+}
+
+// ParseWebhook decodes Pay, Fail and Refund notifications (form-encoded, the provider default)
+func (p *CloudPayments) ParseWebhook(header http.Header, body []byte) (*Payment, error) {
+	if !p.validSignature(header.Get("Content-HMAC"), body) {
+		return nil, ErrInvalidSignature
+	}
+
+	form, err := url.ParseQuery(string(body))
+	if err != nil {
+		return nil, fmt.Errorf("error parsing notification: %w", err)
+	}
+
+	status := cloudPaymentsStatus(form.Get("Status"))
+	switch {
+	case form.Get("PaymentTransactionId") != "":
+		// Refund notifications reference the original payment
+		status = StatusRefunded
+	case form.Get("Status") == "" && form.Get("ReasonCode") != "":
+		status = StatusFailed
+	}
+
+	tx := cloudPaymentsTransaction{
+		Amount:    json.Number(form.Get("Amount")),
+		Currency:  form.Get("Currency"),
+		InvoiceID: form.Get("InvoiceId"),
+	}
+	payment, err := tx.payment()
+	if err != nil {
+		return nil, err
+	}
+	payment.ProviderPaymentID = form.Get("TransactionId")
+	if status == StatusRefunded {
+		payment.ProviderPaymentID = form.Get("PaymentTransactionId")
+	}
+	payment.Status = status
+	return payment, nil
+}
+
+func (p *CloudPayments) GetPayment(reference string) (*Payment, error) {
+	var tx cloudPaymentsTransaction
+	if err := p.call("/v2/payments/find", map[string]interface{}{"InvoiceId": reference}, &tx); err != nil {
+		return nil, err
+	}
+	payment, err := tx.payment()
+	if err != nil {
+		return nil, err
+	}
+	payment.ProviderPaymentID = fmt.Sprintf("%d", tx.TransactionID)
+	payment.Status = cloudPaymentsStatus(tx.Status)
+	return payment, nil
+}
+
+func (p *CloudPayments) Refund(providerPaymentID string, amount money.Money) error {
+	return p.call("/payments/refund", map[string]interface{}{
+		"TransactionId": json.Number(providerPaymentID),
+		"Amount":        json.Number(amount.String()),
+	}, nil)
+}
+
+func (p *CloudPayments) validSignature(signature string, body []byte) bool {
+	if signature == "" {
+		return false
+	}
+	given, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(sha256.New, []byte(p.apiSecret))
+	mac.Write(body)
+	return hmac.Equal(given, mac.Sum(nil))
+}
+
+// call posts a JSON request and decodes the Model of a successful response into out
+func (p *CloudPayments) call(path string, body interface{}, out interface{}) error {
+	jsonData, err := json.Marshal(body)
+	if err != nil {
+		return fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	req, err := http.NewRequest("POST", p.baseURL+path, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.SetBasicAuth(p.publicID, p.apiSecret)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send request to payment provider: %w", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("payment provider error: status %d, response: %s", resp.StatusCode, string(respBody))
+	}
+
+	var result cloudPaymentsResponse
+	if err := json.Unmarshal(respBody, &result); err != nil {
+		return fmt.Errorf("failed to parse response: %w", err)
+	}
+	if !result.Success {
+		if path == "/v2/payments/find" {
+			return ErrPaymentNotFound
+		}
+		return fmt.Errorf("payment provider error: %s", result.Message)
+	}
+	if out == nil || len(result.Model) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(result.Model, out); err != nil {
+		return fmt.Errorf("failed to parse response model: %w", err)
+	}
+	return nil
+}
+
+func (tx cloudPaymentsTransaction) payment() (*Payment, error) {
+	currency, err := money.ParseCurrency(tx.Currency)
+	if err != nil {
+		return nil, err
+	}
+	amount, err := money.Parse(tx.Amount.String(), currency, money.HalfUp)
+	if err != nil {
+		return nil, err
+	}
+	return &Payment{Reference: tx.InvoiceID, Amount: amount}, nil
+}
+
+func cloudPaymentsStatus(status string) Status {
+	switch status {
+	case "Completed":
+		return StatusSucceeded
+	case "Declined", "Cancelled":
+		return StatusFailed
+	case "Refunded":
+		return StatusRefunded
+	default: // AwaitingAuthentication, Authorized
+		return StatusPending
+	}
+}
@@ -0,0 +1,150 @@
+package gateway
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"classmate-central/internal/money"
+)
+
+// FakeProvider is an in-memory provider for tests and local development. Complete and Fail settle a
+// payment and return the signed webhook the real provider would send.
+type FakeProvider struct {
+	mu       sync.Mutex
+	secret   string
+	seq      int
+	payments map[string]*Payment
+}
+
+type fakeWebhook struct {
+	Reference         string `json:"reference"`
+	ProviderPaymentID string `json:"providerPaymentId"`
+	Status            Status `json:"status"`
+	Amount            string `json:"amount"`
+	Currency          string `json:"currency"`
+}
+
+func NewFakeProvider(secret string) *FakeProvider {
+	return &FakeProvider{secret: secret, payments: make(map[string]*Payment)}
+}
+
+func (p *FakeProvider) Name() string { return "fake" }
+
+func (p *FakeProvider) CreatePayment(req PaymentRequest) (*Payment, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.seq++
+	payment := &Payment{
+		Reference:         req.Reference,
+		ProviderPaymentID: fmt.Sprintf("fake_%d", p.seq),
+		PaymentURL:        "https://pay.fake.local/" + req.Reference,
+		Status:            StatusPending,
+		Amount:            req.Amount,
+	}
+	p.payments[req.Reference] = payment
+	copied := *payment
+	return &copied, nil
+}
+
+func (p *FakeProvider) ParseWebhook(header http.Header, body []byte) (*Payment, error) {
+	if !hmac.Equal([]byte(header.Get("X-Fake-Signature")), []byte(p.sign(body))) {
+		return nil, ErrInvalidSignature
+	}
+
+	var hook fakeWebhook
+	if err := json.Unmarshal(body, &hook); err != nil {
+		return nil, fmt.Errorf("error parsing notification: %w", err)
+	}
+	currency, err := money.ParseCurrency(hook.Currency)
+	if err != nil {
+		return nil, err
+	}
+	amount, err := money.Parse(hook.Amount, currency, money.HalfUp)
+	if err != nil {
+		return nil, err
+	}
+	return &Payment{
+		Reference:         hook.Reference,
+		ProviderPaymentID: hook.ProviderPaymentID,
+		Status:            hook.Status,
+		Amount:            amount,
+	}, nil
+}
+
+func (p *FakeProvider) GetPayment(reference string) (*Payment, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	payment, ok := p.payments[reference]
+	if !ok {
+		return nil, ErrPaymentNotFound
+	}
+	copied := *payment
+	return &copied, nil
+}
+
+func (p *FakeProvider) Refund(providerPaymentID string, amount money.Money) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, payment := range p.payments {
+		if payment.ProviderPaymentID == providerPaymentID {
+			if payment.Status != StatusSucceeded || amount.GreaterThan(payment.Amount) {
+				return fmt.Errorf("payment %s cannot be refunded", providerPaymentID)
+			}
+			if amount.Equal(payment.Amount) {
+				payment.Status = StatusRefunded
+			}
+			return nil
+		}
+	}
+	return ErrPaymentNotFound
+}
+
+// Complete marks the payment as paid and returns the webhook notifying about it
+func (p *FakeProvider) Complete(reference string) (http.Header, []byte, error) {
+	return p.settle(reference, StatusSucceeded)
+}
+
+// Fail marks the payment as declined and returns the webhook notifying about it
+func (p *FakeProvider) Fail(reference string) (http.Header, []byte, error) {
+	return p.settle(reference, StatusFailed)
+}
+
+func (p *FakeProvider) settle(reference string, status Status) (http.Header, []byte, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	payment, ok := p.payments[reference]
+	if !ok {
+		return nil, nil, ErrPaymentNotFound
+	}
+	payment.Status = status
+
+	body, err := json.Marshal(fakeWebhook{
+		Reference:         payment.Reference,
+		ProviderPaymentID: payment.ProviderPaymentID,
+		Status:            status,
+		Amount:            payment.Amount.String(),
+		Currency:          string(payment.Amount.Currency()),
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	header := http.Header{}
+	header.Set("Content-Type", "application/json")
+	header.Set("X-Fake-Signature", p.sign(body))
+	return header, body, nil
+}
+
+func (p *FakeProvider) sign(body []byte) string {
+	mac := hmac.New(sha256.New, []byte(p.secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,119 @@
+// Package gateway integrates online payment providers. A provider hosts the payment page, reports the
+// result with a signed webhook and can be polled for the status of a payment or asked for a refund.
+package gateway
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+
+	"classmate-central/internal/money"
+)
+
+// Status is the provider-independent state of an online payment
+type Status string
+
+const (
+	StatusPending   Status = "pending"
+	StatusSucceeded Status = "succeeded"
+	StatusFailed    Status = "failed"
+	StatusRefunded  Status = "refunded"
+)
+
+var (
+	// ErrInvalidSignature is returned for webhooks that were not signed by the provider
+	ErrInvalidSignature = errors.New("invalid webhook signature")
+	// ErrUnknownProvider is returned for providers that are not configured
+	ErrUnknownProvider = errors.New("unknown payment provider")
+	// ErrPaymentNotFound is returned when the provider has no payment for the reference
+	ErrPaymentNotFound = errors.New("payment not found at provider")
+)
+
+// PaymentRequest describes a payment link to create
+type PaymentRequest struct {
+	Reference   string // our payment intent ID, echoed back by the provider
+	Amount      money.Money
+	Description string
+	AccountID   string // student ID
+	Email       string
+	ReturnURL   string
+}
+
+// Payment is a payment as reported by the provider
+type Payment struct {
+	Reference         string
+	ProviderPaymentID string
+	PaymentURL        string
+	Status            Status
+	Amount            money.Money
+}
+
+// Provider is implemented by every payment provider adapter
+type Provider interface {
+	Name() string
+	// CreatePayment registers the payment and returns the link the payer follows
+	CreatePayment(req PaymentRequest) (*Payment, error)
+	// ParseWebhook verifies the signature of a notification and decodes it
+	ParseWebhook(header http.Header, body []byte) (*Payment, error)
+	// GetPayment queries the current state of the payment with our reference
+	GetPayment(reference string) (*Payment, error)
+	// Refund returns the amount (part or all of the payment) to the payer
+	Refund(providerPaymentID string, amount money.Money) error
+}
+
+// Registry holds the configured providers
+type Registry struct {
+	providers   map[string]Provider
+	defaultName string
+}
+
+// NewRegistry registers the providers; the first one is the default
+func NewRegistry(providers ...Provider) *Registry {
+	r := &Registry{providers: make(map[string]Provider)}
+	for _, p := range providers {
+		if r.defaultName == "" {
+			r.defaultName = p.Name()
+		}
+		r.providers[p.Name()] = p
+	}
+	return r
+}
+
+// NewRegistryFromEnv configures providers from environment variables:
+// CLOUDPAYMENTS_PUBLIC_ID and CLOUDPAYMENTS_API_SECRET enable CloudPayments, PAYMENT_FAKE_SECRET enables
+// the fake provider outside production and PAYMENT_PROVIDER picks the default one.
+func NewRegistryFromEnv() *Registry {
+	var providers []Provider
+	if publicID, secret := os.Getenv("CLOUDPAYMENTS_PUBLIC_ID"), os.Getenv("CLOUDPAYMENTS_API_SECRET"); publicID != "" && secret != "" {
+		providers = append(providers, NewCloudPayments(publicID, secret, os.Getenv("CLOUDPAYMENTS_API_URL")))
+	}
+	if secret := os.Getenv("PAYMENT_FAKE_SECRET"); secret != "" && os.Getenv("ENV") != "production" {
+		providers = append(providers, NewFakeProvider(secret))
+	}
+
+	r := NewRegistry(providers...)
+	if name := os.Getenv("PAYMENT_PROVIDER"); name != "" {
+		if _, ok := r.providers[name]; ok {
+			r.defaultName = name
+		}
+	}
+	return r
+}
+
+// Get returns the provider by name, or the default one for an empty name
+func (r *Registry) Get(name string) (Provider, error) {
+	if name == "" {
+		name = r.defaultName
+	}
+	p, ok := r.providers[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownProvider, name)
+	}
+	return p, nil
+}
+
+// Enabled reports whether at least one provider is configured
+func (r *Registry) Enabled() bool {
+	return len(r.providers) > 0
+}
@@ -0,0 +1,114 @@
+package gateway
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"classmate-central/internal/money"
+)
+
+func TestCloudPayments_CreatePayment(t *testing.T) {
+	var got map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, pass, ok := r.BasicAuth(); !ok || user != "pk_test" || pass != "secret" {
+			t.Errorf("missing basic auth")
+		}
+		if r.URL.Path != "/orders/create" {
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+		_ = json.NewDecoder(r.Body).Decode(&got)
+		_, _ = w.Write([]byte(`{"Success":true,"Model":{"Id":"ord_1","Url":"https://pay.example/ord_1"}}`))
+	}))
+	defer server.Close()
+
+	p := NewCloudPayments("pk_test", "secret", server.URL)
+	payment, err := p.CreatePayment(PaymentRequest{Reference: "intent-1", Amount: money.MustParse("15000.50", money.KZT), AccountID: "student-1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if payment.ProviderPaymentID != "ord_1" || payment.PaymentURL != "https://pay.example/ord_1" || payment.Status != StatusPending {
+		t.Errorf("unexpected payment: %+v", payment)
+	}
+	if got["InvoiceId"] != "intent-1" || got["Currency"] != "KZT" || got["Amount"] != 15000.5 {
+		t.Errorf("unexpected request: %v", got)
+	}
+}
+
+func TestCloudPayments_ParseWebhook(t *testing.T) {
+	p := NewCloudPayments("pk_test", "secret", "")
+	body := []byte(url.Values{
+		"TransactionId": {"504"},
+		"Amount":        {"15000.50"},
+		"Currency":      {"KZT"},
+		"InvoiceId":     {"intent-1"},
+		"Status":        {"Completed"},
+	}.Encode())
+
+	mac := hmac.New(sha256.New, []byte("secret"))
+	mac.Write(body)
+	header := http.Header{}
+	header.Set("Content-HMAC", base64.StdEncoding.EncodeToString(mac.Sum(nil)))
+
+	payment, err := p.ParseWebhook(header, body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if payment.Reference != "intent-1" || payment.ProviderPaymentID != "504" || payment.Status != StatusSucceeded {
+		t.Errorf("unexpected payment: %+v", payment)
+	}
+	if !payment.Amount.Equal(money.MustParse("15000.50", money.KZT)) {
+		t.Errorf("amount = %s", payment.Amount.Format())
+	}
+
+	header.Set("Content-HMAC", base64.StdEncoding.EncodeToString([]byte("forged")))
+	if _, err := p.ParseWebhook(header, body); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("expected ErrInvalidSignature, got %v", err)
+	}
+}
+
+func TestFakeProvider_CompleteRoundTrip(t *testing.T) {
+	p := NewFakeProvider("secret")
+	amount := money.MustParse("9900", money.UZS)
+	if _, err := p.CreatePayment(PaymentRequest{Reference: "intent-2", Amount: amount}); err != nil {
+		t.Fatal(err)
+	}
+
+	header, body, err := p.Complete("intent-2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	payment, err := p.ParseWebhook(header, body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if payment.Status != StatusSucceeded || !payment.Amount.Equal(amount) || payment.Reference != "intent-2" {
+		t.Errorf("unexpected payment: %+v", payment)
+	}
+
+	if _, err := NewFakeProvider("other").ParseWebhook(header, body); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("expected ErrInvalidSignature with another secret, got %v", err)
+	}
+	if _, err := p.GetPayment("unknown"); !errors.Is(err, ErrPaymentNotFound) {
+		t.Errorf("expected ErrPaymentNotFound, got %v", err)
+	}
+}
+
+func TestRegistry_Get(t *testing.T) {
+	r := NewRegistry(NewFakeProvider("s"), NewCloudPayments("pk", "s", ""))
+	if p, err := r.Get(""); err != nil || p.Name() != "fake" {
+		t.Errorf("default provider = %v, %v", p, err)
+	}
+	if p, err := r.Get("cloudpayments"); err != nil || p.Name() != "cloudpayments" {
+		t.Errorf("named provider = %v, %v", p, err)
+	}
+	if _, err := NewRegistry().Get(""); !errors.Is(err, ErrUnknownProvider) {
+		t.Errorf("expected ErrUnknownProvider without providers, got %v", err)
+	}
+}
@@ -0,0 +1,123 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"classmate-central/internal/models"
+	"classmate-central/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+const maxAuditPageSize = 200
+
+type AuditHandler struct {
+	service *services.AuditService
+}
+
+func NewAuditHandler(service *services.AuditService) *AuditHandler {
+	return &AuditHandler{service: service}
+}
+
+// GetAuditLog returns the company's audit entries, newest first
+// GET /api/audit-log?userId=&action=&entityType=&entityId=&requestId=&from=&to=&limit=&offset=
+func (h *AuditHandler) GetAuditLog(c *gin.Context) {
+	filter, err := parseAuditFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	filter.Limit = 50
+	if limitParam := c.Query("limit"); limitParam != "" {
+		if val, err := strconv.Atoi(limitParam); err == nil && val > 0 {
+			filter.Limit = val
+		}
+	}
+	if filter.Limit > maxAuditPageSize {
+		filter.Limit = maxAuditPageSize
+	}
+	if offsetParam := c.Query("offset"); offsetParam != "" {
+		if val, err := strconv.Atoi(offsetParam); err == nil && val >= 0 {
+			filter.Offset = val
+		}
+	}
+
+	entries, err := h.service.List(c.GetString("company_id"), filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load audit log"})
+		return
+	}
+
+	c.JSON(http.StatusOK, entries)
+}
+
+// ExportAuditLog exports the entries matching the same filters as CSV
+// GET /api/export/audit-log/csv
+func (h *AuditHandler) ExportAuditLog(c *gin.Context) {
+	filter, err := parseAuditFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	data, err := h.service.ExportCSV(c.GetString("company_id"), filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to export audit log"})
+		return
+	}
+
+	c.Header("Content-Type", "text/csv; charset=utf-8")
+	c.Header("Content-Disposition", `attachment; filename="audit_log_`+time.Now().Format("20060102_150405")+`.csv"`)
+	c.Data(http.StatusOK, "text/csv; charset=utf-8", data)
+}
+
+// parseAuditFilter reads the filter query parameters. from and to accept RFC 3339 timestamps
+// or dates; a date in to includes the whole day.
+func parseAuditFilter(c *gin.Context) (models.AuditFilter, error) {
+	filter := models.AuditFilter{
+		Action:     c.Query("action"),
+		EntityType: c.Query("entityType"),
+		EntityID:   c.Query("entityId"),
+		RequestID:  c.Query("requestId"),
+	}
+
+	if userID := c.Query("userId"); userID != "" {
+		id, err := strconv.Atoi(userID)
+		if err != nil {
+			return filter, fmt.Errorf("invalid userId")
+		}
+		filter.UserID = id
+	}
+
+	if from := c.Query("from"); from != "" {
+		t, _, err := parseAuditTime(from)
+		if err != nil {
+			return filter, fmt.Errorf("invalid from, expected RFC 3339 or YYYY-MM-DD")
+		}
+		filter.From = &t
+	}
+	if to := c.Query("to"); to != "" {
+		t, isDate, err := parseAuditTime(to)
+		if err != nil {
+			return filter, fmt.Errorf("invalid to, expected RFC 3339 or YYYY-MM-DD")
+		}
+		if isDate {
+			t = t.AddDate(0, 0, 1)
+		}
+		filter.To = &t
+	}
+
+	return filter, nil
+}
+
+func parseAuditTime(value string) (time.Time, bool, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, false, nil
+	}
+	t, err := time.Parse("2006-01-02", value)
+	return t, true, err
+}
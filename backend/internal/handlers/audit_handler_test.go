@@ -0,0 +1,47 @@
+package handlers
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func auditTestContext(query string) *gin.Context {
+	gin.SetMode(gin.TestMode)
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest("GET", "/api/audit-log?"+query, nil)
+	return c
+}
+
+func TestParseAuditFilter(t *testing.T) {
+	c := auditTestContext("userId=7&action=update&entityType=roles&entityId=r1&requestId=abc&from=2026-03-01&to=2026-03-31")
+
+	filter, err := parseAuditFilter(c)
+	require.NoError(t, err)
+	assert.Equal(t, 7, filter.UserID)
+	assert.Equal(t, "update", filter.Action)
+	assert.Equal(t, "roles", filter.EntityType)
+	assert.Equal(t, "r1", filter.EntityID)
+	assert.Equal(t, "abc", filter.RequestID)
+	require.NotNil(t, filter.From)
+	require.NotNil(t, filter.To)
+	assert.Equal(t, time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC), *filter.From)
+	// A date in to includes the whole day
+	assert.Equal(t, time.Date(2026, 4, 1, 0, 0, 0, 0, time.UTC), *filter.To)
+}
+
+func TestParseAuditFilterTimestampsAndErrors(t *testing.T) {
+	filter, err := parseAuditFilter(auditTestContext("to=2026-03-31T12:00:00Z"))
+	require.NoError(t, err)
+	assert.Nil(t, filter.From)
+	assert.Equal(t, time.Date(2026, 3, 31, 12, 0, 0, 0, time.UTC), *filter.To)
+
+	_, err = parseAuditFilter(auditTestContext("userId=abc"))
+	assert.Error(t, err)
+	_, err = parseAuditFilter(auditTestContext("from=yesterday"))
+	assert.Error(t, err)
+}
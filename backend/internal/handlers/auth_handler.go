@@ -3,11 +3,14 @@ package handlers
 import (
 	"crypto/rand"
 	"database/sql"
+	"errors"
 	"fmt"
 	"math/big"
 	"net/http"
 	"os"
+	"strconv"
 
+	"classmate-central/internal/database"
 	"classmate-central/internal/logger"
 	"classmate-central/internal/middleware"
 	"classmate-central/internal/models"
@@ -21,27 +24,66 @@ import (
 )
 
 type AuthHandler struct {
-	userRepo     *repository.UserRepository
-	companyRepo  *repository.CompanyRepository
-	roleRepo     *repository.RoleRepository
-	settingsRepo *repository.SettingsRepository
-	emailService *services.EmailService
-	branchRepo   *repository.BranchRepository
-	db           *sql.DB
+	userRepo             *repository.UserRepository
+	companyRepo          *repository.CompanyRepository
+	roleRepo             *repository.RoleRepository
+	settingsRepo         *repository.SettingsRepository
+	emailService         *services.EmailService
+	branchRepo           *repository.BranchRepository
+	sessionService       *services.SessionService
+	twoFactorService     *services.TwoFactorService
+	accountService       *services.AccountService
+	loginSecurityService *services.LoginSecurityService
+	ssoService           *services.SSOService
+	planService          *services.PlanService
+	db                   *sql.DB
 }
 
-func NewAuthHandler(userRepo *repository.UserRepository, companyRepo *repository.CompanyRepository, roleRepo *repository.RoleRepository, settingsRepo *repository.SettingsRepository, emailService *services.EmailService, branchRepo *repository.BranchRepository, db *sql.DB) *AuthHandler {
+func NewAuthHandler(
+	userRepo *repository.UserRepository,
+	companyRepo *repository.CompanyRepository,
+	roleRepo *repository.RoleRepository,
+	settingsRepo *repository.SettingsRepository,
+	emailService *services.EmailService,
+	branchRepo *repository.BranchRepository,
+	sessionService *services.SessionService,
+	twoFactorService *services.TwoFactorService,
+	accountService *services.AccountService,
+	loginSecurityService *services.LoginSecurityService,
+	ssoService *services.SSOService,
+	planService *services.PlanService,
+	db *sql.DB,
+) *AuthHandler {
 	return &AuthHandler{
-		userRepo:     userRepo,
-		db:           db,
-		companyRepo:  companyRepo,
-		roleRepo:     roleRepo,
-		settingsRepo: settingsRepo,
-		emailService: emailService,
-		branchRepo:   branchRepo,
+		userRepo:             userRepo,
+		db:                   db,
+		companyRepo:          companyRepo,
+		roleRepo:             roleRepo,
+		settingsRepo:         settingsRepo,
+		emailService:         emailService,
+		branchRepo:           branchRepo,
+		sessionService:       sessionService,
+		twoFactorService:     twoFactorService,
+		accountService:       accountService,
+		loginSecurityService: loginSecurityService,
+		ssoService:           ssoService,
+		planService:          planService,
 	}
 }
 
+// startSession opens a server-side session for a fresh login and issues its token pair
+func (h *AuthHandler) startSession(c *gin.Context, user *models.User, companyID string, currentBranchID *string, twoFactorVerified bool) (string, string, error) {
+	session, refreshToken, err := h.sessionService.Start(user.ID, companyID, currentBranchID, c.Request.UserAgent(), c.ClientIP(), twoFactorVerified)
+	if err != nil {
+		return "", "", err
+	}
+	token, err := middleware.GenerateToken(user.ID, user.Email, session.ID, session.ContextVersion)
+	if err != nil {
+		return "", "", err
+	}
+	return token, refreshToken, nil
+}
+
 // Helper to generate 6-char alphanumeric code
 func generateVerificationCode() string {
 	const letters = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789" // avoid confusing chars
@@ -143,6 +185,9 @@ func (h *AuthHandler) Register(c *gin.Context) {
 		branchCreated = true
 	}
 
+	// The new company has no user yet; its setup is audited as a system change of this request
+	registrationActor := database.Actor{CompanyID: company.ID, IP: c.ClientIP(), RequestID: c.GetString("request_id")}
+
 	// Create default settings for the new company and branch
 	defaultSettings := &models.Settings{
 		CenterName: req.CompanyName,
@@ -151,18 +196,22 @@ func (h *AuthHandler) Register(c *gin.Context) {
 		CompanyID:  company.ID,
 		BranchID:   defaultBranchID,
 	}
-	if err := h.settingsRepo.Update(defaultSettings, company.ID, defaultBranchID); err != nil {
+	if err := h.settingsRepo.Update(defaultSettings, defaultBranchID, registrationActor); err != nil {
 		// Log error but don't fail registration - settings can be created later
 		logger.Warn("Failed to create default settings", logger.ErrorField(err), zap.String("companyId", company.ID))
 	}
 
 	// Create default roles for the new company using SQL function
-	_, err = h.companyRepo.DB().Exec("SELECT create_default_roles_for_company($1)", company.ID)
+	_, err = database.Tenant(h.companyRepo.DB(), company.ID).Exec("SELECT create_default_roles_for_company($1)", company.ID)
 	if err != nil {
 		logger.Warn("Failed to create default roles for company", logger.ErrorField(err), zap.String("companyId", company.ID))
 		// Continue registration even if role creation fails
 	} else {
 		logger.Info("Default roles created", zap.String("companyId", company.ID))
+		// Teachers only see their own groups, lessons and students by default
+		if _, err := database.Tenant(h.companyRepo.DB(), company.ID).Exec("SELECT apply_default_permission_scopes($1)", company.ID); err != nil {
+			logger.Warn("Failed to apply default permission scopes", logger.ErrorField(err), zap.String("companyId", company.ID))
+		}
 	}
 
 	// For the first user of the company, grant admin role by default
@@ -203,7 +252,7 @@ func (h *AuthHandler) Register(c *gin.Context) {
 
 	// Assign user to default branch (only if branch was created successfully)
 	if branchCreated {
-		if err := branchRepo.AssignUserToBranch(user.ID, defaultBranchID, user.RoleID, company.ID, nil); err != nil {
+		if err := branchRepo.AssignUserToBranch(user.ID, defaultBranchID, user.RoleID, nil, registrationActor); err != nil {
 			logger.Error("Failed to assign user to default branch", logger.ErrorField(err), zap.Int("userId", user.ID), zap.String("branchId", defaultBranchID), zap.String("companyId", company.ID))
 			// This is critical - user won't have access to any branch
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to assign user to default branch. Please contact support."})
@@ -218,7 +267,7 @@ func (h *AuthHandler) Register(c *gin.Context) {
 
 	// Assign admin role to the first user
 	if adminRole != nil {
-		err = h.userRepo.AssignRoleToUser(user.ID, adminRoleID, company.ID, nil)
+		err = h.userRepo.AssignRoleToUser(user.ID, adminRoleID, nil, registrationActor)
 		if err != nil {
 			logger.Error("Failed to assign admin role to user", logger.ErrorField(err), zap.Int("userId", user.ID), zap.String("roleId", adminRoleID), zap.String("companyId", company.ID))
 			// Log error but don't fail registration
@@ -235,12 +284,6 @@ func (h *AuthHandler) Register(c *gin.Context) {
 		userWithRoles = user
 	}
 
-	// Get permissions for token
-	permissions := []string{}
-	if userWithRoles != nil {
-		permissions = userWithRoles.Permissions
-	}
-
 	// Get user's branches (already assigned to default branch)
 	branches, err := branchRepo.GetUserBranches(user.ID, company.ID)
 	if err != nil {
@@ -252,27 +295,18 @@ func (h *AuthHandler) Register(c *gin.Context) {
 
 	// Get default branch
 	var currentBranchID *string
-	branchIDs := make([]string, len(branches))
-	for i, branch := range branches {
-		branchIDs[i] = branch.ID
-	}
 	if len(branches) > 0 {
 		currentBranchID = &branches[0].ID
 	}
 
-	// Generate tokens with role, permissions, and branch info
-	token, err := middleware.GenerateToken(user.ID, user.Email, user.RoleID, permissions, currentBranchID, branchIDs)
+	// Start a session in the default branch
+	token, refreshToken, err := h.startSession(c, user, company.ID, currentBranchID, false)
 	if err != nil {
+		logger.Error("Failed to start session", logger.ErrorField(err), zap.Int("userId", user.ID))
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error generating token"})
 		return
 	}
 
-	refreshToken, err := middleware.GenerateRefreshToken(user.ID, user.Email, user.RoleID, permissions, currentBranchID, branchIDs)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error generating refresh token"})
-		return
-	}
-
 	if userWithRoles != nil {
 		user = userWithRoles
 	}
@@ -306,34 +340,135 @@ func (h *AuthHandler) Login(c *gin.Context) {
 	}
 
 	// Get user
+	attempt := loginAttempt(c, req.Email)
 	user, err := h.userRepo.GetByEmail(req.Email)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
 		return
 	}
 	if user == nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
+		h.loginSecurityService.RecordUnknownEmail(attempt)
+		respondInvalidCredentials(c)
+		return
+	}
+
+	// A locked account is refused before the password is checked, with the same answer as a
+	// wrong password
+	lockedFor, err := h.loginSecurityService.LockedFor(user, attempt)
+	if err != nil {
+		logger.Error("Failed to check account lockout", logger.ErrorField(err), zap.Int("userId", user.ID))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+	if lockedFor > 0 {
+		respondInvalidCredentials(c)
 		return
 	}
 
 	// Check password
 	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.Password)); err != nil {
+		h.respondLoginFailure(c, user, attempt, services.LoginFailurePassword)
+		return
+	}
+
+	h.finishLogin(c, user, attempt)
+}
+
+// finishLogin continues a login whose first factor (password or SSO) succeeded. With 2FA
+// enabled it only opens a challenge and tokens are issued by LoginTwoFactor.
+func (h *AuthHandler) finishLogin(c *gin.Context, user *models.User, attempt services.LoginAttempt) {
+	twoFactorEnabled, err := h.twoFactorService.IsEnabled(user.ID)
+	if err != nil {
+		logger.Error("Failed to check two-factor authentication", logger.ErrorField(err), zap.Int("userId", user.ID))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+	if twoFactorEnabled {
+		challengeToken, expiresAt, err := h.twoFactorService.CreateChallenge(user.ID, c.ClientIP())
+		if err != nil {
+			logger.Error("Failed to create two-factor challenge", logger.ErrorField(err), zap.Int("userId", user.ID))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+			return
+		}
+		c.JSON(http.StatusOK, models.TwoFactorChallengeResponse{
+			TwoFactorRequired: true,
+			ChallengeToken:    challengeToken,
+			ExpiresAt:         expiresAt,
+		})
+		return
+	}
+
+	h.recordLoginSuccess(user, attempt)
+	h.completeLogin(c, user, false)
+}
+
+// LoginTwoFactor is the second step of a login with 2FA: it answers the challenge issued by
+// Login with a TOTP or recovery code and starts a session that counts as 2FA-verified
+func (h *AuthHandler) LoginTwoFactor(c *gin.Context) {
+	var req models.TwoFactorLoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": validation.FormatValidationErrors(err)})
+		return
+	}
+	if req.Code == "" && req.RecoveryCode == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "code or recoveryCode is required"})
+		return
+	}
+
+	userID, err := h.twoFactorService.CompleteChallenge(req.ChallengeToken, req.Code, req.RecoveryCode)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrTwoFactorInvalidCode):
+			user, getErr := h.userRepo.GetByID(userID)
+			if getErr != nil || user == nil {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid two-factor code"})
+				return
+			}
+			h.respondLoginFailure(c, user, loginAttempt(c, user.Email), services.LoginFailureTwoFactor)
+		case errors.Is(err, services.ErrTwoFactorChallengeInvalid), errors.Is(err, services.ErrTwoFactorNotEnabled):
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Login challenge is invalid or expired, please sign in again"})
+		default:
+			logger.Error("Failed to complete two-factor login", logger.ErrorField(err))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		}
+		return
+	}
+
+	user, err := h.userRepo.GetByID(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+	if user == nil {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
 		return
 	}
 
+	// The account may have been locked by failed codes on an earlier challenge
+	attempt := loginAttempt(c, user.Email)
+	lockedFor, err := h.loginSecurityService.LockedFor(user, attempt)
+	if err != nil {
+		logger.Error("Failed to check account lockout", logger.ErrorField(err), zap.Int("userId", user.ID))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+	if lockedFor > 0 {
+		respondAccountLocked(c, lockedFor)
+		return
+	}
+
+	h.recordLoginSuccess(user, attempt)
+	h.completeLogin(c, user, true)
+}
+
+// completeLogin starts a session for an authenticated user and responds with the token pair
+func (h *AuthHandler) completeLogin(c *gin.Context, user *models.User, twoFactorVerified bool) {
 	// Load user with roles and permissions
 	userWithRoles, err := h.userRepo.GetUserWithRoles(user.ID, user.CompanyID)
 	if err != nil {
 		userWithRoles = user
 	}
 
-	// Get permissions for token
-	permissions := []string{}
-	if userWithRoles != nil {
-		permissions = userWithRoles.Permissions
-	}
-
 	// Get user's branches
 	branchRepo := repository.NewBranchRepository(h.db)
 	branches, err := branchRepo.GetUserBranches(user.ID, user.CompanyID)
@@ -344,27 +479,18 @@ func (h *AuthHandler) Login(c *gin.Context) {
 
 	// Get default branch
 	var currentBranchID *string
-	branchIDs := make([]string, len(branches))
-	for i, branch := range branches {
-		branchIDs[i] = branch.ID
-	}
 	if len(branches) > 0 {
 		currentBranchID = &branches[0].ID
 	}
 
-	// Generate tokens with role, permissions, and branch info
-	token, err := middleware.GenerateToken(user.ID, user.Email, user.RoleID, permissions, currentBranchID, branchIDs)
+	// Start a session in the default branch
+	token, refreshToken, err := h.startSession(c, user, user.CompanyID, currentBranchID, twoFactorVerified)
 	if err != nil {
+		logger.Error("Failed to start session", logger.ErrorField(err), zap.Int("userId", user.ID))
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error generating token"})
 		return
 	}
 
-	refreshToken, err := middleware.GenerateRefreshToken(user.ID, user.Email, user.RoleID, permissions, currentBranchID, branchIDs)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error generating refresh token"})
-		return
-	}
-
 	if userWithRoles != nil {
 		user = userWithRoles
 	}
@@ -380,6 +506,8 @@ func (h *AuthHandler) Login(c *gin.Context) {
 	})
 }
 
+// RefreshToken rotates the refresh token of a session and issues a new access token.
+// Each refresh token works once; presenting a used one revokes the whole session.
 func (h *AuthHandler) RefreshToken(c *gin.Context) {
 	var req struct {
 		RefreshToken string `json:"refreshToken" binding:"required"`
@@ -390,15 +518,19 @@ func (h *AuthHandler) RefreshToken(c *gin.Context) {
 		return
 	}
 
-	// Validate refresh token
-	claims, err := middleware.ValidateToken(req.RefreshToken)
+	session, refreshToken, err := h.sessionService.Refresh(req.RefreshToken, c.ClientIP())
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid refresh token"})
+		if errors.Is(err, repository.ErrRefreshTokenInvalid) || errors.Is(err, repository.ErrRefreshTokenReused) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid refresh token"})
+			return
+		}
+		logger.Error("Failed to rotate refresh token", logger.ErrorField(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error generating refresh token"})
 		return
 	}
 
 	// Get user with roles and permissions
-	user, err := h.userRepo.GetByID(claims.UserID)
+	user, err := h.userRepo.GetByID(session.UserID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
 		return
@@ -414,12 +546,6 @@ func (h *AuthHandler) RefreshToken(c *gin.Context) {
 		userWithRoles = user
 	}
 
-	// Use permissions from token if available, otherwise load from DB
-	permissions := claims.Permissions
-	if len(permissions) == 0 && userWithRoles != nil {
-		permissions = userWithRoles.Permissions
-	}
-
 	// Get user's branches
 	branchRepo := repository.NewBranchRepository(h.db)
 	branches, err := branchRepo.GetUserBranches(user.ID, user.CompanyID)
@@ -430,31 +556,22 @@ func (h *AuthHandler) RefreshToken(c *gin.Context) {
 
 	// Get current or default branch
 	var currentBranchID *string
-	branchIDs := make([]string, len(branches))
 	for i, branch := range branches {
-		branchIDs[i] = branch.ID
+		// Preserve the branch selected in this session while the user still has access to it
+		if session.CurrentBranchID != nil && branch.ID == *session.CurrentBranchID {
+			currentBranchID = &branches[i].ID
+		}
 	}
-
-	// Try to preserve current branch from token, otherwise use first available
-	if claims.CurrentBranchID != nil {
-		currentBranchID = claims.CurrentBranchID
-	} else if len(branches) > 0 {
+	if currentBranchID == nil && len(branches) > 0 {
 		currentBranchID = &branches[0].ID
 	}
 
-	// Generate new tokens with role, permissions, and branch info
-	token, err := middleware.GenerateToken(claims.UserID, claims.Email, user.RoleID, permissions, currentBranchID, branchIDs)
+	token, err := middleware.GenerateToken(user.ID, user.Email, session.ID, session.ContextVersion)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error generating token"})
 		return
 	}
 
-	refreshToken, err := middleware.GenerateRefreshToken(claims.UserID, claims.Email, user.RoleID, permissions, currentBranchID, branchIDs)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error generating refresh token"})
-		return
-	}
-
 	if userWithRoles != nil {
 		user = userWithRoles
 	}
@@ -494,6 +611,23 @@ func (h *AuthHandler) Me(c *gin.Context) {
 		return
 	}
 
+	// Report what the user may do in the current branch, which may differ from the company-wide roles
+	user.Permissions = middleware.GetUserPermissions(c)
+	if scopes, ok := c.Get("permission_scopes"); ok {
+		user.PermissionScopes, _ = scopes.(map[string]string)
+	}
+	if teacherID := c.GetString("teacher_id"); teacherID != "" {
+		user.TeacherID = &teacherID
+	}
+	user.TwoFactorEnabled = c.GetBool("two_factor_enabled")
+	user.TwoFactorRequired = c.GetBool("two_factor_required")
+	user.CompanyStatus = c.GetString("company_status")
+	user.PlanFeatures = c.GetStringSlice("plan_features")
+	user.PlatformAdmin = c.GetBool("platform_admin")
+	if impersonatedBy := c.GetInt("impersonated_by"); impersonatedBy != 0 {
+		user.ImpersonatedBy = &impersonatedBy
+	}
+
 	c.JSON(http.StatusOK, user)
 }
 
@@ -560,6 +694,9 @@ func (h *AuthHandler) InviteUser(c *gin.Context) {
 		c.JSON(http.StatusConflict, gin.H{"error": "User with this email already exists"})
 		return
 	}
+	if planLimitReached(c, h.planService, models.PlanResourceUsers) {
+		return
+	}
 
 	// Generate temp password and verification code
 	tempPassword := generateVerificationCode()
@@ -585,20 +722,15 @@ func (h *AuthHandler) InviteUser(c *gin.Context) {
 		return
 	}
 
-	if err := h.userRepo.AssignRoleToUser(user.ID, req.RoleID, companyID.(string), nil); err != nil {
+	assignedBy := currentUserID(c)
+	if err := h.userRepo.AssignRoleToUser(user.ID, req.RoleID, assignedBy, auditActor(c)); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error assigning role: " + err.Error()})
 		return
 	}
 
 	// Assign user to selected branches
-	userID, _ := c.Get("user_id")
-	var assignedBy *int
-	if uid, ok := userID.(int); ok {
-		assignedBy = &uid
-	}
-
 	for _, branchID := range req.BranchIDs {
-		if err := h.branchRepo.AssignUserToBranch(user.ID, branchID, &req.RoleID, companyID.(string), assignedBy); err != nil {
+		if err := h.branchRepo.AssignUserToBranch(user.ID, branchID, &req.RoleID, assignedBy, auditActor(c)); err != nil {
 			logger.Error("Failed to assign user to branch", logger.ErrorField(err), zap.Int("userId", user.ID), zap.String("branchId", branchID))
 			// Continue with other branches, but log the error
 		}
@@ -658,7 +790,7 @@ func (h *AuthHandler) AcceptInvite(c *gin.Context) {
 
 	logger.Info("Invite completed", zap.Int("userId", user.ID), zap.String("email", user.Email), zap.String("companyId", user.CompanyID))
 
-	// Load roles/permissions for token - ensure we use the correct company_id
+	// Load roles/permissions for the response - ensure we use the correct company_id
 	userWithRoles, err := h.userRepo.GetUserWithRoles(user.ID, user.CompanyID)
 	if err != nil {
 		logger.Warn("Failed to load user roles, using basic user", logger.ErrorField(err), zap.Int("userId", user.ID), zap.String("companyId", user.CompanyID))
@@ -667,11 +799,6 @@ func (h *AuthHandler) AcceptInvite(c *gin.Context) {
 		logger.Info("User roles loaded", zap.Int("userId", user.ID), zap.Int("rolesCount", len(user.Roles)), zap.Int("permissionsCount", len(user.Permissions)))
 	}
 
-	perms := []string{}
-	if user.Permissions != nil {
-		perms = user.Permissions
-	}
-
 	// Get user's branches
 	branchRepo := repository.NewBranchRepository(h.db)
 	branches, err := branchRepo.GetUserBranches(user.ID, user.CompanyID)
@@ -682,25 +809,17 @@ func (h *AuthHandler) AcceptInvite(c *gin.Context) {
 
 	// Get default branch
 	var currentBranchID *string
-	branchIDs := make([]string, len(branches))
-	for i, branch := range branches {
-		branchIDs[i] = branch.ID
-	}
 	if len(branches) > 0 {
 		currentBranchID = &branches[0].ID
 	}
 
-	// Generate tokens with branch info
-	token, err := middleware.GenerateToken(user.ID, user.Email, user.RoleID, perms, currentBranchID, branchIDs)
+	// Start a session in the default branch
+	token, refreshToken, err := h.startSession(c, user, user.CompanyID, currentBranchID, false)
 	if err != nil {
+		logger.Error("Failed to start session", logger.ErrorField(err), zap.Int("userId", user.ID))
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error generating token"})
 		return
 	}
-	refreshToken, err := middleware.GenerateRefreshToken(user.ID, user.Email, user.RoleID, perms, currentBranchID, branchIDs)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error generating refresh token"})
-		return
-	}
 
 	// Add branches to user object
 	user.Branches = branches
@@ -731,17 +850,104 @@ func (h *AuthHandler) GetUsers(c *gin.Context) {
 	c.JSON(http.StatusOK, users)
 }
 
-// Logout handles user logout
-// Note: For full token blacklist functionality, implement Redis or database-based token blacklist
+// Logout revokes the session of the current access token
 func (h *AuthHandler) Logout(c *gin.Context) {
-	// In a stateless JWT system, logout is handled client-side by removing tokens
-	// For enhanced security, you can implement token blacklisting here:
-	// 1. Extract token from Authorization header
-	// 2. Add token to blacklist (Redis or database)
-	// 3. Check blacklist in AuthMiddleware before validating token
+	userID := c.GetInt("user_id")
+	sessionID := c.GetString("session_id")
+	if err := h.sessionService.Revoke(sessionID, userID, c.GetString("company_id"), repository.SessionRevokeLogout); err != nil && !errors.Is(err, sql.ErrNoRows) {
+		logger.Error("Failed to revoke session", logger.ErrorField(err), zap.Int("userId", userID), zap.String("sessionId", sessionID))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to log out"})
+		return
+	}
 
-	// For now, we just return success - client should remove tokens
 	c.JSON(http.StatusOK, gin.H{
 		"message": "Logged out successfully",
 	})
 }
+
+// GetSessions lists the active sessions of the current user
+func (h *AuthHandler) GetSessions(c *gin.Context) {
+	sessions, err := h.sessionService.List(c.GetInt("user_id"), c.GetString("company_id"), c.GetString("session_id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, sessions)
+}
+
+// RevokeSession logs one of the current user's devices out
+func (h *AuthHandler) RevokeSession(c *gin.Context) {
+	reason := repository.SessionRevokeUser
+	if c.Param("id") == c.GetString("session_id") {
+		reason = repository.SessionRevokeLogout
+	}
+	if err := h.sessionService.Revoke(c.Param("id"), c.GetInt("user_id"), c.GetString("company_id"), reason); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Session not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Session revoked"})
+}
+
+// RevokeOtherSessions logs the current user out everywhere except the current device
+func (h *AuthHandler) RevokeOtherSessions(c *gin.Context) {
+	revoked, err := h.sessionService.RevokeAll(c.GetInt("user_id"), c.GetString("company_id"), c.GetString("session_id"), repository.SessionRevokeUser)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Sessions revoked", "revoked": revoked})
+}
+
+// GetUserSessions lists the active sessions of a user of the company (admin)
+func (h *AuthHandler) GetUserSessions(c *gin.Context) {
+	userID, err := strconv.Atoi(c.Param("userId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+	sessions, err := h.sessionService.List(userID, c.GetString("company_id"), c.GetString("session_id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, sessions)
+}
+
+// RevokeUserSession closes one session of a user of the company (admin)
+func (h *AuthHandler) RevokeUserSession(c *gin.Context) {
+	userID, err := strconv.Atoi(c.Param("userId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+	if err := h.sessionService.Revoke(c.Param("id"), userID, c.GetString("company_id"), repository.SessionRevokeAdmin); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Session not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	logger.Info("Session revoked by admin", zap.Int("userId", userID), zap.String("sessionId", c.Param("id")), zap.Int("revokedBy", c.GetInt("user_id")))
+	c.JSON(http.StatusOK, gin.H{"message": "Session revoked"})
+}
+
+// RevokeUserSessions closes every session of a user of the company (admin)
+func (h *AuthHandler) RevokeUserSessions(c *gin.Context) {
+	userID, err := strconv.Atoi(c.Param("userId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+	revoked, err := h.sessionService.RevokeAll(userID, c.GetString("company_id"), "", repository.SessionRevokeAdmin)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	logger.Info("All sessions revoked by admin", zap.Int("userId", userID), zap.Int64("count", revoked), zap.Int("revokedBy", c.GetInt("user_id")))
+	c.JSON(http.StatusOK, gin.H{"message": "Sessions revoked", "revoked": revoked})
+}
@@ -0,0 +1,121 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"classmate-central/internal/logger"
+	"classmate-central/internal/models"
+	"classmate-central/internal/repository"
+	"classmate-central/internal/services"
+	"classmate-central/internal/validation"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// respondAccountError maps account flow errors to responses
+func respondAccountError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrAccountTokenInvalid):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Link is invalid or has expired"})
+	case errors.Is(err, services.ErrWrongPassword):
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Current password is incorrect"})
+	case errors.Is(err, services.ErrPasswordUnchanged), errors.Is(err, services.ErrEmailUnchanged):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, repository.ErrEmailTaken):
+		c.JSON(http.StatusConflict, gin.H{"error": "Email is already in use"})
+	default:
+		logger.Error("Account operation failed", logger.ErrorField(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+	}
+}
+
+// ForgotPassword emails a password reset link. The response is the same whether or not
+// the email is registered.
+func (h *AuthHandler) ForgotPassword(c *gin.Context) {
+	var req models.ForgotPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": validation.FormatValidationErrors(err)})
+		return
+	}
+
+	if err := h.accountService.RequestPasswordReset(req.Email); err != nil {
+		respondAccountError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "If this email is registered, a password reset link has been sent"})
+}
+
+// ResetPassword sets a new password with the token from the reset email.
+// All sessions of the user are closed, so every device has to sign in again.
+func (h *AuthHandler) ResetPassword(c *gin.Context) {
+	var req models.ResetPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": validation.FormatValidationErrors(err)})
+		return
+	}
+
+	if err := h.accountService.ResetPassword(req.Token, req.Password); err != nil {
+		respondAccountError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Password has been reset, please sign in"})
+}
+
+// ChangePassword changes the password of the current user. Every session is closed and a
+// new one is started for the current device, so the response carries a fresh token pair.
+func (h *AuthHandler) ChangePassword(c *gin.Context) {
+	var req models.ChangePasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": validation.FormatValidationErrors(err)})
+		return
+	}
+
+	user, err := h.accountService.ChangePassword(c.GetInt("user_id"), req.CurrentPassword, req.NewPassword)
+	if err != nil {
+		respondAccountError(c, err)
+		return
+	}
+	logger.Info("Password changed, starting a new session", zap.Int("userId", user.ID))
+	h.completeLogin(c, user, false)
+}
+
+// RequestEmailChange sends a confirmation link to the new address; the email changes only
+// after the link is opened
+func (h *AuthHandler) RequestEmailChange(c *gin.Context) {
+	var req models.ChangeEmailRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": validation.FormatValidationErrors(err)})
+		return
+	}
+	if err := validation.ValidateEmail(req.NewEmail); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.accountService.RequestEmailChange(c.GetInt("user_id"), req.Password, req.NewEmail); err != nil {
+		respondAccountError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "A confirmation link has been sent to the new email"})
+}
+
+// ConfirmEmailChange switches the account to the new, now verified, address
+func (h *AuthHandler) ConfirmEmailChange(c *gin.Context) {
+	var req models.ConfirmEmailChangeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": validation.FormatValidationErrors(err)})
+		return
+	}
+
+	user, err := h.accountService.ConfirmEmailChange(req.Token)
+	if err != nil {
+		respondAccountError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Email has been changed",
+		"email":   user.Email,
+	})
+}
@@ -0,0 +1,132 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"classmate-central/internal/logger"
+	"classmate-central/internal/middleware"
+	"classmate-central/internal/models"
+	"classmate-central/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultLoginEventsLimit = 50
+	maxLoginEventsLimit     = 200
+)
+
+// loginAttempt describes the client of the current request for the login audit trail
+func loginAttempt(c *gin.Context, email string) services.LoginAttempt {
+	return services.LoginAttempt{
+		Email:     email,
+		IP:        c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+		Country:   middleware.ClientCountry(c),
+	}
+}
+
+// respondAccountLocked refuses the second step of a login while the account is locked. Only
+// someone who knew the password gets there, so the lock does not reveal a registered email.
+func respondAccountLocked(c *gin.Context, lockedFor time.Duration) {
+	retryAfter := int(math.Ceil(lockedFor.Seconds()))
+	c.Header("Retry-After", strconv.Itoa(retryAfter))
+	c.JSON(http.StatusTooManyRequests, gin.H{
+		"error":      "Too many failed login attempts, the account is temporarily locked",
+		"code":       "account_locked",
+		"retryAfter": retryAfter,
+	})
+}
+
+// respondInvalidCredentials answers a failed first login step the same way for unknown emails,
+// wrong passwords and locked accounts, so the response does not reveal which emails are
+// registered. The owner learns about a lock from the login events and the email alert.
+func respondInvalidCredentials(c *gin.Context) {
+	c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
+}
+
+// respondLoginFailure counts a failed login toward the lockout and responds accordingly
+func (h *AuthHandler) respondLoginFailure(c *gin.Context, user *models.User, attempt services.LoginAttempt, reason string) {
+	lockedFor, err := h.loginSecurityService.RecordFailure(user, attempt, reason)
+	if err != nil {
+		logger.Error("Failed to record failed login", logger.ErrorField(err), zap.Int("userId", user.ID))
+	}
+	if reason != services.LoginFailureTwoFactor {
+		respondInvalidCredentials(c)
+		return
+	}
+	if lockedFor > 0 {
+		respondAccountLocked(c, lockedFor)
+		return
+	}
+	c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid two-factor code"})
+}
+
+// recordLoginSuccess resets the lockout counter and audits the login; errors do not block the login
+func (h *AuthHandler) recordLoginSuccess(user *models.User, attempt services.LoginAttempt) {
+	if err := h.loginSecurityService.RecordSuccess(user, attempt); err != nil {
+		logger.Error("Failed to record successful login", logger.ErrorField(err), zap.Int("userId", user.ID))
+	}
+}
+
+// loginEventsLimit reads the ?limit= query parameter
+func loginEventsLimit(c *gin.Context) int {
+	limit, err := strconv.Atoi(c.Query("limit"))
+	if err != nil || limit <= 0 {
+		return defaultLoginEventsLimit
+	}
+	if limit > maxLoginEventsLimit {
+		return maxLoginEventsLimit
+	}
+	return limit
+}
+
+// GetLoginEvents lists the latest login attempts of the current user
+func (h *AuthHandler) GetLoginEvents(c *gin.Context) {
+	events, err := h.loginSecurityService.ListEvents(c.GetInt("user_id"), c.GetString("company_id"), loginEventsLimit(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, events)
+}
+
+// GetUserLoginEvents lists the latest login attempts of a user of the company (admin)
+func (h *AuthHandler) GetUserLoginEvents(c *gin.Context) {
+	userID, err := strconv.Atoi(c.Param("userId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+	events, err := h.loginSecurityService.ListEvents(userID, c.GetString("company_id"), loginEventsLimit(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, events)
+}
+
+// UnlockUser lifts the lockout of a user of the company (admin)
+func (h *AuthHandler) UnlockUser(c *gin.Context) {
+	userID, err := strconv.Atoi(c.Param("userId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+	if err := h.loginSecurityService.Unlock(userID, c.GetString("company_id")); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	logger.Info("User unlocked by admin", zap.Int("userId", userID), zap.Int("unlockedBy", c.GetInt("user_id")))
+	c.JSON(http.StatusOK, gin.H{"message": "User unlocked"})
+}
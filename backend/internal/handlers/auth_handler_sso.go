@@ -0,0 +1,193 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"net/url"
+
+	"classmate-central/internal/logger"
+	"classmate-central/internal/models"
+	"classmate-central/internal/oidc"
+	"classmate-central/internal/services"
+	"classmate-central/internal/validation"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// ssoErrorCode maps an SSO failure to the error code passed to the frontend callback page
+func ssoErrorCode(err error) string {
+	var limitErr *services.PlanLimitError
+	switch {
+	case errors.Is(err, services.ErrSSOLoginInvalid):
+		return "sso_expired"
+	case errors.Is(err, services.ErrSSONotConfigured):
+		return "sso_not_configured"
+	case errors.Is(err, services.ErrSSOEmailNotVerified):
+		return "sso_email_not_verified"
+	case errors.Is(err, services.ErrSSODomainNotAllowed):
+		return "sso_domain_not_allowed"
+	case errors.Is(err, services.ErrSSOAccountInOtherCompany):
+		return "sso_account_conflict"
+	case errors.Is(err, services.ErrSSOProvisioningDisabled):
+		return "sso_no_account"
+	case errors.As(err, &limitErr):
+		return "sso_plan_limit"
+	default:
+		return "sso_failed"
+	}
+}
+
+// redirectSSOError sends the browser back to the frontend with an error code
+func redirectSSOError(c *gin.Context, code string) {
+	c.Redirect(http.StatusFound, services.FrontendCallbackURL(url.Values{"error": {code}}))
+}
+
+// DiscoverSSO tells the login page whether an email signs in through its company's SSO
+func (h *AuthHandler) DiscoverSSO(c *gin.Context) {
+	var req models.SSODiscoverRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": validation.FormatValidationErrors(err)})
+		return
+	}
+	companyID, err := h.ssoService.CompanyForEmail(req.Email)
+	if err != nil {
+		logger.Error("Failed to look up SSO for email domain", logger.ErrorField(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+	if companyID == "" {
+		c.JSON(http.StatusOK, models.SSODiscoverResponse{})
+		return
+	}
+	c.JSON(http.StatusOK, models.SSODiscoverResponse{
+		SSOEnabled: true,
+		LoginURL:   "/api/auth/sso/" + url.PathEscape(companyID) + "/login",
+	})
+}
+
+// StartSSO redirects the browser to the company's OpenID provider
+func (h *AuthHandler) StartSSO(c *gin.Context) {
+	authURL, err := h.ssoService.Start(c.Request.Context(), c.Param("companyId"))
+	if err != nil {
+		if !errors.Is(err, services.ErrSSONotConfigured) {
+			logger.Error("Failed to start SSO login", logger.ErrorField(err), zap.String("companyId", c.Param("companyId")))
+		}
+		redirectSSOError(c, ssoErrorCode(err))
+		return
+	}
+	c.Redirect(http.StatusFound, authURL)
+}
+
+// SSOCallback receives the redirect from the provider. The browser is sent on to the frontend
+// with a one-time code that POST /api/auth/sso/exchange turns into a session, so no tokens
+// appear in URLs.
+func (h *AuthHandler) SSOCallback(c *gin.Context) {
+	if providerError := c.Query("error"); providerError != "" {
+		logger.Info("SSO login cancelled at provider", zap.String("error", providerError))
+		redirectSSOError(c, "sso_cancelled")
+		return
+	}
+	if c.Query("state") == "" || c.Query("code") == "" {
+		redirectSSOError(c, "sso_expired")
+		return
+	}
+
+	user, err := h.ssoService.Callback(c.Request.Context(), c.Query("state"), c.Query("code"))
+	if err != nil {
+		switch {
+		case errors.Is(err, oidc.ErrInvalidIDToken), errors.Is(err, oidc.ErrExchangeFailed):
+			logger.Warn("SSO login rejected", logger.ErrorField(err))
+		case ssoErrorCode(err) == "sso_failed":
+			logger.Error("SSO login failed", logger.ErrorField(err))
+		default:
+			logger.Info("SSO login refused", zap.String("reason", err.Error()))
+		}
+		redirectSSOError(c, ssoErrorCode(err))
+		return
+	}
+
+	code, err := h.ssoService.IssueLoginCode(user.ID)
+	if err != nil {
+		logger.Error("Failed to issue SSO login code", logger.ErrorField(err), zap.Int("userId", user.ID))
+		redirectSSOError(c, "sso_failed")
+		return
+	}
+	c.Redirect(http.StatusFound, services.FrontendCallbackURL(url.Values{"code": {code}}))
+}
+
+// ExchangeSSOCode finishes an SSO login with the code from the frontend callback page. Users
+// with 2FA enabled still answer a challenge, like after a password.
+func (h *AuthHandler) ExchangeSSOCode(c *gin.Context) {
+	var req models.SSOExchangeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": validation.FormatValidationErrors(err)})
+		return
+	}
+
+	user, err := h.ssoService.RedeemLoginCode(req.Code)
+	if err != nil {
+		if errors.Is(err, services.ErrSSOLoginInvalid) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Login code is invalid or expired, please sign in again"})
+			return
+		}
+		logger.Error("Failed to redeem SSO login code", logger.ErrorField(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+	h.finishLogin(c, user, loginAttempt(c, user.Email))
+}
+
+// GetSSOConfig returns the SSO configuration of the company
+func (h *AuthHandler) GetSSOConfig(c *gin.Context) {
+	cfg, err := h.ssoService.GetConfig(c.GetString("company_id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if cfg == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Single sign-on is not configured"})
+		return
+	}
+	c.JSON(http.StatusOK, cfg)
+}
+
+// UpdateSSOConfig creates or replaces the SSO configuration of the company
+func (h *AuthHandler) UpdateSSOConfig(c *gin.Context) {
+	var req models.SSOConfigRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": validation.FormatValidationErrors(err)})
+		return
+	}
+
+	cfg, err := h.ssoService.SaveConfig(c.Request.Context(), c.GetString("company_id"), &req)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrSSOInvalidConfig):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case errors.Is(err, services.ErrSSODomainTaken):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+	logger.Info("SSO configuration updated", zap.String("companyId", cfg.CompanyID), zap.Int("updatedBy", c.GetInt("user_id")))
+	c.JSON(http.StatusOK, cfg)
+}
+
+// DeleteSSOConfig turns SSO off for the company. Users keep their accounts and can reset a
+// password to sign in.
+func (h *AuthHandler) DeleteSSOConfig(c *gin.Context) {
+	if err := h.ssoService.DeleteConfig(c.GetString("company_id")); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Single sign-on is not configured"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	logger.Info("SSO configuration deleted", zap.String("companyId", c.GetString("company_id")), zap.Int("deletedBy", c.GetInt("user_id")))
+	c.JSON(http.StatusOK, gin.H{"message": "Single sign-on disabled"})
+}
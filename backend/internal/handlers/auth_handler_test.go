@@ -18,22 +18,35 @@ import (
 	"github.com/stretchr/testify/require"
 )
 
-func setupTestRouter(t *testing.T) (*gin.Engine, *AuthHandler, *sql.DB) {
-	gin.SetMode(gin.TestMode)
-	
-	// Setup test database
-	db := testutil.SetupTestDB(t)
-
-	// Create repositories
+// newTestAuthHandler wires the auth handler with its services the way cmd/api does
+func newTestAuthHandler(db *sql.DB) *AuthHandler {
 	userRepo := repository.NewUserRepository(db)
 	companyRepo := repository.NewCompanyRepository(db)
 	roleRepo := repository.NewRoleRepository(db)
 	settingsRepo := repository.NewSettingsRepository(db)
 	emailService := services.NewEmailService()
+	branchRepo := repository.NewBranchRepository(db)
+	sessionRepo := repository.NewSessionRepository(db)
+	tokenRepo := repository.NewAccountTokenRepository(db)
+	planService := services.NewPlanService(repository.NewPlanRepository(db), companyRepo)
+
+	return NewAuthHandler(userRepo, companyRepo, roleRepo, settingsRepo, emailService, branchRepo,
+		services.NewSessionService(sessionRepo),
+		services.NewTwoFactorService(repository.NewTwoFactorRepository(db)),
+		services.NewAccountService(userRepo, tokenRepo, emailService),
+		services.NewLoginSecurityService(userRepo, repository.NewLoginEventRepository(db), emailService),
+		services.NewSSOService(repository.NewSSORepository(db), userRepo, roleRepo, branchRepo, tokenRepo, planService),
+		planService, db)
+}
+
+func setupTestRouter(t *testing.T) (*gin.Engine, *AuthHandler, *sql.DB) {
+	gin.SetMode(gin.TestMode)
+	
+	// Setup test database
+	db := testutil.SetupTestDB(t)
 
 	// Create handler
-	branchRepo := repository.NewBranchRepository(db)
-	authHandler := NewAuthHandler(userRepo, companyRepo, roleRepo, settingsRepo, emailService, branchRepo, db)
+	authHandler := newTestAuthHandler(db)
 
 	// Setup router
 	router := gin.New()
@@ -156,3 +169,37 @@ func TestAuthHandler_Login_InvalidCredentials(t *testing.T) {
 	assert.Equal(t, http.StatusUnauthorized, w.Code)
 }
 
+
+// TestAuthHandler_Login_LockedAccountLooksLikeUnknownEmail locks an account with wrong passwords
+// and checks that neither the locking attempt nor a login while locked answers differently
+// from an email that is not registered
+func TestAuthHandler_Login_LockedAccountLooksLikeUnknownEmail(t *testing.T) {
+	router, _, db := setupTestRouter(t)
+	defer db.Close()
+	defer testutil.CleanupTestDB(t, db)
+
+	registerTenant(t, router, "locked@example.com")
+	login := func(email, password string) *httptest.ResponseRecorder {
+		loginBody, _ := json.Marshal(models.LoginRequest{Email: email, Password: password})
+		req, _ := http.NewRequest("POST", "/api/auth/login", bytes.NewBuffer(loginBody))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	unknown := login("nonexistent@example.com", "wrongpassword")
+	require.Equal(t, http.StatusUnauthorized, unknown.Code)
+
+	for attempt := 1; attempt <= services.LockoutThreshold; attempt++ {
+		w := login("locked@example.com", "wrongpassword")
+		assert.Equal(t, unknown.Code, w.Code, "attempt %d", attempt)
+		assert.Equal(t, unknown.Body.String(), w.Body.String(), "attempt %d", attempt)
+		assert.Empty(t, w.Header().Get("Retry-After"), "attempt %d", attempt)
+	}
+
+	// Even the right password is refused while locked, without telling why
+	w := login("locked@example.com", "password123")
+	assert.Equal(t, unknown.Code, w.Code)
+	assert.Equal(t, unknown.Body.String(), w.Body.String())
+}
@@ -0,0 +1,200 @@
+package handlers
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+
+	"classmate-central/internal/logger"
+	"classmate-central/internal/models"
+	"classmate-central/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// respondTwoFactorError maps 2FA service errors to responses
+func respondTwoFactorError(c *gin.Context, err error) {
+	var lockedErr *services.TwoFactorLockedError
+	switch {
+	case errors.As(err, &lockedErr):
+		retryAfter := int(math.Ceil(lockedErr.Remaining.Seconds()))
+		c.Header("Retry-After", strconv.Itoa(retryAfter))
+		c.JSON(http.StatusTooManyRequests, gin.H{
+			"error":      "Too many invalid two-factor codes, try again later",
+			"code":       "two_factor_locked",
+			"retryAfter": retryAfter,
+		})
+	case errors.Is(err, services.ErrTwoFactorInvalidCode):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid two-factor code"})
+	case errors.Is(err, services.ErrTwoFactorNotSetUp), errors.Is(err, services.ErrTwoFactorNotEnabled),
+		errors.Is(err, services.ErrTwoFactorAlreadyEnabled):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		logger.Error("Two-factor operation failed", logger.ErrorField(err), zap.Int("userId", c.GetInt("user_id")))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+	}
+}
+
+// bindTwoFactorCode reads a TOTP or recovery code from the request body
+func bindTwoFactorCode(c *gin.Context, allowRecovery bool) (models.TwoFactorCodeRequest, bool) {
+	var req models.TwoFactorCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return req, false
+	}
+	if !allowRecovery {
+		req.RecoveryCode = ""
+	}
+	if req.Code == "" && req.RecoveryCode == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "code is required"})
+		return req, false
+	}
+	return req, true
+}
+
+// markTwoFactorVerified records a fresh 2FA confirmation on the current session (step-up)
+func (h *AuthHandler) markTwoFactorVerified(c *gin.Context) error {
+	return h.sessionService.MarkTwoFactorVerified(c.GetString("session_id"), c.GetInt("user_id"))
+}
+
+// GetTwoFactorStatus reports whether the current user has 2FA enabled and must use it
+func (h *AuthHandler) GetTwoFactorStatus(c *gin.Context) {
+	status, err := h.twoFactorService.Status(c.GetInt("user_id"))
+	if err != nil {
+		respondTwoFactorError(c, err)
+		return
+	}
+	status.Required = c.GetBool("two_factor_required")
+	if verifiedAt := c.GetTime("two_factor_verified_at"); !verifiedAt.IsZero() {
+		status.VerifiedAt = &verifiedAt
+	}
+	c.JSON(http.StatusOK, status)
+}
+
+// SetupTwoFactor generates a TOTP secret and its otpauth:// URI for the QR code
+func (h *AuthHandler) SetupTwoFactor(c *gin.Context) {
+	userID := c.GetInt("user_id")
+	user, err := h.userRepo.GetByID(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+	if user == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	setup, err := h.twoFactorService.Setup(userID, user.Email)
+	if err != nil {
+		respondTwoFactorError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, setup)
+}
+
+// EnableTwoFactor confirms the enrollment with a code and returns the recovery codes (shown once)
+func (h *AuthHandler) EnableTwoFactor(c *gin.Context) {
+	req, ok := bindTwoFactorCode(c, false)
+	if !ok {
+		return
+	}
+	codes, err := h.twoFactorService.Enable(c.GetInt("user_id"), req.Code)
+	if err != nil {
+		respondTwoFactorError(c, err)
+		return
+	}
+	// The code just proved possession of the second factor
+	if err := h.markTwoFactorVerified(c); err != nil {
+		logger.Warn("Failed to record two-factor verification", logger.ErrorField(err), zap.Int("userId", c.GetInt("user_id")))
+	}
+	c.JSON(http.StatusOK, models.TwoFactorRecoveryCodesResponse{RecoveryCodes: codes})
+}
+
+// DisableTwoFactor turns 2FA off; refused while a role of the user requires it
+func (h *AuthHandler) DisableTwoFactor(c *gin.Context) {
+	if c.GetBool("two_factor_required") {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Two-factor authentication is required for your role"})
+		return
+	}
+	req, ok := bindTwoFactorCode(c, true)
+	if !ok {
+		return
+	}
+	if err := h.twoFactorService.Disable(c.GetInt("user_id"), req.Code, req.RecoveryCode); err != nil {
+		respondTwoFactorError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Two-factor authentication disabled"})
+}
+
+// RegenerateRecoveryCodes replaces the recovery codes after confirming with a TOTP code
+func (h *AuthHandler) RegenerateRecoveryCodes(c *gin.Context) {
+	req, ok := bindTwoFactorCode(c, false)
+	if !ok {
+		return
+	}
+	codes, err := h.twoFactorService.RegenerateRecoveryCodes(c.GetInt("user_id"), req.Code)
+	if err != nil {
+		respondTwoFactorError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, models.TwoFactorRecoveryCodesResponse{RecoveryCodes: codes})
+}
+
+// VerifyTwoFactor confirms a code for the current session, unlocking sensitive actions for
+// middleware.TwoFactorStepUpTTL
+func (h *AuthHandler) VerifyTwoFactor(c *gin.Context) {
+	req, ok := bindTwoFactorCode(c, true)
+	if !ok {
+		return
+	}
+	if err := h.twoFactorService.Verify(c.GetInt("user_id"), req.Code, req.RecoveryCode); err != nil {
+		respondTwoFactorError(c, err)
+		return
+	}
+	if err := h.markTwoFactorVerified(c); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record verification"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Two-factor code confirmed"})
+}
+
+// GetTwoFactorPolicy returns the roles of the company that require 2FA
+func (h *AuthHandler) GetTwoFactorPolicy(c *gin.Context) {
+	roleIDs, err := h.roleRepo.GetTwoFactorRoleIDs(c.GetString("company_id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, models.TwoFactorPolicy{RoleIDs: roleIDs})
+}
+
+// UpdateTwoFactorPolicy sets which roles of the company require 2FA
+func (h *AuthHandler) UpdateTwoFactorPolicy(c *gin.Context) {
+	companyID := c.GetString("company_id")
+	var req models.TwoFactorPolicy
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	for _, roleID := range req.RoleIDs {
+		role, err := h.roleRepo.GetByID(roleID, companyID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if role == nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Role not found: " + roleID})
+			return
+		}
+	}
+
+	if err := h.roleRepo.SetTwoFactorRoles(companyID, req.RoleIDs); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	logger.Info("Two-factor policy updated", zap.String("companyId", companyID), zap.Strings("roleIds", req.RoleIDs), zap.Int("updatedBy", c.GetInt("user_id")))
+	h.GetTwoFactorPolicy(c)
+}
@@ -0,0 +1,60 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"classmate-central/internal/middleware"
+	"classmate-central/internal/models"
+	"classmate-central/internal/services"
+	"classmate-central/internal/testutil"
+	"classmate-central/internal/totp"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestTwoFactor_StepUpLocksAfterInvalidCodes guesses step-up codes with a valid access token and
+// checks that the guesses lock verify, disable and recovery-code regeneration alike
+func TestTwoFactor_StepUpLocksAfterInvalidCodes(t *testing.T) {
+	router, authHandler, db := setupTestRouter(t)
+	defer db.Close()
+	defer testutil.CleanupTestDB(t, db)
+
+	api := router.Group("/api")
+	api.Use(middleware.AuthMiddleware(db))
+	api.POST("/auth/2fa/setup", authHandler.SetupTwoFactor)
+	api.POST("/auth/2fa/enable", authHandler.EnableTwoFactor)
+	api.POST("/auth/2fa/disable", authHandler.DisableTwoFactor)
+	api.POST("/auth/2fa/recovery-codes", authHandler.RegenerateRecoveryCodes)
+	api.POST("/auth/2fa/verify", authHandler.VerifyTwoFactor)
+
+	token := registerTenant(t, router, "owner-2fa@example.com")
+	w := tenantRequest(router, token, "POST", "/api/auth/2fa/setup", nil)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var setup models.TwoFactorSetupResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &setup))
+
+	code, err := totp.Code(setup.Secret, time.Now())
+	require.NoError(t, err)
+	w = tenantRequest(router, token, "POST", "/api/auth/2fa/enable", gin.H{"code": code})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	// A code that was valid once cannot be replayed, so it is a wrong guess from now on
+	for attempt := 1; attempt < services.LockoutThreshold; attempt++ {
+		w = tenantRequest(router, token, "POST", "/api/auth/2fa/verify", gin.H{"code": code})
+		assert.Equal(t, http.StatusBadRequest, w.Code, "attempt %d", attempt)
+	}
+	w = tenantRequest(router, token, "POST", "/api/auth/2fa/verify", gin.H{"code": code})
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.NotEmpty(t, w.Header().Get("Retry-After"))
+	assert.Contains(t, w.Body.String(), "two_factor_locked")
+
+	for _, path := range []string{"/api/auth/2fa/verify", "/api/auth/2fa/disable", "/api/auth/2fa/recovery-codes"} {
+		w = tenantRequest(router, token, "POST", path, gin.H{"code": "123456", "recoveryCode": "abcde-fghjk"})
+		assert.Equal(t, http.StatusTooManyRequests, w.Code, path)
+	}
+}
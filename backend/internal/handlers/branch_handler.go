@@ -2,13 +2,16 @@ package handlers
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
 	"net/http"
+	"strconv"
 
 	"classmate-central/internal/logger"
 	"classmate-central/internal/middleware"
 	"classmate-central/internal/models"
 	"classmate-central/internal/repository"
+	"classmate-central/internal/services"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
@@ -16,16 +19,20 @@ import (
 )
 
 type BranchHandler struct {
-	branchRepo *repository.BranchRepository
-	roleRepo   *repository.RoleRepository
-	db         *sql.DB
+	branchRepo     *repository.BranchRepository
+	roleRepo       *repository.RoleRepository
+	sessionService *services.SessionService
+	planService    *services.PlanService
+	db             *sql.DB
 }
 
-func NewBranchHandler(db *sql.DB) *BranchHandler {
+func NewBranchHandler(db *sql.DB, sessionService *services.SessionService, planService *services.PlanService) *BranchHandler {
 	return &BranchHandler{
-		branchRepo: repository.NewBranchRepository(db),
-		roleRepo:   repository.NewRoleRepository(db),
-		db:         db,
+		branchRepo:     repository.NewBranchRepository(db),
+		roleRepo:       repository.NewRoleRepository(db),
+		sessionService: sessionService,
+		planService:    planService,
+		db:             db,
 	}
 }
 
@@ -90,6 +97,9 @@ func (h *BranchHandler) CreateBranch(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	if planLimitReached(c, h.planService, models.PlanResourceBranches) {
+		return
+	}
 
 	branch := &models.Branch{
 		ID:        uuid.New().String(),
@@ -117,7 +127,7 @@ func (h *BranchHandler) CreateBranch(c *gin.Context) {
 
 	// Always assign user to the new branch (AssignUserToBranch uses ON CONFLICT, so it's safe)
 	logger.Info("Assigning user to new branch", zap.Int("userId", userID.(int)), zap.String("branchId", branch.ID), zap.String("companyId", companyID.(string)))
-	if assignErr := h.branchRepo.AssignUserToBranch(userID.(int), branch.ID, roleIDPtr, companyID.(string), nil); assignErr != nil {
+	if assignErr := h.branchRepo.AssignUserToBranch(userID.(int), branch.ID, roleIDPtr, nil, auditActor(c)); assignErr != nil {
 		logger.Error("Failed to auto-assign user to new branch", logger.ErrorField(assignErr), zap.Int("userId", userID.(int)), zap.String("branchId", branch.ID))
 		// Don't fail branch creation if assignment fails, but log the error
 	} else {
@@ -204,7 +214,7 @@ func (h *BranchHandler) DeleteBranch(c *gin.Context) {
 		return
 	}
 
-	err = h.branchRepo.DeleteBranch(branchID, companyID.(string))
+	err = h.branchRepo.DeleteBranch(branchID, auditActor(c))
 	if err != nil {
 		logger.Error("Failed to delete branch", logger.ErrorField(err))
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete branch"})
@@ -220,7 +230,6 @@ func (h *BranchHandler) SwitchBranch(c *gin.Context) {
 	userID, _ := c.Get("user_id")
 	companyID, _ := c.Get("company_id")
 	userEmail, _ := c.Get("user_email")
-	roleID, _ := c.Get("role_id")
 
 	var req struct {
 		BranchID string `json:"branchId" binding:"required"`
@@ -238,66 +247,63 @@ func (h *BranchHandler) SwitchBranch(c *gin.Context) {
 		return
 	}
 
-	// Get user's branches for the token
-	branches, err := h.branchRepo.GetUserBranches(userID.(int), companyID.(string))
-	if err != nil {
-		logger.Error("Failed to get user branches", logger.ErrorField(err))
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get branches"})
+	// Remember the branch on the session so refreshed tokens keep it
+	sessionID := c.GetString("session_id")
+	if c.GetInt("impersonated_by") != 0 {
+		h.switchImpersonationBranch(c, sessionID, req.BranchID)
 		return
 	}
-
-	branchIDs := make([]string, len(branches))
-	for i, branch := range branches {
-		branchIDs[i] = branch.ID
-	}
-
-	// Get user permissions
-	perms, err := h.roleRepo.GetUserPermissions(userID.(int), companyID.(string))
+	refreshToken, err := h.sessionService.SwitchBranch(sessionID, userID.(int), req.BranchID)
 	if err != nil {
-		logger.Error("Failed to get user permissions", logger.ErrorField(err))
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get permissions"})
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Session has been revoked or expired"})
+			return
+		}
+		logger.Error("Failed to generate refresh token", logger.ErrorField(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate refresh token"})
 		return
 	}
 
-	// Convert roleID to *string
-	var roleIDPtr *string
-	if roleIDVal, ok := roleID.(string); ok {
-		roleIDPtr = &roleIDVal
-	}
-
-	// Generate new tokens with the new branch
-	token, err := middleware.GenerateToken(
-		userID.(int),
-		userEmail.(string),
-		roleIDPtr,
-		perms,
-		&req.BranchID,
-		branchIDs,
-	)
+	// Generate a new access token for the session
+	token, err := middleware.GenerateToken(userID.(int), userEmail.(string), sessionID, c.GetInt("context_version"))
 	if err != nil {
 		logger.Error("Failed to generate token", logger.ErrorField(err))
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
 		return
 	}
 
-	refreshToken, err := middleware.GenerateRefreshToken(
-		userID.(int),
-		userEmail.(string),
-		roleIDPtr,
-		perms,
-		&req.BranchID,
-		branchIDs,
-	)
+	c.JSON(http.StatusOK, gin.H{
+		"token":        token,
+		"refreshToken": refreshToken,
+		"branchId":     req.BranchID,
+	})
+}
+
+// switchImpersonationBranch is SwitchBranch for an impersonation session: the session keeps its
+// expiry and the new access token expires with it, without a refresh token
+func (h *BranchHandler) switchImpersonationBranch(c *gin.Context, sessionID, branchID string) {
+	userID := c.GetInt("user_id")
+	expiresAt, err := h.sessionService.SwitchImpersonationBranch(sessionID, userID, branchID)
 	if err != nil {
-		logger.Error("Failed to generate refresh token", logger.ErrorField(err))
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate refresh token"})
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Session has been revoked or expired"})
+			return
+		}
+		logger.Error("Failed to switch impersonation branch", logger.ErrorField(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to switch branch"})
+		return
+	}
+
+	token, err := middleware.GenerateImpersonationToken(userID, c.GetString("user_email"), sessionID, c.GetInt("context_version"), expiresAt)
+	if err != nil {
+		logger.Error("Failed to generate token", logger.ErrorField(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"token":        token,
-		"refreshToken": refreshToken,
-		"branchId":     req.BranchID,
+		"token":    token,
+		"branchId": branchID,
 	})
 }
 
@@ -317,6 +323,59 @@ func (h *BranchHandler) GetBranchUsers(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"userIds": userIDs})
 }
 
+// GetUserBranchPermissions returns the effective permissions of a user in a branch.
+// Users may inspect themselves; other users require users.manage.
+// GET /api/branches/:id/users/:userId/permissions
+func (h *BranchHandler) GetUserBranchPermissions(c *gin.Context) {
+	branchID := c.Param("id")
+	companyID := c.GetString("company_id")
+	userID, err := strconv.Atoi(c.Param("userId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+	if userID != c.GetInt("user_id") && !middleware.HasPermission(c, "users.manage") {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error":   "Insufficient permissions",
+			"message": "You don't have permission to perform this action",
+		})
+		return
+	}
+
+	tenant, err := middleware.ResolveTenantContext(h.db, userID)
+	if err != nil && !errors.Is(err, middleware.ErrTenantUserNotFound) {
+		logger.Error("Failed to resolve user permissions", logger.ErrorField(err), zap.Int("userId", userID))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to resolve permissions"})
+		return
+	}
+	// Users of other companies are reported as missing
+	if err != nil || tenant.CompanyID != companyID {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	if len(tenant.BranchIDs) > 0 && !tenant.HasBranch(branchID) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User has no access to this branch"})
+		return
+	}
+
+	permissions, source, grant := tenant.EffectivePermissions(branchID)
+	if permissions == nil {
+		permissions = []string{}
+	}
+	result := models.EffectivePermissions{
+		UserID:      userID,
+		BranchID:    branchID,
+		Source:      source,
+		BranchRole:  grant,
+		Permissions: permissions,
+		Scopes:      tenant.PermissionScopes(branchID),
+	}
+	if tenant.TeacherID != "" {
+		result.TeacherID = &tenant.TeacherID
+	}
+	c.JSON(http.StatusOK, result)
+}
+
 // AssignUserToBranch assigns a user to a branch
 // POST /api/branches/:id/users
 func (h *BranchHandler) AssignUserToBranch(c *gin.Context) {
@@ -334,8 +393,24 @@ func (h *BranchHandler) AssignUserToBranch(c *gin.Context) {
 		return
 	}
 
+	// The role decides the user's permissions in this branch, so it must belong to the company
+	if req.RoleID != nil && *req.RoleID != "" {
+		role, err := h.roleRepo.GetByID(*req.RoleID, companyID.(string))
+		if err != nil {
+			logger.Error("Failed to load role", logger.ErrorField(err))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to assign user to branch"})
+			return
+		}
+		if role == nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Role not found"})
+			return
+		}
+	} else {
+		req.RoleID = nil
+	}
+
 	assignedBy := currentUserID.(int)
-	err := h.branchRepo.AssignUserToBranch(req.UserID, branchID, req.RoleID, companyID.(string), &assignedBy)
+	err := h.branchRepo.AssignUserToBranch(req.UserID, branchID, req.RoleID, &assignedBy, auditActor(c))
 	if err != nil {
 		logger.Error("Failed to assign user to branch", logger.ErrorField(err))
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to assign user to branch"})
@@ -350,7 +425,6 @@ func (h *BranchHandler) AssignUserToBranch(c *gin.Context) {
 func (h *BranchHandler) RemoveUserFromBranch(c *gin.Context) {
 	branchID := c.Param("id")
 	userID := c.Param("userId")
-	companyID, _ := c.Get("company_id")
 
 	// Parse userID to int
 	var userIDInt int
@@ -359,7 +433,7 @@ func (h *BranchHandler) RemoveUserFromBranch(c *gin.Context) {
 		return
 	}
 
-	err := h.branchRepo.RemoveUserFromBranch(userIDInt, branchID, companyID.(string))
+	err := h.branchRepo.RemoveUserFromBranch(userIDInt, branchID, auditActor(c))
 	if err != nil {
 		logger.Error("Failed to remove user from branch", logger.ErrorField(err))
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove user from branch"})
@@ -0,0 +1,123 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"classmate-central/internal/models"
+	"classmate-central/internal/money"
+	"classmate-central/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxBranchReportDays caps the period of a consolidated report
+const maxBranchReportDays = 366
+
+type BranchReportHandler struct {
+	service       *services.BranchReportService
+	exportService *services.ExportService
+}
+
+func NewBranchReportHandler(service *services.BranchReportService, exportService *services.ExportService) *BranchReportHandler {
+	return &BranchReportHandler{service: service, exportService: exportService}
+}
+
+// GetBranchReport returns revenue, attendance, occupancy and lead conversion per branch and summed
+// GET /api/reports/branches?branchIds=a,b&startDate=2024-01-01&endDate=2024-01-31&currency=KZT
+func (h *BranchReportHandler) GetBranchReport(c *gin.Context) {
+	report, ok := h.report(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, report)
+}
+
+// ExportBranchReportExcel exports the same report to Excel, one sheet per branch plus a summary
+// GET /api/export/reports/branches/excel
+func (h *BranchReportHandler) ExportBranchReportExcel(c *gin.Context) {
+	report, ok := h.report(c)
+	if !ok {
+		return
+	}
+
+	excelData, err := h.exportService.ExportBranchReportExcel(report)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate Excel"})
+		return
+	}
+
+	c.Header("Content-Type", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet")
+	c.Header("Content-Disposition", `attachment; filename="branch_report_`+time.Now().Format("20060102_150405")+`.xlsx"`)
+	c.Data(http.StatusOK, "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet", excelData)
+}
+
+func (h *BranchReportHandler) report(c *gin.Context) (*models.BranchReport, bool) {
+	branchIDs, ok := branchSelection(c)
+	if !ok {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Access denied to this branch"})
+		return nil, false
+	}
+
+	from, to, ok := reportPeriod(c)
+	if !ok {
+		return nil, false
+	}
+
+	var currency money.Currency
+	if code := c.Query("currency"); code != "" {
+		parsed, err := money.ParseCurrency(code)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Неподдерживаемая валюта"})
+			return nil, false
+		}
+		currency = parsed
+	}
+
+	report, err := h.service.GetReport(c.GetString("company_id"), branchIDs, from, to, currency)
+	if errors.Is(err, services.ErrNoExchangeRate) {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Не задан курс валюты для пересчёта: " + err.Error()})
+		return nil, false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to build report"})
+		return nil, false
+	}
+	return report, true
+}
+
+// reportPeriod reads startDate and endDate (YYYY-MM-DD, both inclusive) and returns the period
+// as [from, to). The default is the current month up to today.
+func reportPeriod(c *gin.Context) (time.Time, time.Time, bool) {
+	now := time.Now()
+	from := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+	to := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location()).AddDate(0, 0, 1)
+
+	if value := c.Query("startDate"); value != "" {
+		parsed, err := time.ParseInLocation("2006-01-02", value, now.Location())
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid startDate format. Use YYYY-MM-DD"})
+			return time.Time{}, time.Time{}, false
+		}
+		from = parsed
+	}
+	if value := c.Query("endDate"); value != "" {
+		parsed, err := time.ParseInLocation("2006-01-02", value, now.Location())
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid endDate format. Use YYYY-MM-DD"})
+			return time.Time{}, time.Time{}, false
+		}
+		to = parsed.AddDate(0, 0, 1)
+	}
+
+	if !to.After(from) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "endDate must not be before startDate"})
+		return time.Time{}, time.Time{}, false
+	}
+	if to.Sub(from) > maxBranchReportDays*24*time.Hour {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "The period must not exceed one year"})
+		return time.Time{}, time.Time{}, false
+	}
+	return from, to, true
+}
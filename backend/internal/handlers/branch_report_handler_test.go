@@ -0,0 +1,64 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBranchSelection(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	selection := func(query string) ([]string, bool) {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest(http.MethodGet, "/api/reports/branches"+query, nil)
+		c.Set("company_id", "company")
+		c.Set("accessible_branch_ids", []string{"north", "south", "east"})
+		return branchSelection(c)
+	}
+
+	ids, ok := selection("")
+	assert.True(t, ok)
+	assert.Equal(t, []string{"north", "south", "east"}, ids)
+
+	ids, ok = selection("?branchIds=south,north,south")
+	assert.True(t, ok)
+	assert.Equal(t, []string{"south", "north"}, ids)
+
+	ids, ok = selection("?branchIds=east&branchIds=north")
+	assert.True(t, ok)
+	assert.Equal(t, []string{"east", "north"}, ids)
+
+	_, ok = selection("?branchIds=north,west")
+	assert.False(t, ok)
+
+	ids, ok = selection("?branchIds=north&branchId=bogus")
+	assert.False(t, ok)
+	assert.Nil(t, ids)
+}
+
+func TestBranchReportRejectsBadPeriod(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	h := NewBranchReportHandler(nil, nil)
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		c.Set("company_id", "company")
+		c.Set("accessible_branch_ids", []string{"north"})
+		c.Next()
+	})
+	router.GET("/api/reports/branches", h.GetBranchReport)
+
+	for query, status := range map[string]int{
+		"?branchIds=west":                                       http.StatusForbidden,
+		"?startDate=01.03.2025":                                 http.StatusBadRequest,
+		"?startDate=2025-03-10&endDate=2025-03-01":              http.StatusBadRequest,
+		"?startDate=2023-01-01&endDate=2025-01-01":              http.StatusBadRequest,
+		"?startDate=2025-03-01&endDate=2025-03-31&currency=XXX": http.StatusBadRequest,
+	} {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/reports/branches"+query, nil))
+		assert.Equal(t, status, w.Code, query)
+	}
+}
@@ -0,0 +1,132 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+
+	"classmate-central/internal/models"
+	"classmate-central/internal/repository"
+	"classmate-central/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+type BranchTransferHandler struct {
+	service  *services.BranchTransferService
+	students *repository.StudentRepository
+}
+
+func NewBranchTransferHandler(service *services.BranchTransferService, students *repository.StudentRepository) *BranchTransferHandler {
+	return &BranchTransferHandler{service: service, students: students}
+}
+
+// TransferStudent moves a student to another branch with their balance, debts and subscriptions
+// POST /api/students/:id/transfer
+func (h *BranchTransferHandler) TransferStudent(c *gin.Context) {
+	id := c.Param("id")
+
+	var req models.StudentTransferRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !branchAccessible(c, req.BranchID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Access denied to this branch"})
+		return
+	}
+	if !studentInScope(c, h.students, "students.update", id) {
+		return
+	}
+
+	transfer, err := h.service.TransferStudent(auditActor(c), id, req)
+	switch {
+	case errors.Is(err, services.ErrInvalidSubscriptionPolicy), errors.Is(err, repository.ErrBranchUnavailable):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, repository.ErrTransferSameBranch):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, repository.ErrTransferKeepCurrency):
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, services.ErrNoExchangeRate):
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Не задан курс валюты для пересчёта: " + err.Error()})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to transfer student"})
+		return
+	}
+	if transfer == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Student not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, transfer)
+}
+
+// GetStudentTransfers returns the branch transfers of a student, newest first
+// GET /api/students/:id/transfers
+func (h *BranchTransferHandler) GetStudentTransfers(c *gin.Context) {
+	id := c.Param("id")
+	if !studentInScope(c, h.students, "students.view", id) {
+		return
+	}
+
+	transfers, err := h.service.GetStudentTransfers(id, c.GetString("company_id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, transfers)
+}
+
+// GetTeacherBranches returns the branches a teacher works in with the working hours there
+// GET /api/teachers/:id/branches
+func (h *BranchTransferHandler) GetTeacherBranches(c *gin.Context) {
+	branches, err := h.service.GetTeacherBranches(c.Param("id"), c.GetString("company_id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if branches == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Teacher not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, branches)
+}
+
+// SetTeacherBranches replaces the branches a teacher works in, the working hours there and the primary branch
+// PUT /api/teachers/:id/branches
+func (h *BranchTransferHandler) SetTeacherBranches(c *gin.Context) {
+	id := c.Param("id")
+
+	var req models.SetTeacherBranchesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	for _, b := range req.Branches {
+		if !branchAccessible(c, b.BranchID) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Access denied to this branch"})
+			return
+		}
+	}
+
+	err := h.service.SetTeacherBranches(auditActor(c), id, req)
+	switch {
+	case errors.Is(err, services.ErrInvalidTeacherBranches), errors.Is(err, repository.ErrBranchUnavailable):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, sql.ErrNoRows):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Teacher not found"})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	h.GetTeacherBranches(c)
+}
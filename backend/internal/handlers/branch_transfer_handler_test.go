@@ -0,0 +1,154 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"classmate-central/internal/database"
+	"classmate-central/internal/models"
+	"classmate-central/internal/money"
+	"classmate-central/internal/repository"
+	"classmate-central/internal/services"
+	"classmate-central/internal/testutil"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTransferStudentRejectsBadRequests(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	h := NewBranchTransferHandler(services.NewBranchTransferService(nil, nil), nil)
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		c.Set("company_id", "company")
+		c.Set("accessible_branch_ids", []string{"b1", "b2"})
+		c.Next()
+	})
+	router.POST("/api/students/:id/transfer", h.TransferStudent)
+	router.PUT("/api/teachers/:id/branches", h.SetTeacherBranches)
+
+	cases := []struct {
+		method, path, body string
+		status             int
+	}{
+		{http.MethodPost, "/api/students/s1/transfer", `{"subscriptionPolicy": "move"}`, http.StatusBadRequest},
+		{http.MethodPost, "/api/students/s1/transfer", `{"branchId": "b3", "subscriptionPolicy": "move"}`, http.StatusForbidden},
+		{http.MethodPost, "/api/students/s1/transfer", `{"branchId": "b2", "subscriptionPolicy": "split"}`, http.StatusBadRequest},
+		{http.MethodPut, "/api/teachers/t1/branches", `{"primaryBranchId": "b1", "branches": [{"branchId": "b3"}]}`, http.StatusForbidden},
+		{http.MethodPut, "/api/teachers/t1/branches", `{"primaryBranchId": "b2", "branches": [{"branchId": "b1"}]}`, http.StatusBadRequest},
+	}
+	for _, tc := range cases {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(tc.method, tc.path, strings.NewReader(tc.body))
+		req.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(w, req)
+		assert.Equal(t, tc.status, w.Code, tc.body)
+	}
+}
+
+// TestTransferStudent_SubscriptionPolicies transfers students under each subscription policy and
+// checks what happens to their enrollments, upcoming lessons and installment plans
+func TestTransferStudent_SubscriptionPolicies(t *testing.T) {
+	router, db := setupTenantIsolationRouter(t)
+	defer db.Close()
+	defer testutil.CleanupTestDB(t, db)
+
+	email := "owner-transfer@example.com"
+	token := registerTenant(t, router, email)
+	companyID := companyOf(t, db, email)
+	fromBranch := companyID + "_default_branch"
+	toBranch := companyID + "_second_branch"
+	require.NoError(t, repository.NewBranchRepository(db).CreateBranch(&models.Branch{ID: toBranch, Name: "Second", CompanyID: companyID, Status: "active"}))
+
+	price := money.MustParse("40000", money.DefaultCurrency)
+	require.NoError(t, repository.NewTeacherRepository(db).Create(&models.Teacher{ID: "tr-teacher", Name: "Teacher", Subject: "Math", Email: "teacher-transfer@example.com", Status: "active"}, companyID, fromBranch))
+	require.NoError(t, repository.NewRoomRepository(db).Create(&models.Room{ID: "tr-room", Name: "Room 1", Capacity: 10, Status: "active"}, companyID, fromBranch))
+	groupRepo := repository.NewGroupRepository(db)
+	lessonRepo := repository.NewLessonRepository(db)
+	enrollmentRepo := repository.NewEnrollmentRepository(db)
+	start := time.Now().Add(24 * time.Hour).Truncate(time.Hour)
+	for _, id := range []string{"tr-kept", "tr-other"} {
+		require.NoError(t, groupRepo.Create(&models.Group{ID: id, Name: id, Subject: "Math", TeacherID: "tr-teacher", RoomID: "tr-room", Status: "active"}, companyID, fromBranch))
+	}
+
+	subscriptionRepo := repository.NewSubscriptionRepository(db)
+	require.NoError(t, subscriptionRepo.CreateType(&models.SubscriptionType{ID: "tr-type", Name: "Monthly", LessonsCount: 8, Price: price, BillingType: "per_lesson"}, companyID))
+	installmentRepo := repository.NewInstallmentRepository(db)
+	newStudent := func(name, subscriptionID, groupID string, plan bool) string {
+		studentID := createdID(t, tenantRequest(router, token, "POST", "/api/students", gin.H{"name": name, "age": 12}))
+		sub := &models.StudentSubscription{ID: subscriptionID, StudentID: studentID, SubscriptionTypeID: "tr-type", TotalLessons: 8, TotalPrice: price, StartDate: time.Now(), Status: "active"}
+		if groupID != "" {
+			sub.GroupID = &groupID
+		}
+		require.NoError(t, subscriptionRepo.CreateStudentSubscription(sub, companyID))
+		_, err := database.System(db).Exec(`UPDATE student_subscriptions SET branch_id = $2 WHERE id = $1`, subscriptionID, fromBranch)
+		require.NoError(t, err)
+		if plan {
+			half := price.Div(2, money.HalfUp)
+			require.NoError(t, installmentRepo.CreatePlan(&models.InstallmentPlan{
+				SubscriptionID: subscriptionID, TotalAmount: price, BillingMode: "debt", ReminderDays: 3,
+				Installments: []models.Installment{
+					{Seq: 1, DueDate: time.Now().AddDate(0, 1, 0), Amount: half},
+					{Seq: 2, DueDate: time.Now().AddDate(0, 2, 0), Amount: price.Sub(half)},
+				},
+			}, companyID))
+		}
+		return studentID
+	}
+
+	keptID := newStudent("Kept Student", "tr-sub-keep", "tr-kept", false)
+	for _, groupID := range []string{"tr-kept", "tr-other"} {
+		require.NoError(t, enrollmentRepo.Create(&models.Enrollment{StudentID: keptID, GroupID: groupID, JoinedAt: time.Now()}, companyID))
+		require.NoError(t, lessonRepo.Create(&models.Lesson{ID: groupID + "-lesson", Title: "Math", TeacherID: "tr-teacher", GroupID: groupID, Subject: "Math",
+			Start: start, End: start.Add(time.Hour), RoomID: "tr-room", Status: "scheduled", StudentIds: []string{keptID}}, companyID, fromBranch))
+	}
+	refundedID := newStudent("Refunded Student", "tr-sub-refund", "", true)
+	movedID := newStudent("Moved Student", "tr-sub-move", "", true)
+
+	service := services.NewBranchTransferService(repository.NewBranchTransferRepository(db), services.NewCurrencyService(repository.NewCurrencyRepository(db)))
+	actor := database.Actor{CompanyID: companyID}
+	transfer := func(studentID, policy string) *models.StudentTransfer {
+		result, err := service.TransferStudent(actor, studentID, models.StudentTransferRequest{BranchID: toBranch, SubscriptionPolicy: policy})
+		require.NoError(t, err)
+		require.NotNil(t, result)
+		return result
+	}
+	count := func(query string, args ...interface{}) int {
+		var n int
+		require.NoError(t, database.System(db).QueryRow(query, args...).Scan(&n))
+		return n
+	}
+
+	// keep: the group of the kept subscription stays open, the other one is closed
+	kept := transfer(keptID, models.TransferKeepSubscriptions)
+	assert.Equal(t, []string{"tr-sub-keep"}, kept.Details.KeptSubscriptions)
+	assert.Equal(t, 1, kept.Details.ClosedEnrollments)
+	assert.Equal(t, 1, kept.Details.RemovedFromLessons)
+	assert.Equal(t, 1, count(`SELECT COUNT(*) FROM enrollment WHERE student_id = $1 AND group_id = 'tr-kept' AND left_at IS NULL`, keptID))
+	assert.Equal(t, 0, count(`SELECT COUNT(*) FROM enrollment WHERE student_id = $1 AND group_id = 'tr-other' AND left_at IS NULL`, keptID))
+	assert.Equal(t, 1, count(`SELECT COUNT(*) FROM lesson_students WHERE student_id = $1 AND lesson_id = 'tr-kept-lesson'`, keptID))
+	assert.Equal(t, 0, count(`SELECT COUNT(*) FROM lesson_students WHERE student_id = $1 AND lesson_id = 'tr-other-lesson'`, keptID))
+
+	// refund: the plan is cancelled with the subscription, so no installment is charged any more
+	refunded := transfer(refundedID, models.TransferRefundSubscriptions)
+	assert.Equal(t, 1, refunded.Details.CancelledPlans)
+	assert.Equal(t, 1, count(`SELECT COUNT(*) FROM installment_plans WHERE subscription_id = 'tr-sub-refund' AND status = 'cancelled'`))
+	assert.Equal(t, 0, count(`SELECT COUNT(*) FROM installments i JOIN installment_plans p ON p.id = i.plan_id
+		WHERE p.subscription_id = 'tr-sub-refund' AND i.status <> 'cancelled'`))
+	due, err := installmentRepo.GetDueForCharge(time.Now().AddDate(1, 0, 0))
+	require.NoError(t, err)
+	for _, i := range due {
+		assert.NotEqual(t, "tr-sub-refund", i.SubscriptionID)
+	}
+
+	// move: the plan follows the subscription to the new branch
+	moved := transfer(movedID, models.TransferMoveSubscriptions)
+	assert.Equal(t, []string{"tr-sub-move"}, moved.Details.MovedSubscriptions)
+	assert.Equal(t, 1, moved.Details.MovedPlans)
+	assert.Equal(t, 1, count(`SELECT COUNT(*) FROM installment_plans WHERE subscription_id = 'tr-sub-move' AND status = 'active' AND branch_id = $1`, toBranch))
+	assert.Equal(t, 1, count(`SELECT COUNT(*) FROM student_subscriptions WHERE id = 'tr-sub-move' AND branch_id = $1`, toBranch))
+}
@@ -0,0 +1,244 @@
+package handlers
+
+import (
+	"classmate-central/internal/models"
+	"classmate-central/internal/repository"
+	"classmate-central/internal/services"
+	"classmate-central/internal/validation"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type CashShiftHandler struct {
+	repo          *repository.CashShiftRepository
+	studentRepo   *repository.StudentRepository
+	exportService *services.ExportService
+}
+
+func NewCashShiftHandler(repo *repository.CashShiftRepository, studentRepo *repository.StudentRepository, exportService *services.ExportService) *CashShiftHandler {
+	return &CashShiftHandler{
+		repo:          repo,
+		studentRepo:   studentRepo,
+		exportService: exportService,
+	}
+}
+
+// GetAll returns cash shifts of the current branch
+func (h *CashShiftHandler) GetAll(c *gin.Context) {
+	companyID := c.GetString("company_id")
+	branchID := c.GetString("branch_id")
+
+	shifts, err := h.repo.GetAll(companyID, branchID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, shifts)
+}
+
+// GetCurrent returns the open shift of the current branch
+func (h *CashShiftHandler) GetCurrent(c *gin.Context) {
+	companyID := c.GetString("company_id")
+	branchID := c.GetString("branch_id")
+
+	shift, err := h.repo.GetOpenByBranch(companyID, branchID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if shift == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "no open cash shift"})
+		return
+	}
+
+	c.JSON(http.StatusOK, shift)
+}
+
+// Open opens a cash shift for the current branch
+func (h *CashShiftHandler) Open(c *gin.Context) {
+	var req models.OpenCashShiftRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": validation.FormatValidationErrors(err)})
+		return
+	}
+	if err := validation.ValidateAmount(req.OpeningFloat); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	companyID := c.GetString("company_id")
+	branchID := c.GetString("branch_id")
+
+	shift := models.CashShift{
+		OpeningFloat: req.OpeningFloat,
+		Notes:        req.Notes,
+		OpenedBy:     currentUserID(c),
+	}
+	if err := h.repo.Open(&shift, companyID, branchID); err != nil {
+		if errors.Is(err, repository.ErrShiftAlreadyOpen) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, shift)
+}
+
+// Close closes a shift with the counted cash and returns the reconciliation report
+func (h *CashShiftHandler) Close(c *gin.Context) {
+	shiftID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid shift id"})
+		return
+	}
+
+	var req models.CloseCashShiftRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": validation.FormatValidationErrors(err)})
+		return
+	}
+	if err := validation.ValidateAmount(req.CountedCash); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	companyID := c.GetString("company_id")
+	if _, err := h.repo.Close(shiftID, companyID, req.CountedCash, req.Notes, currentUserID(c)); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "cash shift not found"})
+			return
+		}
+		if errors.Is(err, repository.ErrShiftClosed) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	report, err := h.repo.GetReport(shiftID, companyID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
+
+// AddMovement records a cash-in or cash-out in the open shift of the current branch
+func (h *CashShiftHandler) AddMovement(c *gin.Context) {
+	var req models.CashMovementRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": validation.FormatValidationErrors(err)})
+		return
+	}
+	if err := validation.ValidatePositiveAmount(req.Amount); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	companyID := c.GetString("company_id")
+	branchID := c.GetString("branch_id")
+
+	movement := models.CashMovement{
+		Type:      req.Type,
+		Amount:    req.Amount,
+		Reason:    req.Reason,
+		CreatedBy: currentUserID(c),
+	}
+	if err := h.repo.AddMovement(&movement, companyID, branchID); err != nil {
+		if errors.Is(err, repository.ErrNoOpenShift) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, movement)
+}
+
+// GetReport returns the reconciliation report of a shift
+func (h *CashShiftHandler) GetReport(c *gin.Context) {
+	report, ok := h.loadReport(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, report)
+}
+
+// ExportReportPDF exports the shift report as PDF
+func (h *CashShiftHandler) ExportReportPDF(c *gin.Context) {
+	report, ok := h.loadReport(c)
+	if !ok {
+		return
+	}
+
+	pdfData, err := h.exportService.ExportCashShiftPDF(report, h.studentNames(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate PDF"})
+		return
+	}
+
+	c.Header("Content-Type", "application/pdf")
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="cash_shift_%d_%s.pdf"`, report.Shift.ID, time.Now().Format("20060102_150405")))
+	c.Data(http.StatusOK, "application/pdf", pdfData)
+}
+
+// ExportReportExcel exports the shift report as Excel
+func (h *CashShiftHandler) ExportReportExcel(c *gin.Context) {
+	report, ok := h.loadReport(c)
+	if !ok {
+		return
+	}
+
+	excelData, err := h.exportService.ExportCashShiftExcel(report, h.studentNames(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate Excel"})
+		return
+	}
+
+	c.Header("Content-Type", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet")
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="cash_shift_%d_%s.xlsx"`, report.Shift.ID, time.Now().Format("20060102_150405")))
+	c.Data(http.StatusOK, "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet", excelData)
+}
+
+func (h *CashShiftHandler) loadReport(c *gin.Context) (*models.CashShiftReport, bool) {
+	shiftID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid shift id"})
+		return nil, false
+	}
+
+	report, err := h.repo.GetReport(shiftID, c.GetString("company_id"))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "cash shift not found"})
+			return nil, false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return nil, false
+	}
+	return report, true
+}
+
+func (h *CashShiftHandler) studentNames(c *gin.Context) map[string]string {
+	studentMap := make(map[string]string)
+	students, err := h.studentRepo.GetAll(c.GetString("company_id"), c.GetString("branch_id"))
+	if err != nil {
+		return studentMap
+	}
+	for _, s := range students {
+		studentMap[s.ID] = s.Name
+	}
+	return studentMap
+}
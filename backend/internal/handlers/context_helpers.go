@@ -0,0 +1,120 @@
+package handlers
+
+import (
+	"strings"
+
+	"classmate-central/internal/database"
+
+	"github.com/gin-gonic/gin"
+)
+
+// currentUserID returns the authenticated user ID from context (set by auth middleware)
+func currentUserID(c *gin.Context) *int {
+	if userID, exists := c.Get("user_id"); exists {
+		if uid, ok := userID.(int); ok {
+			return &uid
+		}
+	}
+	return nil
+}
+
+// auditActor identifies the user, client IP and request of the current request for the audit log
+func auditActor(c *gin.Context) database.Actor {
+	return database.Actor{
+		CompanyID:      c.GetString("company_id"),
+		UserID:         c.GetInt("user_id"),
+		IP:             c.ClientIP(),
+		RequestID:      c.GetString("request_id"),
+		ImpersonatedBy: c.GetInt("impersonated_by"),
+	}
+}
+
+// branchFilter returns the branches a report may cover: the requested ?branchId= if accessible,
+// otherwise all accessible branches. A nil result means no branch filtering (company-wide fallback).
+func branchFilter(c *gin.Context) ([]string, bool) {
+	companyID := c.GetString("company_id")
+
+	var accessible []string
+	if ids, ok := c.Get("accessible_branch_ids"); ok {
+		accessible, _ = ids.([]string)
+	}
+	fallback := len(accessible) == 0 || (len(accessible) == 1 && accessible[0] == companyID)
+
+	requested := c.Query("branchId")
+	if requested == "" {
+		if fallback {
+			return nil, true
+		}
+		return accessible, true
+	}
+
+	if fallback {
+		return []string{requested}, true
+	}
+	for _, id := range accessible {
+		if id == requested {
+			return []string{requested}, true
+		}
+	}
+	return nil, false
+}
+
+// branchSelection returns the branches a consolidated report covers: the requested
+// ?branchIds=a,b if all of them are accessible, otherwise all accessible branches. A nil result
+// means no branch filtering (company-wide fallback).
+func branchSelection(c *gin.Context) ([]string, bool) {
+	var requested []string
+	for _, value := range c.QueryArray("branchIds") {
+		for _, id := range strings.Split(value, ",") {
+			if id = strings.TrimSpace(id); id != "" {
+				requested = append(requested, id)
+			}
+		}
+	}
+	if len(requested) == 0 {
+		return branchFilter(c)
+	}
+
+	accessible, ok := branchFilter(c)
+	if !ok {
+		return nil, false
+	}
+	if accessible == nil {
+		return requested, true
+	}
+	allowed := make(map[string]bool, len(accessible))
+	for _, id := range accessible {
+		allowed[id] = true
+	}
+	selected := []string{}
+	seen := map[string]bool{}
+	for _, id := range requested {
+		if !allowed[id] {
+			return nil, false
+		}
+		if !seen[id] {
+			seen[id] = true
+			selected = append(selected, id)
+		}
+	}
+	return selected, true
+}
+
+// branchAccessible reports whether the user may work with the branch: it is one of the
+// accessible branches, or branch access is not restricted (company-wide fallback)
+func branchAccessible(c *gin.Context, branchID string) bool {
+	companyID := c.GetString("company_id")
+	var accessible []string
+	if ids, ok := c.Get("accessible_branch_ids"); ok {
+		accessible, _ = ids.([]string)
+	}
+	if len(accessible) == 0 || (len(accessible) == 1 && accessible[0] == companyID) {
+		return true
+	}
+	for _, id := range accessible {
+		if id == branchID {
+			return true
+		}
+	}
+	return false
+}
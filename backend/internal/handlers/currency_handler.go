@@ -0,0 +1,196 @@
+package handlers
+
+import (
+	"classmate-central/internal/models"
+	"classmate-central/internal/money"
+	"classmate-central/internal/repository"
+	"classmate-central/internal/validation"
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type CurrencyHandler struct {
+	repo *repository.CurrencyRepository
+}
+
+func NewCurrencyHandler(repo *repository.CurrencyRepository) *CurrencyHandler {
+	return &CurrencyHandler{repo: repo}
+}
+
+// GetSettings returns the base currency of the company and the currency of each branch
+func (h *CurrencyHandler) GetSettings(c *gin.Context) {
+	settings, err := h.repo.GetSettings(c.GetString("company_id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, settings)
+}
+
+// UpdateCompanyCurrency changes the base currency of the company
+func (h *CurrencyHandler) UpdateCompanyCurrency(c *gin.Context) {
+	var req models.UpdateCurrencyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": validation.FormatValidationErrors(err)})
+		return
+	}
+	cur, err := money.ParseCurrency(req.Currency)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Неподдерживаемая валюта"})
+		return
+	}
+
+	companyID := c.GetString("company_id")
+	if err := h.repo.SetCompanyCurrency(cur, companyID); err != nil {
+		h.writeUpdateError(c, err)
+		return
+	}
+
+	settings, err := h.repo.GetSettings(companyID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, settings)
+}
+
+// UpdateBranchCurrency sets the currency of a branch; an empty currency resets it to the company base currency
+func (h *CurrencyHandler) UpdateBranchCurrency(c *gin.Context) {
+	var req models.UpdateCurrencyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": validation.FormatValidationErrors(err)})
+		return
+	}
+
+	var cur *money.Currency
+	if req.Currency != "" {
+		parsed, err := money.ParseCurrency(req.Currency)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Неподдерживаемая валюта"})
+			return
+		}
+		cur = &parsed
+	}
+
+	companyID := c.GetString("company_id")
+	if err := h.repo.SetBranchCurrency(c.Param("id"), cur, companyID); err != nil {
+		h.writeUpdateError(c, err)
+		return
+	}
+
+	settings, err := h.repo.GetSettings(companyID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, settings)
+}
+
+func (h *CurrencyHandler) writeUpdateError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Not found"})
+	case errors.Is(err, repository.ErrCurrencyInUse):
+		c.JSON(http.StatusConflict, gin.H{"error": "Нельзя сменить валюту: уже есть платежи в другой валюте"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
+
+// GetRates returns exchange rates of the company (supports ?from= and ?to=)
+func (h *CurrencyHandler) GetRates(c *gin.Context) {
+	var from, to money.Currency
+	for param, dst := range map[string]*money.Currency{"from": &from, "to": &to} {
+		if code := c.Query(param); code != "" {
+			parsed, err := money.ParseCurrency(code)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Неподдерживаемая валюта"})
+				return
+			}
+			*dst = parsed
+		}
+	}
+
+	rates, err := h.repo.GetRates(from, to, c.GetString("company_id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, rates)
+}
+
+// CreateRate adds an exchange rate effective from the given date
+func (h *CurrencyHandler) CreateRate(c *gin.Context) {
+	var req models.CreateExchangeRateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": validation.FormatValidationErrors(err)})
+		return
+	}
+
+	from, err := money.ParseCurrency(req.FromCurrency)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Неподдерживаемая исходная валюта"})
+		return
+	}
+	to, err := money.ParseCurrency(req.ToCurrency)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Неподдерживаемая целевая валюта"})
+		return
+	}
+	if from == to {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Валюты должны различаться"})
+		return
+	}
+	if req.Rate.IsZero() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Курс должен быть больше нуля"})
+		return
+	}
+	effectiveDate, err := time.Parse("2006-01-02", req.EffectiveDate)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Неверный формат даты, ожидается YYYY-MM-DD"})
+		return
+	}
+
+	rate := models.ExchangeRate{
+		FromCurrency:  from,
+		ToCurrency:    to,
+		Rate:          req.Rate,
+		EffectiveDate: effectiveDate,
+		CreatedBy:     currentUserID(c),
+	}
+	if err := h.repo.CreateRate(&rate, c.GetString("company_id")); err != nil {
+		if errors.Is(err, repository.ErrRateExists) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Курс на эту дату уже задан"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, rate)
+}
+
+// DeleteRate deletes an exchange rate
+func (h *CurrencyHandler) DeleteRate(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+		return
+	}
+
+	if err := h.repo.DeleteRate(id, c.GetString("company_id")); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Exchange rate deleted"})
+}
@@ -1,11 +1,16 @@
 package handlers
 
 import (
+	"classmate-central/internal/logger"
+	"classmate-central/internal/models"
+	"classmate-central/internal/money"
 	"classmate-central/internal/repository"
+	"classmate-central/internal/services"
 	"net/http"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
 )
 
 type DashboardHandler struct {
@@ -15,6 +20,8 @@ type DashboardHandler struct {
 	studentRepo      *repository.StudentRepository
 	leadRepo         *repository.LeadRepository
 	debtRepo         *repository.DebtRepository
+	cashShiftRepo    *repository.CashShiftRepository
+	currencyService  *services.CurrencyService
 }
 
 func NewDashboardHandler(
@@ -24,6 +31,8 @@ func NewDashboardHandler(
 	studentRepo *repository.StudentRepository,
 	leadRepo *repository.LeadRepository,
 	debtRepo *repository.DebtRepository,
+	cashShiftRepo *repository.CashShiftRepository,
+	currencyService *services.CurrencyService,
 ) *DashboardHandler {
 	return &DashboardHandler{
 		lessonRepo:       lessonRepo,
@@ -32,12 +41,43 @@ func NewDashboardHandler(
 		studentRepo:      studentRepo,
 		leadRepo:         leadRepo,
 		debtRepo:         debtRepo,
+		cashShiftRepo:    cashShiftRepo,
+		currencyService:  currencyService,
 	}
 }
 
+// toBaseCurrency converts an amount into the dashboard currency. Amounts without an exchange
+// rate are left out of the totals (and logged) rather than mixed with other currencies.
+func toBaseCurrency(conv *services.CurrencyConverter, amount money.Money, at time.Time) (money.Money, bool) {
+	converted, err := conv.Convert(amount, at)
+	if err != nil {
+		logger.Warn("Amount skipped in dashboard totals", logger.ErrorField(err), zap.String("amount", amount.Format()))
+		return money.Money{}, false
+	}
+	return converted, true
+}
+
+// paymentsInBaseCurrency returns the payment transactions with amounts converted into the dashboard currency
+func paymentsInBaseCurrency(conv *services.CurrencyConverter, transactions []models.PaymentTransaction) []models.PaymentTransaction {
+	payments := make([]models.PaymentTransaction, 0, len(transactions))
+	for _, tx := range transactions {
+		if tx.Type != "payment" {
+			continue
+		}
+		amount, ok := toBaseCurrency(conv, tx.Amount, tx.CreatedAt)
+		if !ok {
+			continue
+		}
+		tx.Amount = amount
+		tx.Currency = conv.Currency()
+		payments = append(payments, tx)
+	}
+	return payments
+}
+
 type RevenuePoint struct {
-	Date   string  `json:"date"`
-	Amount float64 `json:"amount"`
+	Date   string      `json:"date"`
+	Amount money.Money `json:"amount"`
 }
 
 type AttendancePoint struct {
@@ -47,10 +87,11 @@ type AttendancePoint struct {
 }
 
 type DashboardStats struct {
-	Revenue struct {
-		Today     float64        `json:"today"`
-		ThisWeek  float64        `json:"thisWeek"`
-		ThisMonth float64        `json:"thisMonth"`
+	Currency money.Currency `json:"currency"` // all amounts are converted into the company base currency
+	Revenue  struct {
+		Today     money.Money    `json:"today"`
+		ThisWeek  money.Money    `json:"thisWeek"`
+		ThisMonth money.Money    `json:"thisMonth"`
 		Data      []RevenuePoint `json:"data"`
 	} `json:"revenue"`
 	Attendance struct {
@@ -72,10 +113,15 @@ type DashboardStats struct {
 		Cancelled int `json:"cancelled"`
 	} `json:"lessons"`
 	Financial struct {
-		TotalBalance    float64 `json:"totalBalance"`
-		PendingDebts    int     `json:"pendingDebts"`
-		TotalDebtAmount float64 `json:"totalDebtAmount"`
+		TotalBalance    money.Money `json:"totalBalance"`
+		PendingDebts    int         `json:"pendingDebts"`
+		TotalDebtAmount money.Money `json:"totalDebtAmount"`
 	} `json:"financial"`
+	CashShifts struct {
+		OpenShiftID      *int               `json:"openShiftId,omitempty"`
+		Discrepancies    []models.CashShift `json:"discrepancies"`
+		TotalDiscrepancy money.Money        `json:"totalDiscrepancy"`
+	} `json:"cashShifts"`
 	Leads struct {
 		New        int     `json:"new"`
 		InProgress int     `json:"inProgress"`
@@ -96,19 +142,25 @@ func (h *DashboardHandler) GetStats(c *gin.Context) {
 	weekStart := todayStart.AddDate(0, 0, -int(now.Weekday())+1) // Monday
 	monthStart := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
 
+	conv, err := h.currencyService.Converter(companyID, "")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	stats.Currency = conv.Currency()
+
 	// Revenue statistics
 	allTransactions, _ := h.paymentRepo.GetAllTransactions(companyID)
-	for _, tx := range allTransactions {
-		if tx.Type == "payment" {
-			if tx.CreatedAt.After(todayStart) && tx.CreatedAt.Before(todayEnd) {
-				stats.Revenue.Today += tx.Amount
-			}
-			if tx.CreatedAt.After(weekStart) {
-				stats.Revenue.ThisWeek += tx.Amount
-			}
-			if tx.CreatedAt.After(monthStart) {
-				stats.Revenue.ThisMonth += tx.Amount
-			}
+	payments := paymentsInBaseCurrency(conv, allTransactions)
+	for _, tx := range payments {
+		if tx.CreatedAt.After(todayStart) && tx.CreatedAt.Before(todayEnd) {
+			stats.Revenue.Today = stats.Revenue.Today.Add(tx.Amount)
+		}
+		if tx.CreatedAt.After(weekStart) {
+			stats.Revenue.ThisWeek = stats.Revenue.ThisWeek.Add(tx.Amount)
+		}
+		if tx.CreatedAt.After(monthStart) {
+			stats.Revenue.ThisMonth = stats.Revenue.ThisMonth.Add(tx.Amount)
 		}
 	}
 
@@ -118,12 +170,10 @@ func (h *DashboardHandler) GetStats(c *gin.Context) {
 		dateEnd := date.Add(24 * time.Hour)
 		dateStr := date.Format("02 Jan")
 
-		var dayAmount float64
-		for _, tx := range allTransactions {
-			if tx.Type == "payment" {
-				if tx.CreatedAt.After(date) && tx.CreatedAt.Before(dateEnd) {
-					dayAmount += tx.Amount
-				}
+		var dayAmount money.Money
+		for _, tx := range payments {
+			if tx.CreatedAt.After(date) && tx.CreatedAt.Before(dateEnd) {
+				dayAmount = dayAmount.Add(tx.Amount)
 			}
 		}
 
@@ -229,14 +279,32 @@ func (h *DashboardHandler) GetStats(c *gin.Context) {
 	// Financial statistics
 	allBalances, _ := h.paymentRepo.GetAllBalances(companyID)
 	for _, balance := range allBalances {
-		stats.Financial.TotalBalance += balance.Balance
+		if amount, ok := toBaseCurrency(conv, balance.Balance, now); ok {
+			stats.Financial.TotalBalance = stats.Financial.TotalBalance.Add(amount)
+		}
 	}
 
 	allDebts, _ := h.debtRepo.GetAll(companyID)
 	for _, debt := range allDebts {
-		if debt.Status == "pending" {
+		if debt.Status == "pending" || debt.Status == "partially_paid" {
 			stats.Financial.PendingDebts++
-			stats.Financial.TotalDebtAmount += debt.Amount
+			if amount, ok := toBaseCurrency(conv, debt.Remaining(), now); ok {
+				stats.Financial.TotalDebtAmount = stats.Financial.TotalDebtAmount.Add(amount)
+			}
+		}
+	}
+
+	// Cash shift statistics (recent closed shifts whose count did not match)
+	if openShift, _ := h.cashShiftRepo.GetOpenByBranch(companyID, branchID); openShift != nil {
+		stats.CashShifts.OpenShiftID = &openShift.ID
+	}
+	stats.CashShifts.Discrepancies, _ = h.cashShiftRepo.GetWithDiscrepancies(companyID, branchID, 10)
+	if stats.CashShifts.Discrepancies == nil {
+		stats.CashShifts.Discrepancies = []models.CashShift{}
+	}
+	for _, shift := range stats.CashShifts.Discrepancies {
+		if amount, ok := toBaseCurrency(conv, *shift.Discrepancy, now); ok {
+			stats.CashShifts.TotalDiscrepancy = stats.CashShifts.TotalDiscrepancy.Add(amount)
 		}
 	}
 
@@ -308,6 +376,12 @@ func (h *DashboardHandler) GetRevenueChart(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	conv, err := h.currencyService.Converter(companyID, "")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	payments := paymentsInBaseCurrency(conv, allTransactions)
 
 	now := time.Now()
 	var data []RevenuePoint
@@ -321,12 +395,10 @@ func (h *DashboardHandler) GetRevenueChart(c *gin.Context) {
 			dateEnd := date.Add(24 * time.Hour)
 			dateStr := date.Format("02 Jan")
 
-			var dayAmount float64
-			for _, tx := range allTransactions {
-				if tx.Type == "payment" {
-					if tx.CreatedAt.After(date) && tx.CreatedAt.Before(dateEnd) {
-						dayAmount += tx.Amount
-					}
+			var dayAmount money.Money
+			for _, tx := range payments {
+				if tx.CreatedAt.After(date) && tx.CreatedAt.Before(dateEnd) {
+					dayAmount = dayAmount.Add(tx.Amount)
 				}
 			}
 
@@ -344,12 +416,10 @@ func (h *DashboardHandler) GetRevenueChart(c *gin.Context) {
 			dateEnd := date.Add(24 * time.Hour)
 			dateStr := date.Format("02 Jan")
 
-			var dayAmount float64
-			for _, tx := range allTransactions {
-				if tx.Type == "payment" {
-					if tx.CreatedAt.After(date) && tx.CreatedAt.Before(dateEnd) {
-						dayAmount += tx.Amount
-					}
+			var dayAmount money.Money
+			for _, tx := range payments {
+				if tx.CreatedAt.After(date) && tx.CreatedAt.Before(dateEnd) {
+					dayAmount = dayAmount.Add(tx.Amount)
 				}
 			}
 
@@ -366,12 +436,10 @@ func (h *DashboardHandler) GetRevenueChart(c *gin.Context) {
 			monthEnd := monthStart.AddDate(0, 1, 0)
 			dateStr := monthStart.Format("Jan 2006")
 
-			var monthAmount float64
-			for _, tx := range allTransactions {
-				if tx.Type == "payment" {
-					if tx.CreatedAt.After(monthStart) && tx.CreatedAt.Before(monthEnd) {
-						monthAmount += tx.Amount
-					}
+			var monthAmount money.Money
+			for _, tx := range payments {
+				if tx.CreatedAt.After(monthStart) && tx.CreatedAt.Before(monthEnd) {
+					monthAmount = monthAmount.Add(tx.Amount)
 				}
 			}
 
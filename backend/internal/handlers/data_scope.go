@@ -0,0 +1,152 @@
+package handlers
+
+import (
+	"net/http"
+
+	"classmate-central/internal/middleware"
+	"classmate-central/internal/models"
+	"classmate-central/internal/repository"
+
+	"github.com/gin-gonic/gin"
+)
+
+// scopeBranches returns the branches a listing covers under the data scope of a permission:
+// every accessible branch for "all", otherwise the current branch.
+func scopeBranches(c *gin.Context, permission string) []string {
+	if middleware.DataScope(c, permission) == models.ScopeAll {
+		if ids, ok := c.Get("accessible_branch_ids"); ok {
+			if accessible, ok := ids.([]string); ok && len(accessible) > 0 {
+				return accessible
+			}
+		}
+	}
+	branchID := c.GetString("branch_id")
+	if branchID == "" {
+		branchID = c.GetString("company_id")
+	}
+	return []string{branchID}
+}
+
+// ownTeacherScope reports whether a permission is limited to the records of the user's own
+// teacher and returns that teacher. Without a linked teacher the ID is "" and matches nothing.
+func ownTeacherScope(c *gin.Context, permission string) (string, bool) {
+	if middleware.DataScope(c, permission) != models.ScopeOwn {
+		return "", false
+	}
+	return c.GetString("teacher_id"), true
+}
+
+// teacherInScope reports whether a record taught by teacherID is visible under the permission
+func teacherInScope(c *gin.Context, permission, teacherID string) bool {
+	ownTeacherID, own := ownTeacherScope(c, permission)
+	return !own || (ownTeacherID != "" && ownTeacherID == teacherID)
+}
+
+// studentInScope applies the "own" data scope of a permission to a single student.
+// It writes the response and returns false when the student must not be shown.
+func studentInScope(c *gin.Context, students *repository.StudentRepository, permission, studentID string) bool {
+	teacherID, own := ownTeacherScope(c, permission)
+	if !own {
+		return true
+	}
+	taught := false
+	if teacherID != "" {
+		var err error
+		taught, err = students.IsTaughtBy(studentID, teacherID, c.GetString("company_id"))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return false
+		}
+	}
+	if !taught {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Student not found"})
+		return false
+	}
+	return true
+}
+
+// lessonInScope applies the "own" data scope of a permission to a single lesson.
+// It writes the response and returns false when the lesson must not be shown.
+func lessonInScope(c *gin.Context, lessons *repository.LessonRepository, permission, lessonID string) bool {
+	if _, own := ownTeacherScope(c, permission); !own {
+		return true
+	}
+	lesson, err := lessons.GetByID(lessonID, c.GetString("company_id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return false
+	}
+	if lesson == nil || !teacherInScope(c, permission, lesson.TeacherID) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Lesson not found"})
+		return false
+	}
+	return true
+}
+
+// canViewFinance reports whether prices, payments and debts may be shown
+func canViewFinance(c *gin.Context) bool {
+	return middleware.HasPermission(c, "finance.view")
+}
+
+// subscriptionWithoutPrices hides the price fields of a subscription: the nil fields
+// shadow the embedded ones and are omitted from JSON.
+type subscriptionWithoutPrices struct {
+	*models.StudentSubscription
+	TotalPrice     *struct{} `json:"totalPrice,omitempty"`
+	PricePerLesson *struct{} `json:"pricePerLesson,omitempty"`
+}
+
+// subscriptionResponse returns the subscription as the user may see it
+func subscriptionResponse(c *gin.Context, sub *models.StudentSubscription) interface{} {
+	if sub == nil || canViewFinance(c) {
+		return sub
+	}
+	return subscriptionWithoutPrices{StudentSubscription: sub}
+}
+
+// subscriptionsResponse returns the subscriptions as the user may see them
+func subscriptionsResponse(c *gin.Context, subs []models.StudentSubscription) interface{} {
+	if canViewFinance(c) {
+		return subs
+	}
+	hidden := make([]subscriptionWithoutPrices, len(subs))
+	for i := range subs {
+		hidden[i] = subscriptionWithoutPrices{StudentSubscription: &subs[i]}
+	}
+	return hidden
+}
+
+// financeActivityTypes are student activities that reveal payments or debts
+var financeActivityTypes = map[string]bool{"payment": true, "debt_created": true}
+
+// financeNotificationTypes are student notifications that reveal debts or instalments
+var financeNotificationTypes = map[string]bool{"debt_reminder": true, "installment_reminder": true}
+
+// hideFinanceActivities drops payment and debt activities and the metadata (amounts) of
+// subscription changes
+func hideFinanceActivities(activities []*models.StudentActivityLog) []*models.StudentActivityLog {
+	visible := make([]*models.StudentActivityLog, 0, len(activities))
+	for _, activity := range activities {
+		if financeActivityTypes[activity.ActivityType] {
+			continue
+		}
+		if activity.ActivityType == "subscription_change" && activity.Metadata != nil {
+			stripped := *activity
+			stripped.Metadata = nil
+			activity = &stripped
+		}
+		visible = append(visible, activity)
+	}
+	return visible
+}
+
+// hideFinanceNotifications drops debt and instalment notifications
+func hideFinanceNotifications(notifications []*models.Notification) []*models.Notification {
+	visible := make([]*models.Notification, 0, len(notifications))
+	for _, n := range notifications {
+		if !financeNotificationTypes[n.Type] {
+			visible = append(visible, n)
+		}
+	}
+	return visible
+}
@@ -0,0 +1,89 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+
+	"classmate-central/internal/models"
+	"classmate-central/internal/money"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func scopeTestContext(permissions []string, scopes map[string]string, teacherID string) *gin.Context {
+	gin.SetMode(gin.TestMode)
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Set("company_id", "company")
+	c.Set("branch_id", "north")
+	c.Set("accessible_branch_ids", []string{"north", "south"})
+	c.Set("permissions", permissions)
+	c.Set("permission_scopes", scopes)
+	if teacherID != "" {
+		c.Set("teacher_id", teacherID)
+	}
+	return c
+}
+
+func TestDataScopeBranchesAndTeacher(t *testing.T) {
+	c := scopeTestContext(nil, map[string]string{
+		"students.view": models.ScopeAll,
+		"lessons.view":  models.ScopeOwn,
+	}, "t1")
+
+	assert.Equal(t, []string{"north", "south"}, scopeBranches(c, "students.view"))
+	assert.Equal(t, []string{"north"}, scopeBranches(c, "lessons.view"))
+	// Permissions without a scope keep the current branch
+	assert.Equal(t, []string{"north"}, scopeBranches(c, "groups.view"))
+
+	assert.True(t, teacherInScope(c, "lessons.view", "t1"))
+	assert.False(t, teacherInScope(c, "lessons.view", "t2"))
+	assert.True(t, teacherInScope(c, "students.view", "t2"))
+
+	lessons := lessonsInScope(c, []*models.Lesson{{ID: "l1", TeacherID: "t1"}, {ID: "l2", TeacherID: "t2"}})
+	require.Len(t, lessons, 1)
+	assert.Equal(t, "l1", lessons[0].ID)
+}
+
+func TestOwnScopeWithoutLinkedTeacherShowsNothing(t *testing.T) {
+	c := scopeTestContext(nil, map[string]string{"lessons.view": models.ScopeOwn}, "")
+
+	assert.False(t, teacherInScope(c, "lessons.view", ""))
+	assert.Empty(t, lessonsInScope(c, []*models.Lesson{{ID: "l1"}, {ID: "l2", TeacherID: "t1"}}))
+}
+
+func TestSubscriptionPricesHiddenWithoutFinanceView(t *testing.T) {
+	sub := models.StudentSubscription{ID: "s1", TotalLessons: 8, TotalPrice: money.FromMinor(800000)}
+
+	body, err := json.Marshal(subscriptionsResponse(scopeTestContext(nil, nil, ""), []models.StudentSubscription{sub}))
+	require.NoError(t, err)
+	var hidden []map[string]interface{}
+	require.NoError(t, json.Unmarshal(body, &hidden))
+	require.Len(t, hidden, 1)
+	assert.Equal(t, "s1", hidden[0]["id"])
+	assert.NotContains(t, hidden[0], "totalPrice")
+	assert.NotContains(t, hidden[0], "pricePerLesson")
+
+	body, err = json.Marshal(subscriptionResponse(scopeTestContext([]string{"finance.view"}, nil, ""), &sub))
+	require.NoError(t, err)
+	var shown map[string]interface{}
+	require.NoError(t, json.Unmarshal(body, &shown))
+	assert.Contains(t, shown, "totalPrice")
+}
+
+func TestHideFinanceActivities(t *testing.T) {
+	metadata := `{"price":"8000"}`
+	activities := hideFinanceActivities([]*models.StudentActivityLog{
+		{ID: 1, ActivityType: "payment"},
+		{ID: 2, ActivityType: "attendance"},
+		{ID: 3, ActivityType: "debt_created"},
+		{ID: 4, ActivityType: "subscription_change", Metadata: &metadata},
+	})
+
+	require.Len(t, activities, 2)
+	assert.Equal(t, 2, activities[0].ID)
+	assert.Equal(t, 4, activities[1].ID)
+	assert.Nil(t, activities[1].Metadata)
+}
@@ -2,19 +2,29 @@ package handlers
 
 import (
 	"classmate-central/internal/models"
+	"classmate-central/internal/money"
 	"classmate-central/internal/repository"
+	"classmate-central/internal/services"
+	"errors"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
 type DebtHandler struct {
-	repo *repository.DebtRepository
+	repo          *repository.DebtRepository
+	debtService   *services.DebtService
+	exportService *services.ExportService
 }
 
-func NewDebtHandler(repo *repository.DebtRepository) *DebtHandler {
-	return &DebtHandler{repo: repo}
+func NewDebtHandler(repo *repository.DebtRepository, debtService *services.DebtService, exportService *services.ExportService) *DebtHandler {
+	return &DebtHandler{
+		repo:          repo,
+		debtService:   debtService,
+		exportService: exportService,
+	}
 }
 
 func (h *DebtHandler) Create(c *gin.Context) {
@@ -106,3 +116,94 @@ func (h *DebtHandler) Delete(c *gin.Context) {
 
 	c.JSON(http.StatusOK, gin.H{"message": "Debt deleted successfully"})
 }
+
+// GetPayments returns the payments allocated to a debt
+func (h *DebtHandler) GetPayments(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid debt ID"})
+		return
+	}
+
+	payments, err := h.repo.GetPayments(id, c.GetString("company_id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, payments)
+}
+
+// GetAgingReport returns outstanding debts bucketed by days overdue per branch (supports ?branchId=, ?currency=)
+func (h *DebtHandler) GetAgingReport(c *gin.Context) {
+	report, ok := h.agingReport(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, report)
+}
+
+// ExportAgingPDF exports the aging report as PDF
+func (h *DebtHandler) ExportAgingPDF(c *gin.Context) {
+	report, ok := h.agingReport(c)
+	if !ok {
+		return
+	}
+
+	pdfData, err := h.exportService.ExportDebtAgingPDF(report)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate PDF"})
+		return
+	}
+
+	c.Header("Content-Type", "application/pdf")
+	c.Header("Content-Disposition", `attachment; filename="debt_aging_`+time.Now().Format("20060102_150405")+`.pdf"`)
+	c.Data(http.StatusOK, "application/pdf", pdfData)
+}
+
+// ExportAgingExcel exports the aging report as Excel
+func (h *DebtHandler) ExportAgingExcel(c *gin.Context) {
+	report, ok := h.agingReport(c)
+	if !ok {
+		return
+	}
+
+	excelData, err := h.exportService.ExportDebtAgingExcel(report)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate Excel"})
+		return
+	}
+
+	c.Header("Content-Type", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet")
+	c.Header("Content-Disposition", `attachment; filename="debt_aging_`+time.Now().Format("20060102_150405")+`.xlsx"`)
+	c.Data(http.StatusOK, "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet", excelData)
+}
+
+func (h *DebtHandler) agingReport(c *gin.Context) (*models.DebtAgingReport, bool) {
+	branchIDs, ok := branchFilter(c)
+	if !ok {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Access denied to this branch"})
+		return nil, false
+	}
+
+	var currency money.Currency
+	if code := c.Query("currency"); code != "" {
+		parsed, err := money.ParseCurrency(code)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Неподдерживаемая валюта"})
+			return nil, false
+		}
+		currency = parsed
+	}
+
+	report, err := h.debtService.GetAgingReport(c.GetString("company_id"), branchIDs, time.Now(), currency)
+	if errors.Is(err, services.ErrNoExchangeRate) {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Не задан курс валюты для пересчёта: " + err.Error()})
+		return nil, false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return nil, false
+	}
+	return report, true
+}
@@ -3,6 +3,7 @@ package handlers
 import (
 	"classmate-central/internal/logger"
 	"classmate-central/internal/models"
+	"classmate-central/internal/money"
 	"classmate-central/internal/repository"
 	"classmate-central/internal/services"
 	"net/http"
@@ -140,7 +141,7 @@ func (h *ExportHandler) ExportStudentsPDF(c *gin.Context) {
 		return
 	}
 
-	students, err := h.studentRepo.GetAll(companyID, branchID)
+	students, err := h.scopedStudents(c, companyID)
 	if err != nil {
 		logger.Error("Failed to fetch students for PDF export", zap.Error(err), zap.String("company_id", companyID))
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch students"})
@@ -176,7 +177,7 @@ func (h *ExportHandler) ExportStudentsExcel(c *gin.Context) {
 		return
 	}
 
-	students, err := h.studentRepo.GetAll(companyID, branchID)
+	students, err := h.scopedStudents(c, companyID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch students"})
 		return
@@ -242,6 +243,7 @@ func (h *ExportHandler) ExportSchedulePDF(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch lessons"})
 		return
 	}
+	lessons = lessonsInScope(c, lessons)
 
 	// Filter lessons by date range first
 	filteredLessons := []*models.Lesson{}
@@ -311,6 +313,7 @@ func (h *ExportHandler) ExportScheduleExcel(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch lessons"})
 		return
 	}
+	lessons = lessonsInScope(c, lessons)
 
 	// Filter lessons by date range first
 	filteredLessons := []*models.Lesson{}
@@ -391,6 +394,15 @@ func (h *ExportHandler) filterTransactions(transactions []models.PaymentTransact
 	return filtered
 }
 
+// scopedStudents loads the students covered by the data scope of students.view
+func (h *ExportHandler) scopedStudents(c *gin.Context, companyID string) ([]*models.Student, error) {
+	branchIDs := scopeBranches(c, "students.view")
+	if teacherID, own := ownTeacherScope(c, "students.view"); own {
+		return h.studentRepo.GetAllForTeacher(companyID, branchIDs, teacherID)
+	}
+	return h.studentRepo.GetAllByBranches(companyID, branchIDs)
+}
+
 func (h *ExportHandler) filterStudents(students []*models.Student, c *gin.Context) []*models.Student {
 	filtered := []*models.Student{}
 
@@ -410,14 +422,14 @@ func (h *ExportHandler) filterStudents(students []*models.Student, c *gin.Contex
 		zap.Int("total_students", len(students)),
 	)
 
-	// Get balances if hasBalance filter is set
-	var balanceMap map[string]float64
-	if hasBalanceStr == "true" {
+	// Get balances if hasBalance filter is set (balances are finance data)
+	var balanceMap map[string]money.Money
+	if hasBalanceStr == "true" && canViewFinance(c) {
 		companyID := c.GetString("company_id")
 		if companyID != "" {
 			balances, err := h.paymentRepo.GetAllBalances(companyID)
 			if err == nil {
-				balanceMap = make(map[string]float64)
+				balanceMap = make(map[string]money.Money)
 				for _, balance := range balances {
 					balanceMap[balance.StudentID] = balance.Balance
 				}
@@ -492,7 +504,7 @@ func (h *ExportHandler) filterStudents(students []*models.Student, c *gin.Contex
 
 		// HasBalance filter
 		if hasBalanceStr == "true" && balanceMap != nil {
-			if balanceMap[student.ID] <= 0 {
+			if !balanceMap[student.ID].IsPositive() {
 				continue
 			}
 		}
@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"classmate-central/internal/repository"
+	"classmate-central/internal/validation"
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+type FiscalHandler struct {
+	repo *repository.FiscalReceiptRepository
+}
+
+func NewFiscalHandler(repo *repository.FiscalReceiptRepository) *FiscalHandler {
+	return &FiscalHandler{repo: repo}
+}
+
+// GetReceipts returns fiscal receipts (supports ?status= and ?branchId=)
+func (h *FiscalHandler) GetReceipts(c *gin.Context) {
+	branchIDs, ok := branchFilter(c)
+	if !ok {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Access denied to this branch"})
+		return
+	}
+
+	status := c.Query("status")
+	if status != "" {
+		if err := validation.ValidateOneOf(status, []string{"pending", "registered", "failed"}, "status"); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	receipts, err := h.repo.List(status, c.GetString("company_id"), branchIDs)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, receipts)
+}
+
+// GetStats returns the number of pending, registered and failed receipts
+func (h *FiscalHandler) GetStats(c *gin.Context) {
+	stats, err := h.repo.GetStats(c.GetString("company_id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, stats)
+}
+
+// RetryReceipt puts a failed receipt back in the registration queue
+func (h *FiscalHandler) RetryReceipt(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+		return
+	}
+
+	if err := h.repo.Retry(id, c.GetString("company_id")); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Failed receipt not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Receipt queued for registration"})
+}
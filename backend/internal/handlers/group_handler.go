@@ -24,22 +24,27 @@ func NewGroupHandler(repo *repository.GroupRepository, lessonRepo *repository.Le
 
 func (h *GroupHandler) GetAll(c *gin.Context) {
 	companyID := c.GetString("company_id")
-	branchID := c.GetString("branch_id")
 
-	// Используем выбранный филиал для изоляции данных
-	// Если branchID не установлен, используем company_id как fallback
-	if branchID == "" {
-		branchID = companyID
-	}
-	
+	// Данные ограничены областью видимости groups.view
 	var groups []*models.Group
 	var err error
-	groups, err = h.repo.GetAll(companyID, branchID)
+	groups, err = h.repo.GetAllByBranches(companyID, scopeBranches(c, "groups.view"))
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
+	// Scope "own": only the groups the user teaches
+	if _, own := ownTeacherScope(c, "groups.view"); own {
+		visible := []*models.Group{}
+		for _, group := range groups {
+			if teacherInScope(c, "groups.view", group.TeacherID) {
+				visible = append(visible, group)
+			}
+		}
+		groups = visible
+	}
+
 	c.JSON(http.StatusOK, groups)
 }
 
@@ -52,7 +57,7 @@ func (h *GroupHandler) GetByID(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
-	if group == nil {
+	if group == nil || !teacherInScope(c, "groups.view", group.TeacherID) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Group not found"})
 		return
 	}
@@ -99,15 +104,9 @@ func (h *GroupHandler) Update(c *gin.Context) {
 
 func (h *GroupHandler) Delete(c *gin.Context) {
 	id := c.Param("id")
-	companyID := c.GetString("company_id")
-
-	// Delete all lessons associated with this group first
-	if err := h.lessonRepo.DeleteByGroupID(id, companyID); err != nil {
-		log.Printf("Warning: Failed to delete lessons for group %s: %v", id, err)
-		// Continue with group deletion even if lesson deletion fails
-	}
 
-	if err := h.repo.Delete(id, companyID); err != nil {
+	// The group's lessons go to the trash together with it
+	if err := h.repo.Delete(id, auditActor(c)); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -0,0 +1,120 @@
+package handlers
+
+import (
+	"classmate-central/internal/models"
+	"classmate-central/internal/repository"
+	"classmate-central/internal/services"
+	"classmate-central/internal/validation"
+	"database/sql"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type InstallmentHandler struct {
+	repo               *repository.InstallmentRepository
+	installmentService *services.InstallmentService
+}
+
+func NewInstallmentHandler(repo *repository.InstallmentRepository, installmentService *services.InstallmentService) *InstallmentHandler {
+	return &InstallmentHandler{
+		repo:               repo,
+		installmentService: installmentService,
+	}
+}
+
+// GetPlan returns the installment plan of a subscription with its schedule
+func (h *InstallmentHandler) GetPlan(c *gin.Context) {
+	plan, err := h.repo.GetPlanBySubscription(c.Param("id"), c.GetString("company_id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if plan == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Installment plan not found"})
+		return
+	}
+	c.JSON(http.StatusOK, plan)
+}
+
+// CreatePlan splits the subscription price into installments
+func (h *InstallmentHandler) CreatePlan(c *gin.Context) {
+	var req models.CreateInstallmentPlanRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": validation.FormatValidationErrors(err)})
+		return
+	}
+	if req.BillingMode != "" {
+		if err := validation.ValidateOneOf(req.BillingMode, []string{"debt", "invoice"}, "billingMode"); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	if req.ReminderDays != nil && *req.ReminderDays < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "reminderDays must not be negative"})
+		return
+	}
+	if req.GraceDays != nil && *req.GraceDays < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "graceDays must not be negative"})
+		return
+	}
+
+	plan, err := h.installmentService.CreatePlan(c.Param("id"), req, currentUserID(c), c.GetString("company_id"))
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrInvalidSchedule), errors.Is(err, services.ErrSubscriptionNotPayable):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case errors.Is(err, repository.ErrPlanExists):
+			c.JSON(http.StatusConflict, gin.H{"error": "У абонемента уже есть план рассрочки"})
+		case errors.Is(err, sql.ErrNoRows):
+			c.JSON(http.StatusNotFound, gin.H{"error": "Subscription not found"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+	if plan == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Subscription not found"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, plan)
+}
+
+// CancelPlan cancels the remaining installments of a subscription plan
+func (h *InstallmentHandler) CancelPlan(c *gin.Context) {
+	if err := h.repo.CancelPlan(c.Param("id"), c.GetString("company_id")); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Active installment plan not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Installment plan cancelled"})
+}
+
+// List returns installments across plans (supports ?status= and ?branchId=)
+func (h *InstallmentHandler) List(c *gin.Context) {
+	branchIDs, ok := branchFilter(c)
+	if !ok {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Access denied to this branch"})
+		return
+	}
+
+	status := c.Query("status")
+	if status != "" {
+		if err := validation.ValidateOneOf(status, []string{"scheduled", "due", "partially_paid", "paid", "overdue", "cancelled"}, "status"); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	installments, err := h.repo.List(status, c.GetString("company_id"), branchIDs)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, installments)
+}
@@ -3,6 +3,8 @@ package handlers
 import (
 	"classmate-central/internal/models"
 	"classmate-central/internal/repository"
+	"database/sql"
+	"errors"
 	"fmt"
 	"net/http"
 
@@ -131,10 +133,22 @@ func (h *LeadHandler) GetConversionStats(c *gin.Context) {
 	c.JSON(http.StatusOK, stats)
 }
 
+// leadExists writes a 404 and returns false when the lead does not belong to the company
+func (h *LeadHandler) leadExists(c *gin.Context, leadID string) bool {
+	if _, err := h.repo.GetByID(leadID, c.GetString("company_id")); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Lead not found"})
+		return false
+	}
+	return true
+}
+
 // Activities
 func (h *LeadHandler) GetActivities(c *gin.Context) {
 	leadID := c.Param("id")
-	activities, err := h.repo.GetActivities(leadID)
+	if !h.leadExists(c, leadID) {
+		return
+	}
+	activities, err := h.repo.GetActivities(leadID, c.GetString("company_id"))
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -144,6 +158,9 @@ func (h *LeadHandler) GetActivities(c *gin.Context) {
 
 func (h *LeadHandler) AddActivity(c *gin.Context) {
 	leadID := c.Param("id")
+	if !h.leadExists(c, leadID) {
+		return
+	}
 	var activity models.LeadActivity
 	if err := c.ShouldBindJSON(&activity); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
@@ -158,7 +175,7 @@ func (h *LeadHandler) AddActivity(c *gin.Context) {
 		}
 	}
 
-	if err := h.repo.AddActivity(&activity); err != nil {
+	if err := h.repo.AddActivity(&activity, c.GetString("company_id")); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -169,7 +186,10 @@ func (h *LeadHandler) AddActivity(c *gin.Context) {
 // Tasks
 func (h *LeadHandler) GetTasks(c *gin.Context) {
 	leadID := c.Param("id")
-	tasks, err := h.repo.GetTasks(leadID)
+	if !h.leadExists(c, leadID) {
+		return
+	}
+	tasks, err := h.repo.GetTasks(leadID, c.GetString("company_id"))
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -179,6 +199,9 @@ func (h *LeadHandler) GetTasks(c *gin.Context) {
 
 func (h *LeadHandler) CreateTask(c *gin.Context) {
 	leadID := c.Param("id")
+	if !h.leadExists(c, leadID) {
+		return
+	}
 	var task models.LeadTask
 	if err := c.ShouldBindJSON(&task); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
@@ -190,7 +213,7 @@ func (h *LeadHandler) CreateTask(c *gin.Context) {
 		task.Status = "pending"
 	}
 
-	if err := h.repo.CreateTask(&task); err != nil {
+	if err := h.repo.CreateTask(&task, c.GetString("company_id")); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -213,8 +236,13 @@ func (h *LeadHandler) UpdateTask(c *gin.Context) {
 		return
 	}
 	task.ID = id
+	task.LeadID = c.Param("id")
 
-	if err := h.repo.UpdateTask(&task); err != nil {
+	if err := h.repo.UpdateTask(&task, c.GetString("company_id")); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Task not found"})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -26,23 +26,17 @@ func NewLessonHandler(repo *repository.LessonRepository, roomRepo *repository.Ro
 
 func (h *LessonHandler) GetAll(c *gin.Context) {
 	companyID := c.GetString("company_id")
-	branchID := c.GetString("branch_id")
-	
-	// Используем выбранный филиал для изоляции данных
-	// Если branchID не установлен, используем company_id как fallback
-	if branchID == "" {
-		branchID = companyID
-	}
-	
+
+	// Данные ограничены областью видимости lessons.view
 	var lessons []*models.Lesson
 	var err error
-	lessons, err = h.repo.GetAll(companyID, branchID)
+	lessons, err = h.repo.GetAllByBranches(companyID, scopeBranches(c, "lessons.view"))
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, lessons)
+	c.JSON(http.StatusOK, lessonsInScope(c, lessons))
 }
 
 func (h *LessonHandler) GetIndividual(c *gin.Context) {
@@ -53,7 +47,21 @@ func (h *LessonHandler) GetIndividual(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, lessons)
+	c.JSON(http.StatusOK, lessonsInScope(c, lessons))
+}
+
+// lessonsInScope keeps only the user's own lessons when lessons.view has the "own" scope
+func lessonsInScope(c *gin.Context, lessons []*models.Lesson) []*models.Lesson {
+	if _, own := ownTeacherScope(c, "lessons.view"); !own {
+		return lessons
+	}
+	visible := []*models.Lesson{}
+	for _, lesson := range lessons {
+		if teacherInScope(c, "lessons.view", lesson.TeacherID) {
+			visible = append(visible, lesson)
+		}
+	}
+	return visible
 }
 
 func (h *LessonHandler) GetByID(c *gin.Context) {
@@ -65,7 +73,7 @@ func (h *LessonHandler) GetByID(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
-	if lesson == nil {
+	if lesson == nil || !teacherInScope(c, "lessons.view", lesson.TeacherID) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Lesson not found"})
 		return
 	}
@@ -178,9 +186,8 @@ func (h *LessonHandler) Update(c *gin.Context) {
 
 func (h *LessonHandler) Delete(c *gin.Context) {
 	id := c.Param("id")
-	companyID := c.GetString("company_id")
 
-	if err := h.repo.Delete(id, companyID); err != nil {
+	if err := h.repo.Delete(id, auditActor(c)); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -442,6 +449,11 @@ func (h *LessonHandler) GetByTeacher(c *gin.Context) {
 	teacherID := c.Param("teacherId")
 	companyID := c.GetString("company_id")
 
+	if !teacherInScope(c, "lessons.view", teacherID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Access denied to lessons of this teacher"})
+		return
+	}
+
 	// Get query parameters for date range
 	startDateStr := c.Query("startDate")
 	endDateStr := c.Query("endDate")
@@ -2,14 +2,18 @@ package handlers
 
 import (
 	"bytes"
+	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"os"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
 
+	"classmate-central/internal/models"
 	"classmate-central/internal/repository"
 	"classmate-central/internal/services"
 
@@ -24,6 +28,8 @@ type MigrationHandler struct {
 	lessonRepo       *repository.LessonRepository
 	subscriptionRepo *repository.SubscriptionRepository
 	branchRepo       *repository.BranchRepository
+	dataService      *services.CompanyDataService
+	planService      *services.PlanService
 }
 
 func NewMigrationHandler(
@@ -34,6 +40,8 @@ func NewMigrationHandler(
 	lessonRepo *repository.LessonRepository,
 	subscriptionRepo *repository.SubscriptionRepository,
 	branchRepo *repository.BranchRepository,
+	dataService *services.CompanyDataService,
+	planService *services.PlanService,
 ) *MigrationHandler {
 	return &MigrationHandler{
 		teacherRepo:      teacherRepo,
@@ -43,6 +51,8 @@ func NewMigrationHandler(
 		lessonRepo:       lessonRepo,
 		subscriptionRepo: subscriptionRepo,
 		branchRepo:       branchRepo,
+		dataService:      dataService,
+		planService:      planService,
 	}
 }
 
@@ -92,6 +102,9 @@ func (h *MigrationHandler) StartMigration(c *gin.Context) {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Company ID not found"})
 		return
 	}
+	if planLimitReached(c, h.planService, models.PlanResourceStorage) {
+		return
+	}
 
 	// Check if migration is already running
 	statusMutex.RLock()
@@ -288,18 +301,36 @@ func (h *MigrationHandler) runMigration(companyID string, req MigrationRequest,
 		scriptPath = "migration/migration_old.js"
 	}
 
+	plan, err := h.planService.GetCompanyPlan(companyID)
+	if err != nil {
+		statusMutex.Lock()
+		status.Status = "failed"
+		status.Error = "Failed to check plan limits"
+		now := time.Now()
+		status.CompletedAt = &now
+		statusMutex.Unlock()
+		return
+	}
+	var maxStudents, maxBranches *int64
+	if plan != nil {
+		maxStudents = plan.Limit(models.PlanResourceStudents)
+		maxBranches = plan.Limit(models.PlanResourceBranches)
+	}
+
 	// Run migration with streaming progress updates
 	result, err := migrationService.RunMigration(services.MigrationConfig{
-		AlfaCRMURL: req.AlfaCRMURL,
-		Email:      req.Email,
-		APIKey:     req.APIKey,
-		CompanyID:  companyID,
-		DBHost:     dbHost,
-		DBPort:     dbPort,
-		DBName:     dbName,
-		DBUser:     dbUser,
-		DBPassword: dbPassword,
-		ScriptPath: scriptPath,
+		AlfaCRMURL:  req.AlfaCRMURL,
+		Email:       req.Email,
+		APIKey:      req.APIKey,
+		CompanyID:   companyID,
+		DBHost:      dbHost,
+		DBPort:      dbPort,
+		DBName:      dbName,
+		DBUser:      dbUser,
+		DBPassword:  dbPassword,
+		ScriptPath:  scriptPath,
+		MaxStudents: maxStudents,
+		MaxBranches: maxBranches,
 	}, progressCallback)
 
 	// Always save logs, even on success or failure
@@ -321,6 +352,11 @@ func (h *MigrationHandler) runMigration(companyID string, req MigrationRequest,
 		statusMutex.Lock()
 		status.Status = "failed"
 		status.Error = fmt.Sprintf("Migration failed: %v", err)
+		if result != nil {
+			if message := planLimitFailure(result.Stderr); message != "" {
+				status.Error = message
+			}
+		}
 		now := time.Now()
 		status.CompletedAt = &now
 		statusMutex.Unlock()
@@ -421,76 +457,119 @@ func (h *MigrationHandler) runMigration(companyID string, req MigrationRequest,
 	statusMutex.Unlock()
 }
 
-// ClearCompanyData clears all data for the current company
+// DataConfirmationRequest carries the company name typed to confirm a wipe or restore
+type DataConfirmationRequest struct {
+	Confirmation string `json:"confirmation" binding:"required"`
+}
+
+// ClearCompanyData starts a background job that snapshots the company's data and then deletes it.
+// The company name has to be typed as confirmation.
+// POST /api/migration/clear-data
 func (h *MigrationHandler) ClearCompanyData(c *gin.Context) {
-	companyID := c.GetString("company_id")
-	if companyID == "" {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Company ID not found"})
+	var req DataConfirmationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Type the company name to confirm"})
+		return
+	}
+
+	if migrationRunning(c.GetString("company_id")) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Migration is already running"})
 		return
 	}
 
-	// Get database connection (assuming we can access it through one of the repositories)
-	// We'll use a direct SQL approach for this operation
-	db := h.teacherRepo.GetDB() // We need to add this method to repository
+	job, err := h.dataService.StartWipe(auditActor(c), req.Confirmation)
+	h.respondDataJob(c, job, err)
+}
 
-	// Start transaction
-	tx, err := db.Begin()
+// RestoreSnapshot starts a background job that replaces the company's data with a snapshot
+// POST /api/migration/snapshots/:id/restore
+func (h *MigrationHandler) RestoreSnapshot(c *gin.Context) {
+	snapshotID, err := strconv.ParseInt(c.Param("id"), 10, 64)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to start transaction: %v", err)})
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid snapshot ID"})
 		return
 	}
-	defer tx.Rollback()
-
-	// Delete in correct order (respecting foreign keys)
-	queries := []string{
-		// Delete lessons and related data
-		"DELETE FROM lesson_students WHERE company_id = $1",
-		"DELETE FROM lesson_attendance WHERE lesson_id IN (SELECT id FROM lessons WHERE company_id = $1)",
-		"DELETE FROM lessons WHERE company_id = $1",
-
-		// Delete subscriptions
-		"DELETE FROM subscription_freezes WHERE subscription_id IN (SELECT id FROM student_subscriptions WHERE company_id = $1)",
-		"DELETE FROM student_subscriptions WHERE company_id = $1",
-		"DELETE FROM subscription_types WHERE company_id = $1",
-
-		// Delete finance data
-		"DELETE FROM payment_transactions WHERE company_id = $1",
-		"DELETE FROM debt_records WHERE company_id = $1",
-
-		// Delete group data
-		// Note: group_schedule table doesn't exist in current schema
-		"DELETE FROM student_groups WHERE group_id IN (SELECT id FROM groups WHERE company_id = $1)",
-		"DELETE FROM groups WHERE company_id = $1",
-
-		// Delete students and related data
-		"DELETE FROM student_balance WHERE student_id IN (SELECT id FROM students WHERE company_id = $1)",
-		"DELETE FROM student_activity_log WHERE student_id IN (SELECT id FROM students WHERE company_id = $1)",
-		"DELETE FROM student_notes WHERE student_id IN (SELECT id FROM students WHERE company_id = $1)",
-		"DELETE FROM notifications WHERE student_id IN (SELECT id FROM students WHERE company_id = $1)",
-		"DELETE FROM students WHERE company_id = $1",
-
-		// Delete teachers and rooms
-		"DELETE FROM teachers WHERE company_id = $1",
-		"DELETE FROM rooms WHERE company_id = $1",
-	}
-
-	for _, query := range queries {
-		_, err := tx.Exec(query, companyID)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to clear data: %v", err)})
-			return
-		}
+	var req DataConfirmationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Type the company name to confirm"})
+		return
 	}
 
-	// Commit transaction
-	if err := tx.Commit(); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to commit: %v", err)})
+	if migrationRunning(c.GetString("company_id")) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Migration is already running"})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"message": "All company data cleared successfully",
-	})
+	job, err := h.dataService.StartRestore(auditActor(c), snapshotID, req.Confirmation)
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Snapshot not found"})
+		return
+	}
+	h.respondDataJob(c, job, err)
+}
+
+// migrationRunning reports whether an AlfaCRM import is writing into the company right now
+func migrationRunning(companyID string) bool {
+	statusMutex.RLock()
+	defer statusMutex.RUnlock()
+	status, exists := migrationStatuses[companyID]
+	return exists && status.Status == "running"
+}
+
+func (h *MigrationHandler) respondDataJob(c *gin.Context, job *models.CompanyDataJob, err error) {
+	switch {
+	case errors.Is(err, services.ErrConfirmationMismatch):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Confirmation does not match the company name"})
+	case errors.Is(err, repository.ErrDataJobActive):
+		c.JSON(http.StatusConflict, gin.H{"error": "Another wipe or restore is already running"})
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start job"})
+	default:
+		c.JSON(http.StatusAccepted, job)
+	}
+}
+
+// GetDataJobs returns the company's latest wipe and restore jobs
+// GET /api/migration/data-jobs
+func (h *MigrationHandler) GetDataJobs(c *gin.Context) {
+	jobs, err := h.dataService.ListJobs(c.GetString("company_id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load jobs"})
+		return
+	}
+	c.JSON(http.StatusOK, jobs)
+}
+
+// GetDataJob returns a wipe or restore job, for polling its progress
+// GET /api/migration/data-jobs/:id
+func (h *MigrationHandler) GetDataJob(c *gin.Context) {
+	jobID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid job ID"})
+		return
+	}
+
+	job, err := h.dataService.GetJob(c.GetString("company_id"), jobID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load job"})
+		return
+	}
+	if job == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Job not found"})
+		return
+	}
+	c.JSON(http.StatusOK, job)
+}
+
+// GetSnapshots returns the company's data snapshots, newest first
+// GET /api/migration/snapshots
+func (h *MigrationHandler) GetSnapshots(c *gin.Context) {
+	snapshots, err := h.dataService.ListSnapshots(c.GetString("company_id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load snapshots"})
+		return
+	}
+	c.JSON(http.StatusOK, snapshots)
 }
 
 // TestAlfaCRMConnection tests the connection to AlfaCRM API
@@ -603,3 +682,14 @@ func (h *MigrationHandler) updateProgressFromOutput(status *MigrationStatus, std
 		h.updateProgressFromLine(status, line)
 	}
 }
+
+// planLimitFailure returns the script's plan limit message from its stderr, or "" when the
+// migration failed for another reason
+func planLimitFailure(stderr string) string {
+	for _, line := range strings.Split(stderr, "\n") {
+		if i := strings.Index(line, "plan limit: "); i >= 0 {
+			return strings.TrimSpace(line[i:])
+		}
+	}
+	return ""
+}
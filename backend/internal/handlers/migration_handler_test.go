@@ -0,0 +1,177 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"classmate-central/internal/database"
+	"classmate-central/internal/middleware"
+	"classmate-central/internal/models"
+	"classmate-central/internal/money"
+	"classmate-central/internal/repository"
+	"classmate-central/internal/services"
+	"classmate-central/internal/testutil"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPlanLimitFailure(t *testing.T) {
+	stderr := "\n❌ ОШИБКА МИГРАЦИИ: plan limit: the migration would leave 60 students, the plan allows 50\nError: plan limit: the migration would leave 60 students, the plan allows 50\n    at checkPlanLimits"
+	assert.Equal(t, "plan limit: the migration would leave 60 students, the plan allows 50", planLimitFailure(stderr))
+	assert.Equal(t, "", planLimitFailure("Error: connect ECONNREFUSED"))
+}
+
+func TestCompanyDataJobsRequireConfirmation(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	h := NewMigrationHandler(nil, nil, nil, nil, nil, nil, nil, nil, nil)
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		c.Set("company_id", "company")
+		c.Next()
+	})
+	router.POST("/api/migration/clear-data", h.ClearCompanyData)
+	router.POST("/api/migration/snapshots/:id/restore", h.RestoreSnapshot)
+
+	for _, path := range []string{"/api/migration/clear-data", "/api/migration/snapshots/1/restore"} {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, path, strings.NewReader(`{}`)))
+		assert.Equal(t, http.StatusBadRequest, w.Code, path)
+		assert.Contains(t, w.Body.String(), "Type the company name to confirm", path)
+	}
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/migration/snapshots/latest/restore", strings.NewReader(`{"confirmation":"Acme"}`)))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+// setupCompanyDataRouter mounts the wipe, restore and snapshot routes on the tenant isolation router
+func setupCompanyDataRouter(t *testing.T) (*gin.Engine, *sql.DB) {
+	router, db := setupTenantIsolationRouter(t)
+
+	dataService := services.NewCompanyDataService(repository.NewCompanyDataRepository(db), repository.NewCompanyRepository(db))
+	h := NewMigrationHandler(nil, nil, nil, nil, nil, nil, nil, dataService, nil)
+	api := router.Group("/api")
+	api.Use(middleware.AuthMiddleware(db), middleware.CompanyMiddleware(db))
+	api.POST("/migration/clear-data", middleware.RequirePermission("migration", "manage"), h.ClearCompanyData)
+	api.GET("/migration/data-jobs/:id", middleware.RequirePermission("migration", "manage"), h.GetDataJob)
+	api.GET("/migration/snapshots", middleware.RequirePermission("migration", "manage"), h.GetSnapshots)
+	api.POST("/migration/snapshots/:id/restore", middleware.RequirePermission("migration", "manage"), h.RestoreSnapshot)
+	return router, db
+}
+
+// waitForDataJob polls a wipe or restore job until it finishes
+func waitForDataJob(t *testing.T, router *gin.Engine, token string, w *httptest.ResponseRecorder) models.CompanyDataJob {
+	t.Helper()
+	require.Equal(t, http.StatusAccepted, w.Code, w.Body.String())
+	var job models.CompanyDataJob
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &job))
+
+	deadline := time.Now().Add(30 * time.Second)
+	for job.Status != models.DataJobCompleted && job.Status != models.DataJobFailed {
+		require.True(t, time.Now().Before(deadline), "data job %d did not finish", job.ID)
+		time.Sleep(50 * time.Millisecond)
+		w = tenantRequest(router, token, "GET", fmt.Sprintf("/api/migration/data-jobs/%d", job.ID), nil)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &job))
+	}
+	require.Equal(t, models.DataJobCompleted, job.Status, job.Error)
+	return job
+}
+
+// companyDataTables are the wiped tables the round trip test fills
+var companyDataTables = []string{
+	"students", "student_notes", "leads", "lead_tasks", "teachers", "rooms", "groups", "lessons", "tariffs",
+	"subscription_types", "student_subscriptions", "payment_transactions", "debt_records", "invoice",
+}
+
+func companyDataCounts(t *testing.T, db *sql.DB, companyID string) map[string]int64 {
+	t.Helper()
+	counts := map[string]int64{}
+	for _, table := range companyDataTables {
+		var count int64
+		require.NoError(t, database.System(db).QueryRow(`SELECT COUNT(*) FROM `+table+` WHERE company_id = $1`, companyID).Scan(&count))
+		counts[table] = count
+	}
+	return counts
+}
+
+// TestCompanyData_SnapshotWipeRestoreRoundTrip wipes a company through the API, checks that the
+// snapshot holds every row and that restoring it brings back exactly the same row counts
+func TestCompanyData_SnapshotWipeRestoreRoundTrip(t *testing.T) {
+	router, db := setupCompanyDataRouter(t)
+	defer db.Close()
+	defer testutil.CleanupTestDB(t, db)
+
+	email := "owner-snapshot@example.com"
+	token := registerTenant(t, router, email)
+	companyID := companyOf(t, db, email)
+	branchID := companyID + "_default_branch"
+
+	studentID := createdID(t, tenantRequest(router, token, "POST", "/api/students", gin.H{"name": "Snapshot Student", "age": 12}))
+	createdID(t, tenantRequest(router, token, "POST", "/api/students/"+studentID+"/notes", gin.H{"note": "Prefers mornings"}))
+	leadID := createdID(t, tenantRequest(router, token, "POST", "/api/leads", gin.H{"name": "Snapshot Lead", "phone": "+77001234567", "source": "call"}))
+	createdID(t, tenantRequest(router, token, "POST", "/api/leads/"+leadID+"/tasks", gin.H{"title": "Call back"}))
+
+	price := money.MustParse("40000", money.DefaultCurrency)
+	require.NoError(t, repository.NewTeacherRepository(db).Create(&models.Teacher{ID: "snap-teacher", Name: "Snapshot Teacher", Subject: "Math", Email: "teacher-snap@example.com", Status: "active"}, companyID, branchID))
+	require.NoError(t, repository.NewRoomRepository(db).Create(&models.Room{ID: "snap-room", Name: "Room 1", Capacity: 10, Status: "active"}, companyID, branchID))
+	require.NoError(t, repository.NewGroupRepository(db).Create(&models.Group{ID: "snap-group", Name: "Math 1", Subject: "Math", TeacherID: "snap-teacher", RoomID: "snap-room", Status: "active"}, companyID, branchID))
+	start := time.Now().Add(24 * time.Hour).Truncate(time.Hour)
+	require.NoError(t, repository.NewLessonRepository(db).Create(&models.Lesson{ID: "snap-lesson", Title: "Math", TeacherID: "snap-teacher", GroupID: "snap-group", Subject: "Math", Start: start, End: start.Add(time.Hour), RoomID: "snap-room", Status: "scheduled"}, companyID, branchID))
+	require.NoError(t, repository.NewTariffRepository(db).Create(&models.Tariff{ID: "snap-tariff", Name: "Monthly", Price: price}, database.Actor{CompanyID: companyID}))
+	subscriptionRepo := repository.NewSubscriptionRepository(db)
+	require.NoError(t, subscriptionRepo.CreateType(&models.SubscriptionType{ID: "snap-type", Name: "Monthly", LessonsCount: 8, Price: price, BillingType: "per_lesson"}, companyID))
+	require.NoError(t, subscriptionRepo.CreateStudentSubscription(&models.StudentSubscription{ID: "snap-sub", StudentID: studentID, SubscriptionTypeID: "snap-type", TotalLessons: 8, TotalPrice: price, StartDate: time.Now(), Status: "active"}, companyID))
+	require.NoError(t, repository.NewPaymentRepository(db).CreateTransaction(&models.PaymentTransaction{StudentID: studentID, Amount: price, Type: "payment", PaymentMethod: "cash", Description: "Payment"}, companyID))
+	require.NoError(t, repository.NewDebtRepository(db).Create(&models.DebtRecord{StudentID: studentID, Amount: money.MustParse("3000", money.DefaultCurrency)}, companyID))
+	require.NoError(t, repository.NewInvoiceRepository(db).Create(&models.Invoice{StudentID: studentID, IssuedAt: time.Now(), Status: "unpaid"}, companyID))
+
+	before := companyDataCounts(t, db, companyID)
+	for table, count := range before {
+		require.NotZero(t, count, "the test must fill %s", table)
+	}
+	confirmation := gin.H{"confirmation": "Company " + email}
+
+	wipe := waitForDataJob(t, router, token, tenantRequest(router, token, "POST", "/api/migration/clear-data", confirmation))
+	require.NotNil(t, wipe.SnapshotID)
+	for table, count := range companyDataCounts(t, db, companyID) {
+		assert.Zero(t, count, "%s after the wipe", table)
+	}
+	w := tenantRequest(router, token, "GET", "/api/students/"+studentID, nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = tenantRequest(router, token, "GET", "/api/migration/snapshots", nil)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var snapshots []models.CompanySnapshot
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &snapshots))
+	require.Len(t, snapshots, 1)
+	assert.Equal(t, *wipe.SnapshotID, snapshots[0].ID)
+	assert.Equal(t, "before_wipe", snapshots[0].Reason)
+	for table, count := range before {
+		assert.Equal(t, count, snapshots[0].RowCounts[table], "%s in the snapshot", table)
+	}
+
+	restore := waitForDataJob(t, router, token, tenantRequest(router, token, "POST",
+		fmt.Sprintf("/api/migration/snapshots/%d/restore", *wipe.SnapshotID), confirmation))
+	var result map[string]map[string]int64
+	require.NoError(t, json.Unmarshal(restore.Result, &result))
+	for table, count := range before {
+		assert.Equal(t, count, result["restored"][table], "%s restored", table)
+	}
+	assert.Equal(t, before, companyDataCounts(t, db, companyID))
+
+	w = tenantRequest(router, token, "GET", "/api/students/"+studentID, nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "Snapshot Student")
+	w = tenantRequest(router, token, "GET", "/api/groups/snap-group", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "Snapshot Teacher")
+}
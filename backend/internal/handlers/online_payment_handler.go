@@ -0,0 +1,201 @@
+package handlers
+
+import (
+	"classmate-central/internal/gateway"
+	"classmate-central/internal/logger"
+	"classmate-central/internal/models"
+	"classmate-central/internal/repository"
+	"classmate-central/internal/services"
+	"classmate-central/internal/validation"
+	"database/sql"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// maxWebhookBody limits the size of provider notifications
+const maxWebhookBody = 1 << 20
+
+type OnlinePaymentHandler struct {
+	repo                 *repository.PaymentIntentRepository
+	onlinePaymentService *services.OnlinePaymentService
+}
+
+func NewOnlinePaymentHandler(repo *repository.PaymentIntentRepository, onlinePaymentService *services.OnlinePaymentService) *OnlinePaymentHandler {
+	return &OnlinePaymentHandler{
+		repo:                 repo,
+		onlinePaymentService: onlinePaymentService,
+	}
+}
+
+// CreateIntent creates a payment link for a student (optionally paying an invoice)
+func (h *OnlinePaymentHandler) CreateIntent(c *gin.Context) {
+	var req models.CreatePaymentIntentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": validation.FormatValidationErrors(err)})
+		return
+	}
+	if err := validation.ValidateAmount(req.Amount); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	intent, err := h.onlinePaymentService.CreateIntent(req, currentUserID(c), c.GetString("company_id"))
+	if err != nil {
+		switch {
+		case errors.Is(err, gateway.ErrUnknownProvider):
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Платежный провайдер не настроен"})
+		case errors.Is(err, services.ErrNothingToPay), errors.Is(err, services.ErrInvoiceNotPayable):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case errors.Is(err, services.ErrProviderFailed):
+			c.JSON(http.StatusBadGateway, gin.H{"error": "Платежный провайдер недоступен, попробуйте позже"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+	if intent == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Student or invoice not found"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, intent)
+}
+
+// GetIntents returns online payments (supports ?status=, ?studentId= and ?branchId=)
+func (h *OnlinePaymentHandler) GetIntents(c *gin.Context) {
+	branchIDs, ok := branchFilter(c)
+	if !ok {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Access denied to this branch"})
+		return
+	}
+
+	status := c.Query("status")
+	if status != "" {
+		if err := validation.ValidateOneOf(status, []string{"pending", "review", "succeeded", "failed", "cancelled", "refunded"}, "status"); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	intents, err := h.repo.List(status, c.Query("studentId"), c.GetString("company_id"), branchIDs)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, intents)
+}
+
+// GetIntent returns an online payment
+func (h *OnlinePaymentHandler) GetIntent(c *gin.Context) {
+	intent, err := h.repo.GetByID(c.Param("id"), c.GetString("company_id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if intent == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Not found"})
+		return
+	}
+	c.JSON(http.StatusOK, intent)
+}
+
+// CancelIntent cancels a payment link that was not paid yet
+func (h *OnlinePaymentHandler) CancelIntent(c *gin.Context) {
+	if err := h.repo.Cancel(c.Param("id"), c.GetString("company_id")); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Pending payment not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Payment cancelled"})
+}
+
+// AcceptIntent books an online payment held in review because the paid amount differs from the link
+func (h *OnlinePaymentHandler) AcceptIntent(c *gin.Context) {
+	intent, err := h.onlinePaymentService.AcceptReview(c.Param("id"), c.GetString("company_id"))
+	if err != nil {
+		if errors.Is(err, repository.ErrIntentNotInReview) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if intent == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Not found"})
+		return
+	}
+	c.JSON(http.StatusOK, intent)
+}
+
+// RefundIntent refunds a confirmed online payment, fully or partially
+func (h *OnlinePaymentHandler) RefundIntent(c *gin.Context) {
+	var req models.RefundPaymentIntentRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": validation.FormatValidationErrors(err)})
+			return
+		}
+	}
+	if err := validation.ValidateAmount(req.Amount); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	intent, err := h.onlinePaymentService.Refund(c.Param("id"), req.Amount, currentUserID(c), c.GetString("company_id"))
+	if err != nil {
+		switch {
+		case errors.Is(err, repository.ErrIntentNotConfirmed), errors.Is(err, repository.ErrRefundExceedsPayment), errors.Is(err, services.ErrNothingToPay):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		case errors.Is(err, gateway.ErrUnknownProvider):
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Платежный провайдер не настроен"})
+		case errors.Is(err, services.ErrProviderFailed):
+			c.JSON(http.StatusBadGateway, gin.H{"error": "Платежный провайдер отклонил возврат"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+	if intent == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Not found"})
+		return
+	}
+	c.JSON(http.StatusOK, intent)
+}
+
+// Webhook receives payment notifications from a provider (public, authenticated by signature)
+func (h *OnlinePaymentHandler) Webhook(c *gin.Context) {
+	body, err := io.ReadAll(io.LimitReader(c.Request.Body, maxWebhookBody))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid body"})
+		return
+	}
+
+	provider := c.Param("provider")
+	if err := h.onlinePaymentService.HandleWebhook(provider, c.Request.Header, body); err != nil {
+		switch {
+		case errors.Is(err, gateway.ErrUnknownProvider):
+			c.JSON(http.StatusNotFound, gin.H{"error": "Not found"})
+		case errors.Is(err, gateway.ErrInvalidSignature):
+			logger.Warn("Payment webhook with invalid signature", zap.String("provider", provider), zap.String("ip", c.ClientIP()))
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid signature"})
+		case errors.Is(err, repository.ErrProviderMismatch):
+			logger.Warn("Payment webhook for an intent of another provider", zap.String("provider", provider), zap.String("ip", c.ClientIP()))
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown payment"})
+		default:
+			// Non-2xx makes the provider redeliver the notification
+			logger.Error("Failed to process payment webhook", logger.ErrorField(err), zap.String("provider", provider))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process notification"})
+		}
+		return
+	}
+
+	// {"code": 0} is the acknowledgement CloudPayments-style providers expect
+	c.JSON(http.StatusOK, gin.H{"code": 0})
+}
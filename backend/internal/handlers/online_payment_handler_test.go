@@ -0,0 +1,156 @@
+package handlers
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"classmate-central/internal/gateway"
+	"classmate-central/internal/middleware"
+	"classmate-central/internal/models"
+	"classmate-central/internal/repository"
+	"classmate-central/internal/services"
+	"classmate-central/internal/testutil"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// setupOnlinePaymentRouter mounts the online payment routes with the fake provider
+func setupOnlinePaymentRouter(t *testing.T) (*gin.Engine, *sql.DB, *gateway.FakeProvider) {
+	router, db := setupTenantIsolationRouter(t)
+
+	fake := gateway.NewFakeProvider("test-secret")
+	intentRepo := repository.NewPaymentIntentRepository(db)
+	service := services.NewOnlinePaymentService(intentRepo, repository.NewInvoiceRepository(db), repository.NewStudentRepository(db), gateway.NewRegistry(fake))
+	handler := NewOnlinePaymentHandler(intentRepo, service)
+
+	router.POST("/api/webhooks/payments/:provider", handler.Webhook)
+	api := router.Group("/api")
+	api.Use(middleware.AuthMiddleware(db), middleware.CompanyMiddleware(db))
+	api.POST("/payments/online", middleware.RequirePermission("finance", "transactions"), handler.CreateIntent)
+	api.GET("/payments/online/:id", middleware.RequirePermission("finance", "view"), handler.GetIntent)
+	api.POST("/payments/online/:id/accept", middleware.RequirePermission("finance", "transactions"), handler.AcceptIntent)
+	api.POST("/payments/online/:id/refund", middleware.RequirePermission("finance", "transactions"), handler.RefundIntent)
+	return router, db, fake
+}
+
+// sendFakeWebhook completes the payment at the fake provider and posts its notification
+func sendFakeWebhook(t *testing.T, router *gin.Engine, fake *gateway.FakeProvider, reference string) *httptest.ResponseRecorder {
+	t.Helper()
+	header, body, err := fake.Complete(reference)
+	require.NoError(t, err)
+	req, _ := http.NewRequest("POST", "/api/webhooks/payments/fake", bytes.NewReader(body))
+	for name := range header {
+		req.Header.Set(name, header.Get(name))
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func getIntent(t *testing.T, router *gin.Engine, token, id string) models.PaymentIntent {
+	t.Helper()
+	w := tenantRequest(router, token, "GET", "/api/payments/online/"+id, nil)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var intent models.PaymentIntent
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &intent))
+	return intent
+}
+
+func TestOnlinePayment_AmountMismatchIsHeldForReview(t *testing.T) {
+	router, db, fake := setupOnlinePaymentRouter(t)
+	defer db.Close()
+	defer testutil.CleanupTestDB(t, db)
+
+	token := registerTenant(t, router, "owner-online@example.com")
+	studentID := createdID(t, tenantRequest(router, token, "POST", "/api/students", gin.H{"name": "Anna Petrova", "age": 12}))
+	intentID := createdID(t, tenantRequest(router, token, "POST", "/api/payments/online", gin.H{"studentId": studentID, "amount": "5000.00"}))
+
+	// The link asks for more than the provider will report as paid
+	_, err := db.Exec(`UPDATE payment_intents SET amount = 6000 WHERE id = $1`, intentID)
+	require.NoError(t, err)
+
+	w := sendFakeWebhook(t, router, fake, intentID)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	intent := getIntent(t, router, token, intentID)
+	assert.Equal(t, "review", intent.Status)
+	assert.Nil(t, intent.TransactionID)
+	require.NotNil(t, intent.PaidAmount)
+	assert.Equal(t, "5000.00", intent.PaidAmount.String())
+
+	var payments int
+	require.NoError(t, db.QueryRow(`SELECT COUNT(*) FROM payment_transactions WHERE student_id = $1`, studentID).Scan(&payments))
+	assert.Equal(t, 0, payments, "a held payment must not be credited")
+
+	w = tenantRequest(router, token, "POST", "/api/payments/online/"+intentID+"/accept", nil)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	intent = getIntent(t, router, token, intentID)
+	assert.Equal(t, "succeeded", intent.Status)
+	require.NotNil(t, intent.TransactionID)
+	assert.Equal(t, "5000.00", intent.Refundable().String())
+
+	w = tenantRequest(router, token, "POST", "/api/payments/online/"+intentID+"/accept", nil)
+	assert.Equal(t, http.StatusConflict, w.Code)
+}
+
+func TestOnlinePayment_WebhookOfAnotherProviderIsRejected(t *testing.T) {
+	router, db, fake := setupOnlinePaymentRouter(t)
+	defer db.Close()
+	defer testutil.CleanupTestDB(t, db)
+
+	token := registerTenant(t, router, "owner-provider@example.com")
+	studentID := createdID(t, tenantRequest(router, token, "POST", "/api/students", gin.H{"name": "Anna Petrova", "age": 12}))
+	intentID := createdID(t, tenantRequest(router, token, "POST", "/api/payments/online", gin.H{"studentId": studentID, "amount": "5000.00"}))
+
+	// The intent belongs to CloudPayments; the fake provider must not be able to confirm it
+	_, err := db.Exec(`UPDATE payment_intents SET provider = 'cloudpayments' WHERE id = $1`, intentID)
+	require.NoError(t, err)
+
+	w := sendFakeWebhook(t, router, fake, intentID)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	intent := getIntent(t, router, token, intentID)
+	assert.Equal(t, "pending", intent.Status)
+	assert.Nil(t, intent.TransactionID)
+}
+
+func TestOnlinePayment_RefundTakesTheAmountOffTheBalance(t *testing.T) {
+	router, db, fake := setupOnlinePaymentRouter(t)
+	defer db.Close()
+	defer testutil.CleanupTestDB(t, db)
+
+	token := registerTenant(t, router, "owner-refund@example.com")
+	studentID := createdID(t, tenantRequest(router, token, "POST", "/api/students", gin.H{"name": "Anna Petrova", "age": 12}))
+	intentID := createdID(t, tenantRequest(router, token, "POST", "/api/payments/online", gin.H{"studentId": studentID, "amount": "5000.00"}))
+
+	balance := func() string {
+		t.Helper()
+		var b string
+		require.NoError(t, db.QueryRow(`SELECT balance::text FROM student_balance WHERE student_id = $1`, studentID).Scan(&b))
+		return b
+	}
+
+	w := sendFakeWebhook(t, router, fake, intentID)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, "5000.00", balance())
+
+	w = tenantRequest(router, token, "POST", "/api/payments/online/"+intentID+"/refund", gin.H{"amount": "2000.00"})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, "3000.00", balance(), "a partial refund pays its amount back out of the balance")
+	assert.Equal(t, "succeeded", getIntent(t, router, token, intentID).Status)
+
+	// Without an amount the rest of the payment is refunded
+	w = tenantRequest(router, token, "POST", "/api/payments/online/"+intentID+"/refund", nil)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, "0.00", balance(), "a full refund leaves nothing of the payment on the balance")
+
+	intent := getIntent(t, router, token, intentID)
+	assert.Equal(t, "refunded", intent.Status)
+	assert.Equal(t, "0.00", intent.Refundable().String())
+}
@@ -2,6 +2,7 @@ package handlers
 
 import (
 	"classmate-central/internal/models"
+	"classmate-central/internal/money"
 	"classmate-central/internal/repository"
 	"classmate-central/internal/services"
 	"classmate-central/internal/validation"
@@ -50,6 +51,14 @@ func (h *PaymentHandler) CreateTransaction(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	if tx.Currency != "" {
+		cur, err := money.ParseCurrency(string(tx.Currency))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Неподдерживаемая валюта"})
+			return
+		}
+		tx.Currency = cur
+	}
 
 	// Get user ID from context (set by auth middleware)
 	if userID, exists := c.Get("user_id"); exists {
@@ -59,9 +68,18 @@ func (h *PaymentHandler) CreateTransaction(c *gin.Context) {
 	}
 
 	companyID := c.GetString("company_id")
+	tx.BranchID = c.GetString("branch_id")
 
 	// Use atomic transaction method to ensure data consistency
 	if err := h.repo.CreateTransactionWithBalance(&tx, companyID); err != nil {
+		if errors.Is(err, repository.ErrNoOpenShift) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Cash payments require an open cash shift for this branch"})
+			return
+		}
+		if errors.Is(err, repository.ErrCurrencyMismatch) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Валюта платежа не совпадает с валютой баланса студента или кассы"})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create transaction: " + err.Error()})
 		return
 	}
@@ -119,7 +137,11 @@ func (h *PaymentHandler) GetAllTransactions(c *gin.Context) {
 func (h *PaymentHandler) GetStudentBalance(c *gin.Context) {
 	studentID := c.Param("studentId")
 
-	balance, err := h.repo.GetStudentBalance(studentID)
+	balance, err := h.repo.GetStudentBalance(studentID, c.GetString("company_id"))
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Student not found"})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -174,13 +196,20 @@ func (h *PaymentHandler) UpdateTransaction(c *gin.Context) {
 		}
 	}
 
-	companyID := c.GetString("company_id")
-	updated, err := h.repo.UpdateTransactionWithBalance(txID, companyID, &input)
+	updated, err := h.repo.UpdateTransactionWithBalance(txID, &input, auditActor(c))
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			c.JSON(http.StatusNotFound, gin.H{"error": "transaction not found"})
 			return
 		}
+		if errors.Is(err, repository.ErrShiftClosed) {
+			c.JSON(http.StatusConflict, gin.H{"error": "transaction belongs to a closed cash shift"})
+			return
+		}
+		if errors.Is(err, repository.ErrReceiptRegistered) {
+			c.JSON(http.StatusConflict, gin.H{"error": "transaction has a registered fiscal receipt, record a refund instead"})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
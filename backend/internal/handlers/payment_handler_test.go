@@ -9,6 +9,7 @@ import (
 	"testing"
 
 	"classmate-central/internal/models"
+	"classmate-central/internal/money"
 	"classmate-central/internal/repository"
 	"classmate-central/internal/services"
 	"classmate-central/internal/testutil"
@@ -47,7 +48,7 @@ func TestPaymentHandler_CreateTransaction(t *testing.T) {
 	
 	reqBody := models.PaymentTransaction{
 		StudentID:     "test-student-id",
-		Amount:        5000.0,
+		Amount:        money.FromMajor(5000, money.KZT),
 		Type:          "payment",
 		PaymentMethod: "cash",
 		Description:   "Test payment",
@@ -62,7 +63,8 @@ func TestPaymentHandler_CreateTransaction(t *testing.T) {
 
 	// This will likely fail without proper setup, but tests the handler structure
 	// In real test, you'd need to create company, student, etc. first
-	assert.True(t, w.Code == http.StatusCreated || w.Code == http.StatusInternalServerError || w.Code == http.StatusBadRequest)
+	// Cash payments without an open cash shift are rejected with 409
+	assert.True(t, w.Code == http.StatusCreated || w.Code == http.StatusInternalServerError || w.Code == http.StatusBadRequest || w.Code == http.StatusConflict)
 }
 
 func TestPaymentHandler_GetAllTransactions(t *testing.T) {
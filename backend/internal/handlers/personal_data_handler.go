@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"net/http"
+
+	"classmate-central/internal/middleware"
+	"classmate-central/internal/models"
+	"classmate-central/internal/repository"
+	"classmate-central/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// personalDataResources maps each subject type to the resource whose view permission allows
+// the export and whose delete permission allows the erasure
+var personalDataResources = map[string]string{
+	models.SubjectStudent: "students",
+	models.SubjectLead:    "leads",
+}
+
+type PersonalDataHandler struct {
+	service *services.PersonalDataService
+}
+
+func NewPersonalDataHandler(service *services.PersonalDataService) *PersonalDataHandler {
+	return &PersonalDataHandler{service: service}
+}
+
+// ExportPersonalData downloads everything the company holds about a student or lead as JSON
+// GET /api/personal-data/:type/:id
+func (h *PersonalDataHandler) ExportPersonalData(c *gin.Context) {
+	subjectType, ok := h.authorize(c, "view")
+	if !ok {
+		return
+	}
+
+	export, err := h.service.Export(auditActor(c), subjectType, c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to export personal data"})
+		return
+	}
+	if export == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Subject not found"})
+		return
+	}
+
+	c.Header("Content-Disposition", `attachment; filename="personal_data_`+subjectType+`_`+export.SubjectID+`.json"`)
+	c.JSON(http.StatusOK, export)
+}
+
+// ErasePersonalData anonymizes a student or lead, keeping their financial records
+// POST /api/personal-data/:type/:id/erase
+func (h *PersonalDataHandler) ErasePersonalData(c *gin.Context) {
+	subjectType, ok := h.authorize(c, "delete")
+	if !ok {
+		return
+	}
+
+	erasure, err := h.service.Erase(auditActor(c), subjectType, c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to erase personal data"})
+		return
+	}
+	if erasure == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Subject not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, erasure)
+}
+
+// authorize checks the subject type and the user's permission on it, responding if either fails
+func (h *PersonalDataHandler) authorize(c *gin.Context, action string) (string, bool) {
+	subjectType := c.Param("type")
+	if !repository.IsPersonalDataSubject(subjectType) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown subject type"})
+		return "", false
+	}
+	if !middleware.HasPermission(c, personalDataResources[subjectType]+"."+action) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Insufficient permissions"})
+		return "", false
+	}
+	return subjectType, true
+}
@@ -0,0 +1,119 @@
+package handlers
+
+import (
+	"bytes"
+	"compress/gzip"
+	"database/sql"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"classmate-central/internal/database"
+	"classmate-central/internal/middleware"
+	"classmate-central/internal/repository"
+	"classmate-central/internal/services"
+	"classmate-central/internal/testutil"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPersonalDataChecksTypeAndPermission(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	h := NewPersonalDataHandler(nil)
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		c.Set("company_id", "company")
+		c.Set("permissions", []string{"students.view", "leads.view"})
+		c.Next()
+	})
+	router.GET("/api/personal-data/:type/:id", h.ExportPersonalData)
+	router.POST("/api/personal-data/:type/:id/erase", h.ErasePersonalData)
+
+	cases := []struct {
+		method, path string
+		status       int
+	}{
+		{http.MethodGet, "/api/personal-data/teacher/t1", http.StatusBadRequest},
+		{http.MethodPost, "/api/personal-data/teacher/t1/erase", http.StatusBadRequest},
+		{http.MethodPost, "/api/personal-data/student/s1/erase", http.StatusForbidden},
+		{http.MethodPost, "/api/personal-data/lead/l1/erase", http.StatusForbidden},
+	}
+	for _, tc := range cases {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(tc.method, tc.path, nil))
+		assert.Equal(t, tc.status, w.Code, tc.path)
+	}
+}
+
+// TestPersonalDataErasure_ScrubsSnapshots erases a student who is in an older snapshot and
+// checks that restoring that snapshot does not bring the personal data back
+func TestPersonalDataErasure_ScrubsSnapshots(t *testing.T) {
+	router, db := setupCompanyDataRouter(t)
+	defer db.Close()
+	defer testutil.CleanupTestDB(t, db)
+
+	h := NewPersonalDataHandler(services.NewPersonalDataService(repository.NewPersonalDataRepository(db)))
+	api := router.Group("/api")
+	api.Use(middleware.AuthMiddleware(db), middleware.CompanyMiddleware(db))
+	api.POST("/personal-data/:type/:id/erase", h.ErasePersonalData)
+
+	email := "owner-erasure@example.com"
+	token := registerTenant(t, router, email)
+	companyID := companyOf(t, db, email)
+	confirmation := gin.H{"confirmation": "Company " + email}
+
+	studentID := createdID(t, tenantRequest(router, token, "POST", "/api/students",
+		gin.H{"name": "Erased Student", "email": "erased@example.com", "phone": "+77001112233", "age": 12}))
+	createdID(t, tenantRequest(router, token, "POST", "/api/students/"+studentID+"/notes", gin.H{"note": "Private note"}))
+	keptID := createdID(t, tenantRequest(router, token, "POST", "/api/students", gin.H{"name": "Kept Student", "age": 13}))
+
+	// The wipe leaves a snapshot with the student; restoring it brings the student back
+	wipe := waitForDataJob(t, router, token, tenantRequest(router, token, "POST", "/api/migration/clear-data", confirmation))
+	require.NotNil(t, wipe.SnapshotID)
+	waitForDataJob(t, router, token, tenantRequest(router, token, "POST",
+		fmt.Sprintf("/api/migration/snapshots/%d/restore", *wipe.SnapshotID), confirmation))
+
+	w := tenantRequest(router, token, "POST", "/api/personal-data/student/"+studentID+"/erase", nil)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	waitForDataJob(t, router, token, tenantRequest(router, token, "POST",
+		fmt.Sprintf("/api/migration/snapshots/%d/restore", *wipe.SnapshotID), confirmation))
+
+	var name, studentEmail string
+	var phone sql.NullString
+	var anonymizedAt sql.NullTime
+	require.NoError(t, database.System(db).QueryRow(`SELECT name, email, phone, anonymized_at FROM students WHERE id = $1`, studentID).
+		Scan(&name, &studentEmail, &phone, &anonymizedAt))
+	assert.Equal(t, "Anonymized", name)
+	assert.Equal(t, "anonymized-"+studentID+"@invalid", studentEmail)
+	assert.False(t, phone.Valid)
+	assert.True(t, anonymizedAt.Valid)
+
+	var notes int
+	require.NoError(t, database.System(db).QueryRow(`SELECT COUNT(*) FROM student_notes WHERE student_id = $1`, studentID).Scan(&notes))
+	assert.Zero(t, notes)
+
+	w = tenantRequest(router, token, "GET", "/api/students/"+keptID, nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "Kept Student")
+
+	rows, err := database.System(db).Query(`SELECT data FROM company_snapshots WHERE company_id = $1`, companyID)
+	require.NoError(t, err)
+	defer rows.Close()
+	for rows.Next() {
+		var data []byte
+		require.NoError(t, rows.Scan(&data))
+		zr, err := gzip.NewReader(bytes.NewReader(data))
+		require.NoError(t, err)
+		raw, err := io.ReadAll(zr)
+		require.NoError(t, err)
+		assert.NotContains(t, string(raw), "Erased Student")
+		assert.NotContains(t, string(raw), "Private note")
+		assert.Contains(t, string(raw), "Kept Student")
+	}
+	require.NoError(t, rows.Err())
+}
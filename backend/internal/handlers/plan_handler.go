@@ -0,0 +1,155 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"classmate-central/internal/middleware"
+	"classmate-central/internal/models"
+	"classmate-central/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// defaultUsageDays is how much metered usage history a company usage request returns
+const defaultUsageDays = 30
+
+// planLimitReached answers 403 with the code plan_limit_reached when the company's plan does
+// not allow one more of a resource, or 500 if the limits cannot be checked. Returns true if
+// the request was answered.
+func planLimitReached(c *gin.Context, plans *services.PlanService, resource string) bool {
+	err := plans.CheckLimit(c.GetString("company_id"), resource)
+	var limitErr *services.PlanLimitError
+	switch {
+	case errors.As(err, &limitErr):
+		c.JSON(http.StatusForbidden, gin.H{
+			"error":    planLimitMessage(limitErr),
+			"code":     middleware.PlanLimitReached,
+			"resource": limitErr.Resource,
+			"limit":    limitErr.Limit,
+			"used":     limitErr.Used,
+		})
+		return true
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check plan limits"})
+		return true
+	}
+	return false
+}
+
+func planLimitMessage(err *services.PlanLimitError) string {
+	if err.Resource == models.PlanResourceStorage {
+		return fmt.Sprintf("Your plan includes %d MB of storage and it is used up. Upgrade the plan to add more data",
+			err.Limit/(1024*1024))
+	}
+	return fmt.Sprintf("Your plan allows at most %d %s. Upgrade the plan to add more", err.Limit, err.Resource)
+}
+
+// PlanHandler serves the platform endpoints for plans and company usage
+type PlanHandler struct {
+	service *services.PlanService
+}
+
+func NewPlanHandler(service *services.PlanService) *PlanHandler {
+	return &PlanHandler{service: service}
+}
+
+// GetPlans returns every plan with the number of companies on it
+// GET /api/platform/plans
+func (h *PlanHandler) GetPlans(c *gin.Context) {
+	plans, err := h.service.GetPlans()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, plans)
+}
+
+// UpdatePlan replaces the limits and features of a plan
+// PUT /api/platform/plans/:id
+func (h *PlanHandler) UpdatePlan(c *gin.Context) {
+	var req models.UpdatePlanRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	plan, err := h.service.UpdatePlan(c.Param("id"), req)
+	switch {
+	case errors.Is(err, services.ErrInvalidPlan):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update plan"})
+		return
+	}
+	if plan == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Plan not found"})
+		return
+	}
+	c.JSON(http.StatusOK, plan)
+}
+
+// GetCompaniesUsage returns every company with its plan and current usage
+// GET /api/platform/usage
+func (h *PlanHandler) GetCompaniesUsage(c *gin.Context) {
+	usage, err := h.service.GetCompaniesUsage()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, usage)
+}
+
+// GetCompanyUsage returns a company's plan, current usage and daily usage history
+// GET /api/platform/companies/:id/usage (supports ?days=, default 30)
+func (h *PlanHandler) GetCompanyUsage(c *gin.Context) {
+	days := defaultUsageDays
+	if value := c.Query("days"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 || parsed > 366 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "days must be between 1 and 366"})
+			return
+		}
+		days = parsed
+	}
+
+	usage, err := h.service.GetCompanyUsage(c.Param("id"), days)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if usage == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Company not found"})
+		return
+	}
+	c.JSON(http.StatusOK, usage)
+}
+
+// SetCompanyPlan moves a company to another plan; the change is recorded in the company's audit log
+// PUT /api/platform/companies/:id/plan
+func (h *PlanHandler) SetCompanyPlan(c *gin.Context) {
+	var req models.SetCompanyPlanRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	err := h.service.SetCompanyPlan(platformActor(c), req.PlanID)
+	switch {
+	case errors.Is(err, services.ErrPlanNotFound):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, sql.ErrNoRows):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Company not found"})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to change company plan"})
+		return
+	}
+
+	h.GetCompanyUsage(c)
+}
@@ -0,0 +1,41 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"classmate-central/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPlanEndpointsRejectBadRequests(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	h := NewPlanHandler(services.NewPlanService(nil, nil))
+	router := gin.New()
+	router.PUT("/api/platform/plans/:id", h.UpdatePlan)
+	router.GET("/api/platform/companies/:id/usage", h.GetCompanyUsage)
+	router.PUT("/api/platform/companies/:id/plan", h.SetCompanyPlan)
+
+	cases := []struct {
+		method, path, body string
+		status             int
+	}{
+		{http.MethodPut, "/api/platform/plans/free", `{"maxStudents": 10}`, http.StatusBadRequest},
+		{http.MethodPut, "/api/platform/plans/free", `{"name": "Free", "maxStudents": -1}`, http.StatusBadRequest},
+		{http.MethodPut, "/api/platform/plans/free", `{"name": "Free", "features": ["api"]}`, http.StatusBadRequest},
+		{http.MethodGet, "/api/platform/companies/c1/usage?days=0", ``, http.StatusBadRequest},
+		{http.MethodGet, "/api/platform/companies/c1/usage?days=week", ``, http.StatusBadRequest},
+		{http.MethodPut, "/api/platform/companies/c1/plan", `{}`, http.StatusBadRequest},
+	}
+	for _, tc := range cases {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(tc.method, tc.path, strings.NewReader(tc.body))
+		req.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(w, req)
+		assert.Equal(t, tc.status, w.Code, tc.path+" "+tc.body)
+	}
+}
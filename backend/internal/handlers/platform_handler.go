@@ -0,0 +1,178 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"classmate-central/internal/database"
+	"classmate-central/internal/models"
+	"classmate-central/internal/repository"
+	"classmate-central/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+const maxPlatformPageSize = 200
+
+// PlatformHandler serves the platform console endpoints, which work across companies
+type PlatformHandler struct {
+	service *services.PlatformService
+}
+
+func NewPlatformHandler(service *services.PlatformService) *PlatformHandler {
+	return &PlatformHandler{service: service}
+}
+
+// platformActor is the audit actor for a platform admin acting on the company in :id. The entry
+// goes to that company's audit log with the admin as its user.
+func platformActor(c *gin.Context) database.Actor {
+	actor := auditActor(c)
+	actor.CompanyID = c.Param("id")
+	return actor
+}
+
+// GetCompanies returns one page of the companies matching the search, newest first
+// GET /api/platform/companies?search=&status=&planId=&limit=&offset=
+func (h *PlatformHandler) GetCompanies(c *gin.Context) {
+	filter := models.PlatformCompanyFilter{
+		Search: c.Query("search"),
+		Status: c.Query("status"),
+		PlanID: c.Query("planId"),
+		Limit:  50,
+	}
+	switch filter.Status {
+	case "", models.CompanyStatusActive, models.CompanyStatusSuspended, "inactive":
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "status must be active, suspended or inactive"})
+		return
+	}
+	if limitParam := c.Query("limit"); limitParam != "" {
+		if val, err := strconv.Atoi(limitParam); err == nil && val > 0 {
+			filter.Limit = val
+		}
+	}
+	if filter.Limit > maxPlatformPageSize {
+		filter.Limit = maxPlatformPageSize
+	}
+	if offsetParam := c.Query("offset"); offsetParam != "" {
+		if val, err := strconv.Atoi(offsetParam); err == nil && val >= 0 {
+			filter.Offset = val
+		}
+	}
+
+	list, err := h.service.SearchCompanies(filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load companies"})
+		return
+	}
+	c.JSON(http.StatusOK, list)
+}
+
+// GetCompany returns a company with its plan, usage, figures and users
+// GET /api/platform/companies/:id
+func (h *PlatformHandler) GetCompany(c *gin.Context) {
+	company, err := h.service.GetCompany(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load company"})
+		return
+	}
+	if company == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Company not found"})
+		return
+	}
+	c.JSON(http.StatusOK, company)
+}
+
+// SuspendCompany makes a company read-only; the reason is shown to platform admins and kept in
+// the company's audit log
+// POST /api/platform/companies/:id/suspend
+func (h *PlatformHandler) SuspendCompany(c *gin.Context) {
+	var req models.SuspendCompanyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !companyStatusChanged(c, h.service.SuspendCompany(platformActor(c), req.Reason)) {
+		return
+	}
+	h.GetCompany(c)
+}
+
+// ReactivateCompany makes a suspended or deleted company active again
+// POST /api/platform/companies/:id/reactivate
+func (h *PlatformHandler) ReactivateCompany(c *gin.Context) {
+	if !companyStatusChanged(c, h.service.ReactivateCompany(platformActor(c))) {
+		return
+	}
+	h.GetCompany(c)
+}
+
+// companyStatusChanged answers the errors of a suspend or reactivate and reports whether it succeeded
+func companyStatusChanged(c *gin.Context, err error) bool {
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Company not found"})
+		return false
+	case errors.Is(err, repository.ErrCompanyStatusUnchanged):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return false
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to change company status"})
+		return false
+	}
+	return true
+}
+
+// Impersonate signs the platform admin in as a user of the company for support. The access
+// token cannot be refreshed and expires with the session (PLATFORM_IMPERSONATION_TTL).
+// POST /api/platform/companies/:id/impersonate
+func (h *PlatformHandler) Impersonate(c *gin.Context) {
+	var req models.ImpersonateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	result, err := h.service.Impersonate(platformActor(c), req.UserID, req.Reason, c.Request.UserAgent())
+	switch {
+	case errors.Is(err, services.ErrImpersonationNotAllowed):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start impersonation"})
+		return
+	}
+	if result == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found in this company"})
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+// GetMaintenanceJobs returns the names of the jobs that can be run for one company
+// GET /api/platform/jobs
+func (h *PlatformHandler) GetMaintenanceJobs(c *gin.Context) {
+	c.JSON(http.StatusOK, services.MaintenanceJobs)
+}
+
+// RunMaintenanceJob runs a scheduled job for one company now and returns what it did
+// POST /api/platform/companies/:id/jobs/:job
+func (h *PlatformHandler) RunMaintenanceJob(c *gin.Context) {
+	run, err := h.service.RunMaintenanceJob(platformActor(c), c.Param("job"))
+	switch {
+	case errors.Is(err, services.ErrUnknownMaintenanceJob):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "jobs": services.MaintenanceJobs})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Maintenance job failed"})
+		return
+	}
+	if run == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Company not found"})
+		return
+	}
+	c.JSON(http.StatusOK, run)
+}
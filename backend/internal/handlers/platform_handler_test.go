@@ -0,0 +1,263 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"classmate-central/internal/database"
+	"classmate-central/internal/middleware"
+	"classmate-central/internal/models"
+	"classmate-central/internal/repository"
+	"classmate-central/internal/services"
+	"classmate-central/internal/testutil"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPlatformEndpointsRejectBadRequests(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	h := NewPlatformHandler(services.NewPlatformService(nil, nil, nil, nil, nil, nil))
+	router := gin.New()
+	router.GET("/api/platform/companies", h.GetCompanies)
+	router.POST("/api/platform/companies/:id/suspend", h.SuspendCompany)
+	router.POST("/api/platform/companies/:id/impersonate", h.Impersonate)
+	router.POST("/api/platform/companies/:id/jobs/:job", h.RunMaintenanceJob)
+
+	cases := []struct {
+		method, path, body string
+		status             int
+	}{
+		{http.MethodGet, "/api/platform/companies?status=deleted", ``, http.StatusBadRequest},
+		{http.MethodPost, "/api/platform/companies/c1/suspend", `{}`, http.StatusBadRequest},
+		{http.MethodPost, "/api/platform/companies/c1/impersonate", `{"reason": "ticket 42"}`, http.StatusBadRequest},
+		{http.MethodPost, "/api/platform/companies/c1/impersonate", `{"userId": 5}`, http.StatusBadRequest},
+		{http.MethodPost, "/api/platform/companies/c1/jobs/drop_everything", ``, http.StatusBadRequest},
+	}
+	for _, tc := range cases {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(tc.method, tc.path, strings.NewReader(tc.body))
+		req.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(w, req)
+		assert.Equal(t, tc.status, w.Code, tc.path+" "+tc.body)
+	}
+}
+
+// setupPlatformRouter mounts the platform console behind the same middleware chain as main.go,
+// next to the sign-in routes an impersonation session may or may not use
+func setupPlatformRouter(t *testing.T) (*gin.Engine, *sql.DB) {
+	router, db := setupTenantIsolationRouter(t)
+
+	companyRepo := repository.NewCompanyRepository(db)
+	planService := services.NewPlanService(repository.NewPlanRepository(db), companyRepo)
+	trashService := services.NewTrashService(repository.NewTrashRepository(db))
+	companyDataService := services.NewCompanyDataService(repository.NewCompanyDataRepository(db), companyRepo)
+	debtService := services.NewDebtService(repository.NewDebtRepository(db), repository.NewBranchRepository(db), services.NewCurrencyService(repository.NewCurrencyRepository(db)))
+	platformHandler := NewPlatformHandler(services.NewPlatformService(repository.NewPlatformRepository(db), planService,
+		services.NewSessionService(repository.NewSessionRepository(db)), trashService, companyDataService, debtService))
+	authHandler := newTestAuthHandler(db)
+
+	api := router.Group("/api")
+	api.Use(middleware.AuthMiddleware(db), middleware.CompanyMiddleware(db))
+	stepUp := middleware.RequireTwoFactorStepUp()
+	api.GET("/auth/me", authHandler.Me)
+	api.POST("/auth/password/change", authHandler.ChangePassword)
+	api.DELETE("/auth/sessions", authHandler.RevokeOtherSessions)
+	platform := api.Group("/platform", middleware.RequirePlatformAdmin())
+	platform.GET("/companies", platformHandler.GetCompanies)
+	platform.GET("/companies/:id", platformHandler.GetCompany)
+	platform.POST("/companies/:id/suspend", stepUp, platformHandler.SuspendCompany)
+	platform.POST("/companies/:id/reactivate", stepUp, platformHandler.ReactivateCompany)
+	platform.POST("/companies/:id/impersonate", stepUp, platformHandler.Impersonate)
+	platform.POST("/companies/:id/jobs/:job", stepUp, platformHandler.RunMaintenanceJob)
+	return router, db
+}
+
+// makePlatformAdmin flags a user as a platform admin with 2FA enabled and confirmed in the
+// user's sessions, so the console's step-up passes, and returns the user's ID
+func makePlatformAdmin(t *testing.T, db *sql.DB, email string) int {
+	t.Helper()
+	var userID int
+	require.NoError(t, database.System(db).QueryRow(`UPDATE users SET is_platform_admin = true WHERE email = $1 RETURNING id`, email).Scan(&userID))
+	_, err := database.System(db).Exec(`INSERT INTO user_two_factor (user_id, secret_encrypted, enabled_at) VALUES ($1, 'test', CURRENT_TIMESTAMP)`, userID)
+	require.NoError(t, err)
+	_, err = database.System(db).Exec(`UPDATE user_sessions SET two_factor_verified_at = CURRENT_TIMESTAMP WHERE user_id = $1`, userID)
+	require.NoError(t, err)
+	return userID
+}
+
+// auditActions returns the actions of a company's audit log entries made by a user, oldest first
+func auditActions(t *testing.T, db *sql.DB, companyID string, userID int) []string {
+	t.Helper()
+	rows, err := database.System(db).Query(`SELECT action FROM audit_log WHERE company_id = $1 AND user_id = $2 ORDER BY id`, companyID, userID)
+	require.NoError(t, err)
+	defer rows.Close()
+	actions := []string{}
+	for rows.Next() {
+		var action string
+		require.NoError(t, rows.Scan(&action))
+		actions = append(actions, action)
+	}
+	require.NoError(t, rows.Err())
+	return actions
+}
+
+// TestPlatformConsole_RequiresPlatformAdmin checks that company roles do not open the console,
+// that the flag in the database does, and that actions on a company also need a 2FA step-up
+func TestPlatformConsole_RequiresPlatformAdmin(t *testing.T) {
+	router, db := setupPlatformRouter(t)
+	defer db.Close()
+	defer testutil.CleanupTestDB(t, db)
+
+	ownerToken := registerTenant(t, router, "owner-console@example.com")
+	adminToken := registerTenant(t, router, "admin-console@example.com")
+	companyID := companyOf(t, db, "owner-console@example.com")
+
+	// Owning a company does not make a platform admin
+	w := tenantRequest(router, ownerToken, "GET", "/api/platform/companies", nil)
+	require.Equal(t, http.StatusForbidden, w.Code, w.Body.String())
+	assert.Contains(t, w.Body.String(), middleware.PlatformAdminRequired)
+
+	// The flag alone opens the console but not actions on a company
+	_, err := database.System(db).Exec(`UPDATE users SET is_platform_admin = true WHERE email = 'admin-console@example.com'`)
+	require.NoError(t, err)
+	w = tenantRequest(router, adminToken, "GET", "/api/platform/companies?search="+companyID, nil)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var list models.PlatformCompanyList
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &list))
+	require.Len(t, list.Companies, 1)
+	assert.Equal(t, companyID, list.Companies[0].ID)
+
+	w = tenantRequest(router, adminToken, "POST", "/api/platform/companies/"+companyID+"/suspend", gin.H{"reason": "unpaid"})
+	require.Equal(t, http.StatusForbidden, w.Code, w.Body.String())
+	assert.Contains(t, w.Body.String(), middleware.TwoFactorSetupRequired)
+
+	// Taking the flag away closes the console for the open session
+	_, err = database.System(db).Exec(`UPDATE users SET is_platform_admin = false WHERE email = 'admin-console@example.com'`)
+	require.NoError(t, err)
+	w = tenantRequest(router, adminToken, "GET", "/api/platform/companies", nil)
+	assert.Equal(t, http.StatusForbidden, w.Code, w.Body.String())
+}
+
+// TestPlatformConsole_SuspensionMakesCompanyReadOnly suspends a company and checks that its users
+// can still read and sign in but not change data, until the company is reactivated, and that
+// both actions are in the company's audit log
+func TestPlatformConsole_SuspensionMakesCompanyReadOnly(t *testing.T) {
+	router, db := setupPlatformRouter(t)
+	defer db.Close()
+	defer testutil.CleanupTestDB(t, db)
+
+	ownerToken := registerTenant(t, router, "owner-suspended@example.com")
+	adminToken := registerTenant(t, router, "admin-suspend@example.com")
+	adminID := makePlatformAdmin(t, db, "admin-suspend@example.com")
+	companyID := companyOf(t, db, "owner-suspended@example.com")
+	studentID := createdID(t, tenantRequest(router, ownerToken, "POST", "/api/students", gin.H{"name": "Before Suspension", "age": 12}))
+
+	w := tenantRequest(router, adminToken, "POST", "/api/platform/companies/"+companyID+"/suspend", gin.H{"reason": "unpaid invoice"})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var details models.PlatformCompanyDetails
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &details))
+	assert.Equal(t, models.CompanyStatusSuspended, details.Status)
+	w = tenantRequest(router, adminToken, "POST", "/api/platform/companies/"+companyID+"/suspend", gin.H{"reason": "again"})
+	assert.Equal(t, http.StatusConflict, w.Code, w.Body.String())
+
+	// The owner's open session sees the suspension on the next request
+	w = tenantRequest(router, ownerToken, "POST", "/api/students", gin.H{"name": "During Suspension", "age": 12})
+	require.Equal(t, http.StatusForbidden, w.Code, w.Body.String())
+	assert.Contains(t, w.Body.String(), middleware.CompanyReadOnly)
+	w = tenantRequest(router, ownerToken, "PUT", "/api/students/"+studentID, gin.H{"name": "Renamed", "age": 12})
+	assert.Equal(t, http.StatusForbidden, w.Code, w.Body.String())
+	w = tenantRequest(router, ownerToken, "DELETE", "/api/students/"+studentID, nil)
+	assert.Equal(t, http.StatusForbidden, w.Code, w.Body.String())
+
+	w = tenantRequest(router, ownerToken, "GET", "/api/students/"+studentID, nil)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Contains(t, w.Body.String(), "Before Suspension")
+	w = tenantRequest(router, ownerToken, "GET", "/api/auth/me", nil)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Contains(t, w.Body.String(), `"companyStatus":"suspended"`)
+
+	var students int
+	require.NoError(t, database.System(db).QueryRow(`SELECT COUNT(*) FROM students WHERE company_id = $1`, companyID).Scan(&students))
+	assert.Equal(t, 1, students)
+
+	w = tenantRequest(router, adminToken, "POST", "/api/platform/companies/"+companyID+"/reactivate", nil)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	createdID(t, tenantRequest(router, ownerToken, "POST", "/api/students", gin.H{"name": "After Suspension", "age": 12}))
+
+	assert.Equal(t, []string{"suspend_company", "reactivate_company"}, auditActions(t, db, companyID, adminID))
+}
+
+// TestPlatformConsole_ImpersonationIsTimeLimitedAndAudited signs a platform admin in as a company
+// owner and checks that the session acts as the owner, cannot change how the owner signs in or
+// use the console, is in the company's audit log, and stops working when it expires
+func TestPlatformConsole_ImpersonationIsTimeLimitedAndAudited(t *testing.T) {
+	t.Setenv("PLATFORM_IMPERSONATION_TTL", "15m")
+	router, db := setupPlatformRouter(t)
+	defer db.Close()
+	defer testutil.CleanupTestDB(t, db)
+
+	ownerToken := registerTenant(t, router, "owner-impersonated@example.com")
+	adminToken := registerTenant(t, router, "admin-impersonate@example.com")
+	adminID := makePlatformAdmin(t, db, "admin-impersonate@example.com")
+	companyID := companyOf(t, db, "owner-impersonated@example.com")
+	studentID := createdID(t, tenantRequest(router, ownerToken, "POST", "/api/students", gin.H{"name": "Support Case", "age": 12}))
+	var ownerID int
+	require.NoError(t, database.System(db).QueryRow(`SELECT id FROM users WHERE email = 'owner-impersonated@example.com'`).Scan(&ownerID))
+
+	// Platform admins cannot be impersonated, and only users of the company in the path can be
+	w := tenantRequest(router, adminToken, "POST", "/api/platform/companies/"+companyOf(t, db, "admin-impersonate@example.com")+"/impersonate",
+		gin.H{"userId": adminID, "reason": "ticket 7"})
+	assert.Equal(t, http.StatusForbidden, w.Code, w.Body.String())
+	w = tenantRequest(router, adminToken, "POST", "/api/platform/companies/"+companyID+"/impersonate", gin.H{"userId": adminID, "reason": "ticket 7"})
+	assert.Equal(t, http.StatusNotFound, w.Code, w.Body.String())
+
+	before := time.Now()
+	w = tenantRequest(router, adminToken, "POST", "/api/platform/companies/"+companyID+"/impersonate", gin.H{"userId": ownerID, "reason": "ticket 7"})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var session models.ImpersonationResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &session))
+	assert.WithinDuration(t, before.Add(15*time.Minute), session.ExpiresAt, time.Minute)
+	assert.NotContains(t, w.Body.String(), "refreshToken")
+
+	var reason string
+	require.NoError(t, database.System(db).QueryRow(`
+		SELECT changes->>'reason' FROM audit_log
+		WHERE company_id = $1 AND user_id = $2 AND action = 'impersonate_user' AND entity_id = $3`,
+		companyID, adminID, strconv.Itoa(ownerID)).Scan(&reason))
+	assert.Equal(t, "ticket 7", reason)
+
+	// The session acts as the owner
+	w = tenantRequest(router, session.AccessToken, "GET", "/api/students/"+studentID, nil)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	createdID(t, tenantRequest(router, session.AccessToken, "POST", "/api/students", gin.H{"name": "Added By Support", "age": 12}))
+
+	// but cannot take over the owner's sign-in, nor use the console as the admin
+	for _, tc := range []struct{ method, path string }{
+		{"POST", "/api/auth/password/change"},
+		{"DELETE", "/api/auth/sessions"},
+	} {
+		w = tenantRequest(router, session.AccessToken, tc.method, tc.path, gin.H{"currentPassword": "password123", "newPassword": "password456"})
+		require.Equal(t, http.StatusForbidden, w.Code, tc.path+": "+w.Body.String())
+		assert.Contains(t, w.Body.String(), middleware.ImpersonationRestricted, tc.path)
+	}
+	w = tenantRequest(router, session.AccessToken, "GET", "/api/platform/companies", nil)
+	assert.Equal(t, http.StatusForbidden, w.Code, w.Body.String())
+
+	// An expired impersonation session is rejected even while its token is still valid
+	_, err := database.System(db).Exec(`UPDATE user_sessions SET expires_at = CURRENT_TIMESTAMP - INTERVAL '1 second' WHERE id = $1`, session.SessionID)
+	require.NoError(t, err)
+	w = tenantRequest(router, session.AccessToken, "GET", "/api/students/"+studentID, nil)
+	assert.Equal(t, http.StatusUnauthorized, w.Code, w.Body.String())
+
+	// The owner's own session may still change the password
+	w = tenantRequest(router, ownerToken, "POST", "/api/auth/password/change", gin.H{"currentPassword": "password123", "newPassword": "password456"})
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+}
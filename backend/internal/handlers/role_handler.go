@@ -74,6 +74,9 @@ func (h *RoleHandler) Create(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	if !validScopes(c, req.PermissionScopes) {
+		return
+	}
 
 	// Create role
 	role := &models.Role{
@@ -82,18 +85,24 @@ func (h *RoleHandler) Create(c *gin.Context) {
 		CompanyID:   companyID.(string),
 	}
 
-	if err := h.roleRepo.Create(role); err != nil {
+	if err := h.roleRepo.Create(role, auditActor(c)); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error creating role: " + err.Error()})
 		return
 	}
 
 	// Assign permissions if provided
 	if len(req.PermissionIDs) > 0 {
-		if err := h.roleRepo.SetRolePermissions(role.ID, req.PermissionIDs); err != nil {
+		if err := h.roleRepo.SetRolePermissions(role.ID, req.PermissionIDs, auditActor(c)); err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error assigning permissions: " + err.Error()})
 			return
 		}
 	}
+	if len(req.PermissionScopes) > 0 {
+		if err := h.roleRepo.SetPermissionScopes(role.ID, req.PermissionScopes, auditActor(c)); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error setting permission scopes: " + err.Error()})
+			return
+		}
+	}
 
 	// Reload role with permissions
 	role, err := h.roleRepo.GetByID(role.ID, companyID.(string))
@@ -119,6 +128,9 @@ func (h *RoleHandler) Update(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	if !validScopes(c, req.PermissionScopes) {
+		return
+	}
 
 	// Get existing role
 	role, err := h.roleRepo.GetByID(roleID, companyID.(string))
@@ -139,18 +151,24 @@ func (h *RoleHandler) Update(c *gin.Context) {
 		role.Description = req.Description
 	}
 
-	if err := h.roleRepo.Update(role); err != nil {
+	if err := h.roleRepo.Update(role, auditActor(c)); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating role: " + err.Error()})
 		return
 	}
 
 	// Update permissions if provided
 	if req.PermissionIDs != nil {
-		if err := h.roleRepo.SetRolePermissions(roleID, req.PermissionIDs); err != nil {
+		if err := h.roleRepo.SetRolePermissions(roleID, req.PermissionIDs, auditActor(c)); err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating permissions: " + err.Error()})
 			return
 		}
 	}
+	if len(req.PermissionScopes) > 0 {
+		if err := h.roleRepo.SetPermissionScopes(roleID, req.PermissionScopes, auditActor(c)); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating permission scopes: " + err.Error()})
+			return
+		}
+	}
 
 	// Reload role with permissions
 	role, err = h.roleRepo.GetByID(roleID, companyID.(string))
@@ -165,7 +183,7 @@ func (h *RoleHandler) Update(c *gin.Context) {
 // Delete deletes a role
 func (h *RoleHandler) Delete(c *gin.Context) {
 	roleID := c.Param("id")
-	companyID, exists := c.Get("company_id")
+	_, exists := c.Get("company_id")
 	if !exists {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Company context required"})
 		return
@@ -179,7 +197,7 @@ func (h *RoleHandler) Delete(c *gin.Context) {
 		return
 	}
 
-	if err := h.roleRepo.Delete(roleID, companyID.(string)); err != nil {
+	if err := h.roleRepo.Delete(roleID, auditActor(c)); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error deleting role: " + err.Error()})
 		return
 	}
@@ -191,7 +209,7 @@ func (h *RoleHandler) Delete(c *gin.Context) {
 func (h *RoleHandler) GetRolePermissions(c *gin.Context) {
 	roleID := c.Param("id")
 
-	permissions, err := h.roleRepo.GetRolePermissions(roleID)
+	permissions, err := h.roleRepo.GetRolePermissions(roleID, c.GetString("company_id"))
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error getting role permissions"})
 		return
@@ -211,3 +229,14 @@ func (h *RoleHandler) GetAllPermissions(c *gin.Context) {
 	c.JSON(http.StatusOK, permissions)
 }
 
+
+// validScopes checks requested permission scopes, answering 400 for unknown ones
+func validScopes(c *gin.Context, scopes map[string]string) bool {
+	for permID, scope := range scopes {
+		if !models.ValidScope(scope) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid scope for " + permID + ": must be all, branch or own"})
+			return false
+		}
+	}
+	return true
+}
@@ -66,7 +66,7 @@ func (h *SettingsHandler) Update(c *gin.Context) {
 	// ID will be set by the repository during update
 	settings.BranchID = branchID
 
-	if err := h.repo.Update(&settings, companyID, branchID); err != nil {
+	if err := h.repo.Update(&settings, branchID, auditActor(c)); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -1,6 +1,8 @@
 package handlers
 
 import (
+	"database/sql"
+	"errors"
 	"net/http"
 	"strconv"
 
@@ -17,6 +19,7 @@ type StudentHandler struct {
 	activityRepo     *repository.ActivityRepository
 	notificationRepo *repository.NotificationRepository
 	activityService  *services.ActivityService
+	planService      *services.PlanService
 }
 
 func NewStudentHandler(
@@ -24,24 +27,24 @@ func NewStudentHandler(
 	activityRepo *repository.ActivityRepository,
 	notificationRepo *repository.NotificationRepository,
 	activityService *services.ActivityService,
+	planService *services.PlanService,
 ) *StudentHandler {
 	return &StudentHandler{
 		repo:             repo,
 		activityRepo:     activityRepo,
 		notificationRepo: notificationRepo,
 		activityService:  activityService,
+		planService:      planService,
 	}
 }
 
 func (h *StudentHandler) GetAll(c *gin.Context) {
 	companyID := c.GetString("company_id")
-	branchID := c.GetString("branch_id")
 
-	// Используем выбранный филиал для изоляции данных
-	// Если branchID не установлен, используем company_id как fallback
-	if branchID == "" {
-		branchID = companyID
-	}
+	// Данные ограничены областью видимости students.view:
+	// все доступные филиалы, текущий филиал или только ученики преподавателя
+	branchIDs := scopeBranches(c, "students.view")
+	teacherID, own := ownTeacherScope(c, "students.view")
 
 	// Optional server-side search and pagination
 	query := c.Query("query")
@@ -61,7 +64,11 @@ func (h *StudentHandler) GetAll(c *gin.Context) {
 	// Always compute global counts (not filtered by search)
 	var activeCnt, inactiveCnt, totalCnt int
 	var cntErr error
-	activeCnt, inactiveCnt, totalCnt, cntErr = h.repo.GetCounts(companyID, branchID)
+	if own {
+		activeCnt, inactiveCnt, totalCnt, cntErr = h.repo.GetCountsForTeacher(companyID, branchIDs, teacherID)
+	} else {
+		activeCnt, inactiveCnt, totalCnt, cntErr = h.repo.GetCountsByBranches(companyID, branchIDs)
+	}
 	if cntErr != nil {
 		// Not fatal for listing; log-like response inline
 		activeCnt, inactiveCnt, totalCnt = 0, 0, 0
@@ -71,7 +78,11 @@ func (h *StudentHandler) GetAll(c *gin.Context) {
 		var items []*models.Student
 		var total int
 		var err error
-		items, total, err = h.repo.GetPaged(companyID, branchID, query, page, pageSize)
+		if own {
+			items, total, err = h.repo.GetPagedForTeacher(companyID, branchIDs, teacherID, query, page, pageSize)
+		} else {
+			items, total, err = h.repo.GetPagedByBranches(companyID, branchIDs, query, page, pageSize)
+		}
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
@@ -90,10 +101,13 @@ func (h *StudentHandler) GetAll(c *gin.Context) {
 		return
 	}
 
-	// Use selected branch for data isolation
 	var students []*models.Student
 	var err error
-	students, err = h.repo.GetAll(companyID, branchID)
+	if own {
+		students, err = h.repo.GetAllForTeacher(companyID, branchIDs, teacherID)
+	} else {
+		students, err = h.repo.GetAllByBranches(companyID, branchIDs)
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -116,6 +130,10 @@ func (h *StudentHandler) GetByID(c *gin.Context) {
 	id := c.Param("id")
 	companyID := c.GetString("company_id")
 
+	if !studentInScope(c, h.repo, "students.view", id) {
+		return
+	}
+
 	student, err := h.repo.GetByID(id, companyID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
@@ -158,6 +176,10 @@ func (h *StudentHandler) Create(c *gin.Context) {
 		}
 	}
 
+	if planLimitReached(c, h.planService, models.PlanResourceStudents) {
+		return
+	}
+
 	companyID := c.GetString("company_id")
 	branchID := c.GetString("branch_id")
 	if err := h.repo.Create(&student, companyID, branchID); err != nil {
@@ -216,9 +238,8 @@ func (h *StudentHandler) Update(c *gin.Context) {
 
 func (h *StudentHandler) Delete(c *gin.Context) {
 	id := c.Param("id")
-	companyID := c.GetString("company_id")
 
-	if err := h.repo.Delete(id, companyID); err != nil {
+	if err := h.repo.Delete(id, auditActor(c)); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -230,6 +251,9 @@ func (h *StudentHandler) Delete(c *gin.Context) {
 func (h *StudentHandler) GetActivities(c *gin.Context) {
 	id := c.Param("id")
 
+	if !studentInScope(c, h.repo, "students.view", id) {
+		return
+	}
 	limit := 50
 	offset := 0
 
@@ -245,11 +269,14 @@ func (h *StudentHandler) GetActivities(c *gin.Context) {
 		}
 	}
 
-	activities, err := h.activityRepo.GetStudentActivities(id, limit, offset)
+	activities, err := h.activityRepo.GetStudentActivities(id, c.GetString("company_id"), limit, offset)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	if !canViewFinance(c) {
+		activities = hideFinanceActivities(activities)
+	}
 
 	c.JSON(http.StatusOK, activities)
 }
@@ -267,6 +294,16 @@ func (h *StudentHandler) AddNote(c *gin.Context) {
 		return
 	}
 
+	student, err := h.repo.GetByID(id, c.GetString("company_id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if student == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Student not found"})
+		return
+	}
+
 	// Get user ID from context (set by auth middleware)
 	var createdBy *int
 	if userID, exists := c.Get("userID"); exists {
@@ -281,7 +318,7 @@ func (h *StudentHandler) AddNote(c *gin.Context) {
 		CreatedBy: createdBy,
 	}
 
-	if err := h.repo.AddNote(note); err != nil {
+	if err := h.repo.AddNote(note, c.GetString("company_id")); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -296,7 +333,10 @@ func (h *StudentHandler) AddNote(c *gin.Context) {
 func (h *StudentHandler) GetNotes(c *gin.Context) {
 	id := c.Param("id")
 
-	notes, err := h.repo.GetNotes(id)
+	if !studentInScope(c, h.repo, "students.view", id) {
+		return
+	}
+	notes, err := h.repo.GetNotes(id, c.GetString("company_id"))
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -369,7 +409,10 @@ func (h *StudentHandler) UpdateStatus(c *gin.Context) {
 func (h *StudentHandler) GetAttendanceJournal(c *gin.Context) {
 	id := c.Param("id")
 
-	journal, err := h.repo.GetAttendanceJournal(id)
+	if !studentInScope(c, h.repo, "students.view", id) {
+		return
+	}
+	journal, err := h.repo.GetAttendanceJournal(id, c.GetString("company_id"))
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -382,11 +425,17 @@ func (h *StudentHandler) GetAttendanceJournal(c *gin.Context) {
 func (h *StudentHandler) GetNotifications(c *gin.Context) {
 	id := c.Param("id")
 
-	notifications, err := h.notificationRepo.GetStudentNotifications(id)
+	if !studentInScope(c, h.repo, "students.view", id) {
+		return
+	}
+	notifications, err := h.notificationRepo.GetStudentNotifications(id, c.GetString("company_id"))
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	if !canViewFinance(c) {
+		notifications = hideFinanceNotifications(notifications)
+	}
 
 	c.JSON(http.StatusOK, notifications)
 }
@@ -400,7 +449,11 @@ func (h *StudentHandler) MarkNotificationRead(c *gin.Context) {
 		return
 	}
 
-	if err := h.notificationRepo.MarkAsRead(notificationID); err != nil {
+	if err := h.notificationRepo.MarkAsRead(notificationID, c.GetString("company_id")); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Notification not found"})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -5,6 +5,7 @@ import (
 	"classmate-central/internal/repository"
 	"classmate-central/internal/services"
 	"classmate-central/internal/validation"
+	"database/sql"
 	"net/http"
 	"time"
 
@@ -14,6 +15,8 @@ import (
 
 type SubscriptionHandler struct {
 	repo                *repository.SubscriptionRepository
+	lessonRepo          *repository.LessonRepository
+	studentRepo         *repository.StudentRepository
 	attendanceService    *services.AttendanceService
 	activityService      *services.ActivityService
 	subscriptionService  *services.SubscriptionService
@@ -21,12 +24,16 @@ type SubscriptionHandler struct {
 
 func NewSubscriptionHandler(
 	repo *repository.SubscriptionRepository,
+	lessonRepo *repository.LessonRepository,
+	studentRepo *repository.StudentRepository,
 	attendanceService *services.AttendanceService,
 	activityService *services.ActivityService,
 	subscriptionService *services.SubscriptionService,
 ) *SubscriptionHandler {
 	return &SubscriptionHandler{
 		repo:               repo,
+		lessonRepo:         lessonRepo,
+		studentRepo:        studentRepo,
 		attendanceService:  attendanceService,
 		activityService:    activityService,
 		subscriptionService: subscriptionService,
@@ -164,7 +171,7 @@ func (h *SubscriptionHandler) GetStudentSubscriptions(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, subs)
+	c.JSON(http.StatusOK, subscriptionsResponse(c, subs))
 }
 
 func (h *SubscriptionHandler) GetSubscriptionByID(c *gin.Context) {
@@ -177,7 +184,7 @@ func (h *SubscriptionHandler) GetSubscriptionByID(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, sub)
+	c.JSON(http.StatusOK, subscriptionResponse(c, sub))
 }
 
 func (h *SubscriptionHandler) UpdateSubscription(c *gin.Context) {
@@ -227,7 +234,7 @@ func (h *SubscriptionHandler) GetAllSubscriptions(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, subs)
+	c.JSON(http.StatusOK, subscriptionsResponse(c, subs))
 }
 
 // ============= Subscription Freezes =============
@@ -242,7 +249,12 @@ func (h *SubscriptionHandler) CreateFreeze(c *gin.Context) {
 	}
 
 	freeze.SubscriptionID = subscriptionID
-	if err := h.repo.CreateFreeze(&freeze); err != nil {
+	err := h.repo.CreateFreeze(&freeze, c.GetString("company_id"))
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Subscription not found"})
+		return
+	}
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -253,7 +265,7 @@ func (h *SubscriptionHandler) CreateFreeze(c *gin.Context) {
 func (h *SubscriptionHandler) GetFreezes(c *gin.Context) {
 	subscriptionID := c.Param("id")
 
-	freezes, err := h.repo.GetFreezesBySubscription(subscriptionID)
+	freezes, err := h.repo.GetFreezesBySubscription(subscriptionID, c.GetString("company_id"))
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -269,7 +281,12 @@ func (h *SubscriptionHandler) UpdateFreeze(c *gin.Context) {
 		return
 	}
 
-	if err := h.repo.UpdateFreeze(&freeze); err != nil {
+	err := h.repo.UpdateFreeze(&freeze, c.GetString("company_id"))
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Freeze not found"})
+		return
+	}
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -337,6 +354,11 @@ func (h *SubscriptionHandler) MarkAttendance(c *gin.Context) {
 	// Get company ID from context
 	companyID := c.GetString("company_id")
 
+	// Scope "own": attendance can only be marked in the user's own lessons
+	if !lessonInScope(c, h.lessonRepo, "attendance.mark", req.LessonID) {
+		return
+	}
+
 	// Get user ID from context (set by auth middleware)
 	var markedBy *int
 	if userID, exists := c.Get("userID"); exists {
@@ -358,7 +380,11 @@ func (h *SubscriptionHandler) MarkAttendance(c *gin.Context) {
 func (h *SubscriptionHandler) GetAttendanceByLesson(c *gin.Context) {
 	lessonID := c.Param("lessonId")
 
-	attendances, err := h.repo.GetAttendanceByLesson(lessonID)
+	if !lessonInScope(c, h.lessonRepo, "attendance.view", lessonID) {
+		return
+	}
+
+	attendances, err := h.repo.GetAttendanceByLesson(lessonID, c.GetString("company_id"))
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -370,7 +396,11 @@ func (h *SubscriptionHandler) GetAttendanceByLesson(c *gin.Context) {
 func (h *SubscriptionHandler) GetAttendanceByStudent(c *gin.Context) {
 	studentID := c.Param("studentId")
 
-	attendances, err := h.repo.GetAttendanceByStudent(studentID)
+	if !studentInScope(c, h.studentRepo, "attendance.view", studentID) {
+		return
+	}
+
+	attendances, err := h.repo.GetAttendanceByStudent(studentID, c.GetString("company_id"))
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
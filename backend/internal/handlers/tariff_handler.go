@@ -24,9 +24,8 @@ func (h *TariffHandler) Create(c *gin.Context) {
 		return
 	}
 
-	companyID := c.GetString("company_id")
 	tariff.ID = uuid.New().String()
-	if err := h.repo.Create(&tariff, companyID); err != nil {
+	if err := h.repo.Create(&tariff, auditActor(c)); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -60,7 +59,6 @@ func (h *TariffHandler) GetByID(c *gin.Context) {
 
 func (h *TariffHandler) Update(c *gin.Context) {
 	id := c.Param("id")
-	companyID := c.GetString("company_id")
 
 	var tariff models.Tariff
 	if err := c.ShouldBindJSON(&tariff); err != nil {
@@ -69,7 +67,7 @@ func (h *TariffHandler) Update(c *gin.Context) {
 	}
 
 	tariff.ID = id
-	if err := h.repo.Update(&tariff, companyID); err != nil {
+	if err := h.repo.Update(&tariff, auditActor(c)); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -79,9 +77,8 @@ func (h *TariffHandler) Update(c *gin.Context) {
 
 func (h *TariffHandler) Delete(c *gin.Context) {
 	id := c.Param("id")
-	companyID := c.GetString("company_id")
 
-	if err := h.repo.Delete(id, companyID); err != nil {
+	if err := h.repo.Delete(id, auditActor(c)); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
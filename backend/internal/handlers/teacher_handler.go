@@ -1,6 +1,8 @@
 package handlers
 
 import (
+	"database/sql"
+	"errors"
 	"net/http"
 
 	"classmate-central/internal/models"
@@ -135,12 +137,48 @@ func (h *TeacherHandler) Update(c *gin.Context) {
 
 func (h *TeacherHandler) Delete(c *gin.Context) {
 	id := c.Param("id")
-	companyID := c.GetString("company_id")
 
-	if err := h.repo.Delete(id, companyID); err != nil {
+	if err := h.repo.Delete(id, auditActor(c)); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{"message": "Teacher deleted successfully"})
 }
+
+// LinkUser links the teacher to a user account so that "own" data scopes resolve to it
+// PUT /api/teachers/:id/user
+func (h *TeacherHandler) LinkUser(c *gin.Context) {
+	id := c.Param("id")
+	companyID := c.GetString("company_id")
+
+	var req models.LinkTeacherUserRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	err := h.repo.LinkUser(id, req.UserID, companyID)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Teacher not found"})
+		return
+	case errors.Is(err, repository.ErrTeacherUserNotInCompany):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, repository.ErrTeacherUserAlreadyLinked):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	teacher, err := h.repo.GetByID(id, companyID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, teacher)
+}
@@ -0,0 +1,289 @@
+package handlers
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"classmate-central/internal/database"
+	"classmate-central/internal/middleware"
+	"classmate-central/internal/models"
+	"classmate-central/internal/repository"
+	"classmate-central/internal/services"
+	"classmate-central/internal/testutil"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// setupTenantIsolationRouter mounts the student, lead, schedule, finance and subscription routes
+// behind the same auth and company middleware as cmd/api. Handler tests add the routes they need;
+// the full router of cmd/api is walked by the tests of internal/server.
+func setupTenantIsolationRouter(t *testing.T) (*gin.Engine, *sql.DB) {
+	router, _, db := setupTestRouter(t)
+
+	studentRepo := repository.NewStudentRepository(db)
+	activityRepo := repository.NewActivityRepository(db)
+	notificationRepo := repository.NewNotificationRepository(db)
+	planService := services.NewPlanService(repository.NewPlanRepository(db), repository.NewCompanyRepository(db))
+	studentHandler := NewStudentHandler(studentRepo, activityRepo, notificationRepo, services.NewActivityService(activityRepo), planService)
+	leadHandler := NewLeadHandler(repository.NewLeadRepository(db))
+
+	lessonRepo := repository.NewLessonRepository(db)
+	roomRepo := repository.NewRoomRepository(db)
+	debtRepo := repository.NewDebtRepository(db)
+	subscriptionRepo := repository.NewSubscriptionRepository(db)
+	activityService := services.NewActivityService(activityRepo)
+	emailService := services.NewEmailService()
+	attendanceService := services.NewAttendanceService(subscriptionRepo, repository.NewSubscriptionConsumptionRepository(db), activityRepo, notificationRepo, emailService, studentRepo, lessonRepo, db)
+	subscriptionService := services.NewSubscriptionService(subscriptionRepo, lessonRepo, activityRepo, db)
+	debtService := services.NewDebtService(debtRepo, repository.NewBranchRepository(db), services.NewCurrencyService(repository.NewCurrencyRepository(db)))
+	teacherHandler := NewTeacherHandler(repository.NewTeacherRepository(db))
+	groupHandler := NewGroupHandler(repository.NewGroupRepository(db), lessonRepo)
+	lessonHandler := NewLessonHandler(lessonRepo, roomRepo)
+	settingsHandler := NewSettingsHandler(repository.NewSettingsRepository(db))
+	roomHandler := NewRoomHandler(roomRepo)
+	paymentHandler := NewPaymentHandler(repository.NewPaymentRepository(db), activityService, emailService, studentRepo)
+	tariffHandler := NewTariffHandler(repository.NewTariffRepository(db))
+	debtHandler := NewDebtHandler(debtRepo, debtService, services.NewExportService())
+	subscriptionHandler := NewSubscriptionHandler(subscriptionRepo, lessonRepo, studentRepo, attendanceService, activityService, subscriptionService)
+
+	api := router.Group("/api")
+	api.Use(middleware.AuthMiddleware(db), middleware.CompanyMiddleware(db))
+	api.POST("/students", middleware.RequirePermission("students", "create"), studentHandler.Create)
+	api.GET("/students/:id/activities", middleware.RequirePermission("students", "view"), studentHandler.GetActivities)
+	api.POST("/students/:id/notes", middleware.RequirePermission("students", "update"), studentHandler.AddNote)
+	api.GET("/students/:id/notes", middleware.RequirePermission("students", "view"), studentHandler.GetNotes)
+	api.PUT("/students/:id/status", middleware.RequirePermission("students", "update"), studentHandler.UpdateStatus)
+	api.GET("/students/:id/attendance", middleware.RequirePermission("students", "view"), studentHandler.GetAttendanceJournal)
+	api.GET("/students/:id/notifications", middleware.RequirePermission("students", "view"), studentHandler.GetNotifications)
+	api.GET("/students/:id", middleware.RequirePermission("students", "view"), studentHandler.GetByID)
+	api.PUT("/students/:id", middleware.RequirePermission("students", "update"), studentHandler.Update)
+	api.DELETE("/students/:id", middleware.RequirePermission("students", "delete"), studentHandler.Delete)
+	api.PUT("/notifications/:notificationId/read", middleware.RequirePermission("students", "view"), studentHandler.MarkNotificationRead)
+	api.POST("/leads", middleware.RequirePermission("leads", "create"), leadHandler.Create)
+	api.GET("/leads/:id", middleware.RequirePermission("leads", "view"), leadHandler.GetByID)
+	api.PUT("/leads/:id", middleware.RequirePermission("leads", "update"), leadHandler.Update)
+	api.DELETE("/leads/:id", middleware.RequirePermission("leads", "delete"), leadHandler.Delete)
+	api.GET("/leads/:id/activities", middleware.RequirePermission("leads", "view"), leadHandler.GetActivities)
+	api.POST("/leads/:id/activities", middleware.RequirePermission("leads", "update"), leadHandler.AddActivity)
+	api.GET("/leads/:id/tasks", middleware.RequirePermission("leads", "view"), leadHandler.GetTasks)
+	api.POST("/leads/:id/tasks", middleware.RequirePermission("leads", "update"), leadHandler.CreateTask)
+	api.PUT("/leads/:id/tasks/:taskId", middleware.RequirePermission("leads", "update"), leadHandler.UpdateTask)
+	api.GET("/teachers", middleware.RequirePermission("teachers", "view"), teacherHandler.GetAll)
+	api.GET("/teachers/:id", middleware.RequirePermission("teachers", "view"), teacherHandler.GetByID)
+	api.POST("/teachers", middleware.RequirePermission("teachers", "create"), teacherHandler.Create)
+	api.PUT("/teachers/:id", middleware.RequirePermission("teachers", "update"), teacherHandler.Update)
+	api.DELETE("/teachers/:id", middleware.RequirePermission("teachers", "delete"), teacherHandler.Delete)
+	api.GET("/groups", middleware.RequirePermission("groups", "view"), groupHandler.GetAll)
+	api.GET("/groups/:id", middleware.RequirePermission("groups", "view"), groupHandler.GetByID)
+	api.POST("/groups", middleware.RequirePermission("groups", "create"), groupHandler.Create)
+	api.PUT("/groups/:id", middleware.RequirePermission("groups", "update"), groupHandler.Update)
+	api.DELETE("/groups/:id", middleware.RequirePermission("groups", "delete"), groupHandler.Delete)
+	api.POST("/groups/:id/generate-lessons", middleware.RequirePermission("lessons", "create"), groupHandler.GenerateLessons)
+	api.POST("/groups/:id/extend", middleware.RequirePermission("groups", "update"), groupHandler.ExtendGroup)
+	api.GET("/lessons", middleware.RequirePermission("lessons", "view"), lessonHandler.GetAll)
+	api.GET("/lessons/individual", middleware.RequirePermission("lessons", "view"), lessonHandler.GetIndividual)
+	api.GET("/lessons/:id", middleware.RequirePermission("lessons", "view"), lessonHandler.GetByID)
+	api.POST("/lessons", middleware.RequirePermission("lessons", "create"), lessonHandler.Create)
+	api.PUT("/lessons/:id", middleware.RequirePermission("lessons", "update"), lessonHandler.Update)
+	api.DELETE("/lessons/:id", middleware.RequirePermission("lessons", "delete"), lessonHandler.Delete)
+	api.POST("/lessons/check-conflicts", middleware.RequirePermission("lessons", "create"), lessonHandler.CheckConflicts)
+	api.GET("/lessons/teacher/:teacherId", middleware.RequirePermission("lessons", "view"), lessonHandler.GetByTeacher)
+	api.POST("/lessons/bulk", middleware.RequirePermission("lessons", "create"), lessonHandler.CreateBulk)
+	api.GET("/settings", middleware.RequirePermission("settings", "view"), settingsHandler.Get)
+	api.PUT("/settings", middleware.RequirePermission("settings", "update"), settingsHandler.Update)
+	api.GET("/rooms", middleware.RequirePermission("rooms", "view"), roomHandler.GetAll)
+	api.GET("/rooms/:id", middleware.RequirePermission("rooms", "view"), roomHandler.GetByID)
+	api.POST("/rooms", middleware.RequirePermission("rooms", "create"), roomHandler.Create)
+	api.PUT("/rooms/:id", middleware.RequirePermission("rooms", "update"), roomHandler.Update)
+	api.DELETE("/rooms/:id", middleware.RequirePermission("rooms", "delete"), roomHandler.Delete)
+	api.POST("/payments/transactions", middleware.RequirePermission("finance", "transactions"), paymentHandler.CreateTransaction)
+	api.GET("/payments/transactions", middleware.RequirePermission("finance", "view"), paymentHandler.GetAllTransactions)
+	api.GET("/payments/transactions/student/:studentId", middleware.RequirePermission("finance", "view"), paymentHandler.GetTransactionsByStudent)
+	api.PUT("/payments/transactions/:id", middleware.RequirePermission("finance", "transactions"), paymentHandler.UpdateTransaction)
+	api.GET("/payments/balance/:studentId", middleware.RequirePermission("finance", "view"), paymentHandler.GetStudentBalance)
+	api.GET("/payments/balances", middleware.RequirePermission("finance", "view"), paymentHandler.GetAllBalances)
+	api.GET("/tariffs", middleware.RequirePermission("finance", "tariffs"), tariffHandler.GetAll)
+	api.GET("/tariffs/:id", middleware.RequirePermission("finance", "tariffs"), tariffHandler.GetByID)
+	api.POST("/tariffs", middleware.RequirePermission("finance", "tariffs"), tariffHandler.Create)
+	api.PUT("/tariffs/:id", middleware.RequirePermission("finance", "tariffs"), tariffHandler.Update)
+	api.DELETE("/tariffs/:id", middleware.RequirePermission("finance", "tariffs"), tariffHandler.Delete)
+	api.GET("/debts", middleware.RequirePermission("finance", "debts"), debtHandler.GetAll)
+	api.GET("/debts/student/:studentId", middleware.RequirePermission("finance", "debts"), debtHandler.GetByStudent)
+	api.POST("/debts", middleware.RequirePermission("finance", "debts"), debtHandler.Create)
+	api.PUT("/debts/:id", middleware.RequirePermission("finance", "debts"), debtHandler.Update)
+	api.DELETE("/debts/:id", middleware.RequirePermission("finance", "debts"), debtHandler.Delete)
+	api.GET("/debts/:id/payments", middleware.RequirePermission("finance", "debts"), debtHandler.GetPayments)
+	api.GET("/debts/aging", middleware.RequirePermission("finance", "debts"), debtHandler.GetAgingReport)
+	api.GET("/subscriptions/types", middleware.RequirePermission("subscriptions", "view"), subscriptionHandler.GetAllTypes)
+	api.GET("/subscriptions/types/:id", middleware.RequirePermission("subscriptions", "view"), subscriptionHandler.GetTypeByID)
+	api.POST("/subscriptions/types", middleware.RequirePermission("subscriptions", "create"), subscriptionHandler.CreateType)
+	api.PUT("/subscriptions/types/:id", middleware.RequirePermission("subscriptions", "update"), subscriptionHandler.UpdateType)
+	api.DELETE("/subscriptions/types/:id", middleware.RequirePermission("subscriptions", "delete"), subscriptionHandler.DeleteType)
+	api.GET("/subscriptions", middleware.RequirePermission("subscriptions", "view"), subscriptionHandler.GetAllSubscriptions)
+	api.GET("/subscriptions/student/:studentId", middleware.RequirePermission("subscriptions", "view"), subscriptionHandler.GetStudentSubscriptions)
+	api.GET("/subscriptions/:id", middleware.RequirePermission("subscriptions", "view"), subscriptionHandler.GetSubscriptionByID)
+	api.POST("/subscriptions", middleware.RequirePermission("subscriptions", "create"), subscriptionHandler.CreateStudentSubscription)
+	api.PUT("/subscriptions/:id", middleware.RequirePermission("subscriptions", "update"), subscriptionHandler.UpdateSubscription)
+	api.DELETE("/subscriptions/:id", middleware.RequirePermission("subscriptions", "delete"), subscriptionHandler.DeleteSubscription)
+	api.GET("/subscriptions/:id/freezes", middleware.RequirePermission("subscriptions", "view"), subscriptionHandler.GetFreezes)
+	api.POST("/subscriptions/:id/freezes", middleware.RequirePermission("subscriptions", "freeze"), subscriptionHandler.CreateFreeze)
+	api.POST("/subscriptions/:id/freeze", middleware.RequirePermission("subscriptions", "freeze"), subscriptionHandler.FreezeSubscription)
+	api.PUT("/subscriptions/freezes", middleware.RequirePermission("subscriptions", "freeze"), subscriptionHandler.UpdateFreeze)
+	api.POST("/attendance", middleware.RequirePermission("attendance", "mark"), subscriptionHandler.MarkAttendance)
+	api.GET("/attendance/lesson/:lessonId", middleware.RequirePermission("attendance", "view"), subscriptionHandler.GetAttendanceByLesson)
+	api.GET("/attendance/student/:studentId", middleware.RequirePermission("attendance", "view"), subscriptionHandler.GetAttendanceByStudent)
+
+	return router, db
+}
+
+// tenantRequest sends an authenticated JSON request and returns the recorder
+func tenantRequest(router *gin.Engine, token, method, path string, body interface{}) *httptest.ResponseRecorder {
+	var reader *bytes.Reader
+	if body != nil {
+		jsonBody, _ := json.Marshal(body)
+		reader = bytes.NewReader(jsonBody)
+	} else {
+		reader = bytes.NewReader(nil)
+	}
+	req, _ := http.NewRequest(method, path, reader)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+// registerTenant creates a company with its owner and returns the owner's access token
+func registerTenant(t *testing.T, router *gin.Engine, email string) string {
+	t.Helper()
+	jsonBody, _ := json.Marshal(models.RegisterRequest{
+		Email:       email,
+		Password:    "password123",
+		Name:        "Owner " + email,
+		CompanyName: "Company " + email,
+	})
+	req, _ := http.NewRequest("POST", "/api/auth/register", bytes.NewBuffer(jsonBody))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+
+	var response models.AuthResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	return response.Token
+}
+
+// createdID decodes the "id" of a 201 response
+func createdID(t *testing.T, w *httptest.ResponseRecorder) string {
+	t.Helper()
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var created struct {
+		ID json.RawMessage `json:"id"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+	var id string
+	if err := json.Unmarshal(created.ID, &id); err != nil {
+		id = string(created.ID) // numeric IDs
+	}
+	return id
+}
+
+// TestTenantIsolation_ForeignIDs has company B call every student and lead endpoint with the
+// IDs of company A's rows. Reads must not return them and writes must not change them.
+func TestTenantIsolation_ForeignIDs(t *testing.T) {
+	router, db := setupTenantIsolationRouter(t)
+	defer db.Close()
+	defer testutil.CleanupTestDB(t, db)
+
+	tokenA := registerTenant(t, router, "owner-a@example.com")
+	tokenB := registerTenant(t, router, "owner-b@example.com")
+
+	// Company A's data
+	studentID := createdID(t, tenantRequest(router, tokenA, "POST", "/api/students", gin.H{"name": "Anna Petrova", "age": 12}))
+	createdID(t, tenantRequest(router, tokenA, "POST", "/api/students/"+studentID+"/notes", gin.H{"note": "Prefers mornings"}))
+	leadID := createdID(t, tenantRequest(router, tokenA, "POST", "/api/leads", gin.H{"name": "Lead A", "phone": "+77001234567", "source": "call"}))
+	createdID(t, tenantRequest(router, tokenA, "POST", "/api/leads/"+leadID+"/activities", gin.H{"activityType": "call", "description": "First call"}))
+	taskID := createdID(t, tenantRequest(router, tokenA, "POST", "/api/leads/"+leadID+"/tasks", gin.H{"title": "Call back"}))
+
+	notification := &models.Notification{StudentID: studentID, Type: "debt_reminder", Message: "Debt"}
+	require.NoError(t, repository.NewNotificationRepository(db).CreateNotification(notification))
+	notificationID := fmt.Sprint(notification.ID)
+
+	notFound := []struct {
+		method string
+		path   string
+		body   interface{}
+	}{
+		{"GET", "/api/students/" + studentID, nil},
+		{"POST", "/api/students/" + studentID + "/notes", gin.H{"note": "Injected"}},
+		{"PUT", "/api/students/" + studentID + "/status", gin.H{"status": "inactive"}},
+		{"PUT", "/api/notifications/" + notificationID + "/read", nil},
+		{"GET", "/api/leads/" + leadID, nil},
+		{"GET", "/api/leads/" + leadID + "/activities", nil},
+		{"POST", "/api/leads/" + leadID + "/activities", gin.H{"activityType": "note", "description": "Injected"}},
+		{"GET", "/api/leads/" + leadID + "/tasks", nil},
+		{"POST", "/api/leads/" + leadID + "/tasks", gin.H{"title": "Injected"}},
+		{"PUT", "/api/leads/" + leadID + "/tasks/" + taskID, gin.H{"title": "Hijacked", "status": "completed"}},
+	}
+	for _, tc := range notFound {
+		w := tenantRequest(router, tokenB, tc.method, tc.path, tc.body)
+		assert.Equal(t, http.StatusNotFound, w.Code, "%s %s: %s", tc.method, tc.path, w.Body.String())
+	}
+
+	// Lists scoped to the student return nothing of company A
+	for _, path := range []string{
+		"/api/students/" + studentID + "/activities",
+		"/api/students/" + studentID + "/notes",
+		"/api/students/" + studentID + "/attendance",
+		"/api/students/" + studentID + "/notifications",
+	} {
+		w := tenantRequest(router, tokenB, "GET", path, nil)
+		if w.Code == http.StatusOK {
+			assert.JSONEq(t, "[]", w.Body.String(), path)
+		} else {
+			assert.Equal(t, http.StatusNotFound, w.Code, path)
+		}
+	}
+
+	// Updates and deletes by foreign ID leave company A's rows alone
+	tenantRequest(router, tokenB, "PUT", "/api/students/"+studentID, gin.H{"name": "Hijacked", "age": 30})
+	tenantRequest(router, tokenB, "DELETE", "/api/students/"+studentID, nil)
+	tenantRequest(router, tokenB, "PUT", "/api/leads/"+leadID, gin.H{"name": "Hijacked", "phone": "+77000000000", "source": "call"})
+	tenantRequest(router, tokenB, "DELETE", "/api/leads/"+leadID, nil)
+
+	w := tenantRequest(router, tokenA, "GET", "/api/students/"+studentID, nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "Anna Petrova")
+
+	w = tenantRequest(router, tokenA, "GET", "/api/students/"+studentID+"/notes", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.NotContains(t, w.Body.String(), "Injected")
+
+	w = tenantRequest(router, tokenA, "GET", "/api/leads/"+leadID, nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "Lead A")
+
+	w = tenantRequest(router, tokenA, "GET", "/api/leads/"+leadID+"/tasks", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "Call back")
+	assert.NotContains(t, w.Body.String(), "Hijacked")
+
+	var isRead bool
+	require.NoError(t, db.QueryRow(`SELECT is_read FROM notifications WHERE id = $1`, notification.ID).Scan(&isRead))
+	assert.False(t, isRead)
+}
+
+// companyOf returns the company of the user with the email
+func companyOf(t *testing.T, db *sql.DB, email string) string {
+	t.Helper()
+	var companyID string
+	require.NoError(t, database.System(db).QueryRow(`SELECT company_id FROM users WHERE email = $1`, email).Scan(&companyID))
+	return companyID
+}
@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+
+	"classmate-central/internal/models"
+	"classmate-central/internal/services"
+	"classmate-central/internal/tenantarchive"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxArchiveSize caps the size of an uploaded company archive
+const maxArchiveSize = 100 << 20
+
+type TenantTransferHandler struct {
+	service     *services.TenantTransferService
+	planService *services.PlanService
+}
+
+func NewTenantTransferHandler(service *services.TenantTransferService, planService *services.PlanService) *TenantTransferHandler {
+	return &TenantTransferHandler{service: service, planService: planService}
+}
+
+// ExportCompanyData downloads all of the company's data as an archive
+// GET /api/migration/export
+func (h *TenantTransferHandler) ExportCompanyData(c *gin.Context) {
+	data, filename, err := h.service.Export(c.GetString("company_id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to export company data"})
+		return
+	}
+
+	c.Header("Content-Disposition", `attachment; filename="`+filename+`"`)
+	c.Data(http.StatusOK, "application/zip", data)
+}
+
+// ImportCompanyData checks an uploaded archive and, with dryRun=false and the checksum of the
+// dry run, imports it into the company
+// POST /api/migration/import (multipart: file, dryRun, checksum)
+func (h *TenantTransferHandler) ImportCompanyData(c *gin.Context) {
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxArchiveSize)
+	dryRun := true
+	if value := c.PostForm("dryRun"); value != "" {
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid dryRun"})
+			return
+		}
+		dryRun = parsed
+	}
+
+	header, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Upload the archive as file (at most 100 MB)"})
+		return
+	}
+	file, err := header.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read the archive"})
+		return
+	}
+	defer file.Close()
+	data, err := io.ReadAll(file)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read the archive"})
+		return
+	}
+
+	if !dryRun && planLimitReached(c, h.planService, models.PlanResourceStorage) {
+		return
+	}
+
+	report, err := h.service.Import(auditActor(c), data, dryRun, c.PostForm("checksum"))
+	switch {
+	case errors.Is(err, tenantarchive.ErrInvalidArchive):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrDryRunRequired):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Run a dry run of this archive within the last hour and pass its checksum to apply it"})
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to import company data"})
+	case !report.Valid:
+		c.JSON(http.StatusUnprocessableEntity, report)
+	default:
+		c.JSON(http.StatusOK, report)
+	}
+}
@@ -0,0 +1,185 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"classmate-central/internal/middleware"
+	"classmate-central/internal/models"
+	"classmate-central/internal/repository"
+	"classmate-central/internal/services"
+	"classmate-central/internal/testutil"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestImportCompanyDataRejectsBadUploads(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	h := NewTenantTransferHandler(services.NewTenantTransferService(nil, nil, nil), nil)
+	router := gin.New()
+	router.POST("/api/migration/import", h.ImportCompanyData)
+
+	upload := func(fields map[string]string, file []byte) *httptest.ResponseRecorder {
+		var body bytes.Buffer
+		mw := multipart.NewWriter(&body)
+		for name, value := range fields {
+			mw.WriteField(name, value)
+		}
+		if file != nil {
+			fw, _ := mw.CreateFormFile("file", "company.zip")
+			fw.Write(file)
+		}
+		mw.Close()
+		req := httptest.NewRequest(http.MethodPost, "/api/migration/import", &body)
+		req.Header.Set("Content-Type", mw.FormDataContentType())
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := upload(nil, nil)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "Upload the archive")
+
+	w = upload(map[string]string{"dryRun": "maybe"}, []byte("zip"))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "Invalid dryRun")
+
+	w = upload(nil, []byte("not a zip file"))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "invalid company archive")
+}
+
+// uploadArchive posts an archive to the import route as the token's company
+func uploadArchive(router *gin.Engine, token string, data []byte, fields map[string]string) *httptest.ResponseRecorder {
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	for name, value := range fields {
+		mw.WriteField(name, value)
+	}
+	fw, _ := mw.CreateFormFile("file", "company.zip")
+	fw.Write(data)
+	mw.Close()
+	req := httptest.NewRequest(http.MethodPost, "/api/migration/import", &body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	req.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+// TestImportCompanyData_RequiresStoredDryRun checks that the checksum of an archive alone does not
+// allow applying it: the importing company must have dry-run the archive, and each dry run
+// applies it once
+func TestImportCompanyData_RequiresStoredDryRun(t *testing.T) {
+	router, db := setupTenantIsolationRouter(t)
+	defer db.Close()
+	defer testutil.CleanupTestDB(t, db)
+
+	companyRepo := repository.NewCompanyRepository(db)
+	planService := services.NewPlanService(repository.NewPlanRepository(db), companyRepo)
+	service := services.NewTenantTransferService(repository.NewTenantTransferRepository(db), companyRepo, planService)
+	h := NewTenantTransferHandler(service, planService)
+	api := router.Group("/api")
+	api.Use(middleware.AuthMiddleware(db), middleware.CompanyMiddleware(db))
+	api.GET("/migration/export", middleware.RequirePermission("migration", "manage"), h.ExportCompanyData)
+	api.POST("/migration/import", middleware.RequirePermission("migration", "manage"), h.ImportCompanyData)
+
+	tokenA := registerTenant(t, router, "owner-export@example.com")
+	tokenB := registerTenant(t, router, "owner-import@example.com")
+	tokenC := registerTenant(t, router, "owner-other@example.com")
+	// The archive brings a branch, which a company on the free plan has no room for
+	_, err := db.Exec(`UPDATE companies SET plan_id = 'pro' WHERE id = ANY($1)`,
+		pq.Array([]string{companyOf(t, db, "owner-import@example.com"), companyOf(t, db, "owner-other@example.com")}))
+	require.NoError(t, err)
+	createdID(t, tenantRequest(router, tokenA, "POST", "/api/students", gin.H{"name": "Archived Student", "age": 12}))
+
+	w := tenantRequest(router, tokenA, "GET", "/api/migration/export", nil)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	archive := w.Body.Bytes()
+	sum := sha256.Sum256(archive)
+	checksum := hex.EncodeToString(sum[:])
+	apply := map[string]string{"dryRun": "false", "checksum": checksum}
+
+	w = uploadArchive(router, tokenB, archive, apply)
+	assert.Equal(t, http.StatusBadRequest, w.Code, "the checksum alone must not apply an archive")
+
+	// A dry run of another company does not count
+	w = uploadArchive(router, tokenC, archive, nil)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	w = uploadArchive(router, tokenB, archive, apply)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = uploadArchive(router, tokenB, archive, nil)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var report models.TenantImportReport
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &report))
+	assert.True(t, report.DryRun)
+	assert.Equal(t, checksum, report.Checksum)
+
+	w = uploadArchive(router, tokenB, archive, apply)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &report))
+	assert.False(t, report.DryRun)
+	assert.Equal(t, int64(1), report.Rows["students"])
+
+	w = uploadArchive(router, tokenB, archive, apply)
+	assert.Equal(t, http.StatusBadRequest, w.Code, "a dry run applies its archive once")
+}
+
+// TestImportCompanyData_RespectsPlanLimits checks that an archive with more students or branches
+// than the importing company's plan has room for fails its dry run and cannot be applied
+func TestImportCompanyData_RespectsPlanLimits(t *testing.T) {
+	router, db := setupTenantIsolationRouter(t)
+	defer db.Close()
+	defer testutil.CleanupTestDB(t, db)
+
+	companyRepo := repository.NewCompanyRepository(db)
+	planService := services.NewPlanService(repository.NewPlanRepository(db), companyRepo)
+	service := services.NewTenantTransferService(repository.NewTenantTransferRepository(db), companyRepo, planService)
+	h := NewTenantTransferHandler(service, planService)
+	api := router.Group("/api")
+	api.Use(middleware.AuthMiddleware(db), middleware.CompanyMiddleware(db))
+	api.GET("/migration/export", middleware.RequirePermission("migration", "manage"), h.ExportCompanyData)
+	api.POST("/migration/import", middleware.RequirePermission("migration", "manage"), h.ImportCompanyData)
+
+	tokenA := registerTenant(t, router, "owner-limits-export@example.com")
+	tokenB := registerTenant(t, router, "owner-limits-import@example.com")
+	companyB := companyOf(t, db, "owner-limits-import@example.com")
+	for _, name := range []string{"First Student", "Second Student"} {
+		createdID(t, tenantRequest(router, tokenA, "POST", "/api/students", gin.H{"name": name, "age": 12}))
+	}
+	w := tenantRequest(router, tokenA, "GET", "/api/migration/export", nil)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	archive := w.Body.Bytes()
+
+	// Room for the branch and one more student, not two
+	_, err := db.Exec(`INSERT INTO plans (id, name, max_students, max_branches) VALUES ('test-small', 'Small', 1, 2)`)
+	require.NoError(t, err)
+	defer db.Exec(`DELETE FROM plans WHERE id = 'test-small'`)
+	_, err = db.Exec(`UPDATE companies SET plan_id = 'test-small' WHERE id = $1`, companyB)
+	require.NoError(t, err)
+
+	w = uploadArchive(router, tokenB, archive, nil)
+	require.Equal(t, http.StatusUnprocessableEntity, w.Code, w.Body.String())
+	var report models.TenantImportReport
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &report))
+	assert.False(t, report.Valid)
+	assert.Contains(t, report.Errors, "plan limit: the archive adds 2 students, the plan allows 1 more")
+
+	w = uploadArchive(router, tokenB, archive, map[string]string{"dryRun": "false", "checksum": report.Checksum})
+	assert.Equal(t, http.StatusBadRequest, w.Code, "a failed dry run must not allow applying the archive")
+
+	var students int
+	require.NoError(t, db.QueryRow(`SELECT COUNT(*) FROM students WHERE company_id = $1`, companyB).Scan(&students))
+	assert.Equal(t, 0, students)
+}
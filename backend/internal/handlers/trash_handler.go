@@ -0,0 +1,102 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+
+	"classmate-central/internal/middleware"
+	"classmate-central/internal/models"
+	"classmate-central/internal/repository"
+	"classmate-central/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// trashPermissions maps each trash type to the permission needed to delete, and so to see and
+// restore, records of that type
+var trashPermissions = map[string]string{
+	models.TrashStudent: "students.delete",
+	models.TrashTeacher: "teachers.delete",
+	models.TrashGroup:   "groups.delete",
+	models.TrashLesson:  "lessons.delete",
+	models.TrashBranch:  "settings.update",
+}
+
+// trashPlanResources maps the trash types that count against a plan limit to their resource
+var trashPlanResources = map[string]string{
+	models.TrashStudent: models.PlanResourceStudents,
+	models.TrashBranch:  models.PlanResourceBranches,
+}
+
+type TrashHandler struct {
+	service     *services.TrashService
+	planService *services.PlanService
+}
+
+func NewTrashHandler(service *services.TrashService, planService *services.PlanService) *TrashHandler {
+	return &TrashHandler{service: service, planService: planService}
+}
+
+// GetTrash lists deleted records that can still be restored, limited to the types the user may delete
+// GET /api/trash?type=student|teacher|group|lesson|branch
+func (h *TrashHandler) GetTrash(c *gin.Context) {
+	entityType := c.Query("type")
+	if entityType != "" {
+		if !repository.IsTrashType(entityType) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown trash type"})
+			return
+		}
+		if !middleware.HasPermission(c, trashPermissions[entityType]) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Insufficient permissions"})
+			return
+		}
+	}
+
+	items, err := h.service.List(c.GetString("company_id"), entityType)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load trash"})
+		return
+	}
+
+	visible := []*models.TrashItem{}
+	for _, item := range items {
+		if middleware.HasPermission(c, trashPermissions[item.Type]) {
+			visible = append(visible, item)
+		}
+	}
+	c.JSON(http.StatusOK, visible)
+}
+
+// Restore brings a deleted record back
+// POST /api/trash/:type/:id/restore
+func (h *TrashHandler) Restore(c *gin.Context) {
+	entityType := c.Param("type")
+	if !repository.IsTrashType(entityType) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown trash type"})
+		return
+	}
+	if !middleware.HasPermission(c, trashPermissions[entityType]) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Insufficient permissions"})
+		return
+	}
+	if resource, ok := trashPlanResources[entityType]; ok && planLimitReached(c, h.planService, resource) {
+		return
+	}
+
+	err := h.service.Restore(entityType, c.Param("id"), auditActor(c))
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Record is not in the trash or can no longer be restored"})
+		return
+	}
+	if errors.Is(err, repository.ErrRestoreConflict) {
+		c.JSON(http.StatusConflict, gin.H{"error": "An active record with the same email exists"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to restore record"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Record restored successfully"})
+}
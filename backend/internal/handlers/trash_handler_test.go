@@ -0,0 +1,123 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"classmate-central/internal/middleware"
+	"classmate-central/internal/models"
+	"classmate-central/internal/money"
+	"classmate-central/internal/repository"
+	"classmate-central/internal/services"
+	"classmate-central/internal/testutil"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTrashPermissionsCoverEveryType(t *testing.T) {
+	for _, entityType := range []string{models.TrashStudent, models.TrashTeacher, models.TrashGroup, models.TrashLesson, models.TrashBranch} {
+		assert.NotEmpty(t, trashPermissions[entityType], entityType)
+	}
+}
+
+func TestTrashRestoreChecksTypeAndPermission(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	h := NewTrashHandler(nil, nil)
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		c.Set("company_id", "company")
+		c.Set("permissions", []string{"students.delete"})
+		c.Next()
+	})
+	router.POST("/api/trash/:type/:id/restore", h.Restore)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/trash/room/r1/restore", nil))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/trash/teacher/t1/restore", nil))
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	var body map[string]string
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	assert.Equal(t, "Insufficient permissions", body["error"])
+}
+
+// TestTrash_StudentRoundTrip deletes a student with a debt and an installment plan, checks that the
+// lists and the charge job skip them while the student is in the trash, and restores the student
+func TestTrash_StudentRoundTrip(t *testing.T) {
+	router, db := setupTenantIsolationRouter(t)
+	defer db.Close()
+	defer testutil.CleanupTestDB(t, db)
+
+	trashHandler := NewTrashHandler(services.NewTrashService(repository.NewTrashRepository(db)), services.NewPlanService(repository.NewPlanRepository(db), repository.NewCompanyRepository(db)))
+	api := router.Group("/api")
+	api.Use(middleware.AuthMiddleware(db), middleware.CompanyMiddleware(db))
+	api.GET("/trash", trashHandler.GetTrash)
+	api.POST("/trash/:type/:id/restore", trashHandler.Restore)
+
+	token := registerTenant(t, router, "owner-trash@example.com")
+	companyID := companyOf(t, db, "owner-trash@example.com")
+	studentID := createdID(t, tenantRequest(router, token, "POST", "/api/students", gin.H{"name": "Trash Student", "age": 12}))
+
+	subscriptionRepo := repository.NewSubscriptionRepository(db)
+	price := money.MustParse("40000", money.DefaultCurrency)
+	require.NoError(t, subscriptionRepo.CreateType(&models.SubscriptionType{ID: "trash-type", Name: "Monthly", LessonsCount: 8, Price: price, BillingType: "per_lesson"}, companyID))
+	require.NoError(t, subscriptionRepo.CreateStudentSubscription(&models.StudentSubscription{ID: "trash-sub", StudentID: studentID, SubscriptionTypeID: "trash-type", TotalLessons: 8, TotalPrice: price, StartDate: time.Now(), Status: "active"}, companyID))
+	require.NoError(t, repository.NewDebtRepository(db).Create(&models.DebtRecord{StudentID: studentID, Amount: money.MustParse("3000", money.DefaultCurrency), Notes: "Trash Debt"}, companyID))
+
+	installmentRepo := repository.NewInstallmentRepository(db)
+	plan := &models.InstallmentPlan{SubscriptionID: "trash-sub", TotalAmount: price, BillingMode: "debt", ReminderDays: 3,
+		Installments: []models.Installment{{Seq: 1, DueDate: time.Now().AddDate(0, 0, -1), Amount: price}}}
+	require.NoError(t, installmentRepo.CreatePlan(plan, companyID))
+	dueForPlan := func() bool {
+		due, err := installmentRepo.GetDueForCharge(time.Now())
+		require.NoError(t, err)
+		for _, inst := range due {
+			if inst.PlanID == plan.ID {
+				return true
+			}
+		}
+		return false
+	}
+	require.True(t, dueForPlan())
+
+	w := tenantRequest(router, token, "DELETE", "/api/students/"+studentID, nil)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	w = tenantRequest(router, token, "GET", "/api/students/"+studentID, nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	w = tenantRequest(router, token, "GET", "/api/debts", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.NotContains(t, w.Body.String(), "Trash Debt")
+	w = tenantRequest(router, token, "GET", "/api/subscriptions", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.NotContains(t, w.Body.String(), "trash-sub")
+	assert.False(t, dueForPlan(), "installments of a student in the trash must not be charged")
+
+	w = tenantRequest(router, token, "GET", "/api/trash", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), studentID)
+
+	w = tenantRequest(router, token, "POST", "/api/trash/student/"+studentID+"/restore", nil)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	w = tenantRequest(router, token, "GET", "/api/students/"+studentID, nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "Trash Student")
+	w = tenantRequest(router, token, "GET", "/api/debts", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "Trash Debt")
+	w = tenantRequest(router, token, "GET", "/api/subscriptions", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "trash-sub")
+	assert.True(t, dueForPlan(), "the plan resumes once the student is restored")
+
+	w = tenantRequest(router, token, "POST", "/api/trash/student/"+studentID+"/restore", nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
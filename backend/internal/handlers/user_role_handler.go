@@ -49,7 +49,7 @@ func (h *UserRoleHandler) GetUserRoles(c *gin.Context) {
 
 // AssignRole assigns a role to a user
 func (h *UserRoleHandler) AssignRole(c *gin.Context) {
-	companyID, exists := c.Get("company_id")
+	_, exists := c.Get("company_id")
 	if !exists {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Company context required"})
 		return
@@ -69,7 +69,7 @@ func (h *UserRoleHandler) AssignRole(c *gin.Context) {
 		assignedByPtr = &id
 	}
 
-	if err := h.userRepo.AssignRoleToUser(req.UserID, req.RoleID, companyID.(string), assignedByPtr); err != nil {
+	if err := h.userRepo.AssignRoleToUser(req.UserID, req.RoleID, assignedByPtr, auditActor(c)); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error assigning role: " + err.Error()})
 		return
 	}
@@ -79,7 +79,7 @@ func (h *UserRoleHandler) AssignRole(c *gin.Context) {
 
 // RemoveRole removes a role from a user
 func (h *UserRoleHandler) RemoveRole(c *gin.Context) {
-	companyID, exists := c.Get("company_id")
+	_, exists := c.Get("company_id")
 	if !exists {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Company context required"})
 		return
@@ -91,7 +91,7 @@ func (h *UserRoleHandler) RemoveRole(c *gin.Context) {
 		return
 	}
 
-	if err := h.userRepo.RemoveRoleFromUser(req.UserID, req.RoleID, companyID.(string)); err != nil {
+	if err := h.userRepo.RemoveRoleFromUser(req.UserID, req.RoleID, auditActor(c)); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error removing role: " + err.Error()})
 		return
 	}
@@ -1,6 +1,7 @@
 package middleware
 
 import (
+	"database/sql"
 	"fmt"
 	"net/http"
 	"os"
@@ -8,54 +9,105 @@ import (
 	"time"
 
 	"classmate-central/internal/logger"
+	"classmate-central/internal/repository"
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
 	"go.uber.org/zap"
 )
 
+// Token types carried in the "typ" claim. Access tokens authenticate API calls,
+// refresh tokens can only be exchanged at /auth/refresh.
+const (
+	TokenTypeAccess  = "access"
+	TokenTypeRefresh = "refresh"
+)
+
+const (
+	defaultAccessTokenTTL   = 15 * time.Minute
+	defaultRefreshTokenTTL  = 7 * 24 * time.Hour
+	defaultImpersonationTTL = 30 * time.Minute
+)
+
+// Claims identify the user and session only. Company, branches, roles and permissions
+// are resolved per request by CompanyMiddleware, so they are never stale.
 type Claims struct {
-	UserID         int      `json:"user_id"`
-	Email          string   `json:"email"`
-	RoleID         *string  `json:"role_id,omitempty"`
-	Permissions    []string `json:"permissions,omitempty"`
-	CurrentBranchID *string  `json:"current_branch_id,omitempty"`
-	Branches       []string `json:"branches,omitempty"` // List of accessible branch IDs
+	UserID         int    `json:"user_id"`
+	Email          string `json:"email,omitempty"`
+	Type           string `json:"typ"`
+	SessionID      string `json:"sid"`
+	ContextVersion int    `json:"ver,omitempty"` // users.context_version when the token was issued
 	jwt.RegisteredClaims
 }
 
-func GenerateToken(userID int, email string, roleID *string, permissions []string, currentBranchID *string, branches []string) (string, error) {
-	expirationTime := time.Now().Add(24 * time.Hour)
+// AccessTokenTTL returns the access token lifetime (JWT_EXPIRATION, default 15m)
+func AccessTokenTTL() time.Duration {
+	return durationFromEnv("JWT_EXPIRATION", defaultAccessTokenTTL)
+}
+
+// RefreshTokenTTL returns the refresh token lifetime (JWT_REFRESH_EXPIRATION, default 168h)
+func RefreshTokenTTL() time.Duration {
+	return durationFromEnv("JWT_REFRESH_EXPIRATION", defaultRefreshTokenTTL)
+}
+
+// ImpersonationTTL returns how long a platform admin's impersonation session lasts
+// (PLATFORM_IMPERSONATION_TTL, default 30m)
+func ImpersonationTTL() time.Duration {
+	return durationFromEnv("PLATFORM_IMPERSONATION_TTL", defaultImpersonationTTL)
+}
+
+func durationFromEnv(key string, fallback time.Duration) time.Duration {
+	if value := os.Getenv(key); value != "" {
+		if d, err := time.ParseDuration(value); err == nil && d > 0 {
+			return d
+		}
+		logger.Warn("Invalid duration setting, using default", zap.String("key", key), zap.String("value", value))
+	}
+	return fallback
+}
+
+// GenerateToken issues a short-lived access token bound to a session
+func GenerateToken(userID int, email string, sessionID string, contextVersion int) (string, error) {
 	claims := &Claims{
 		UserID:         userID,
 		Email:          email,
-		RoleID:         roleID,
-		Permissions:    permissions,
-		CurrentBranchID: currentBranchID,
-		Branches:       branches,
-		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(expirationTime),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
-		},
+		Type:           TokenTypeAccess,
+		SessionID:      sessionID,
+		ContextVersion: contextVersion,
 	}
-
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	jwtSecret := os.Getenv("JWT_SECRET")
-	return token.SignedString([]byte(jwtSecret))
+	return signToken(claims, AccessTokenTTL())
 }
 
-func GenerateRefreshToken(userID int, email string, roleID *string, permissions []string, currentBranchID *string, branches []string) (string, error) {
-	expirationTime := time.Now().Add(7 * 24 * time.Hour)
+// GenerateImpersonationToken issues the access token of an impersonation session. It lives as
+// long as the session because impersonation sessions cannot be refreshed.
+func GenerateImpersonationToken(userID int, email string, sessionID string, contextVersion int, expiresAt time.Time) (string, error) {
 	claims := &Claims{
 		UserID:         userID,
 		Email:          email,
-		RoleID:         roleID,
-		Permissions:    permissions,
-		CurrentBranchID: currentBranchID,
-		Branches:       branches,
-		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(expirationTime),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
-		},
+		Type:           TokenTypeAccess,
+		SessionID:      sessionID,
+		ContextVersion: contextVersion,
+	}
+	return signToken(claims, time.Until(expiresAt))
+}
+
+// GenerateRefreshToken issues a refresh token for a session. Refresh tokens carry
+// no permissions: everything is reloaded from the database when they are used.
+func GenerateRefreshToken(userID int, sessionID string) (string, error) {
+	claims := &Claims{
+		UserID:    userID,
+		Type:      TokenTypeRefresh,
+		SessionID: sessionID,
+	}
+	return signToken(claims, RefreshTokenTTL())
+}
+
+func signToken(claims *Claims, ttl time.Duration) (string, error) {
+	now := time.Now()
+	claims.RegisteredClaims = jwt.RegisteredClaims{
+		ID:        uuid.New().String(),
+		ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+		IssuedAt:  jwt.NewNumericDate(now),
 	}
 
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
@@ -84,7 +136,35 @@ func ValidateToken(tokenString string) (*Claims, error) {
 	return nil, fmt.Errorf("invalid token")
 }
 
-func AuthMiddleware() gin.HandlerFunc {
+// ValidateAccessToken validates a token and requires it to be a session-bound access token
+func ValidateAccessToken(tokenString string) (*Claims, error) {
+	return validateTyped(tokenString, TokenTypeAccess)
+}
+
+// ValidateRefreshToken validates a token and requires it to be a session-bound refresh token
+func ValidateRefreshToken(tokenString string) (*Claims, error) {
+	return validateTyped(tokenString, TokenTypeRefresh)
+}
+
+func validateTyped(tokenString, tokenType string) (*Claims, error) {
+	claims, err := ValidateToken(tokenString)
+	if err != nil {
+		return nil, err
+	}
+	if claims.Type != tokenType {
+		return nil, fmt.Errorf("unexpected token type %q", claims.Type)
+	}
+	if claims.SessionID == "" {
+		return nil, fmt.Errorf("token is not bound to a session")
+	}
+	return claims, nil
+}
+
+// AuthMiddleware authenticates access tokens and rejects tokens whose session
+// has been revoked or has expired.
+func AuthMiddleware(db *sql.DB) gin.HandlerFunc {
+	sessionRepo := repository.NewSessionRepository(db)
+
 	return func(c *gin.Context) {
 		authHeader := c.GetHeader("Authorization")
 		if authHeader == "" {
@@ -100,7 +180,7 @@ func AuthMiddleware() gin.HandlerFunc {
 			return
 		}
 
-		claims, err := ValidateToken(tokenString)
+		claims, err := ValidateAccessToken(tokenString)
 		if err != nil {
 			tokenPrefix := tokenString
 			if len(tokenString) > 20 {
@@ -112,16 +192,44 @@ func AuthMiddleware() gin.HandlerFunc {
 			return
 		}
 
-	c.Set("user_id", claims.UserID)
-	c.Set("user_email", claims.Email)
-	if claims.RoleID != nil {
-		c.Set("role_id", *claims.RoleID)
-	}
-	c.Set("permissions", claims.Permissions)
-	if claims.CurrentBranchID != nil {
-		c.Set("current_branch_id", *claims.CurrentBranchID)
-	}
-	c.Set("branches", claims.Branches)
-	c.Next()
+		state, err := sessionRepo.Touch(claims.SessionID, claims.UserID)
+		if err != nil {
+			logger.Error("Failed to check session", logger.ErrorField(err), zap.String("sessionId", claims.SessionID))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check session"})
+			c.Abort()
+			return
+		}
+		if state == nil || !state.Active {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Session has been revoked or expired"})
+			c.Abort()
+			return
+		}
+
+		c.Set("user_id", claims.UserID)
+		c.Set("session_id", claims.SessionID)
+		c.Set("user_email", claims.Email)
+		c.Set("context_version", state.ContextVersion)
+		if state.CurrentBranchID != nil {
+			c.Set("current_branch_id", *state.CurrentBranchID)
+		}
+		if state.TwoFactorVerifiedAt != nil {
+			c.Set("two_factor_verified_at", *state.TwoFactorVerifiedAt)
+		}
+		if state.ImpersonatedBy != nil {
+			c.Set("impersonated_by", *state.ImpersonatedBy)
+			if impersonationBlocked(c.Request.Method, c.Request.URL.Path) {
+				c.JSON(http.StatusForbidden, gin.H{
+					"error": "This action is not available while signed in as another user",
+					"code":  ImpersonationRestricted,
+				})
+				c.Abort()
+				return
+			}
+		}
+		// Roles or branches changed since the token was issued: clients should reload /auth/me
+		if claims.ContextVersion < state.ContextVersion {
+			c.Header("X-Context-Stale", "true")
+		}
+		c.Next()
 	}
 }
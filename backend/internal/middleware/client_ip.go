@@ -0,0 +1,89 @@
+package middleware
+
+import (
+	"net"
+	"os"
+	"strings"
+	"sync"
+
+	"classmate-central/internal/logger"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+const defaultCountryHeader = "CF-IPCountry"
+
+var (
+	trustedProxiesOnce sync.Once
+	trustedProxyNets   []*net.IPNet
+)
+
+// TrustedProxies returns the proxies (IPs or CIDRs) allowed to report the client address
+// in X-Forwarded-For / X-Real-IP, from TRUSTED_PROXIES (comma separated). Without it no
+// proxy is trusted and the address of the TCP peer is used.
+func TrustedProxies() []string {
+	var proxies []string
+	for _, entry := range strings.Split(os.Getenv("TRUSTED_PROXIES"), ",") {
+		if entry = strings.TrimSpace(entry); entry != "" {
+			proxies = append(proxies, entry)
+		}
+	}
+	return proxies
+}
+
+// parseTrustedProxies turns IPs and CIDRs into networks, skipping invalid entries
+func parseTrustedProxies(proxies []string) []*net.IPNet {
+	nets := make([]*net.IPNet, 0, len(proxies))
+	for _, proxy := range proxies {
+		if !strings.Contains(proxy, "/") {
+			if ip := net.ParseIP(proxy); ip != nil && ip.To4() != nil {
+				proxy += "/32"
+			} else {
+				proxy += "/128"
+			}
+		}
+		_, ipNet, err := net.ParseCIDR(proxy)
+		if err != nil {
+			logger.Warn("Invalid trusted proxy, ignoring", zap.String("proxy", proxy))
+			continue
+		}
+		nets = append(nets, ipNet)
+	}
+	return nets
+}
+
+// fromTrustedProxy reports whether the TCP peer of the request is a trusted proxy
+func fromTrustedProxy(c *gin.Context) bool {
+	trustedProxiesOnce.Do(func() {
+		trustedProxyNets = parseTrustedProxies(TrustedProxies())
+	})
+	ip := net.ParseIP(c.RemoteIP())
+	if ip == nil {
+		return false
+	}
+	for _, ipNet := range trustedProxyNets {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// ClientCountry returns the ISO country code a trusted proxy or CDN attached to the request
+// (GEOIP_COUNTRY_HEADER, default CF-IPCountry), or "" when unknown
+func ClientCountry(c *gin.Context) string {
+	if !fromTrustedProxy(c) {
+		return ""
+	}
+	header := os.Getenv("GEOIP_COUNTRY_HEADER")
+	if header == "" {
+		header = defaultCountryHeader
+	}
+	country := strings.ToUpper(strings.TrimSpace(c.GetHeader(header)))
+	// Cloudflare reports XX for unknown and T1 for Tor
+	if len(country) != 2 || country == "XX" {
+		return ""
+	}
+	return country
+}
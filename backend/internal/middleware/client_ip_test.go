@@ -0,0 +1,63 @@
+package middleware
+
+import (
+	"net"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestParseTrustedProxies(t *testing.T) {
+	nets := parseTrustedProxies([]string{"10.0.0.0/8", "192.168.1.10", "::1", "not-an-ip"})
+	if len(nets) != 3 {
+		t.Fatalf("got %d networks, want 3", len(nets))
+	}
+	for ip, want := range map[string]bool{
+		"10.1.2.3":     true,
+		"192.168.1.10": true,
+		"192.168.1.11": false,
+		"::1":          true,
+		"8.8.8.8":      false,
+	} {
+		got := false
+		for _, ipNet := range nets {
+			if ipNet.Contains(net.ParseIP(ip)) {
+				got = true
+			}
+		}
+		if got != want {
+			t.Errorf("%s trusted = %v, want %v", ip, got, want)
+		}
+	}
+}
+
+func TestClientCountry(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	trustedProxiesOnce.Do(func() {})
+	trustedProxyNets = parseTrustedProxies([]string{"10.0.0.0/8"})
+	defer func() { trustedProxyNets = nil }()
+
+	cases := []struct {
+		name       string
+		remoteAddr string
+		header     string
+		want       string
+	}{
+		{"trusted proxy", "10.0.0.5:443", "de", "DE"},
+		{"unknown country", "10.0.0.5:443", "XX", ""},
+		{"no header", "10.0.0.5:443", "", ""},
+		{"untrusted peer", "203.0.113.7:443", "DE", ""},
+	}
+	for _, tc := range cases {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest("POST", "/api/auth/login", nil)
+		c.Request.RemoteAddr = tc.remoteAddr
+		if tc.header != "" {
+			c.Request.Header.Set(defaultCountryHeader, tc.header)
+		}
+		if got := ClientCountry(c); got != tc.want {
+			t.Errorf("%s: ClientCountry = %q, want %q", tc.name, got, tc.want)
+		}
+	}
+}
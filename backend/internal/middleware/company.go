@@ -2,158 +2,222 @@ package middleware
 
 import (
 	"database/sql"
+	"errors"
+	"fmt"
 	"net/http"
 
+	"classmate-central/internal/database"
 	"classmate-central/internal/logger"
 	"classmate-central/internal/repository"
 
 	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
 	"go.uber.org/zap"
 )
 
-// CompanyMiddleware enriches request context with company, roles and permissions.
-// Must run after AuthMiddleware so user_id is already present.
+// ErrTenantUserNotFound is returned when resolving the context of a user that does not exist
+var ErrTenantUserNotFound = errors.New("user not found")
+
+var errTenantNoCompany = errors.New("user company not assigned")
+
+// CompanyMiddleware enriches request context with company, branches, roles and permissions.
+// Must run after AuthMiddleware so user_id and context_version are already present.
+// The resolved context is cached per user until the user's context version changes.
 func CompanyMiddleware(db *sql.DB) gin.HandlerFunc {
 	roleRepo := repository.NewRoleRepository(db)
+	branchRepo := repository.NewBranchRepository(db)
+	teacherRepo := repository.NewTeacherRepository(db)
+	twoFactorRepo := repository.NewTwoFactorRepository(db)
+	cache := NewTenantContextCache(defaultTenantCacheSize)
 
 	return func(c *gin.Context) {
-		userID, exists := c.Get("user_id")
-		if !exists {
+		userID := c.GetInt("user_id")
+		if userID == 0 {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
 			c.Abort()
 			return
 		}
 
-		// Get user's company_id from database
-		var companyID sql.NullString
-		query := `SELECT company_id FROM users WHERE id = $1`
-		err := db.QueryRow(query, userID).Scan(&companyID)
-		if err == sql.ErrNoRows {
-			logger.Error("User not found in database", zap.Any("userId", userID))
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
-			c.Abort()
-			return
+		tenant, ok := cache.Get(userID, c.GetInt("context_version"))
+		if !ok {
+			var err error
+			tenant, err = loadTenantContext(db, roleRepo, branchRepo, teacherRepo, twoFactorRepo, userID)
+			switch {
+			case errors.Is(err, ErrTenantUserNotFound):
+				logger.Error("User not found in database", zap.Int("userId", userID))
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
+				c.Abort()
+				return
+			case errors.Is(err, errTenantNoCompany):
+				logger.Error("User has no company_id assigned", zap.Int("userId", userID))
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "User company not assigned"})
+				c.Abort()
+				return
+			case err != nil:
+				logger.Error("Failed to resolve tenant context", logger.ErrorField(err), zap.Int("userId", userID))
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to resolve user context"})
+				c.Abort()
+				return
+			}
+			cache.Set(userID, tenant)
 		}
-		if err != nil {
-			logger.Error("Failed to load company for user", logger.ErrorField(err), zap.Any("userId", userID))
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get user company"})
+
+		// Add company_id to context for use in handlers
+		c.Set("company_id", tenant.CompanyID)
+		c.Set("two_factor_enabled", tenant.TwoFactorEnabled)
+		c.Set("two_factor_required", tenant.TwoFactorRequired)
+		c.Set("company_status", tenant.CompanyStatus)
+		c.Set("plan_features", tenant.PlanFeatures)
+		c.Set("platform_admin", tenant.PlatformAdmin)
+
+		// The company requires 2FA for one of the user's roles: only enrollment is allowed until it is enabled
+		if tenant.TwoFactorRequired && !tenant.TwoFactorEnabled && !twoFactorSetupExempt(c.Request.URL.Path) {
+			c.JSON(http.StatusForbidden, gin.H{
+				"error": "Two-factor authentication must be enabled for your role",
+				"code":  TwoFactorSetupRequired,
+			})
 			c.Abort()
 			return
 		}
-		if !companyID.Valid || companyID.String == "" {
-			logger.Error("User has no company_id assigned", zap.Any("userId", userID))
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "User company not assigned"})
+
+		// A suspended company keeps reading its data but cannot change it
+		if tenant.ReadOnly() && !readOnlyExempt(c.Request.Method, c.Request.URL.Path) {
+			c.JSON(http.StatusForbidden, gin.H{
+				"error": "The company is suspended: data can be viewed but not changed",
+				"code":  CompanyReadOnly,
+			})
 			c.Abort()
 			return
 		}
 
-		// Add company_id to context for use in handlers
-		c.Set("company_id", companyID.String)
-
-	// Handle branch context
-	// Priority: 1. X-Branch-ID header (skip for /api/branches endpoint), 2. current_branch_id from token, 3. First available branch from DB
-	branchID := ""
-	// Don't use X-Branch-ID header for /api/branches endpoint to avoid blocking access
-	if c.Request.URL.Path != "/api/branches" {
-		branchID = c.GetHeader("X-Branch-ID")
-	}
-	if branchID == "" {
-		// Try to get from token
-		if tokenBranchID, exists := c.Get("current_branch_id"); exists && tokenBranchID != nil {
-			branchID = tokenBranchID.(string)
+		// Handle branch context
+		// Priority: 1. X-Branch-ID header (skip for /api/branches endpoint), 2. current branch of the session, 3. First available branch
+		branchID := ""
+		fromHeader := false
+		// Don't use X-Branch-ID header for /api/branches endpoint to avoid blocking access
+		if c.Request.URL.Path != "/api/branches" {
+			branchID = c.GetHeader("X-Branch-ID")
+			fromHeader = branchID != ""
 		}
-	}
-
-		// If still no branch_id, try to get first available branch from database
-		// If branches table doesn't exist or no branches available, fallback to company_id
-		var branchRepo *repository.BranchRepository
 		if branchID == "" {
-			branchRepo = repository.NewBranchRepository(db)
-			userBranches, err := branchRepo.GetUserBranches(userID.(int), companyID.String)
-			if err == nil && len(userBranches) > 0 {
-				// Use first available branch
-				branchID = userBranches[0].ID
-				logger.Info("Auto-selected first available branch", zap.Any("userId", userID), zap.String("branchId", branchID))
-			} else {
-				// If branches table doesn't exist or user has no branches, use company_id as fallback
-				// This provides backward compatibility before migrations are applied
-				branchID = companyID.String
-				logger.Info("Using company_id as branch_id (fallback mode)", zap.Any("userId", userID), zap.String("branchId", branchID))
-			}
+			branchID = c.GetString("current_branch_id")
 		}
 
-		// Verify user has access to this branch (skip if using company_id as fallback)
-		if branchID != companyID.String {
-			// Use branchRepo created earlier, or create if not exists
-			if branchRepo == nil {
-				branchRepo = repository.NewBranchRepository(db)
-			}
-			
-			// Check if user has any branches - if not, allow access (user might be registering)
-			userBranches, err := branchRepo.GetUserBranches(userID.(int), companyID.String)
-			if err == nil && len(userBranches) == 0 {
-				// User has no branches yet - this might be during registration
-				// Allow access but use company_id as fallback
-				logger.Info("User has no branches yet, using company_id fallback", zap.Any("userId", userID), zap.String("branchId", branchID))
-				branchID = companyID.String
-			} else {
-				// User has branches, check access to requested branch
-				hasAccess, err := branchRepo.CheckUserBranchAccess(userID.(int), branchID, companyID.String)
-				if err != nil {
-					// If check fails (e.g., branches table doesn't exist), fallback to company_id
-					logger.Warn("Failed to check branch access, using company_id fallback", logger.ErrorField(err), zap.Any("userId", userID), zap.String("branchId", branchID))
-					branchID = companyID.String
-				} else if !hasAccess {
-					logger.Error("User does not have access to branch", zap.Any("userId", userID), zap.String("branchId", branchID))
-					c.JSON(http.StatusForbidden, gin.H{"error": "Access denied to this branch"})
-					c.Abort()
-					return
-				}
+		if len(tenant.BranchIDs) == 0 {
+			// User has no branches yet (e.g. during registration): use company_id as fallback
+			branchID = tenant.CompanyID
+		} else if branchID == "" {
+			branchID = tenant.BranchIDs[0]
+		} else if !tenant.HasBranch(branchID) {
+			if fromHeader {
+				logger.Error("User does not have access to branch", zap.Int("userId", userID), zap.String("branchId", branchID))
+				c.JSON(http.StatusForbidden, gin.H{"error": "Access denied to this branch"})
+				c.Abort()
+				return
 			}
+			// The branch selected in the session was taken away: fall back to the first accessible one
+			branchID = tenant.BranchIDs[0]
 		}
 
 		// Add branch_id to context
 		c.Set("branch_id", branchID)
-		
+
 		// Add list of accessible branch IDs to context for handlers that need to show data from all branches
-		if branchRepo != nil {
-			userBranches, err := branchRepo.GetUserBranches(userID.(int), companyID.String)
-			if err == nil && len(userBranches) > 0 {
-				branchIDs := make([]string, len(userBranches))
-				for i, b := range userBranches {
-					branchIDs[i] = b.ID
-				}
-				c.Set("accessible_branch_ids", branchIDs)
-			} else {
-				// Fallback: use company_id as single "branch"
-				c.Set("accessible_branch_ids", []string{companyID.String})
-			}
+		if len(tenant.BranchIDs) > 0 {
+			c.Set("accessible_branch_ids", tenant.BranchIDs)
 		} else {
 			// Fallback: use company_id as single "branch"
-			c.Set("accessible_branch_ids", []string{companyID.String})
+			c.Set("accessible_branch_ids", []string{tenant.CompanyID})
 		}
 
-		// Hydrate fresh roles/permissions for every request to avoid stale tokens
-		if roleRepo != nil {
-			roles, err := roleRepo.GetUserRoles(userID.(int), companyID.String)
-			if err != nil {
-				logger.Error("Failed to load roles", logger.ErrorField(err), zap.Any("userId", userID), zap.String("companyId", companyID.String))
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to resolve roles"})
-				c.Abort()
-				return
-			}
-			c.Set("roles", roles)
-
-			perms, err := roleRepo.GetUserPermissions(userID.(int), companyID.String)
-			if err != nil {
-				logger.Error("Failed to load permissions", logger.ErrorField(err), zap.Any("userId", userID), zap.String("companyId", companyID.String))
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to resolve permissions"})
-				c.Abort()
-				return
-			}
-			c.Set("permissions", perms)
+		if tenant.RoleID != nil {
+			c.Set("role_id", *tenant.RoleID)
+		}
+		c.Set("roles", tenant.Roles)
+		// Permissions are evaluated for the resolved branch (RequirePermission reads them)
+		permissions, _, _ := tenant.EffectivePermissions(branchID)
+		c.Set("permissions", permissions)
+		// Data scopes narrow what the permissions show (see DataScope)
+		c.Set("permission_scopes", tenant.PermissionScopes(branchID))
+		if tenant.TeacherID != "" {
+			c.Set("teacher_id", tenant.TeacherID)
 		}
 
 		c.Next()
 	}
 }
+
+// loadTenantContext resolves a user's company with its status and plan features, branches,
+// roles, permissions, linked teacher and 2FA state from the database
+func loadTenantContext(db *sql.DB, roleRepo *repository.RoleRepository, branchRepo *repository.BranchRepository, teacherRepo *repository.TeacherRepository, twoFactorRepo *repository.TwoFactorRepository, userID int) (*TenantContext, error) {
+	tenant := &TenantContext{}
+	var companyID, roleID sql.NullString
+	// The company is not known yet, so the lookup itself cannot be scoped to it
+	err := database.System(db).QueryRow(`
+		SELECT u.company_id, u.role_id, u.context_version, u.is_platform_admin,
+		       COALESCE(c.status, ''), COALESCE(p.features, '{}')
+		FROM users u
+		LEFT JOIN companies c ON c.id = u.company_id
+		LEFT JOIN plans p ON p.id = c.plan_id
+		WHERE u.id = $1`, userID).
+		Scan(&companyID, &roleID, &tenant.Version, &tenant.PlatformAdmin, &tenant.CompanyStatus, pq.Array(&tenant.PlanFeatures))
+	if err == sql.ErrNoRows {
+		return nil, ErrTenantUserNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error loading user company: %w", err)
+	}
+	if !companyID.Valid || companyID.String == "" {
+		return nil, errTenantNoCompany
+	}
+	tenant.CompanyID = companyID.String
+	if roleID.Valid {
+		tenant.RoleID = &roleID.String
+	}
+
+	branches, err := branchRepo.GetUserBranches(userID, tenant.CompanyID)
+	if err != nil {
+		return nil, fmt.Errorf("error loading user branches: %w", err)
+	}
+	tenant.BranchIDs = make([]string, len(branches))
+	for i, b := range branches {
+		tenant.BranchIDs[i] = b.ID
+	}
+
+	tenant.Roles, err = roleRepo.GetUserRoles(userID, tenant.CompanyID)
+	if err != nil {
+		return nil, err
+	}
+	tenant.Permissions, err = roleRepo.GetUserPermissions(userID, tenant.CompanyID)
+	if err != nil {
+		return nil, err
+	}
+	tenant.Scopes, err = roleRepo.GetUserPermissionScopes(userID, tenant.CompanyID)
+	if err != nil {
+		return nil, err
+	}
+	tenant.BranchRoles, err = roleRepo.GetUserBranchRoles(userID, tenant.CompanyID)
+	if err != nil {
+		return nil, err
+	}
+	tenant.TeacherID, err = teacherRepo.GetIDByUser(userID, tenant.CompanyID)
+	if err != nil {
+		return nil, err
+	}
+	tenant.TwoFactorRequired, err = roleRepo.IsTwoFactorRequired(userID, tenant.CompanyID)
+	if err != nil {
+		return nil, err
+	}
+	twoFactor, err := twoFactorRepo.Get(userID)
+	if err != nil {
+		return nil, err
+	}
+	tenant.TwoFactorEnabled = twoFactor != nil && twoFactor.EnabledAt != nil
+	return tenant, nil
+}
+
+// ResolveTenantContext loads the tenant context of any user, bypassing the request cache.
+// Used to inspect other users' effective permissions.
+func ResolveTenantContext(db *sql.DB, userID int) (*TenantContext, error) {
+	return loadTenantContext(db, repository.NewRoleRepository(db), repository.NewBranchRepository(db), repository.NewTeacherRepository(db), repository.NewTwoFactorRepository(db), userID)
+}
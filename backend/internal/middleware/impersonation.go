@@ -0,0 +1,27 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+)
+
+// ImpersonationRestricted is returned with 403 when an impersonation session tries to change
+// how the user signs in
+const ImpersonationRestricted = "impersonation_restricted"
+
+// impersonationBlocked lists what a platform admin signed in as a user may not do: change the
+// user's password, email or second factor, or close the user's other sessions. Signing out
+// ends the impersonation and stays allowed.
+func impersonationBlocked(method, path string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return false
+	}
+	switch {
+	case path == "/api/auth/password/change", path == "/api/auth/email/change":
+		return true
+	case strings.HasPrefix(path, "/api/auth/2fa"), strings.HasPrefix(path, "/api/auth/sessions"):
+		return true
+	}
+	return false
+}
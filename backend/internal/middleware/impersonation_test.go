@@ -0,0 +1,50 @@
+package middleware
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestImpersonationBlocked(t *testing.T) {
+	cases := []struct {
+		method, path string
+		want         bool
+	}{
+		{http.MethodGet, "/api/auth/sessions", false},
+		{http.MethodGet, "/api/auth/2fa", false},
+		{http.MethodPost, "/api/students", false},
+		{http.MethodPost, "/api/auth/logout", false},
+		{http.MethodPost, "/api/auth/password/change", true},
+		{http.MethodPost, "/api/auth/email/change", true},
+		{http.MethodPost, "/api/auth/2fa/disable", true},
+		{http.MethodPost, "/api/auth/2fa/verify", true},
+		{http.MethodDelete, "/api/auth/sessions", true},
+		{http.MethodDelete, "/api/auth/sessions/s1", true},
+	}
+	for _, tc := range cases {
+		if got := impersonationBlocked(tc.method, tc.path); got != tc.want {
+			t.Errorf("impersonationBlocked(%s %s) = %v, want %v", tc.method, tc.path, got, tc.want)
+		}
+	}
+}
+
+func TestGenerateImpersonationToken(t *testing.T) {
+	t.Setenv("JWT_SECRET", "test-secret")
+
+	expiresAt := time.Now().Add(30 * time.Minute)
+	token, err := GenerateImpersonationToken(7, "user@example.com", "s1", 3, expiresAt)
+	if err != nil {
+		t.Fatalf("GenerateImpersonationToken: %v", err)
+	}
+	claims, err := ValidateAccessToken(token)
+	if err != nil {
+		t.Fatalf("ValidateAccessToken: %v", err)
+	}
+	if claims.UserID != 7 || claims.SessionID != "s1" || claims.ContextVersion != 3 {
+		t.Errorf("claims = %+v, want user 7, session s1, version 3", claims)
+	}
+	if diff := claims.ExpiresAt.Time.Sub(expiresAt); diff > time.Second || diff < -time.Second {
+		t.Errorf("token expires at %v, want %v", claims.ExpiresAt.Time, expiresAt)
+	}
+}
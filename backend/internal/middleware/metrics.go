@@ -27,6 +27,14 @@ var (
 		[]string{"method", "endpoint"},
 	)
 
+	tenantCacheRequests = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "tenant_context_cache_requests_total",
+			Help: "Tenant context cache lookups in CompanyMiddleware by result (hit or miss)",
+		},
+		[]string{"result"},
+	)
+
 	activeUsers = promauto.NewGauge(
 		prometheus.GaugeOpts{
 			Name: "active_users",
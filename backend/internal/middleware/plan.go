@@ -0,0 +1,83 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Error codes returned with 403 so clients can explain why an action is not available
+const (
+	CompanyReadOnly        = "company_read_only"
+	PlanFeatureUnavailable = "plan_feature_unavailable"
+	PlanLimitReached       = "plan_limit_reached"
+	PlatformAdminRequired  = "platform_admin_required"
+)
+
+// readOnlyExempt lists what users of a suspended company can still do besides reading: manage
+// their own sign-in (logout, password, email, 2FA, sessions), switch branches, and the platform
+// endpoints, which act on other companies
+func readOnlyExempt(method, path string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	}
+	switch {
+	case path == "/api/auth/logout", path == "/api/auth/password/change", path == "/api/auth/email/change",
+		path == "/api/branches/switch":
+		return true
+	case strings.HasPrefix(path, "/api/auth/2fa"):
+		return path != "/api/auth/2fa/policy"
+	case strings.HasPrefix(path, "/api/auth/sessions"), strings.HasPrefix(path, "/api/platform/"):
+		return true
+	}
+	return false
+}
+
+// HasPlanFeature reports whether the plan of the user's company includes a feature
+// (plan_features, set by CompanyMiddleware)
+func HasPlanFeature(c *gin.Context, feature string) bool {
+	if features, ok := c.Get("plan_features"); ok {
+		list, _ := features.([]string)
+		for _, f := range list {
+			if f == feature {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// RequirePlanFeature guards features that only some plans include. Must run after CompanyMiddleware.
+func RequirePlanFeature(feature string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !HasPlanFeature(c, feature) {
+			c.JSON(http.StatusForbidden, gin.H{
+				"error":   "Your plan does not include this feature",
+				"code":    PlanFeatureUnavailable,
+				"feature": feature,
+			})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// RequirePlatformAdmin guards the platform endpoints, which work across companies. Platform
+// admins are flagged in the database (users.is_platform_admin); company roles do not grant it.
+// Must run after CompanyMiddleware.
+func RequirePlatformAdmin() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !c.GetBool("platform_admin") {
+			c.JSON(http.StatusForbidden, gin.H{
+				"error": "Platform administrator access required",
+				"code":  PlatformAdminRequired,
+			})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,82 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestReadOnlyExempt(t *testing.T) {
+	cases := []struct {
+		method, path string
+		want         bool
+	}{
+		{http.MethodGet, "/api/students", true},
+		{http.MethodHead, "/api/students", true},
+		{http.MethodPost, "/api/students", false},
+		{http.MethodPut, "/api/settings", false},
+		{http.MethodDelete, "/api/students/s1", false},
+		{http.MethodPost, "/api/auth/logout", true},
+		{http.MethodPost, "/api/auth/password/change", true},
+		{http.MethodPost, "/api/auth/2fa/enable", true},
+		{http.MethodPut, "/api/auth/2fa/policy", false},
+		{http.MethodDelete, "/api/auth/sessions/3", true},
+		{http.MethodPost, "/api/auth/invite", false},
+		{http.MethodPost, "/api/branches/switch", true},
+		{http.MethodPut, "/api/platform/companies/c1/plan", true},
+	}
+	for _, tc := range cases {
+		if got := readOnlyExempt(tc.method, tc.path); got != tc.want {
+			t.Errorf("readOnlyExempt(%s %s) = %v, want %v", tc.method, tc.path, got, tc.want)
+		}
+	}
+}
+
+func TestRequirePlanFeature(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	run := func(features interface{}) int {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodGet, "/api/export/students/pdf", nil)
+		if features != nil {
+			c.Set("plan_features", features)
+		}
+		RequirePlanFeature("exports")(c)
+		if c.IsAborted() {
+			return w.Code
+		}
+		return http.StatusOK
+	}
+
+	if code := run(nil); code != http.StatusForbidden {
+		t.Errorf("no plan features: status %d, want 403", code)
+	}
+	if code := run([]string{"migration"}); code != http.StatusForbidden {
+		t.Errorf("other feature: status %d, want 403", code)
+	}
+	if code := run([]string{"migration", "exports"}); code != http.StatusOK {
+		t.Errorf("feature included: status %d, want 200", code)
+	}
+}
+
+func TestRequirePlatformAdmin(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	for admin, want := range map[bool]int{false: http.StatusForbidden, true: http.StatusOK} {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodGet, "/api/platform/plans", nil)
+		c.Set("platform_admin", admin)
+		RequirePlatformAdmin()(c)
+		code := http.StatusOK
+		if c.IsAborted() {
+			code = w.Code
+		}
+		if code != want {
+			t.Errorf("platform_admin=%v: status %d, want %d", admin, code, want)
+		}
+	}
+}
@@ -75,21 +75,10 @@ func (rl *RateLimiter) cleanup() {
 	}
 }
 
-// getClientIP extracts client IP from request
+// getClientIP extracts client IP from request. Gin only honours X-Forwarded-For and
+// X-Real-IP when the request comes from a trusted proxy (see TrustedProxies); otherwise
+// the TCP peer address is used, so rotating the headers does not bypass the limits.
 func getClientIP(c *gin.Context) string {
-	// Check X-Forwarded-For header (for proxies)
-	forwarded := c.GetHeader("X-Forwarded-For")
-	if forwarded != "" {
-		return forwarded
-	}
-
-	// Check X-Real-IP header
-	realIP := c.GetHeader("X-Real-IP")
-	if realIP != "" {
-		return realIP
-	}
-
-	// Fallback to remote address
 	return c.ClientIP()
 }
 
@@ -115,22 +104,44 @@ func RateLimitMiddleware(requestsPerSecond rate.Limit, burst int) gin.HandlerFun
 	}
 }
 
+// accountSecurityPaths are the password and email flows covered by the account limiter
+var accountSecurityPaths = map[string]bool{
+	"/api/auth/password/forgot": true,
+	"/api/auth/password/reset":  true,
+	"/api/auth/password/change": true,
+	"/api/auth/email/change":    true,
+	"/api/auth/email/confirm":   true,
+}
+
+// twoFactorCodePaths take TOTP or recovery codes from signed-in users and share the login limiter
+var twoFactorCodePaths = map[string]bool{
+	"/api/auth/2fa/verify":         true,
+	"/api/auth/2fa/disable":        true,
+	"/api/auth/2fa/recovery-codes": true,
+}
+
 // AuthRateLimitMiddleware creates a stricter rate limiter for auth endpoints
-// 5 requests per minute for login, 3 per hour for registration
+// 5 requests per minute for login and two-factor codes, 3 per hour for registration,
+// 5 per 15 minutes for password and email flows. Create it once and attach the same instance to protected
+// account routes so that they share the limits.
 func AuthRateLimitMiddleware() gin.HandlerFunc {
 	// Different limiters for different endpoints
 	loginLimiter := NewRateLimiter(rate.Every(12*time.Second), 5)    // 5 per minute
 	registerLimiter := NewRateLimiter(rate.Every(20*time.Minute), 3) // 3 per hour
+	accountLimiter := NewRateLimiter(rate.Every(3*time.Minute), 5)   // 5 per 15 minutes
 
 	return func(c *gin.Context) {
 		ip := getClientIP(c)
 		path := c.Request.URL.Path
 
 		var limiter *rate.Limiter
-		if path == "/api/auth/login" || path == "/api/auth/verify-email" {
+		if path == "/api/auth/login" || path == "/api/auth/login/2fa" || path == "/api/auth/verify-email" ||
+			path == "/api/auth/sso/discover" || path == "/api/auth/sso/exchange" || twoFactorCodePaths[path] {
 			limiter = loginLimiter.getLimiter(ip)
 		} else if path == "/api/auth/register" {
 			limiter = registerLimiter.getLimiter(ip)
+		} else if accountSecurityPaths[path] {
+			limiter = accountLimiter.getLimiter(ip)
 		} else {
 			// No rate limit for other auth endpoints
 			c.Next()
@@ -0,0 +1,122 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestAuthRateLimitCoversAccountFlows(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	limit := AuthRateLimitMiddleware()
+	ok := func(c *gin.Context) { c.Status(http.StatusOK) }
+	router.POST("/api/auth/password/forgot", limit, ok)
+	router.POST("/api/auth/password/change", limit, ok)
+	router.POST("/api/auth/accept-invite", limit, ok)
+
+	post := func(path, ip string) int {
+		req := httptest.NewRequest(http.MethodPost, path, nil)
+		req.RemoteAddr = ip + ":40000"
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	// Password and email flows share one budget per client
+	for i := 0; i < 5; i++ {
+		path := "/api/auth/password/forgot"
+		if i%2 == 1 {
+			path = "/api/auth/password/change"
+		}
+		if code := post(path, "203.0.113.7"); code != http.StatusOK {
+			t.Fatalf("request %d: status %d, want 200", i+1, code)
+		}
+	}
+	if code := post("/api/auth/password/change", "203.0.113.7"); code != http.StatusTooManyRequests {
+		t.Errorf("6th request: status %d, want 429", code)
+	}
+	if code := post("/api/auth/password/forgot", "203.0.113.8"); code != http.StatusOK {
+		t.Errorf("other client: status %d, want 200", code)
+	}
+
+	// Endpoints without a limit are not affected
+	for i := 0; i < 10; i++ {
+		if code := post("/api/auth/accept-invite", "203.0.113.7"); code != http.StatusOK {
+			t.Fatalf("unlimited endpoint: status %d", code)
+		}
+	}
+}
+
+func TestAuthRateLimitCoversTwoFactorCodes(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	limit := AuthRateLimitMiddleware()
+	ok := func(c *gin.Context) { c.Status(http.StatusOK) }
+	for path := range twoFactorCodePaths {
+		router.POST(path, limit, ok)
+	}
+
+	post := func(path string) int {
+		req := httptest.NewRequest(http.MethodPost, path, nil)
+		req.RemoteAddr = "203.0.113.7:40000"
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	// Step-up, disable and recovery codes draw on one budget, so guesses cannot be spread over them
+	paths := []string{"/api/auth/2fa/verify", "/api/auth/2fa/disable", "/api/auth/2fa/recovery-codes"}
+	for i := 0; i < 5; i++ {
+		if code := post(paths[i%len(paths)]); code != http.StatusOK {
+			t.Fatalf("request %d: status %d, want 200", i+1, code)
+		}
+	}
+	for _, path := range paths {
+		if code := post(path); code != http.StatusTooManyRequests {
+			t.Errorf("%s after 5 codes: status %d, want 429", path, code)
+		}
+	}
+}
+
+func TestAuthRateLimitIgnoresSpoofedForwardedFor(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	t.Setenv("TRUSTED_PROXIES", "10.0.0.0/8")
+	router := gin.New()
+	// Same setup as cmd/api
+	if err := router.SetTrustedProxies(TrustedProxies()); err != nil {
+		t.Fatal(err)
+	}
+	router.POST("/api/auth/login", AuthRateLimitMiddleware(), func(c *gin.Context) { c.String(http.StatusOK, c.ClientIP()) })
+
+	post := func(peer, forwardedFor string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/auth/login", nil)
+		req.RemoteAddr = peer + ":40000"
+		req.Header.Set("X-Forwarded-For", forwardedFor)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	// An untrusted peer cannot pick its address by rotating X-Forwarded-For
+	for i := 0; i < 5; i++ {
+		w := post("203.0.113.7", fmt.Sprintf("198.51.100.%d", i))
+		if w.Code != http.StatusOK {
+			t.Fatalf("request %d: status %d, want 200", i+1, w.Code)
+		}
+		if w.Body.String() != "203.0.113.7" {
+			t.Errorf("request %d: client IP %q, want the peer address", i+1, w.Body.String())
+		}
+	}
+	if w := post("203.0.113.7", "198.51.100.99"); w.Code != http.StatusTooManyRequests {
+		t.Errorf("6th request with a new X-Forwarded-For: status %d, want 429", w.Code)
+	}
+
+	// A trusted proxy reports the client address
+	if w := post("10.0.0.5", "198.51.100.20"); w.Code != http.StatusOK || w.Body.String() != "198.51.100.20" {
+		t.Errorf("trusted proxy: status %d, client IP %q, want 200 and 198.51.100.20", w.Code, w.Body.String())
+	}
+}
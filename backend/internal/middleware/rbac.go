@@ -4,12 +4,14 @@ import (
 	"database/sql"
 	"net/http"
 
+	"classmate-central/internal/models"
 	"classmate-central/internal/repository"
 
 	"github.com/gin-gonic/gin"
 )
 
-// GetUserPermissions retrieves permissions from context (set by AuthMiddleware)
+// GetUserPermissions retrieves the effective permissions for the current branch
+// from context (set by CompanyMiddleware)
 func GetUserPermissions(c *gin.Context) []string {
 	permissions, exists := c.Get("permissions")
 	if !exists {
@@ -33,6 +35,17 @@ func HasPermission(c *gin.Context, permissionName string) bool {
 	return false
 }
 
+// DataScope returns the data scope of a permission in the current branch (all, branch or own)
+// from context (set by CompanyMiddleware). Permissions without a scope are branch scoped.
+func DataScope(c *gin.Context, permissionName string) string {
+	if scopes, ok := c.Get("permission_scopes"); ok {
+		if m, ok := scopes.(map[string]string); ok && m[permissionName] != "" {
+			return m[permissionName]
+		}
+	}
+	return models.ScopeBranch
+}
+
 // RequirePermission middleware checks if user has a specific permission
 func RequirePermission(resource, action string) gin.HandlerFunc {
 	permissionName := resource + "." + action
@@ -0,0 +1,151 @@
+package middleware
+
+import (
+	"sync"
+
+	"classmate-central/internal/models"
+)
+
+// defaultTenantCacheSize bounds the number of users kept in the tenant context cache
+const defaultTenantCacheSize = 10000
+
+// Sources of effective permissions, see TenantContext.EffectivePermissions
+const (
+	PermissionSourceBranchRole   = "branch_role"
+	PermissionSourceCompanyRoles = "company_roles"
+	PermissionSourceCompanyAdmin = "company_admin"
+)
+
+// TenantContext is everything CompanyMiddleware resolves about a user: the company,
+// accessible branches, roles and permissions. It is valid for one context version.
+type TenantContext struct {
+	CompanyID   string
+	RoleID      *string
+	BranchIDs   []string // Accessible branches; empty when the user has none yet
+	Roles       []*models.Role
+	Permissions []string                           // Union of the company-wide roles (user_roles)
+	Scopes      map[string]string                  // Widest data scope of each company-wide permission
+	BranchRoles map[string]*models.BranchRoleGrant // Role bound to each branch assignment, by branch ID
+	TeacherID   string                             // Teacher linked to the user; "" when none
+	Version     int                                // users.context_version the entry was loaded at
+
+	TwoFactorRequired bool // One of the user's roles requires 2FA (company policy)
+	TwoFactorEnabled  bool // The user has confirmed a 2FA enrollment
+
+	CompanyStatus string   // active, suspended or inactive
+	PlanFeatures  []string // Features of the company's plan
+	PlatformAdmin bool     // users.is_platform_admin, outside company RBAC
+}
+
+// ReadOnly reports whether the company is suspended and may only read its data
+func (t *TenantContext) ReadOnly() bool {
+	return t.CompanyStatus == models.CompanyStatusSuspended
+}
+
+// IsAdmin reports whether the user holds the company-wide admin role
+func (t *TenantContext) IsAdmin() bool {
+	for _, role := range t.Roles {
+		if role.Name == "admin" {
+			return true
+		}
+	}
+	return false
+}
+
+// EffectivePermissions returns what the user may do in a branch. A role bound to the
+// branch assignment replaces the company-wide roles there; company admins and branches
+// without a bound role use the company-wide permissions.
+func (t *TenantContext) EffectivePermissions(branchID string) ([]string, string, *models.BranchRoleGrant) {
+	if t.IsAdmin() {
+		return t.Permissions, PermissionSourceCompanyAdmin, nil
+	}
+	if grant, ok := t.BranchRoles[branchID]; ok {
+		return grant.Permissions, PermissionSourceBranchRole, grant
+	}
+	return t.Permissions, PermissionSourceCompanyRoles, nil
+}
+
+// PermissionScopes returns the data scope of each effective permission in a branch,
+// taken from the same source as EffectivePermissions.
+func (t *TenantContext) PermissionScopes(branchID string) map[string]string {
+	if !t.IsAdmin() {
+		if grant, ok := t.BranchRoles[branchID]; ok {
+			return grant.Scopes
+		}
+	}
+	return t.Scopes
+}
+
+// HasBranch reports whether the branch is accessible
+func (t *TenantContext) HasBranch(branchID string) bool {
+	for _, id := range t.BranchIDs {
+		if id == branchID {
+			return true
+		}
+	}
+	return false
+}
+
+// TenantContextCache keeps resolved tenant contexts keyed by user ID. An entry is only
+// returned for the exact context version it was loaded at; any role, branch or permission
+// change bumps the version in the database and makes the entry a miss.
+type TenantContextCache struct {
+	mu         sync.RWMutex
+	entries    map[int]*TenantContext
+	maxEntries int
+}
+
+func NewTenantContextCache(maxEntries int) *TenantContextCache {
+	if maxEntries <= 0 {
+		maxEntries = defaultTenantCacheSize
+	}
+	return &TenantContextCache{
+		entries:    make(map[int]*TenantContext),
+		maxEntries: maxEntries,
+	}
+}
+
+// Get returns the cached context of a user if it was loaded at the given version
+func (c *TenantContextCache) Get(userID, version int) (*TenantContext, bool) {
+	c.mu.RLock()
+	entry, ok := c.entries[userID]
+	c.mu.RUnlock()
+
+	if ok && entry.Version == version {
+		tenantCacheRequests.WithLabelValues("hit").Inc()
+		return entry, true
+	}
+	if ok {
+		c.Invalidate(userID)
+	}
+	tenantCacheRequests.WithLabelValues("miss").Inc()
+	return nil, false
+}
+
+// Set stores the context of a user, evicting an arbitrary entry when the cache is full
+func (c *TenantContextCache) Set(userID int, entry *TenantContext) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, exists := c.entries[userID]; !exists && len(c.entries) >= c.maxEntries {
+		for id := range c.entries {
+			delete(c.entries, id)
+			break
+		}
+	}
+	c.entries[userID] = entry
+}
+
+// Invalidate drops the cached context of a user
+func (c *TenantContextCache) Invalidate(userID int) {
+	c.mu.Lock()
+	delete(c.entries, userID)
+	c.mu.Unlock()
+}
+
+// Len returns the number of cached users
+func (c *TenantContextCache) Len() int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return len(c.entries)
+}
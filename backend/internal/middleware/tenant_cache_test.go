@@ -0,0 +1,110 @@
+package middleware
+
+import (
+	"testing"
+
+	"classmate-central/internal/models"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestTenantContextCacheVersioning(t *testing.T) {
+	cache := NewTenantContextCache(10)
+	hits := testutil.ToFloat64(tenantCacheRequests.WithLabelValues("hit"))
+	misses := testutil.ToFloat64(tenantCacheRequests.WithLabelValues("miss"))
+
+	if _, ok := cache.Get(1, 1); ok {
+		t.Fatal("empty cache returned an entry")
+	}
+	cache.Set(1, &TenantContext{CompanyID: "c1", BranchIDs: []string{"b1"}, Version: 1})
+
+	entry, ok := cache.Get(1, 1)
+	if !ok || entry.CompanyID != "c1" || !entry.HasBranch("b1") || entry.HasBranch("b2") {
+		t.Fatalf("unexpected entry %+v", entry)
+	}
+
+	// A bumped version (role, branch or permission change) must not be served from cache
+	if _, ok := cache.Get(1, 2); ok {
+		t.Fatal("stale entry returned for a newer version")
+	}
+	if cache.Len() != 0 {
+		t.Fatal("stale entry was not invalidated")
+	}
+
+	if got := testutil.ToFloat64(tenantCacheRequests.WithLabelValues("hit")) - hits; got != 1 {
+		t.Errorf("hits = %v, want 1", got)
+	}
+	if got := testutil.ToFloat64(tenantCacheRequests.WithLabelValues("miss")) - misses; got != 2 {
+		t.Errorf("misses = %v, want 2", got)
+	}
+}
+
+func TestTenantContextCacheBounded(t *testing.T) {
+	cache := NewTenantContextCache(2)
+	for userID := 1; userID <= 5; userID++ {
+		cache.Set(userID, &TenantContext{Version: 1})
+	}
+	if cache.Len() != 2 {
+		t.Fatalf("cache holds %d entries, want 2", cache.Len())
+	}
+	if _, ok := cache.Get(5, 1); !ok {
+		t.Error("most recently set entry was evicted")
+	}
+}
+
+func TestEffectivePermissionsPerBranch(t *testing.T) {
+	tenant := &TenantContext{
+		BranchIDs:   []string{"north", "south", "east"},
+		Roles:       []*models.Role{{Name: "manager"}, {Name: "teacher"}},
+		Permissions: []string{"finance.view", "lessons.view"},
+		BranchRoles: map[string]*models.BranchRoleGrant{
+			"north": {BranchID: "north", RoleID: "r-manager", Permissions: []string{"finance.view"}},
+			"south": {BranchID: "south", RoleID: "r-teacher", Permissions: []string{"lessons.view"}},
+		},
+	}
+
+	perms, source, grant := tenant.EffectivePermissions("south")
+	if source != PermissionSourceBranchRole || grant == nil || grant.RoleID != "r-teacher" {
+		t.Fatalf("south: source %q grant %+v", source, grant)
+	}
+	if len(perms) != 1 || perms[0] != "lessons.view" {
+		t.Errorf("teacher branch must not get the manager's permissions, got %v", perms)
+	}
+
+	// No role bound to the assignment: company-wide roles apply
+	perms, source, _ = tenant.EffectivePermissions("east")
+	if source != PermissionSourceCompanyRoles || len(perms) != 2 {
+		t.Errorf("east: source %q perms %v", source, perms)
+	}
+
+	// Company admins are never narrowed by branch roles
+	tenant.Roles = append(tenant.Roles, &models.Role{Name: "admin"})
+	perms, source, _ = tenant.EffectivePermissions("south")
+	if source != PermissionSourceCompanyAdmin || len(perms) != 2 {
+		t.Errorf("admin: source %q perms %v", source, perms)
+	}
+}
+
+func TestPermissionScopesFollowEffectiveRole(t *testing.T) {
+	tenant := &TenantContext{
+		Roles:  []*models.Role{{Name: "manager"}},
+		Scopes: map[string]string{"students.view": models.ScopeAll},
+		BranchRoles: map[string]*models.BranchRoleGrant{
+			"south": {BranchID: "south", Scopes: map[string]string{"students.view": models.ScopeOwn}},
+		},
+	}
+
+	if got := tenant.PermissionScopes("north")["students.view"]; got != models.ScopeAll {
+		t.Errorf("north: scope %q, want all", got)
+	}
+	if got := tenant.PermissionScopes("south")["students.view"]; got != models.ScopeOwn {
+		t.Errorf("south: scope %q, want own from the branch role", got)
+	}
+
+	if got := models.WiderScope(models.ScopeOwn, models.ScopeBranch); got != models.ScopeBranch {
+		t.Errorf("WiderScope(own, branch) = %q", got)
+	}
+	if got := models.WiderScope("", models.ScopeOwn); got != models.ScopeOwn {
+		t.Errorf("WiderScope(\"\", own) = %q", got)
+	}
+}
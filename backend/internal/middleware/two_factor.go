@@ -0,0 +1,59 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Error codes returned with 403 so clients know which 2FA screen to show
+const (
+	TwoFactorSetupRequired  = "two_factor_setup_required"
+	TwoFactorStepUpRequired = "two_factor_step_up_required"
+)
+
+const defaultTwoFactorStepUpTTL = 10 * time.Minute
+
+// TwoFactorStepUpTTL returns how long a 2FA confirmation unlocks sensitive actions
+// (TWO_FACTOR_STEP_UP_TTL, default 10m)
+func TwoFactorStepUpTTL() time.Duration {
+	return durationFromEnv("TWO_FACTOR_STEP_UP_TTL", defaultTwoFactorStepUpTTL)
+}
+
+// twoFactorSetupExempt lists what a user who must enable 2FA can still reach: the profile,
+// logout and the 2FA endpoints themselves
+func twoFactorSetupExempt(path string) bool {
+	return path == "/api/auth/me" || path == "/api/auth/logout" || strings.HasPrefix(path, "/api/auth/2fa")
+}
+
+// stepUpFresh reports whether a 2FA confirmation at verifiedAt is still recent enough
+func stepUpFresh(verifiedAt time.Time, now time.Time, ttl time.Duration) bool {
+	return !verifiedAt.IsZero() && !verifiedAt.After(now) && now.Sub(verifiedAt) <= ttl
+}
+
+// RequireTwoFactorStepUp guards sensitive actions: the user must have 2FA enabled and the
+// session must have confirmed a code within TwoFactorStepUpTTL (at login or via /auth/2fa/verify).
+// Must run after AuthMiddleware and CompanyMiddleware.
+func RequireTwoFactorStepUp() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !c.GetBool("two_factor_enabled") {
+			c.JSON(http.StatusForbidden, gin.H{
+				"error": "Two-factor authentication must be enabled for this action",
+				"code":  TwoFactorSetupRequired,
+			})
+			c.Abort()
+			return
+		}
+		if !stepUpFresh(c.GetTime("two_factor_verified_at"), time.Now(), TwoFactorStepUpTTL()) {
+			c.JSON(http.StatusForbidden, gin.H{
+				"error": "Confirm this action with a two-factor code",
+				"code":  TwoFactorStepUpRequired,
+			})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,79 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestStepUpFresh(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	ttl := 10 * time.Minute
+
+	cases := []struct {
+		name       string
+		verifiedAt time.Time
+		want       bool
+	}{
+		{"never verified", time.Time{}, false},
+		{"just verified", now.Add(-time.Minute), true},
+		{"at the limit", now.Add(-ttl), true},
+		{"expired", now.Add(-ttl - time.Second), false},
+		{"in the future", now.Add(time.Minute), false},
+	}
+	for _, tc := range cases {
+		if got := stepUpFresh(tc.verifiedAt, now, ttl); got != tc.want {
+			t.Errorf("%s: stepUpFresh = %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestTwoFactorSetupExempt(t *testing.T) {
+	for path, want := range map[string]bool{
+		"/api/auth/me":        true,
+		"/api/auth/logout":    true,
+		"/api/auth/2fa":       true,
+		"/api/auth/2fa/setup": true,
+		"/api/students":       false,
+		"/api/auth/sessions":  false,
+	} {
+		if got := twoFactorSetupExempt(path); got != want {
+			t.Errorf("twoFactorSetupExempt(%q) = %v, want %v", path, got, want)
+		}
+	}
+}
+
+func TestRequireTwoFactorStepUp(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	run := func(enabled bool, verifiedAt time.Time) int {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodPost, "/api/migration/clear-data", nil)
+		c.Set("two_factor_enabled", enabled)
+		if !verifiedAt.IsZero() {
+			c.Set("two_factor_verified_at", verifiedAt)
+		}
+		RequireTwoFactorStepUp()(c)
+		if c.IsAborted() {
+			return w.Code
+		}
+		return http.StatusOK
+	}
+
+	if code := run(false, time.Now()); code != http.StatusForbidden {
+		t.Errorf("without 2FA: status %d, want 403", code)
+	}
+	if code := run(true, time.Time{}); code != http.StatusForbidden {
+		t.Errorf("never verified: status %d, want 403", code)
+	}
+	if code := run(true, time.Now().Add(-time.Hour)); code != http.StatusForbidden {
+		t.Errorf("stale verification: status %d, want 403", code)
+	}
+	if code := run(true, time.Now().Add(-time.Minute)); code != http.StatusOK {
+		t.Errorf("fresh verification: status %d, want 200", code)
+	}
+}
@@ -1,32 +1,234 @@
 package models
 
-import "time"
+import (
+	"encoding/json"
+	"time"
+
+	"classmate-central/internal/money"
+)
 
 // User represents authentication user
 type User struct {
-	ID                     int       `json:"id" db:"id"`
-	Email                  string    `json:"email" db:"email"`
-	Password               string    `json:"-" db:"password"`
-	Name                   string    `json:"name" db:"name"`
-	CompanyID              string    `json:"companyId" db:"company_id"`
-	RoleID                 *string   `json:"roleId,omitempty" db:"role_id"`
-	Roles                  []*Role   `json:"roles,omitempty"`           // Populated via JOIN
-	Permissions            []string  `json:"permissions,omitempty"`     // Populated from roles
-	Branches               []*Branch `json:"branches,omitempty"`        // User's accessible branches
-	CurrentBranchID        *string   `json:"currentBranchId,omitempty"` // Currently active branch
-	IsEmailVerified        bool      `json:"isEmailVerified" db:"is_email_verified"`
-	EmailVerificationToken *string   `json:"-" db:"email_verification_token"`
-	CreatedAt              time.Time `json:"created_at" db:"created_at"`
-	UpdatedAt              time.Time `json:"updated_at" db:"updated_at"`
+	ID                     int               `json:"id" db:"id"`
+	Email                  string            `json:"email" db:"email"`
+	Password               string            `json:"-" db:"password"`
+	Name                   string            `json:"name" db:"name"`
+	CompanyID              string            `json:"companyId" db:"company_id"`
+	RoleID                 *string           `json:"roleId,omitempty" db:"role_id"`
+	Roles                  []*Role           `json:"roles,omitempty"`            // Populated via JOIN
+	Permissions            []string          `json:"permissions,omitempty"`      // Populated from roles
+	PermissionScopes       map[string]string `json:"permissionScopes,omitempty"` // Data scope by permission name
+	TeacherID              *string           `json:"teacherId,omitempty"`        // Linked teacher record (data scope "own")
+	Branches               []*Branch         `json:"branches,omitempty"`         // User's accessible branches
+	CurrentBranchID        *string           `json:"currentBranchId,omitempty"`  // Currently active branch
+	TwoFactorEnabled       bool              `json:"twoFactorEnabled"`           // TOTP 2FA is enabled (reported by /auth/me)
+	TwoFactorRequired      bool              `json:"twoFactorRequired"`          // A role of the user requires 2FA
+	CompanyStatus          string            `json:"companyStatus,omitempty"`    // Suspended companies are read-only
+	PlanFeatures           []string          `json:"planFeatures,omitempty"`     // Features of the company's plan
+	PlatformAdmin          bool              `json:"platformAdmin"`              // May use the platform endpoints
+	ImpersonatedBy         *int              `json:"impersonatedBy,omitempty"`   // Platform admin signed in as this user
+	IsEmailVerified        bool              `json:"isEmailVerified" db:"is_email_verified"`
+	EmailVerificationToken *string           `json:"-" db:"email_verification_token"`
+	CreatedAt              time.Time         `json:"created_at" db:"created_at"`
+	UpdatedAt              time.Time         `json:"updated_at" db:"updated_at"`
 }
 
 // Company represents a company/tenant in the system
 type Company struct {
 	ID        string    `json:"id" db:"id"`
 	Name      string    `json:"name" db:"name"`
-	Status    string    `json:"status" db:"status"`
+	Status    string    `json:"status" db:"status"` // active, suspended, inactive
+	PlanID    string    `json:"planId" db:"plan_id"`
 	CreatedAt time.Time `json:"createdAt" db:"created_at"`
 	UpdatedAt time.Time `json:"updatedAt" db:"updated_at"`
+	// SuspendedAt and SuspensionReason are set while the company is suspended
+	SuspendedAt      *time.Time `json:"suspendedAt,omitempty" db:"suspended_at"`
+	SuspensionReason *string    `json:"suspensionReason,omitempty" db:"suspension_reason"`
+}
+
+// Company statuses. A suspended company can still sign in and read its data but cannot change it.
+const (
+	CompanyStatusActive    = "active"
+	CompanyStatusSuspended = "suspended"
+)
+
+// Resources limited by a plan
+const (
+	PlanResourceStudents = "students"
+	PlanResourceBranches = "branches"
+	PlanResourceUsers    = "users"
+	PlanResourceStorage  = "storage"
+)
+
+// Features a plan can include
+const (
+	PlanFeatureExports   = "exports"   // PDF/Excel/CSV exports
+	PlanFeatureMigration = "migration" // AlfaCRM migration and company archive import
+	PlanFeatureSSO       = "sso"       // Single sign-on configuration
+)
+
+// PlanFeatures lists every feature a plan can include
+var PlanFeatures = []string{PlanFeatureExports, PlanFeatureMigration, PlanFeatureSSO}
+
+// Plan caps what a company can create and lists the features it may use. A nil limit is unlimited.
+type Plan struct {
+	ID           string    `json:"id" db:"id"`
+	Name         string    `json:"name" db:"name"`
+	MaxStudents  *int      `json:"maxStudents" db:"max_students"`
+	MaxBranches  *int      `json:"maxBranches" db:"max_branches"`
+	MaxUsers     *int      `json:"maxUsers" db:"max_users"`
+	MaxStorageMB *int      `json:"maxStorageMb" db:"max_storage_mb"`
+	Features     []string  `json:"features" db:"features"`
+	Companies    int       `json:"companies"` // Companies on the plan
+	CreatedAt    time.Time `json:"createdAt" db:"created_at"`
+	UpdatedAt    time.Time `json:"updatedAt" db:"updated_at"`
+}
+
+// Limit returns the cap of a resource in its unit (storage in bytes), or nil if it is unlimited
+func (p *Plan) Limit(resource string) *int64 {
+	var limit *int
+	switch resource {
+	case PlanResourceStudents:
+		limit = p.MaxStudents
+	case PlanResourceBranches:
+		limit = p.MaxBranches
+	case PlanResourceUsers:
+		limit = p.MaxUsers
+	case PlanResourceStorage:
+		if p.MaxStorageMB != nil {
+			bytes := int64(*p.MaxStorageMB) * 1024 * 1024
+			return &bytes
+		}
+	}
+	if limit == nil {
+		return nil
+	}
+	value := int64(*limit)
+	return &value
+}
+
+// HasFeature reports whether the plan includes a feature
+func (p *Plan) HasFeature(feature string) bool {
+	for _, f := range p.Features {
+		if f == feature {
+			return true
+		}
+	}
+	return false
+}
+
+// UpdatePlanRequest replaces the limits and features of a plan
+type UpdatePlanRequest struct {
+	Name         string   `json:"name" binding:"required"`
+	MaxStudents  *int     `json:"maxStudents"`
+	MaxBranches  *int     `json:"maxBranches"`
+	MaxUsers     *int     `json:"maxUsers"`
+	MaxStorageMB *int     `json:"maxStorageMb"`
+	Features     []string `json:"features"`
+}
+
+// SetCompanyPlanRequest moves a company to another plan
+type SetCompanyPlanRequest struct {
+	PlanID string `json:"planId" binding:"required"`
+}
+
+// CompanyUsage is what a company used on a day, as measured by the usage metering job
+type CompanyUsage struct {
+	CompanyID    string    `json:"companyId" db:"company_id"`
+	Day          string    `json:"day" db:"day"` // YYYY-MM-DD
+	Students     int64     `json:"students" db:"students"`
+	Branches     int64     `json:"branches" db:"branches"`
+	Users        int64     `json:"users" db:"users"`
+	StorageBytes int64     `json:"storageBytes" db:"storage_bytes"`
+	MeasuredAt   time.Time `json:"measuredAt" db:"measured_at"`
+}
+
+// CompanyPlanUsage is a company's plan with its current usage and the metered history
+type CompanyPlanUsage struct {
+	Company *Company        `json:"company"`
+	Plan    *Plan           `json:"plan"`
+	Current *CompanyUsage   `json:"current"` // Counted now; storage is the last metered value
+	History []*CompanyUsage `json:"history"` // Newest first
+}
+
+// PlatformCompanyFilter narrows the platform company list; zero values match everything
+type PlatformCompanyFilter struct {
+	Search string // Company name or ID, or the email of one of its users
+	Status string
+	PlanID string
+	Limit  int
+	Offset int
+}
+
+// PlatformCompany is a company in the platform company list
+type PlatformCompany struct {
+	Company
+	PlanName       string        `json:"planName"`
+	Usage          *CompanyUsage `json:"usage"`                    // Counted now; storage is the last metered value
+	LastActivityAt *time.Time    `json:"lastActivityAt,omitempty"` // Last request of any of its users
+}
+
+// PlatformCompanyList is one page of the platform company list
+type PlatformCompanyList struct {
+	Companies []*PlatformCompany `json:"companies"`
+	Total     int                `json:"total"` // Companies matching the filter on all pages
+}
+
+// PlatformCompanyStats are the figures support looks at first
+type PlatformCompanyStats struct {
+	Teachers       int64 `json:"teachers"`
+	Groups         int64 `json:"groups"`
+	Leads          int64 `json:"leads"`
+	Lessons30Days  int64 `json:"lessons30Days"`  // Lessons scheduled in the last 30 days
+	Payments30Days int64 `json:"payments30Days"` // Payments received in the last 30 days
+	ActiveSessions int64 `json:"activeSessions"`
+}
+
+// PlatformCompanyUser is a user of a company as platform admins see it
+type PlatformCompanyUser struct {
+	ID            int        `json:"id"`
+	Name          string     `json:"name"`
+	Email         string     `json:"email"`
+	Roles         []string   `json:"roles"`
+	PlatformAdmin bool       `json:"platformAdmin"`
+	LastSeenAt    *time.Time `json:"lastSeenAt,omitempty"`
+}
+
+// PlatformCompanyDetails is a company with its plan, figures and users
+type PlatformCompanyDetails struct {
+	*PlatformCompany
+	Plan  *Plan                  `json:"plan"`
+	Stats *PlatformCompanyStats  `json:"stats"`
+	Users []*PlatformCompanyUser `json:"users"`
+}
+
+// SuspendCompanyRequest makes a company read-only
+type SuspendCompanyRequest struct {
+	Reason string `json:"reason" binding:"required"`
+}
+
+// ImpersonateRequest opens a support session as a user of a company
+type ImpersonateRequest struct {
+	UserID int    `json:"userId" binding:"required"`
+	Reason string `json:"reason" binding:"required"` // Recorded in the company's audit log
+}
+
+// ImpersonationResponse is the access token of an impersonation session. There is no refresh
+// token: the session ends when the token expires.
+type ImpersonationResponse struct {
+	AccessToken string               `json:"accessToken"`
+	ExpiresAt   time.Time            `json:"expiresAt"`
+	SessionID   string               `json:"sessionId"`
+	User        *PlatformCompanyUser `json:"user"`
+}
+
+// MaintenanceRun is the outcome of a maintenance job run for one company
+type MaintenanceRun struct {
+	Job        string                 `json:"job"`
+	CompanyID  string                 `json:"companyId"`
+	StartedAt  time.Time              `json:"startedAt"`
+	FinishedAt time.Time              `json:"finishedAt"`
+	Result     map[string]interface{} `json:"result"`
 }
 
 // Branch represents a branch/location of a company
@@ -63,6 +265,7 @@ type Teacher struct {
 	Workload  int    `json:"workload" db:"workload"`
 	CompanyID string `json:"companyId" db:"company_id"`
 	BranchID  string `json:"branchId" db:"branch_id"`
+	UserID    *int   `json:"userId,omitempty" db:"user_id"` // User account of the teacher (data scope "own")
 }
 
 // Student represents a student in the system
@@ -226,59 +429,169 @@ type LeadConversionStats struct {
 	ConversionRate  float64 `json:"conversionRate"`
 }
 
+// ============= CURRENCY MODULE =============
+
+// ExchangeRate is a manually maintained conversion rate effective from a date
+type ExchangeRate struct {
+	ID            int            `json:"id" db:"id"`
+	FromCurrency  money.Currency `json:"fromCurrency" db:"from_currency"`
+	ToCurrency    money.Currency `json:"toCurrency" db:"to_currency"`
+	Rate          money.Rate     `json:"rate" db:"rate"` // units of ToCurrency for one unit of FromCurrency
+	EffectiveDate time.Time      `json:"effectiveDate" db:"effective_date"`
+	CreatedBy     *int           `json:"createdBy,omitempty" db:"created_by"`
+	CreatedAt     time.Time      `json:"createdAt" db:"created_at"`
+	CompanyID     string         `json:"companyId" db:"company_id"`
+}
+
+// BranchCurrency is the currency configuration of a branch
+type BranchCurrency struct {
+	BranchID          string          `json:"branchId"`
+	BranchName        string          `json:"branchName"`
+	Currency          *money.Currency `json:"currency,omitempty"` // override, nil = company base currency
+	EffectiveCurrency money.Currency  `json:"effectiveCurrency"`
+}
+
+// CurrencySettings is the currency configuration of a company
+type CurrencySettings struct {
+	BaseCurrency money.Currency   `json:"baseCurrency"`
+	Supported    []money.Currency `json:"supported"`
+	Branches     []BranchCurrency `json:"branches"`
+}
+
+// UpdateCurrencyRequest sets the base currency of a company or the currency of a branch
+type UpdateCurrencyRequest struct {
+	Currency string `json:"currency"` // empty for a branch resets it to the company base currency
+}
+
+// CreateExchangeRateRequest represents a request to add an exchange rate
+type CreateExchangeRateRequest struct {
+	FromCurrency  string     `json:"fromCurrency" binding:"required"`
+	ToCurrency    string     `json:"toCurrency" binding:"required"`
+	Rate          money.Rate `json:"rate"`
+	EffectiveDate string     `json:"effectiveDate" binding:"required"` // YYYY-MM-DD
+}
+
 // ============= FINANCE MODULE =============
 
 // PaymentTransaction represents a payment transaction
 type PaymentTransaction struct {
-	ID            int       `json:"id" db:"id"`
-	StudentID     string    `json:"studentId" db:"student_id"`
-	Amount        float64   `json:"amount" db:"amount"`
-	Type          string    `json:"type" db:"type"`                    // payment, refund, debt
-	PaymentMethod string    `json:"paymentMethod" db:"payment_method"` // cash, card, transfer, other
-	Description   string    `json:"description" db:"description"`
-	CreatedAt     time.Time `json:"createdAt" db:"created_at"`
-	CreatedBy     *int      `json:"createdBy,omitempty" db:"created_by"`
-	CompanyID     string    `json:"companyId" db:"company_id"`
-	BranchID      string    `json:"branchId" db:"branch_id"`
+	ID            int            `json:"id" db:"id"`
+	StudentID     string         `json:"studentId" db:"student_id"`
+	Amount        money.Money    `json:"amount" db:"amount"`
+	Type          string         `json:"type" db:"type"`                    // payment, refund, debt
+	PaymentMethod string         `json:"paymentMethod" db:"payment_method"` // cash, card, transfer, other
+	Description   string         `json:"description" db:"description"`
+	CreatedAt     time.Time      `json:"createdAt" db:"created_at"`
+	CreatedBy     *int           `json:"createdBy,omitempty" db:"created_by"`
+	CompanyID     string         `json:"companyId" db:"company_id"`
+	BranchID      string         `json:"branchId" db:"branch_id"`
+	ShiftID       *int           `json:"shiftId,omitempty" db:"shift_id"` // cash shift the payment was collected in
+	Currency      money.Currency `json:"currency" db:"currency"`
+	FiscalNumber  *string        `json:"fiscalNumber,omitempty" db:"fiscal_number"` // set once the fiscal receipt is registered
+	FiscalQR      *string        `json:"fiscalQr,omitempty" db:"fiscal_qr"`
+	FiscalURL     *string        `json:"fiscalUrl,omitempty" db:"fiscal_url"`
+}
+
+// ApplyCurrency tags the amount with the transaction currency (after scanning)
+func (t *PaymentTransaction) ApplyCurrency() {
+	t.Amount = t.Amount.WithCurrency(t.Currency)
 }
 
 // PaymentTransactionUpdate represents fields that can be updated for a transaction
 type PaymentTransactionUpdate struct {
-	Amount        *float64 `json:"amount"`
-	PaymentMethod *string  `json:"paymentMethod"`
-	Description   *string  `json:"description"`
+	Amount        *money.Money `json:"amount"`
+	PaymentMethod *string      `json:"paymentMethod"`
+	Description   *string      `json:"description"`
 }
 
 // StudentBalance represents a student's financial balance
 type StudentBalance struct {
-	StudentID       string     `json:"studentId" db:"student_id"`
-	Balance         float64    `json:"balance" db:"balance"`
-	LastPaymentDate *time.Time `json:"lastPaymentDate,omitempty" db:"last_payment_date"`
-	Version         int        `json:"version" db:"version"` // For optimistic locking
+	StudentID       string         `json:"studentId" db:"student_id"`
+	Balance         money.Money    `json:"balance" db:"balance"`
+	LastPaymentDate *time.Time     `json:"lastPaymentDate,omitempty" db:"last_payment_date"`
+	Version         int            `json:"version" db:"version"` // For optimistic locking
+	Currency        money.Currency `json:"currency" db:"currency"`
+}
+
+// ApplyCurrency tags the balance with its currency (after scanning)
+func (b *StudentBalance) ApplyCurrency() {
+	b.Balance = b.Balance.WithCurrency(b.Currency)
 }
 
 // Tariff represents a pricing plan
 type Tariff struct {
-	ID           string    `json:"id" db:"id"`
-	Name         string    `json:"name" db:"name"`
-	Description  string    `json:"description" db:"description"`
-	Price        float64   `json:"price" db:"price"`
-	DurationDays *int      `json:"durationDays,omitempty" db:"duration_days"` // NULL for unlimited
-	LessonCount  *int      `json:"lessonCount,omitempty" db:"lesson_count"`   // NULL for unlimited
-	CreatedAt    time.Time `json:"createdAt" db:"created_at"`
+	ID           string      `json:"id" db:"id"`
+	Name         string      `json:"name" db:"name"`
+	Description  string      `json:"description" db:"description"`
+	Price        money.Money `json:"price" db:"price"`
+	DurationDays *int        `json:"durationDays,omitempty" db:"duration_days"` // NULL for unlimited
+	LessonCount  *int        `json:"lessonCount,omitempty" db:"lesson_count"`   // NULL for unlimited
+	CreatedAt    time.Time   `json:"createdAt" db:"created_at"`
 }
 
 // DebtRecord represents a debt record for a student
 type DebtRecord struct {
-	ID        int        `json:"id" db:"id"`
-	StudentID string     `json:"studentId" db:"student_id"`
-	Amount    float64    `json:"amount" db:"amount"`
-	DueDate   *time.Time `json:"dueDate,omitempty" db:"due_date"`
-	Status    string     `json:"status" db:"status"` // pending, paid
-	Notes     string     `json:"notes" db:"notes"`
-	CreatedAt time.Time  `json:"createdAt" db:"created_at"`
-	CompanyID string     `json:"companyId" db:"company_id"`
-	BranchID  string     `json:"branchId" db:"branch_id"`
+	ID         int            `json:"id" db:"id"`
+	StudentID  string         `json:"studentId" db:"student_id"`
+	Amount     money.Money    `json:"amount" db:"amount"`
+	PaidAmount money.Money    `json:"paidAmount" db:"paid_amount"`
+	DueDate    *time.Time     `json:"dueDate,omitempty" db:"due_date"`
+	Status     string         `json:"status" db:"status"` // pending, partially_paid, paid
+	Source     string         `json:"source" db:"source"` // manual, negative_balance, invoice, installment
+	InvoiceID  *int64         `json:"invoiceId,omitempty" db:"invoice_id"`
+	Notes      string         `json:"notes" db:"notes"`
+	CreatedAt  time.Time      `json:"createdAt" db:"created_at"`
+	SettledAt  *time.Time     `json:"settledAt,omitempty" db:"settled_at"`
+	CompanyID  string         `json:"companyId" db:"company_id"`
+	BranchID   string         `json:"branchId" db:"branch_id"`
+	Currency   money.Currency `json:"currency" db:"currency"`
+}
+
+// ApplyCurrency tags the amounts with the debt currency (after scanning)
+func (d *DebtRecord) ApplyCurrency() {
+	d.Amount = d.Amount.WithCurrency(d.Currency)
+	d.PaidAmount = d.PaidAmount.WithCurrency(d.Currency)
+}
+
+// Remaining returns the unpaid part of the debt
+func (d *DebtRecord) Remaining() money.Money {
+	return d.Amount.Sub(d.PaidAmount)
+}
+
+// DebtPayment represents the part of a payment allocated to a debt
+type DebtPayment struct {
+	ID                   int         `json:"id" db:"id"`
+	DebtID               int         `json:"debtId" db:"debt_id"`
+	PaymentTransactionID *int        `json:"paymentTransactionId,omitempty" db:"payment_transaction_id"`
+	Amount               money.Money `json:"amount" db:"amount"`
+	CreatedAt            time.Time   `json:"createdAt" db:"created_at"`
+	CompanyID            string      `json:"companyId" db:"company_id"`
+}
+
+// DebtAgingBuckets holds outstanding debt amounts by days overdue
+type DebtAgingBuckets struct {
+	Days0To30  money.Money `json:"days0To30"`
+	Days31To60 money.Money `json:"days31To60"`
+	Days61To90 money.Money `json:"days61To90"`
+	Days90Plus money.Money `json:"days90Plus"`
+	Total      money.Money `json:"total"`
+	DebtCount  int         `json:"debtCount"`
+}
+
+// DebtAgingBranch is the aging of outstanding debts of one branch
+type DebtAgingBranch struct {
+	BranchID   string           `json:"branchId"`
+	BranchName string           `json:"branchName"`
+	Buckets    DebtAgingBuckets `json:"buckets"`
+}
+
+// DebtAgingReport is the aging report of outstanding debts per branch, converted to one currency
+type DebtAgingReport struct {
+	AsOf        time.Time         `json:"asOf"`
+	Currency    money.Currency    `json:"currency"`
+	Branches    []DebtAgingBranch `json:"branches"`
+	Total       DebtAgingBuckets  `json:"total"`
+	Unconverted []money.Money     `json:"unconverted,omitempty"` // debts without an exchange rate, per currency, not in the totals
 }
 
 // Discount represents a discount that can be applied to students
@@ -307,47 +620,160 @@ type StudentDiscount struct {
 	BranchID   string     `json:"branchId" db:"branch_id"`
 }
 
+// CashShift represents a cash register shift of a branch
+type CashShift struct {
+	ID           int            `json:"id" db:"id"`
+	Status       string         `json:"status" db:"status"` // open, closed
+	OpeningFloat money.Money    `json:"openingFloat" db:"opening_float"`
+	ExpectedCash *money.Money   `json:"expectedCash,omitempty" db:"expected_cash"`
+	CountedCash  *money.Money   `json:"countedCash,omitempty" db:"counted_cash"`
+	Discrepancy  *money.Money   `json:"discrepancy,omitempty" db:"discrepancy"` // counted - expected
+	OpenedBy     *int           `json:"openedBy,omitempty" db:"opened_by"`
+	ClosedBy     *int           `json:"closedBy,omitempty" db:"closed_by"`
+	OpenedAt     time.Time      `json:"openedAt" db:"opened_at"`
+	ClosedAt     *time.Time     `json:"closedAt,omitempty" db:"closed_at"`
+	Notes        string         `json:"notes" db:"notes"`
+	CompanyID    string         `json:"companyId" db:"company_id"`
+	BranchID     string         `json:"branchId" db:"branch_id"`
+	Currency     money.Currency `json:"currency" db:"currency"`
+}
+
+// ApplyCurrency tags the amounts with the shift currency (after scanning)
+func (s *CashShift) ApplyCurrency() {
+	s.OpeningFloat = s.OpeningFloat.WithCurrency(s.Currency)
+	for _, m := range []**money.Money{&s.ExpectedCash, &s.CountedCash, &s.Discrepancy} {
+		if *m != nil {
+			v := (*m).WithCurrency(s.Currency)
+			*m = &v
+		}
+	}
+}
+
+// CashMovement represents a cash-in or cash-out within a shift
+type CashMovement struct {
+	ID        int         `json:"id" db:"id"`
+	ShiftID   int         `json:"shiftId" db:"shift_id"`
+	Type      string      `json:"type" db:"type"` // cash_in, cash_out
+	Amount    money.Money `json:"amount" db:"amount"`
+	Reason    string      `json:"reason" db:"reason"`
+	CreatedBy *int        `json:"createdBy,omitempty" db:"created_by"`
+	CreatedAt time.Time   `json:"createdAt" db:"created_at"`
+	CompanyID string      `json:"companyId" db:"company_id"`
+	BranchID  string      `json:"branchId" db:"branch_id"`
+}
+
+// CashShiftReport is the reconciliation summary of a shift
+type CashShiftReport struct {
+	Shift        CashShift            `json:"shift"`
+	CashPayments money.Money          `json:"cashPayments"`
+	CashRefunds  money.Money          `json:"cashRefunds"`
+	CashIns      money.Money          `json:"cashIns"`
+	CashOuts     money.Money          `json:"cashOuts"`
+	ExpectedCash money.Money          `json:"expectedCash"`
+	Transactions []PaymentTransaction `json:"transactions"`
+	Movements    []CashMovement       `json:"movements"`
+}
+
+// OpenCashShiftRequest represents a request to open a shift
+type OpenCashShiftRequest struct {
+	OpeningFloat money.Money `json:"openingFloat"`
+	Notes        string      `json:"notes"`
+}
+
+// CloseCashShiftRequest represents a request to close a shift with the counted cash
+type CloseCashShiftRequest struct {
+	CountedCash money.Money `json:"countedCash"`
+	Notes       string      `json:"notes"`
+}
+
+// CashMovementRequest represents a request to add a cash-in or cash-out
+type CashMovementRequest struct {
+	Type   string      `json:"type" binding:"required,oneof=cash_in cash_out"`
+	Amount money.Money `json:"amount"`
+	Reason string      `json:"reason"`
+}
+
 // ============= SUBSCRIPTION MODULE =============
 
 // SubscriptionType represents a subscription type/plan
 type SubscriptionType struct {
-	ID           string    `json:"id" db:"id"`
-	Name         string    `json:"name" db:"name"`
-	LessonsCount int       `json:"lessonsCount" db:"lessons_count"`
-	ValidityDays *int      `json:"validityDays,omitempty" db:"validity_days"` // NULL = unlimited
-	Price        float64   `json:"price" db:"price"`
-	CanFreeze    bool      `json:"canFreeze" db:"can_freeze"`
-	BillingType  string    `json:"billingType" db:"billing_type"` // per_lesson, monthly, unlimited
-	Description  string    `json:"description" db:"description"`
-	CreatedAt    time.Time `json:"createdAt" db:"created_at"`
-	CompanyID    string    `json:"companyId" db:"company_id"`
-	BranchID     string    `json:"branchId" db:"branch_id"`
+	ID           string         `json:"id" db:"id"`
+	Name         string         `json:"name" db:"name"`
+	LessonsCount int            `json:"lessonsCount" db:"lessons_count"`
+	ValidityDays *int           `json:"validityDays,omitempty" db:"validity_days"` // NULL = unlimited
+	Price        money.Money    `json:"price" db:"price"`
+	CanFreeze    bool           `json:"canFreeze" db:"can_freeze"`
+	BillingType  string         `json:"billingType" db:"billing_type"` // per_lesson, monthly, unlimited
+	Description  string         `json:"description" db:"description"`
+	CreatedAt    time.Time      `json:"createdAt" db:"created_at"`
+	CompanyID    string         `json:"companyId" db:"company_id"`
+	BranchID     string         `json:"branchId" db:"branch_id"`
+	Currency     money.Currency `json:"currency" db:"currency"`
+}
+
+// ApplyCurrency tags the price with the subscription type currency (after scanning)
+func (t *SubscriptionType) ApplyCurrency() {
+	t.Price = t.Price.WithCurrency(t.Currency)
 }
 
 // StudentSubscription represents a subscription assigned to a student
 type StudentSubscription struct {
-	ID                   string     `json:"id" db:"id"`
-	StudentID            string     `json:"studentId" db:"student_id"`
-	SubscriptionTypeID   string     `json:"subscriptionTypeId,omitempty" db:"subscription_type_id"`
-	SubscriptionTypeName string     `json:"subscriptionTypeName,omitempty" db:"subscription_type_name"` // Added for display
-	BillingType          string     `json:"billingType,omitempty" db:"billing_type"`                    // Added for display
-	GroupID              *string    `json:"groupId,omitempty" db:"group_id"`
-	TeacherID            *string    `json:"teacherId,omitempty" db:"teacher_id"`
-	TotalLessons         int        `json:"totalLessons" db:"total_lessons"`
-	UsedLessons          int        `json:"usedLessons" db:"used_lessons"`
-	LessonsRemaining     int        `json:"lessonsRemaining" db:"lessons_remaining"` // Computed field
-	TotalPrice           float64    `json:"totalPrice" db:"total_price"`
-	PricePerLesson       float64    `json:"pricePerLesson" db:"price_per_lesson"`
-	StartDate            time.Time  `json:"startDate" db:"start_date"`
-	EndDate              *time.Time `json:"endDate,omitempty" db:"end_date"` // NULL if no expiry
-	PaidTill             *time.Time `json:"paidTill,omitempty" db:"paid_till"`
-	Status               string     `json:"status" db:"status"` // active, expired, frozen, completed
-	FreezeDaysRemaining  int        `json:"freezeDaysRemaining" db:"freeze_days_remaining"`
-	CreatedAt            time.Time  `json:"createdAt" db:"created_at"`
-	UpdatedAt            time.Time  `json:"updatedAt" db:"updated_at"`
-	CompanyID            string     `json:"companyId" db:"company_id"`
-	BranchID             string     `json:"branchId" db:"branch_id"`
-	Version              int        `json:"version" db:"version"` // For optimistic locking
+	ID                   string         `json:"id" db:"id"`
+	StudentID            string         `json:"studentId" db:"student_id"`
+	SubscriptionTypeID   string         `json:"subscriptionTypeId,omitempty" db:"subscription_type_id"`
+	SubscriptionTypeName string         `json:"subscriptionTypeName,omitempty" db:"subscription_type_name"` // Added for display
+	BillingType          string         `json:"billingType,omitempty" db:"billing_type"`                    // Added for display
+	GroupID              *string        `json:"groupId,omitempty" db:"group_id"`
+	TeacherID            *string        `json:"teacherId,omitempty" db:"teacher_id"`
+	TotalLessons         int            `json:"totalLessons" db:"total_lessons"`
+	UsedLessons          int            `json:"usedLessons" db:"used_lessons"`
+	LessonsRemaining     int            `json:"lessonsRemaining" db:"lessons_remaining"` // Computed field
+	TotalPrice           money.Money    `json:"totalPrice" db:"total_price"`
+	PricePerLesson       money.Money    `json:"pricePerLesson" db:"price_per_lesson"` // Derived: TotalPrice / TotalLessons
+	StartDate            time.Time      `json:"startDate" db:"start_date"`
+	EndDate              *time.Time     `json:"endDate,omitempty" db:"end_date"` // NULL if no expiry
+	PaidTill             *time.Time     `json:"paidTill,omitempty" db:"paid_till"`
+	Status               string         `json:"status" db:"status"` // active, expired, frozen, completed, suspended, cancelled
+	FreezeDaysRemaining  int            `json:"freezeDaysRemaining" db:"freeze_days_remaining"`
+	CreatedAt            time.Time      `json:"createdAt" db:"created_at"`
+	UpdatedAt            time.Time      `json:"updatedAt" db:"updated_at"`
+	CompanyID            string         `json:"companyId" db:"company_id"`
+	BranchID             string         `json:"branchId" db:"branch_id"`
+	Version              int            `json:"version" db:"version"` // For optimistic locking
+	Currency             money.Currency `json:"currency" db:"currency"`
+}
+
+// ApplyCurrency tags the prices with the subscription currency (after scanning)
+func (s *StudentSubscription) ApplyCurrency() {
+	s.TotalPrice = s.TotalPrice.WithCurrency(s.Currency)
+	s.PricePerLesson = s.PricePerLesson.WithCurrency(s.Currency)
+}
+
+// DerivePricePerLesson sets PricePerLesson from TotalPrice and TotalLessons (rounded half up).
+// It is informational: lessons are charged with LessonCharge.
+func (s *StudentSubscription) DerivePricePerLesson() {
+	if s.TotalLessons > 0 && s.TotalPrice.IsPositive() {
+		s.PricePerLesson = s.TotalPrice.Div(int64(s.TotalLessons), money.HalfUp)
+	}
+}
+
+// LessonCharge returns the amount charged for the lesson with the given 0-based index.
+// Charges are exact shares of TotalPrice, so all lessons of a subscription add up to its price
+// (e.g. 10 000 ₸ / 3 = 3333.34 + 3333.33 + 3333.33). Extra lessons are charged PricePerLesson.
+func (s *StudentSubscription) LessonCharge(lessonIndex int) money.Money {
+	if s.TotalPrice.IsPositive() && lessonIndex < s.TotalLessons {
+		return s.TotalPrice.Share(s.TotalLessons, lessonIndex)
+	}
+	return s.PricePerLesson
+}
+
+// UnusedValue returns what the lessons not used yet are worth: the sum of their LessonCharge
+func (s *StudentSubscription) UnusedValue() money.Money {
+	value := money.New(0, s.Currency)
+	for i := s.UsedLessons; i < s.TotalLessons; i++ {
+		value = value.Add(s.LessonCharge(i))
+	}
+	return value
 }
 
 // SubscriptionFreeze represents a freeze period for a subscription
@@ -375,6 +801,178 @@ type LessonAttendance struct {
 	BranchID       string    `json:"branchId" db:"branch_id"`
 }
 
+// ============= FISCAL MODULE =============
+
+// FiscalReceipt is the fiscal receipt of a cash or card payment or refund, registered with the OFD
+type FiscalReceipt struct {
+	ID            int            `json:"id" db:"id"`
+	TransactionID int            `json:"transactionId" db:"transaction_id"`
+	Operation     string         `json:"operation" db:"operation"` // sale, refund
+	Amount        money.Money    `json:"amount" db:"amount"`
+	Currency      money.Currency `json:"currency" db:"currency"`
+	PaymentMethod string         `json:"paymentMethod" db:"payment_method"`
+	Description   string         `json:"description" db:"description"`
+	Status        string         `json:"status" db:"status"` // pending, registered, failed
+	Attempts      int            `json:"attempts" db:"attempts"`
+	NextAttemptAt time.Time      `json:"nextAttemptAt" db:"next_attempt_at"`
+	LastError     *string        `json:"lastError,omitempty" db:"last_error"`
+	Operator      *string        `json:"operator,omitempty" db:"operator"`
+	FiscalNumber  *string        `json:"fiscalNumber,omitempty" db:"fiscal_number"`
+	QRCode        *string        `json:"qrCode,omitempty" db:"qr_code"`
+	ReceiptURL    *string        `json:"receiptUrl,omitempty" db:"receipt_url"`
+	RegisteredAt  *time.Time     `json:"registeredAt,omitempty" db:"registered_at"`
+	CreatedAt     time.Time      `json:"createdAt" db:"created_at"`
+	UpdatedAt     time.Time      `json:"updatedAt" db:"updated_at"`
+	CompanyID     string         `json:"companyId" db:"company_id"`
+	BranchID      string         `json:"branchId" db:"branch_id"`
+}
+
+// ApplyCurrency tags the amount with the receipt currency (after scanning)
+func (r *FiscalReceipt) ApplyCurrency() {
+	r.Amount = r.Amount.WithCurrency(r.Currency)
+}
+
+// FiscalReceiptStats counts receipts of a company by status
+type FiscalReceiptStats struct {
+	Pending    int `json:"pending"`
+	Registered int `json:"registered"`
+	Failed     int `json:"failed"`
+}
+
+// ============= ONLINE PAYMENT MODULE =============
+
+// PaymentIntent is a payment link created at an online payment provider
+type PaymentIntent struct {
+	ID                string         `json:"id" db:"id"` // also the reference sent to the provider
+	StudentID         string         `json:"studentId" db:"student_id"`
+	InvoiceID         *int64         `json:"invoiceId,omitempty" db:"invoice_id"`
+	Amount            money.Money    `json:"amount" db:"amount"`
+	Currency          money.Currency `json:"currency" db:"currency"`
+	Description       string         `json:"description" db:"description"`
+	Provider          string         `json:"provider" db:"provider"`
+	ProviderPaymentID *string        `json:"providerPaymentId,omitempty" db:"provider_payment_id"`
+	PaymentURL        *string        `json:"paymentUrl,omitempty" db:"payment_url"`
+	Status            string         `json:"status" db:"status"`                          // pending, review, succeeded, failed, cancelled, refunded
+	PaidAmount        *money.Money   `json:"paidAmount,omitempty" db:"paid_amount"`       // amount confirmed by the provider when it differs
+	TransactionID     *int           `json:"transactionId,omitempty" db:"transaction_id"` // payment transaction created on confirmation
+	RefundedAmount    money.Money    `json:"refundedAmount" db:"refunded_amount"`
+	CreatedBy         *int           `json:"createdBy,omitempty" db:"created_by"`
+	CreatedAt         time.Time      `json:"createdAt" db:"created_at"`
+	UpdatedAt         time.Time      `json:"updatedAt" db:"updated_at"`
+	ConfirmedAt       *time.Time     `json:"confirmedAt,omitempty" db:"confirmed_at"`
+	CompanyID         string         `json:"companyId" db:"company_id"`
+	BranchID          string         `json:"branchId" db:"branch_id"`
+}
+
+// ApplyCurrency tags the amounts with the intent currency (after scanning)
+func (p *PaymentIntent) ApplyCurrency() {
+	p.Amount = p.Amount.WithCurrency(p.Currency)
+	p.RefundedAmount = p.RefundedAmount.WithCurrency(p.Currency)
+	if p.PaidAmount != nil {
+		paid := p.PaidAmount.WithCurrency(p.Currency)
+		p.PaidAmount = &paid
+	}
+}
+
+// Paid returns the amount the payer actually paid
+func (p *PaymentIntent) Paid() money.Money {
+	if p.PaidAmount != nil {
+		return *p.PaidAmount
+	}
+	return p.Amount
+}
+
+// Refundable returns the part of a confirmed payment that was not refunded yet
+func (p *PaymentIntent) Refundable() money.Money {
+	return p.Paid().Sub(p.RefundedAmount)
+}
+
+// CreatePaymentIntentRequest creates a payment link. For invoices the amount defaults to the unpaid rest.
+type CreatePaymentIntentRequest struct {
+	StudentID   string      `json:"studentId" binding:"required"`
+	InvoiceID   *int64      `json:"invoiceId"`
+	Amount      money.Money `json:"amount"`
+	Description string      `json:"description"`
+	Provider    string      `json:"provider"` // configured provider name, default when empty
+	ReturnURL   string      `json:"returnUrl"`
+}
+
+// RefundPaymentIntentRequest refunds a confirmed online payment; a zero amount refunds the rest
+type RefundPaymentIntentRequest struct {
+	Amount money.Money `json:"amount"`
+}
+
+// ============= INSTALLMENT MODULE =============
+
+// InstallmentPlan splits the price of a subscription into scheduled payments
+type InstallmentPlan struct {
+	ID             int            `json:"id" db:"id"`
+	SubscriptionID string         `json:"subscriptionId" db:"subscription_id"`
+	StudentID      string         `json:"studentId" db:"student_id"`
+	TotalAmount    money.Money    `json:"totalAmount" db:"total_amount"`
+	BillingMode    string         `json:"billingMode" db:"billing_mode"` // debt, invoice: what is generated on the due date
+	ReminderDays   int            `json:"reminderDays" db:"reminder_days"`
+	GraceDays      *int           `json:"graceDays,omitempty" db:"grace_days"` // nil: the subscription is never suspended
+	Status         string         `json:"status" db:"status"`                  // active, completed, cancelled
+	SuspendedAt    *time.Time     `json:"suspendedAt,omitempty" db:"suspended_at"`
+	CreatedBy      *int           `json:"createdBy,omitempty" db:"created_by"`
+	CreatedAt      time.Time      `json:"createdAt" db:"created_at"`
+	CompanyID      string         `json:"companyId" db:"company_id"`
+	BranchID       string         `json:"branchId" db:"branch_id"`
+	Currency       money.Currency `json:"currency" db:"currency"`
+	Installments   []Installment  `json:"installments"`
+}
+
+// ApplyCurrency tags the plan and installment amounts with the plan currency (after scanning)
+func (p *InstallmentPlan) ApplyCurrency() {
+	p.TotalAmount = p.TotalAmount.WithCurrency(p.Currency)
+	for i := range p.Installments {
+		p.Installments[i].Amount = p.Installments[i].Amount.WithCurrency(p.Currency)
+		p.Installments[i].PaidAmount = p.Installments[i].PaidAmount.WithCurrency(p.Currency)
+	}
+}
+
+// Installment is one scheduled payment of a plan
+type Installment struct {
+	ID             int         `json:"id" db:"id"`
+	PlanID         int         `json:"planId" db:"plan_id"`
+	Seq            int         `json:"seq" db:"seq"` // 1-based
+	DueDate        time.Time   `json:"dueDate" db:"due_date"`
+	Amount         money.Money `json:"amount" db:"amount"`
+	PaidAmount     money.Money `json:"paidAmount" db:"paid_amount"`
+	Status         string      `json:"status" db:"status"` // scheduled, due, partially_paid, paid, overdue, cancelled
+	DebtID         *int        `json:"debtId,omitempty" db:"debt_id"`
+	InvoiceID      *int64      `json:"invoiceId,omitempty" db:"invoice_id"`
+	RemindedAt     *time.Time  `json:"remindedAt,omitempty" db:"reminded_at"`
+	PaidAt         *time.Time  `json:"paidAt,omitempty" db:"paid_at"`
+	CompanyID      string      `json:"companyId" db:"company_id"`
+	StudentID      string      `json:"studentId,omitempty" db:"student_id"`           // from the plan, in lists
+	SubscriptionID string      `json:"subscriptionId,omitempty" db:"subscription_id"` // from the plan, in lists
+}
+
+// Remaining returns the unpaid part of the installment
+func (i *Installment) Remaining() money.Money {
+	return i.Amount.Sub(i.PaidAmount)
+}
+
+// InstallmentInput is one explicit installment of a new plan
+type InstallmentInput struct {
+	DueDate string      `json:"dueDate" binding:"required"` // YYYY-MM-DD
+	Amount  money.Money `json:"amount"`
+}
+
+// CreateInstallmentPlanRequest creates a plan either from explicit installments or as
+// Count equal parts starting at FirstDueDate, every IntervalMonths months
+type CreateInstallmentPlanRequest struct {
+	BillingMode    string             `json:"billingMode"` // debt (default), invoice
+	Installments   []InstallmentInput `json:"installments"`
+	Count          int                `json:"count"`
+	FirstDueDate   string             `json:"firstDueDate"` // YYYY-MM-DD
+	IntervalMonths int                `json:"intervalMonths"`
+	ReminderDays   *int               `json:"reminderDays"`
+	GraceDays      *int               `json:"graceDays"`
+}
+
 // ============= STUDENT MANAGEMENT MODULE =============
 
 // StudentActivityLog represents an activity/action performed with a student
@@ -401,7 +999,7 @@ type StudentNote struct {
 type Notification struct {
 	ID        int       `json:"id" db:"id"`
 	StudentID string    `json:"studentId" db:"student_id"`
-	Type      string    `json:"type" db:"type"` // debt_reminder, subscription_expiring, subscription_expired
+	Type      string    `json:"type" db:"type"` // debt_reminder, subscription_expiring, subscription_expired, installment_reminder, subscription_suspended
 	Message   string    `json:"message" db:"message"`
 	IsRead    bool      `json:"isRead" db:"is_read"`
 	CreatedAt time.Time `json:"createdAt" db:"created_at"`
@@ -524,40 +1122,47 @@ type SubscriptionConsumption struct {
 
 // Invoice represents a bill/invoice for a student
 type Invoice struct {
-	ID        int64      `json:"id" db:"id"`
-	StudentID string     `json:"studentId" db:"student_id"`
-	IssuedAt  time.Time  `json:"issuedAt" db:"issued_at"`
-	DueAt     *time.Time `json:"dueAt,omitempty" db:"due_at"`
-	Status    string     `json:"status" db:"status"` // unpaid, partially, paid, void
-	CompanyID string     `json:"companyId" db:"company_id"`
-	CreatedAt time.Time  `json:"createdAt" db:"created_at"`
-	UpdatedAt time.Time  `json:"updatedAt" db:"updated_at"`
+	ID        int64          `json:"id" db:"id"`
+	StudentID string         `json:"studentId" db:"student_id"`
+	IssuedAt  time.Time      `json:"issuedAt" db:"issued_at"`
+	DueAt     *time.Time     `json:"dueAt,omitempty" db:"due_at"`
+	Status    string         `json:"status" db:"status"`     // unpaid, partially, paid, void
+	Currency  money.Currency `json:"currency" db:"currency"` // also the currency of its items
+	CompanyID string         `json:"companyId" db:"company_id"`
+	CreatedAt time.Time      `json:"createdAt" db:"created_at"`
+	UpdatedAt time.Time      `json:"updatedAt" db:"updated_at"`
 }
 
 // InvoiceItem represents a line item in an invoice
 type InvoiceItem struct {
-	ID          int64     `json:"id" db:"id"`
-	InvoiceID   int64     `json:"invoiceId" db:"invoice_id"`
-	Description string    `json:"description" db:"description"`
-	Quantity    int       `json:"quantity" db:"quantity"`
-	UnitPrice   float64   `json:"unitPrice" db:"unit_price"`
-	Meta        *string   `json:"meta,omitempty" db:"meta"` // JSONB stored as string
-	CompanyID   string    `json:"companyId" db:"company_id"`
-	CreatedAt   time.Time `json:"createdAt" db:"created_at"`
+	ID          int64       `json:"id" db:"id"`
+	InvoiceID   int64       `json:"invoiceId" db:"invoice_id"`
+	Description string      `json:"description" db:"description"`
+	Quantity    int         `json:"quantity" db:"quantity"`
+	UnitPrice   money.Money `json:"unitPrice" db:"unit_price"`
+	Meta        *string     `json:"meta,omitempty" db:"meta"` // JSONB stored as string
+	CompanyID   string      `json:"companyId" db:"company_id"`
+	CreatedAt   time.Time   `json:"createdAt" db:"created_at"`
 }
 
 // ============= TRANSACTION MODULE =============
 
 // Transaction represents a unified financial transaction
 type Transaction struct {
-	ID             int64     `json:"id" db:"id"`
-	PaymentID      *int      `json:"paymentId,omitempty" db:"payment_id"`
-	InvoiceID      *int64    `json:"invoiceId,omitempty" db:"invoice_id"`
-	SubscriptionID *string   `json:"subscriptionId,omitempty" db:"subscription_id"`
-	Amount         float64   `json:"amount" db:"amount"`
-	Kind           string    `json:"kind" db:"kind"` // pay_invoice, buy_subscription, refund, deduction, payment
-	CreatedAt      time.Time `json:"createdAt" db:"created_at"`
-	CompanyID      string    `json:"companyId" db:"company_id"`
+	ID             int64          `json:"id" db:"id"`
+	PaymentID      *int           `json:"paymentId,omitempty" db:"payment_id"`
+	InvoiceID      *int64         `json:"invoiceId,omitempty" db:"invoice_id"`
+	SubscriptionID *string        `json:"subscriptionId,omitempty" db:"subscription_id"`
+	Amount         money.Money    `json:"amount" db:"amount"`
+	Kind           string         `json:"kind" db:"kind"` // pay_invoice, buy_subscription, refund, deduction, payment
+	CreatedAt      time.Time      `json:"createdAt" db:"created_at"`
+	CompanyID      string         `json:"companyId" db:"company_id"`
+	Currency       money.Currency `json:"currency" db:"currency"`
+}
+
+// ApplyCurrency tags the amount with the transaction currency (after scanning)
+func (t *Transaction) ApplyCurrency() {
+	t.Amount = t.Amount.WithCurrency(t.Currency)
 }
 
 // ============= RBAC MODULE =============
@@ -569,8 +1174,10 @@ type Role struct {
 	Description string        `json:"description" db:"description"`
 	CompanyID   string        `json:"companyId" db:"company_id"`
 	Permissions []*Permission `json:"permissions,omitempty"` // Populated via JOIN
-	CreatedAt   time.Time     `json:"createdAt" db:"created_at"`
-	UpdatedAt   time.Time     `json:"updatedAt" db:"updated_at"`
+	// RequireTwoFactor is the company 2FA policy: holders of the role must use 2FA
+	RequireTwoFactor bool      `json:"requireTwoFactor" db:"require_two_factor"`
+	CreatedAt        time.Time `json:"createdAt" db:"created_at"`
+	UpdatedAt        time.Time `json:"updatedAt" db:"updated_at"`
 }
 
 // Permission represents a permission/resource action
@@ -580,9 +1187,32 @@ type Permission struct {
 	Resource    string    `json:"resource" db:"resource"`
 	Action      string    `json:"action" db:"action"`
 	Description string    `json:"description" db:"description"`
+	Scope       string    `json:"scope,omitempty" db:"scope"` // Data scope when loaded for a role
 	CreatedAt   time.Time `json:"createdAt" db:"created_at"`
 }
 
+// Data scopes of a role permission (role_permissions.scope)
+const (
+	ScopeAll    = "all"    // Every accessible branch
+	ScopeBranch = "branch" // The current branch
+	ScopeOwn    = "own"    // Records of the teacher linked to the user
+)
+
+// ValidScope reports whether s is a known data scope
+func ValidScope(s string) bool {
+	return s == ScopeAll || s == ScopeBranch || s == ScopeOwn
+}
+
+var scopeRank = map[string]int{ScopeOwn: 1, ScopeBranch: 2, ScopeAll: 3}
+
+// WiderScope returns the wider of two data scopes (all > branch > own)
+func WiderScope(a, b string) string {
+	if scopeRank[b] > scopeRank[a] {
+		return b
+	}
+	return a
+}
+
 // UserRole represents the relationship between a user and a role
 type UserRole struct {
 	UserID     int       `json:"userId" db:"user_id"`
@@ -594,16 +1224,23 @@ type UserRole struct {
 
 // CreateRoleRequest represents a request to create a role
 type CreateRoleRequest struct {
-	Name          string   `json:"name" binding:"required"`
-	Description   string   `json:"description"`
-	PermissionIDs []string `json:"permissionIds"`
+	Name             string            `json:"name" binding:"required"`
+	Description      string            `json:"description"`
+	PermissionIDs    []string          `json:"permissionIds"`
+	PermissionScopes map[string]string `json:"permissionScopes"` // Data scope by permission ID: all, branch or own
 }
 
 // UpdateRoleRequest represents a request to update a role
 type UpdateRoleRequest struct {
-	Name          string   `json:"name"`
-	Description   string   `json:"description"`
-	PermissionIDs []string `json:"permissionIds"`
+	Name             string            `json:"name"`
+	Description      string            `json:"description"`
+	PermissionIDs    []string          `json:"permissionIds"`
+	PermissionScopes map[string]string `json:"permissionScopes"` // Data scope by permission ID: all, branch or own
+}
+
+// LinkTeacherUserRequest links a teacher to a user account; a null userId unlinks it
+type LinkTeacherUserRequest struct {
+	UserID *int `json:"userId"`
 }
 
 // AssignRoleRequest represents a request to assign a role to a user
@@ -611,3 +1248,479 @@ type AssignRoleRequest struct {
 	UserID int    `json:"userId" binding:"required"`
 	RoleID string `json:"roleId" binding:"required"`
 }
+
+// BranchRoleGrant is the role a user holds in one branch (user_branches.role_id) with its permissions
+type BranchRoleGrant struct {
+	BranchID    string            `json:"branchId"`
+	RoleID      string            `json:"roleId"`
+	RoleName    string            `json:"roleName"`
+	Permissions []string          `json:"permissions"`
+	Scopes      map[string]string `json:"scopes"` // Data scope by permission name
+}
+
+// EffectivePermissions is what a user may do in one branch and where it comes from
+type EffectivePermissions struct {
+	UserID      int               `json:"userId"`
+	BranchID    string            `json:"branchId"`
+	Source      string            `json:"source"`               // branch_role, company_roles or company_admin
+	BranchRole  *BranchRoleGrant  `json:"branchRole,omitempty"` // Set when Source is branch_role
+	Permissions []string          `json:"permissions"`
+	Scopes      map[string]string `json:"scopes"`              // Data scope by permission name
+	TeacherID   *string           `json:"teacherId,omitempty"` // Teacher linked to the user (scope "own")
+}
+
+// ============= SESSION MODULE =============
+
+// UserSession represents a login on one device. Refresh tokens issued for the
+// session are rotated on every use; revoking the session logs the device out.
+type UserSession struct {
+	ID              string     `json:"id" db:"id"`
+	UserID          int        `json:"userId" db:"user_id"`
+	CompanyID       string     `json:"companyId" db:"company_id"`
+	CurrentBranchID *string    `json:"currentBranchId,omitempty" db:"current_branch_id"`
+	UserAgent       string     `json:"userAgent" db:"user_agent"`
+	Device          string     `json:"device"` // Human readable summary of the user agent
+	IP              string     `json:"ip" db:"ip"`
+	CreatedAt       time.Time  `json:"createdAt" db:"created_at"`
+	LastSeenAt      time.Time  `json:"lastSeenAt" db:"last_seen_at"`
+	ExpiresAt       time.Time  `json:"expiresAt" db:"expires_at"`
+	RevokedAt       *time.Time `json:"revokedAt,omitempty" db:"revoked_at"`
+	RevokeReason    *string    `json:"revokeReason,omitempty" db:"revoke_reason"`
+	Current         bool       `json:"current"` // Session of the requesting access token
+	ContextVersion  int        `json:"-"`       // users.context_version, embedded in access tokens
+	// TwoFactorVerifiedAt is when the session last confirmed the second factor (login or step-up)
+	TwoFactorVerifiedAt *time.Time `json:"twoFactorVerifiedAt,omitempty" db:"two_factor_verified_at"`
+	// ImpersonatedBy is the platform admin who opened the session to act as the user
+	ImpersonatedBy      *int    `json:"impersonatedBy,omitempty" db:"impersonated_by"`
+	ImpersonationReason *string `json:"impersonationReason,omitempty" db:"impersonation_reason"`
+}
+
+// UserTwoFactor is the TOTP enrollment of a user. The secret is stored encrypted.
+type UserTwoFactor struct {
+	UserID          int        `json:"userId" db:"user_id"`
+	SecretEncrypted string     `json:"-" db:"secret_encrypted"`
+	EnabledAt       *time.Time `json:"enabledAt,omitempty" db:"enabled_at"` // nil until the enrollment is confirmed
+	LastUsedStep    int64      `json:"-" db:"last_used_step"`               // Last accepted TOTP step, codes are single-use
+	FailedAttempts  int        `json:"-" db:"failed_attempts"`              // Consecutive invalid codes outside of login
+	LockedUntil     *time.Time `json:"-" db:"locked_until"`                 // Codes are refused until then
+	CreatedAt       time.Time  `json:"createdAt" db:"created_at"`
+	UpdatedAt       time.Time  `json:"updatedAt" db:"updated_at"`
+}
+
+// TwoFactorChallenge is the second step of a login with 2FA; only the token hash is stored
+type TwoFactorChallenge struct {
+	UserID     int        `db:"user_id"`
+	Attempts   int        `db:"attempts"`
+	ExpiresAt  time.Time  `db:"expires_at"`
+	ConsumedAt *time.Time `db:"consumed_at"`
+}
+
+// TwoFactorStatus describes the 2FA state of the current user
+type TwoFactorStatus struct {
+	Enabled                bool       `json:"enabled"`
+	EnabledAt              *time.Time `json:"enabledAt,omitempty"`
+	Required               bool       `json:"required"` // One of the user's roles requires 2FA
+	RecoveryCodesRemaining int        `json:"recoveryCodesRemaining"`
+	VerifiedAt             *time.Time `json:"verifiedAt,omitempty"` // Last confirmation in the current session
+}
+
+// TwoFactorSetupResponse carries a new TOTP secret for the authenticator app
+type TwoFactorSetupResponse struct {
+	Secret          string `json:"secret"`
+	ProvisioningURI string `json:"provisioningUri"` // otpauth:// URI, rendered as a QR code by the client
+}
+
+// TwoFactorCodeRequest confirms an action with a TOTP code or, where accepted, a recovery code
+type TwoFactorCodeRequest struct {
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recoveryCode"`
+}
+
+// TwoFactorLoginRequest is the second step of a login with 2FA
+type TwoFactorLoginRequest struct {
+	ChallengeToken string `json:"challengeToken" binding:"required"`
+	Code           string `json:"code"`
+	RecoveryCode   string `json:"recoveryCode"`
+}
+
+// TwoFactorChallengeResponse is returned by login instead of tokens when 2FA is enabled
+type TwoFactorChallengeResponse struct {
+	TwoFactorRequired bool      `json:"twoFactorRequired"`
+	ChallengeToken    string    `json:"challengeToken"`
+	ExpiresAt         time.Time `json:"expiresAt"`
+}
+
+// TwoFactorRecoveryCodesResponse lists freshly generated recovery codes; they are shown only once
+type TwoFactorRecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recoveryCodes"`
+}
+
+// AccountToken is a single-use password reset or email change token; only its hash is stored
+type AccountToken struct {
+	UserID    int       `db:"user_id"`
+	Purpose   string    `db:"purpose"`
+	NewEmail  *string   `db:"new_email"` // Email change: the address being verified
+	ExpiresAt time.Time `db:"expires_at"`
+}
+
+// ForgotPasswordRequest asks for a password reset link
+type ForgotPasswordRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+// ResetPasswordRequest sets a new password with a token from the reset email
+type ResetPasswordRequest struct {
+	Token    string `json:"token" binding:"required"`
+	Password string `json:"password" binding:"required,min=6"`
+}
+
+// ChangePasswordRequest changes the password of the current user
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"currentPassword" binding:"required"`
+	NewPassword     string `json:"newPassword" binding:"required,min=6"`
+}
+
+// ChangeEmailRequest starts an email change; the new address must be confirmed
+type ChangeEmailRequest struct {
+	NewEmail string `json:"newEmail" binding:"required,email"`
+	Password string `json:"password" binding:"required"`
+}
+
+// ConfirmEmailChangeRequest confirms a new address with the token sent to it
+type ConfirmEmailChangeRequest struct {
+	Token string `json:"token" binding:"required"`
+}
+
+// LoginEvent is one login attempt in the audit trail
+type LoginEvent struct {
+	ID            int64     `json:"id" db:"id"`
+	UserID        *int      `json:"userId,omitempty" db:"user_id"`
+	CompanyID     *string   `json:"-" db:"company_id"`
+	Email         string    `json:"email" db:"email"`
+	Success       bool      `json:"success" db:"success"`
+	FailureReason *string   `json:"failureReason,omitempty" db:"failure_reason"` // unknown_email, invalid_password, invalid_two_factor, locked
+	IP            string    `json:"ip" db:"ip"`
+	UserAgent     string    `json:"userAgent" db:"user_agent"`
+	Device        string    `json:"device" db:"device"`
+	Country       string    `json:"country,omitempty" db:"country"`
+	NewDevice     bool      `json:"newDevice" db:"new_device"`
+	NewCountry    bool      `json:"newCountry" db:"new_country"`
+	CreatedAt     time.Time `json:"createdAt" db:"created_at"`
+}
+
+// TwoFactorPolicy lists the roles whose holders must use 2FA
+type TwoFactorPolicy struct {
+	RoleIDs []string `json:"roleIds"`
+}
+
+// SSOConfig is the OpenID Connect provider of a company. The client secret is never returned.
+type SSOConfig struct {
+	CompanyID       string    `json:"companyId" db:"company_id"`
+	Issuer          string    `json:"issuer" db:"issuer"`
+	ClientID        string    `json:"clientId" db:"client_id"`
+	ClientSecret    string    `json:"-" db:"client_secret"` // sealed
+	HasClientSecret bool      `json:"hasClientSecret" db:"-"`
+	AllowedDomains  []string  `json:"allowedDomains" db:"allowed_domains"`
+	DefaultRoleID   *string   `json:"defaultRoleId,omitempty" db:"default_role_id"`
+	DefaultBranchID *string   `json:"defaultBranchId,omitempty" db:"default_branch_id"`
+	Enabled         bool      `json:"enabled" db:"enabled"`
+	CreatedAt       time.Time `json:"createdAt" db:"created_at"`
+	UpdatedAt       time.Time `json:"updatedAt" db:"updated_at"`
+}
+
+// SSOConfigRequest creates or updates the OpenID Connect provider of a company.
+// An empty client secret keeps the stored one.
+type SSOConfigRequest struct {
+	Issuer          string   `json:"issuer" binding:"required,url"`
+	ClientID        string   `json:"clientId" binding:"required"`
+	ClientSecret    string   `json:"clientSecret"`
+	AllowedDomains  []string `json:"allowedDomains" binding:"required,min=1"`
+	DefaultRoleID   *string  `json:"defaultRoleId"`
+	DefaultBranchID *string  `json:"defaultBranchId"`
+	Enabled         bool     `json:"enabled"`
+}
+
+// SSOLoginState is an authorization request in progress; only the hash of the state is stored
+type SSOLoginState struct {
+	CompanyID    string    `db:"company_id"`
+	Nonce        string    `db:"nonce"`
+	CodeVerifier string    `db:"code_verifier"`
+	ExpiresAt    time.Time `db:"expires_at"`
+}
+
+// UserIdentity links a user to an account at an OpenID provider
+type UserIdentity struct {
+	ID          int        `json:"id" db:"id"`
+	UserID      int        `json:"userId" db:"user_id"`
+	CompanyID   string     `json:"-" db:"company_id"`
+	Issuer      string     `json:"issuer" db:"issuer"`
+	Subject     string     `json:"subject" db:"subject"`
+	Email       string     `json:"email" db:"email"`
+	CreatedAt   time.Time  `json:"createdAt" db:"created_at"`
+	LastLoginAt *time.Time `json:"lastLoginAt,omitempty" db:"last_login_at"`
+}
+
+// SSODiscoverRequest asks whether an email signs in through SSO
+type SSODiscoverRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+// SSODiscoverResponse tells the login page where to start SSO for an email
+type SSODiscoverResponse struct {
+	SSOEnabled bool   `json:"ssoEnabled"`
+	LoginURL   string `json:"loginUrl,omitempty"`
+}
+
+// SSOExchangeRequest trades the one-time code from the SSO redirect for a session
+type SSOExchangeRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+// AuditEntry is one change recorded in the company audit log
+type AuditEntry struct {
+	ID         int64           `json:"id" db:"id"`
+	CompanyID  string          `json:"-" db:"company_id"`
+	UserID     *int            `json:"userId,omitempty" db:"user_id"` // nil for system changes
+	UserName   string          `json:"userName,omitempty"`
+	Action     string          `json:"action" db:"action"` // create, update, delete, clear_company_data
+	EntityType string          `json:"entityType" db:"entity_type"`
+	EntityID   *string         `json:"entityId,omitempty" db:"entity_id"`
+	Changes    json.RawMessage `json:"changes" db:"changes"` // {"before": {...}, "after": {...}}
+	IPAddress  *string         `json:"ipAddress,omitempty" db:"ip_address"`
+	RequestID  *string         `json:"requestId,omitempty" db:"request_id"`
+	CreatedAt  time.Time       `json:"createdAt" db:"created_at"`
+	// ImpersonatedBy is the platform admin who made the change signed in as the user
+	ImpersonatedBy   *int   `json:"impersonatedBy,omitempty" db:"impersonated_by"`
+	ImpersonatorName string `json:"impersonatorName,omitempty"`
+}
+
+// AuditFilter narrows an audit log query; zero values match everything
+type AuditFilter struct {
+	UserID     int
+	Action     string
+	EntityType string
+	EntityID   string
+	RequestID  string
+	From       *time.Time
+	To         *time.Time
+	Limit      int
+	Offset     int
+}
+
+// Trash entity types
+const (
+	TrashStudent = "student"
+	TrashTeacher = "teacher"
+	TrashGroup   = "group"
+	TrashLesson  = "lesson"
+	TrashBranch  = "branch"
+)
+
+// TrashItem is a deleted record that can still be restored
+type TrashItem struct {
+	Type            string    `json:"type"` // student, teacher, group, lesson, branch
+	ID              string    `json:"id"`
+	Name            string    `json:"name"`
+	DeletedAt       time.Time `json:"deletedAt"`
+	DeletedBy       *int      `json:"deletedBy,omitempty"`
+	DeletedByName   string    `json:"deletedByName,omitempty"`
+	RestorableUntil time.Time `json:"restorableUntil"`
+}
+
+// Company data job kinds and statuses
+const (
+	DataJobWipe    = "wipe"
+	DataJobRestore = "restore"
+
+	DataJobPending   = "pending"
+	DataJobRunning   = "running"
+	DataJobCompleted = "completed"
+	DataJobFailed    = "failed"
+)
+
+// CompanySnapshot is a stored logical dump of a company's data; the dump itself is not
+// part of the JSON
+type CompanySnapshot struct {
+	ID        int64            `json:"id" db:"id"`
+	CompanyID string           `json:"-" db:"company_id"`
+	Reason    string           `json:"reason" db:"reason"` // before_wipe, before_restore, before_import
+	RowCounts map[string]int64 `json:"rowCounts" db:"row_counts"`
+	SizeBytes int64            `json:"sizeBytes" db:"size_bytes"`
+	CreatedBy *int             `json:"createdBy,omitempty" db:"created_by"`
+	CreatedAt time.Time        `json:"createdAt" db:"created_at"`
+}
+
+// CompanyDataJob is a background wipe or restore of a company's data
+type CompanyDataJob struct {
+	ID               int64           `json:"id" db:"id"`
+	CompanyID        string          `json:"-" db:"company_id"`
+	Kind             string          `json:"kind" db:"kind"`     // wipe, restore
+	Status           string          `json:"status" db:"status"` // pending, running, completed, failed
+	Step             string          `json:"step" db:"step"`
+	SourceSnapshotID *int64          `json:"sourceSnapshotId,omitempty" db:"source_snapshot_id"`
+	SnapshotID       *int64          `json:"snapshotId,omitempty" db:"snapshot_id"`
+	Result           json.RawMessage `json:"result" db:"result"` // {"deleted": {table: rows}, "restored": {table: rows}}
+	Error            string          `json:"error,omitempty" db:"error"`
+	CreatedBy        *int            `json:"createdBy,omitempty" db:"created_by"`
+	CreatedAt        time.Time       `json:"createdAt" db:"created_at"`
+	StartedAt        *time.Time      `json:"startedAt,omitempty" db:"started_at"`
+	CompletedAt      *time.Time      `json:"completedAt,omitempty" db:"completed_at"`
+}
+
+// TenantImportReport is the outcome of importing a company archive
+type TenantImportReport struct {
+	DryRun         bool             `json:"dryRun"`
+	Valid          bool             `json:"valid"`    // no errors: a valid dry run can be applied
+	Checksum       string           `json:"checksum"` // SHA-256 of the archive, required to apply it after the dry run
+	SourceCompany  string           `json:"sourceCompany"`
+	SchemaVersion  string           `json:"schemaVersion"`
+	Rows           map[string]int64 `json:"rows"`           // rows imported per table
+	MergedBranches int              `json:"mergedBranches"` // imported branches matched to existing ones by name
+	SnapshotID     *int64           `json:"snapshotId,omitempty"`
+	Warnings       []string         `json:"warnings"`
+	Errors         []string         `json:"errors"`
+}
+
+// Personal data subjects
+const (
+	SubjectStudent = "student"
+	SubjectLead    = "lead"
+)
+
+// PersonalDataExport is everything the company holds about one student or lead
+type PersonalDataExport struct {
+	SubjectType string                       `json:"subjectType"`
+	SubjectID   string                       `json:"subjectId"`
+	ExportedAt  time.Time                    `json:"exportedAt"`
+	Tables      map[string][]json.RawMessage `json:"tables"`  // rows referencing the subject, per table
+	Matches     map[string][]json.RawMessage `json:"matches"` // other students and leads with the same email or phone
+}
+
+// PersonalDataErasure is the outcome of anonymizing a student or lead
+type PersonalDataErasure struct {
+	SubjectType  string           `json:"subjectType"`
+	SubjectID    string           `json:"subjectId"`
+	AnonymizedAt time.Time        `json:"anonymizedAt"`
+	Changed      map[string]int64 `json:"changed"` // rows anonymized or deleted per table
+}
+
+// BranchReportMetrics are the figures of one branch, or of all selected branches, for a period.
+// Rates are percentages; for the total they are computed from the summed counts.
+type BranchReportMetrics struct {
+	Payments         money.Money `json:"payments"`
+	Refunds          money.Money `json:"refunds"`
+	Revenue          money.Money `json:"revenue"` // payments minus refunds
+	PaymentCount     int         `json:"paymentCount"`
+	AttendanceMarked int         `json:"attendanceMarked"`
+	Attended         int         `json:"attended"`
+	Missed           int         `json:"missed"`
+	AttendanceRate   float64     `json:"attendanceRate"`
+	Lessons          int         `json:"lessons"`    // lessons held or scheduled, cancelled ones excluded
+	Seats            int         `json:"seats"`      // room capacity of those lessons
+	SeatsTaken       int         `json:"seatsTaken"` // students booked on lessons in rooms with a capacity
+	Occupancy        float64     `json:"occupancy"`
+	Leads            int         `json:"leads"` // leads created in the period
+	LeadsEnrolled    int         `json:"leadsEnrolled"`
+	LeadConversion   float64     `json:"leadConversion"`
+}
+
+// BranchReportRow is the part of a consolidated report for one branch
+type BranchReportRow struct {
+	BranchID   string              `json:"branchId"`
+	BranchName string              `json:"branchName"`
+	Metrics    BranchReportMetrics `json:"metrics"`
+}
+
+// BranchReport is the consolidated report of the selected branches for a period, amounts in one currency
+type BranchReport struct {
+	From     time.Time           `json:"from"`
+	To       time.Time           `json:"to"` // exclusive
+	Currency money.Currency      `json:"currency"`
+	Branches []BranchReportRow   `json:"branches"`
+	Total    BranchReportMetrics `json:"total"`
+	// Unconverted is the revenue (payments minus refunds) without an exchange rate, per currency, not in the figures
+	Unconverted []money.Money `json:"unconverted,omitempty"`
+}
+
+// BranchRevenue is the sum of one kind of payment transaction of a branch on one day, in its own currency
+type BranchRevenue struct {
+	BranchID string
+	Day      time.Time
+	Type     string // payment, refund
+	Amount   money.Money
+	Count    int
+}
+
+// Policies for the active subscriptions of a student transferred to another branch
+const (
+	TransferMoveSubscriptions   = "move"   // the subscriptions follow the student
+	TransferRefundSubscriptions = "refund" // the subscriptions are cancelled, their unused value stays on the balance
+	TransferKeepSubscriptions   = "keep"   // the subscriptions stay in the old branch until they expire
+)
+
+// StudentTransferRequest moves a student to another branch
+type StudentTransferRequest struct {
+	BranchID           string `json:"branchId" binding:"required"`
+	SubscriptionPolicy string `json:"subscriptionPolicy" binding:"required"` // move, refund, keep
+	Reason             string `json:"reason"`
+}
+
+// StudentTransferDetails is what a transfer changed. CancelledValue and BalanceBefore are in the
+// currency of the old branch, BalanceAfter in the currency of the new one.
+type StudentTransferDetails struct {
+	ClosedEnrollments     int            `json:"closedEnrollments"`     // group enrollments in the old branch
+	ClosedIndividual      int            `json:"closedIndividual"`      // individual enrollments in the old branch
+	RemovedFromLessons    int            `json:"removedFromLessons"`    // upcoming lessons of the old branch
+	MovedSubscriptions    []string       `json:"movedSubscriptions"`    // subscription IDs
+	RefundedSubscriptions []string       `json:"refundedSubscriptions"` // subscription IDs
+	KeptSubscriptions     []string       `json:"keptSubscriptions"`     // subscription IDs
+	CancelledValue        money.Money    `json:"cancelledValue"`        // unused value of the refunded subscriptions, left on the balance
+	CancelledPlans        int            `json:"cancelledPlans"`        // installment plans of the refunded subscriptions
+	MovedPlans            int            `json:"movedPlans"`            // installment plans of the moved subscriptions
+	MovedDebts            int            `json:"movedDebts"`            // outstanding debts
+	FromCurrency          money.Currency `json:"fromCurrency"`
+	ToCurrency            money.Currency `json:"toCurrency"`
+	BalanceBefore         money.Money    `json:"balanceBefore"`
+	BalanceAfter          money.Money    `json:"balanceAfter"`
+}
+
+// ApplyCurrency tags the amounts with their currencies (after decoding)
+func (d *StudentTransferDetails) ApplyCurrency() {
+	d.CancelledValue = d.CancelledValue.WithCurrency(d.FromCurrency)
+	d.BalanceBefore = d.BalanceBefore.WithCurrency(d.FromCurrency)
+	d.BalanceAfter = d.BalanceAfter.WithCurrency(d.ToCurrency)
+}
+
+// StudentTransfer is a logged transfer of a student between branches
+type StudentTransfer struct {
+	ID                 int64                  `json:"id"`
+	StudentID          string                 `json:"studentId"`
+	FromBranchID       *string                `json:"fromBranchId,omitempty"`
+	ToBranchID         *string                `json:"toBranchId,omitempty"`
+	SubscriptionPolicy string                 `json:"subscriptionPolicy"`
+	Reason             string                 `json:"reason,omitempty"`
+	Details            StudentTransferDetails `json:"details"`
+	CreatedBy          *int                   `json:"createdBy,omitempty"`
+	CreatedAt          time.Time              `json:"createdAt"`
+}
+
+// TeacherWorkingHours is a weekly slot a teacher works in a branch
+type TeacherWorkingHours struct {
+	Weekday int    `json:"weekday"` // 0 = Sunday
+	Start   string `json:"start"`   // HH:MM
+	End     string `json:"end"`     // HH:MM
+}
+
+// TeacherBranch is a branch a teacher works in, with the teacher's working hours there
+type TeacherBranch struct {
+	BranchID   string                `json:"branchId"`
+	BranchName string                `json:"branchName,omitempty"` // Populated via JOIN
+	Primary    bool                  `json:"primary"`              // teachers.branch_id
+	Schedule   []TeacherWorkingHours `json:"schedule"`
+}
+
+// SetTeacherBranchesRequest replaces the branches of a teacher; the primary branch must be one of them
+type SetTeacherBranchesRequest struct {
+	PrimaryBranchID string          `json:"primaryBranchId" binding:"required"`
+	Branches        []TeacherBranch `json:"branches" binding:"required"`
+}
@@ -0,0 +1,495 @@
+// Package money implements a fixed-point monetary amount.
+//
+// Amounts are stored as an integer number of minor units (tiyn for KZT) together
+// with the currency, so sums, differences and repeated deductions are exact.
+// Every operation that can lose precision (parsing, multiplication, division)
+// takes an explicit RoundingMode.
+package money
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// Currency is an ISO 4217 currency code
+type Currency string
+
+const (
+	KZT Currency = "KZT"
+	UZS Currency = "UZS"
+	RUB Currency = "RUB"
+	USD Currency = "USD"
+	EUR Currency = "EUR"
+
+	// DefaultCurrency is used for amounts without an explicit currency
+	DefaultCurrency = KZT
+)
+
+var currencySymbols = map[Currency]string{
+	KZT: "₸",
+	UZS: "сўм",
+	RUB: "₽",
+	USD: "$",
+	EUR: "€",
+}
+
+// ErrUnsupportedCurrency is returned for unknown currency codes
+var ErrUnsupportedCurrency = errors.New("unsupported currency")
+
+// ParseCurrency validates a currency code ("kzt" and "KZT" are both accepted)
+func ParseCurrency(code string) (Currency, error) {
+	c := Currency(strings.ToUpper(strings.TrimSpace(code)))
+	if _, ok := currencySymbols[c]; !ok {
+		return "", fmt.Errorf("%w: %q", ErrUnsupportedCurrency, code)
+	}
+	return c, nil
+}
+
+// SupportedCurrencies returns the codes of all supported currencies
+func SupportedCurrencies() []Currency {
+	return []Currency{KZT, UZS, RUB, USD, EUR}
+}
+
+// MinorUnits returns the number of decimal places of the currency
+func (c Currency) MinorUnits() int {
+	return 2
+}
+
+// Symbol returns the display symbol of the currency
+func (c Currency) Symbol() string {
+	if symbol, ok := currencySymbols[c.orDefault()]; ok {
+		return symbol
+	}
+	return string(c)
+}
+
+// Scan implements sql.Scanner (NULL is the default currency)
+func (c *Currency) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case nil:
+		*c = DefaultCurrency
+	case []byte:
+		*c = Currency(strings.TrimSpace(string(v)))
+	case string:
+		*c = Currency(strings.TrimSpace(v))
+	default:
+		return fmt.Errorf("money: cannot scan %T into currency", src)
+	}
+	return nil
+}
+
+// Value implements driver.Valuer
+func (c Currency) Value() (driver.Value, error) {
+	return string(c.orDefault()), nil
+}
+
+func (c Currency) orDefault() Currency {
+	if c == "" {
+		return DefaultCurrency
+	}
+	return c
+}
+
+// RoundingMode defines how amounts are rounded to minor units
+type RoundingMode int
+
+const (
+	// HalfUp rounds half away from zero (commercial rounding)
+	HalfUp RoundingMode = iota
+	// HalfEven rounds half to the nearest even digit (banker's rounding)
+	HalfEven
+	// Down truncates towards zero
+	Down
+	// Up rounds away from zero
+	Up
+)
+
+// DefaultRounding is the rounding applied to amounts received from clients
+const DefaultRounding = HalfUp
+
+var (
+	ErrInvalidAmount    = errors.New("invalid money amount")
+	ErrCurrencyMismatch = errors.New("currency mismatch")
+)
+
+// Money is an amount in minor units of a currency. The zero value is 0 in the default currency.
+type Money struct {
+	amount   int64
+	currency Currency
+}
+
+// New returns an amount of the given minor units
+func New(minor int64, currency Currency) Money {
+	return Money{amount: minor, currency: currency}
+}
+
+// FromMinor returns an amount of the given minor units in the default currency
+func FromMinor(minor int64) Money {
+	return New(minor, DefaultCurrency)
+}
+
+// FromMajor returns a whole amount (e.g. 5000 ₸)
+func FromMajor(major int64, currency Currency) Money {
+	return New(major*pow10(currency.orDefault().MinorUnits()), currency)
+}
+
+// FromFloat converts a float amount, rounding to minor units with the given mode.
+// Only use it at the boundaries with float-based APIs.
+func FromFloat(f float64, currency Currency, mode RoundingMode) Money {
+	m, err := Parse(strconv.FormatFloat(f, 'f', -1, 64), currency, mode)
+	if err != nil {
+		return New(0, currency)
+	}
+	return m
+}
+
+// Parse parses a decimal string ("1234.56", "-10", "0.005") rounding to minor units with the given mode
+func Parse(s string, currency Currency, mode RoundingMode) (Money, error) {
+	s = strings.TrimSpace(s)
+	r, ok := new(big.Rat).SetString(s)
+	if !ok || strings.ContainsAny(s, "/eE") {
+		return Money{}, fmt.Errorf("%w: %q", ErrInvalidAmount, s)
+	}
+	scale := big.NewRat(pow10(currency.orDefault().MinorUnits()), 1)
+	r.Mul(r, scale)
+	minor, err := roundRat(r, mode)
+	if err != nil {
+		return Money{}, fmt.Errorf("%w: %q", ErrInvalidAmount, s)
+	}
+	return New(minor, currency), nil
+}
+
+// MustParse is Parse that panics on error (for constants and tests)
+func MustParse(s string, currency Currency) Money {
+	m, err := Parse(s, currency, HalfUp)
+	if err != nil {
+		panic(err)
+	}
+	return m
+}
+
+// Minor returns the amount in minor units
+func (m Money) Minor() int64 {
+	return m.amount
+}
+
+// Currency returns the currency of the amount
+func (m Money) Currency() Currency {
+	return m.currency.orDefault()
+}
+
+// WithCurrency returns the same number of minor units in another currency
+func (m Money) WithCurrency(currency Currency) Money {
+	return New(m.amount, currency)
+}
+
+// IsZero reports whether the amount is zero
+func (m Money) IsZero() bool { return m.amount == 0 }
+
+// IsPositive reports whether the amount is greater than zero
+func (m Money) IsPositive() bool { return m.amount > 0 }
+
+// IsNegative reports whether the amount is less than zero
+func (m Money) IsNegative() bool { return m.amount < 0 }
+
+// Sign returns -1, 0 or 1
+func (m Money) Sign() int {
+	switch {
+	case m.amount < 0:
+		return -1
+	case m.amount > 0:
+		return 1
+	}
+	return 0
+}
+
+// Add returns m + o
+func (m Money) Add(o Money) Money {
+	return New(m.amount+o.amount, m.resultCurrency(o))
+}
+
+// Sub returns m - o
+func (m Money) Sub(o Money) Money {
+	return New(m.amount-o.amount, m.resultCurrency(o))
+}
+
+// Neg returns -m
+func (m Money) Neg() Money {
+	return New(-m.amount, m.currency)
+}
+
+// Abs returns |m|
+func (m Money) Abs() Money {
+	if m.amount < 0 {
+		return m.Neg()
+	}
+	return m
+}
+
+// Cmp compares two amounts and returns -1, 0 or 1
+func (m Money) Cmp(o Money) int {
+	m.resultCurrency(o)
+	switch {
+	case m.amount < o.amount:
+		return -1
+	case m.amount > o.amount:
+		return 1
+	}
+	return 0
+}
+
+// Equal reports whether both amounts and currencies are equal
+func (m Money) Equal(o Money) bool {
+	return m.amount == o.amount && m.Currency() == o.Currency()
+}
+
+// LessThan reports whether m < o
+func (m Money) LessThan(o Money) bool { return m.Cmp(o) < 0 }
+
+// GreaterThan reports whether m > o
+func (m Money) GreaterThan(o Money) bool { return m.Cmp(o) > 0 }
+
+// Min returns the smaller of two amounts
+func Min(a, b Money) Money {
+	if a.Cmp(b) <= 0 {
+		return a
+	}
+	return b
+}
+
+// Max returns the larger of two amounts
+func Max(a, b Money) Money {
+	if a.Cmp(b) >= 0 {
+		return a
+	}
+	return b
+}
+
+// Sum adds up amounts
+func Sum(amounts ...Money) Money {
+	var total Money
+	for _, a := range amounts {
+		total = total.Add(a)
+	}
+	return total
+}
+
+// MulInt returns m * n
+func (m Money) MulInt(n int64) Money {
+	return New(m.amount*n, m.currency)
+}
+
+// Mul multiplies by a decimal factor (e.g. "1.12", "0.15") rounding with the given mode
+func (m Money) Mul(factor string, mode RoundingMode) (Money, error) {
+	f, ok := new(big.Rat).SetString(factor)
+	if !ok {
+		return Money{}, fmt.Errorf("invalid factor %q", factor)
+	}
+	r := new(big.Rat).Mul(new(big.Rat).SetInt64(m.amount), f)
+	minor, err := roundRat(r, mode)
+	if err != nil {
+		return Money{}, err
+	}
+	return New(minor, m.currency), nil
+}
+
+// Div divides the amount into n parts rounding with the given mode.
+// The parts do not necessarily add back up to m; use Split when they must.
+func (m Money) Div(n int64, mode RoundingMode) Money {
+	if n == 0 {
+		panic("money: division by zero")
+	}
+	minor, _ := roundRat(big.NewRat(m.amount, n), mode)
+	return New(minor, m.currency)
+}
+
+// Split divides the amount into n parts that add up exactly to m.
+// The remainder is spread one minor unit at a time over the first parts,
+// e.g. 100.00 / 3 = [33.34, 33.33, 33.33].
+func (m Money) Split(n int) []Money {
+	if n <= 0 {
+		return nil
+	}
+	parts := make([]Money, n)
+	for i := range parts {
+		parts[i] = m.Share(n, i)
+	}
+	return parts
+}
+
+// Share returns the i-th (0-based) part of Split(n) without allocating all parts
+func (m Money) Share(n, i int) Money {
+	if n <= 0 || i < 0 || i >= n {
+		return New(0, m.currency)
+	}
+	base := m.amount / int64(n)
+	rem := m.amount % int64(n)
+	if rem < 0 {
+		rem = -rem
+		if int64(i) < rem {
+			return New(base-1, m.currency)
+		}
+		return New(base, m.currency)
+	}
+	if int64(i) < rem {
+		return New(base+1, m.currency)
+	}
+	return New(base, m.currency)
+}
+
+// Float64 returns the amount in major units as float (charts, spreadsheets). Never do arithmetic on it.
+func (m Money) Float64() float64 {
+	return float64(m.amount) / float64(pow10(m.Currency().MinorUnits()))
+}
+
+// String returns the amount as a plain decimal ("1234.50")
+func (m Money) String() string {
+	digits := m.Currency().MinorUnits()
+	scale := pow10(digits)
+	sign := ""
+	a := m.amount
+	if a < 0 {
+		sign = "-"
+	}
+	major := a / scale
+	minor := a % scale
+	if major < 0 {
+		major = -major
+	}
+	if minor < 0 {
+		minor = -minor
+	}
+	if digits == 0 {
+		return fmt.Sprintf("%s%d", sign, major)
+	}
+	return fmt.Sprintf("%s%d.%0*d", sign, major, digits, minor)
+}
+
+// Format returns the amount with the currency symbol: "1234.50 ₸", "1234.50 сўм", "$1234.50"
+func (m Money) Format() string {
+	switch m.Currency() {
+	case USD, EUR:
+		if m.amount < 0 {
+			return "-" + m.Currency().Symbol() + m.Abs().String()
+		}
+		return m.Currency().Symbol() + m.String()
+	}
+	return m.String() + " " + m.Currency().Symbol()
+}
+
+// MarshalJSON encodes the amount as a JSON number in major units
+func (m Money) MarshalJSON() ([]byte, error) {
+	return []byte(m.String()), nil
+}
+
+// UnmarshalJSON accepts a JSON number or numeric string, rounding with DefaultRounding
+func (m *Money) UnmarshalJSON(data []byte) error {
+	s := strings.TrimSpace(string(data))
+	if s == "null" {
+		return nil
+	}
+	if strings.HasPrefix(s, `"`) {
+		var str string
+		if err := json.Unmarshal(data, &str); err != nil {
+			return err
+		}
+		s = str
+	} else if strings.ContainsAny(s, "eE") {
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return fmt.Errorf("%w: %s", ErrInvalidAmount, s)
+		}
+		s = strconv.FormatFloat(f, 'f', -1, 64)
+	}
+	parsed, err := Parse(s, m.currency, DefaultRounding)
+	if err != nil {
+		return err
+	}
+	m.amount = parsed.amount
+	return nil
+}
+
+// Scan implements sql.Scanner for NUMERIC columns
+func (m *Money) Scan(src interface{}) error {
+	var s string
+	switch v := src.(type) {
+	case nil:
+		m.amount = 0
+		return nil
+	case []byte:
+		s = string(v)
+	case string:
+		s = v
+	case int64:
+		m.amount = v * pow10(m.Currency().MinorUnits())
+		return nil
+	case float64:
+		s = strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		return fmt.Errorf("money: cannot scan %T", src)
+	}
+	parsed, err := Parse(s, m.currency, HalfUp)
+	if err != nil {
+		return err
+	}
+	m.amount = parsed.amount
+	return nil
+}
+
+// Value implements driver.Valuer; the amount is sent as an exact decimal string
+func (m Money) Value() (driver.Value, error) {
+	return m.String(), nil
+}
+
+func (m Money) resultCurrency(o Money) Currency {
+	switch {
+	case m.currency == "":
+		return o.currency
+	case o.currency == "" || m.currency == o.currency:
+		return m.currency
+	}
+	panic(fmt.Errorf("%w: %s and %s", ErrCurrencyMismatch, m.currency, o.currency))
+}
+
+func roundRat(r *big.Rat, mode RoundingMode) (int64, error) {
+	num := new(big.Int).Set(r.Num())
+	den := r.Denom()
+	q, rem := new(big.Int).QuoRem(num, den, new(big.Int))
+	if rem.Sign() != 0 {
+		neg := r.Sign() < 0
+		twice := new(big.Int).Mul(new(big.Int).Abs(rem), big.NewInt(2))
+		half := twice.Cmp(den)
+		awayFromZero := false
+		switch mode {
+		case HalfUp:
+			awayFromZero = half >= 0
+		case HalfEven:
+			awayFromZero = half > 0 || (half == 0 && q.Bit(0) == 1)
+		case Up:
+			awayFromZero = true
+		case Down:
+			awayFromZero = false
+		}
+		if awayFromZero {
+			if neg {
+				q.Sub(q, big.NewInt(1))
+			} else {
+				q.Add(q, big.NewInt(1))
+			}
+		}
+	}
+	if !q.IsInt64() {
+		return 0, errors.New("money: amount out of range")
+	}
+	return q.Int64(), nil
+}
+
+func pow10(n int) int64 {
+	return int64(math.Pow10(n))
+}
@@ -0,0 +1,210 @@
+package money
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestParse_Rounding(t *testing.T) {
+	cases := []struct {
+		in   string
+		mode RoundingMode
+		want int64
+	}{
+		{"1234.56", HalfUp, 123456},
+		{"10", HalfUp, 1000},
+		{"0.005", HalfUp, 1},
+		{"0.005", HalfEven, 0},
+		{"0.015", HalfEven, 2},
+		{"0.009", Down, 0},
+		{"0.001", Up, 1},
+		{"-0.005", HalfUp, -1},
+		{"-1.115", HalfEven, -112},
+	}
+	for _, tc := range cases {
+		m, err := Parse(tc.in, KZT, tc.mode)
+		if err != nil {
+			t.Fatalf("Parse(%q): %v", tc.in, err)
+		}
+		if m.Minor() != tc.want {
+			t.Errorf("Parse(%q, %d) = %d, want %d", tc.in, tc.mode, m.Minor(), tc.want)
+		}
+	}
+
+	if _, err := Parse("abc", KZT, HalfUp); err == nil {
+		t.Error("expected error for non-numeric input")
+	}
+}
+
+func TestString(t *testing.T) {
+	cases := map[int64]string{
+		0:       "0.00",
+		5:       "0.05",
+		-5:      "-0.05",
+		123456:  "1234.56",
+		-100000: "-1000.00",
+	}
+	for minor, want := range cases {
+		if got := FromMinor(minor).String(); got != want {
+			t.Errorf("FromMinor(%d).String() = %q, want %q", minor, got, want)
+		}
+	}
+	if got := FromMinor(150000).Format(); got != "1500.00 ₸" {
+		t.Errorf("Format() = %q", got)
+	}
+}
+
+func TestSplit_AddsUpExactly(t *testing.T) {
+	total := MustParse("10000", KZT)
+	parts := total.Split(3)
+	if parts[0].Minor() != 333334 || parts[1].Minor() != 333333 || parts[2].Minor() != 333333 {
+		t.Fatalf("unexpected split: %v", parts)
+	}
+	if !Sum(parts...).Equal(total) {
+		t.Fatalf("split parts add up to %s, want %s", Sum(parts...), total)
+	}
+
+	negative := MustParse("-100", KZT).Split(3)
+	if !Sum(negative...).Equal(MustParse("-100", KZT)) {
+		t.Fatalf("negative split parts add up to %s", Sum(negative...))
+	}
+}
+
+// A 12-lesson subscription for 25 000 ₸ costs 2083.333... per lesson. With float prices the
+// per-lesson deductions never added back up to the subscription price; shares of Split do.
+func TestRepeatedDeductions_StayExact(t *testing.T) {
+	total := MustParse("25000", KZT)
+	const lessons = 12
+
+	balance := total
+	for i := 0; i < lessons; i++ {
+		balance = balance.Sub(total.Share(lessons, i))
+	}
+	if !balance.IsZero() {
+		t.Fatalf("balance after %d deductions = %s, want 0.00", lessons, balance)
+	}
+
+	// Fixed per-lesson price deducted many times: exact to the tiyn
+	price := MustParse("0.10", KZT)
+	balance = MustParse("1000", KZT)
+	for i := 0; i < 10000; i++ {
+		balance = balance.Sub(price)
+	}
+	if !balance.IsZero() {
+		t.Fatalf("balance after 10000 deductions of 0.10 = %s, want 0.00", balance)
+	}
+}
+
+func TestDiv(t *testing.T) {
+	if got := MustParse("100", KZT).Div(3, HalfUp); got.Minor() != 3333 {
+		t.Errorf("100/3 HalfUp = %s", got)
+	}
+	if got := MustParse("0.05", KZT).Div(2, HalfEven); got.Minor() != 2 {
+		t.Errorf("0.05/2 HalfEven = %s", got)
+	}
+	if got := MustParse("0.05", KZT).Div(2, HalfUp); got.Minor() != 3 {
+		t.Errorf("0.05/2 HalfUp = %s", got)
+	}
+}
+
+func TestMul(t *testing.T) {
+	got, err := MustParse("199.99", KZT).Mul("0.15", HalfUp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Minor() != 3000 {
+		t.Errorf("199.99 * 0.15 = %s, want 30.00", got)
+	}
+}
+
+func TestJSON_RoundTrip(t *testing.T) {
+	var v struct {
+		Amount Money  `json:"amount"`
+		Opt    *Money `json:"opt,omitempty"`
+	}
+	if err := json.Unmarshal([]byte(`{"amount": 1234.5, "opt": "0.1"}`), &v); err != nil {
+		t.Fatal(err)
+	}
+	if v.Amount.Minor() != 123450 || v.Opt == nil || v.Opt.Minor() != 10 {
+		t.Fatalf("unexpected decode: %v %v", v.Amount, v.Opt)
+	}
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != `{"amount":1234.50,"opt":0.10}` {
+		t.Fatalf("unexpected encode: %s", data)
+	}
+}
+
+func TestScanAndValue(t *testing.T) {
+	var m Money
+	if err := m.Scan([]byte("2083.33")); err != nil {
+		t.Fatal(err)
+	}
+	if m.Minor() != 208333 {
+		t.Fatalf("Scan = %d", m.Minor())
+	}
+	v, err := m.Value()
+	if err != nil || v != "2083.33" {
+		t.Fatalf("Value = %v, %v", v, err)
+	}
+	if err := m.Scan(nil); err != nil || !m.IsZero() {
+		t.Fatalf("Scan(nil) = %s, %v", m, err)
+	}
+}
+
+func TestCurrencyMismatchPanics(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Fatal("expected panic on currency mismatch")
+		}
+	}()
+	_ = New(100, KZT).Add(New(100, UZS))
+}
+
+func TestFormat_Currencies(t *testing.T) {
+	cases := map[Money]string{
+		New(150000, KZT):  "1500.00 ₸",
+		New(1250000, UZS): "12500.00 сўм",
+		New(1999, USD):    "$19.99",
+		New(-1999, EUR):   "-€19.99",
+		FromMinor(100):    "1.00 ₸",
+	}
+	for m, want := range cases {
+		if got := m.Format(); got != want {
+			t.Errorf("Format(%s %s) = %q, want %q", m, m.Currency(), got, want)
+		}
+	}
+}
+
+func TestConvert(t *testing.T) {
+	rate, err := ParseRate("0.0021")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 10 000 ₸ at 0.0021 USD per tenge
+	got, err := MustParse("10000", KZT).Convert(rate, USD, HalfUp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Minor() != 2100 || got.Currency() != USD {
+		t.Fatalf("Convert = %s %s, want 21.00 USD", got, got.Currency())
+	}
+
+	back, err := got.Convert(rate.Inverse(), KZT, HalfUp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if back.Minor() != 1000000 {
+		t.Fatalf("inverse Convert = %s, want 10000.00", back)
+	}
+
+	if _, err := ParseRate("0"); err == nil {
+		t.Error("expected error for zero rate")
+	}
+	if _, err := ParseCurrency("XXX"); err == nil {
+		t.Error("expected error for unsupported currency")
+	}
+}
@@ -0,0 +1,128 @@
+package money
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// ErrInvalidRate is returned for zero, negative or malformed exchange rates
+var ErrInvalidRate = errors.New("invalid exchange rate")
+
+// Rate is an exact exchange rate: how many units of the target currency one unit of the source buys
+type Rate struct {
+	r *big.Rat
+}
+
+// ParseRate parses a positive decimal rate ("0.0021", "475.5")
+func ParseRate(s string) (Rate, error) {
+	s = strings.TrimSpace(s)
+	r, ok := new(big.Rat).SetString(s)
+	if !ok || r.Sign() <= 0 || strings.Contains(s, "/") {
+		return Rate{}, fmt.Errorf("%w: %q", ErrInvalidRate, s)
+	}
+	return Rate{r: r}, nil
+}
+
+// IsZero reports whether the rate is unset
+func (r Rate) IsZero() bool {
+	return r.r == nil || r.r.Sign() == 0
+}
+
+// Inverse returns 1/r
+func (r Rate) Inverse() Rate {
+	if r.IsZero() {
+		return r
+	}
+	return Rate{r: new(big.Rat).Inv(r.r)}
+}
+
+// String returns the rate with up to 8 decimal places
+func (r Rate) String() string {
+	if r.r == nil {
+		return "0"
+	}
+	s := r.r.FloatString(8)
+	s = strings.TrimRight(s, "0")
+	return strings.TrimSuffix(s, ".")
+}
+
+// Convert converts the amount into another currency with the given rate, rounding with mode
+func (m Money) Convert(rate Rate, to Currency, mode RoundingMode) (Money, error) {
+	if m.Currency() == to.orDefault() {
+		return m, nil
+	}
+	if rate.IsZero() {
+		return Money{}, ErrInvalidRate
+	}
+	// minor units of target = minor units of source * rate * 10^(to digits - from digits)
+	r := new(big.Rat).Mul(new(big.Rat).SetInt64(m.amount), rate.r)
+	if diff := to.orDefault().MinorUnits() - m.Currency().MinorUnits(); diff != 0 {
+		scale := new(big.Rat).SetInt64(pow10(abs(diff)))
+		if diff > 0 {
+			r.Mul(r, scale)
+		} else {
+			r.Quo(r, scale)
+		}
+	}
+	minor, err := roundRat(r, mode)
+	if err != nil {
+		return Money{}, err
+	}
+	return New(minor, to), nil
+}
+
+// MarshalJSON encodes the rate as a JSON number
+func (r Rate) MarshalJSON() ([]byte, error) {
+	return []byte(r.String()), nil
+}
+
+// UnmarshalJSON accepts a JSON number or numeric string
+func (r *Rate) UnmarshalJSON(data []byte) error {
+	s := strings.TrimSpace(string(data))
+	if strings.HasPrefix(s, `"`) {
+		if err := json.Unmarshal(data, &s); err != nil {
+			return err
+		}
+	}
+	parsed, err := ParseRate(s)
+	if err != nil {
+		return err
+	}
+	*r = parsed
+	return nil
+}
+
+// Scan implements sql.Scanner for NUMERIC columns
+func (r *Rate) Scan(src interface{}) error {
+	var s string
+	switch v := src.(type) {
+	case []byte:
+		s = string(v)
+	case string:
+		s = v
+	default:
+		return fmt.Errorf("money: cannot scan %T into rate", src)
+	}
+	parsed, err := ParseRate(s)
+	if err != nil {
+		return err
+	}
+	*r = parsed
+	return nil
+}
+
+// Value implements driver.Valuer
+func (r Rate) Value() (driver.Value, error) {
+	return r.String(), nil
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
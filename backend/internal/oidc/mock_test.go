@@ -0,0 +1,227 @@
+package oidc
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const mockKeyID = "mock-key"
+
+// MockUser is the identity the mock provider signs in
+type MockUser struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+}
+
+type mockGrant struct {
+	clientID      string
+	redirectURI   string
+	nonce         string
+	codeChallenge string
+	user          MockUser
+}
+
+// MockProvider is an in-process OpenID provider for tests. Its authorization endpoint signs in
+// the user set with SetUser without a login form and redirects straight back with a code.
+type MockProvider struct {
+	Server *httptest.Server
+
+	clientID     string
+	clientSecret string
+	key          *rsa.PrivateKey
+
+	mu     sync.Mutex
+	user   MockUser
+	grants map[string]mockGrant
+}
+
+// NewMockProvider starts a mock provider that accepts the given client credentials
+func NewMockProvider(clientID, clientSecret string) (*MockProvider, error) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, err
+	}
+	m := &MockProvider{
+		clientID:     clientID,
+		clientSecret: clientSecret,
+		key:          key,
+		grants:       make(map[string]mockGrant),
+		user:         MockUser{Subject: "mock-user", Email: "user@example.com", EmailVerified: true, Name: "Mock User"},
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", m.handleDiscovery)
+	mux.HandleFunc("/jwks", m.handleJWKS)
+	mux.HandleFunc("/authorize", m.handleAuthorize)
+	mux.HandleFunc("/token", m.handleToken)
+	m.Server = httptest.NewServer(mux)
+	return m, nil
+}
+
+// Issuer is the issuer URL to configure
+func (m *MockProvider) Issuer() string { return m.Server.URL }
+
+// Client returns an HTTP client that talks to the provider
+func (m *MockProvider) Client() *http.Client { return m.Server.Client() }
+
+// Close stops the provider
+func (m *MockProvider) Close() { m.Server.Close() }
+
+// SetUser chooses who signs in next
+func (m *MockProvider) SetUser(user MockUser) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.user = user
+}
+
+// Authorize follows an authorization URL like a browser would and returns the callback URL
+// (redirect_uri with code and state) the provider redirects to
+func (m *MockProvider) Authorize(authURL string) (string, error) {
+	client := *m.Client()
+	client.CheckRedirect = func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }
+	resp, err := client.Get(authURL)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusFound {
+		return "", fmt.Errorf("authorize returned status %d", resp.StatusCode)
+	}
+	return resp.Header.Get("Location"), nil
+}
+
+func (m *MockProvider) handleDiscovery(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"issuer":                                m.Issuer(),
+		"authorization_endpoint":                m.Issuer() + "/authorize",
+		"token_endpoint":                        m.Issuer() + "/token",
+		"jwks_uri":                              m.Issuer() + "/jwks",
+		"response_types_supported":              []string{"code"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+	})
+}
+
+func (m *MockProvider) handleJWKS(w http.ResponseWriter, r *http.Request) {
+	pub := m.key.PublicKey
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": mockKeyID,
+			"use": "sig",
+			"alg": "RS256",
+			"n":   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+		}},
+	})
+}
+
+func (m *MockProvider) handleAuthorize(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	if q.Get("response_type") != "code" || q.Get("client_id") != m.clientID || q.Get("code_challenge_method") != "S256" {
+		http.Error(w, "invalid authorization request", http.StatusBadRequest)
+		return
+	}
+	redirectURI, err := url.Parse(q.Get("redirect_uri"))
+	if err != nil || redirectURI.Scheme == "" {
+		http.Error(w, "invalid redirect_uri", http.StatusBadRequest)
+		return
+	}
+	code, err := NewState()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	m.mu.Lock()
+	m.grants[code] = mockGrant{
+		clientID:      m.clientID,
+		redirectURI:   redirectURI.String(),
+		nonce:         q.Get("nonce"),
+		codeChallenge: q.Get("code_challenge"),
+		user:          m.user,
+	}
+	m.mu.Unlock()
+
+	params := redirectURI.Query()
+	params.Set("code", code)
+	params.Set("state", q.Get("state"))
+	redirectURI.RawQuery = params.Encode()
+	http.Redirect(w, r, redirectURI.String(), http.StatusFound)
+}
+
+func (m *MockProvider) handleToken(w http.ResponseWriter, r *http.Request) {
+	clientID, clientSecret, _ := r.BasicAuth()
+	clientID, _ = url.QueryUnescape(clientID)
+	clientSecret, _ = url.QueryUnescape(clientSecret)
+	if clientID != m.clientID || clientSecret != m.clientSecret {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid_client"})
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_request"})
+		return
+	}
+
+	m.mu.Lock()
+	grant, ok := m.grants[r.PostForm.Get("code")]
+	delete(m.grants, r.PostForm.Get("code"))
+	m.mu.Unlock()
+	if !ok || grant.redirectURI != r.PostForm.Get("redirect_uri") ||
+		CodeChallenge(r.PostForm.Get("code_verifier")) != grant.codeChallenge {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	idToken, err := m.SignIDToken(grant.user, grant.nonce, time.Now())
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "server_error"})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"access_token": "mock-access-token",
+		"token_type":   "Bearer",
+		"expires_in":   3600,
+		"id_token":     idToken,
+	})
+}
+
+// SignIDToken issues an ID token for the user as the provider would
+func (m *MockProvider) SignIDToken(user MockUser, nonce string, issuedAt time.Time) (string, error) {
+	if user.Subject == "" {
+		return "", errors.New("mock user has no subject")
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"iss":            m.Issuer(),
+		"sub":            user.Subject,
+		"aud":            m.clientID,
+		"iat":            issuedAt.Unix(),
+		"exp":            issuedAt.Add(time.Hour).Unix(),
+		"nonce":          nonce,
+		"email":          user.Email,
+		"email_verified": user.EmailVerified,
+		"name":           user.Name,
+	})
+	token.Header["kid"] = mockKeyID
+	return token.SignedString(m.key)
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
@@ -0,0 +1,107 @@
+package oidc
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func newTestProvider(t *testing.T) (*MockProvider, *Provider, Config) {
+	t.Helper()
+	mock, err := NewMockProvider("client-1", "secret/1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(mock.Close)
+
+	provider, err := Discover(context.Background(), mock.Client(), mock.Issuer())
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := Config{ClientID: "client-1", ClientSecret: "secret/1", RedirectURL: "http://localhost:8080/api/auth/sso/callback"}
+	return mock, provider, cfg
+}
+
+func TestAuthorizationCodeFlow(t *testing.T) {
+	mock, provider, cfg := newTestProvider(t)
+	mock.SetUser(MockUser{Subject: "42", Email: "Anna@Example.com", EmailVerified: true, Name: "Anna"})
+
+	verifier, _ := NewCodeVerifier()
+	callback, err := mock.Authorize(provider.AuthCodeURL(cfg, "state-1", "nonce-1", verifier))
+	if err != nil {
+		t.Fatal(err)
+	}
+	callbackURL, _ := url.Parse(callback)
+	if got := callbackURL.Query().Get("state"); got != "state-1" {
+		t.Fatalf("state = %q, want state-1", got)
+	}
+
+	ctx := context.Background()
+	if _, err := provider.Exchange(ctx, cfg, callbackURL.Query().Get("code"), "wrong-verifier"); !errors.Is(err, ErrExchangeFailed) {
+		t.Fatalf("exchange with wrong PKCE verifier: err = %v, want ErrExchangeFailed", err)
+	}
+
+	// The failed attempt used up the code, as a real provider would
+	callback, _ = mock.Authorize(provider.AuthCodeURL(cfg, "state-1", "nonce-1", verifier))
+	callbackURL, _ = url.Parse(callback)
+	idToken, err := provider.Exchange(ctx, cfg, callbackURL.Query().Get("code"), verifier)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	claims, err := provider.VerifyIDToken(ctx, cfg, idToken, "nonce-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.Subject != "42" || claims.Email != "Anna@Example.com" || !claims.EmailVerified || claims.Name != "Anna" {
+		t.Errorf("claims = %+v", claims)
+	}
+}
+
+func TestVerifyIDTokenRejects(t *testing.T) {
+	mock, provider, cfg := newTestProvider(t)
+	ctx := context.Background()
+	user := MockUser{Subject: "42", Email: "anna@example.com", EmailVerified: true}
+
+	valid, _ := mock.SignIDToken(user, "nonce-1", time.Now())
+	expired, _ := mock.SignIDToken(user, "nonce-1", time.Now().Add(-2*time.Hour))
+
+	other, err := NewMockProvider("client-1", "secret/1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer other.Close()
+	foreign, _ := other.SignIDToken(user, "nonce-1", time.Now())
+
+	cases := []struct {
+		name  string
+		token string
+		nonce string
+		cfg   Config
+	}{
+		{"wrong nonce", valid, "nonce-2", cfg},
+		{"wrong audience", valid, "nonce-1", Config{ClientID: "client-2"}},
+		{"expired", expired, "nonce-1", cfg},
+		{"signed by another provider", foreign, "nonce-1", cfg},
+		{"garbage", "not.a.token", "nonce-1", cfg},
+	}
+	for _, tc := range cases {
+		if _, err := provider.VerifyIDToken(ctx, tc.cfg, tc.token, tc.nonce); !errors.Is(err, ErrInvalidIDToken) {
+			t.Errorf("%s: err = %v, want ErrInvalidIDToken", tc.name, err)
+		}
+	}
+}
+
+func TestDiscoverUnknownIssuer(t *testing.T) {
+	mock, err := NewMockProvider("client-1", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mock.Close()
+
+	if _, err := Discover(context.Background(), mock.Client(), mock.Issuer()+"/tenant"); err == nil {
+		t.Error("expected an error for an issuer without provider metadata")
+	}
+}
@@ -0,0 +1,78 @@
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"classmate-central/internal/database"
+	"classmate-central/internal/models"
+)
+
+// Purposes of account tokens
+const (
+	AccountTokenPasswordReset = "password_reset"
+	AccountTokenEmailChange   = "email_change"
+	AccountTokenSSOLogin      = "sso_login"
+)
+
+type AccountTokenRepository struct {
+	db *sql.DB
+}
+
+func NewAccountTokenRepository(db *sql.DB) *AccountTokenRepository {
+	return &AccountTokenRepository{db: db}
+}
+
+// Create stores a token by its hash. Unused tokens issued earlier to the user for the same
+// purpose are discarded, so only the latest link works.
+func (r *AccountTokenRepository) Create(tokenHash string, userID int, purpose string, newEmail *string, expiresAt time.Time) error {
+	tx, err := database.System(r.db).Begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM account_tokens WHERE user_id = $1 AND purpose = $2 AND used_at IS NULL`, userID, purpose); err != nil {
+		return fmt.Errorf("error discarding previous account tokens: %w", err)
+	}
+	_, err = tx.Exec(`
+		INSERT INTO account_tokens (token_hash, user_id, purpose, new_email, expires_at)
+		VALUES ($1, $2, $3, $4, $5)`, tokenHash, userID, purpose, newEmail, expiresAt)
+	if err != nil {
+		return fmt.Errorf("error creating account token: %w", err)
+	}
+	return tx.Commit()
+}
+
+// Consume marks a valid token as used and returns it. Unknown, expired and already used
+// tokens yield nil.
+func (r *AccountTokenRepository) Consume(tokenHash, purpose string) (*models.AccountToken, error) {
+	token := &models.AccountToken{Purpose: purpose}
+	var newEmail sql.NullString
+	err := database.System(r.db).QueryRow(`
+		UPDATE account_tokens SET used_at = CURRENT_TIMESTAMP
+		WHERE token_hash = $1 AND purpose = $2 AND used_at IS NULL AND expires_at > CURRENT_TIMESTAMP
+		RETURNING user_id, new_email, expires_at`, tokenHash, purpose).Scan(&token.UserID, &newEmail, &token.ExpiresAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error consuming account token: %w", err)
+	}
+	token.NewEmail = nullStringPtr(newEmail)
+	return token, nil
+}
+
+// DeleteExpired removes tokens that expired before the given time
+func (r *AccountTokenRepository) DeleteExpired(before time.Time) (int64, error) {
+	result, err := database.System(r.db).Exec(`DELETE FROM account_tokens WHERE expires_at < $1`, before)
+	if err != nil {
+		return 0, fmt.Errorf("error deleting expired account tokens: %w", err)
+	}
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("error checking delete result: %w", err)
+	}
+	return deleted, nil
+}
@@ -4,6 +4,7 @@ import (
 	"database/sql"
 	"fmt"
 
+	"classmate-central/internal/database"
 	"classmate-central/internal/models"
 )
 
@@ -15,14 +16,15 @@ func NewActivityRepository(db *sql.DB) *ActivityRepository {
 	return &ActivityRepository{db: db}
 }
 
-// LogActivity records a student activity
+// LogActivity records a student activity. The company of the row is taken from the student by
+// the insert trigger of migration 043, so callers outside a request can log too.
 func (r *ActivityRepository) LogActivity(activity *models.StudentActivityLog) error {
 	query := `
 		INSERT INTO student_activity_log (student_id, activity_type, description, metadata, created_by, created_at)
 		VALUES ($1, $2, $3, $4, $5, COALESCE($6, CURRENT_TIMESTAMP))
 		RETURNING id
 	`
-	err := r.db.QueryRow(
+	err := database.System(r.db).QueryRow(
 		query,
 		activity.StudentID,
 		activity.ActivityType,
@@ -39,8 +41,8 @@ func (r *ActivityRepository) LogActivity(activity *models.StudentActivityLog) er
 	return nil
 }
 
-// GetStudentActivities retrieves activities for a student with pagination
-func (r *ActivityRepository) GetStudentActivities(studentID string, limit, offset int) ([]*models.StudentActivityLog, error) {
+// GetStudentActivities retrieves activities of a company's student with pagination
+func (r *ActivityRepository) GetStudentActivities(studentID, companyID string, limit, offset int) ([]*models.StudentActivityLog, error) {
 	if limit <= 0 {
 		limit = 50
 	}
@@ -48,52 +50,58 @@ func (r *ActivityRepository) GetStudentActivities(studentID string, limit, offse
 	query := `
 		SELECT id, student_id, activity_type, description, metadata, created_by, created_at
 		FROM student_activity_log
-		WHERE student_id = $1
+		WHERE student_id = $1 AND company_id = $2
 		ORDER BY created_at DESC
-		LIMIT $2 OFFSET $3
+		LIMIT $3 OFFSET $4
 	`
 
-	rows, err := r.db.Query(query, studentID, limit, offset)
-	if err != nil {
-		return nil, fmt.Errorf("error getting student activities: %w", err)
-	}
-	defer rows.Close()
-
 	activities := []*models.StudentActivityLog{}
-	for rows.Next() {
-		activity := &models.StudentActivityLog{}
-		var metadata sql.NullString
-		var createdBy sql.NullInt32
-
-		err := rows.Scan(
-			&activity.ID,
-			&activity.StudentID,
-			&activity.ActivityType,
-			&activity.Description,
-			&metadata,
-			&createdBy,
-			&activity.CreatedAt,
-		)
+	err := database.WithTenant(r.db, companyID, func(tx *sql.Tx) error {
+		rows, err := tx.Query(query, studentID, companyID, limit, offset)
 		if err != nil {
-			return nil, fmt.Errorf("error scanning activity: %w", err)
-		}
-
-		if metadata.Valid {
-			activity.Metadata = &metadata.String
+			return fmt.Errorf("error getting student activities: %w", err)
 		}
-		if createdBy.Valid {
-			val := int(createdBy.Int32)
-			activity.CreatedBy = &val
+		defer rows.Close()
+
+		for rows.Next() {
+			activity := &models.StudentActivityLog{}
+			var metadata sql.NullString
+			var createdBy sql.NullInt32
+
+			err := rows.Scan(
+				&activity.ID,
+				&activity.StudentID,
+				&activity.ActivityType,
+				&activity.Description,
+				&metadata,
+				&createdBy,
+				&activity.CreatedAt,
+			)
+			if err != nil {
+				return fmt.Errorf("error scanning activity: %w", err)
+			}
+
+			if metadata.Valid {
+				activity.Metadata = &metadata.String
+			}
+			if createdBy.Valid {
+				val := int(createdBy.Int32)
+				activity.CreatedBy = &val
+			}
+
+			activities = append(activities, activity)
 		}
-
-		activities = append(activities, activity)
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, err
 	}
 
 	return activities, nil
 }
 
 // GetActivityStats returns statistics about student activities
-func (r *ActivityRepository) GetActivityStats(studentID string) (map[string]int, error) {
+func (r *ActivityRepository) GetActivityStats(studentID, companyID string) (map[string]int, error) {
 	query := `
 		SELECT activity_type, COUNT(*) as count
 		FROM student_activity_log
@@ -101,7 +109,7 @@ func (r *ActivityRepository) GetActivityStats(studentID string) (map[string]int,
 		GROUP BY activity_type
 	`
 
-	rows, err := r.db.Query(query, studentID)
+	rows, err := database.Tenant(r.db, companyID).Query(query, studentID)
 	if err != nil {
 		return nil, fmt.Errorf("error getting activity stats: %w", err)
 	}
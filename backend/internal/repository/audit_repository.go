@@ -0,0 +1,131 @@
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"classmate-central/internal/database"
+	"classmate-central/internal/models"
+)
+
+type AuditRepository struct {
+	db *sql.DB
+}
+
+func NewAuditRepository(db *sql.DB) *AuditRepository {
+	return &AuditRepository{db: db}
+}
+
+// Record writes an explicit entry inside the caller's transaction. Row changes of audited
+// tables are recorded by triggers; this is for operations that are not a single row, such
+// as clearing company data.
+func (r *AuditRepository) Record(tx *sql.Tx, entry *models.AuditEntry) error {
+	return recordAudit(tx, entry)
+}
+
+func recordAudit(tx *sql.Tx, entry *models.AuditEntry) error {
+	changes := entry.Changes
+	if len(changes) == 0 {
+		changes = []byte(`{}`)
+	}
+	err := tx.QueryRow(`
+		INSERT INTO audit_log (company_id, user_id, impersonated_by, action, entity_type, entity_id, changes, ip_address, request_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		RETURNING id, created_at`,
+		entry.CompanyID, entry.UserID, entry.ImpersonatedBy, entry.Action, entry.EntityType, entry.EntityID, string(changes),
+		entry.IPAddress, entry.RequestID,
+	).Scan(&entry.ID, &entry.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("error recording audit entry: %w", err)
+	}
+	return nil
+}
+
+// List returns the company's audit entries matching the filter, newest first
+func (r *AuditRepository) List(companyID string, filter models.AuditFilter) ([]*models.AuditEntry, error) {
+	conditions := []string{"a.company_id = $1"}
+	args := []interface{}{companyID}
+	add := func(condition string, value interface{}) {
+		args = append(args, value)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+	if filter.UserID != 0 {
+		add("a.user_id = $%d", filter.UserID)
+	}
+	if filter.Action != "" {
+		add("a.action = $%d", filter.Action)
+	}
+	if filter.EntityType != "" {
+		add("a.entity_type = $%d", filter.EntityType)
+	}
+	if filter.EntityID != "" {
+		add("a.entity_id = $%d", filter.EntityID)
+	}
+	if filter.RequestID != "" {
+		add("a.request_id = $%d", filter.RequestID)
+	}
+	if filter.From != nil {
+		add("a.created_at >= $%d", *filter.From)
+	}
+	if filter.To != nil {
+		add("a.created_at < $%d", *filter.To)
+	}
+
+	query := `
+		SELECT a.id, a.company_id, a.user_id, COALESCE(u.name, ''), a.impersonated_by, COALESCE(iu.name, ''),
+		       a.action, a.entity_type, a.entity_id, a.changes, a.ip_address, a.request_id, a.created_at
+		FROM audit_log a
+		LEFT JOIN users u ON u.id = a.user_id
+		LEFT JOIN users iu ON iu.id = a.impersonated_by
+		WHERE ` + strings.Join(conditions, " AND ") + `
+		ORDER BY a.created_at DESC, a.id DESC`
+	if filter.Limit > 0 {
+		args = append(args, filter.Limit, filter.Offset)
+		query += fmt.Sprintf(" LIMIT $%d OFFSET $%d", len(args)-1, len(args))
+	}
+
+	rows, err := database.Tenant(r.db, companyID).Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error listing audit log: %w", err)
+	}
+	defer rows.Close()
+
+	entries := []*models.AuditEntry{}
+	for rows.Next() {
+		entry := &models.AuditEntry{}
+		var userID, impersonatedBy sql.NullInt64
+		var entityID, ip, requestID sql.NullString
+		var changes []byte
+		err := rows.Scan(&entry.ID, &entry.CompanyID, &userID, &entry.UserName, &impersonatedBy, &entry.ImpersonatorName,
+			&entry.Action, &entry.EntityType, &entityID, &changes, &ip, &requestID, &entry.CreatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning audit entry: %w", err)
+		}
+		if userID.Valid {
+			id := int(userID.Int64)
+			entry.UserID = &id
+		}
+		entry.ImpersonatedBy = nullableInt(impersonatedBy)
+		entry.EntityID = nullStringPtr(entityID)
+		entry.IPAddress = nullStringPtr(ip)
+		entry.RequestID = nullStringPtr(requestID)
+		entry.Changes = changes
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
+
+// DeleteOlderThan removes audit entries recorded before the given time
+func (r *AuditRepository) DeleteOlderThan(before time.Time) (int64, error) {
+	result, err := database.System(r.db).Exec(`DELETE FROM audit_log WHERE created_at < $1`, before)
+	if err != nil {
+		return 0, fmt.Errorf("error deleting old audit entries: %w", err)
+	}
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("error checking delete result: %w", err)
+	}
+	return deleted, nil
+}
@@ -0,0 +1,146 @@
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"classmate-central/internal/database"
+	"classmate-central/internal/models"
+	"classmate-central/internal/money"
+
+	"github.com/lib/pq"
+)
+
+// BranchReportRepository aggregates revenue, attendance, occupancy and leads per branch
+type BranchReportRepository struct {
+	db *sql.DB
+}
+
+func NewBranchReportRepository(db *sql.DB) *BranchReportRepository {
+	return &BranchReportRepository{db: db}
+}
+
+// branchReportQuery runs a per-branch aggregate over [from, to). $1 is the company, $2 and $3
+// the period; with branchIDs the rows are limited to those branches through $4. Rows without
+// a branch are reported under "".
+func (r *BranchReportRepository) branchReportQuery(query, branchColumn, companyID string, branchIDs []string, from, to time.Time, scan func(*sql.Rows) error) error {
+	args := []interface{}{companyID, from, to}
+	filter := ""
+	if len(branchIDs) > 0 {
+		filter = " AND " + branchColumn + " = ANY($4)"
+		args = append(args, pq.Array(branchIDs))
+	}
+	rows, err := database.Tenant(r.db, companyID).Query(fmt.Sprintf(query, filter), args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		if err := scan(rows); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// GetRevenue returns payments and refunds per branch, day and currency
+func (r *BranchReportRepository) GetRevenue(companyID string, branchIDs []string, from, to time.Time) ([]models.BranchRevenue, error) {
+	revenue := []models.BranchRevenue{}
+	err := r.branchReportQuery(`
+		SELECT COALESCE(branch_id, ''), date_trunc('day', created_at), type, currency, SUM(ABS(amount)), COUNT(*)
+		FROM payment_transactions
+		WHERE company_id = $1 AND created_at >= $2 AND created_at < $3 AND type IN ('payment', 'refund')%s
+		GROUP BY 1, 2, 3, 4`,
+		"branch_id", companyID, branchIDs, from, to, func(rows *sql.Rows) error {
+			var row models.BranchRevenue
+			var currency money.Currency
+			if err := rows.Scan(&row.BranchID, &row.Day, &row.Type, &currency, &row.Amount, &row.Count); err != nil {
+				return err
+			}
+			row.Amount = row.Amount.WithCurrency(currency)
+			revenue = append(revenue, row)
+			return nil
+		})
+	if err != nil {
+		return nil, fmt.Errorf("error fetching branch revenue: %w", err)
+	}
+	return revenue, nil
+}
+
+// GetActivity returns the attendance, occupancy and lead figures per branch. Attendance and
+// occupancy count lessons starting in the period, leads count leads created in it.
+func (r *BranchReportRepository) GetActivity(companyID string, branchIDs []string, from, to time.Time) (map[string]*models.BranchReportMetrics, error) {
+	metrics := map[string]*models.BranchReportMetrics{}
+	get := func(branchID string) *models.BranchReportMetrics {
+		if metrics[branchID] == nil {
+			metrics[branchID] = &models.BranchReportMetrics{}
+		}
+		return metrics[branchID]
+	}
+
+	err := r.branchReportQuery(`
+		SELECT COALESCE(l.branch_id, ''), COUNT(*),
+		       COUNT(*) FILTER (WHERE la.status = 'attended'), COUNT(*) FILTER (WHERE la.status = 'missed')
+		FROM lesson_attendance la
+		JOIN lessons l ON l.id = la.lesson_id
+		WHERE l.company_id = $1 AND l.start_time >= $2 AND l.start_time < $3 AND l.deleted_at IS NULL%s
+		GROUP BY 1`,
+		"l.branch_id", companyID, branchIDs, from, to, func(rows *sql.Rows) error {
+			var branchID string
+			var marked, attended, missed int
+			if err := rows.Scan(&branchID, &marked, &attended, &missed); err != nil {
+				return err
+			}
+			m := get(branchID)
+			m.AttendanceMarked, m.Attended, m.Missed = marked, attended, missed
+			return nil
+		})
+	if err != nil {
+		return nil, fmt.Errorf("error fetching branch attendance: %w", err)
+	}
+
+	err = r.branchReportQuery(`
+		SELECT COALESCE(l.branch_id, ''), COUNT(*),
+		       COALESCE(SUM(rm.capacity) FILTER (WHERE rm.capacity > 0), 0),
+		       COALESCE(SUM(booked.students) FILTER (WHERE rm.capacity > 0), 0)
+		FROM lessons l
+		LEFT JOIN rooms rm ON rm.id = l.room_id
+		LEFT JOIN LATERAL (SELECT COUNT(*) AS students FROM lesson_students ls WHERE ls.lesson_id = l.id) booked ON true
+		WHERE l.company_id = $1 AND l.start_time >= $2 AND l.start_time < $3 AND l.deleted_at IS NULL
+		  AND l.status <> 'cancelled'%s
+		GROUP BY 1`,
+		"l.branch_id", companyID, branchIDs, from, to, func(rows *sql.Rows) error {
+			var branchID string
+			var lessons, seats, taken int
+			if err := rows.Scan(&branchID, &lessons, &seats, &taken); err != nil {
+				return err
+			}
+			m := get(branchID)
+			m.Lessons, m.Seats, m.SeatsTaken = lessons, seats, taken
+			return nil
+		})
+	if err != nil {
+		return nil, fmt.Errorf("error fetching branch occupancy: %w", err)
+	}
+
+	err = r.branchReportQuery(`
+		SELECT COALESCE(branch_id, ''), COUNT(*), COUNT(*) FILTER (WHERE status = 'enrolled')
+		FROM leads
+		WHERE company_id = $1 AND created_at >= $2 AND created_at < $3%s
+		GROUP BY 1`,
+		"branch_id", companyID, branchIDs, from, to, func(rows *sql.Rows) error {
+			var branchID string
+			var leads, enrolled int
+			if err := rows.Scan(&branchID, &leads, &enrolled); err != nil {
+				return err
+			}
+			m := get(branchID)
+			m.Leads, m.LeadsEnrolled = leads, enrolled
+			return nil
+		})
+	if err != nil {
+		return nil, fmt.Errorf("error fetching branch leads: %w", err)
+	}
+	return metrics, nil
+}
@@ -4,6 +4,7 @@ import (
 	"database/sql"
 	"fmt"
 
+	"classmate-central/internal/database"
 	"classmate-central/internal/logger"
 	"classmate-central/internal/models"
 
@@ -23,11 +24,11 @@ func (r *BranchRepository) GetBranchesByCompany(companyID string) ([]*models.Bra
 	query := `
 		SELECT id, name, company_id, address, phone, status, created_at, updated_at
 		FROM branches
-		WHERE company_id = $1
+		WHERE company_id = $1 AND deleted_at IS NULL
 		ORDER BY name
 	`
 
-	rows, err := r.db.Query(query, companyID)
+	rows, err := database.Tenant(r.db, companyID).Query(query, companyID)
 	if err != nil {
 		logger.Error("Failed to query branches by company", logger.ErrorField(err), zap.String("companyId", companyID))
 		return nil, err
@@ -74,7 +75,7 @@ func (r *BranchRepository) GetUserBranches(userID int, companyID string) ([]*mod
 		WHERE ur.user_id = $1 AND ur.company_id = $2 AND r.name = 'admin'
 	`
 	var adminCount int
-	err := r.db.QueryRow(query, userID, companyID).Scan(&adminCount)
+	err := database.Tenant(r.db, companyID).QueryRow(query, userID, companyID).Scan(&adminCount)
 	if err != nil && err != sql.ErrNoRows {
 		logger.Error("Failed to check admin role", logger.ErrorField(err), zap.Int("userId", userID), zap.String("companyId", companyID))
 		return nil, err
@@ -99,12 +100,12 @@ func (r *BranchRepository) GetUserBranches(userID int, companyID string) ([]*mod
 		SELECT DISTINCT b.id, b.name, b.company_id, b.address, b.phone, b.status, b.created_at, b.updated_at
 		FROM branches b
 		JOIN user_branches ub ON b.id = ub.branch_id
-		WHERE ub.user_id = $1 AND ub.company_id = $2
+		WHERE ub.user_id = $1 AND ub.company_id = $2 AND b.deleted_at IS NULL
 		ORDER BY b.name
 	`
 
 	logger.Info("User is not admin, querying user_branches", zap.Int("userId", userID), zap.String("companyId", companyID))
-	rows, err := r.db.Query(query, userID, companyID)
+	rows, err := database.Tenant(r.db, companyID).Query(query, userID, companyID)
 	if err != nil {
 		logger.Error("Failed to query user branches", logger.ErrorField(err), zap.Int("userId", userID), zap.String("companyId", companyID))
 		return nil, err
@@ -161,13 +162,13 @@ func (r *BranchRepository) GetBranchByID(branchID string, companyID string) (*mo
 	query := `
 		SELECT id, name, company_id, address, phone, status, created_at, updated_at
 		FROM branches
-		WHERE id = $1 AND company_id = $2
+		WHERE id = $1 AND company_id = $2 AND deleted_at IS NULL
 	`
 
 	var branch models.Branch
 	var address sql.NullString
 	var phone sql.NullString
-	err := r.db.QueryRow(query, branchID, companyID).Scan(
+	err := database.Tenant(r.db, companyID).QueryRow(query, branchID, companyID).Scan(
 		&branch.ID,
 		&branch.Name,
 		&branch.CompanyID,
@@ -206,10 +207,12 @@ func (r *BranchRepository) CreateBranch(branch *models.Branch) error {
 		ON CONFLICT (id) DO UPDATE SET
 			name = EXCLUDED.name,
 			status = EXCLUDED.status,
+			deleted_at = NULL,
+			deleted_by = NULL,
 			updated_at = NOW()
 	`
 
-	_, err := r.db.Exec(
+	_, err := database.Tenant(r.db, branch.CompanyID).Exec(
 		query,
 		branch.ID,
 		branch.Name,
@@ -232,10 +235,10 @@ func (r *BranchRepository) UpdateBranch(branch *models.Branch) error {
 	query := `
 		UPDATE branches
 		SET name = $1, address = $2, phone = $3, status = $4, updated_at = NOW()
-		WHERE id = $5 AND company_id = $6
+		WHERE id = $5 AND company_id = $6 AND deleted_at IS NULL
 	`
 
-	result, err := r.db.Exec(
+	result, err := database.Tenant(r.db, branch.CompanyID).Exec(
 		query,
 		branch.Name,
 		branch.Address,
@@ -261,11 +264,19 @@ func (r *BranchRepository) UpdateBranch(branch *models.Branch) error {
 	return nil
 }
 
-// DeleteBranch deletes a branch
-func (r *BranchRepository) DeleteBranch(branchID string, companyID string) error {
-	query := `DELETE FROM branches WHERE id = $1 AND company_id = $2`
+// DeleteBranch moves a branch to the trash
+func (r *BranchRepository) DeleteBranch(branchID string, actor database.Actor) error {
+	query := `
+		UPDATE branches SET deleted_at = NOW(), deleted_by = NULLIF($3, 0)
+		WHERE id = $1 AND company_id = $2 AND deleted_at IS NULL
+	`
 
-	result, err := r.db.Exec(query, branchID, companyID)
+	var result sql.Result
+	err := database.WithActor(r.db, actor, func(tx *sql.Tx) error {
+		var err error
+		result, err = tx.Exec(query, branchID, actor.CompanyID, actor.UserID)
+		return err
+	})
 	if err != nil {
 		logger.Error("Failed to delete branch", logger.ErrorField(err))
 		return err
@@ -283,7 +294,7 @@ func (r *BranchRepository) DeleteBranch(branchID string, companyID string) error
 }
 
 // AssignUserToBranch assigns a user to a branch
-func (r *BranchRepository) AssignUserToBranch(userID int, branchID string, roleID *string, companyID string, assignedBy *int) error {
+func (r *BranchRepository) AssignUserToBranch(userID int, branchID string, roleID *string, assignedBy *int, actor database.Actor) error {
 	query := `
 		INSERT INTO user_branches (user_id, branch_id, role_id, company_id, assigned_at, assigned_by)
 		VALUES ($1, $2, $3, $4, NOW(), $5)
@@ -291,7 +302,10 @@ func (r *BranchRepository) AssignUserToBranch(userID int, branchID string, roleI
 		DO UPDATE SET role_id = $3, assigned_at = NOW(), assigned_by = $5
 	`
 
-	_, err := r.db.Exec(query, userID, branchID, roleID, companyID, assignedBy)
+	err := database.WithActor(r.db, actor, func(tx *sql.Tx) error {
+		_, err := tx.Exec(query, userID, branchID, roleID, actor.CompanyID, assignedBy)
+		return err
+	})
 	if err != nil {
 		logger.Error("Failed to assign user to branch", logger.ErrorField(err))
 		return err
@@ -301,13 +315,18 @@ func (r *BranchRepository) AssignUserToBranch(userID int, branchID string, roleI
 }
 
 // RemoveUserFromBranch removes a user's access to a branch
-func (r *BranchRepository) RemoveUserFromBranch(userID int, branchID string, companyID string) error {
+func (r *BranchRepository) RemoveUserFromBranch(userID int, branchID string, actor database.Actor) error {
 	query := `
 		DELETE FROM user_branches
 		WHERE user_id = $1 AND branch_id = $2 AND company_id = $3
 	`
 
-	result, err := r.db.Exec(query, userID, branchID, companyID)
+	var result sql.Result
+	err := database.WithActor(r.db, actor, func(tx *sql.Tx) error {
+		var err error
+		result, err = tx.Exec(query, userID, branchID, actor.CompanyID)
+		return err
+	})
 	if err != nil {
 		logger.Error("Failed to remove user from branch", logger.ErrorField(err))
 		return err
@@ -332,7 +351,7 @@ func (r *BranchRepository) GetBranchUsers(branchID string, companyID string) ([]
 		WHERE branch_id = $1 AND company_id = $2
 	`
 
-	rows, err := r.db.Query(query, branchID, companyID)
+	rows, err := database.Tenant(r.db, companyID).Query(query, branchID, companyID)
 	if err != nil {
 		logger.Error("Failed to query branch users", logger.ErrorField(err))
 		return nil, err
@@ -362,7 +381,7 @@ func (r *BranchRepository) CheckUserBranchAccess(userID int, branchID string, co
 		WHERE ur.user_id = $1 AND ur.company_id = $2 AND r.name = 'admin'
 	`
 	var adminCount int
-	err := r.db.QueryRow(query, userID, companyID).Scan(&adminCount)
+	err := database.Tenant(r.db, companyID).QueryRow(query, userID, companyID).Scan(&adminCount)
 	if err != nil && err != sql.ErrNoRows {
 		logger.Error("Failed to check admin role", logger.ErrorField(err))
 		return false, err
@@ -370,9 +389,9 @@ func (r *BranchRepository) CheckUserBranchAccess(userID int, branchID string, co
 
 	if adminCount > 0 {
 		// User is admin, check if branch belongs to their company
-		query = `SELECT COUNT(*) FROM branches WHERE id = $1 AND company_id = $2`
+		query = `SELECT COUNT(*) FROM branches WHERE id = $1 AND company_id = $2 AND deleted_at IS NULL`
 		var branchCount int
-		err = r.db.QueryRow(query, branchID, companyID).Scan(&branchCount)
+		err = database.Tenant(r.db, companyID).QueryRow(query, branchID, companyID).Scan(&branchCount)
 		if err != nil {
 			logger.Error("Failed to check branch", logger.ErrorField(err))
 			return false, err
@@ -382,11 +401,12 @@ func (r *BranchRepository) CheckUserBranchAccess(userID int, branchID string, co
 
 	// Otherwise, check if user is explicitly assigned to the branch
 	query = `
-		SELECT COUNT(*) FROM user_branches
-		WHERE user_id = $1 AND branch_id = $2 AND company_id = $3
+		SELECT COUNT(*) FROM user_branches ub
+		JOIN branches b ON b.id = ub.branch_id
+		WHERE ub.user_id = $1 AND ub.branch_id = $2 AND ub.company_id = $3 AND b.deleted_at IS NULL
 	`
 	var count int
-	err = r.db.QueryRow(query, userID, branchID, companyID).Scan(&count)
+	err = database.Tenant(r.db, companyID).QueryRow(query, userID, branchID, companyID).Scan(&count)
 	if err != nil {
 		logger.Error("Failed to check user branch access", logger.ErrorField(err))
 		return false, err
@@ -0,0 +1,600 @@
+package repository
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"classmate-central/internal/database"
+	"classmate-central/internal/models"
+	"classmate-central/internal/money"
+
+	"github.com/lib/pq"
+)
+
+// ErrTransferSameBranch is returned when a student is transferred to the branch they are in
+var ErrTransferSameBranch = errors.New("the student is already in this branch")
+
+// ErrBranchUnavailable is returned when a branch to move to or work in does not exist or is inactive
+var ErrBranchUnavailable = errors.New("branch not found or inactive")
+
+// ErrTransferKeepCurrency is returned when subscriptions are to be kept in an old branch with
+// another currency: their lessons would be charged to the converted balance in the old currency
+var ErrTransferKeepCurrency = errors.New("subscriptions can only be kept when both branches use the same currency")
+
+// MoneyConverter converts an amount into the currency of the target branch
+type MoneyConverter func(money.Money) (money.Money, error)
+
+// BranchTransferRepository moves students between branches and keeps the branches teachers work in
+type BranchTransferRepository struct {
+	db *sql.DB
+}
+
+func NewBranchTransferRepository(db *sql.DB) *BranchTransferRepository {
+	return &BranchTransferRepository{db: db}
+}
+
+// TransferStudent moves the student to req.BranchID in one transaction: enrollments and upcoming
+// lessons in the old branch are closed unless kept subscriptions still cover them, active
+// subscriptions and their installment plans are moved, cancelled or kept according to
+// req.SubscriptionPolicy, and outstanding debts and the balance follow the student, converted
+// with convert into toCurrency. The transfer is logged. Returns nil if the company has no such
+// student.
+func (r *BranchTransferRepository) TransferStudent(actor database.Actor, studentID string, req models.StudentTransferRequest, toCurrency money.Currency, convert MoneyConverter) (*models.StudentTransfer, error) {
+	var transfer *models.StudentTransfer
+	err := database.WithActor(r.db, actor, func(tx *sql.Tx) error {
+		companyID := actor.CompanyID
+
+		var fromBranch string
+		err := tx.QueryRow(`SELECT COALESCE(branch_id, '') FROM students WHERE id = $1 AND company_id = $2 AND deleted_at IS NULL FOR UPDATE`,
+			studentID, companyID).Scan(&fromBranch)
+		if err == sql.ErrNoRows {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("error getting student: %w", err)
+		}
+		if fromBranch == req.BranchID {
+			return ErrTransferSameBranch
+		}
+
+		var active bool
+		err = tx.QueryRow(`SELECT status = 'active' FROM branches WHERE id = $1 AND company_id = $2 AND deleted_at IS NULL`,
+			req.BranchID, companyID).Scan(&active)
+		if err == sql.ErrNoRows || (err == nil && !active) {
+			return ErrBranchUnavailable
+		}
+		if err != nil {
+			return fmt.Errorf("error getting branch: %w", err)
+		}
+
+		var fromCurrency money.Currency
+		if err := tx.QueryRow(`SELECT effective_currency($1, NULLIF($2, ''))`, companyID, fromBranch).Scan(&fromCurrency); err != nil {
+			return fmt.Errorf("error getting branch currency: %w", err)
+		}
+		if req.SubscriptionPolicy == models.TransferKeepSubscriptions && fromCurrency != toCurrency {
+			return ErrTransferKeepCurrency
+		}
+
+		details := models.StudentTransferDetails{
+			MovedSubscriptions:    []string{},
+			RefundedSubscriptions: []string{},
+			KeptSubscriptions:     []string{},
+			CancelledValue:        money.New(0, fromCurrency),
+			FromCurrency:          fromCurrency,
+			ToCurrency:            toCurrency,
+		}
+
+		keep := req.SubscriptionPolicy == models.TransferKeepSubscriptions
+		if err := closeBranchEnrollments(tx, studentID, companyID, fromBranch, keep, &details); err != nil {
+			return err
+		}
+		if err := transferSubscriptions(tx, studentID, companyID, fromBranch, req, toCurrency, convert, &details); err != nil {
+			return err
+		}
+		if err := transferDebts(tx, studentID, companyID, fromBranch, req.BranchID, toCurrency, convert, &details); err != nil {
+			return err
+		}
+		if err := transferBalance(tx, studentID, toCurrency, convert, &details); err != nil {
+			return err
+		}
+
+		if _, err := tx.Exec(`UPDATE students SET branch_id = $2 WHERE id = $1`, studentID, req.BranchID); err != nil {
+			return fmt.Errorf("error moving student: %w", err)
+		}
+
+		transfer = &models.StudentTransfer{
+			StudentID:          studentID,
+			SubscriptionPolicy: req.SubscriptionPolicy,
+			Reason:             req.Reason,
+			Details:            details,
+			CreatedBy:          actorUserID(actor),
+		}
+		if fromBranch != "" {
+			transfer.FromBranchID = &fromBranch
+		}
+		transfer.ToBranchID = &req.BranchID
+		data, err := json.Marshal(details)
+		if err != nil {
+			return fmt.Errorf("error encoding transfer: %w", err)
+		}
+		err = tx.QueryRow(`
+			INSERT INTO student_transfers (company_id, student_id, from_branch_id, to_branch_id, subscription_policy, reason, details, created_by)
+			VALUES ($1, $2, NULLIF($3, ''), $4, $5, NULLIF($6, ''), $7, $8)
+			RETURNING id, created_at`,
+			companyID, studentID, fromBranch, req.BranchID, req.SubscriptionPolicy, req.Reason, data, transfer.CreatedBy).
+			Scan(&transfer.ID, &transfer.CreatedAt)
+		if err != nil {
+			return fmt.Errorf("error logging transfer: %w", err)
+		}
+
+		entry := companyDataAuditEntry(actor, "transfer_student", map[string]interface{}{
+			"transferId": transfer.ID, "fromBranchId": transfer.FromBranchID, "toBranchId": req.BranchID,
+			"subscriptionPolicy": req.SubscriptionPolicy,
+		})
+		entry.EntityType = "students"
+		entry.EntityID = &studentID
+		return recordAudit(tx, entry)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return transfer, nil
+}
+
+// closeBranchEnrollments ends the student's group and individual enrollments in the branch and
+// takes them off its upcoming lessons. With keep, the subscriptions staying in the branch must
+// remain usable: the groups they are tied to stay open, and a subscription tied to no group keeps
+// all of the student's enrollments and lessons in the branch.
+func closeBranchEnrollments(tx *sql.Tx, studentID, companyID, branchID string, keep bool, details *models.StudentTransferDetails) error {
+	keptGroups := []string{}
+	if keep {
+		rows, err := tx.Query(`
+			SELECT group_id FROM student_subscriptions
+			WHERE student_id = $1 AND company_id = $2 AND COALESCE(branch_id, '') = $3
+			  AND status IN ('active', 'frozen', 'suspended')`, studentID, companyID, branchID)
+		if err != nil {
+			return fmt.Errorf("error getting kept subscriptions: %w", err)
+		}
+		anyGroup := false
+		for rows.Next() {
+			var groupID sql.NullString
+			if err := rows.Scan(&groupID); err != nil {
+				rows.Close()
+				return fmt.Errorf("error scanning kept subscription: %w", err)
+			}
+			if !groupID.Valid {
+				anyGroup = true
+			}
+			keptGroups = append(keptGroups, groupID.String)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return fmt.Errorf("error getting kept subscriptions: %w", err)
+		}
+		if anyGroup {
+			return nil
+		}
+	}
+
+	result, err := tx.Exec(`
+		UPDATE enrollment e SET left_at = now()
+		FROM groups g
+		WHERE g.id = e.group_id AND e.student_id = $1 AND e.company_id = $2 AND e.left_at IS NULL
+		  AND COALESCE(g.branch_id, '') = $3 AND NOT g.id = ANY($4)`, studentID, companyID, branchID, pq.Array(keptGroups))
+	if err != nil {
+		return fmt.Errorf("error closing enrollments: %w", err)
+	}
+	if details.ClosedEnrollments, err = affected(result); err != nil {
+		return fmt.Errorf("error closing enrollments: %w", err)
+	}
+
+	_, err = tx.Exec(`
+		DELETE FROM student_groups sg
+		USING groups g
+		WHERE g.id = sg.group_id AND sg.student_id = $1 AND g.company_id = $2 AND COALESCE(g.branch_id, '') = $3
+		  AND NOT g.id = ANY($4)`,
+		studentID, companyID, branchID, pq.Array(keptGroups))
+	if err != nil {
+		return fmt.Errorf("error removing group memberships: %w", err)
+	}
+
+	result, err = tx.Exec(`
+		UPDATE individual_enrollment SET ended_at = now()
+		WHERE student_id = $1 AND company_id = $2 AND ended_at IS NULL AND COALESCE(branch_id, '') = $3`,
+		studentID, companyID, branchID)
+	if err != nil {
+		return fmt.Errorf("error closing individual enrollments: %w", err)
+	}
+	if details.ClosedIndividual, err = affected(result); err != nil {
+		return fmt.Errorf("error closing individual enrollments: %w", err)
+	}
+
+	result, err = tx.Exec(`
+		DELETE FROM lesson_students ls
+		USING lessons l
+		WHERE l.id = ls.lesson_id AND ls.student_id = $1 AND l.company_id = $2 AND COALESCE(l.branch_id, '') = $3
+		  AND l.start_time > now() AND l.status = 'scheduled' AND l.deleted_at IS NULL
+		  AND NOT COALESCE(l.group_id, '') = ANY($4)`,
+		studentID, companyID, branchID, pq.Array(keptGroups))
+	if err != nil {
+		return fmt.Errorf("error removing student from lessons: %w", err)
+	}
+	if details.RemovedFromLessons, err = affected(result); err != nil {
+		return fmt.Errorf("error removing student from lessons: %w", err)
+	}
+	return nil
+}
+
+// transferSubscriptions applies the subscription policy to the student's active, frozen and
+// suspended subscriptions of the old branch and to their installment plans. Lessons are charged
+// to the balance as they are attended, so the unused part of a cancelled subscription is already
+// on the balance; nothing is paid out.
+func transferSubscriptions(tx *sql.Tx, studentID, companyID, fromBranch string, req models.StudentTransferRequest, toCurrency money.Currency, convert MoneyConverter, details *models.StudentTransferDetails) error {
+	rows, err := tx.Query(`
+		SELECT id, total_lessons, used_lessons, total_price, price_per_lesson, currency
+		FROM student_subscriptions
+		WHERE student_id = $1 AND company_id = $2 AND COALESCE(branch_id, '') = $3
+		  AND status IN ('active', 'frozen', 'suspended')
+		ORDER BY created_at
+		FOR UPDATE`, studentID, companyID, fromBranch)
+	if err != nil {
+		return fmt.Errorf("error getting subscriptions: %w", err)
+	}
+	var subs []models.StudentSubscription
+	for rows.Next() {
+		var sub models.StudentSubscription
+		if err := rows.Scan(&sub.ID, &sub.TotalLessons, &sub.UsedLessons, &sub.TotalPrice, &sub.PricePerLesson, &sub.Currency); err != nil {
+			rows.Close()
+			return fmt.Errorf("error scanning subscription: %w", err)
+		}
+		sub.ApplyCurrency()
+		subs = append(subs, sub)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error getting subscriptions: %w", err)
+	}
+
+	for _, sub := range subs {
+		switch req.SubscriptionPolicy {
+		case models.TransferKeepSubscriptions:
+			details.KeptSubscriptions = append(details.KeptSubscriptions, sub.ID)
+
+		case models.TransferRefundSubscriptions:
+			if _, err := tx.Exec(`UPDATE student_subscriptions SET status = 'cancelled', updated_at = CURRENT_TIMESTAMP, version = version + 1 WHERE id = $1`,
+				sub.ID); err != nil {
+				return fmt.Errorf("error cancelling subscription: %w", err)
+			}
+			if err := cancelInstallmentPlan(tx, sub.ID, details); err != nil {
+				return err
+			}
+			details.CancelledValue = details.CancelledValue.Add(sub.UnusedValue().WithCurrency(details.FromCurrency))
+			details.RefundedSubscriptions = append(details.RefundedSubscriptions, sub.ID)
+
+		default:
+			totalPrice, err := convert(sub.TotalPrice)
+			if err != nil {
+				return err
+			}
+			pricePerLesson, err := convert(sub.PricePerLesson)
+			if err != nil {
+				return err
+			}
+			// A group of the old branch is closed to the student, so the subscription is no longer tied to it
+			_, err = tx.Exec(`
+				UPDATE student_subscriptions
+				SET branch_id = $2, total_price = $3, price_per_lesson = $4, currency = $5,
+				    group_id = CASE WHEN group_id IN (SELECT id FROM groups WHERE COALESCE(branch_id, '') = $6) THEN NULL ELSE group_id END,
+				    updated_at = CURRENT_TIMESTAMP, version = version + 1
+				WHERE id = $1`,
+				sub.ID, req.BranchID, totalPrice, pricePerLesson, toCurrency, fromBranch)
+			if err != nil {
+				return fmt.Errorf("error moving subscription: %w", err)
+			}
+			if err := moveInstallmentPlan(tx, sub.ID, req.BranchID, toCurrency, convert, details); err != nil {
+				return err
+			}
+			details.MovedSubscriptions = append(details.MovedSubscriptions, sub.ID)
+		}
+	}
+	return nil
+}
+
+// cancelInstallmentPlan cancels the active installment plan of a cancelled subscription, as
+// InstallmentRepository.CancelPlan does: installments not yet charged are cancelled, debts and
+// invoices already generated stay
+func cancelInstallmentPlan(tx *sql.Tx, subscriptionID string, details *models.StudentTransferDetails) error {
+	var planID int
+	err := tx.QueryRow(`
+		UPDATE installment_plans SET status = 'cancelled'
+		WHERE subscription_id = $1 AND status = 'active'
+		RETURNING id`, subscriptionID).Scan(&planID)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("error cancelling installment plan: %w", err)
+	}
+	if _, err := tx.Exec(`UPDATE installments SET status = 'cancelled' WHERE plan_id = $1 AND status = 'scheduled'`, planID); err != nil {
+		return fmt.Errorf("error cancelling installments: %w", err)
+	}
+	details.CancelledPlans++
+	return nil
+}
+
+// moveInstallmentPlan moves the active installment plan of a moved subscription to the new branch
+// and converts its installments into toCurrency. The plan total becomes the sum of the converted
+// installments, so rounding cannot make them disagree.
+func moveInstallmentPlan(tx *sql.Tx, subscriptionID, toBranch string, toCurrency money.Currency, convert MoneyConverter, details *models.StudentTransferDetails) error {
+	var planID int
+	var currency money.Currency
+	err := tx.QueryRow(`SELECT id, currency FROM installment_plans WHERE subscription_id = $1 AND status = 'active' FOR UPDATE`,
+		subscriptionID).Scan(&planID, &currency)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("error getting installment plan: %w", err)
+	}
+
+	if currency != toCurrency {
+		rows, err := tx.Query(`SELECT id, amount, paid_amount FROM installments WHERE plan_id = $1 FOR UPDATE`, planID)
+		if err != nil {
+			return fmt.Errorf("error getting installments: %w", err)
+		}
+		type installment struct {
+			id           int
+			amount, paid money.Money
+		}
+		var installments []installment
+		for rows.Next() {
+			var i installment
+			if err := rows.Scan(&i.id, &i.amount, &i.paid); err != nil {
+				rows.Close()
+				return fmt.Errorf("error scanning installment: %w", err)
+			}
+			i.amount, i.paid = i.amount.WithCurrency(currency), i.paid.WithCurrency(currency)
+			installments = append(installments, i)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return fmt.Errorf("error getting installments: %w", err)
+		}
+
+		for _, i := range installments {
+			amount, err := convert(i.amount)
+			if err != nil {
+				return err
+			}
+			paid, err := convert(i.paid)
+			if err != nil {
+				return err
+			}
+			if _, err := tx.Exec(`UPDATE installments SET amount = $2, paid_amount = $3 WHERE id = $1`, i.id, amount, paid); err != nil {
+				return fmt.Errorf("error converting installment: %w", err)
+			}
+		}
+	}
+
+	_, err = tx.Exec(`
+		UPDATE installment_plans
+		SET branch_id = $2, currency = $3, total_amount = (SELECT SUM(amount) FROM installments WHERE plan_id = $1)
+		WHERE id = $1`, planID, toBranch, toCurrency)
+	if err != nil {
+		return fmt.Errorf("error moving installment plan: %w", err)
+	}
+	details.MovedPlans++
+	return nil
+}
+
+// transferDebts moves the student's outstanding debts of the old branch to the new one
+func transferDebts(tx *sql.Tx, studentID, companyID, fromBranch, toBranch string, toCurrency money.Currency, convert MoneyConverter, details *models.StudentTransferDetails) error {
+	rows, err := tx.Query(`
+		SELECT id, amount, paid_amount, currency FROM debt_records
+		WHERE student_id = $1 AND company_id = $2 AND COALESCE(branch_id, '') = $3
+		  AND status IN ('pending', 'partially_paid') AND amount > paid_amount
+		FOR UPDATE`, studentID, companyID, fromBranch)
+	if err != nil {
+		return fmt.Errorf("error getting debts: %w", err)
+	}
+	type openDebt struct {
+		id           int
+		amount, paid money.Money
+	}
+	var debts []openDebt
+	for rows.Next() {
+		var d openDebt
+		var currency money.Currency
+		if err := rows.Scan(&d.id, &d.amount, &d.paid, &currency); err != nil {
+			rows.Close()
+			return fmt.Errorf("error scanning debt: %w", err)
+		}
+		d.amount, d.paid = d.amount.WithCurrency(currency), d.paid.WithCurrency(currency)
+		debts = append(debts, d)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error getting debts: %w", err)
+	}
+
+	for _, d := range debts {
+		amount, err := convert(d.amount)
+		if err != nil {
+			return err
+		}
+		paid, err := convert(d.paid)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(`UPDATE debt_records SET branch_id = $2, amount = $3, paid_amount = $4, currency = $5 WHERE id = $1`,
+			d.id, toBranch, amount, paid, toCurrency)
+		if err != nil {
+			return fmt.Errorf("error moving debt: %w", err)
+		}
+	}
+	details.MovedDebts = len(debts)
+	return nil
+}
+
+// transferBalance converts the student's balance into the currency of the new branch
+func transferBalance(tx *sql.Tx, studentID string, toCurrency money.Currency, convert MoneyConverter, details *models.StudentTransferDetails) error {
+	var balance money.Money
+	var currency money.Currency
+	err := tx.QueryRow(`SELECT balance, currency FROM student_balance WHERE student_id = $1 FOR UPDATE`, studentID).Scan(&balance, &currency)
+	if err == sql.ErrNoRows {
+		details.BalanceBefore = money.New(0, details.FromCurrency)
+		details.BalanceAfter = money.New(0, toCurrency)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("error getting balance: %w", err)
+	}
+	balance = balance.WithCurrency(currency)
+	details.BalanceBefore = balance
+
+	converted, err := convert(balance)
+	if err != nil {
+		return err
+	}
+	details.BalanceAfter = converted
+	if currency == toCurrency {
+		return nil
+	}
+	_, err = tx.Exec(`UPDATE student_balance SET balance = $2, currency = $3, version = version + 1 WHERE student_id = $1`,
+		studentID, converted, toCurrency)
+	if err != nil {
+		return fmt.Errorf("error converting balance: %w", err)
+	}
+	return nil
+}
+
+func affected(result sql.Result) (int, error) {
+	n, err := result.RowsAffected()
+	return int(n), err
+}
+
+// GetStudentTransfers returns the transfers of a student, newest first
+func (r *BranchTransferRepository) GetStudentTransfers(studentID, companyID string) ([]models.StudentTransfer, error) {
+	rows, err := database.Tenant(r.db, companyID).Query(`
+		SELECT id, student_id, from_branch_id, to_branch_id, subscription_policy, COALESCE(reason, ''), details, created_by, created_at
+		FROM student_transfers
+		WHERE student_id = $1 AND company_id = $2
+		ORDER BY created_at DESC, id DESC`, studentID, companyID)
+	if err != nil {
+		return nil, fmt.Errorf("error getting student transfers: %w", err)
+	}
+	defer rows.Close()
+
+	transfers := []models.StudentTransfer{}
+	for rows.Next() {
+		var t models.StudentTransfer
+		var fromBranch, toBranch sql.NullString
+		var createdBy sql.NullInt64
+		var details []byte
+		if err := rows.Scan(&t.ID, &t.StudentID, &fromBranch, &toBranch, &t.SubscriptionPolicy, &t.Reason, &details, &createdBy, &t.CreatedAt); err != nil {
+			return nil, fmt.Errorf("error scanning student transfer: %w", err)
+		}
+		if fromBranch.Valid {
+			t.FromBranchID = &fromBranch.String
+		}
+		if toBranch.Valid {
+			t.ToBranchID = &toBranch.String
+		}
+		if createdBy.Valid {
+			id := int(createdBy.Int64)
+			t.CreatedBy = &id
+		}
+		if err := json.Unmarshal(details, &t.Details); err != nil {
+			return nil, fmt.Errorf("error decoding student transfer: %w", err)
+		}
+		t.Details.ApplyCurrency()
+		transfers = append(transfers, t)
+	}
+	return transfers, rows.Err()
+}
+
+// GetTeacherBranches returns the branches a teacher works in with the working hours there,
+// the primary branch first. Returns nil if the company has no such teacher.
+func (r *BranchTransferRepository) GetTeacherBranches(teacherID, companyID string) ([]models.TeacherBranch, error) {
+	var primary sql.NullString
+	err := database.Tenant(r.db, companyID).QueryRow(`SELECT branch_id FROM teachers WHERE id = $1 AND company_id = $2 AND deleted_at IS NULL`,
+		teacherID, companyID).Scan(&primary)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error getting teacher: %w", err)
+	}
+
+	rows, err := database.Tenant(r.db, companyID).Query(`
+		SELECT tb.branch_id, b.name, tb.schedule
+		FROM teacher_branches tb
+		JOIN branches b ON b.id = tb.branch_id
+		WHERE tb.teacher_id = $1 AND tb.company_id = $2 AND b.deleted_at IS NULL
+		ORDER BY tb.branch_id = $3 DESC, b.name`, teacherID, companyID, primary.String)
+	if err != nil {
+		return nil, fmt.Errorf("error getting teacher branches: %w", err)
+	}
+	defer rows.Close()
+
+	branches := []models.TeacherBranch{}
+	for rows.Next() {
+		var b models.TeacherBranch
+		var schedule []byte
+		if err := rows.Scan(&b.BranchID, &b.BranchName, &schedule); err != nil {
+			return nil, fmt.Errorf("error scanning teacher branch: %w", err)
+		}
+		if err := json.Unmarshal(schedule, &b.Schedule); err != nil {
+			return nil, fmt.Errorf("error decoding teacher schedule: %w", err)
+		}
+		b.Primary = b.BranchID == primary.String
+		branches = append(branches, b)
+	}
+	return branches, rows.Err()
+}
+
+// SetTeacherBranches replaces the branches a teacher works in and their working hours, and makes
+// primaryBranchID the teacher's primary branch. Returns sql.ErrNoRows if the company has no such
+// teacher and ErrBranchUnavailable if a branch is not one of the company's.
+func (r *BranchTransferRepository) SetTeacherBranches(actor database.Actor, teacherID, primaryBranchID string, branches []models.TeacherBranch) error {
+	return database.WithActor(r.db, actor, func(tx *sql.Tx) error {
+		companyID := actor.CompanyID
+		result, err := tx.Exec(`UPDATE teachers SET branch_id = $3 WHERE id = $1 AND company_id = $2 AND deleted_at IS NULL`,
+			teacherID, companyID, primaryBranchID)
+		if err != nil {
+			return fmt.Errorf("error updating teacher: %w", err)
+		}
+		if n, err := affected(result); err != nil || n == 0 {
+			if err != nil {
+				return fmt.Errorf("error updating teacher: %w", err)
+			}
+			return sql.ErrNoRows
+		}
+
+		if _, err := tx.Exec(`DELETE FROM teacher_branches WHERE teacher_id = $1 AND company_id = $2`, teacherID, companyID); err != nil {
+			return fmt.Errorf("error clearing teacher branches: %w", err)
+		}
+		for _, b := range branches {
+			schedule, err := json.Marshal(b.Schedule)
+			if err != nil {
+				return fmt.Errorf("error encoding teacher schedule: %w", err)
+			}
+			result, err := tx.Exec(`
+				INSERT INTO teacher_branches (teacher_id, branch_id, company_id, schedule)
+				SELECT $1, id, company_id, $3 FROM branches WHERE id = $2 AND company_id = $4 AND deleted_at IS NULL`,
+				teacherID, b.BranchID, schedule, companyID)
+			if err != nil {
+				return fmt.Errorf("error adding teacher branch: %w", err)
+			}
+			if n, err := affected(result); err != nil || n == 0 {
+				if err != nil {
+					return fmt.Errorf("error adding teacher branch: %w", err)
+				}
+				return ErrBranchUnavailable
+			}
+		}
+		return nil
+	})
+}
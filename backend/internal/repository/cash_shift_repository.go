@@ -0,0 +1,357 @@
+package repository
+
+import (
+	"classmate-central/internal/database"
+	"classmate-central/internal/models"
+	"classmate-central/internal/money"
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrNoOpenShift is returned when a cash operation requires an open shift and there is none
+	ErrNoOpenShift = errors.New("no open cash shift for this branch")
+	// ErrShiftAlreadyOpen is returned when opening a shift while another one is open in the branch
+	ErrShiftAlreadyOpen = errors.New("cash shift is already open for this branch")
+	// ErrShiftClosed is returned when modifying a closed shift or its cash transactions
+	ErrShiftClosed = errors.New("cash shift is closed")
+)
+
+type CashShiftRepository struct {
+	db *sql.DB
+}
+
+func NewCashShiftRepository(db *sql.DB) *CashShiftRepository {
+	return &CashShiftRepository{db: db}
+}
+
+const cashShiftColumns = `id, status, opening_float, expected_cash, counted_cash, discrepancy,
+	opened_by, closed_by, opened_at, closed_at, notes, company_id, branch_id, currency`
+
+func scanCashShift(row interface{ Scan(...interface{}) error }) (*models.CashShift, error) {
+	var shift models.CashShift
+	var openedBy, closedBy sql.NullInt64
+	var closedAt sql.NullTime
+	var notes sql.NullString
+	err := row.Scan(&shift.ID, &shift.Status, &shift.OpeningFloat, &shift.ExpectedCash, &shift.CountedCash, &shift.Discrepancy,
+		&openedBy, &closedBy, &shift.OpenedAt, &closedAt, &notes, &shift.CompanyID, &shift.BranchID, &shift.Currency)
+	if err != nil {
+		return nil, err
+	}
+	if openedBy.Valid {
+		id := int(openedBy.Int64)
+		shift.OpenedBy = &id
+	}
+	if closedBy.Valid {
+		id := int(closedBy.Int64)
+		shift.ClosedBy = &id
+	}
+	if closedAt.Valid {
+		shift.ClosedAt = &closedAt.Time
+	}
+	if notes.Valid {
+		shift.Notes = notes.String
+	}
+	shift.ApplyCurrency()
+	return &shift, nil
+}
+
+// Open opens a new shift for the branch. Only one shift per branch may be open at a time.
+func (r *CashShiftRepository) Open(shift *models.CashShift, companyID, branchID string) error {
+	dbTx, err := database.Tenant(r.db, companyID).Begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer dbTx.Rollback()
+
+	var exists bool
+	err = dbTx.QueryRow(`SELECT EXISTS(SELECT 1 FROM cash_shifts WHERE branch_id = $1 AND company_id = $2 AND status = 'open')`,
+		branchID, companyID).Scan(&exists)
+	if err != nil {
+		return fmt.Errorf("error checking open shift: %w", err)
+	}
+	if exists {
+		return ErrShiftAlreadyOpen
+	}
+
+	query := `INSERT INTO cash_shifts (status, opening_float, opened_by, notes, company_id, branch_id)
+	          VALUES ('open', $1, $2, $3, $4, $5) RETURNING ` + cashShiftColumns
+	created, err := scanCashShift(dbTx.QueryRow(query, shift.OpeningFloat, shift.OpenedBy, shift.Notes, companyID, branchID))
+	if err != nil {
+		return fmt.Errorf("error opening shift: %w", err)
+	}
+
+	if err = dbTx.Commit(); err != nil {
+		return fmt.Errorf("error committing transaction: %w", err)
+	}
+
+	*shift = *created
+	return nil
+}
+
+// GetOpenByBranch returns the currently open shift of the branch or nil if there is none
+func (r *CashShiftRepository) GetOpenByBranch(companyID, branchID string) (*models.CashShift, error) {
+	query := `SELECT ` + cashShiftColumns + ` FROM cash_shifts
+	          WHERE branch_id = $1 AND company_id = $2 AND status = 'open'`
+	shift, err := scanCashShift(database.Tenant(r.db, companyID).QueryRow(query, branchID, companyID))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error fetching open shift: %w", err)
+	}
+	return shift, nil
+}
+
+// GetByID returns a shift by ID
+func (r *CashShiftRepository) GetByID(id int, companyID string) (*models.CashShift, error) {
+	query := `SELECT ` + cashShiftColumns + ` FROM cash_shifts WHERE id = $1 AND company_id = $2`
+	shift, err := scanCashShift(database.Tenant(r.db, companyID).QueryRow(query, id, companyID))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error fetching shift: %w", err)
+	}
+	return shift, nil
+}
+
+// GetAll returns shifts of a branch, newest first. Empty branchID returns shifts of all branches.
+func (r *CashShiftRepository) GetAll(companyID, branchID string) ([]models.CashShift, error) {
+	query := `SELECT ` + cashShiftColumns + ` FROM cash_shifts
+	          WHERE company_id = $1 AND ($2 = '' OR branch_id = $2)
+	          ORDER BY opened_at DESC`
+	rows, err := database.Tenant(r.db, companyID).Query(query, companyID, branchID)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching shifts: %w", err)
+	}
+	defer rows.Close()
+
+	shifts := []models.CashShift{}
+	for rows.Next() {
+		shift, err := scanCashShift(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning shift: %w", err)
+		}
+		shifts = append(shifts, *shift)
+	}
+	return shifts, nil
+}
+
+// GetWithDiscrepancies returns closed shifts whose counted cash did not match the expected amount
+func (r *CashShiftRepository) GetWithDiscrepancies(companyID, branchID string, limit int) ([]models.CashShift, error) {
+	query := `SELECT ` + cashShiftColumns + ` FROM cash_shifts
+	          WHERE company_id = $1 AND ($2 = '' OR branch_id = $2)
+	            AND status = 'closed' AND discrepancy IS NOT NULL AND discrepancy <> 0
+	          ORDER BY closed_at DESC
+	          LIMIT $3`
+	rows, err := database.Tenant(r.db, companyID).Query(query, companyID, branchID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching shift discrepancies: %w", err)
+	}
+	defer rows.Close()
+
+	shifts := []models.CashShift{}
+	for rows.Next() {
+		shift, err := scanCashShift(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning shift: %w", err)
+		}
+		shifts = append(shifts, *shift)
+	}
+	return shifts, nil
+}
+
+// AddMovement records a cash-in or cash-out in the open shift of the branch
+func (r *CashShiftRepository) AddMovement(movement *models.CashMovement, companyID, branchID string) error {
+	dbTx, err := database.Tenant(r.db, companyID).Begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer dbTx.Rollback()
+
+	// Lock the open shift so it cannot be closed concurrently
+	var shiftID int
+	err = dbTx.QueryRow(`SELECT id FROM cash_shifts WHERE branch_id = $1 AND company_id = $2 AND status = 'open' FOR UPDATE`,
+		branchID, companyID).Scan(&shiftID)
+	if err == sql.ErrNoRows {
+		return ErrNoOpenShift
+	}
+	if err != nil {
+		return fmt.Errorf("error fetching open shift: %w", err)
+	}
+
+	query := `INSERT INTO cash_movements (shift_id, type, amount, reason, created_by, company_id, branch_id)
+	          VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id, created_at`
+	err = dbTx.QueryRow(query, shiftID, movement.Type, movement.Amount, movement.Reason, movement.CreatedBy, companyID, branchID).
+		Scan(&movement.ID, &movement.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("error creating cash movement: %w", err)
+	}
+
+	if err = dbTx.Commit(); err != nil {
+		return fmt.Errorf("error committing transaction: %w", err)
+	}
+
+	movement.ShiftID = shiftID
+	movement.CompanyID = companyID
+	movement.BranchID = branchID
+	return nil
+}
+
+// Close counts the shift: computes the expected cash, stores the counted amount and the discrepancy
+func (r *CashShiftRepository) Close(shiftID int, companyID string, countedCash money.Money, notes string, closedBy *int) (*models.CashShift, error) {
+	dbTx, err := database.Tenant(r.db, companyID).Begin()
+	if err != nil {
+		return nil, fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer dbTx.Rollback()
+
+	shift, err := scanCashShift(dbTx.QueryRow(`SELECT `+cashShiftColumns+` FROM cash_shifts
+		WHERE id = $1 AND company_id = $2 FOR UPDATE`, shiftID, companyID))
+	if err == sql.ErrNoRows {
+		return nil, sql.ErrNoRows
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error fetching shift: %w", err)
+	}
+	if shift.Status != "open" {
+		return nil, ErrShiftClosed
+	}
+
+	totals, err := shiftTotals(dbTx, shiftID)
+	if err != nil {
+		return nil, err
+	}
+	expected := ExpectedShiftCash(shift.OpeningFloat, totals)
+
+	if notes == "" {
+		notes = shift.Notes
+	}
+	query := `UPDATE cash_shifts
+	          SET status = 'closed', expected_cash = $1, counted_cash = $2, discrepancy = $2 - $1,
+	              closed_by = $3, closed_at = CURRENT_TIMESTAMP, notes = $4
+	          WHERE id = $5 AND company_id = $6
+	          RETURNING ` + cashShiftColumns
+	closed, err := scanCashShift(dbTx.QueryRow(query, expected, countedCash, closedBy, notes, shiftID, companyID))
+	if err != nil {
+		return nil, fmt.Errorf("error closing shift: %w", err)
+	}
+
+	if err = dbTx.Commit(); err != nil {
+		return nil, fmt.Errorf("error committing transaction: %w", err)
+	}
+	return closed, nil
+}
+
+// CashShiftTotals holds the cash flows of a shift
+type CashShiftTotals struct {
+	Payments money.Money
+	Refunds  money.Money
+	CashIns  money.Money
+	CashOuts money.Money
+}
+
+// ExpectedShiftCash returns the amount of cash that should be in the register
+func ExpectedShiftCash(openingFloat money.Money, t CashShiftTotals) money.Money {
+	return openingFloat.Add(t.Payments).Sub(t.Refunds).Add(t.CashIns).Sub(t.CashOuts)
+}
+
+type queryRower interface {
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+func shiftTotals(q queryRower, shiftID int) (CashShiftTotals, error) {
+	var t CashShiftTotals
+	err := q.QueryRow(`
+		SELECT
+			COALESCE(SUM(amount) FILTER (WHERE type = 'payment'), 0),
+			COALESCE(SUM(amount) FILTER (WHERE type = 'refund'), 0)
+		FROM payment_transactions
+		WHERE shift_id = $1 AND payment_method = 'cash'
+	`, shiftID).Scan(&t.Payments, &t.Refunds)
+	if err != nil {
+		return t, fmt.Errorf("error calculating shift payments: %w", err)
+	}
+
+	err = q.QueryRow(`
+		SELECT
+			COALESCE(SUM(amount) FILTER (WHERE type = 'cash_in'), 0),
+			COALESCE(SUM(amount) FILTER (WHERE type = 'cash_out'), 0)
+		FROM cash_movements
+		WHERE shift_id = $1
+	`, shiftID).Scan(&t.CashIns, &t.CashOuts)
+	if err != nil {
+		return t, fmt.Errorf("error calculating shift movements: %w", err)
+	}
+	return t, nil
+}
+
+// GetReport builds the reconciliation report of a shift
+func (r *CashShiftRepository) GetReport(shiftID int, companyID string) (*models.CashShiftReport, error) {
+	shift, err := r.GetByID(shiftID, companyID)
+	if err != nil {
+		return nil, err
+	}
+	if shift == nil {
+		return nil, sql.ErrNoRows
+	}
+
+	totals, err := shiftTotals(r.db, shiftID)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &models.CashShiftReport{
+		Shift:        *shift,
+		CashPayments: totals.Payments.WithCurrency(shift.Currency),
+		CashRefunds:  totals.Refunds.WithCurrency(shift.Currency),
+		CashIns:      totals.CashIns.WithCurrency(shift.Currency),
+		CashOuts:     totals.CashOuts.WithCurrency(shift.Currency),
+		ExpectedCash: ExpectedShiftCash(shift.OpeningFloat, totals),
+		Transactions: []models.PaymentTransaction{},
+		Movements:    []models.CashMovement{},
+	}
+	if shift.ExpectedCash != nil {
+		report.ExpectedCash = *shift.ExpectedCash
+	}
+
+	txRows, err := database.Tenant(r.db, companyID).Query(`SELECT id, student_id, amount, type, payment_method, description, created_at, created_by
+		FROM payment_transactions WHERE shift_id = $1 AND company_id = $2 ORDER BY created_at`, shiftID, companyID)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching shift transactions: %w", err)
+	}
+	defer txRows.Close()
+	for txRows.Next() {
+		var tx models.PaymentTransaction
+		var description sql.NullString
+		if err := txRows.Scan(&tx.ID, &tx.StudentID, &tx.Amount, &tx.Type, &tx.PaymentMethod, &description, &tx.CreatedAt, &tx.CreatedBy); err != nil {
+			return nil, fmt.Errorf("error scanning shift transaction: %w", err)
+		}
+		tx.Description = description.String
+		tx.ShiftID = &shiftID
+		tx.Currency = shift.Currency
+		tx.ApplyCurrency()
+		report.Transactions = append(report.Transactions, tx)
+	}
+
+	mvRows, err := database.Tenant(r.db, companyID).Query(`SELECT id, shift_id, type, amount, reason, created_by, created_at, company_id, COALESCE(branch_id, '')
+		FROM cash_movements WHERE shift_id = $1 AND company_id = $2 ORDER BY created_at`, shiftID, companyID)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching shift movements: %w", err)
+	}
+	defer mvRows.Close()
+	for mvRows.Next() {
+		var m models.CashMovement
+		var reason sql.NullString
+		if err := mvRows.Scan(&m.ID, &m.ShiftID, &m.Type, &m.Amount, &reason, &m.CreatedBy, &m.CreatedAt, &m.CompanyID, &m.BranchID); err != nil {
+			return nil, fmt.Errorf("error scanning cash movement: %w", err)
+		}
+		m.Reason = reason.String
+		m.Amount = m.Amount.WithCurrency(shift.Currency)
+		report.Movements = append(report.Movements, m)
+	}
+
+	return report, nil
+}
@@ -0,0 +1,662 @@
+package repository
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"classmate-central/internal/database"
+	"classmate-central/internal/models"
+
+	"github.com/lib/pq"
+)
+
+// ErrDataJobActive is returned when the company already has a wipe or restore in progress
+var ErrDataJobActive = errors.New("a data job is already running for this company")
+
+// ErrSnapshotFormat is returned for a snapshot written in a format this version cannot read
+var ErrSnapshotFormat = errors.New("unsupported snapshot format")
+
+// snapshotFormat versions the snapshot document
+const snapshotFormat = 1
+
+// restoreBatchSize is the number of rows inserted per statement when restoring
+const restoreBatchSize = 500
+
+// tenantTable is a table holding company data. scope is a condition on alias x that selects
+// the company's rows ($1 is the company ID); tables without a company_id reach it through
+// their parent.
+type tenantTable struct {
+	name  string
+	scope string
+}
+
+func byCompany(name string) tenantTable {
+	return tenantTable{name: name, scope: "x.company_id = $1"}
+}
+
+func byStudent(name string) tenantTable {
+	return tenantTable{name: name, scope: "x.student_id IN (SELECT id FROM students WHERE company_id = $1)"}
+}
+
+// wipeTables are cleared by a company data wipe, children before parents so that foreign
+// keys hold; a restore inserts them in reverse order.
+var wipeTables = []tenantTable{
+	byCompany("subscription_consumption"),
+	byCompany("lesson_attendance"),
+	byCompany("lesson_students"),
+	byCompany("lessons"),
+	byCompany("lesson_occurrence"),
+	byCompany("schedule_rule"),
+	byCompany("group_schedule"),
+	byCompany("fiscal_receipts"),
+	byCompany("debt_payments"),
+	byCompany("installments"),
+	byCompany("installment_plans"),
+	byCompany("transaction"),
+	byCompany("payment_intents"),
+	byCompany("invoice_item"),
+	byCompany("debt_records"),
+	byCompany("invoice"),
+	byCompany("cash_movements"),
+	byCompany("payment_transactions"),
+	byCompany("cash_shifts"),
+	{name: "subscription_freezes", scope: "x.subscription_id IN (SELECT id FROM student_subscriptions WHERE company_id = $1)"},
+	byCompany("student_subscriptions"),
+	byCompany("subscription_types"),
+	byCompany("enrollment"),
+	byCompany("individual_enrollment"),
+	byStudent("student_groups"),
+	byCompany("groups"),
+	byStudent("student_balance"),
+	byStudent("student_subjects"),
+	byCompany("student_activity_log"),
+	byCompany("student_notes"),
+	byCompany("notifications"),
+	byCompany("student_transfers"),
+	byCompany("students"),
+	byCompany("lead_activities"),
+	byCompany("lead_tasks"),
+	byCompany("leads"),
+	byCompany("teacher_branches"),
+	byCompany("teachers"),
+	byCompany("rooms"),
+	byCompany("tariffs"),
+}
+
+// accountTables survive a wipe - the company keeps its users, roles, branches and settings -
+// but are dumped too, so a snapshot is a full copy of the company. Sessions, tokens and logs
+// are left out.
+var accountTables = []tenantTable{
+	byCompany("company_sso_configs"),
+	byCompany("exchange_rates"),
+	byCompany("settings"),
+	byCompany("user_branches"),
+	byCompany("user_roles"),
+	{name: "role_permissions", scope: "x.role_id IN (SELECT id FROM roles WHERE company_id = $1)"},
+	byCompany("roles"),
+	byCompany("users"),
+	byCompany("branches"),
+}
+
+// snapshotDocument is the decompressed content of a snapshot
+type snapshotDocument struct {
+	Format    int                          `json:"format"`
+	CompanyID string                       `json:"companyId"`
+	CreatedAt time.Time                    `json:"createdAt"`
+	Tables    map[string][]json.RawMessage `json:"tables"`
+}
+
+type CompanyDataRepository struct {
+	db *sql.DB
+}
+
+func NewCompanyDataRepository(db *sql.DB) *CompanyDataRepository {
+	return &CompanyDataRepository{db: db}
+}
+
+// Wipe takes a snapshot of the company and deletes its business data in one transaction, so
+// either both happen or neither. progress is called with the name of each step. Returns the
+// snapshot ID and the number of rows deleted per table.
+func (r *CompanyDataRepository) Wipe(actor database.Actor, progress func(step string)) (int64, map[string]int64, error) {
+	var snapshotID int64
+	var deleted map[string]int64
+	err := r.inSnapshotTx(actor, func(tx *sql.Tx) error {
+		progress("snapshot")
+		snapshot, err := createSnapshot(tx, actor, "before_wipe")
+		if err != nil {
+			return err
+		}
+		snapshotID = snapshot.ID
+
+		progress("delete")
+		deleted, err = deleteCompanyData(tx, actor.CompanyID)
+		if err != nil {
+			return err
+		}
+
+		return recordAudit(tx, companyDataAuditEntry(actor, "clear_company_data", map[string]interface{}{
+			"before": deleted, "after": map[string]int64{}, "snapshotId": snapshotID,
+		}))
+	})
+	if err != nil {
+		return 0, nil, fmt.Errorf("error clearing company data: %w", err)
+	}
+	return snapshotID, deleted, nil
+}
+
+// Restore replaces the company's business data with the content of a snapshot. The current
+// data is snapshotted first, so a restore can be undone as well. Returns sql.ErrNoRows if the
+// company has no such snapshot.
+func (r *CompanyDataRepository) Restore(sourceID int64, actor database.Actor, progress func(step string)) (int64, map[string]int64, map[string]int64, error) {
+	var snapshotID int64
+	var deleted, restored map[string]int64
+	err := r.inSnapshotTx(actor, func(tx *sql.Tx) error {
+		progress("load")
+		doc, err := loadSnapshot(tx, actor.CompanyID, sourceID)
+		if err != nil {
+			return err
+		}
+
+		progress("snapshot")
+		snapshot, err := createSnapshot(tx, actor, "before_restore")
+		if err != nil {
+			return err
+		}
+		snapshotID = snapshot.ID
+
+		progress("delete")
+		deleted, err = deleteCompanyData(tx, actor.CompanyID)
+		if err != nil {
+			return err
+		}
+
+		progress("restore")
+		restored = map[string]int64{}
+		for i := len(wipeTables) - 1; i >= 0; i-- {
+			table := wipeTables[i].name
+			count, err := insertSnapshotRows(tx, table, doc.Tables[table])
+			if err != nil {
+				return err
+			}
+			if count > 0 {
+				restored[table] = count
+			}
+		}
+
+		return recordAudit(tx, companyDataAuditEntry(actor, "restore_company_data", map[string]interface{}{
+			"before": deleted, "after": restored, "sourceSnapshotId": sourceID, "snapshotId": snapshotID,
+		}))
+	})
+	if err == sql.ErrNoRows || errors.Is(err, ErrSnapshotFormat) {
+		return 0, nil, nil, err
+	}
+	if err != nil {
+		return 0, nil, nil, fmt.Errorf("error restoring company data: %w", err)
+	}
+	return snapshotID, deleted, restored, nil
+}
+
+// inSnapshotTx runs fn in a repeatable read transaction of the actor's company, so that the
+// snapshot and the deletes see exactly the same rows; a concurrent change makes the job fail
+// instead of slipping past the snapshot. One summary audit entry replaces the per-row ones.
+func (r *CompanyDataRepository) inSnapshotTx(actor database.Actor, fn func(tx *sql.Tx) error) error {
+	tx, err := database.Tenant(r.db, actor.CompanyID).BeginTx(context.Background(), &sql.TxOptions{Isolation: sql.LevelRepeatableRead})
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := database.SetActor(tx, actor); err != nil {
+		return err
+	}
+	if err := database.SuppressAudit(tx); err != nil {
+		return err
+	}
+	if err := fn(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// createSnapshot dumps every tenant table of the company into a new snapshot row
+func createSnapshot(tx *sql.Tx, actor database.Actor, reason string) (*models.CompanySnapshot, error) {
+	doc := snapshotDocument{
+		Format:    snapshotFormat,
+		CompanyID: actor.CompanyID,
+		CreatedAt: time.Now().UTC(),
+		Tables:    map[string][]json.RawMessage{},
+	}
+	for _, t := range append(append([]tenantTable{}, wipeTables...), accountTables...) {
+		rows, err := dumpTable(tx, t, actor.CompanyID)
+		if err != nil {
+			return nil, err
+		}
+		if len(rows) > 0 {
+			doc.Tables[t.name] = rows
+		}
+	}
+
+	data, err := encodeSnapshot(&doc)
+	if err != nil {
+		return nil, err
+	}
+	counts := snapshotRowCounts(&doc)
+	countsJSON, err := json.Marshal(counts)
+	if err != nil {
+		return nil, fmt.Errorf("error encoding snapshot counts: %w", err)
+	}
+	snapshot := &models.CompanySnapshot{
+		CompanyID: actor.CompanyID,
+		Reason:    reason,
+		RowCounts: counts,
+		SizeBytes: int64(len(data)),
+		CreatedBy: actorUserID(actor),
+	}
+	err = tx.QueryRow(`
+		INSERT INTO company_snapshots (company_id, reason, row_counts, size_bytes, data, created_by)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id, created_at`,
+		snapshot.CompanyID, snapshot.Reason, string(countsJSON), snapshot.SizeBytes, data, snapshot.CreatedBy,
+	).Scan(&snapshot.ID, &snapshot.CreatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("error saving snapshot: %w", err)
+	}
+	return snapshot, nil
+}
+
+// encodeSnapshot compresses a snapshot document
+func encodeSnapshot(doc *snapshotDocument) ([]byte, error) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if err := json.NewEncoder(zw).Encode(doc); err != nil {
+		return nil, fmt.Errorf("error encoding snapshot: %w", err)
+	}
+	if err := zw.Close(); err != nil {
+		return nil, fmt.Errorf("error compressing snapshot: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+func snapshotRowCounts(doc *snapshotDocument) map[string]int64 {
+	counts := map[string]int64{}
+	for table, rows := range doc.Tables {
+		counts[table] = int64(len(rows))
+	}
+	return counts
+}
+
+// saveSnapshotDocument replaces the content of an existing snapshot
+func saveSnapshotDocument(tx *sql.Tx, id int64, doc *snapshotDocument) error {
+	data, err := encodeSnapshot(doc)
+	if err != nil {
+		return err
+	}
+	countsJSON, err := json.Marshal(snapshotRowCounts(doc))
+	if err != nil {
+		return fmt.Errorf("error encoding snapshot counts: %w", err)
+	}
+	_, err = tx.Exec(`UPDATE company_snapshots SET data = $1, row_counts = $2, size_bytes = $3 WHERE id = $4`,
+		data, string(countsJSON), len(data), id)
+	if err != nil {
+		return fmt.Errorf("error saving snapshot: %w", err)
+	}
+	return nil
+}
+
+func dumpTable(tx *sql.Tx, t tenantTable, companyID string) ([]json.RawMessage, error) {
+	rows, err := tx.Query(fmt.Sprintf(`SELECT row_to_json(x)::text FROM %s x WHERE %s`, pq.QuoteIdentifier(t.name), t.scope), companyID)
+	if err != nil {
+		return nil, fmt.Errorf("error dumping %s: %w", t.name, err)
+	}
+	defer rows.Close()
+
+	result := []json.RawMessage{}
+	for rows.Next() {
+		var row string
+		if err := rows.Scan(&row); err != nil {
+			return nil, fmt.Errorf("error dumping %s: %w", t.name, err)
+		}
+		result = append(result, json.RawMessage(row))
+	}
+	return result, rows.Err()
+}
+
+func deleteCompanyData(tx *sql.Tx, companyID string) (map[string]int64, error) {
+	deleted := map[string]int64{}
+	for _, t := range wipeTables {
+		result, err := tx.Exec(fmt.Sprintf(`DELETE FROM %s x WHERE %s`, pq.QuoteIdentifier(t.name), t.scope), companyID)
+		if err != nil {
+			return nil, fmt.Errorf("error deleting %s: %w", t.name, err)
+		}
+		rows, err := result.RowsAffected()
+		if err != nil {
+			return nil, fmt.Errorf("error checking delete result: %w", err)
+		}
+		if rows > 0 {
+			deleted[t.name] = rows
+		}
+	}
+	return deleted, nil
+}
+
+func loadSnapshot(tx *sql.Tx, companyID string, id int64) (*snapshotDocument, error) {
+	var data []byte
+	err := tx.QueryRow(`SELECT data FROM company_snapshots WHERE id = $1 AND company_id = $2`, id, companyID).Scan(&data)
+	if err != nil {
+		return nil, err
+	}
+
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("error reading snapshot: %w", err)
+	}
+	raw, err := io.ReadAll(zr)
+	if err != nil {
+		return nil, fmt.Errorf("error reading snapshot: %w", err)
+	}
+	doc := &snapshotDocument{}
+	if err := json.Unmarshal(raw, doc); err != nil {
+		return nil, fmt.Errorf("error decoding snapshot: %w", err)
+	}
+	if doc.Format != snapshotFormat || doc.CompanyID != companyID {
+		return nil, ErrSnapshotFormat
+	}
+	return doc, nil
+}
+
+// insertSnapshotRows inserts dumped rows back into their table. Only columns that exist in
+// both the dump and the current schema are written, so snapshots survive added or dropped
+// columns; generated columns are computed again.
+func insertSnapshotRows(tx *sql.Tx, table string, rows []json.RawMessage) (int64, error) {
+	if len(rows) == 0 {
+		return 0, nil
+	}
+
+	var sample map[string]json.RawMessage
+	if err := json.Unmarshal(rows[0], &sample); err != nil {
+		return 0, fmt.Errorf("error decoding %s rows: %w", table, err)
+	}
+	columnRows, err := tx.Query(`
+		SELECT column_name FROM information_schema.columns
+		WHERE table_schema = 'public' AND table_name = $1 AND is_generated = 'NEVER'
+		ORDER BY ordinal_position`, table)
+	if err != nil {
+		return 0, fmt.Errorf("error reading %s columns: %w", table, err)
+	}
+	var columns []string
+	for columnRows.Next() {
+		var column string
+		if err := columnRows.Scan(&column); err != nil {
+			columnRows.Close()
+			return 0, fmt.Errorf("error reading %s columns: %w", table, err)
+		}
+		if _, ok := sample[column]; ok {
+			columns = append(columns, pq.QuoteIdentifier(column))
+		}
+	}
+	columnRows.Close()
+	if err := columnRows.Err(); err != nil {
+		return 0, fmt.Errorf("error reading %s columns: %w", table, err)
+	}
+
+	columnList := strings.Join(columns, ", ")
+	query := fmt.Sprintf(`INSERT INTO %[1]s (%[2]s) SELECT %[2]s FROM json_populate_recordset(NULL::%[1]s, $1)`,
+		pq.QuoteIdentifier(table), columnList)
+
+	var inserted int64
+	for start := 0; start < len(rows); start += restoreBatchSize {
+		end := start + restoreBatchSize
+		if end > len(rows) {
+			end = len(rows)
+		}
+		batch, err := json.Marshal(rows[start:end])
+		if err != nil {
+			return inserted, fmt.Errorf("error encoding %s rows: %w", table, err)
+		}
+		result, err := tx.Exec(query, string(batch))
+		if err != nil {
+			return inserted, fmt.Errorf("error restoring %s: %w", table, err)
+		}
+		count, err := result.RowsAffected()
+		if err != nil {
+			return inserted, fmt.Errorf("error checking restore result: %w", err)
+		}
+		inserted += count
+	}
+	return inserted, nil
+}
+
+func companyDataAuditEntry(actor database.Actor, action string, changes map[string]interface{}) *models.AuditEntry {
+	data, _ := json.Marshal(changes)
+	companyID := actor.CompanyID
+	entry := &models.AuditEntry{
+		CompanyID:  companyID,
+		UserID:     actorUserID(actor),
+		Action:     action,
+		EntityType: "company",
+		EntityID:   &companyID,
+		Changes:    data,
+	}
+	if actor.ImpersonatedBy != 0 {
+		impersonatedBy := actor.ImpersonatedBy
+		entry.ImpersonatedBy = &impersonatedBy
+	}
+	if actor.IP != "" {
+		entry.IPAddress = &actor.IP
+	}
+	if actor.RequestID != "" {
+		entry.RequestID = &actor.RequestID
+	}
+	return entry
+}
+
+func actorUserID(actor database.Actor) *int {
+	if actor.UserID == 0 {
+		return nil
+	}
+	id := actor.UserID
+	return &id
+}
+
+// GetSnapshot returns a snapshot of the company without its data
+func (r *CompanyDataRepository) GetSnapshot(companyID string, id int64) (*models.CompanySnapshot, error) {
+	snapshots, err := r.listSnapshots(companyID, `WHERE company_id = $1 AND id = $2`, companyID, id)
+	if err != nil || len(snapshots) == 0 {
+		return nil, err
+	}
+	return snapshots[0], nil
+}
+
+// ListSnapshots returns the company's snapshots, newest first
+func (r *CompanyDataRepository) ListSnapshots(companyID string) ([]*models.CompanySnapshot, error) {
+	return r.listSnapshots(companyID, `WHERE company_id = $1`, companyID)
+}
+
+func (r *CompanyDataRepository) listSnapshots(companyID, where string, args ...interface{}) ([]*models.CompanySnapshot, error) {
+	rows, err := database.Tenant(r.db, companyID).Query(`
+		SELECT id, company_id, reason, row_counts, size_bytes, created_by, created_at
+		FROM company_snapshots `+where+`
+		ORDER BY created_at DESC, id DESC`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error listing snapshots: %w", err)
+	}
+	defer rows.Close()
+
+	snapshots := []*models.CompanySnapshot{}
+	for rows.Next() {
+		s := &models.CompanySnapshot{}
+		var counts []byte
+		var createdBy sql.NullInt64
+		if err := rows.Scan(&s.ID, &s.CompanyID, &s.Reason, &counts, &s.SizeBytes, &createdBy, &s.CreatedAt); err != nil {
+			return nil, fmt.Errorf("error scanning snapshot: %w", err)
+		}
+		if err := json.Unmarshal(counts, &s.RowCounts); err != nil {
+			return nil, fmt.Errorf("error decoding snapshot counts: %w", err)
+		}
+		if createdBy.Valid {
+			id := int(createdBy.Int64)
+			s.CreatedBy = &id
+		}
+		snapshots = append(snapshots, s)
+	}
+	return snapshots, rows.Err()
+}
+
+// DeleteSnapshotsOlderThan removes snapshots taken before the given time. An empty companyID
+// covers all companies.
+func (r *CompanyDataRepository) DeleteSnapshotsOlderThan(before time.Time, companyID string) (int64, error) {
+	result, err := database.TenantOrSystem(r.db, companyID).Exec(`DELETE FROM company_snapshots WHERE created_at < $1 AND ($2 = '' OR company_id = $2)`,
+		before, companyID)
+	if err != nil {
+		return 0, fmt.Errorf("error deleting old snapshots: %w", err)
+	}
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("error checking delete result: %w", err)
+	}
+	return deleted, nil
+}
+
+// CreateJob registers a pending job. Returns ErrDataJobActive if the company already has an
+// unfinished one.
+func (r *CompanyDataRepository) CreateJob(job *models.CompanyDataJob) error {
+	job.Status = models.DataJobPending
+	err := database.Tenant(r.db, job.CompanyID).QueryRow(`
+		INSERT INTO company_data_jobs (company_id, kind, status, source_snapshot_id, created_by)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, created_at`,
+		job.CompanyID, job.Kind, job.Status, job.SourceSnapshotID, job.CreatedBy,
+	).Scan(&job.ID, &job.CreatedAt)
+	if err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+			return ErrDataJobActive
+		}
+		return fmt.Errorf("error creating data job: %w", err)
+	}
+	return nil
+}
+
+// SetJobStep marks a job running and records the step it is in
+func (r *CompanyDataRepository) SetJobStep(id int64, step string) error {
+	_, err := database.System(r.db).Exec(`
+		UPDATE company_data_jobs
+		SET status = $2, step = $3, started_at = COALESCE(started_at, NOW())
+		WHERE id = $1`, id, models.DataJobRunning, step)
+	if err != nil {
+		return fmt.Errorf("error updating data job: %w", err)
+	}
+	return nil
+}
+
+// CompleteJob marks a job completed with the snapshot it took and its result
+func (r *CompanyDataRepository) CompleteJob(id, snapshotID int64, result interface{}) error {
+	data, err := json.Marshal(result)
+	if err != nil {
+		return fmt.Errorf("error encoding data job result: %w", err)
+	}
+	_, err = database.System(r.db).Exec(`
+		UPDATE company_data_jobs
+		SET status = $2, step = '', snapshot_id = $3, result = $4, completed_at = NOW()
+		WHERE id = $1`, id, models.DataJobCompleted, snapshotID, string(data))
+	if err != nil {
+		return fmt.Errorf("error completing data job: %w", err)
+	}
+	return nil
+}
+
+// FailJob marks a job failed
+func (r *CompanyDataRepository) FailJob(id int64, message string) error {
+	_, err := database.System(r.db).Exec(`
+		UPDATE company_data_jobs SET status = $2, error = $3, completed_at = NOW()
+		WHERE id = $1`, id, models.DataJobFailed, message)
+	if err != nil {
+		return fmt.Errorf("error failing data job: %w", err)
+	}
+	return nil
+}
+
+// FailUnfinishedJobs marks the jobs of all companies that are still pending or running as
+// failed. Their transactions did not survive the process that ran them.
+func (r *CompanyDataRepository) FailUnfinishedJobs(message string) (int64, error) {
+	result, err := database.System(r.db).Exec(`
+		UPDATE company_data_jobs SET status = $1, error = $2, completed_at = NOW()
+		WHERE status IN ($3, $4)`, models.DataJobFailed, message, models.DataJobPending, models.DataJobRunning)
+	if err != nil {
+		return 0, fmt.Errorf("error failing unfinished data jobs: %w", err)
+	}
+	failed, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("error checking update result: %w", err)
+	}
+	return failed, nil
+}
+
+const dataJobColumns = `id, company_id, kind, status, step, source_snapshot_id, snapshot_id, result,
+	COALESCE(error, ''), created_by, created_at, started_at, completed_at`
+
+// GetJob returns a job of the company
+func (r *CompanyDataRepository) GetJob(companyID string, id int64) (*models.CompanyDataJob, error) {
+	jobs, err := r.queryJobs(companyID, `SELECT `+dataJobColumns+` FROM company_data_jobs WHERE company_id = $1 AND id = $2`, companyID, id)
+	if err != nil || len(jobs) == 0 {
+		return nil, err
+	}
+	return jobs[0], nil
+}
+
+// ListJobs returns the company's latest jobs, newest first
+func (r *CompanyDataRepository) ListJobs(companyID string, limit int) ([]*models.CompanyDataJob, error) {
+	return r.queryJobs(companyID, `
+		SELECT `+dataJobColumns+` FROM company_data_jobs
+		WHERE company_id = $1
+		ORDER BY created_at DESC, id DESC
+		LIMIT $2`, companyID, limit)
+}
+
+func (r *CompanyDataRepository) queryJobs(companyID, query string, args ...interface{}) ([]*models.CompanyDataJob, error) {
+	rows, err := database.Tenant(r.db, companyID).Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error listing data jobs: %w", err)
+	}
+	defer rows.Close()
+
+	jobs := []*models.CompanyDataJob{}
+	for rows.Next() {
+		job := &models.CompanyDataJob{}
+		var sourceID, snapshotID, createdBy sql.NullInt64
+		var result []byte
+		var startedAt, completedAt sql.NullTime
+		err := rows.Scan(&job.ID, &job.CompanyID, &job.Kind, &job.Status, &job.Step, &sourceID, &snapshotID, &result,
+			&job.Error, &createdBy, &job.CreatedAt, &startedAt, &completedAt)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning data job: %w", err)
+		}
+		if sourceID.Valid {
+			job.SourceSnapshotID = &sourceID.Int64
+		}
+		if snapshotID.Valid {
+			job.SnapshotID = &snapshotID.Int64
+		}
+		if createdBy.Valid {
+			id := int(createdBy.Int64)
+			job.CreatedBy = &id
+		}
+		if startedAt.Valid {
+			job.StartedAt = &startedAt.Time
+		}
+		if completedAt.Valid {
+			job.CompletedAt = &completedAt.Time
+		}
+		job.Result = result
+		jobs = append(jobs, job)
+	}
+	return jobs, rows.Err()
+}
@@ -4,6 +4,7 @@ import (
 	"database/sql"
 	"fmt"
 
+	"classmate-central/internal/database"
 	"classmate-central/internal/models"
 
 	"github.com/google/uuid"
@@ -32,11 +33,11 @@ func (r *CompanyRepository) Create(company *models.Company) error {
 	query := `
 		INSERT INTO companies (id, name, status, created_at, updated_at)
 		VALUES ($1, $2, $3, NOW(), NOW())
-		RETURNING created_at, updated_at
+		RETURNING plan_id, created_at, updated_at
 	`
 
-	err := r.db.QueryRow(query, company.ID, company.Name, company.Status).
-		Scan(&company.CreatedAt, &company.UpdatedAt)
+	err := database.Tenant(r.db, company.ID).QueryRow(query, company.ID, company.Name, company.Status).
+		Scan(&company.PlanID, &company.CreatedAt, &company.UpdatedAt)
 	if err != nil {
 		return fmt.Errorf("error creating company: %w", err)
 	}
@@ -47,10 +48,11 @@ func (r *CompanyRepository) Create(company *models.Company) error {
 // GetByID retrieves a company by ID
 func (r *CompanyRepository) GetByID(id string) (*models.Company, error) {
 	company := &models.Company{}
-	query := `SELECT id, name, status, created_at, updated_at FROM companies WHERE id = $1`
+	query := `SELECT id, name, status, plan_id, created_at, updated_at, suspended_at, suspension_reason FROM companies WHERE id = $1`
 
-	err := r.db.QueryRow(query, id).Scan(
-		&company.ID, &company.Name, &company.Status, &company.CreatedAt, &company.UpdatedAt,
+	err := database.Tenant(r.db, id).QueryRow(query, id).Scan(
+		&company.ID, &company.Name, &company.Status, &company.PlanID, &company.CreatedAt, &company.UpdatedAt,
+		&company.SuspendedAt, &company.SuspensionReason,
 	)
 	if err == sql.ErrNoRows {
 		return nil, nil
@@ -64,9 +66,9 @@ func (r *CompanyRepository) GetByID(id string) (*models.Company, error) {
 
 // GetAll retrieves all companies
 func (r *CompanyRepository) GetAll() ([]*models.Company, error) {
-	query := `SELECT id, name, status, created_at, updated_at FROM companies ORDER BY created_at DESC`
+	query := `SELECT id, name, status, plan_id, created_at, updated_at, suspended_at, suspension_reason FROM companies ORDER BY created_at DESC`
 
-	rows, err := r.db.Query(query)
+	rows, err := database.System(r.db).Query(query)
 	if err != nil {
 		return nil, fmt.Errorf("error getting companies: %w", err)
 	}
@@ -76,7 +78,8 @@ func (r *CompanyRepository) GetAll() ([]*models.Company, error) {
 	for rows.Next() {
 		company := &models.Company{}
 		err := rows.Scan(
-			&company.ID, &company.Name, &company.Status, &company.CreatedAt, &company.UpdatedAt,
+			&company.ID, &company.Name, &company.Status, &company.PlanID, &company.CreatedAt, &company.UpdatedAt,
+			&company.SuspendedAt, &company.SuspensionReason,
 		)
 		if err != nil {
 			return nil, fmt.Errorf("error scanning company: %w", err)
@@ -96,7 +99,7 @@ func (r *CompanyRepository) Update(company *models.Company) error {
 		RETURNING updated_at
 	`
 
-	err := r.db.QueryRow(query, company.Name, company.Status, company.ID).
+	err := database.Tenant(r.db, company.ID).QueryRow(query, company.Name, company.Status, company.ID).
 		Scan(&company.UpdatedAt)
 	if err != nil {
 		return fmt.Errorf("error updating company: %w", err)
@@ -109,7 +112,7 @@ func (r *CompanyRepository) Update(company *models.Company) error {
 func (r *CompanyRepository) Delete(id string) error {
 	query := `UPDATE companies SET status = 'inactive', updated_at = NOW() WHERE id = $1`
 
-	_, err := r.db.Exec(query, id)
+	_, err := database.Tenant(r.db, id).Exec(query, id)
 	if err != nil {
 		return fmt.Errorf("error deleting company: %w", err)
 	}
@@ -0,0 +1,228 @@
+package repository
+
+import (
+	"classmate-central/internal/database"
+	"classmate-central/internal/models"
+	"classmate-central/internal/money"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	// ErrCurrencyInUse is returned when changing the currency of a company or branch that already has payments in another currency
+	ErrCurrencyInUse = errors.New("payments in another currency already exist")
+	// ErrRateExists is returned when a rate for the same currency pair and date already exists
+	ErrRateExists = errors.New("exchange rate for this date already exists")
+)
+
+type CurrencyRepository struct {
+	db *sql.DB
+}
+
+func NewCurrencyRepository(db *sql.DB) *CurrencyRepository {
+	return &CurrencyRepository{db: db}
+}
+
+// GetBaseCurrency returns the base currency of the company
+func (r *CurrencyRepository) GetBaseCurrency(companyID string) (money.Currency, error) {
+	var cur money.Currency
+	err := database.Tenant(r.db, companyID).QueryRow(`SELECT base_currency FROM companies WHERE id = $1`, companyID).Scan(&cur)
+	if err == sql.ErrNoRows {
+		return money.DefaultCurrency, nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("error getting base currency: %w", err)
+	}
+	return cur, nil
+}
+
+// GetSettings returns the base currency of the company and the currency of every branch
+func (r *CurrencyRepository) GetSettings(companyID string) (*models.CurrencySettings, error) {
+	base, err := r.GetBaseCurrency(companyID)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := database.Tenant(r.db, companyID).Query(`
+		SELECT id, name, currency
+		FROM branches
+		WHERE company_id = $1 AND deleted_at IS NULL
+		ORDER BY name`, companyID)
+	if err != nil {
+		return nil, fmt.Errorf("error getting branch currencies: %w", err)
+	}
+	defer rows.Close()
+
+	settings := &models.CurrencySettings{
+		BaseCurrency: base,
+		Supported:    money.SupportedCurrencies(),
+		Branches:     []models.BranchCurrency{},
+	}
+	for rows.Next() {
+		var b models.BranchCurrency
+		var cur sql.NullString
+		if err := rows.Scan(&b.BranchID, &b.BranchName, &cur); err != nil {
+			return nil, fmt.Errorf("error scanning branch currency: %w", err)
+		}
+		b.EffectiveCurrency = base
+		if cur.Valid {
+			c := money.Currency(cur.String)
+			b.Currency = &c
+			b.EffectiveCurrency = c
+		}
+		settings.Branches = append(settings.Branches, b)
+	}
+	return settings, rows.Err()
+}
+
+// SetCompanyCurrency changes the base currency of the company. Branches without their own
+// currency follow it, so it is refused when such branches already have payments in another currency.
+func (r *CurrencyRepository) SetCompanyCurrency(cur money.Currency, companyID string) error {
+	var conflicts int
+	err := database.Tenant(r.db, companyID).QueryRow(`
+		SELECT COUNT(*) FROM payment_transactions pt
+		LEFT JOIN branches b ON b.id = pt.branch_id
+		WHERE pt.company_id = $1 AND b.currency IS NULL AND pt.currency <> $2`,
+		companyID, cur).Scan(&conflicts)
+	if err != nil {
+		return fmt.Errorf("error checking existing payments: %w", err)
+	}
+	if conflicts > 0 {
+		return ErrCurrencyInUse
+	}
+
+	result, err := database.Tenant(r.db, companyID).Exec(`UPDATE companies SET base_currency = $1 WHERE id = $2`, cur, companyID)
+	if err != nil {
+		return fmt.Errorf("error updating base currency: %w", err)
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// SetBranchCurrency sets the currency of a branch; nil resets it to the company base currency
+func (r *CurrencyRepository) SetBranchCurrency(branchID string, cur *money.Currency, companyID string) error {
+	effective := cur
+	if effective == nil {
+		base, err := r.GetBaseCurrency(companyID)
+		if err != nil {
+			return err
+		}
+		effective = &base
+	}
+
+	var conflicts int
+	err := database.Tenant(r.db, companyID).QueryRow(`
+		SELECT COUNT(*) FROM payment_transactions
+		WHERE company_id = $1 AND branch_id = $2 AND currency <> $3`,
+		companyID, branchID, *effective).Scan(&conflicts)
+	if err != nil {
+		return fmt.Errorf("error checking existing payments: %w", err)
+	}
+	if conflicts > 0 {
+		return ErrCurrencyInUse
+	}
+
+	result, err := database.Tenant(r.db, companyID).Exec(`UPDATE branches SET currency = $1 WHERE id = $2 AND company_id = $3`, cur, branchID, companyID)
+	if err != nil {
+		return fmt.Errorf("error updating branch currency: %w", err)
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+const exchangeRateColumns = `id, from_currency, to_currency, rate, effective_date, created_by, created_at, company_id`
+
+func scanExchangeRates(rows *sql.Rows) ([]models.ExchangeRate, error) {
+	rates := []models.ExchangeRate{}
+	for rows.Next() {
+		var rate models.ExchangeRate
+		var createdBy sql.NullInt64
+		if err := rows.Scan(&rate.ID, &rate.FromCurrency, &rate.ToCurrency, &rate.Rate, &rate.EffectiveDate,
+			&createdBy, &rate.CreatedAt, &rate.CompanyID); err != nil {
+			return nil, fmt.Errorf("error scanning exchange rate: %w", err)
+		}
+		if createdBy.Valid {
+			id := int(createdBy.Int64)
+			rate.CreatedBy = &id
+		}
+		rates = append(rates, rate)
+	}
+	return rates, rows.Err()
+}
+
+// GetRates returns the exchange rates of the company, newest first. Empty currencies are not filtered.
+func (r *CurrencyRepository) GetRates(from, to money.Currency, companyID string) ([]models.ExchangeRate, error) {
+	query := `SELECT ` + exchangeRateColumns + ` FROM exchange_rates
+		WHERE company_id = $1
+		AND ($2 = '' OR from_currency = $2)
+		AND ($3 = '' OR to_currency = $3)
+		ORDER BY effective_date DESC, from_currency, to_currency`
+	rows, err := database.Tenant(r.db, companyID).Query(query, companyID, string(from), string(to))
+	if err != nil {
+		return nil, fmt.Errorf("error getting exchange rates: %w", err)
+	}
+	defer rows.Close()
+	return scanExchangeRates(rows)
+}
+
+// GetRatesUntil returns all rates of the company effective on or before the given date
+func (r *CurrencyRepository) GetRatesUntil(until time.Time, companyID string) ([]models.ExchangeRate, error) {
+	query := `SELECT ` + exchangeRateColumns + ` FROM exchange_rates
+		WHERE company_id = $1 AND effective_date <= $2
+		ORDER BY effective_date`
+	rows, err := database.Tenant(r.db, companyID).Query(query, companyID, until)
+	if err != nil {
+		return nil, fmt.Errorf("error getting exchange rates: %w", err)
+	}
+	defer rows.Close()
+	return scanExchangeRates(rows)
+}
+
+// CreateRate stores a new exchange rate
+func (r *CurrencyRepository) CreateRate(rate *models.ExchangeRate, companyID string) error {
+	query := `
+		INSERT INTO exchange_rates (company_id, from_currency, to_currency, rate, effective_date, created_by)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (company_id, from_currency, to_currency, effective_date) DO NOTHING
+		RETURNING id, created_at`
+	err := database.Tenant(r.db, companyID).QueryRow(query, companyID, rate.FromCurrency, rate.ToCurrency, rate.Rate, rate.EffectiveDate, rate.CreatedBy).
+		Scan(&rate.ID, &rate.CreatedAt)
+	if err == sql.ErrNoRows {
+		return ErrRateExists
+	}
+	if err != nil {
+		return fmt.Errorf("error creating exchange rate: %w", err)
+	}
+	rate.CompanyID = companyID
+	return nil
+}
+
+// DeleteRate deletes an exchange rate
+func (r *CurrencyRepository) DeleteRate(id int, companyID string) error {
+	result, err := database.Tenant(r.db, companyID).Exec(`DELETE FROM exchange_rates WHERE id = $1 AND company_id = $2`, id, companyID)
+	if err != nil {
+		return fmt.Errorf("error deleting exchange rate: %w", err)
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
@@ -1,8 +1,13 @@
 package repository
 
 import (
+	"classmate-central/internal/database"
 	"classmate-central/internal/models"
+	"classmate-central/internal/money"
 	"database/sql"
+	"fmt"
+	"strings"
+	"time"
 )
 
 type DebtRepository struct {
@@ -13,29 +18,22 @@ func NewDebtRepository(db *sql.DB) *DebtRepository {
 	return &DebtRepository{db: db}
 }
 
-func (r *DebtRepository) Create(debt *models.DebtRecord, companyID string) error {
-	query := `INSERT INTO debt_records (student_id, amount, due_date, status, notes, company_id) 
-	          VALUES ($1, $2, $3, $4, $5, $6) RETURNING id, created_at`
-	return r.db.QueryRow(query, debt.StudentID, debt.Amount, debt.DueDate, debt.Status, debt.Notes, companyID).
-		Scan(&debt.ID, &debt.CreatedAt)
-}
+const debtColumns = `id, student_id, amount, paid_amount, due_date, status, source, invoice_id, notes, created_at, settled_at, company_id, COALESCE(branch_id, ''), currency`
 
-func (r *DebtRepository) GetByStudent(studentID string, companyID string) ([]models.DebtRecord, error) {
-	query := `SELECT id, student_id, amount, due_date, status, notes, created_at 
-	          FROM debt_records WHERE student_id = $1 AND company_id = $2 ORDER BY created_at DESC`
-	rows, err := r.db.Query(query, studentID, companyID)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
+// notTrashed hides debts of students in the trash from lists, reports and reminders. The debts stay
+// and reappear when the student is restored.
+const notTrashed = `NOT EXISTS (SELECT 1 FROM students s WHERE s.id = debt_records.student_id AND s.deleted_at IS NOT NULL)`
 
+func scanDebts(rows *sql.Rows) ([]models.DebtRecord, error) {
 	debts := []models.DebtRecord{}
 	for rows.Next() {
 		var debt models.DebtRecord
 		var notes sql.NullString
-		if err := rows.Scan(&debt.ID, &debt.StudentID, &debt.Amount, &debt.DueDate, &debt.Status, &notes, &debt.CreatedAt); err != nil {
+		if err := rows.Scan(&debt.ID, &debt.StudentID, &debt.Amount, &debt.PaidAmount, &debt.DueDate, &debt.Status,
+			&debt.Source, &debt.InvoiceID, &notes, &debt.CreatedAt, &debt.SettledAt, &debt.CompanyID, &debt.BranchID, &debt.Currency); err != nil {
 			return nil, err
 		}
+		debt.ApplyCurrency()
 		if notes.Valid {
 			debt.Notes = notes.String
 		}
@@ -44,87 +42,309 @@ func (r *DebtRepository) GetByStudent(studentID string, companyID string) ([]mod
 	return debts, nil
 }
 
-func (r *DebtRepository) GetAll(companyID string) ([]models.DebtRecord, error) {
-	query := `SELECT id, student_id, amount, due_date, status, notes, created_at 
-	          FROM debt_records WHERE company_id = $1 ORDER BY created_at DESC`
-	rows, err := r.db.Query(query, companyID)
+func (r *DebtRepository) Create(debt *models.DebtRecord, companyID string) error {
+	if debt.Status == "" {
+		debt.Status = "pending"
+	}
+	if debt.Source == "" {
+		debt.Source = "manual"
+	}
+	query := `INSERT INTO debt_records (student_id, amount, due_date, status, source, notes, company_id, branch_id)
+	          VALUES ($1, $2, $3, $4, $5, $6, $7, COALESCE(NULLIF($8, ''), (SELECT branch_id FROM students WHERE id = $1)))
+	          RETURNING id, created_at, COALESCE(branch_id, ''), currency`
+	err := database.Tenant(r.db, companyID).QueryRow(query, debt.StudentID, debt.Amount, debt.DueDate, debt.Status, debt.Source, debt.Notes, companyID, debt.BranchID).
+		Scan(&debt.ID, &debt.CreatedAt, &debt.BranchID, &debt.Currency)
+	debt.ApplyCurrency()
+	return err
+}
+
+func (r *DebtRepository) GetByStudent(studentID string, companyID string) ([]models.DebtRecord, error) {
+	query := `SELECT ` + debtColumns + `
+	          FROM debt_records WHERE student_id = $1 AND company_id = $2 ORDER BY created_at DESC`
+	rows, err := database.Tenant(r.db, companyID).Query(query, studentID, companyID)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	debts := []models.DebtRecord{}
-	for rows.Next() {
-		var debt models.DebtRecord
-		var notes sql.NullString
-		if err := rows.Scan(&debt.ID, &debt.StudentID, &debt.Amount, &debt.DueDate, &debt.Status, &notes, &debt.CreatedAt); err != nil {
-			return nil, err
-		}
-		if notes.Valid {
-			debt.Notes = notes.String
-		}
-		debts = append(debts, debt)
+	return scanDebts(rows)
+}
+
+func (r *DebtRepository) GetAll(companyID string) ([]models.DebtRecord, error) {
+	query := `SELECT ` + debtColumns + `
+	          FROM debt_records WHERE company_id = $1 AND ` + notTrashed + ` ORDER BY created_at DESC`
+	rows, err := database.Tenant(r.db, companyID).Query(query, companyID)
+	if err != nil {
+		return nil, err
 	}
-	return debts, nil
+	defer rows.Close()
+
+	return scanDebts(rows)
 }
 
 func (r *DebtRepository) GetByStatus(status string, companyID string) ([]models.DebtRecord, error) {
-	query := `SELECT id, student_id, amount, due_date, status, notes, created_at 
-	          FROM debt_records WHERE status = $1 AND company_id = $2 ORDER BY created_at DESC`
-	rows, err := r.db.Query(query, status, companyID)
+	query := `SELECT ` + debtColumns + `
+	          FROM debt_records WHERE status = $1 AND company_id = $2 AND ` + notTrashed + ` ORDER BY created_at DESC`
+	rows, err := database.Tenant(r.db, companyID).Query(query, status, companyID)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	debts := []models.DebtRecord{}
+	return scanDebts(rows)
+}
+
+// GetOutstanding returns unpaid and partially paid debts, optionally limited to the given branches
+func (r *DebtRepository) GetOutstanding(companyID string, branchIDs []string) ([]models.DebtRecord, error) {
+	query := `SELECT ` + debtColumns + `
+	          FROM debt_records
+	          WHERE company_id = $1 AND status IN ('pending', 'partially_paid') AND amount > paid_amount AND ` + notTrashed
+	args := []interface{}{companyID}
+	if len(branchIDs) > 0 {
+		placeholders := make([]string, len(branchIDs))
+		for i, bid := range branchIDs {
+			placeholders[i] = fmt.Sprintf("$%d", i+2)
+			args = append(args, bid)
+		}
+		query += fmt.Sprintf(` AND branch_id IN (%s)`, strings.Join(placeholders, ","))
+	}
+	query += ` ORDER BY COALESCE(due_date, created_at), id`
+
+	rows, err := database.Tenant(r.db, companyID).Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching outstanding debts: %w", err)
+	}
+	defer rows.Close()
+
+	return scanDebts(rows)
+}
+
+// GetPayments returns the payment allocations of a debt
+func (r *DebtRepository) GetPayments(debtID int, companyID string) ([]models.DebtPayment, error) {
+	query := `SELECT id, debt_id, payment_transaction_id, amount, created_at, company_id
+	          FROM debt_payments WHERE debt_id = $1 AND company_id = $2 ORDER BY created_at`
+	rows, err := database.Tenant(r.db, companyID).Query(query, debtID, companyID)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching debt payments: %w", err)
+	}
+	defer rows.Close()
+
+	payments := []models.DebtPayment{}
 	for rows.Next() {
-		var debt models.DebtRecord
-		var notes sql.NullString
-		if err := rows.Scan(&debt.ID, &debt.StudentID, &debt.Amount, &debt.DueDate, &debt.Status, &notes, &debt.CreatedAt); err != nil {
+		var p models.DebtPayment
+		if err := rows.Scan(&p.ID, &p.DebtID, &p.PaymentTransactionID, &p.Amount, &p.CreatedAt, &p.CompanyID); err != nil {
 			return nil, err
 		}
-		if notes.Valid {
-			debt.Notes = notes.String
-		}
-		debts = append(debts, debt)
+		payments = append(payments, p)
 	}
-	return debts, nil
+	return payments, nil
 }
 
 func (r *DebtRepository) Update(debt *models.DebtRecord, companyID string) error {
 	query := `UPDATE debt_records SET amount = $1, due_date = $2, status = $3, notes = $4 WHERE id = $5 AND company_id = $6`
-	_, err := r.db.Exec(query, debt.Amount, debt.DueDate, debt.Status, debt.Notes, debt.ID, companyID)
+	_, err := database.Tenant(r.db, companyID).Exec(query, debt.Amount, debt.DueDate, debt.Status, debt.Notes, debt.ID, companyID)
 	return err
 }
 
 func (r *DebtRepository) Delete(id int, companyID string) error {
 	query := `DELETE FROM debt_records WHERE id = $1 AND company_id = $2`
-	_, err := r.db.Exec(query, id, companyID)
+	_, err := database.Tenant(r.db, companyID).Exec(query, id, companyID)
 	return err
 }
 
 // GetByStatusAllCompanies - for background tasks (notifications, etc.)
 func (r *DebtRepository) GetByStatusAllCompanies(status string) ([]models.DebtRecord, error) {
-	query := `SELECT id, student_id, amount, due_date, status, notes, created_at 
-	          FROM debt_records WHERE status = $1 ORDER BY created_at DESC`
-	rows, err := r.db.Query(query, status)
+	query := `SELECT ` + debtColumns + `
+	          FROM debt_records WHERE status = $1 AND ` + notTrashed + ` ORDER BY created_at DESC`
+	rows, err := database.System(r.db).Query(query, status)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	debts := []models.DebtRecord{}
+	return scanDebts(rows)
+}
+
+// CreateFromOverdueInvoices opens a debt for every unpaid invoice past its due date (for background tasks;
+// an empty companyID covers all companies). The debt amount is the invoice total minus what was already paid against it.
+// Invoices of students in the trash are skipped until the student is restored.
+func (r *DebtRepository) CreateFromOverdueInvoices(now time.Time, companyID string) (int64, error) {
+	query := `
+		INSERT INTO debt_records (student_id, amount, due_date, status, source, invoice_id, notes, company_id, branch_id, currency)
+		SELECT i.student_id, t.total - COALESCE(p.paid, 0), i.due_at, 'pending', 'invoice', i.id,
+		       'Просроченный счет №' || i.id, i.company_id, COALESCE(i.branch_id, s.branch_id), i.currency
+		FROM invoice i
+		JOIN students s ON s.id = i.student_id
+		JOIN (SELECT invoice_id, SUM(quantity * unit_price) AS total FROM invoice_item GROUP BY invoice_id) t ON t.invoice_id = i.id
+		LEFT JOIN (SELECT invoice_id, SUM(amount) AS paid FROM transaction WHERE kind = 'pay_invoice' GROUP BY invoice_id) p ON p.invoice_id = i.id
+		WHERE i.status IN ('unpaid', 'partially') AND s.deleted_at IS NULL
+		  AND i.due_at IS NOT NULL AND i.due_at < $1
+		  AND ($2 = '' OR i.company_id = $2)
+		  AND t.total - COALESCE(p.paid, 0) > 0
+		  AND NOT EXISTS (SELECT 1 FROM debt_records d WHERE d.invoice_id = i.id)
+		ON CONFLICT DO NOTHING`
+	result, err := database.TenantOrSystem(r.db, companyID).Exec(query, now, companyID)
+	if err != nil {
+		return 0, fmt.Errorf("error creating debts from overdue invoices: %w", err)
+	}
+	return result.RowsAffected()
+}
+
+// CreateNegativeBalanceDebt opens a debt for the part of a charge not covered by the student's balance.
+// It must run in the same transaction that applied the charge; newBalance is the balance after the charge.
+func CreateNegativeBalanceDebt(dbTx *sql.Tx, studentID string, charge, newBalance money.Money, notes, companyID string) (*models.DebtRecord, error) {
+	if !newBalance.IsNegative() || !charge.IsPositive() {
+		return nil, nil
+	}
+	amount := money.Min(charge, newBalance.Neg())
+
+	debt := &models.DebtRecord{
+		StudentID: studentID,
+		Amount:    amount,
+		Status:    "pending",
+		Source:    "negative_balance",
+		Notes:     notes,
+		CompanyID: companyID,
+	}
+	now := time.Now()
+	debt.DueDate = &now
+
+	query := `INSERT INTO debt_records (student_id, amount, due_date, status, source, notes, company_id, branch_id)
+	          VALUES ($1, $2, $3, $4, $5, $6, $7, (SELECT branch_id FROM students WHERE id = $1))
+	          RETURNING id, created_at, COALESCE(branch_id, ''), currency`
+	err := dbTx.QueryRow(query, debt.StudentID, debt.Amount, debt.DueDate, debt.Status, debt.Source, debt.Notes, companyID).
+		Scan(&debt.ID, &debt.CreatedAt, &debt.BranchID, &debt.Currency)
+	if err != nil {
+		return nil, fmt.Errorf("error creating debt: %w", err)
+	}
+	debt.ApplyCurrency()
+	return debt, nil
+}
+
+// SettleDebts allocates an incoming payment to the student's outstanding debts, oldest first.
+// It must run in the same transaction that recorded the payment and returns the amount allocated.
+func SettleDebts(dbTx *sql.Tx, studentID string, amount money.Money, paymentTxID *int, companyID string) (money.Money, error) {
+	if !amount.IsPositive() {
+		return money.Money{}, nil
+	}
+
+	rows, err := dbTx.Query(`
+		SELECT id, amount, paid_amount FROM debt_records
+		WHERE student_id = $1 AND company_id = $2
+		  AND status IN ('pending', 'partially_paid') AND amount > paid_amount
+		ORDER BY COALESCE(due_date, created_at), id
+		FOR UPDATE`, studentID, companyID)
+	if err != nil {
+		return money.Money{}, fmt.Errorf("error fetching outstanding debts: %w", err)
+	}
+
+	type openDebt struct {
+		id        int
+		remaining money.Money
+	}
+	var open []openDebt
 	for rows.Next() {
-		var debt models.DebtRecord
-		var notes sql.NullString
-		if err := rows.Scan(&debt.ID, &debt.StudentID, &debt.Amount, &debt.DueDate, &debt.Status, &notes, &debt.CreatedAt); err != nil {
-			return nil, err
+		var id int
+		var debtAmount, paid money.Money
+		if err := rows.Scan(&id, &debtAmount, &paid); err != nil {
+			rows.Close()
+			return money.Money{}, fmt.Errorf("error scanning debt: %w", err)
 		}
-		if notes.Valid {
-			debt.Notes = notes.String
+		open = append(open, openDebt{id: id, remaining: debtAmount.Sub(paid)})
+	}
+	rows.Close()
+
+	var allocated money.Money
+	for _, d := range open {
+		left := amount.Sub(allocated)
+		if !left.IsPositive() {
+			break
 		}
-		debts = append(debts, debt)
+		part := money.Min(d.remaining, left)
+
+		_, err = dbTx.Exec(`
+			UPDATE debt_records
+			SET paid_amount = paid_amount + $1,
+			    status = CASE WHEN paid_amount + $1 >= amount THEN 'paid' ELSE 'partially_paid' END,
+			    settled_at = CASE WHEN paid_amount + $1 >= amount THEN CURRENT_TIMESTAMP ELSE settled_at END
+			WHERE id = $2`, part, d.id)
+		if err != nil {
+			return money.Money{}, fmt.Errorf("error settling debt: %w", err)
+		}
+
+		_, err = dbTx.Exec(`INSERT INTO debt_payments (debt_id, payment_transaction_id, amount, company_id) VALUES ($1, $2, $3, $4)`,
+			d.id, paymentTxID, part, companyID)
+		if err != nil {
+			return money.Money{}, fmt.Errorf("error recording debt payment: %w", err)
+		}
+		allocated = allocated.Add(part)
 	}
-	return debts, nil
+
+	return allocated, nil
+}
+
+// ReleaseDebtPayments undoes up to amount of the student's payment allocations, newest first, so the
+// debts they settled are outstanding again; paymentTxID limits it to the allocations of one payment.
+// It must run in the transaction that refunded or changed the payment and returns the amount released.
+func ReleaseDebtPayments(dbTx *sql.Tx, studentID string, paymentTxID *int, amount money.Money, companyID string) (money.Money, error) {
+	if !amount.IsPositive() {
+		return money.Money{}, nil
+	}
+
+	rows, err := dbTx.Query(`
+		SELECT dp.id, dp.debt_id, dp.amount FROM debt_payments dp
+		JOIN debt_records d ON d.id = dp.debt_id
+		WHERE d.student_id = $1 AND dp.company_id = $2 AND ($3::int IS NULL OR dp.payment_transaction_id = $3)
+		  AND d.status IN ('paid', 'partially_paid')
+		ORDER BY dp.created_at DESC, dp.id DESC
+		FOR UPDATE OF dp, d`, studentID, companyID, paymentTxID)
+	if err != nil {
+		return money.Money{}, fmt.Errorf("error fetching debt payments: %w", err)
+	}
+
+	type allocation struct {
+		id, debtID int
+		amount     money.Money
+	}
+	var allocations []allocation
+	for rows.Next() {
+		var a allocation
+		if err := rows.Scan(&a.id, &a.debtID, &a.amount); err != nil {
+			rows.Close()
+			return money.Money{}, fmt.Errorf("error scanning debt payment: %w", err)
+		}
+		allocations = append(allocations, a)
+	}
+	rows.Close()
+
+	var released money.Money
+	for _, a := range allocations {
+		left := amount.Sub(released)
+		if !left.IsPositive() {
+			break
+		}
+		part := money.Min(a.amount, left)
+
+		if part.Cmp(a.amount) == 0 {
+			_, err = dbTx.Exec(`DELETE FROM debt_payments WHERE id = $1`, a.id)
+		} else {
+			_, err = dbTx.Exec(`UPDATE debt_payments SET amount = amount - $1 WHERE id = $2`, part, a.id)
+		}
+		if err != nil {
+			return money.Money{}, fmt.Errorf("error releasing debt payment: %w", err)
+		}
+
+		_, err = dbTx.Exec(`
+			UPDATE debt_records
+			SET paid_amount = paid_amount - $1,
+			    status = CASE WHEN paid_amount - $1 > 0 THEN 'partially_paid' ELSE 'pending' END,
+			    settled_at = NULL
+			WHERE id = $2`, part, a.debtID)
+		if err != nil {
+			return money.Money{}, fmt.Errorf("error reopening debt: %w", err)
+		}
+		released = released.Add(part)
+	}
+
+	return released, nil
 }
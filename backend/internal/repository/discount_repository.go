@@ -1,6 +1,7 @@
 package repository
 
 import (
+	"classmate-central/internal/database"
 	"classmate-central/internal/models"
 	"database/sql"
 	"fmt"
@@ -17,14 +18,14 @@ func NewDiscountRepository(db *sql.DB) *DiscountRepository {
 func (r *DiscountRepository) Create(discount *models.Discount, companyID string) error {
 	query := `INSERT INTO discounts (id, name, description, type, value, is_active, company_id) 
 	          VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING created_at`
-	return r.db.QueryRow(query, discount.ID, discount.Name, discount.Description, discount.Type, discount.Value, discount.IsActive, companyID).
+	return database.Tenant(r.db, companyID).QueryRow(query, discount.ID, discount.Name, discount.Description, discount.Type, discount.Value, discount.IsActive, companyID).
 		Scan(&discount.CreatedAt)
 }
 
 func (r *DiscountRepository) GetAll(companyID string) ([]models.Discount, error) {
 	query := `SELECT id, name, description, type, value, is_active, created_at, company_id 
 	          FROM discounts WHERE company_id = $1 ORDER BY created_at DESC`
-	rows, err := r.db.Query(query, companyID)
+	rows, err := database.Tenant(r.db, companyID).Query(query, companyID)
 	if err != nil {
 		return nil, err
 	}
@@ -45,7 +46,7 @@ func (r *DiscountRepository) GetByID(id string, companyID string) (*models.Disco
 	query := `SELECT id, name, description, type, value, is_active, created_at, company_id 
 	          FROM discounts WHERE id = $1 AND company_id = $2`
 	var discount models.Discount
-	err := r.db.QueryRow(query, id, companyID).Scan(&discount.ID, &discount.Name, &discount.Description, &discount.Type, &discount.Value, &discount.IsActive, &discount.CreatedAt, &discount.CompanyID)
+	err := database.Tenant(r.db, companyID).QueryRow(query, id, companyID).Scan(&discount.ID, &discount.Name, &discount.Description, &discount.Type, &discount.Value, &discount.IsActive, &discount.CreatedAt, &discount.CompanyID)
 	if err != nil {
 		return nil, err
 	}
@@ -55,13 +56,13 @@ func (r *DiscountRepository) GetByID(id string, companyID string) (*models.Disco
 func (r *DiscountRepository) Update(discount *models.Discount, companyID string) error {
 	query := `UPDATE discounts SET name = $1, description = $2, type = $3, value = $4, is_active = $5 
 	          WHERE id = $6 AND company_id = $7`
-	_, err := r.db.Exec(query, discount.Name, discount.Description, discount.Type, discount.Value, discount.IsActive, discount.ID, companyID)
+	_, err := database.Tenant(r.db, companyID).Exec(query, discount.Name, discount.Description, discount.Type, discount.Value, discount.IsActive, discount.ID, companyID)
 	return err
 }
 
 func (r *DiscountRepository) Delete(id string, companyID string) error {
 	query := `DELETE FROM discounts WHERE id = $1 AND company_id = $2`
-	_, err := r.db.Exec(query, id, companyID)
+	_, err := database.Tenant(r.db, companyID).Exec(query, id, companyID)
 	return err
 }
 
@@ -69,7 +70,7 @@ func (r *DiscountRepository) Delete(id string, companyID string) error {
 func (r *DiscountRepository) ApplyToStudent(studentDiscount *models.StudentDiscount, companyID string) error {
 	query := `INSERT INTO student_discounts (student_id, discount_id, applied_at, expires_at, is_active, company_id) 
 	          VALUES ($1, $2, $3, $4, $5, $6) RETURNING id, created_at`
-	return r.db.QueryRow(query, studentDiscount.StudentID, studentDiscount.DiscountID, studentDiscount.AppliedAt, studentDiscount.ExpiresAt, studentDiscount.IsActive, companyID).
+	return database.Tenant(r.db, companyID).QueryRow(query, studentDiscount.StudentID, studentDiscount.DiscountID, studentDiscount.AppliedAt, studentDiscount.ExpiresAt, studentDiscount.IsActive, companyID).
 		Scan(&studentDiscount.ID, &studentDiscount.CreatedAt)
 }
 
@@ -80,7 +81,7 @@ func (r *DiscountRepository) GetStudentDiscounts(studentID string, companyID str
 	          JOIN discounts d ON sd.discount_id = d.id
 	          WHERE sd.student_id = $1 AND sd.company_id = $2 AND sd.is_active = true
 	          ORDER BY sd.created_at DESC`
-	rows, err := r.db.Query(query, studentID, companyID)
+	rows, err := database.Tenant(r.db, companyID).Query(query, studentID, companyID)
 	if err != nil {
 		return nil, err
 	}
@@ -110,6 +111,6 @@ func (r *DiscountRepository) GetStudentDiscounts(studentID string, companyID str
 func (r *DiscountRepository) RemoveStudentDiscount(studentID string, discountID string, companyID string) error {
 	query := `UPDATE student_discounts SET is_active = false 
 	          WHERE student_id = $1 AND discount_id = $2 AND company_id = $3`
-	_, err := r.db.Exec(query, studentID, discountID, companyID)
+	_, err := database.Tenant(r.db, companyID).Exec(query, studentID, discountID, companyID)
 	return err
 }
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"time"
 
+	"classmate-central/internal/database"
 	"classmate-central/internal/models"
 )
 
@@ -22,7 +23,7 @@ func (r *EnrollmentRepository) Create(enrollment *models.Enrollment, companyID s
 		VALUES ($1, $2, $3, $4, $5)
 		RETURNING id, created_at
 	`
-	err := r.db.QueryRow(
+	err := database.Tenant(r.db, companyID).QueryRow(
 		query,
 		enrollment.StudentID,
 		enrollment.GroupID,
@@ -42,7 +43,7 @@ func (r *EnrollmentRepository) GetByID(id int64, companyID string) (*models.Enro
 
 	query := `SELECT id, student_id, group_id, joined_at, left_at, company_id, created_at 
 	          FROM enrollment WHERE id = $1 AND company_id = $2`
-	err := r.db.QueryRow(query, id, companyID).Scan(
+	err := database.Tenant(r.db, companyID).QueryRow(query, id, companyID).Scan(
 		&enrollment.ID,
 		&enrollment.StudentID,
 		&enrollment.GroupID,
@@ -76,7 +77,7 @@ func (r *EnrollmentRepository) GetByStudentAndGroup(studentID, groupID string, c
 		ORDER BY joined_at DESC
 		LIMIT 1
 	`
-	err := r.db.QueryRow(query, studentID, groupID, companyID).Scan(
+	err := database.Tenant(r.db, companyID).QueryRow(query, studentID, groupID, companyID).Scan(
 		&enrollment.ID,
 		&enrollment.StudentID,
 		&enrollment.GroupID,
@@ -106,7 +107,7 @@ func (r *EnrollmentRepository) GetActiveByStudent(studentID string, companyID st
 		WHERE student_id = $1 AND company_id = $2 AND left_at IS NULL
 		ORDER BY joined_at DESC
 	`
-	rows, err := r.db.Query(query, studentID, companyID)
+	rows, err := database.Tenant(r.db, companyID).Query(query, studentID, companyID)
 	if err != nil {
 		return nil, fmt.Errorf("error getting active enrollments: %w", err)
 	}
@@ -147,7 +148,7 @@ func (r *EnrollmentRepository) GetActiveByGroup(groupID string, companyID string
 		WHERE group_id = $1 AND company_id = $2 AND left_at IS NULL
 		ORDER BY joined_at DESC
 	`
-	rows, err := r.db.Query(query, groupID, companyID)
+	rows, err := database.Tenant(r.db, companyID).Query(query, groupID, companyID)
 	if err != nil {
 		return nil, fmt.Errorf("error getting group enrollments: %w", err)
 	}
@@ -187,7 +188,7 @@ func (r *EnrollmentRepository) Update(enrollment *models.Enrollment, companyID s
 		SET student_id = $2, group_id = $3, joined_at = $4, left_at = $5
 		WHERE id = $1 AND company_id = $6
 	`
-	_, err := r.db.Exec(
+	_, err := database.Tenant(r.db, companyID).Exec(
 		query,
 		enrollment.ID,
 		enrollment.StudentID,
@@ -208,7 +209,7 @@ func (r *EnrollmentRepository) Leave(studentID, groupID string, companyID string
 		SET left_at = $3
 		WHERE student_id = $1 AND group_id = $2 AND company_id = $4 AND left_at IS NULL
 	`
-	_, err := r.db.Exec(query, studentID, groupID, time.Now(), companyID)
+	_, err := database.Tenant(r.db, companyID).Exec(query, studentID, groupID, time.Now(), companyID)
 	if err != nil {
 		return fmt.Errorf("error leaving enrollment: %w", err)
 	}
@@ -217,7 +218,7 @@ func (r *EnrollmentRepository) Leave(studentID, groupID string, companyID string
 
 func (r *EnrollmentRepository) Delete(id int64, companyID string) error {
 	query := `DELETE FROM enrollment WHERE id = $1 AND company_id = $2`
-	_, err := r.db.Exec(query, id, companyID)
+	_, err := database.Tenant(r.db, companyID).Exec(query, id, companyID)
 	if err != nil {
 		return fmt.Errorf("error deleting enrollment: %w", err)
 	}
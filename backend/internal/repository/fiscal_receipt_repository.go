@@ -0,0 +1,230 @@
+package repository
+
+import (
+	"classmate-central/internal/database"
+	"classmate-central/internal/fiscal"
+	"classmate-central/internal/models"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ErrReceiptRegistered is returned when changing the amount or method of a payment whose fiscal receipt is registered
+var ErrReceiptRegistered = errors.New("transaction has a registered fiscal receipt")
+
+type FiscalReceiptRepository struct {
+	db *sql.DB
+}
+
+func NewFiscalReceiptRepository(db *sql.DB) *FiscalReceiptRepository {
+	return &FiscalReceiptRepository{db: db}
+}
+
+const fiscalReceiptColumns = `id, transaction_id, operation, amount, currency, payment_method, description, status, attempts,
+	next_attempt_at, last_error, operator, fiscal_number, qr_code, receipt_url, registered_at, created_at, updated_at,
+	company_id, COALESCE(branch_id, '')`
+
+func scanFiscalReceipts(rows *sql.Rows) ([]models.FiscalReceipt, error) {
+	receipts := []models.FiscalReceipt{}
+	for rows.Next() {
+		var r models.FiscalReceipt
+		var lastError, operator, fiscalNumber, qrCode, receiptURL sql.NullString
+		if err := rows.Scan(&r.ID, &r.TransactionID, &r.Operation, &r.Amount, &r.Currency, &r.PaymentMethod, &r.Description, &r.Status,
+			&r.Attempts, &r.NextAttemptAt, &lastError, &operator, &fiscalNumber, &qrCode, &receiptURL, &r.RegisteredAt,
+			&r.CreatedAt, &r.UpdatedAt, &r.CompanyID, &r.BranchID); err != nil {
+			return nil, fmt.Errorf("error scanning fiscal receipt: %w", err)
+		}
+		r.LastError = nullStringPtr(lastError)
+		r.Operator = nullStringPtr(operator)
+		r.FiscalNumber = nullStringPtr(fiscalNumber)
+		r.QRCode = nullStringPtr(qrCode)
+		r.ReceiptURL = nullStringPtr(receiptURL)
+		r.ApplyCurrency()
+		receipts = append(receipts, r)
+	}
+	return receipts, rows.Err()
+}
+
+func nullStringPtr(s sql.NullString) *string {
+	if !s.Valid {
+		return nil
+	}
+	return &s.String
+}
+
+// needsFiscalReceipt reports whether the transaction must be fiscalized: cash and card payments and refunds
+func needsFiscalReceipt(tx *models.PaymentTransaction) bool {
+	return (tx.Type == "payment" || tx.Type == "refund") && (tx.PaymentMethod == "cash" || tx.PaymentMethod == "card")
+}
+
+// queueFiscalReceipt queues the receipt of a payment transaction within the caller's database transaction
+func queueFiscalReceipt(dbTx *sql.Tx, transactionID int) error {
+	_, err := dbTx.Exec(`
+		INSERT INTO fiscal_receipts (transaction_id, operation, amount, currency, payment_method, description, company_id, branch_id)
+		SELECT id, CASE WHEN type = 'refund' THEN 'refund' ELSE 'sale' END, amount, currency, payment_method, description,
+		       company_id, branch_id
+		FROM payment_transactions WHERE id = $1
+		ON CONFLICT (transaction_id) DO NOTHING`, transactionID)
+	if err != nil {
+		return fmt.Errorf("error queueing fiscal receipt: %w", err)
+	}
+	return nil
+}
+
+// requeueFiscalReceipt replaces the unregistered receipt of an edited transaction
+func requeueFiscalReceipt(dbTx *sql.Tx, tx *models.PaymentTransaction) error {
+	if _, err := dbTx.Exec(`DELETE FROM fiscal_receipts WHERE transaction_id = $1 AND status <> 'registered'`, tx.ID); err != nil {
+		return fmt.Errorf("error removing fiscal receipt: %w", err)
+	}
+	if !needsFiscalReceipt(tx) {
+		return nil
+	}
+	return queueFiscalReceipt(dbTx, tx.ID)
+}
+
+// fiscalReceiptStatus returns the status of the receipt of a transaction ("" if it has none), locking it
+func fiscalReceiptStatus(dbTx *sql.Tx, transactionID int) (string, error) {
+	var status string
+	err := dbTx.QueryRow(`SELECT status FROM fiscal_receipts WHERE transaction_id = $1 FOR UPDATE`, transactionID).Scan(&status)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("error fetching fiscal receipt: %w", err)
+	}
+	return status, nil
+}
+
+// ClaimDue takes up to limit pending receipts whose next attempt is due and counts the attempt. Claimed
+// receipts are leased until now+lease so that concurrent workers do not register them twice.
+func (r *FiscalReceiptRepository) ClaimDue(now time.Time, limit int, lease time.Duration) ([]models.FiscalReceipt, error) {
+	rows, err := database.System(r.db).Query(`
+		UPDATE fiscal_receipts
+		SET attempts = attempts + 1, next_attempt_at = $2, updated_at = CURRENT_TIMESTAMP
+		WHERE id IN (
+			SELECT id FROM fiscal_receipts
+			WHERE status = 'pending' AND next_attempt_at <= $1
+			ORDER BY next_attempt_at
+			LIMIT $3
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING `+fiscalReceiptColumns, now, now.Add(lease), limit)
+	if err != nil {
+		return nil, fmt.Errorf("error claiming fiscal receipts: %w", err)
+	}
+	defer rows.Close()
+	return scanFiscalReceipts(rows)
+}
+
+// MarkRegistered stores the registration on the receipt and its payment transaction
+func (r *FiscalReceiptRepository) MarkRegistered(id int, operator string, reg *fiscal.Registration) error {
+	dbTx, err := database.System(r.db).Begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer dbTx.Rollback()
+
+	var transactionID int
+	err = dbTx.QueryRow(`
+		UPDATE fiscal_receipts
+		SET status = 'registered', operator = $2, fiscal_number = $3, qr_code = $4, receipt_url = $5,
+		    registered_at = $6, last_error = NULL, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1
+		RETURNING transaction_id`,
+		id, operator, reg.FiscalNumber, reg.QRCode, reg.URL, reg.RegisteredAt).Scan(&transactionID)
+	if err != nil {
+		return fmt.Errorf("error updating fiscal receipt: %w", err)
+	}
+
+	_, err = dbTx.Exec(`UPDATE payment_transactions SET fiscal_number = $2, fiscal_qr = $3, fiscal_url = $4 WHERE id = $1`,
+		transactionID, reg.FiscalNumber, reg.QRCode, reg.URL)
+	if err != nil {
+		return fmt.Errorf("error updating transaction fiscal data: %w", err)
+	}
+
+	if err = dbTx.Commit(); err != nil {
+		return fmt.Errorf("error committing transaction: %w", err)
+	}
+	return nil
+}
+
+// MarkRetry records a failed attempt and schedules the next one
+func (r *FiscalReceiptRepository) MarkRetry(id int, lastError string, next time.Time) error {
+	_, err := database.System(r.db).Exec(`UPDATE fiscal_receipts SET last_error = $2, next_attempt_at = $3, updated_at = CURRENT_TIMESTAMP WHERE id = $1`,
+		id, lastError, next)
+	if err != nil {
+		return fmt.Errorf("error updating fiscal receipt: %w", err)
+	}
+	return nil
+}
+
+// MarkFailed stops retrying a receipt; it waits for a manual retry
+func (r *FiscalReceiptRepository) MarkFailed(id int, lastError string) error {
+	_, err := database.System(r.db).Exec(`UPDATE fiscal_receipts SET status = 'failed', last_error = $2, updated_at = CURRENT_TIMESTAMP WHERE id = $1`,
+		id, lastError)
+	if err != nil {
+		return fmt.Errorf("error updating fiscal receipt: %w", err)
+	}
+	return nil
+}
+
+// Retry puts a failed receipt back in the queue. Returns sql.ErrNoRows if there is no failed receipt with the ID.
+func (r *FiscalReceiptRepository) Retry(id int, companyID string) error {
+	result, err := database.Tenant(r.db, companyID).Exec(`
+		UPDATE fiscal_receipts
+		SET status = 'pending', attempts = 0, next_attempt_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND company_id = $2 AND status = 'failed'`, id, companyID)
+	if err != nil {
+		return fmt.Errorf("error retrying fiscal receipt: %w", err)
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error checking retry result: %w", err)
+	}
+	if rows == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// List returns receipts of the company, newest first, optionally filtered by status and branches
+func (r *FiscalReceiptRepository) List(status, companyID string, branchIDs []string) ([]models.FiscalReceipt, error) {
+	query := `SELECT ` + fiscalReceiptColumns + ` FROM fiscal_receipts WHERE company_id = $1`
+	args := []interface{}{companyID}
+	if status != "" {
+		args = append(args, status)
+		query += fmt.Sprintf(" AND status = $%d", len(args))
+	}
+	if len(branchIDs) > 0 {
+		placeholders := make([]string, len(branchIDs))
+		for i, id := range branchIDs {
+			args = append(args, id)
+			placeholders[i] = fmt.Sprintf("$%d", len(args))
+		}
+		query += " AND branch_id IN (" + strings.Join(placeholders, ", ") + ")"
+	}
+	query += " ORDER BY created_at DESC LIMIT 500"
+
+	rows, err := database.Tenant(r.db, companyID).Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error listing fiscal receipts: %w", err)
+	}
+	defer rows.Close()
+	return scanFiscalReceipts(rows)
+}
+
+// GetStats counts the receipts of the company by status
+func (r *FiscalReceiptRepository) GetStats(companyID string) (*models.FiscalReceiptStats, error) {
+	var stats models.FiscalReceiptStats
+	err := database.Tenant(r.db, companyID).QueryRow(`
+		SELECT COUNT(*) FILTER (WHERE status = 'pending'),
+		       COUNT(*) FILTER (WHERE status = 'registered'),
+		       COUNT(*) FILTER (WHERE status = 'failed')
+		FROM fiscal_receipts WHERE company_id = $1`, companyID).Scan(&stats.Pending, &stats.Registered, &stats.Failed)
+	if err != nil {
+		return nil, fmt.Errorf("error counting fiscal receipts: %w", err)
+	}
+	return &stats, nil
+}
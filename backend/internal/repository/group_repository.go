@@ -6,6 +6,7 @@ import (
 	"strings"
 	"time"
 
+	"classmate-central/internal/database"
 	"classmate-central/internal/models"
 )
 
@@ -18,7 +19,7 @@ func NewGroupRepository(db *sql.DB) *GroupRepository {
 }
 
 func (r *GroupRepository) Create(group *models.Group, companyID string, branchID string) error {
-	tx, err := r.db.Begin()
+	tx, err := database.Tenant(r.db, companyID).Begin()
 	if err != nil {
 		return fmt.Errorf("error starting transaction: %w", err)
 	}
@@ -89,7 +90,7 @@ func (r *GroupRepository) GetAllByBranches(companyID string, branchIDs []string)
 	
 	if hasFallback && len(branchIDs) == 1 {
 		// Fallback mode: don't filter by branch_id
-		query = baseQuery + ` WHERE g.company_id = $1 ORDER BY g.name`
+		query = baseQuery + ` WHERE g.company_id = $1 AND g.deleted_at IS NULL ORDER BY g.name`
 		args = []interface{}{companyID}
 	} else {
 		// Filter by accessible branches only
@@ -97,7 +98,7 @@ func (r *GroupRepository) GetAllByBranches(companyID string, branchIDs []string)
 		for i := range branchIDs {
 			placeholders[i] = fmt.Sprintf("$%d", i+2)
 		}
-		query = baseQuery + fmt.Sprintf(` WHERE g.company_id = $1 AND g.branch_id IN (%s) ORDER BY g.name`, strings.Join(placeholders, ","))
+		query = baseQuery + fmt.Sprintf(` WHERE g.company_id = $1 AND g.branch_id IN (%s) AND g.deleted_at IS NULL ORDER BY g.name`, strings.Join(placeholders, ","))
 		args = make([]interface{}, len(branchIDs)+1)
 		args[0] = companyID
 		for i, bid := range branchIDs {
@@ -105,7 +106,7 @@ func (r *GroupRepository) GetAllByBranches(companyID string, branchIDs []string)
 		}
 	}
 
-	rows, err := r.db.Query(query, args...)
+	rows, err := database.Tenant(r.db, companyID).Query(query, args...)
 	if err != nil {
 		return nil, fmt.Errorf("error getting groups: %w", err)
 	}
@@ -161,7 +162,7 @@ func (r *GroupRepository) GetAllByBranches(companyID string, branchIDs []string)
 		group.StudentIds = []string{}
 
 		// Get students from enrollment table (active enrollments only)
-		studentRows, err := r.db.Query(`SELECT student_id FROM enrollment WHERE group_id = $1 AND left_at IS NULL`, group.ID)
+		studentRows, err := database.Tenant(r.db, companyID).Query(`SELECT student_id FROM enrollment WHERE group_id = $1 AND left_at IS NULL`, group.ID)
 		if err == nil {
 			for studentRows.Next() {
 				var studentID string
@@ -197,11 +198,11 @@ func (r *GroupRepository) GetByID(id string, companyID string) (*models.Group, e
 		FROM groups g
 		LEFT JOIN teachers t ON g.teacher_id = t.id
 		LEFT JOIN rooms rm ON g.room_id = rm.id
-		WHERE g.id = $1 AND g.company_id = $2
+		WHERE g.id = $1 AND g.company_id = $2 AND g.deleted_at IS NULL
 	`
 
 	var roomName sql.NullString
-	err := r.db.QueryRow(query, id, companyID).Scan(&group.ID, &group.Name, &group.Subject, &teacherID, &roomID, &schedule, &description, &status, &color, &group.CompanyID, &teacherName, &roomName)
+	err := database.Tenant(r.db, companyID).QueryRow(query, id, companyID).Scan(&group.ID, &group.Name, &group.Subject, &teacherID, &roomID, &schedule, &description, &status, &color, &group.CompanyID, &teacherName, &roomName)
 	if err == sql.ErrNoRows {
 		return nil, nil
 	}
@@ -242,7 +243,7 @@ func (r *GroupRepository) GetByID(id string, companyID string) (*models.Group, e
 	group.StudentIds = []string{}
 
 	// Get students from enrollment table (active enrollments only)
-	studentRows, err := r.db.Query(`SELECT student_id FROM enrollment WHERE group_id = $1 AND left_at IS NULL`, group.ID)
+	studentRows, err := database.Tenant(r.db, companyID).Query(`SELECT student_id FROM enrollment WHERE group_id = $1 AND left_at IS NULL`, group.ID)
 	if err == nil {
 		for studentRows.Next() {
 			var studentID string
@@ -257,7 +258,7 @@ func (r *GroupRepository) GetByID(id string, companyID string) (*models.Group, e
 }
 
 func (r *GroupRepository) Update(group *models.Group, companyID string) error {
-	tx, err := r.db.Begin()
+	tx, err := database.Tenant(r.db, companyID).Begin()
 	if err != nil {
 		return fmt.Errorf("error starting transaction: %w", err)
 	}
@@ -285,7 +286,7 @@ func (r *GroupRepository) Update(group *models.Group, companyID string) error {
 	query := `
 		UPDATE groups 
 		SET name = $2, subject = $3, teacher_id = $4, room_id = $5, schedule = $6, description = $7, status = $8, color = $9
-		WHERE id = $1 AND company_id = $10
+		WHERE id = $1 AND company_id = $10 AND deleted_at IS NULL
 	`
 	_, err = tx.Exec(query, group.ID, group.Name, group.Subject, group.TeacherID, roomID, group.Schedule, group.Description, group.Status, group.Color, companyID)
 	if err != nil {
@@ -326,10 +327,23 @@ func (r *GroupRepository) Update(group *models.Group, companyID string) error {
 	return tx.Commit()
 }
 
-func (r *GroupRepository) Delete(id string, companyID string) error {
-	query := `DELETE FROM groups WHERE id = $1 AND company_id = $2`
-
-	_, err := r.db.Exec(query, id, companyID)
+// Delete moves a group and its lessons to the trash in one transaction, so both carry the
+// same deleted_at and restoring the group brings the lessons back
+func (r *GroupRepository) Delete(id string, actor database.Actor) error {
+	err := database.WithActor(r.db, actor, func(tx *sql.Tx) error {
+		_, err := tx.Exec(`
+			UPDATE lessons SET deleted_at = NOW(), deleted_by = NULLIF($3, 0)
+			WHERE group_id = $1 AND company_id = $2 AND deleted_at IS NULL
+		`, id, actor.CompanyID, actor.UserID)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(`
+			UPDATE groups SET deleted_at = NOW(), deleted_by = NULLIF($3, 0)
+			WHERE id = $1 AND company_id = $2 AND deleted_at IS NULL
+		`, id, actor.CompanyID, actor.UserID)
+		return err
+	})
 	if err != nil {
 		return fmt.Errorf("error deleting group: %w", err)
 	}
@@ -415,7 +429,7 @@ func (r *GroupRepository) GenerateLessonsForGroup(group *models.Group, companyID
 	if group.RoomID != "" {
 		roomID = sql.NullString{String: group.RoomID, Valid: true}
 	} else {
-		err := r.db.QueryRow(`SELECT id FROM rooms WHERE company_id = $1 LIMIT 1`, companyID).Scan(&roomID)
+		err := database.Tenant(r.db, companyID).QueryRow(`SELECT id FROM rooms WHERE company_id = $1 LIMIT 1`, companyID).Scan(&roomID)
 		if err != nil && err != sql.ErrNoRows {
 			return 0, fmt.Errorf("error getting room: %w", err)
 		}
@@ -484,11 +498,12 @@ func (r *GroupRepository) GenerateLessonsForGroup(group *models.Group, companyID
 			// (e.g., one ends at 16:00:00 and another starts at 16:00:00 - no conflict)
 			if roomID.Valid {
 				var conflictCount int
-				err := r.db.QueryRow(`
+				err := database.Tenant(r.db, companyID).QueryRow(`
 					SELECT COUNT(*) FROM lessons
 					WHERE room_id = $1 
 					AND company_id = $2
 					AND id != $3
+					AND deleted_at IS NULL
 					AND start_time < $5 
 					AND end_time > $4
 					AND DATE_TRUNC('minute', end_time) <> DATE_TRUNC('minute', $4)
@@ -511,7 +526,7 @@ func (r *GroupRepository) GenerateLessonsForGroup(group *models.Group, companyID
 			fmt.Printf("      - start_time: %v (Go time.Time)\n", lessonStart)
 			fmt.Printf("      - end_time: %v (Go time.Time)\n", lessonEnd)
 
-			result, err := r.db.Exec(`
+			result, err := database.Tenant(r.db, companyID).Exec(`
 				INSERT INTO lessons (id, title, teacher_id, group_id, subject, start_time, end_time, room_id, status, company_id)
 				VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
 				ON CONFLICT (id) DO NOTHING
@@ -532,7 +547,7 @@ func (r *GroupRepository) GenerateLessonsForGroup(group *models.Group, companyID
 				// Add students to the lesson
 				studentsAdded := 0
 				for _, studentID := range group.StudentIds {
-					_, err = r.db.Exec(`
+					_, err = database.Tenant(r.db, companyID).Exec(`
 						INSERT INTO lesson_students (lesson_id, student_id, company_id)
 						VALUES ($1, $2, $3)
 						ON CONFLICT DO NOTHING
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"time"
 
+	"classmate-central/internal/database"
 	"classmate-central/internal/models"
 )
 
@@ -22,7 +23,7 @@ func (r *IndividualEnrollmentRepository) Create(enrollment *models.IndividualEnr
 		VALUES ($1, $2, $3, $4, $5)
 		RETURNING id, created_at
 	`
-	err := r.db.QueryRow(
+	err := database.Tenant(r.db, companyID).QueryRow(
 		query,
 		enrollment.StudentID,
 		enrollment.TeacherID,
@@ -42,7 +43,7 @@ func (r *IndividualEnrollmentRepository) GetByID(id int64, companyID string) (*m
 
 	query := `SELECT id, student_id, teacher_id, started_at, ended_at, company_id, created_at 
 	          FROM individual_enrollment WHERE id = $1 AND company_id = $2`
-	err := r.db.QueryRow(query, id, companyID).Scan(
+	err := database.Tenant(r.db, companyID).QueryRow(query, id, companyID).Scan(
 		&enrollment.ID,
 		&enrollment.StudentID,
 		&enrollment.TeacherID,
@@ -72,7 +73,7 @@ func (r *IndividualEnrollmentRepository) GetActiveByStudent(studentID string, co
 		WHERE student_id = $1 AND company_id = $2 AND ended_at IS NULL
 		ORDER BY started_at DESC
 	`
-	rows, err := r.db.Query(query, studentID, companyID)
+	rows, err := database.Tenant(r.db, companyID).Query(query, studentID, companyID)
 	if err != nil {
 		return nil, fmt.Errorf("error getting active individual enrollments: %w", err)
 	}
@@ -113,7 +114,7 @@ func (r *IndividualEnrollmentRepository) GetActiveByTeacher(teacherID string, co
 		WHERE teacher_id = $1 AND company_id = $2 AND ended_at IS NULL
 		ORDER BY started_at DESC
 	`
-	rows, err := r.db.Query(query, teacherID, companyID)
+	rows, err := database.Tenant(r.db, companyID).Query(query, teacherID, companyID)
 	if err != nil {
 		return nil, fmt.Errorf("error getting teacher's individual enrollments: %w", err)
 	}
@@ -153,7 +154,7 @@ func (r *IndividualEnrollmentRepository) Update(enrollment *models.IndividualEnr
 		SET student_id = $2, teacher_id = $3, started_at = $4, ended_at = $5
 		WHERE id = $1 AND company_id = $6
 	`
-	_, err := r.db.Exec(
+	_, err := database.Tenant(r.db, companyID).Exec(
 		query,
 		enrollment.ID,
 		enrollment.StudentID,
@@ -174,7 +175,7 @@ func (r *IndividualEnrollmentRepository) End(studentID, teacherID string, compan
 		SET ended_at = $3
 		WHERE student_id = $1 AND teacher_id = $2 AND company_id = $4 AND ended_at IS NULL
 	`
-	_, err := r.db.Exec(query, studentID, teacherID, time.Now(), companyID)
+	_, err := database.Tenant(r.db, companyID).Exec(query, studentID, teacherID, time.Now(), companyID)
 	if err != nil {
 		return fmt.Errorf("error ending individual enrollment: %w", err)
 	}
@@ -183,7 +184,7 @@ func (r *IndividualEnrollmentRepository) End(studentID, teacherID string, compan
 
 func (r *IndividualEnrollmentRepository) Delete(id int64, companyID string) error {
 	query := `DELETE FROM individual_enrollment WHERE id = $1 AND company_id = $2`
-	_, err := r.db.Exec(query, id, companyID)
+	_, err := database.Tenant(r.db, companyID).Exec(query, id, companyID)
 	if err != nil {
 		return fmt.Errorf("error deleting individual enrollment: %w", err)
 	}
@@ -0,0 +1,455 @@
+package repository
+
+import (
+	"classmate-central/internal/database"
+	"classmate-central/internal/models"
+	"classmate-central/internal/money"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ErrPlanExists is returned when creating a plan for a subscription that already has an active one
+var ErrPlanExists = errors.New("subscription already has an installment plan")
+
+type InstallmentRepository struct {
+	db *sql.DB
+}
+
+func NewInstallmentRepository(db *sql.DB) *InstallmentRepository {
+	return &InstallmentRepository{db: db}
+}
+
+const installmentPlanColumns = `id, subscription_id, student_id, total_amount, billing_mode, reminder_days, grace_days,
+	status, suspended_at, created_by, created_at, company_id, COALESCE(branch_id, ''), currency`
+
+func scanInstallmentPlan(row interface{ Scan(...interface{}) error }) (*models.InstallmentPlan, error) {
+	var plan models.InstallmentPlan
+	var graceDays, createdBy sql.NullInt64
+	err := row.Scan(&plan.ID, &plan.SubscriptionID, &plan.StudentID, &plan.TotalAmount, &plan.BillingMode, &plan.ReminderDays, &graceDays,
+		&plan.Status, &plan.SuspendedAt, &createdBy, &plan.CreatedAt, &plan.CompanyID, &plan.BranchID, &plan.Currency)
+	if err != nil {
+		return nil, err
+	}
+	if graceDays.Valid {
+		days := int(graceDays.Int64)
+		plan.GraceDays = &days
+	}
+	if createdBy.Valid {
+		id := int(createdBy.Int64)
+		plan.CreatedBy = &id
+	}
+	plan.Installments = []models.Installment{}
+	plan.ApplyCurrency()
+	return &plan, nil
+}
+
+// installmentColumns selects an installment joined with its plan (alias p)
+const installmentColumns = `i.id, i.plan_id, i.seq, i.due_date, i.amount, i.paid_amount, i.status, i.debt_id, i.invoice_id,
+	i.reminded_at, i.paid_at, i.company_id, p.student_id, p.subscription_id, p.currency`
+
+// planNotTrashed skips plans of students in the trash: their installments are not listed, charged
+// or reminded and do not suspend the subscription. The plan is paused rather than cancelled, so a
+// restored student's plan resumes and the next run charges what fell due in the meantime.
+const planNotTrashed = `NOT EXISTS (SELECT 1 FROM students s WHERE s.id = p.student_id AND s.deleted_at IS NOT NULL)`
+
+func scanInstallments(rows *sql.Rows) ([]models.Installment, error) {
+	installments := []models.Installment{}
+	for rows.Next() {
+		var inst models.Installment
+		var debtID sql.NullInt64
+		var currency money.Currency
+		if err := rows.Scan(&inst.ID, &inst.PlanID, &inst.Seq, &inst.DueDate, &inst.Amount, &inst.PaidAmount, &inst.Status, &debtID, &inst.InvoiceID,
+			&inst.RemindedAt, &inst.PaidAt, &inst.CompanyID, &inst.StudentID, &inst.SubscriptionID, &currency); err != nil {
+			return nil, fmt.Errorf("error scanning installment: %w", err)
+		}
+		if debtID.Valid {
+			id := int(debtID.Int64)
+			inst.DebtID = &id
+		}
+		inst.Amount = inst.Amount.WithCurrency(currency)
+		inst.PaidAmount = inst.PaidAmount.WithCurrency(currency)
+		installments = append(installments, inst)
+	}
+	return installments, rows.Err()
+}
+
+// CreatePlan stores a plan with its installments for a subscription. The student, branch and
+// currency are taken from the subscription.
+func (r *InstallmentRepository) CreatePlan(plan *models.InstallmentPlan, companyID string) error {
+	dbTx, err := database.Tenant(r.db, companyID).Begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer dbTx.Rollback()
+
+	var exists bool
+	err = dbTx.QueryRow(`SELECT EXISTS(SELECT 1 FROM installment_plans WHERE subscription_id = $1 AND company_id = $2 AND status <> 'cancelled')`,
+		plan.SubscriptionID, companyID).Scan(&exists)
+	if err != nil {
+		return fmt.Errorf("error checking existing plan: %w", err)
+	}
+	if exists {
+		return ErrPlanExists
+	}
+
+	query := `
+		INSERT INTO installment_plans (subscription_id, student_id, total_amount, currency, billing_mode, reminder_days, grace_days,
+			created_by, company_id, branch_id)
+		SELECT ss.id, ss.student_id, $2, ss.currency, $3, $4, $5, $6, $7, COALESCE(ss.branch_id, s.branch_id)
+		FROM student_subscriptions ss
+		JOIN students s ON s.id = ss.student_id
+		WHERE ss.id = $1 AND ss.company_id = $7
+		RETURNING id, student_id, status, created_at, COALESCE(branch_id, ''), currency`
+	err = dbTx.QueryRow(query, plan.SubscriptionID, plan.TotalAmount, plan.BillingMode, plan.ReminderDays, plan.GraceDays, plan.CreatedBy, companyID).
+		Scan(&plan.ID, &plan.StudentID, &plan.Status, &plan.CreatedAt, &plan.BranchID, &plan.Currency)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return err
+		}
+		return fmt.Errorf("error creating installment plan: %w", err)
+	}
+
+	for i := range plan.Installments {
+		inst := &plan.Installments[i]
+		err = dbTx.QueryRow(`
+			INSERT INTO installments (plan_id, seq, due_date, amount, company_id)
+			VALUES ($1, $2, $3, $4, $5)
+			RETURNING id, status`,
+			plan.ID, inst.Seq, inst.DueDate, inst.Amount, companyID).Scan(&inst.ID, &inst.Status)
+		if err != nil {
+			return fmt.Errorf("error creating installment: %w", err)
+		}
+		inst.PlanID = plan.ID
+		inst.CompanyID = companyID
+		inst.StudentID = plan.StudentID
+		inst.SubscriptionID = plan.SubscriptionID
+	}
+
+	if err := dbTx.Commit(); err != nil {
+		return fmt.Errorf("error committing installment plan: %w", err)
+	}
+	plan.CompanyID = companyID
+	plan.ApplyCurrency()
+	return nil
+}
+
+// GetPlanBySubscription returns the active or completed plan of a subscription with its installments
+func (r *InstallmentRepository) GetPlanBySubscription(subscriptionID string, companyID string) (*models.InstallmentPlan, error) {
+	query := `SELECT ` + installmentPlanColumns + ` FROM installment_plans
+		WHERE subscription_id = $1 AND company_id = $2 AND status <> 'cancelled'`
+	plan, err := scanInstallmentPlan(database.Tenant(r.db, companyID).QueryRow(query, subscriptionID, companyID))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error getting installment plan: %w", err)
+	}
+
+	rows, err := database.Tenant(r.db, companyID).Query(`SELECT `+installmentColumns+`
+		FROM installments i JOIN installment_plans p ON p.id = i.plan_id
+		WHERE i.plan_id = $1
+		ORDER BY i.seq`, plan.ID)
+	if err != nil {
+		return nil, fmt.Errorf("error getting installments: %w", err)
+	}
+	defer rows.Close()
+
+	plan.Installments, err = scanInstallments(rows)
+	if err != nil {
+		return nil, err
+	}
+	return plan, nil
+}
+
+// BilledByInstallments reports whether the subscription's price is billed by an installment plan
+// (active or completed), so lessons charged to it must not open negative balance debts as well
+func BilledByInstallments(dbTx *sql.Tx, subscriptionID string) (bool, error) {
+	var billed bool
+	err := dbTx.QueryRow(`SELECT EXISTS (SELECT 1 FROM installment_plans WHERE subscription_id = $1 AND status <> 'cancelled')`,
+		subscriptionID).Scan(&billed)
+	if err != nil {
+		return false, fmt.Errorf("error checking installment plan: %w", err)
+	}
+	return billed, nil
+}
+
+// CancelPlan cancels the active plan of a subscription. Installments not yet charged are cancelled;
+// debts and invoices already generated stay. A subscription suspended by the plan is reactivated.
+func (r *InstallmentRepository) CancelPlan(subscriptionID string, companyID string) error {
+	dbTx, err := database.Tenant(r.db, companyID).Begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer dbTx.Rollback()
+
+	var planID int
+	var suspendedAt sql.NullTime
+	err = dbTx.QueryRow(`
+		UPDATE installment_plans SET status = 'cancelled'
+		WHERE subscription_id = $1 AND company_id = $2 AND status = 'active'
+		RETURNING id, suspended_at`, subscriptionID, companyID).Scan(&planID, &suspendedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return err
+		}
+		return fmt.Errorf("error cancelling installment plan: %w", err)
+	}
+
+	if _, err := dbTx.Exec(`UPDATE installments SET status = 'cancelled' WHERE plan_id = $1 AND status = 'scheduled'`, planID); err != nil {
+		return fmt.Errorf("error cancelling installments: %w", err)
+	}
+	if suspendedAt.Valid {
+		if _, err := dbTx.Exec(`UPDATE student_subscriptions SET status = 'active', updated_at = CURRENT_TIMESTAMP
+			WHERE id = $1 AND status = 'suspended'`, subscriptionID); err != nil {
+			return fmt.Errorf("error reactivating subscription: %w", err)
+		}
+	}
+
+	return dbTx.Commit()
+}
+
+// List returns installments of active plans, optionally filtered by status and branches, by due date
+func (r *InstallmentRepository) List(status string, companyID string, branchIDs []string) ([]models.Installment, error) {
+	query := `SELECT ` + installmentColumns + `
+		FROM installments i JOIN installment_plans p ON p.id = i.plan_id
+		WHERE i.company_id = $1 AND p.status <> 'cancelled' AND ` + planNotTrashed
+	args := []interface{}{companyID}
+	if status != "" {
+		args = append(args, status)
+		query += fmt.Sprintf(" AND i.status = $%d", len(args))
+	}
+	if len(branchIDs) > 0 {
+		placeholders := make([]string, len(branchIDs))
+		for i, id := range branchIDs {
+			args = append(args, id)
+			placeholders[i] = fmt.Sprintf("$%d", len(args))
+		}
+		query += " AND p.branch_id IN (" + strings.Join(placeholders, ", ") + ")"
+	}
+	query += " ORDER BY i.due_date, i.plan_id, i.seq"
+
+	rows, err := database.Tenant(r.db, companyID).Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error getting installments: %w", err)
+	}
+	defer rows.Close()
+	return scanInstallments(rows)
+}
+
+// ============= Background processing (all companies) =============
+
+// GetDueForCharge returns installments of active plans that reached their due date but were not charged yet
+func (r *InstallmentRepository) GetDueForCharge(today time.Time) ([]models.Installment, error) {
+	rows, err := database.System(r.db).Query(`SELECT `+installmentColumns+`
+		FROM installments i JOIN installment_plans p ON p.id = i.plan_id
+		WHERE p.status = 'active' AND i.status = 'scheduled' AND i.due_date <= $1 AND `+planNotTrashed+`
+		ORDER BY i.due_date, i.id`, today)
+	if err != nil {
+		return nil, fmt.Errorf("error getting due installments: %w", err)
+	}
+	defer rows.Close()
+	return scanInstallments(rows)
+}
+
+// Charge generates the debt or invoice of a scheduled installment (depending on the plan billing mode)
+// and marks it due. Installments that are no longer scheduled are left alone.
+func (r *InstallmentRepository) Charge(installmentID int) error {
+	dbTx, err := database.System(r.db).Begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer dbTx.Rollback()
+
+	var (
+		seq, count           int
+		dueDate              time.Time
+		amount               money.Money
+		status, mode         string
+		studentID, companyID string
+		branchID             sql.NullString
+		currency             money.Currency
+	)
+	err = dbTx.QueryRow(`
+		SELECT i.seq, i.due_date, i.amount, i.status, p.billing_mode, p.student_id, p.company_id, p.branch_id, p.currency,
+		       (SELECT COUNT(*) FROM installments WHERE plan_id = p.id)
+		FROM installments i JOIN installment_plans p ON p.id = i.plan_id
+		WHERE i.id = $1
+		FOR UPDATE OF i`, installmentID).
+		Scan(&seq, &dueDate, &amount, &status, &mode, &studentID, &companyID, &branchID, &currency, &count)
+	if err != nil {
+		return fmt.Errorf("error getting installment: %w", err)
+	}
+	if status != "scheduled" {
+		return nil
+	}
+	description := fmt.Sprintf("Рассрочка по абонементу: платеж %d из %d", seq, count)
+
+	if mode == "invoice" {
+		var invoiceID int64
+		err = dbTx.QueryRow(`
+			INSERT INTO invoice (student_id, issued_at, due_at, status, company_id, branch_id, currency)
+			VALUES ($1, CURRENT_TIMESTAMP, $2, 'unpaid', $3, $4, $5)
+			RETURNING id`, studentID, dueDate, companyID, branchID, currency).Scan(&invoiceID)
+		if err != nil {
+			return fmt.Errorf("error creating installment invoice: %w", err)
+		}
+		_, err = dbTx.Exec(`
+			INSERT INTO invoice_item (invoice_id, description, quantity, unit_price, company_id)
+			VALUES ($1, $2, 1, $3, $4)`, invoiceID, description, amount, companyID)
+		if err != nil {
+			return fmt.Errorf("error creating installment invoice item: %w", err)
+		}
+		_, err = dbTx.Exec(`UPDATE installments SET status = 'due', invoice_id = $2 WHERE id = $1`, installmentID, invoiceID)
+	} else {
+		var debtID int
+		err = dbTx.QueryRow(`
+			INSERT INTO debt_records (student_id, amount, due_date, status, source, notes, company_id, branch_id, currency)
+			VALUES ($1, $2, $3, 'pending', 'installment', $4, $5, $6, $7)
+			RETURNING id`, studentID, amount, dueDate, description, companyID, branchID, currency).Scan(&debtID)
+		if err != nil {
+			return fmt.Errorf("error creating installment debt: %w", err)
+		}
+		_, err = dbTx.Exec(`UPDATE installments SET status = 'due', debt_id = $2 WHERE id = $1`, installmentID, debtID)
+	}
+	if err != nil {
+		return fmt.Errorf("error updating installment: %w", err)
+	}
+
+	return dbTx.Commit()
+}
+
+// GetCharged returns charged, not yet paid installments of active plans with PaidAmount recomputed
+// from what was paid against their debt or invoice
+func (r *InstallmentRepository) GetCharged() ([]models.Installment, error) {
+	rows, err := database.System(r.db).Query(`
+		SELECT i.id, i.plan_id, i.seq, i.due_date, i.amount,
+		       CASE WHEN inv.status = 'paid' THEN i.amount
+		            ELSE COALESCE(d.paid_amount, 0) + COALESCE(ip.paid, 0) END,
+		       i.status, i.debt_id, i.invoice_id, i.reminded_at, i.paid_at, i.company_id, p.student_id, p.subscription_id, p.currency
+		FROM installments i
+		JOIN installment_plans p ON p.id = i.plan_id
+		LEFT JOIN invoice inv ON inv.id = i.invoice_id
+		LEFT JOIN debt_records d ON d.id = i.debt_id OR (i.invoice_id IS NOT NULL AND d.invoice_id = i.invoice_id)
+		LEFT JOIN (SELECT invoice_id, SUM(amount) AS paid FROM transaction WHERE kind = 'pay_invoice' GROUP BY invoice_id) ip
+		       ON ip.invoice_id = i.invoice_id
+		WHERE p.status = 'active' AND i.status IN ('due', 'partially_paid', 'overdue')`)
+	if err != nil {
+		return nil, fmt.Errorf("error getting charged installments: %w", err)
+	}
+	defer rows.Close()
+	return scanInstallments(rows)
+}
+
+// UpdateStatus stores the paid amount and status of an installment
+func (r *InstallmentRepository) UpdateStatus(id int, paid money.Money, status string) error {
+	_, err := database.System(r.db).Exec(`
+		UPDATE installments
+		SET paid_amount = $2, status = $3,
+		    paid_at = CASE WHEN $3 = 'paid' THEN COALESCE(paid_at, CURRENT_TIMESTAMP) ELSE NULL END
+		WHERE id = $1`, id, paid, status)
+	if err != nil {
+		return fmt.Errorf("error updating installment status: %w", err)
+	}
+	return nil
+}
+
+// GetToRemind returns scheduled installments whose reminder window (plan reminder_days before the due date) has started
+func (r *InstallmentRepository) GetToRemind(today time.Time) ([]models.Installment, error) {
+	rows, err := database.System(r.db).Query(`SELECT `+installmentColumns+`
+		FROM installments i JOIN installment_plans p ON p.id = i.plan_id
+		WHERE p.status = 'active' AND i.status = 'scheduled' AND i.reminded_at IS NULL AND `+planNotTrashed+`
+		  AND i.due_date - p.reminder_days <= $1::date
+		ORDER BY i.due_date, i.id`, today)
+	if err != nil {
+		return nil, fmt.Errorf("error getting installments to remind: %w", err)
+	}
+	defer rows.Close()
+	return scanInstallments(rows)
+}
+
+// MarkReminded records that the reminder for an installment was sent
+func (r *InstallmentRepository) MarkReminded(id int) error {
+	_, err := database.System(r.db).Exec(`UPDATE installments SET reminded_at = CURRENT_TIMESTAMP WHERE id = $1`, id)
+	if err != nil {
+		return fmt.Errorf("error marking installment reminded: %w", err)
+	}
+	return nil
+}
+
+// pastGraceCondition matches plans with an unpaid installment overdue for longer than the grace period
+const pastGraceCondition = `EXISTS (
+		SELECT 1 FROM installments i
+		WHERE i.plan_id = p.id AND i.status IN ('due', 'partially_paid', 'overdue')
+		  AND i.due_date + p.grace_days < $1::date)`
+
+// GetPlansToSuspend returns active plans with a grace period that has been exceeded and whose subscription is not suspended yet
+func (r *InstallmentRepository) GetPlansToSuspend(today time.Time) ([]*models.InstallmentPlan, error) {
+	return r.queryPlans(`SELECT `+installmentPlanColumns+` FROM installment_plans p
+		WHERE p.status = 'active' AND p.grace_days IS NOT NULL AND p.suspended_at IS NULL AND `+planNotTrashed+` AND `+pastGraceCondition, today)
+}
+
+// GetPlansToResume returns plans that suspended their subscription and no longer have installments past the grace period
+func (r *InstallmentRepository) GetPlansToResume(today time.Time) ([]*models.InstallmentPlan, error) {
+	return r.queryPlans(`SELECT `+installmentPlanColumns+` FROM installment_plans p
+		WHERE p.status IN ('active', 'completed') AND p.suspended_at IS NOT NULL AND NOT `+pastGraceCondition, today)
+}
+
+func (r *InstallmentRepository) queryPlans(query string, args ...interface{}) ([]*models.InstallmentPlan, error) {
+	rows, err := database.System(r.db).Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error getting installment plans: %w", err)
+	}
+	defer rows.Close()
+
+	plans := []*models.InstallmentPlan{}
+	for rows.Next() {
+		plan, err := scanInstallmentPlan(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning installment plan: %w", err)
+		}
+		plans = append(plans, plan)
+	}
+	return plans, rows.Err()
+}
+
+// SetSuspended suspends (or reactivates) the subscription of a plan. Only active subscriptions are
+// suspended and only subscriptions suspended by the plan are reactivated.
+func (r *InstallmentRepository) SetSuspended(plan *models.InstallmentPlan, suspended bool) error {
+	dbTx, err := database.System(r.db).Begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer dbTx.Rollback()
+
+	from, to := "suspended", "active"
+	planUpdate := `UPDATE installment_plans SET suspended_at = NULL WHERE id = $1`
+	if suspended {
+		from, to = "active", "suspended"
+		planUpdate = `UPDATE installment_plans SET suspended_at = CURRENT_TIMESTAMP WHERE id = $1`
+	}
+
+	if _, err := dbTx.Exec(planUpdate, plan.ID); err != nil {
+		return fmt.Errorf("error updating installment plan: %w", err)
+	}
+	if _, err := dbTx.Exec(`UPDATE student_subscriptions SET status = $2, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND status = $3`, plan.SubscriptionID, to, from); err != nil {
+		return fmt.Errorf("error updating subscription status: %w", err)
+	}
+
+	return dbTx.Commit()
+}
+
+// CompletePlans marks active plans whose installments are all paid (or cancelled) as completed
+func (r *InstallmentRepository) CompletePlans() (int64, error) {
+	result, err := database.System(r.db).Exec(`
+		UPDATE installment_plans p SET status = 'completed'
+		WHERE p.status = 'active'
+		  AND NOT EXISTS (SELECT 1 FROM installments i WHERE i.plan_id = p.id AND i.status NOT IN ('paid', 'cancelled'))`)
+	if err != nil {
+		return 0, fmt.Errorf("error completing installment plans: %w", err)
+	}
+	return result.RowsAffected()
+}
@@ -4,7 +4,9 @@ import (
 	"database/sql"
 	"fmt"
 
+	"classmate-central/internal/database"
 	"classmate-central/internal/models"
+	"classmate-central/internal/money"
 )
 
 type InvoiceRepository struct {
@@ -17,18 +19,18 @@ func NewInvoiceRepository(db *sql.DB) *InvoiceRepository {
 
 func (r *InvoiceRepository) Create(invoice *models.Invoice, companyID string) error {
 	query := `
-		INSERT INTO invoice (student_id, issued_at, due_at, status, company_id)
-		VALUES ($1, $2, $3, $4, $5)
-		RETURNING id, created_at, updated_at
+		INSERT INTO invoice (student_id, issued_at, due_at, status, company_id, currency)
+		VALUES ($1, $2, $3, $4, $5, effective_currency($5, (SELECT branch_id FROM students WHERE id = $1)))
+		RETURNING id, created_at, updated_at, currency
 	`
-	err := r.db.QueryRow(
+	err := database.Tenant(r.db, companyID).QueryRow(
 		query,
 		invoice.StudentID,
 		invoice.IssuedAt,
 		invoice.DueAt,
 		invoice.Status,
 		companyID,
-	).Scan(&invoice.ID, &invoice.CreatedAt, &invoice.UpdatedAt)
+	).Scan(&invoice.ID, &invoice.CreatedAt, &invoice.UpdatedAt, &invoice.Currency)
 	if err != nil {
 		return fmt.Errorf("error creating invoice: %w", err)
 	}
@@ -39,9 +41,9 @@ func (r *InvoiceRepository) GetByID(id int64, companyID string) (*models.Invoice
 	invoice := &models.Invoice{}
 	var dueAt sql.NullTime
 
-	query := `SELECT id, student_id, issued_at, due_at, status, company_id, created_at, updated_at 
+	query := `SELECT id, student_id, issued_at, due_at, status, company_id, created_at, updated_at, currency
 	          FROM invoice WHERE id = $1 AND company_id = $2`
-	err := r.db.QueryRow(query, id, companyID).Scan(
+	err := database.Tenant(r.db, companyID).QueryRow(query, id, companyID).Scan(
 		&invoice.ID,
 		&invoice.StudentID,
 		&invoice.IssuedAt,
@@ -50,6 +52,7 @@ func (r *InvoiceRepository) GetByID(id int64, companyID string) (*models.Invoice
 		&invoice.CompanyID,
 		&invoice.CreatedAt,
 		&invoice.UpdatedAt,
+		&invoice.Currency,
 	)
 	if err == sql.ErrNoRows {
 		return nil, nil
@@ -67,12 +70,12 @@ func (r *InvoiceRepository) GetByID(id int64, companyID string) (*models.Invoice
 
 func (r *InvoiceRepository) GetByStudentID(studentID string, companyID string) ([]*models.Invoice, error) {
 	query := `
-		SELECT id, student_id, issued_at, due_at, status, company_id, created_at, updated_at 
+		SELECT id, student_id, issued_at, due_at, status, company_id, created_at, updated_at, currency
 		FROM invoice 
 		WHERE student_id = $1 AND company_id = $2
 		ORDER BY issued_at DESC
 	`
-	rows, err := r.db.Query(query, studentID, companyID)
+	rows, err := database.Tenant(r.db, companyID).Query(query, studentID, companyID)
 	if err != nil {
 		return nil, fmt.Errorf("error getting invoices: %w", err)
 	}
@@ -92,6 +95,7 @@ func (r *InvoiceRepository) GetByStudentID(studentID string, companyID string) (
 			&invoice.CompanyID,
 			&invoice.CreatedAt,
 			&invoice.UpdatedAt,
+			&invoice.Currency,
 		)
 		if err != nil {
 			return nil, fmt.Errorf("error scanning invoice: %w", err)
@@ -107,13 +111,33 @@ func (r *InvoiceRepository) GetByStudentID(studentID string, companyID string) (
 	return invoices, nil
 }
 
+// GetBalanceDue returns the unpaid part of an invoice (items minus invoice payments) with its status.
+// Returns sql.ErrNoRows if the invoice does not exist.
+func (r *InvoiceRepository) GetBalanceDue(id int64, companyID string) (*models.Invoice, money.Money, error) {
+	invoice := &models.Invoice{}
+	var due money.Money
+	query := `SELECT i.id, i.student_id, i.status, i.currency,
+	                 COALESCE((SELECT SUM(quantity * unit_price) FROM invoice_item WHERE invoice_id = i.id), 0)
+	                 - COALESCE((SELECT SUM(amount) FROM transaction WHERE invoice_id = i.id AND kind = 'pay_invoice'), 0)
+	          FROM invoice i WHERE i.id = $1 AND i.company_id = $2`
+	err := database.Tenant(r.db, companyID).QueryRow(query, id, companyID).Scan(&invoice.ID, &invoice.StudentID, &invoice.Status, &invoice.Currency, &due)
+	if err == sql.ErrNoRows {
+		return nil, money.Money{}, sql.ErrNoRows
+	}
+	if err != nil {
+		return nil, money.Money{}, fmt.Errorf("error getting invoice balance: %w", err)
+	}
+	invoice.CompanyID = companyID
+	return invoice, due.WithCurrency(invoice.Currency), nil
+}
+
 func (r *InvoiceRepository) Update(invoice *models.Invoice, companyID string) error {
 	query := `
 		UPDATE invoice 
 		SET student_id = $2, issued_at = $3, due_at = $4, status = $5, updated_at = CURRENT_TIMESTAMP
 		WHERE id = $1 AND company_id = $6
 	`
-	_, err := r.db.Exec(
+	_, err := database.Tenant(r.db, companyID).Exec(
 		query,
 		invoice.ID,
 		invoice.StudentID,
@@ -130,7 +154,7 @@ func (r *InvoiceRepository) Update(invoice *models.Invoice, companyID string) er
 
 func (r *InvoiceRepository) Delete(id int64, companyID string) error {
 	query := `DELETE FROM invoice WHERE id = $1 AND company_id = $2`
-	_, err := r.db.Exec(query, id, companyID)
+	_, err := database.Tenant(r.db, companyID).Exec(query, id, companyID)
 	if err != nil {
 		return fmt.Errorf("error deleting invoice: %w", err)
 	}
@@ -145,7 +169,7 @@ func (r *InvoiceRepository) CreateItem(item *models.InvoiceItem, companyID strin
 		VALUES ($1, $2, $3, $4, $5, $6)
 		RETURNING id, created_at
 	`
-	err := r.db.QueryRow(
+	err := database.Tenant(r.db, companyID).QueryRow(
 		query,
 		item.InvoiceID,
 		item.Description,
@@ -162,12 +186,13 @@ func (r *InvoiceRepository) CreateItem(item *models.InvoiceItem, companyID strin
 
 func (r *InvoiceRepository) GetItemsByInvoiceID(invoiceID int64, companyID string) ([]*models.InvoiceItem, error) {
 	query := `
-		SELECT id, invoice_id, description, quantity, unit_price, meta, company_id, created_at 
-		FROM invoice_item 
-		WHERE invoice_id = $1 AND company_id = $2
-		ORDER BY id ASC
+		SELECT ii.id, ii.invoice_id, ii.description, ii.quantity, ii.unit_price, ii.meta, ii.company_id, ii.created_at, i.currency
+		FROM invoice_item ii
+		JOIN invoice i ON i.id = ii.invoice_id
+		WHERE ii.invoice_id = $1 AND ii.company_id = $2
+		ORDER BY ii.id ASC
 	`
-	rows, err := r.db.Query(query, invoiceID, companyID)
+	rows, err := database.Tenant(r.db, companyID).Query(query, invoiceID, companyID)
 	if err != nil {
 		return nil, fmt.Errorf("error getting invoice items: %w", err)
 	}
@@ -177,6 +202,7 @@ func (r *InvoiceRepository) GetItemsByInvoiceID(invoiceID int64, companyID strin
 	for rows.Next() {
 		item := &models.InvoiceItem{}
 		var meta sql.NullString
+		var currency money.Currency
 
 		err := rows.Scan(
 			&item.ID,
@@ -187,10 +213,12 @@ func (r *InvoiceRepository) GetItemsByInvoiceID(invoiceID int64, companyID strin
 			&meta,
 			&item.CompanyID,
 			&item.CreatedAt,
+			&currency,
 		)
 		if err != nil {
 			return nil, fmt.Errorf("error scanning invoice item: %w", err)
 		}
+		item.UnitPrice = item.UnitPrice.WithCurrency(currency)
 
 		if meta.Valid {
 			item.Meta = &meta.String
@@ -204,7 +232,7 @@ func (r *InvoiceRepository) GetItemsByInvoiceID(invoiceID int64, companyID strin
 
 func (r *InvoiceRepository) DeleteItem(id int64, companyID string) error {
 	query := `DELETE FROM invoice_item WHERE id = $1 AND company_id = $2`
-	_, err := r.db.Exec(query, id, companyID)
+	_, err := database.Tenant(r.db, companyID).Exec(query, id, companyID)
 	if err != nil {
 		return fmt.Errorf("error deleting invoice item: %w", err)
 	}
@@ -1,6 +1,7 @@
 package repository
 
 import (
+	"classmate-central/internal/database"
 	"classmate-central/internal/models"
 	"database/sql"
 	"fmt"
@@ -61,7 +62,7 @@ func (r *LeadRepository) GetAllByBranches(companyID string, branchIDs []string)
 		}
 	}
 	
-	rows, err := r.db.Query(query, args...)
+	rows, err := database.Tenant(r.db, companyID).Query(query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -98,7 +99,7 @@ func (r *LeadRepository) GetByID(id string, companyID string) (*models.Lead, err
 	var lead models.Lead
 	var email, notes sql.NullString
 	var assignedTo sql.NullInt64
-	err := r.db.QueryRow(query, id, companyID).Scan(&lead.ID, &lead.Name, &lead.Phone, &email,
+	err := database.Tenant(r.db, companyID).QueryRow(query, id, companyID).Scan(&lead.ID, &lead.Name, &lead.Phone, &email,
 		&lead.Source, &lead.Status, &notes, &assignedTo, &lead.CreatedAt, &lead.UpdatedAt)
 	if err != nil {
 		return nil, err
@@ -120,7 +121,7 @@ func (r *LeadRepository) Create(lead *models.Lead, companyID string) error {
 	query := `INSERT INTO leads (id, name, phone, email, source, status, notes, assigned_to, created_at, updated_at, company_id) 
 	          VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)`
 	now := time.Now()
-	_, err := r.db.Exec(query, lead.ID, lead.Name, lead.Phone, lead.Email, lead.Source,
+	_, err := database.Tenant(r.db, companyID).Exec(query, lead.ID, lead.Name, lead.Phone, lead.Email, lead.Source,
 		lead.Status, lead.Notes, lead.AssignedTo, now, now, companyID)
 	return err
 }
@@ -128,21 +129,21 @@ func (r *LeadRepository) Create(lead *models.Lead, companyID string) error {
 func (r *LeadRepository) Update(lead *models.Lead, companyID string) error {
 	query := `UPDATE leads SET name = $1, phone = $2, email = $3, source = $4, status = $5, 
 	          notes = $6, assigned_to = $7, updated_at = $8 WHERE id = $9 AND company_id = $10`
-	_, err := r.db.Exec(query, lead.Name, lead.Phone, lead.Email, lead.Source, lead.Status,
+	_, err := database.Tenant(r.db, companyID).Exec(query, lead.Name, lead.Phone, lead.Email, lead.Source, lead.Status,
 		lead.Notes, lead.AssignedTo, time.Now(), lead.ID, companyID)
 	return err
 }
 
 func (r *LeadRepository) Delete(id string, companyID string) error {
 	query := `DELETE FROM leads WHERE id = $1 AND company_id = $2`
-	_, err := r.db.Exec(query, id, companyID)
+	_, err := database.Tenant(r.db, companyID).Exec(query, id, companyID)
 	return err
 }
 
 func (r *LeadRepository) GetByStatus(status string, companyID string) ([]models.Lead, error) {
 	query := `SELECT id, name, phone, email, source, status, notes, assigned_to, created_at, updated_at 
 	          FROM leads WHERE status = $1 AND company_id = $2 ORDER BY created_at DESC`
-	rows, err := r.db.Query(query, status, companyID)
+	rows, err := database.Tenant(r.db, companyID).Query(query, status, companyID)
 	if err != nil {
 		return nil, err
 	}
@@ -176,7 +177,7 @@ func (r *LeadRepository) GetByStatus(status string, companyID string) ([]models.
 func (r *LeadRepository) GetBySource(source string, companyID string) ([]models.Lead, error) {
 	query := `SELECT id, name, phone, email, source, status, notes, assigned_to, created_at, updated_at 
 	          FROM leads WHERE source = $1 AND company_id = $2 ORDER BY created_at DESC`
-	rows, err := r.db.Query(query, source, companyID)
+	rows, err := database.Tenant(r.db, companyID).Query(query, source, companyID)
 	if err != nil {
 		return nil, err
 	}
@@ -219,7 +220,7 @@ func (r *LeadRepository) GetConversionStats(companyID string) (*models.LeadConve
 		WHERE company_id = $1
 	`
 	var stats models.LeadConversionStats
-	err := r.db.QueryRow(query, companyID).Scan(&stats.TotalLeads, &stats.NewLeads,
+	err := database.Tenant(r.db, companyID).QueryRow(query, companyID).Scan(&stats.TotalLeads, &stats.NewLeads,
 		&stats.InProgressLeads, &stats.EnrolledLeads, &stats.RejectedLeads)
 	if err != nil {
 		return nil, err
@@ -234,46 +235,53 @@ func (r *LeadRepository) GetConversionStats(companyID string) (*models.LeadConve
 }
 
 // Lead Activities
-func (r *LeadRepository) GetActivities(leadID string) ([]models.LeadActivity, error) {
+func (r *LeadRepository) GetActivities(leadID, companyID string) ([]models.LeadActivity, error) {
 	query := `SELECT id, lead_id, activity_type, description, created_by, created_at 
-	          FROM lead_activities WHERE lead_id = $1 ORDER BY created_at DESC`
-	rows, err := r.db.Query(query, leadID)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
+	          FROM lead_activities WHERE lead_id = $1 AND company_id = $2 ORDER BY created_at DESC`
 
 	activities := []models.LeadActivity{} // Initialize as empty slice instead of nil
-	for rows.Next() {
-		var activity models.LeadActivity
-		var createdBy sql.NullInt64
-		if err := rows.Scan(&activity.ID, &activity.LeadID, &activity.ActivityType,
-			&activity.Description, &createdBy, &activity.CreatedAt); err != nil {
-			return nil, err
+	err := database.WithTenant(r.db, companyID, func(tx *sql.Tx) error {
+		rows, err := tx.Query(query, leadID, companyID)
+		if err != nil {
+			return err
 		}
-		if createdBy.Valid {
-			val := int(createdBy.Int64)
-			activity.CreatedBy = &val
+		defer rows.Close()
+
+		for rows.Next() {
+			var activity models.LeadActivity
+			var createdBy sql.NullInt64
+			if err := rows.Scan(&activity.ID, &activity.LeadID, &activity.ActivityType,
+				&activity.Description, &createdBy, &activity.CreatedAt); err != nil {
+				return err
+			}
+			if createdBy.Valid {
+				val := int(createdBy.Int64)
+				activity.CreatedBy = &val
+			}
+			activities = append(activities, activity)
 		}
-		activities = append(activities, activity)
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, err
 	}
 
 	return activities, nil
 }
 
-func (r *LeadRepository) AddActivity(activity *models.LeadActivity) error {
+func (r *LeadRepository) AddActivity(activity *models.LeadActivity, companyID string) error {
 	query := `INSERT INTO lead_activities (lead_id, activity_type, description, created_by, created_at) 
 	          VALUES ($1, $2, $3, $4, $5) RETURNING id`
-	err := r.db.QueryRow(query, activity.LeadID, activity.ActivityType, activity.Description,
+	err := database.Tenant(r.db, companyID).QueryRow(query, activity.LeadID, activity.ActivityType, activity.Description,
 		activity.CreatedBy, time.Now()).Scan(&activity.ID)
 	return err
 }
 
 // Lead Tasks
-func (r *LeadRepository) GetTasks(leadID string) ([]models.LeadTask, error) {
+func (r *LeadRepository) GetTasks(leadID, companyID string) ([]models.LeadTask, error) {
 	query := `SELECT id, lead_id, title, description, due_date, status, assigned_to, created_at, completed_at 
-	          FROM lead_tasks WHERE lead_id = $1 ORDER BY due_date ASC`
-	rows, err := r.db.Query(query, leadID)
+	          FROM lead_tasks WHERE lead_id = $1 AND company_id = $2 ORDER BY due_date ASC`
+	rows, err := database.Tenant(r.db, companyID).Query(query, leadID, companyID)
 	if err != nil {
 		return nil, err
 	}
@@ -308,17 +316,18 @@ func (r *LeadRepository) GetTasks(leadID string) ([]models.LeadTask, error) {
 	return tasks, nil
 }
 
-func (r *LeadRepository) CreateTask(task *models.LeadTask) error {
+func (r *LeadRepository) CreateTask(task *models.LeadTask, companyID string) error {
 	query := `INSERT INTO lead_tasks (lead_id, title, description, due_date, status, assigned_to, created_at) 
 	          VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id`
-	err := r.db.QueryRow(query, task.LeadID, task.Title, task.Description, task.DueDate,
+	err := database.Tenant(r.db, companyID).QueryRow(query, task.LeadID, task.Title, task.Description, task.DueDate,
 		task.Status, task.AssignedTo, time.Now()).Scan(&task.ID)
 	return err
 }
 
-func (r *LeadRepository) UpdateTask(task *models.LeadTask) error {
+// UpdateTask updates a task of one of the company's leads; sql.ErrNoRows if there is none
+func (r *LeadRepository) UpdateTask(task *models.LeadTask, companyID string) error {
 	query := `UPDATE lead_tasks SET title = $1, description = $2, due_date = $3, status = $4, 
-	          assigned_to = $5, completed_at = $6 WHERE id = $7`
+	          assigned_to = $5, completed_at = $6 WHERE id = $7 AND lead_id = $8 AND company_id = $9`
 	var completedAt *time.Time
 	if task.Status == "completed" && task.CompletedAt == nil {
 		now := time.Now()
@@ -326,7 +335,17 @@ func (r *LeadRepository) UpdateTask(task *models.LeadTask) error {
 	} else {
 		completedAt = task.CompletedAt
 	}
-	_, err := r.db.Exec(query, task.Title, task.Description, task.DueDate, task.Status,
-		task.AssignedTo, completedAt, task.ID)
-	return err
+	result, err := database.Tenant(r.db, companyID).Exec(query, task.Title, task.Description, task.DueDate, task.Status,
+		task.AssignedTo, completedAt, task.ID, task.LeadID, companyID)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
 }
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"time"
 
+	"classmate-central/internal/database"
 	"classmate-central/internal/models"
 )
 
@@ -22,7 +23,7 @@ func (r *LessonOccurrenceRepository) Create(occurrence *models.LessonOccurrence,
 		VALUES ($1, $2, $3, $4, $5)
 		RETURNING id, created_at, updated_at
 	`
-	err := r.db.QueryRow(
+	err := database.Tenant(r.db, companyID).QueryRow(
 		query,
 		occurrence.RuleID,
 		occurrence.StartsAt,
@@ -41,7 +42,7 @@ func (r *LessonOccurrenceRepository) GetByID(id int64, companyID string) (*model
 
 	query := `SELECT id, rule_id, starts_at, ends_at, status, company_id, created_at, updated_at 
 	          FROM lesson_occurrence WHERE id = $1 AND company_id = $2`
-	err := r.db.QueryRow(query, id, companyID).Scan(
+	err := database.Tenant(r.db, companyID).QueryRow(query, id, companyID).Scan(
 		&occurrence.ID,
 		&occurrence.RuleID,
 		&occurrence.StartsAt,
@@ -68,7 +69,7 @@ func (r *LessonOccurrenceRepository) GetByRuleID(ruleID int64, companyID string)
 		WHERE rule_id = $1 AND company_id = $2
 		ORDER BY starts_at ASC
 	`
-	rows, err := r.db.Query(query, ruleID, companyID)
+	rows, err := database.Tenant(r.db, companyID).Query(query, ruleID, companyID)
 	if err != nil {
 		return nil, fmt.Errorf("error getting lesson occurrences: %w", err)
 	}
@@ -105,7 +106,7 @@ func (r *LessonOccurrenceRepository) GetFutureByRuleID(ruleID int64, companyID s
 		WHERE rule_id = $1 AND company_id = $2 AND starts_at >= $3
 		ORDER BY starts_at ASC
 	`
-	rows, err := r.db.Query(query, ruleID, companyID, fromTime)
+	rows, err := database.Tenant(r.db, companyID).Query(query, ruleID, companyID, fromTime)
 	if err != nil {
 		return nil, fmt.Errorf("error getting future lesson occurrences: %w", err)
 	}
@@ -142,7 +143,7 @@ func (r *LessonOccurrenceRepository) GetInRange(start, end time.Time, companyID
 		WHERE company_id = $1 AND starts_at >= $2 AND starts_at < $3
 		ORDER BY starts_at ASC
 	`
-	rows, err := r.db.Query(query, companyID, start, end)
+	rows, err := database.Tenant(r.db, companyID).Query(query, companyID, start, end)
 	if err != nil {
 		return nil, fmt.Errorf("error getting lesson occurrences in range: %w", err)
 	}
@@ -178,7 +179,7 @@ func (r *LessonOccurrenceRepository) Update(occurrence *models.LessonOccurrence,
 		SET rule_id = $2, starts_at = $3, ends_at = $4, status = $5, updated_at = CURRENT_TIMESTAMP
 		WHERE id = $1 AND company_id = $6
 	`
-	_, err := r.db.Exec(
+	_, err := database.Tenant(r.db, companyID).Exec(
 		query,
 		occurrence.ID,
 		occurrence.RuleID,
@@ -198,7 +199,7 @@ func (r *LessonOccurrenceRepository) DeleteFutureByRuleID(ruleID int64, companyI
 		DELETE FROM lesson_occurrence 
 		WHERE rule_id = $1 AND company_id = $2 AND starts_at >= $3
 	`
-	_, err := r.db.Exec(query, ruleID, companyID, fromTime)
+	_, err := database.Tenant(r.db, companyID).Exec(query, ruleID, companyID, fromTime)
 	if err != nil {
 		return fmt.Errorf("error deleting future lesson occurrences: %w", err)
 	}
@@ -207,7 +208,7 @@ func (r *LessonOccurrenceRepository) DeleteFutureByRuleID(ruleID int64, companyI
 
 func (r *LessonOccurrenceRepository) Delete(id int64, companyID string) error {
 	query := `DELETE FROM lesson_occurrence WHERE id = $1 AND company_id = $2`
-	_, err := r.db.Exec(query, id, companyID)
+	_, err := database.Tenant(r.db, companyID).Exec(query, id, companyID)
 	if err != nil {
 		return fmt.Errorf("error deleting lesson occurrence: %w", err)
 	}
@@ -219,7 +220,7 @@ func (r *LessonOccurrenceRepository) BulkCreate(occurrences []*models.LessonOccu
 		return nil
 	}
 
-	tx, err := r.db.Begin()
+	tx, err := database.Tenant(r.db, companyID).Begin()
 	if err != nil {
 		return fmt.Errorf("error starting transaction: %w", err)
 	}
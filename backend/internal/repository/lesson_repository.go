@@ -6,6 +6,7 @@ import (
 	"strings"
 	"time"
 
+	"classmate-central/internal/database"
 	"classmate-central/internal/models"
 )
 
@@ -18,7 +19,7 @@ func NewLessonRepository(db *sql.DB) *LessonRepository {
 }
 
 func (r *LessonRepository) Create(lesson *models.Lesson, companyID, branchID string) error {
-	tx, err := r.db.Begin()
+	tx, err := database.Tenant(r.db, companyID).Begin()
 	if err != nil {
 		return fmt.Errorf("error starting transaction: %w", err)
 	}
@@ -94,7 +95,7 @@ func (r *LessonRepository) GetAllByBranches(companyID string, branchIDs []string
 	
 	if hasFallback && len(branchIDs) == 1 {
 		// Fallback mode: don't filter by branch_id
-		query = baseQuery + ` WHERE l.company_id = $1 ORDER BY l.start_time`
+		query = baseQuery + ` WHERE l.company_id = $1 AND l.deleted_at IS NULL ORDER BY l.start_time`
 		args = []interface{}{companyID}
 	} else {
 		// Filter by accessible branches only
@@ -102,7 +103,7 @@ func (r *LessonRepository) GetAllByBranches(companyID string, branchIDs []string
 		for i := range branchIDs {
 			placeholders[i] = fmt.Sprintf("$%d", i+2)
 		}
-		query = baseQuery + fmt.Sprintf(` WHERE l.company_id = $1 AND l.branch_id IN (%s) ORDER BY l.start_time`, strings.Join(placeholders, ","))
+		query = baseQuery + fmt.Sprintf(` WHERE l.company_id = $1 AND l.branch_id IN (%s) AND l.deleted_at IS NULL ORDER BY l.start_time`, strings.Join(placeholders, ","))
 		args = make([]interface{}, len(branchIDs)+1)
 		args[0] = companyID
 		for i, bid := range branchIDs {
@@ -110,7 +111,7 @@ func (r *LessonRepository) GetAllByBranches(companyID string, branchIDs []string
 		}
 	}
 
-	rows, err := r.db.Query(query, args...)
+	rows, err := database.Tenant(r.db, companyID).Query(query, args...)
 	if err != nil {
 		return nil, fmt.Errorf("error getting lessons: %w", err)
 	}
@@ -159,7 +160,7 @@ func (r *LessonRepository) GetAllByBranches(companyID string, branchIDs []string
 		lesson.StudentIds = []string{}
 
 		// Get students
-		studentRows, err := r.db.Query(`SELECT student_id FROM lesson_students WHERE lesson_id = $1`, lesson.ID)
+		studentRows, err := database.Tenant(r.db, companyID).Query(`SELECT student_id FROM lesson_students WHERE lesson_id = $1`, lesson.ID)
 		if err == nil {
 			defer studentRows.Close()
 			for studentRows.Next() {
@@ -191,10 +192,10 @@ func (r *LessonRepository) GetByID(id string, companyID string) (*models.Lesson,
 		LEFT JOIN teachers t ON l.teacher_id = t.id
 		LEFT JOIN groups g ON l.group_id = g.id
 		LEFT JOIN rooms rm ON l.room_id = rm.id
-		WHERE l.id = $1 AND l.company_id = $2
+		WHERE l.id = $1 AND l.company_id = $2 AND l.deleted_at IS NULL
 	`
 
-	err := r.db.QueryRow(query, id, companyID).Scan(&lesson.ID, &lesson.Title, &teacherID, &groupID,
+	err := database.Tenant(r.db, companyID).QueryRow(query, id, companyID).Scan(&lesson.ID, &lesson.Title, &teacherID, &groupID,
 		&lesson.Subject, &lesson.Start, &lesson.End, &room, &roomID, &status, &lesson.CompanyID,
 		&teacherName, &groupName, &roomName)
 	if err == sql.ErrNoRows {
@@ -235,7 +236,7 @@ func (r *LessonRepository) GetByID(id string, companyID string) (*models.Lesson,
 	lesson.StudentIds = []string{}
 
 	// Get students
-	studentRows, err := r.db.Query(`SELECT student_id FROM lesson_students WHERE lesson_id = $1`, lesson.ID)
+	studentRows, err := database.Tenant(r.db, companyID).Query(`SELECT student_id FROM lesson_students WHERE lesson_id = $1`, lesson.ID)
 	if err == nil {
 		defer studentRows.Close()
 		for studentRows.Next() {
@@ -250,7 +251,7 @@ func (r *LessonRepository) GetByID(id string, companyID string) (*models.Lesson,
 }
 
 func (r *LessonRepository) Update(lesson *models.Lesson, companyID string) error {
-	tx, err := r.db.Begin()
+	tx, err := database.Tenant(r.db, companyID).Begin()
 	if err != nil {
 		return fmt.Errorf("error starting transaction: %w", err)
 	}
@@ -276,7 +277,7 @@ func (r *LessonRepository) Update(lesson *models.Lesson, companyID string) error
 		UPDATE lessons 
 		SET title = $2, teacher_id = $3, group_id = $4, subject = $5, 
 		    start_time = $6, end_time = $7, room = $8, room_id = $9, status = $10
-		WHERE id = $1 AND company_id = $11
+		WHERE id = $1 AND company_id = $11 AND deleted_at IS NULL
 	`
 	_, err = tx.Exec(query, lesson.ID, lesson.Title, lesson.TeacherID, groupID,
 		lesson.Subject, lesson.Start, lesson.End, lesson.Room, roomID, lesson.Status, companyID)
@@ -301,10 +302,17 @@ func (r *LessonRepository) Update(lesson *models.Lesson, companyID string) error
 	return tx.Commit()
 }
 
-func (r *LessonRepository) Delete(id string, companyID string) error {
-	query := `DELETE FROM lessons WHERE id = $1 AND company_id = $2`
+// Delete moves a lesson to the trash; its attendance stays in place
+func (r *LessonRepository) Delete(id string, actor database.Actor) error {
+	query := `
+		UPDATE lessons SET deleted_at = NOW(), deleted_by = NULLIF($3, 0)
+		WHERE id = $1 AND company_id = $2 AND deleted_at IS NULL
+	`
 
-	_, err := r.db.Exec(query, id, companyID)
+	err := database.WithActor(r.db, actor, func(tx *sql.Tx) error {
+		_, err := tx.Exec(query, id, actor.CompanyID, actor.UserID)
+		return err
+	})
 	if err != nil {
 		return fmt.Errorf("error deleting lesson: %w", err)
 	}
@@ -312,11 +320,17 @@ func (r *LessonRepository) Delete(id string, companyID string) error {
 	return nil
 }
 
-// DeleteByGroupID deletes all lessons associated with a group
-func (r *LessonRepository) DeleteByGroupID(groupID string, companyID string) error {
-	query := `DELETE FROM lessons WHERE group_id = $1 AND company_id = $2`
+// DeleteByGroupID moves all lessons associated with a group to the trash
+func (r *LessonRepository) DeleteByGroupID(groupID string, actor database.Actor) error {
+	query := `
+		UPDATE lessons SET deleted_at = NOW(), deleted_by = NULLIF($3, 0)
+		WHERE group_id = $1 AND company_id = $2 AND deleted_at IS NULL
+	`
 
-	_, err := r.db.Exec(query, groupID, companyID)
+	err := database.WithActor(r.db, actor, func(tx *sql.Tx) error {
+		_, err := tx.Exec(query, groupID, actor.CompanyID, actor.UserID)
+		return err
+	})
 	if err != nil {
 		return fmt.Errorf("error deleting lessons for group: %w", err)
 	}
@@ -335,11 +349,11 @@ func (r *LessonRepository) GetIndividualLessons(companyID string) ([]*models.Les
 		FROM lessons l
 		LEFT JOIN teachers t ON l.teacher_id = t.id
 		LEFT JOIN rooms rm ON l.room_id = rm.id
-		WHERE l.company_id = $1 AND (l.group_id IS NULL OR l.group_id = '')
+		WHERE l.company_id = $1 AND (l.group_id IS NULL OR l.group_id = '') AND l.deleted_at IS NULL
 		ORDER BY l.start_time DESC
 	`
 
-	rows, err := r.db.Query(query, companyID)
+	rows, err := database.Tenant(r.db, companyID).Query(query, companyID)
 	if err != nil {
 		return nil, fmt.Errorf("error getting individual lessons: %w", err)
 	}
@@ -383,7 +397,7 @@ func (r *LessonRepository) GetIndividualLessons(companyID string) ([]*models.Les
 
 		// Get students for this lesson
 		studentQuery := `SELECT student_id FROM lesson_students WHERE lesson_id = $1 AND company_id = $2`
-		studentRows, err := r.db.Query(studentQuery, lesson.ID, companyID)
+		studentRows, err := database.Tenant(r.db, companyID).Query(studentQuery, lesson.ID, companyID)
 		if err != nil {
 			return nil, fmt.Errorf("error getting students for lesson: %w", err)
 		}
@@ -437,12 +451,13 @@ func (r *LessonRepository) CheckConflicts(teacherID, roomID string, start, end t
 			AND l.company_id = $2
 			AND l.id != $3
 			AND l.status != 'cancelled'
+			AND l.deleted_at IS NULL
 			AND l.start_time < $5 
 			AND l.end_time > $4
 			AND DATE_TRUNC('minute', l.end_time) <> DATE_TRUNC('minute', $4)
 			AND DATE_TRUNC('minute', l.start_time) <> DATE_TRUNC('minute', $5)
 		`
-		rows, err := r.db.Query(query, teacherID, companyID, excludeLessonID, start, end)
+		rows, err := database.Tenant(r.db, companyID).Query(query, teacherID, companyID, excludeLessonID, start, end)
 		if err != nil {
 			return nil, fmt.Errorf("error checking teacher conflicts: %w", err)
 		}
@@ -476,12 +491,13 @@ func (r *LessonRepository) CheckConflicts(teacherID, roomID string, start, end t
 			AND l.company_id = $2
 			AND l.id != $3
 			AND l.status != 'cancelled'
+			AND l.deleted_at IS NULL
 			AND l.start_time < $5 
 			AND l.end_time > $4
 			AND DATE_TRUNC('minute', l.end_time) <> DATE_TRUNC('minute', $4)
 			AND DATE_TRUNC('minute', l.start_time) <> DATE_TRUNC('minute', $5)
 		`
-		rows, err := r.db.Query(query, roomID, companyID, excludeLessonID, start, end)
+		rows, err := database.Tenant(r.db, companyID).Query(query, roomID, companyID, excludeLessonID, start, end)
 		if err != nil {
 			return nil, fmt.Errorf("error checking room conflicts: %w", err)
 		}
@@ -510,11 +526,11 @@ func (r *LessonRepository) GetByTeacherID(teacherID string, startDate, endDate t
 	query := `
 		SELECT id, title, teacher_id, group_id, subject, start_time, end_time, room, room_id, status 
 		FROM lessons 
-		WHERE teacher_id = $1 AND company_id = $2 AND start_time >= $3 AND start_time <= $4
+		WHERE teacher_id = $1 AND company_id = $2 AND start_time >= $3 AND start_time <= $4 AND deleted_at IS NULL
 		ORDER BY start_time
 	`
 
-	rows, err := r.db.Query(query, teacherID, companyID, startDate, endDate)
+	rows, err := database.Tenant(r.db, companyID).Query(query, teacherID, companyID, startDate, endDate)
 	if err != nil {
 		return nil, fmt.Errorf("error getting lessons by teacher: %w", err)
 	}
@@ -552,7 +568,7 @@ func (r *LessonRepository) GetByTeacherID(teacherID string, startDate, endDate t
 		lesson.StudentIds = []string{}
 
 		// Get students
-		studentRows, err := r.db.Query(`SELECT student_id FROM lesson_students WHERE lesson_id = $1`, lesson.ID)
+		studentRows, err := database.Tenant(r.db, companyID).Query(`SELECT student_id FROM lesson_students WHERE lesson_id = $1`, lesson.ID)
 		if err == nil {
 			defer studentRows.Close()
 			for studentRows.Next() {
@@ -571,7 +587,7 @@ func (r *LessonRepository) GetByTeacherID(teacherID string, startDate, endDate t
 
 // CreateBulk creates multiple lessons in a single transaction
 func (r *LessonRepository) CreateBulk(lessons []*models.Lesson, companyID, branchID string) error {
-	tx, err := r.db.Begin()
+	tx, err := database.Tenant(r.db, companyID).Begin()
 	if err != nil {
 		return fmt.Errorf("error starting transaction: %w", err)
 	}
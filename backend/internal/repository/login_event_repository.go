@@ -0,0 +1,104 @@
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"classmate-central/internal/database"
+	"classmate-central/internal/models"
+)
+
+type LoginEventRepository struct {
+	db *sql.DB
+}
+
+func NewLoginEventRepository(db *sql.DB) *LoginEventRepository {
+	return &LoginEventRepository{db: db}
+}
+
+// Create appends a login attempt to the audit trail
+func (r *LoginEventRepository) Create(event *models.LoginEvent) error {
+	err := database.System(r.db).QueryRow(`
+		INSERT INTO login_events (user_id, company_id, email, success, failure_reason, ip, user_agent, device, country, new_device, new_country)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+		RETURNING id, created_at`,
+		event.UserID, event.CompanyID, event.Email, event.Success, event.FailureReason, event.IP, event.UserAgent,
+		event.Device, event.Country, event.NewDevice, event.NewCountry,
+	).Scan(&event.ID, &event.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("error creating login event: %w", err)
+	}
+	return nil
+}
+
+// LoginHistory summarises the successful logins of a user so far
+type LoginHistory struct {
+	HasLogins    bool // At least one successful login was recorded
+	KnownDevice  bool // The device was seen in a successful login
+	KnownCountry bool // The country was seen in a successful login
+}
+
+// GetHistory reports whether a user has logged in before, and from the device and country
+func (r *LoginEventRepository) GetHistory(userID int, device, country string) (*LoginHistory, error) {
+	history := &LoginHistory{}
+	err := database.System(r.db).QueryRow(`
+		SELECT COUNT(*) > 0,
+		       COALESCE(bool_or(device = $2), FALSE),
+		       COALESCE(bool_or(country = $3), FALSE)
+		FROM login_events
+		WHERE user_id = $1 AND success`, userID, device, country).
+		Scan(&history.HasLogins, &history.KnownDevice, &history.KnownCountry)
+	if err != nil {
+		return nil, fmt.Errorf("error loading login history: %w", err)
+	}
+	return history, nil
+}
+
+// ListByUser returns the latest login attempts of a user of the company, newest first
+func (r *LoginEventRepository) ListByUser(userID int, companyID string, limit int) ([]*models.LoginEvent, error) {
+	rows, err := database.Tenant(r.db, companyID).Query(`
+		SELECT id, user_id, company_id, email, success, failure_reason, ip, user_agent, device, country,
+		       new_device, new_country, created_at
+		FROM login_events
+		WHERE user_id = $1 AND company_id = $2
+		ORDER BY created_at DESC
+		LIMIT $3`, userID, companyID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("error listing login events: %w", err)
+	}
+	defer rows.Close()
+
+	events := []*models.LoginEvent{}
+	for rows.Next() {
+		event := &models.LoginEvent{}
+		var eventUserID sql.NullInt64
+		var eventCompanyID, reason sql.NullString
+		err := rows.Scan(&event.ID, &eventUserID, &eventCompanyID, &event.Email, &event.Success, &reason, &event.IP,
+			&event.UserAgent, &event.Device, &event.Country, &event.NewDevice, &event.NewCountry, &event.CreatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning login event: %w", err)
+		}
+		if eventUserID.Valid {
+			id := int(eventUserID.Int64)
+			event.UserID = &id
+		}
+		event.CompanyID = nullStringPtr(eventCompanyID)
+		event.FailureReason = nullStringPtr(reason)
+		events = append(events, event)
+	}
+	return events, rows.Err()
+}
+
+// DeleteOlderThan removes login events recorded before the given time
+func (r *LoginEventRepository) DeleteOlderThan(before time.Time) (int64, error) {
+	result, err := database.System(r.db).Exec(`DELETE FROM login_events WHERE created_at < $1`, before)
+	if err != nil {
+		return 0, fmt.Errorf("error deleting old login events: %w", err)
+	}
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("error checking delete result: %w", err)
+	}
+	return deleted, nil
+}
@@ -4,6 +4,7 @@ import (
 	"database/sql"
 	"fmt"
 
+	"classmate-central/internal/database"
 	"classmate-central/internal/models"
 )
 
@@ -15,14 +16,15 @@ func NewNotificationRepository(db *sql.DB) *NotificationRepository {
 	return &NotificationRepository{db: db}
 }
 
-// CreateNotification creates a new notification
+// CreateNotification creates a new notification. Its company is taken from the student by the
+// insert trigger of migration 043, so background jobs can notify students of any company.
 func (r *NotificationRepository) CreateNotification(notification *models.Notification) error {
 	query := `
 		INSERT INTO notifications (student_id, type, message, is_read, created_at)
 		VALUES ($1, $2, $3, $4, CURRENT_TIMESTAMP)
 		RETURNING id, created_at
 	`
-	err := r.db.QueryRow(
+	err := database.System(r.db).QueryRow(
 		query,
 		notification.StudentID,
 		notification.Type,
@@ -37,16 +39,16 @@ func (r *NotificationRepository) CreateNotification(notification *models.Notific
 	return nil
 }
 
-// GetStudentNotifications retrieves all notifications for a student
-func (r *NotificationRepository) GetStudentNotifications(studentID string) ([]*models.Notification, error) {
+// GetStudentNotifications retrieves all notifications for a company's student
+func (r *NotificationRepository) GetStudentNotifications(studentID, companyID string) ([]*models.Notification, error) {
 	query := `
 		SELECT id, student_id, type, message, is_read, created_at
 		FROM notifications
-		WHERE student_id = $1
+		WHERE student_id = $1 AND company_id = $2
 		ORDER BY created_at DESC
 	`
 
-	rows, err := r.db.Query(query, studentID)
+	rows, err := database.Tenant(r.db, companyID).Query(query, studentID, companyID)
 	if err != nil {
 		return nil, fmt.Errorf("error getting notifications: %w", err)
 	}
@@ -72,21 +74,29 @@ func (r *NotificationRepository) GetStudentNotifications(studentID string) ([]*m
 	return notifications, nil
 }
 
-// MarkAsRead marks a notification as read
-func (r *NotificationRepository) MarkAsRead(notificationID int) error {
-	query := `UPDATE notifications SET is_read = true WHERE id = $1`
-	_, err := r.db.Exec(query, notificationID)
-	if err != nil {
-		return fmt.Errorf("error marking notification as read: %w", err)
-	}
-	return nil
+// MarkAsRead marks a notification of the company as read; sql.ErrNoRows if there is none
+func (r *NotificationRepository) MarkAsRead(notificationID int, companyID string) error {
+	return database.WithTenant(r.db, companyID, func(tx *sql.Tx) error {
+		result, err := tx.Exec(`UPDATE notifications SET is_read = true WHERE id = $1 AND company_id = $2`, notificationID, companyID)
+		if err != nil {
+			return fmt.Errorf("error marking notification as read: %w", err)
+		}
+		affected, err := result.RowsAffected()
+		if err != nil {
+			return fmt.Errorf("error checking update result: %w", err)
+		}
+		if affected == 0 {
+			return sql.ErrNoRows
+		}
+		return nil
+	})
 }
 
-// GetUnreadCount returns the count of unread notifications for a student
-func (r *NotificationRepository) GetUnreadCount(studentID string) (int, error) {
-	query := `SELECT COUNT(*) FROM notifications WHERE student_id = $1 AND is_read = false`
+// GetUnreadCount returns the count of unread notifications for a company's student
+func (r *NotificationRepository) GetUnreadCount(studentID, companyID string) (int, error) {
+	query := `SELECT COUNT(*) FROM notifications WHERE student_id = $1 AND company_id = $2 AND is_read = false`
 	var count int
-	err := r.db.QueryRow(query, studentID).Scan(&count)
+	err := database.Tenant(r.db, companyID).QueryRow(query, studentID, companyID).Scan(&count)
 	if err != nil {
 		return 0, fmt.Errorf("error getting unread count: %w", err)
 	}
@@ -102,7 +112,7 @@ func (r *NotificationRepository) CheckExistingNotification(studentID, notificati
 		)
 	`
 	var exists bool
-	err := r.db.QueryRow(query, studentID, notificationType).Scan(&exists)
+	err := database.System(r.db).QueryRow(query, studentID, notificationType).Scan(&exists)
 	if err != nil {
 		return false, fmt.Errorf("error checking existing notification: %w", err)
 	}
@@ -0,0 +1,426 @@
+package repository
+
+import (
+	"classmate-central/internal/database"
+	"classmate-central/internal/models"
+	"classmate-central/internal/money"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ErrRefundExceedsPayment is returned when refunding more than is left of a confirmed online payment
+var ErrRefundExceedsPayment = errors.New("refund exceeds the paid amount")
+
+// ErrIntentNotConfirmed is returned when refunding an online payment that was not confirmed
+var ErrIntentNotConfirmed = errors.New("payment intent is not confirmed")
+
+// ErrProviderMismatch is returned when a provider confirms an intent created at another provider
+var ErrProviderMismatch = errors.New("payment intent belongs to another provider")
+
+// ErrIntentNotInReview is returned when accepting an online payment that is not held for review
+var ErrIntentNotInReview = errors.New("payment intent is not held for review")
+
+type PaymentIntentRepository struct {
+	db *sql.DB
+}
+
+func NewPaymentIntentRepository(db *sql.DB) *PaymentIntentRepository {
+	return &PaymentIntentRepository{db: db}
+}
+
+const paymentIntentColumns = `id, student_id, invoice_id, amount, currency, description, provider, provider_payment_id, payment_url,
+	status, paid_amount, transaction_id, refunded_amount, created_by, created_at, updated_at, confirmed_at, company_id, COALESCE(branch_id, '')`
+
+func scanPaymentIntent(row interface{ Scan(...interface{}) error }) (*models.PaymentIntent, error) {
+	var intent models.PaymentIntent
+	var invoiceID, transactionID, createdBy sql.NullInt64
+	var providerPaymentID, paymentURL sql.NullString
+	err := row.Scan(&intent.ID, &intent.StudentID, &invoiceID, &intent.Amount, &intent.Currency, &intent.Description, &intent.Provider,
+		&providerPaymentID, &paymentURL, &intent.Status, &intent.PaidAmount, &transactionID, &intent.RefundedAmount, &createdBy,
+		&intent.CreatedAt, &intent.UpdatedAt, &intent.ConfirmedAt, &intent.CompanyID, &intent.BranchID)
+	if err != nil {
+		return nil, err
+	}
+	if invoiceID.Valid {
+		intent.InvoiceID = &invoiceID.Int64
+	}
+	if transactionID.Valid {
+		id := int(transactionID.Int64)
+		intent.TransactionID = &id
+	}
+	if createdBy.Valid {
+		id := int(createdBy.Int64)
+		intent.CreatedBy = &id
+	}
+	if providerPaymentID.Valid {
+		intent.ProviderPaymentID = &providerPaymentID.String
+	}
+	if paymentURL.Valid {
+		intent.PaymentURL = &paymentURL.String
+	}
+	intent.ApplyCurrency()
+	return &intent, nil
+}
+
+func scanPaymentIntents(rows *sql.Rows) ([]models.PaymentIntent, error) {
+	intents := []models.PaymentIntent{}
+	for rows.Next() {
+		intent, err := scanPaymentIntent(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning payment intent: %w", err)
+		}
+		intents = append(intents, *intent)
+	}
+	return intents, rows.Err()
+}
+
+// Create stores a pending intent for a student of the company. The currency is the one of the
+// student's balance (or branch) since confirmed payments are booked to the balance.
+// Returns sql.ErrNoRows if the student does not exist.
+func (r *PaymentIntentRepository) Create(intent *models.PaymentIntent, companyID string) error {
+	query := `
+		INSERT INTO payment_intents (id, student_id, invoice_id, amount, currency, description, provider, created_by, company_id, branch_id)
+		SELECT $1, s.id, $3, $4,
+		       COALESCE((SELECT currency FROM student_balance WHERE student_id = s.id), effective_currency(s.company_id, s.branch_id)),
+		       $5, $6, $7, s.company_id, s.branch_id
+		FROM students s
+		WHERE s.id = $2 AND s.company_id = $8 AND s.deleted_at IS NULL
+		RETURNING status, currency, COALESCE(branch_id, ''), created_at, updated_at`
+	err := database.Tenant(r.db, companyID).QueryRow(query, intent.ID, intent.StudentID, intent.InvoiceID, intent.Amount, intent.Description, intent.Provider,
+		intent.CreatedBy, companyID).Scan(&intent.Status, &intent.Currency, &intent.BranchID, &intent.CreatedAt, &intent.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return sql.ErrNoRows
+	}
+	if err != nil {
+		return fmt.Errorf("error creating payment intent: %w", err)
+	}
+	intent.CompanyID = companyID
+	intent.ApplyCurrency()
+	return nil
+}
+
+// SetProviderPayment stores the provider's payment ID and link of a company's intent
+func (r *PaymentIntentRepository) SetProviderPayment(id, providerPaymentID, paymentURL, companyID string) error {
+	_, err := database.Tenant(r.db, companyID).Exec(`
+		UPDATE payment_intents
+		SET provider_payment_id = NULLIF($2, ''), payment_url = NULLIF($3, ''), updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND company_id = $4`, id, providerPaymentID, paymentURL, companyID)
+	if err != nil {
+		return fmt.Errorf("error updating payment intent: %w", err)
+	}
+	return nil
+}
+
+func (r *PaymentIntentRepository) GetByID(id, companyID string) (*models.PaymentIntent, error) {
+	intent, err := scanPaymentIntent(database.Tenant(r.db, companyID).QueryRow(`SELECT `+paymentIntentColumns+` FROM payment_intents WHERE id = $1 AND company_id = $2`, id, companyID))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error getting payment intent: %w", err)
+	}
+	return intent, nil
+}
+
+// GetByReference returns the intent a provider webhook refers to (no company context)
+func (r *PaymentIntentRepository) GetByReference(id string) (*models.PaymentIntent, error) {
+	intent, err := scanPaymentIntent(database.System(r.db).QueryRow(`SELECT `+paymentIntentColumns+` FROM payment_intents WHERE id = $1`, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error getting payment intent: %w", err)
+	}
+	return intent, nil
+}
+
+// List returns intents of the company, optionally filtered by status, student and branches
+func (r *PaymentIntentRepository) List(status, studentID, companyID string, branchIDs []string) ([]models.PaymentIntent, error) {
+	query := `SELECT ` + paymentIntentColumns + ` FROM payment_intents WHERE company_id = $1`
+	args := []interface{}{companyID}
+	if status != "" {
+		args = append(args, status)
+		query += fmt.Sprintf(" AND status = $%d", len(args))
+	}
+	if studentID != "" {
+		args = append(args, studentID)
+		query += fmt.Sprintf(" AND student_id = $%d", len(args))
+	}
+	if len(branchIDs) > 0 {
+		placeholders := make([]string, len(branchIDs))
+		for i, id := range branchIDs {
+			args = append(args, id)
+			placeholders[i] = fmt.Sprintf("$%d", len(args))
+		}
+		query += " AND branch_id IN (" + strings.Join(placeholders, ", ") + ")"
+	}
+	query += " ORDER BY created_at DESC"
+
+	rows, err := database.Tenant(r.db, companyID).Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error listing payment intents: %w", err)
+	}
+	defer rows.Close()
+	return scanPaymentIntents(rows)
+}
+
+// GetStalePending returns pending intents of all companies created before the given time
+func (r *PaymentIntentRepository) GetStalePending(before time.Time) ([]models.PaymentIntent, error) {
+	rows, err := database.System(r.db).Query(`SELECT `+paymentIntentColumns+` FROM payment_intents
+		WHERE status = 'pending' AND created_at < $1 ORDER BY created_at`, before)
+	if err != nil {
+		return nil, fmt.Errorf("error getting pending payment intents: %w", err)
+	}
+	defer rows.Close()
+	return scanPaymentIntents(rows)
+}
+
+// Confirm books a successful online payment: it creates the payment transaction (updating the balance
+// and settling debts), pays the linked invoice and marks the intent succeeded, all at once.
+// Confirming an intent twice is a no-op: the second call returns the intent with applied = false.
+// A paid amount different from the intent is not booked: the intent is held in review with the
+// paid amount (applied = false) until AcceptReview.
+// Returns ErrProviderMismatch if the intent was created at another provider.
+func (r *PaymentIntentRepository) Confirm(id, provider, providerPaymentID string, paid money.Money) (*models.PaymentIntent, bool, error) {
+	dbTx, err := database.System(r.db).Begin()
+	if err != nil {
+		return nil, false, fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer dbTx.Rollback()
+
+	intent, err := scanPaymentIntent(dbTx.QueryRow(`SELECT `+paymentIntentColumns+` FROM payment_intents WHERE id = $1 FOR UPDATE`, id))
+	if err == sql.ErrNoRows {
+		return nil, false, sql.ErrNoRows
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("error fetching payment intent: %w", err)
+	}
+	if intent.Provider != provider {
+		return nil, false, ErrProviderMismatch
+	}
+	if intent.Status == "succeeded" || intent.Status == "refunded" || intent.Status == "review" {
+		return intent, false, nil
+	}
+	if paid.Currency() != intent.Currency {
+		return nil, false, ErrCurrencyMismatch
+	}
+
+	if paid.Cmp(intent.Amount) != 0 {
+		err = dbTx.QueryRow(`
+			UPDATE payment_intents
+			SET status = 'review', paid_amount = $2, provider_payment_id = COALESCE(NULLIF($3, ''), provider_payment_id),
+			    updated_at = CURRENT_TIMESTAMP
+			WHERE id = $1
+			RETURNING status, provider_payment_id, updated_at`,
+			id, paid, providerPaymentID).Scan(&intent.Status, &intent.ProviderPaymentID, &intent.UpdatedAt)
+		if err != nil {
+			return nil, false, fmt.Errorf("error holding payment intent for review: %w", err)
+		}
+		if err = dbTx.Commit(); err != nil {
+			return nil, false, fmt.Errorf("error committing transaction: %w", err)
+		}
+		intent.PaidAmount = &paid
+		return intent, false, nil
+	}
+
+	if err = bookIntentPayment(dbTx, intent, paid, providerPaymentID); err != nil {
+		return nil, false, err
+	}
+	if err = dbTx.Commit(); err != nil {
+		return nil, false, fmt.Errorf("error committing transaction: %w", err)
+	}
+	return intent, true, nil
+}
+
+// AcceptReview books an online payment held in review for its paid amount, like Confirm does.
+// Returns sql.ErrNoRows if the intent does not exist and ErrIntentNotInReview if it is not held.
+func (r *PaymentIntentRepository) AcceptReview(id, companyID string) (*models.PaymentIntent, error) {
+	dbTx, err := database.Tenant(r.db, companyID).Begin()
+	if err != nil {
+		return nil, fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer dbTx.Rollback()
+
+	intent, err := scanPaymentIntent(dbTx.QueryRow(`SELECT `+paymentIntentColumns+` FROM payment_intents WHERE id = $1 AND company_id = $2 FOR UPDATE`, id, companyID))
+	if err == sql.ErrNoRows {
+		return nil, sql.ErrNoRows
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error fetching payment intent: %w", err)
+	}
+	if intent.Status != "review" || intent.PaidAmount == nil {
+		return nil, ErrIntentNotInReview
+	}
+
+	if err = bookIntentPayment(dbTx, intent, *intent.PaidAmount, ""); err != nil {
+		return nil, err
+	}
+	if err = dbTx.Commit(); err != nil {
+		return nil, fmt.Errorf("error committing transaction: %w", err)
+	}
+	return intent, nil
+}
+
+// bookIntentPayment creates the payment transaction of a locked intent, pays its invoice and marks it succeeded
+func bookIntentPayment(dbTx *sql.Tx, intent *models.PaymentIntent, paid money.Money, providerPaymentID string) error {
+	description := intent.Description
+	if description == "" {
+		description = "Онлайн-оплата"
+	}
+	tx := &models.PaymentTransaction{
+		StudentID:     intent.StudentID,
+		Amount:        paid,
+		Type:          "payment",
+		PaymentMethod: "card",
+		Description:   description,
+		CreatedBy:     intent.CreatedBy,
+		BranchID:      intent.BranchID,
+		Currency:      intent.Currency,
+	}
+	if err := createTransactionWithBalance(dbTx, tx, intent.CompanyID); err != nil {
+		return err
+	}
+
+	if intent.InvoiceID != nil {
+		if err := payInvoice(dbTx, *intent.InvoiceID, tx, intent.CompanyID); err != nil {
+			return err
+		}
+	}
+
+	err := dbTx.QueryRow(`
+		UPDATE payment_intents
+		SET status = 'succeeded', transaction_id = $2, provider_payment_id = COALESCE(NULLIF($3, ''), provider_payment_id),
+		    confirmed_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1
+		RETURNING status, provider_payment_id, confirmed_at, updated_at`,
+		intent.ID, tx.ID, providerPaymentID).Scan(&intent.Status, &intent.ProviderPaymentID, &intent.ConfirmedAt, &intent.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("error confirming payment intent: %w", err)
+	}
+	intent.TransactionID = &tx.ID
+	return nil
+}
+
+// payInvoice links the payment to the invoice and marks the invoice paid or partially paid
+func payInvoice(dbTx *sql.Tx, invoiceID int64, tx *models.PaymentTransaction, companyID string) error {
+	_, err := dbTx.Exec(`
+		INSERT INTO transaction (payment_id, invoice_id, amount, kind, company_id, currency)
+		VALUES ($1, $2, $3, 'pay_invoice', $4, $5)`,
+		tx.ID, invoiceID, tx.Amount, companyID, tx.Currency)
+	if err != nil {
+		return fmt.Errorf("error linking payment to invoice: %w", err)
+	}
+
+	_, err = dbTx.Exec(`
+		UPDATE invoice i
+		SET status = CASE WHEN paid.amount >= total.amount THEN 'paid' ELSE 'partially' END,
+		    updated_at = CURRENT_TIMESTAMP
+		FROM (SELECT COALESCE(SUM(quantity * unit_price), 0) AS amount FROM invoice_item WHERE invoice_id = $1) total,
+		     (SELECT COALESCE(SUM(amount), 0) AS amount FROM transaction WHERE invoice_id = $1 AND kind = 'pay_invoice') paid
+		WHERE i.id = $1 AND i.company_id = $2 AND i.status IN ('unpaid', 'partially')`,
+		invoiceID, companyID)
+	if err != nil {
+		return fmt.Errorf("error updating invoice status: %w", err)
+	}
+	return nil
+}
+
+// MarkFailed marks a pending intent of the provider as failed (declined or abandoned at the provider)
+func (r *PaymentIntentRepository) MarkFailed(id, provider string) error {
+	_, err := database.System(r.db).Exec(`UPDATE payment_intents SET status = 'failed', updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND provider = $2 AND status = 'pending'`, id, provider)
+	if err != nil {
+		return fmt.Errorf("error updating payment intent: %w", err)
+	}
+	return nil
+}
+
+// Cancel cancels a pending intent. Returns sql.ErrNoRows if there is no pending intent with the ID.
+func (r *PaymentIntentRepository) Cancel(id, companyID string) error {
+	result, err := database.Tenant(r.db, companyID).Exec(`UPDATE payment_intents SET status = 'cancelled', updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND company_id = $2 AND status = 'pending'`, id, companyID)
+	if err != nil {
+		return fmt.Errorf("error cancelling payment intent: %w", err)
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error checking cancel result: %w", err)
+	}
+	if rows == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// CheckRefundable validates that the amount can still be refunded from the intent
+func CheckRefundable(intent *models.PaymentIntent, amount money.Money) error {
+	if intent.Status != "succeeded" {
+		return ErrIntentNotConfirmed
+	}
+	if amount.GreaterThan(intent.Refundable()) {
+		return ErrRefundExceedsPayment
+	}
+	return nil
+}
+
+// RecordRefund books a refund made at the provider as a refund transaction and adds it to the intent.
+// The intent becomes refunded once the whole amount is returned.
+func (r *PaymentIntentRepository) RecordRefund(id string, amount money.Money, createdBy *int, companyID string) (*models.PaymentIntent, error) {
+	dbTx, err := database.Tenant(r.db, companyID).Begin()
+	if err != nil {
+		return nil, fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer dbTx.Rollback()
+
+	intent, err := scanPaymentIntent(dbTx.QueryRow(`SELECT `+paymentIntentColumns+` FROM payment_intents WHERE id = $1 AND company_id = $2 FOR UPDATE`, id, companyID))
+	if err == sql.ErrNoRows {
+		return nil, sql.ErrNoRows
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error fetching payment intent: %w", err)
+	}
+	if err = CheckRefundable(intent, amount); err != nil {
+		return nil, err
+	}
+
+	tx := &models.PaymentTransaction{
+		StudentID:     intent.StudentID,
+		Amount:        amount,
+		Type:          "refund",
+		PaymentMethod: "card",
+		Description:   "Возврат онлайн-оплаты",
+		CreatedBy:     createdBy,
+		BranchID:      intent.BranchID,
+		Currency:      intent.Currency,
+	}
+	if err = createTransactionWithBalance(dbTx, tx, companyID); err != nil {
+		return nil, err
+	}
+	if _, err = dbTx.Exec(`
+		INSERT INTO transaction (payment_id, invoice_id, amount, kind, company_id, currency)
+		VALUES ($1, $2, $3, 'refund', $4, $5)`,
+		tx.ID, intent.InvoiceID, amount, companyID, tx.Currency); err != nil {
+		return nil, fmt.Errorf("error recording refund: %w", err)
+	}
+
+	err = dbTx.QueryRow(`
+		UPDATE payment_intents
+		SET refunded_amount = refunded_amount + $2,
+		    status = CASE WHEN refunded_amount + $2 >= COALESCE(paid_amount, amount) THEN 'refunded' ELSE status END,
+		    updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1
+		RETURNING refunded_amount, status, updated_at`,
+		id, amount).Scan(&intent.RefundedAmount, &intent.Status, &intent.UpdatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("error updating payment intent: %w", err)
+	}
+
+	if err = dbTx.Commit(); err != nil {
+		return nil, fmt.Errorf("error committing transaction: %w", err)
+	}
+	intent.ApplyCurrency()
+	return intent, nil
+}
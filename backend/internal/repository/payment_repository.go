@@ -1,11 +1,17 @@
 package repository
 
 import (
+	"classmate-central/internal/database"
 	"classmate-central/internal/models"
+	"classmate-central/internal/money"
 	"database/sql"
+	"errors"
 	"fmt"
 )
 
+// ErrCurrencyMismatch is returned when a transaction is not in the currency of the student's balance
+var ErrCurrencyMismatch = errors.New("transaction currency does not match the student's balance currency")
+
 type PaymentRepository struct {
 	db *sql.DB
 }
@@ -18,15 +24,18 @@ func NewPaymentRepository(db *sql.DB) *PaymentRepository {
 
 func (r *PaymentRepository) CreateTransaction(tx *models.PaymentTransaction, companyID string) error {
 	query := `INSERT INTO payment_transactions (student_id, amount, type, payment_method, description, created_by, company_id) 
-	          VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id, created_at`
-	return r.db.QueryRow(query, tx.StudentID, tx.Amount, tx.Type, tx.PaymentMethod, tx.Description, tx.CreatedBy, companyID).
-		Scan(&tx.ID, &tx.CreatedAt)
+	          VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id, created_at, currency`
+	err := database.Tenant(r.db, companyID).QueryRow(query, tx.StudentID, tx.Amount, tx.Type, tx.PaymentMethod, tx.Description, tx.CreatedBy, companyID).
+		Scan(&tx.ID, &tx.CreatedAt, &tx.Currency)
+	tx.ApplyCurrency()
+	return err
 }
 
 func (r *PaymentRepository) GetTransactionsByStudent(studentID string, companyID string) ([]models.PaymentTransaction, error) {
-	query := `SELECT id, student_id, amount, type, payment_method, description, created_at, created_by 
+	query := `SELECT id, student_id, amount, type, payment_method, description, created_at, created_by, currency,
+	                 fiscal_number, fiscal_qr, fiscal_url
 	          FROM payment_transactions WHERE student_id = $1 AND company_id = $2 ORDER BY created_at DESC`
-	rows, err := r.db.Query(query, studentID, companyID)
+	rows, err := database.Tenant(r.db, companyID).Query(query, studentID, companyID)
 	if err != nil {
 		return nil, err
 	}
@@ -35,18 +44,21 @@ func (r *PaymentRepository) GetTransactionsByStudent(studentID string, companyID
 	transactions := []models.PaymentTransaction{}
 	for rows.Next() {
 		var tx models.PaymentTransaction
-		if err := rows.Scan(&tx.ID, &tx.StudentID, &tx.Amount, &tx.Type, &tx.PaymentMethod, &tx.Description, &tx.CreatedAt, &tx.CreatedBy); err != nil {
+		if err := rows.Scan(&tx.ID, &tx.StudentID, &tx.Amount, &tx.Type, &tx.PaymentMethod, &tx.Description, &tx.CreatedAt, &tx.CreatedBy, &tx.Currency,
+			&tx.FiscalNumber, &tx.FiscalQR, &tx.FiscalURL); err != nil {
 			return nil, err
 		}
+		tx.ApplyCurrency()
 		transactions = append(transactions, tx)
 	}
 	return transactions, nil
 }
 
 func (r *PaymentRepository) GetAllTransactions(companyID string) ([]models.PaymentTransaction, error) {
-	query := `SELECT id, student_id, amount, type, payment_method, description, created_at, created_by 
+	query := `SELECT id, student_id, amount, type, payment_method, description, created_at, created_by, currency,
+	                 fiscal_number, fiscal_qr, fiscal_url
 	          FROM payment_transactions WHERE company_id = $1 ORDER BY created_at DESC`
-	rows, err := r.db.Query(query, companyID)
+	rows, err := database.Tenant(r.db, companyID).Query(query, companyID)
 	if err != nil {
 		return nil, err
 	}
@@ -55,9 +67,11 @@ func (r *PaymentRepository) GetAllTransactions(companyID string) ([]models.Payme
 	transactions := []models.PaymentTransaction{}
 	for rows.Next() {
 		var tx models.PaymentTransaction
-		if err := rows.Scan(&tx.ID, &tx.StudentID, &tx.Amount, &tx.Type, &tx.PaymentMethod, &tx.Description, &tx.CreatedAt, &tx.CreatedBy); err != nil {
+		if err := rows.Scan(&tx.ID, &tx.StudentID, &tx.Amount, &tx.Type, &tx.PaymentMethod, &tx.Description, &tx.CreatedAt, &tx.CreatedBy, &tx.Currency,
+			&tx.FiscalNumber, &tx.FiscalQR, &tx.FiscalURL); err != nil {
 			return nil, err
 		}
+		tx.ApplyCurrency()
 		transactions = append(transactions, tx)
 	}
 	return transactions, nil
@@ -65,36 +79,53 @@ func (r *PaymentRepository) GetAllTransactions(companyID string) ([]models.Payme
 
 // Student Balance
 
-func (r *PaymentRepository) GetStudentBalance(studentID string) (*models.StudentBalance, error) {
-	query := `SELECT student_id, balance, last_payment_date, version FROM student_balance WHERE student_id = $1`
-	var balance models.StudentBalance
-	err := r.db.QueryRow(query, studentID).Scan(&balance.StudentID, &balance.Balance, &balance.LastPaymentDate, &balance.Version)
+// GetStudentBalance returns the balance of a company's student, creating a zero balance if there
+// is none yet. Returns sql.ErrNoRows if the company has no such student.
+func (r *PaymentRepository) GetStudentBalance(studentID, companyID string) (*models.StudentBalance, error) {
+	balance, err := r.getStudentBalance(studentID, companyID)
 	if err == sql.ErrNoRows {
 		// If no balance record exists, create one with zero balance
-		return r.CreateStudentBalance(studentID)
+		return r.CreateStudentBalance(studentID, companyID)
 	}
+	return balance, err
+}
+
+func (r *PaymentRepository) getStudentBalance(studentID, companyID string) (*models.StudentBalance, error) {
+	query := `SELECT b.student_id, b.balance, b.last_payment_date, b.version, b.currency
+	          FROM student_balance b JOIN students s ON s.id = b.student_id
+	          WHERE b.student_id = $1 AND s.company_id = $2`
+	var balance models.StudentBalance
+	err := database.Tenant(r.db, companyID).QueryRow(query, studentID, companyID).Scan(&balance.StudentID, &balance.Balance, &balance.LastPaymentDate, &balance.Version, &balance.Currency)
 	if err != nil {
 		return nil, err
 	}
+	balance.ApplyCurrency()
 	return &balance, nil
 }
 
-func (r *PaymentRepository) CreateStudentBalance(studentID string) (*models.StudentBalance, error) {
-	query := `INSERT INTO student_balance (student_id, balance, version) VALUES ($1, 0.00, 0) 
-	          ON CONFLICT (student_id) DO NOTHING RETURNING student_id, balance, last_payment_date, version`
+// CreateStudentBalance creates a zero balance for a company's student. Returns sql.ErrNoRows if
+// the company has no such student.
+func (r *PaymentRepository) CreateStudentBalance(studentID, companyID string) (*models.StudentBalance, error) {
+	query := `INSERT INTO student_balance (student_id, balance, version)
+	          SELECT id, 0.00, 0 FROM students WHERE id = $1 AND company_id = $2
+	          ON CONFLICT (student_id) DO NOTHING RETURNING student_id, balance, last_payment_date, version, currency`
 	var balance models.StudentBalance
-	err := r.db.QueryRow(query, studentID).Scan(&balance.StudentID, &balance.Balance, &balance.LastPaymentDate, &balance.Version)
+	err := database.Tenant(r.db, companyID).QueryRow(query, studentID, companyID).Scan(&balance.StudentID, &balance.Balance, &balance.LastPaymentDate, &balance.Version, &balance.Currency)
+	if err == sql.ErrNoRows {
+		// Either a concurrent request created it or there is no such student
+		return r.getStudentBalance(studentID, companyID)
+	}
 	if err != nil {
-		// If conflict occurred, get the existing balance
-		return r.GetStudentBalance(studentID)
+		return nil, err
 	}
+	balance.ApplyCurrency()
 	return &balance, nil
 }
 
-func (r *PaymentRepository) UpdateStudentBalance(studentID string, amount float64) error {
+func (r *PaymentRepository) UpdateStudentBalance(studentID string, amount money.Money, companyID string) error {
 	query := `UPDATE student_balance SET balance = balance + $1, last_payment_date = CURRENT_TIMESTAMP 
-	          WHERE student_id = $2`
-	_, err := r.db.Exec(query, amount, studentID)
+	          WHERE student_id = $2 AND student_id IN (SELECT id FROM students WHERE company_id = $3)`
+	_, err := database.Tenant(r.db, companyID).Exec(query, amount, studentID, companyID)
 	if err != nil {
 		return err
 	}
@@ -105,23 +136,28 @@ func (r *PaymentRepository) UpdateStudentBalance(studentID string, amount float6
 
 // CreateTransactionWithBalance creates a transaction and updates balance atomically
 func (r *PaymentRepository) CreateTransactionWithBalance(tx *models.PaymentTransaction, companyID string) error {
-	dbTx, err := r.db.Begin()
+	dbTx, err := database.Tenant(r.db, companyID).Begin()
 	if err != nil {
 		return fmt.Errorf("error starting transaction: %w", err)
 	}
 	defer dbTx.Rollback()
 
-	// Create transaction record
-	query := `INSERT INTO payment_transactions (student_id, amount, type, payment_method, description, created_by, company_id) 
-	          VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id, created_at`
-	err = dbTx.QueryRow(query, tx.StudentID, tx.Amount, tx.Type, tx.PaymentMethod, tx.Description, tx.CreatedBy, companyID).
-		Scan(&tx.ID, &tx.CreatedAt)
-	if err != nil {
-		return fmt.Errorf("error creating transaction: %w", err)
+	if err = createTransactionWithBalance(dbTx, tx, companyID); err != nil {
+		return err
 	}
 
+	// Commit transaction
+	if err = dbTx.Commit(); err != nil {
+		return fmt.Errorf("error committing transaction: %w", err)
+	}
+
+	return nil
+}
+
+// createTransactionWithBalance is CreateTransactionWithBalance within the caller's database transaction
+func createTransactionWithBalance(dbTx *sql.Tx, tx *models.PaymentTransaction, companyID string) error {
 	// Ensure student balance exists
-	_, err = dbTx.Exec(`
+	_, err := dbTx.Exec(`
 		INSERT INTO student_balance (student_id, balance, version)
 		VALUES ($1, 0, 0)
 		ON CONFLICT (student_id) DO NOTHING
@@ -130,25 +166,61 @@ func (r *PaymentRepository) CreateTransactionWithBalance(tx *models.PaymentTrans
 		return fmt.Errorf("error ensuring student balance exists: %w", err)
 	}
 
-	// Update balance based on transaction type with optimistic locking
-	var balanceAdjustment float64
-	switch tx.Type {
-	case "payment":
-		balanceAdjustment = tx.Amount
-	case "refund":
-		balanceAdjustment = tx.Amount
-	case "debt":
-		balanceAdjustment = -tx.Amount // Debt reduces balance
-	default:
-		balanceAdjustment = tx.Amount
+	// Transactions are always in the currency of the student's balance
+	var balanceCurrency money.Currency
+	if err = dbTx.QueryRow(`SELECT currency FROM student_balance WHERE student_id = $1`, tx.StudentID).Scan(&balanceCurrency); err != nil {
+		return fmt.Errorf("error fetching balance currency: %w", err)
+	}
+	if tx.Currency != "" && tx.Currency != balanceCurrency {
+		return ErrCurrencyMismatch
+	}
+	tx.Currency = balanceCurrency
+	tx.ApplyCurrency()
+
+	// Cash payments and refunds must be collected within the open shift of the branch
+	tx.ShiftID = nil
+	if isCashFlow(tx) {
+		var shiftID int
+		var shiftCurrency money.Currency
+		err = dbTx.QueryRow(`SELECT id, currency FROM cash_shifts WHERE branch_id = $1 AND company_id = $2 AND status = 'open' FOR SHARE`,
+			tx.BranchID, companyID).Scan(&shiftID, &shiftCurrency)
+		if err == sql.ErrNoRows {
+			return ErrNoOpenShift
+		}
+		if err != nil {
+			return fmt.Errorf("error fetching open shift: %w", err)
+		}
+		if shiftCurrency != tx.Currency {
+			return ErrCurrencyMismatch
+		}
+		tx.ShiftID = &shiftID
+	}
+
+	// Create transaction record
+	query := `INSERT INTO payment_transactions (student_id, amount, type, payment_method, description, created_by, company_id, branch_id, shift_id, currency) 
+	          VALUES ($1, $2, $3, $4, $5, $6, $7, NULLIF($8, ''), $9, $10) RETURNING id, created_at`
+	err = dbTx.QueryRow(query, tx.StudentID, tx.Amount, tx.Type, tx.PaymentMethod, tx.Description, tx.CreatedBy, companyID, tx.BranchID, tx.ShiftID, tx.Currency).
+		Scan(&tx.ID, &tx.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("error creating transaction: %w", err)
+	}
+
+	// Cash and card payments are fiscalized: the receipt is queued with the transaction
+	if needsFiscalReceipt(tx) {
+		if err = queueFiscalReceipt(dbTx, tx.ID); err != nil {
+			return err
+		}
 	}
 
+	// Update balance based on transaction type with optimistic locking
+	balanceAdjustment := calculateBalanceAdjustment(tx.Type, tx.Amount) // Refunds and debts reduce balance
+
 	updateQuery := `UPDATE student_balance 
 	                SET balance = balance + $1, 
-	                    last_payment_date = CASE WHEN $2 > 0 THEN CURRENT_TIMESTAMP ELSE last_payment_date END,
+	                    last_payment_date = CASE WHEN $1 > 0 THEN CURRENT_TIMESTAMP ELSE last_payment_date END,
 	                    version = version + 1
-	                WHERE student_id = $3`
-	result, err := dbTx.Exec(updateQuery, balanceAdjustment, balanceAdjustment, tx.StudentID)
+	                WHERE student_id = $2`
+	result, err := dbTx.Exec(updateQuery, balanceAdjustment, tx.StudentID)
 	if err != nil {
 		return fmt.Errorf("error updating balance: %w", err)
 	}
@@ -161,40 +233,70 @@ func (r *PaymentRepository) CreateTransactionWithBalance(tx *models.PaymentTrans
 		return fmt.Errorf("balance record not found for student %s", tx.StudentID)
 	}
 
-	// Commit transaction
-	if err = dbTx.Commit(); err != nil {
-		return fmt.Errorf("error committing transaction: %w", err)
+	// Keep debts in sync: payments settle outstanding debts, refunds reopen the latest settled ones and
+	// charges beyond the balance open a new one
+	switch tx.Type {
+	case "payment":
+		if _, err = SettleDebts(dbTx, tx.StudentID, tx.Amount, &tx.ID, companyID); err != nil {
+			return err
+		}
+	case "refund":
+		if _, err = ReleaseDebtPayments(dbTx, tx.StudentID, nil, tx.Amount, companyID); err != nil {
+			return err
+		}
+	case "debt":
+		var newBalance money.Money
+		if err = dbTx.QueryRow(`SELECT balance FROM student_balance WHERE student_id = $1`, tx.StudentID).Scan(&newBalance); err != nil {
+			return fmt.Errorf("error fetching balance: %w", err)
+		}
+		if _, err = CreateNegativeBalanceDebt(dbTx, tx.StudentID, tx.Amount, newBalance, tx.Description, companyID); err != nil {
+			return err
+		}
 	}
 
 	return nil
 }
 
-func calculateBalanceAdjustment(txType string, amount float64) float64 {
+// isCashFlow reports whether the transaction moves cash through the register
+func isCashFlow(tx *models.PaymentTransaction) bool {
+	return tx.PaymentMethod == "cash" && (tx.Type == "payment" || tx.Type == "refund")
+}
+
+// calculateBalanceAdjustment returns the balance change of a transaction. Amounts are stored positive:
+// a payment brings money in, a refund pays it back out and a debt charges the student.
+func calculateBalanceAdjustment(txType string, amount money.Money) money.Money {
 	switch txType {
 	case "payment":
 		return amount
 	case "refund":
-		return amount
+		return amount.Neg()
 	case "debt":
-		return -amount
+		return amount.Neg()
 	default:
 		return amount
 	}
 }
 
 // UpdateTransactionWithBalance updates a transaction and syncs the student's balance atomically
-func (r *PaymentRepository) UpdateTransactionWithBalance(txID int, companyID string, update *models.PaymentTransactionUpdate) (*models.PaymentTransaction, error) {
-	dbTx, err := r.db.Begin()
+func (r *PaymentRepository) UpdateTransactionWithBalance(txID int, update *models.PaymentTransactionUpdate, actor database.Actor) (*models.PaymentTransaction, error) {
+	companyID := actor.CompanyID
+	dbTx, err := database.Tenant(r.db, actor.CompanyID).Begin()
 	if err != nil {
 		return nil, fmt.Errorf("error starting transaction: %w", err)
 	}
 	defer dbTx.Rollback()
+	if err := database.SetActor(dbTx, actor); err != nil {
+		return nil, err
+	}
 
 	var existing models.PaymentTransaction
-	query := `SELECT id, student_id, amount, type, payment_method, description, created_at, created_by
-	          FROM payment_transactions
-	          WHERE id = $1 AND company_id = $2
-	          FOR UPDATE`
+	var shiftStatus sql.NullString
+	query := `SELECT pt.id, pt.student_id, pt.amount, pt.type, pt.payment_method, pt.description, pt.created_at, pt.created_by,
+	                 pt.shift_id, pt.currency, cs.status
+	          FROM payment_transactions pt
+	          LEFT JOIN cash_shifts cs ON cs.id = pt.shift_id
+	          WHERE pt.id = $1 AND pt.company_id = $2
+	          FOR UPDATE OF pt`
 	err = dbTx.QueryRow(query, txID, companyID).Scan(
 		&existing.ID,
 		&existing.StudentID,
@@ -204,6 +306,9 @@ func (r *PaymentRepository) UpdateTransactionWithBalance(txID int, companyID str
 		&existing.Description,
 		&existing.CreatedAt,
 		&existing.CreatedBy,
+		&existing.ShiftID,
+		&existing.Currency,
+		&shiftStatus,
 	)
 	if err == sql.ErrNoRows {
 		return nil, sql.ErrNoRows
@@ -212,9 +317,24 @@ func (r *PaymentRepository) UpdateTransactionWithBalance(txID int, companyID str
 		return nil, fmt.Errorf("error fetching transaction: %w", err)
 	}
 
+	// Amounts and methods of cash collected in a counted shift are frozen
+	if shiftStatus.String == "closed" && (update.Amount != nil || update.PaymentMethod != nil) {
+		return nil, ErrShiftClosed
+	}
+
+	// So are those of a registered fiscal receipt (a refund corrects them instead)
+	receiptStatus, err := fiscalReceiptStatus(dbTx, txID)
+	if err != nil {
+		return nil, err
+	}
+	if receiptStatus == "registered" && (update.Amount != nil || update.PaymentMethod != nil) {
+		return nil, ErrReceiptRegistered
+	}
+
+	existing.ApplyCurrency()
 	newAmount := existing.Amount
 	if update.Amount != nil {
-		newAmount = *update.Amount
+		newAmount = update.Amount.WithCurrency(existing.Currency)
 	}
 
 	newPaymentMethod := existing.PaymentMethod
@@ -239,11 +359,19 @@ func (r *PaymentRepository) UpdateTransactionWithBalance(txID int, companyID str
 		return nil, fmt.Errorf("error updating transaction: %w", err)
 	}
 
+	if receiptStatus != "registered" {
+		edited := existing
+		edited.PaymentMethod = newPaymentMethod
+		if err = requeueFiscalReceipt(dbTx, &edited); err != nil {
+			return nil, err
+		}
+	}
+
 	oldAdjustment := calculateBalanceAdjustment(existing.Type, existing.Amount)
 	newAdjustment := calculateBalanceAdjustment(existing.Type, newAmount)
-	delta := newAdjustment - oldAdjustment
+	delta := newAdjustment.Sub(oldAdjustment)
 
-	if delta != 0 {
+	if !delta.IsZero() {
 		result, err := dbTx.Exec(
 			`UPDATE student_balance 
 			 SET balance = balance + $1, 
@@ -265,6 +393,10 @@ func (r *PaymentRepository) UpdateTransactionWithBalance(txID int, companyID str
 		}
 	}
 
+	if err = reallocateDebtPayments(dbTx, &existing, newAmount, companyID); err != nil {
+		return nil, err
+	}
+
 	if err = dbTx.Commit(); err != nil {
 		return nil, fmt.Errorf("error committing transaction: %w", err)
 	}
@@ -276,13 +408,37 @@ func (r *PaymentRepository) UpdateTransactionWithBalance(txID int, companyID str
 	return &existing, nil
 }
 
+// reallocateDebtPayments brings the debts a payment or refund settled or reopened in line with its
+// new amount: a payment is allocated again from scratch, a refund reopens or settles the difference
+func reallocateDebtPayments(dbTx *sql.Tx, existing *models.PaymentTransaction, newAmount money.Money, companyID string) error {
+	if newAmount.Cmp(existing.Amount) == 0 {
+		return nil
+	}
+	switch existing.Type {
+	case "payment":
+		if _, err := ReleaseDebtPayments(dbTx, existing.StudentID, &existing.ID, existing.Amount, companyID); err != nil {
+			return err
+		}
+		_, err := SettleDebts(dbTx, existing.StudentID, newAmount, &existing.ID, companyID)
+		return err
+	case "refund":
+		if newAmount.GreaterThan(existing.Amount) {
+			_, err := ReleaseDebtPayments(dbTx, existing.StudentID, nil, newAmount.Sub(existing.Amount), companyID)
+			return err
+		}
+		_, err := SettleDebts(dbTx, existing.StudentID, existing.Amount.Sub(newAmount), nil, companyID)
+		return err
+	}
+	return nil
+}
+
 func (r *PaymentRepository) GetAllBalances(companyID string) ([]models.StudentBalance, error) {
-	query := `SELECT sb.student_id, sb.balance, sb.last_payment_date 
+	query := `SELECT sb.student_id, sb.balance, sb.last_payment_date, sb.currency
 	          FROM student_balance sb
 	          JOIN students s ON sb.student_id = s.id
 	          WHERE s.company_id = $1
 	          ORDER BY sb.balance DESC`
-	rows, err := r.db.Query(query, companyID)
+	rows, err := database.Tenant(r.db, companyID).Query(query, companyID)
 	if err != nil {
 		return nil, err
 	}
@@ -291,9 +447,10 @@ func (r *PaymentRepository) GetAllBalances(companyID string) ([]models.StudentBa
 	balances := []models.StudentBalance{}
 	for rows.Next() {
 		var balance models.StudentBalance
-		if err := rows.Scan(&balance.StudentID, &balance.Balance, &balance.LastPaymentDate); err != nil {
+		if err := rows.Scan(&balance.StudentID, &balance.Balance, &balance.LastPaymentDate, &balance.Currency); err != nil {
 			return nil, err
 		}
+		balance.ApplyCurrency()
 		balances = append(balances, balance)
 	}
 	return balances, nil
@@ -0,0 +1,86 @@
+package repository
+
+import (
+	"testing"
+
+	"classmate-central/internal/database"
+	"classmate-central/internal/models"
+	"classmate-central/internal/money"
+	"classmate-central/internal/testutil"
+)
+
+// TestCreateTransactionWithBalance_RefundLowersBalanceAndReopensDebt walks a charge, its payment and
+// a partial and a full refund, and checks that the balance always mirrors the outstanding debt
+func TestCreateTransactionWithBalance_RefundLowersBalanceAndReopensDebt(t *testing.T) {
+	db := testutil.SetupTestDB(t)
+	defer db.Close()
+	defer testutil.CleanupTestDB(t, db)
+
+	const companyID, studentID = "refund-company", "refund-student"
+	if _, err := database.System(db).Exec(`INSERT INTO companies (id, name) VALUES ($1, $1)`, companyID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := database.System(db).Exec(`INSERT INTO students (id, name, email, company_id) VALUES ($1, $1, $1 || '@example.com', $2)`, studentID, companyID); err != nil {
+		t.Fatal(err)
+	}
+
+	payments := NewPaymentRepository(db)
+	debts := NewDebtRepository(db)
+
+	book := func(txType string, major int64) *models.PaymentTransaction {
+		t.Helper()
+		tx := &models.PaymentTransaction{
+			StudentID:     studentID,
+			Amount:        money.FromMajor(major, money.KZT),
+			Type:          txType,
+			PaymentMethod: "transfer",
+		}
+		if err := payments.CreateTransactionWithBalance(tx, companyID); err != nil {
+			t.Fatalf("%s %d: %v", txType, major, err)
+		}
+		return tx
+	}
+	expect := func(step string, balance int64, status string) {
+		t.Helper()
+		b, err := payments.GetStudentBalance(studentID, companyID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := money.FromMajor(balance, money.KZT); b.Balance.Cmp(want) != 0 {
+			t.Errorf("%s: balance = %s, want %s", step, b.Balance, want)
+		}
+
+		records, err := debts.GetByStudent(studentID, companyID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(records) != 1 {
+			t.Fatalf("%s: %d debts, want 1", step, len(records))
+		}
+		if records[0].Status != status {
+			t.Errorf("%s: debt status = %s, want %s", step, records[0].Status, status)
+		}
+		if outstanding := records[0].Remaining(); outstanding.Cmp(b.Balance.Neg()) != 0 {
+			t.Errorf("%s: outstanding debt = %s, balance = %s; they should offset", step, outstanding, b.Balance)
+		}
+	}
+
+	book("debt", 10000)
+	expect("charge", -10000, "pending")
+
+	book("payment", 10000)
+	expect("payment", 0, "paid")
+
+	book("refund", 4000)
+	expect("partial refund", -4000, "partially_paid")
+
+	refund := book("refund", 6000)
+	expect("full refund", -10000, "pending")
+
+	// Lowering a refund gives the difference back to the balance and settles the debt again
+	lower := money.FromMajor(5000, money.KZT)
+	if _, err := payments.UpdateTransactionWithBalance(refund.ID, &models.PaymentTransactionUpdate{Amount: &lower}, database.Actor{CompanyID: companyID}); err != nil {
+		t.Fatal(err)
+	}
+	expect("lowered refund", -9000, "partially_paid")
+}
@@ -4,6 +4,7 @@ import (
 	"database/sql"
 	"fmt"
 
+	"classmate-central/internal/database"
 	"classmate-central/internal/models"
 )
 
@@ -23,7 +24,7 @@ func (r *PermissionRepository) GetAll() ([]*models.Permission, error) {
 		ORDER BY resource, action
 	`
 
-	rows, err := r.db.Query(query)
+	rows, err := database.System(r.db).Query(query)
 	if err != nil {
 		return nil, fmt.Errorf("error getting permissions: %w", err)
 	}
@@ -54,7 +55,7 @@ func (r *PermissionRepository) GetByID(id string) (*models.Permission, error) {
 		WHERE id = $1
 	`
 
-	err := r.db.QueryRow(query, id).Scan(
+	err := database.System(r.db).QueryRow(query, id).Scan(
 		&perm.ID, &perm.Name, &perm.Resource, &perm.Action,
 		&perm.Description, &perm.CreatedAt,
 	)
@@ -77,7 +78,7 @@ func (r *PermissionRepository) GetByResourceAndAction(resource, action string) (
 		WHERE resource = $1 AND action = $2
 	`
 
-	err := r.db.QueryRow(query, resource, action).Scan(
+	err := database.System(r.db).QueryRow(query, resource, action).Scan(
 		&perm.ID, &perm.Name, &perm.Resource, &perm.Action,
 		&perm.Description, &perm.CreatedAt,
 	)
@@ -100,7 +101,7 @@ func (r *PermissionRepository) GetByResource(resource string) ([]*models.Permiss
 		ORDER BY action
 	`
 
-	rows, err := r.db.Query(query, resource)
+	rows, err := database.System(r.db).Query(query, resource)
 	if err != nil {
 		return nil, fmt.Errorf("error getting permissions by resource: %w", err)
 	}
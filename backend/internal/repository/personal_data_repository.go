@@ -0,0 +1,383 @@
+package repository
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"classmate-central/internal/database"
+	"classmate-central/internal/models"
+
+	"github.com/lib/pq"
+)
+
+// anonymizedName replaces the name of an erased student or lead
+const anonymizedName = "Anonymized"
+
+// byStudentID and byLeadID select a subject's rows; $1 is the subject ID
+func byStudentID(name string) tenantTable {
+	return tenantTable{name: name, scope: "x.student_id = $1"}
+}
+
+func byLeadID(name string) tenantTable {
+	return tenantTable{name: name, scope: "x.lead_id = $1"}
+}
+
+const (
+	studentSubscriptions = "SELECT id FROM student_subscriptions WHERE student_id = $1"
+	studentPayments      = "SELECT id FROM payment_transactions WHERE student_id = $1"
+	studentInvoices      = "SELECT id FROM invoice WHERE student_id = $1"
+)
+
+// studentDataTables are the tables holding a student's data, for the personal data export
+var studentDataTables = []tenantTable{
+	{name: "students", scope: "x.id = $1"},
+	byStudentID("student_subjects"),
+	byStudentID("student_groups"),
+	byStudentID("student_balance"),
+	byStudentID("student_notes"),
+	byStudentID("student_activity_log"),
+	byStudentID("notifications"),
+	byStudentID("student_transfers"),
+	byStudentID("enrollment"),
+	byStudentID("individual_enrollment"),
+	byStudentID("lesson_students"),
+	byStudentID("lesson_attendance"),
+	byStudentID("student_subscriptions"),
+	{name: "subscription_freezes", scope: "x.subscription_id IN (" + studentSubscriptions + ")"},
+	{name: "subscription_consumption", scope: "x.subscription_id IN (" + studentSubscriptions + ")"},
+	byStudentID("payment_transactions"),
+	byStudentID("payment_intents"),
+	{name: "fiscal_receipts", scope: "x.transaction_id IN (" + studentPayments + ")"},
+	byStudentID("invoice"),
+	{name: "invoice_item", scope: "x.invoice_id IN (" + studentInvoices + ")"},
+	{name: "transaction", scope: "x.payment_id IN (" + studentPayments + ") OR x.invoice_id IN (" + studentInvoices + ") OR x.subscription_id IN (" + studentSubscriptions + ")"},
+	byStudentID("debt_records"),
+	{name: "debt_payments", scope: "x.debt_id IN (SELECT id FROM debt_records WHERE student_id = $1)"},
+	byStudentID("installment_plans"),
+	{name: "installments", scope: "x.plan_id IN (SELECT id FROM installment_plans WHERE student_id = $1)"},
+	{name: "audit_log", scope: "x.entity_type = 'students' AND x.entity_id = $1"},
+}
+
+// leadDataTables are the tables holding a lead's data, for the personal data export
+var leadDataTables = []tenantTable{
+	{name: "leads", scope: "x.id = $1"},
+	byLeadID("lead_activities"),
+	byLeadID("lead_tasks"),
+}
+
+// erasureStep changes or deletes the personal data of one table; $1 is the subject ID. In
+// snapshots, the rows whose column holds the subject ID get the fields returned by scrub, or
+// are dropped if scrub is nil. Steps without a column touch tables that are not snapshotted.
+type erasureStep struct {
+	table  string
+	query  string
+	column string
+	scrub  func(id string) map[string]interface{}
+}
+
+// studentErasure anonymizes a student. Subscriptions, payments, invoices, debts, installments
+// and attendance stay for accounting; only the free text attached to attendance is cleared.
+var studentErasure = []erasureStep{
+	{"students", `UPDATE students SET name = '` + anonymizedName + `', email = 'anonymized-' || id || '@invalid',
+		phone = NULL, avatar = NULL, age = NULL, status = 'inactive', anonymized_at = CURRENT_TIMESTAMP WHERE id = $1`,
+		"id", func(id string) map[string]interface{} {
+			return map[string]interface{}{"name": anonymizedName, "email": "anonymized-" + id + "@invalid",
+				"phone": nil, "avatar": nil, "age": nil, "status": "inactive", "anonymized_at": time.Now().UTC()}
+		}},
+	{"student_notes", `DELETE FROM student_notes WHERE student_id = $1`, "student_id", nil},
+	{"student_activity_log", `DELETE FROM student_activity_log WHERE student_id = $1`, "student_id", nil},
+	{"notifications", `DELETE FROM notifications WHERE student_id = $1`, "student_id", nil},
+	{"lesson_attendance", `UPDATE lesson_attendance SET reason = NULL, notes = NULL
+		WHERE student_id = $1 AND (reason IS NOT NULL OR notes IS NOT NULL)`,
+		"student_id", func(string) map[string]interface{} {
+			return map[string]interface{}{"reason": nil, "notes": nil}
+		}},
+	{"audit_log", `UPDATE audit_log SET changes = '{"redacted": true}'
+		WHERE entity_type = 'students' AND entity_id = $1 AND action IN ('create', 'update', 'delete')`, "", nil},
+}
+
+// leadErasure anonymizes a lead and deletes its activities and tasks
+var leadErasure = []erasureStep{
+	{"leads", `UPDATE leads SET name = '` + anonymizedName + `', phone = '', email = NULL, notes = NULL,
+		anonymized_at = CURRENT_TIMESTAMP WHERE id = $1`,
+		"id", func(string) map[string]interface{} {
+			return map[string]interface{}{"name": anonymizedName, "phone": "", "email": nil, "notes": nil,
+				"anonymized_at": time.Now().UTC()}
+		}},
+	{"lead_activities", `DELETE FROM lead_activities WHERE lead_id = $1`, "lead_id", nil},
+	{"lead_tasks", `DELETE FROM lead_tasks WHERE lead_id = $1`, "lead_id", nil},
+}
+
+// personalDataSubject describes where a kind of subject lives
+type personalDataSubject struct {
+	table       string
+	entityType  string // audit_log entity type
+	dataTables  []tenantTable
+	erasure     []erasureStep
+	matchTables []string // tables searched for the same email or phone
+}
+
+var personalDataSubjects = map[string]personalDataSubject{
+	models.SubjectStudent: {table: "students", entityType: "students", dataTables: studentDataTables, erasure: studentErasure, matchTables: []string{"students", "leads"}},
+	models.SubjectLead:    {table: "leads", entityType: "leads", dataTables: leadDataTables, erasure: leadErasure, matchTables: []string{"leads", "students"}},
+}
+
+// IsPersonalDataSubject reports whether subjectType is a kind of subject whose data can be exported and erased
+func IsPersonalDataSubject(subjectType string) bool {
+	_, ok := personalDataSubjects[subjectType]
+	return ok
+}
+
+// PersonalDataRepository exports and erases the personal data of a single student or lead
+type PersonalDataRepository struct {
+	db *sql.DB
+}
+
+func NewPersonalDataRepository(db *sql.DB) *PersonalDataRepository {
+	return &PersonalDataRepository{db: db}
+}
+
+// Export collects every row that references the subject, plus the other students and leads
+// of the company with the same email or phone, and records the export in the audit log.
+// Returns nil if the company has no such subject.
+func (r *PersonalDataRepository) Export(actor database.Actor, subjectType, id string) (*models.PersonalDataExport, error) {
+	subject, ok := personalDataSubjects[subjectType]
+	if !ok {
+		return nil, fmt.Errorf("unknown personal data subject %q", subjectType)
+	}
+
+	var export *models.PersonalDataExport
+	err := database.WithActor(r.db, actor, func(tx *sql.Tx) error {
+		email, phone, found, err := findSubject(tx, subject.table, actor.CompanyID, id)
+		if err != nil || !found {
+			return err
+		}
+
+		export = &models.PersonalDataExport{
+			SubjectType: subjectType,
+			SubjectID:   id,
+			ExportedAt:  time.Now(),
+			Tables:      map[string][]json.RawMessage{},
+			Matches:     map[string][]json.RawMessage{},
+		}
+		for _, t := range subject.dataTables {
+			rows, err := dumpTable(tx, t, id)
+			if err != nil {
+				return err
+			}
+			if len(rows) > 0 {
+				export.Tables[t.name] = rows
+			}
+		}
+		for _, table := range subject.matchTables {
+			rows, err := matchingRows(tx, table, actor.CompanyID, id, email, phone)
+			if err != nil {
+				return err
+			}
+			if len(rows) > 0 {
+				export.Matches[table] = rows
+			}
+		}
+
+		return recordAudit(tx, personalDataAuditEntry(actor, "export_personal_data", subject.entityType, id, map[string]interface{}{
+			"tables": len(export.Tables), "matches": len(export.Matches),
+		}))
+	})
+	if err != nil {
+		return nil, err
+	}
+	return export, nil
+}
+
+// Erase anonymizes the subject's personal fields and deletes its notes and activity, keeping
+// financial records. Earlier audit entries of the subject are redacted, the subject is erased
+// from the company's snapshots as well, so that a restore cannot bring it back, and the erasure
+// itself is recorded without any personal data. Returns nil if the company has no such subject.
+func (r *PersonalDataRepository) Erase(actor database.Actor, subjectType, id string) (*models.PersonalDataErasure, error) {
+	subject, ok := personalDataSubjects[subjectType]
+	if !ok {
+		return nil, fmt.Errorf("unknown personal data subject %q", subjectType)
+	}
+
+	var erasure *models.PersonalDataErasure
+	err := database.WithActor(r.db, actor, func(tx *sql.Tx) error {
+		_, _, found, err := findSubject(tx, subject.table, actor.CompanyID, id)
+		if err != nil || !found {
+			return err
+		}
+		// The row triggers would copy the personal data being erased into the audit log
+		if err := database.SuppressAudit(tx); err != nil {
+			return err
+		}
+
+		erasure = &models.PersonalDataErasure{SubjectType: subjectType, SubjectID: id, AnonymizedAt: time.Now(), Changed: map[string]int64{}}
+		for _, step := range subject.erasure {
+			result, err := tx.Exec(step.query, id)
+			if err != nil {
+				return fmt.Errorf("error erasing %s: %w", step.table, err)
+			}
+			rows, err := result.RowsAffected()
+			if err != nil {
+				return fmt.Errorf("error erasing %s: %w", step.table, err)
+			}
+			if rows > 0 {
+				erasure.Changed[step.table] = rows
+			}
+		}
+
+		snapshots, err := scrubSnapshots(tx, actor.CompanyID, subject.erasure, id)
+		if err != nil {
+			return err
+		}
+
+		return recordAudit(tx, personalDataAuditEntry(actor, "erase_personal_data", subject.entityType, id, map[string]interface{}{
+			"changed": erasure.Changed, "snapshots": snapshots,
+		}))
+	})
+	if err != nil {
+		return nil, err
+	}
+	return erasure, nil
+}
+
+// scrubSnapshots applies the erasure steps to every snapshot of the company that contains the
+// subject and returns the number of snapshots rewritten
+func scrubSnapshots(tx *sql.Tx, companyID string, steps []erasureStep, id string) (int, error) {
+	rows, err := tx.Query(`SELECT id FROM company_snapshots WHERE company_id = $1 ORDER BY id`, companyID)
+	if err != nil {
+		return 0, fmt.Errorf("error listing snapshots: %w", err)
+	}
+	var ids []int64
+	for rows.Next() {
+		var snapshotID int64
+		if err := rows.Scan(&snapshotID); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("error listing snapshots: %w", err)
+		}
+		ids = append(ids, snapshotID)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("error listing snapshots: %w", err)
+	}
+
+	scrubbed := 0
+	for _, snapshotID := range ids {
+		doc, err := loadSnapshot(tx, companyID, snapshotID)
+		if errors.Is(err, ErrSnapshotFormat) {
+			continue // cannot be restored either
+		}
+		if err != nil {
+			return 0, err
+		}
+		changed, err := scrubSnapshotDocument(doc, steps, id)
+		if err != nil {
+			return 0, fmt.Errorf("error erasing snapshot %d: %w", snapshotID, err)
+		}
+		if !changed {
+			continue
+		}
+		if err := saveSnapshotDocument(tx, snapshotID, doc); err != nil {
+			return 0, err
+		}
+		scrubbed++
+	}
+	return scrubbed, nil
+}
+
+// scrubSnapshotDocument applies the erasure steps to the rows of a snapshot and reports
+// whether any row changed
+func scrubSnapshotDocument(doc *snapshotDocument, steps []erasureStep, id string) (bool, error) {
+	changed := false
+	for _, step := range steps {
+		rows := doc.Tables[step.table]
+		if step.column == "" || len(rows) == 0 {
+			continue
+		}
+		kept := rows[:0]
+		for _, raw := range rows {
+			var row map[string]json.RawMessage
+			if err := json.Unmarshal(raw, &row); err != nil {
+				return false, fmt.Errorf("error decoding %s row: %w", step.table, err)
+			}
+			var value interface{}
+			if err := json.Unmarshal(row[step.column], &value); err != nil || value == nil || idKey(value) != id {
+				kept = append(kept, raw)
+				continue
+			}
+			changed = true
+			if step.scrub == nil {
+				continue
+			}
+			for field, v := range step.scrub(id) {
+				data, err := json.Marshal(v)
+				if err != nil {
+					return false, fmt.Errorf("error encoding %s.%s: %w", step.table, field, err)
+				}
+				row[field] = data
+			}
+			data, err := json.Marshal(row)
+			if err != nil {
+				return false, fmt.Errorf("error encoding %s row: %w", step.table, err)
+			}
+			kept = append(kept, data)
+		}
+		if len(kept) == 0 {
+			delete(doc.Tables, step.table)
+		} else {
+			doc.Tables[step.table] = kept
+		}
+	}
+	return changed, nil
+}
+
+// findSubject returns the email and phone of a student or lead of the company. Deleted
+// subjects in the trash are included.
+func findSubject(tx *sql.Tx, table, companyID, id string) (string, string, bool, error) {
+	var email, phone string
+	err := tx.QueryRow(fmt.Sprintf(`SELECT COALESCE(email, ''), COALESCE(phone, '') FROM %s WHERE id = $1 AND company_id = $2`, pq.QuoteIdentifier(table)),
+		id, companyID).Scan(&email, &phone)
+	if err == sql.ErrNoRows {
+		return "", "", false, nil
+	}
+	if err != nil {
+		return "", "", false, fmt.Errorf("error getting %s: %w", table, err)
+	}
+	return email, phone, true, nil
+}
+
+// matchingRows returns the company's other students or leads with the same email (ignoring
+// case) or the same phone (comparing digits only, at least five of them)
+func matchingRows(tx *sql.Tx, table, companyID, id, email, phone string) ([]json.RawMessage, error) {
+	rows, err := tx.Query(fmt.Sprintf(`
+		SELECT row_to_json(x)::text FROM %s x
+		WHERE x.company_id = $1 AND x.id <> $2 AND (
+			($3 <> '' AND LOWER(x.email) = LOWER($3))
+			OR (LENGTH(regexp_replace($4, '\D', '', 'g')) >= 5
+				AND regexp_replace(COALESCE(x.phone, ''), '\D', '', 'g') = regexp_replace($4, '\D', '', 'g'))
+		)`, pq.QuoteIdentifier(table)), companyID, id, email, phone)
+	if err != nil {
+		return nil, fmt.Errorf("error matching %s: %w", table, err)
+	}
+	defer rows.Close()
+
+	result := []json.RawMessage{}
+	for rows.Next() {
+		var row string
+		if err := rows.Scan(&row); err != nil {
+			return nil, fmt.Errorf("error matching %s: %w", table, err)
+		}
+		result = append(result, json.RawMessage(row))
+	}
+	return result, rows.Err()
+}
+
+func personalDataAuditEntry(actor database.Actor, action, entityType, id string, changes map[string]interface{}) *models.AuditEntry {
+	entry := companyDataAuditEntry(actor, action, changes)
+	entry.EntityType = entityType
+	entry.EntityID = &id
+	return entry
+}
@@ -0,0 +1,322 @@
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"classmate-central/internal/database"
+	"classmate-central/internal/models"
+
+	"github.com/lib/pq"
+)
+
+// Live counts of the resources a plan limits, as correlated subqueries on alias c (companies).
+// Deleted and erased students and deleted branches do not count.
+const (
+	usageStudentsQuery = `(SELECT COUNT(*) FROM students s WHERE s.company_id = c.id AND s.deleted_at IS NULL AND s.anonymized_at IS NULL)`
+	usageBranchesQuery = `(SELECT COUNT(*) FROM branches b WHERE b.company_id = c.id AND b.deleted_at IS NULL)`
+	usageUsersQuery    = `(SELECT COUNT(*) FROM users u WHERE u.company_id = c.id)`
+	usageStorageQuery  = `COALESCE((SELECT cu.storage_bytes FROM company_usage cu WHERE cu.company_id = c.id ORDER BY cu.day DESC LIMIT 1), 0)`
+)
+
+const planColumns = `p.id, p.name, p.max_students, p.max_branches, p.max_users, p.max_storage_mb, p.features, p.created_at, p.updated_at`
+
+type PlanRepository struct {
+	db *sql.DB
+}
+
+func NewPlanRepository(db *sql.DB) *PlanRepository {
+	return &PlanRepository{db: db}
+}
+
+func scanPlan(row interface{ Scan(...interface{}) error }, extra ...interface{}) (*models.Plan, error) {
+	plan := &models.Plan{}
+	var maxStudents, maxBranches, maxUsers, maxStorage sql.NullInt64
+	dest := []interface{}{&plan.ID, &plan.Name, &maxStudents, &maxBranches, &maxUsers, &maxStorage,
+		pq.Array(&plan.Features), &plan.CreatedAt, &plan.UpdatedAt}
+	if err := row.Scan(append(dest, extra...)...); err != nil {
+		return nil, err
+	}
+	plan.MaxStudents = nullableInt(maxStudents)
+	plan.MaxBranches = nullableInt(maxBranches)
+	plan.MaxUsers = nullableInt(maxUsers)
+	plan.MaxStorageMB = nullableInt(maxStorage)
+	if plan.Features == nil {
+		plan.Features = []string{}
+	}
+	return plan, nil
+}
+
+func nullableInt(v sql.NullInt64) *int {
+	if !v.Valid {
+		return nil
+	}
+	i := int(v.Int64)
+	return &i
+}
+
+// GetPlans returns every plan with the number of companies on it
+func (r *PlanRepository) GetPlans() ([]*models.Plan, error) {
+	rows, err := database.System(r.db).Query(`
+		SELECT ` + planColumns + `, (SELECT COUNT(*) FROM companies c WHERE c.plan_id = p.id)
+		FROM plans p
+		ORDER BY p.max_students NULLS LAST, p.id`)
+	if err != nil {
+		return nil, fmt.Errorf("error getting plans: %w", err)
+	}
+	defer rows.Close()
+
+	plans := []*models.Plan{}
+	for rows.Next() {
+		var companies int
+		plan, err := scanPlan(rows, &companies)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning plan: %w", err)
+		}
+		plan.Companies = companies
+		plans = append(plans, plan)
+	}
+	return plans, rows.Err()
+}
+
+// GetPlan returns a plan, or nil if it does not exist
+func (r *PlanRepository) GetPlan(id string) (*models.Plan, error) {
+	plan, err := scanPlan(database.System(r.db).QueryRow(`SELECT `+planColumns+` FROM plans p WHERE p.id = $1`, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error getting plan: %w", err)
+	}
+	return plan, nil
+}
+
+// GetCompanyPlan returns the plan of a company, or nil if the company does not exist
+func (r *PlanRepository) GetCompanyPlan(companyID string) (*models.Plan, error) {
+	plan, err := scanPlan(database.Tenant(r.db, companyID).QueryRow(`
+		SELECT `+planColumns+` FROM plans p
+		JOIN companies c ON c.plan_id = p.id
+		WHERE c.id = $1`, companyID))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error getting company plan: %w", err)
+	}
+	return plan, nil
+}
+
+// UpdatePlan replaces the name, limits and features of a plan. Returns sql.ErrNoRows if it
+// does not exist.
+func (r *PlanRepository) UpdatePlan(plan *models.Plan) error {
+	err := database.System(r.db).QueryRow(`
+		UPDATE plans
+		SET name = $1, max_students = $2, max_branches = $3, max_users = $4, max_storage_mb = $5,
+		    features = $6, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $7
+		RETURNING created_at, updated_at`,
+		plan.Name, plan.MaxStudents, plan.MaxBranches, plan.MaxUsers, plan.MaxStorageMB,
+		pq.Array(plan.Features), plan.ID,
+	).Scan(&plan.CreatedAt, &plan.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return err
+	}
+	if err != nil {
+		return fmt.Errorf("error updating plan: %w", err)
+	}
+	return nil
+}
+
+// SetCompanyPlan moves the actor's company to another plan and records it in the company's
+// audit log. Returns sql.ErrNoRows if the company does not exist.
+func (r *PlanRepository) SetCompanyPlan(actor database.Actor, planID string) error {
+	return database.WithActor(r.db, actor, func(tx *sql.Tx) error {
+		var previous string
+		err := tx.QueryRow(`SELECT plan_id FROM companies WHERE id = $1 FOR UPDATE`, actor.CompanyID).Scan(&previous)
+		if err == sql.ErrNoRows {
+			return err
+		}
+		if err != nil {
+			return fmt.Errorf("error locking company: %w", err)
+		}
+		if _, err := tx.Exec(`UPDATE companies SET plan_id = $1, updated_at = NOW() WHERE id = $2`, planID, actor.CompanyID); err != nil {
+			return fmt.Errorf("error changing company plan: %w", err)
+		}
+		return recordAudit(tx, companyDataAuditEntry(actor, "change_plan", map[string]interface{}{
+			"from": previous,
+			"to":   planID,
+		}))
+	})
+}
+
+// CountUsage returns how much of a resource a company uses now. Storage is the last metered
+// value, in bytes.
+func (r *PlanRepository) CountUsage(companyID, resource string) (int64, error) {
+	return countUsage(database.Tenant(r.db, companyID), companyID, resource)
+}
+
+// countUsage counts a resource of the company with q, so imports can count inside their transaction
+func countUsage(q queryRower, companyID, resource string) (int64, error) {
+	var query string
+	switch resource {
+	case models.PlanResourceStudents:
+		query = usageStudentsQuery
+	case models.PlanResourceBranches:
+		query = usageBranchesQuery
+	case models.PlanResourceUsers:
+		query = usageUsersQuery
+	case models.PlanResourceStorage:
+		query = usageStorageQuery
+	default:
+		return 0, fmt.Errorf("unknown plan resource %q", resource)
+	}
+	var used int64
+	if err := q.QueryRow(`SELECT `+query+` FROM companies c WHERE c.id = $1`, companyID).Scan(&used); err != nil && err != sql.ErrNoRows {
+		return 0, fmt.Errorf("error counting %s: %w", resource, err)
+	}
+	return used, nil
+}
+
+// GetCompaniesUsage returns every company with its plan and current usage, newest company first
+func (r *PlanRepository) GetCompaniesUsage() ([]*models.CompanyPlanUsage, error) {
+	rows, err := database.System(r.db).Query(`
+		SELECT c.id, c.name, COALESCE(c.status, ''), c.plan_id, c.created_at, c.updated_at,
+		       ` + usageStudentsQuery + `, ` + usageBranchesQuery + `, ` + usageUsersQuery + `, ` + usageStorageQuery + `,
+		       ` + planColumns + `
+		FROM companies c
+		JOIN plans p ON p.id = c.plan_id
+		ORDER BY c.created_at DESC`)
+	if err != nil {
+		return nil, fmt.Errorf("error getting companies usage: %w", err)
+	}
+	defer rows.Close()
+
+	result := []*models.CompanyPlanUsage{}
+	now := time.Now()
+	for rows.Next() {
+		company := &models.Company{}
+		usage := &models.CompanyUsage{Day: now.Format("2006-01-02"), MeasuredAt: now}
+		plan, err := scanPlan(scanPrefix{rows, []interface{}{
+			&company.ID, &company.Name, &company.Status, &company.PlanID, &company.CreatedAt, &company.UpdatedAt,
+			&usage.Students, &usage.Branches, &usage.Users, &usage.StorageBytes,
+		}})
+		if err != nil {
+			return nil, fmt.Errorf("error scanning company usage: %w", err)
+		}
+		usage.CompanyID = company.ID
+		result = append(result, &models.CompanyPlanUsage{Company: company, Plan: plan, Current: usage})
+	}
+	return result, rows.Err()
+}
+
+// scanPrefix scans the given destinations before the ones passed to Scan
+type scanPrefix struct {
+	row  interface{ Scan(...interface{}) error }
+	dest []interface{}
+}
+
+func (s scanPrefix) Scan(dest ...interface{}) error {
+	return s.row.Scan(append(append([]interface{}{}, s.dest...), dest...)...)
+}
+
+// GetCurrentUsage returns what a company uses now, or nil if it does not exist
+func (r *PlanRepository) GetCurrentUsage(companyID string) (*models.CompanyUsage, error) {
+	now := time.Now()
+	usage := &models.CompanyUsage{CompanyID: companyID, Day: now.Format("2006-01-02"), MeasuredAt: now}
+	err := database.Tenant(r.db, companyID).QueryRow(`
+		SELECT `+usageStudentsQuery+`, `+usageBranchesQuery+`, `+usageUsersQuery+`, `+usageStorageQuery+`
+		FROM companies c WHERE c.id = $1`, companyID,
+	).Scan(&usage.Students, &usage.Branches, &usage.Users, &usage.StorageBytes)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error getting company usage: %w", err)
+	}
+	return usage, nil
+}
+
+// GetUsageHistory returns the metered usage of a company since a day, newest first
+func (r *PlanRepository) GetUsageHistory(companyID string, since time.Time) ([]*models.CompanyUsage, error) {
+	rows, err := database.Tenant(r.db, companyID).Query(`
+		SELECT company_id, TO_CHAR(day, 'YYYY-MM-DD'), students, branches, users, storage_bytes, measured_at
+		FROM company_usage
+		WHERE company_id = $1 AND day >= $2
+		ORDER BY day DESC`, companyID, since)
+	if err != nil {
+		return nil, fmt.Errorf("error getting usage history: %w", err)
+	}
+	defer rows.Close()
+
+	history := []*models.CompanyUsage{}
+	for rows.Next() {
+		usage := &models.CompanyUsage{}
+		if err := rows.Scan(&usage.CompanyID, &usage.Day, &usage.Students, &usage.Branches, &usage.Users,
+			&usage.StorageBytes, &usage.MeasuredAt); err != nil {
+			return nil, fmt.Errorf("error scanning usage: %w", err)
+		}
+		history = append(history, usage)
+	}
+	return history, rows.Err()
+}
+
+// GetMeteredCompanies returns the IDs of the companies whose usage is metered: all but the
+// deleted (inactive) ones
+func (r *PlanRepository) GetMeteredCompanies() ([]string, error) {
+	rows, err := database.System(r.db).Query(`SELECT id FROM companies WHERE COALESCE(status, '') <> 'inactive' ORDER BY id`)
+	if err != nil {
+		return nil, fmt.Errorf("error getting companies to meter: %w", err)
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("error scanning company: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// MeterUsage measures what a company uses and stores it as the usage of the day, replacing
+// an earlier measurement of the same day. Storage is the size of the company's rows in every
+// tenant table plus its snapshots.
+func (r *PlanRepository) MeterUsage(companyID string, day time.Time) (*models.CompanyUsage, error) {
+	var storage int64
+	for _, t := range append(append([]tenantTable{}, wipeTables...), accountTables...) {
+		var size int64
+		err := database.Tenant(r.db, companyID).QueryRow(fmt.Sprintf(`SELECT COALESCE(SUM(pg_column_size(x.*)), 0) FROM %s x WHERE %s`,
+			pq.QuoteIdentifier(t.name), t.scope), companyID).Scan(&size)
+		if err != nil {
+			return nil, fmt.Errorf("error measuring %s: %w", t.name, err)
+		}
+		storage += size
+	}
+	var snapshots int64
+	if err := database.Tenant(r.db, companyID).QueryRow(`SELECT COALESCE(SUM(size_bytes), 0) FROM company_snapshots WHERE company_id = $1`, companyID).Scan(&snapshots); err != nil {
+		return nil, fmt.Errorf("error measuring snapshots: %w", err)
+	}
+	storage += snapshots
+
+	usage := &models.CompanyUsage{CompanyID: companyID, StorageBytes: storage}
+	err := database.Tenant(r.db, companyID).QueryRow(`
+		INSERT INTO company_usage (company_id, day, students, branches, users, storage_bytes, measured_at)
+		SELECT c.id, $2, `+usageStudentsQuery+`, `+usageBranchesQuery+`, `+usageUsersQuery+`, $3, CURRENT_TIMESTAMP
+		FROM companies c WHERE c.id = $1
+		ON CONFLICT (company_id, day) DO UPDATE
+		SET students = EXCLUDED.students, branches = EXCLUDED.branches, users = EXCLUDED.users,
+		    storage_bytes = EXCLUDED.storage_bytes, measured_at = EXCLUDED.measured_at
+		RETURNING TO_CHAR(day, 'YYYY-MM-DD'), students, branches, users, measured_at`,
+		companyID, day.Format("2006-01-02"), storage,
+	).Scan(&usage.Day, &usage.Students, &usage.Branches, &usage.Users, &usage.MeasuredAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error storing usage: %w", err)
+	}
+	return usage, nil
+}
@@ -0,0 +1,243 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"classmate-central/internal/database"
+	"classmate-central/internal/models"
+
+	"github.com/lib/pq"
+)
+
+// ErrCompanyStatusUnchanged is returned when a company is suspended or reactivated while it
+// already has that status
+var ErrCompanyStatusUnchanged = errors.New("company already has this status")
+
+// Last request of any user of company c, not counting platform admins signed in as them
+const lastActivityQuery = `(SELECT MAX(s.last_seen_at) FROM user_sessions s WHERE s.company_id = c.id AND s.impersonated_by IS NULL)`
+
+const platformCompanyColumns = `c.id, c.name, COALESCE(c.status, ''), c.plan_id, c.created_at, c.updated_at,
+	c.suspended_at, c.suspension_reason, p.name,
+	` + usageStudentsQuery + `, ` + usageBranchesQuery + `, ` + usageUsersQuery + `, ` + usageStorageQuery + `,
+	` + lastActivityQuery
+
+// PlatformRepository serves the platform console, which works across companies
+type PlatformRepository struct {
+	db *sql.DB
+}
+
+func NewPlatformRepository(db *sql.DB) *PlatformRepository {
+	return &PlatformRepository{db: db}
+}
+
+func scanPlatformCompany(row interface{ Scan(...interface{}) error }) (*models.PlatformCompany, error) {
+	now := time.Now()
+	company := &models.PlatformCompany{
+		Usage: &models.CompanyUsage{Day: now.Format("2006-01-02"), MeasuredAt: now},
+	}
+	var lastActivity sql.NullTime
+	err := row.Scan(&company.ID, &company.Name, &company.Status, &company.PlanID, &company.CreatedAt, &company.UpdatedAt,
+		&company.SuspendedAt, &company.SuspensionReason, &company.PlanName,
+		&company.Usage.Students, &company.Usage.Branches, &company.Usage.Users, &company.Usage.StorageBytes,
+		&lastActivity)
+	if err != nil {
+		return nil, err
+	}
+	company.Usage.CompanyID = company.ID
+	if lastActivity.Valid {
+		company.LastActivityAt = &lastActivity.Time
+	}
+	return company, nil
+}
+
+// SearchCompanies returns one page of the companies matching the filter, newest first, and
+// how many match in total
+func (r *PlatformRepository) SearchCompanies(filter models.PlatformCompanyFilter) (*models.PlatformCompanyList, error) {
+	conditions := []string{"TRUE"}
+	args := []interface{}{}
+	add := func(condition string, value interface{}) {
+		args = append(args, value)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+	if filter.Search != "" {
+		add(`(LOWER(c.name) LIKE $%[1]d OR LOWER(c.id) LIKE $%[1]d
+			OR EXISTS (SELECT 1 FROM users u WHERE u.company_id = c.id AND LOWER(u.email) LIKE $%[1]d))`,
+			"%"+strings.ToLower(filter.Search)+"%")
+	}
+	if filter.Status != "" {
+		add("COALESCE(c.status, '') = $%d", filter.Status)
+	}
+	if filter.PlanID != "" {
+		add("c.plan_id = $%d", filter.PlanID)
+	}
+	where := " WHERE " + strings.Join(conditions, " AND ")
+
+	list := &models.PlatformCompanyList{Companies: []*models.PlatformCompany{}}
+	if err := database.System(r.db).QueryRow(`SELECT COUNT(*) FROM companies c`+where, args...).Scan(&list.Total); err != nil {
+		return nil, fmt.Errorf("error counting companies: %w", err)
+	}
+
+	query := `SELECT ` + platformCompanyColumns + `
+		FROM companies c
+		JOIN plans p ON p.id = c.plan_id` + where + `
+		ORDER BY c.created_at DESC, c.id`
+	if filter.Limit > 0 {
+		args = append(args, filter.Limit, filter.Offset)
+		query += fmt.Sprintf(" LIMIT $%d OFFSET $%d", len(args)-1, len(args))
+	}
+	rows, err := database.System(r.db).Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error searching companies: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		company, err := scanPlatformCompany(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning company: %w", err)
+		}
+		list.Companies = append(list.Companies, company)
+	}
+	return list, rows.Err()
+}
+
+// GetCompany returns a company with its plan name, usage and last activity, or nil if it does not exist
+func (r *PlatformRepository) GetCompany(id string) (*models.PlatformCompany, error) {
+	company, err := scanPlatformCompany(database.System(r.db).QueryRow(`
+		SELECT `+platformCompanyColumns+`
+		FROM companies c
+		JOIN plans p ON p.id = c.plan_id
+		WHERE c.id = $1`, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error getting company: %w", err)
+	}
+	return company, nil
+}
+
+// GetCompanyStats counts what a company works with; deleted records do not count
+func (r *PlatformRepository) GetCompanyStats(companyID string) (*models.PlatformCompanyStats, error) {
+	stats := &models.PlatformCompanyStats{}
+	err := database.Tenant(r.db, companyID).QueryRow(`
+		SELECT
+			(SELECT COUNT(*) FROM teachers WHERE company_id = $1 AND deleted_at IS NULL),
+			(SELECT COUNT(*) FROM groups WHERE company_id = $1 AND deleted_at IS NULL),
+			(SELECT COUNT(*) FROM leads WHERE company_id = $1),
+			(SELECT COUNT(*) FROM lessons WHERE company_id = $1 AND deleted_at IS NULL
+				AND start_time >= CURRENT_TIMESTAMP - INTERVAL '30 days' AND start_time < CURRENT_TIMESTAMP),
+			(SELECT COUNT(*) FROM payment_transactions WHERE company_id = $1 AND type = 'payment'
+				AND created_at >= CURRENT_TIMESTAMP - INTERVAL '30 days'),
+			(SELECT COUNT(*) FROM user_sessions WHERE company_id = $1 AND impersonated_by IS NULL
+				AND revoked_at IS NULL AND expires_at > CURRENT_TIMESTAMP)`, companyID,
+	).Scan(&stats.Teachers, &stats.Groups, &stats.Leads, &stats.Lessons30Days, &stats.Payments30Days, &stats.ActiveSessions)
+	if err != nil {
+		return nil, fmt.Errorf("error getting company stats: %w", err)
+	}
+	return stats, nil
+}
+
+const platformUserQuery = `
+	SELECT u.id, u.name, u.email, u.is_platform_admin,
+	       ARRAY(SELECT r.name FROM user_roles ur JOIN roles r ON r.id = ur.role_id
+	             WHERE ur.user_id = u.id AND ur.company_id = u.company_id ORDER BY r.name),
+	       (SELECT MAX(s.last_seen_at) FROM user_sessions s WHERE s.user_id = u.id AND s.impersonated_by IS NULL)
+	FROM users u`
+
+func scanPlatformUser(row interface{ Scan(...interface{}) error }) (*models.PlatformCompanyUser, error) {
+	user := &models.PlatformCompanyUser{}
+	var lastSeen sql.NullTime
+	if err := row.Scan(&user.ID, &user.Name, &user.Email, &user.PlatformAdmin, pq.Array(&user.Roles), &lastSeen); err != nil {
+		return nil, err
+	}
+	if user.Roles == nil {
+		user.Roles = []string{}
+	}
+	if lastSeen.Valid {
+		user.LastSeenAt = &lastSeen.Time
+	}
+	return user, nil
+}
+
+// GetCompanyUsers returns the users of a company with their roles, by name
+func (r *PlatformRepository) GetCompanyUsers(companyID string) ([]*models.PlatformCompanyUser, error) {
+	rows, err := database.Tenant(r.db, companyID).Query(platformUserQuery+` WHERE u.company_id = $1 ORDER BY u.name, u.id`, companyID)
+	if err != nil {
+		return nil, fmt.Errorf("error getting company users: %w", err)
+	}
+	defer rows.Close()
+
+	users := []*models.PlatformCompanyUser{}
+	for rows.Next() {
+		user, err := scanPlatformUser(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning company user: %w", err)
+		}
+		users = append(users, user)
+	}
+	return users, rows.Err()
+}
+
+// GetCompanyUser returns a user of a company, or nil if the company has no such user
+func (r *PlatformRepository) GetCompanyUser(companyID string, userID int) (*models.PlatformCompanyUser, error) {
+	user, err := scanPlatformUser(database.Tenant(r.db, companyID).QueryRow(platformUserQuery+` WHERE u.company_id = $1 AND u.id = $2`, companyID, userID))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error getting company user: %w", err)
+	}
+	return user, nil
+}
+
+// SetCompanyStatus suspends or reactivates the actor's company and records it in the company's
+// audit log. The reason is kept while the company is suspended. Returns sql.ErrNoRows if the
+// company does not exist and ErrCompanyStatusUnchanged if it already has the status.
+func (r *PlatformRepository) SetCompanyStatus(actor database.Actor, status, reason string) error {
+	return database.WithActor(r.db, actor, func(tx *sql.Tx) error {
+		var previous string
+		err := tx.QueryRow(`SELECT COALESCE(status, '') FROM companies WHERE id = $1 FOR UPDATE`, actor.CompanyID).Scan(&previous)
+		if err == sql.ErrNoRows {
+			return err
+		}
+		if err != nil {
+			return fmt.Errorf("error locking company: %w", err)
+		}
+		if previous == status {
+			return ErrCompanyStatusUnchanged
+		}
+
+		var suspendedAt *time.Time
+		var suspensionReason *string
+		action := "reactivate_company"
+		if status == models.CompanyStatusSuspended {
+			now := time.Now()
+			suspendedAt, suspensionReason = &now, &reason
+			action = "suspend_company"
+		}
+		_, err = tx.Exec(`
+			UPDATE companies SET status = $1, suspended_at = $2, suspension_reason = $3, updated_at = NOW()
+			WHERE id = $4`, status, suspendedAt, suspensionReason, actor.CompanyID)
+		if err != nil {
+			return fmt.Errorf("error changing company status: %w", err)
+		}
+
+		changes := map[string]interface{}{"from": previous, "to": status}
+		if reason != "" {
+			changes["reason"] = reason
+		}
+		return recordAudit(tx, companyDataAuditEntry(actor, action, changes))
+	})
+}
+
+// RecordAction records something a platform admin did for the actor's company in its audit log
+func (r *PlatformRepository) RecordAction(actor database.Actor, action string, changes map[string]interface{}) error {
+	return database.WithActor(r.db, actor, func(tx *sql.Tx) error {
+		return recordAudit(tx, companyDataAuditEntry(actor, action, changes))
+	})
+}
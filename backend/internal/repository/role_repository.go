@@ -5,7 +5,10 @@ import (
 	"fmt"
 	"strings"
 
+	"classmate-central/internal/database"
 	"classmate-central/internal/models"
+
+	"github.com/lib/pq"
 )
 
 type RoleRepository struct {
@@ -19,13 +22,13 @@ func NewRoleRepository(db *sql.DB) *RoleRepository {
 // GetAll gets all roles for a company with their permissions
 func (r *RoleRepository) GetAll(companyID string) ([]*models.Role, error) {
 	query := `
-		SELECT id, name, description, company_id, created_at, updated_at
+		SELECT id, name, description, company_id, require_two_factor, created_at, updated_at
 		FROM roles
 		WHERE company_id = $1
 		ORDER BY name
 	`
 
-	rows, err := r.db.Query(query, companyID)
+	rows, err := database.Tenant(r.db, companyID).Query(query, companyID)
 	if err != nil {
 		return nil, fmt.Errorf("error getting roles: %w", err)
 	}
@@ -36,14 +39,14 @@ func (r *RoleRepository) GetAll(companyID string) ([]*models.Role, error) {
 		role := &models.Role{}
 		err := rows.Scan(
 			&role.ID, &role.Name, &role.Description, &role.CompanyID,
-			&role.CreatedAt, &role.UpdatedAt,
+			&role.RequireTwoFactor, &role.CreatedAt, &role.UpdatedAt,
 		)
 		if err != nil {
 			return nil, fmt.Errorf("error scanning role: %w", err)
 		}
 
 		// Load permissions for each role
-		permissions, err := r.GetRolePermissions(role.ID)
+		permissions, err := r.GetRolePermissions(role.ID, companyID)
 		if err != nil {
 			// Log error but don't fail - permissions will be empty
 			permissions = []*models.Permission{}
@@ -60,14 +63,14 @@ func (r *RoleRepository) GetAll(companyID string) ([]*models.Role, error) {
 func (r *RoleRepository) GetByID(id, companyID string) (*models.Role, error) {
 	role := &models.Role{}
 	query := `
-		SELECT id, name, description, company_id, created_at, updated_at
+		SELECT id, name, description, company_id, require_two_factor, created_at, updated_at
 		FROM roles
 		WHERE id = $1 AND company_id = $2
 	`
 
-	err := r.db.QueryRow(query, id, companyID).Scan(
+	err := database.Tenant(r.db, companyID).QueryRow(query, id, companyID).Scan(
 		&role.ID, &role.Name, &role.Description, &role.CompanyID,
-		&role.CreatedAt, &role.UpdatedAt,
+		&role.RequireTwoFactor, &role.CreatedAt, &role.UpdatedAt,
 	)
 	if err == sql.ErrNoRows {
 		return nil, nil
@@ -77,7 +80,7 @@ func (r *RoleRepository) GetByID(id, companyID string) (*models.Role, error) {
 	}
 
 	// Load permissions for the role
-	permissions, err := r.GetRolePermissions(id)
+	permissions, err := r.GetRolePermissions(id, companyID)
 	if err != nil {
 		return nil, fmt.Errorf("error getting role permissions: %w", err)
 	}
@@ -87,7 +90,7 @@ func (r *RoleRepository) GetByID(id, companyID string) (*models.Role, error) {
 }
 
 // Create creates a new role
-func (r *RoleRepository) Create(role *models.Role) error {
+func (r *RoleRepository) Create(role *models.Role, actor database.Actor) error {
 	query := `
 		INSERT INTO roles (id, name, description, company_id, created_at, updated_at)
 		VALUES ($1, $2, $3, $4, NOW(), NOW())
@@ -97,8 +100,10 @@ func (r *RoleRepository) Create(role *models.Role) error {
 	// Generate ID: company_id_role_name
 	roleID := fmt.Sprintf("%s_%s", role.CompanyID, strings.ToLower(strings.ReplaceAll(role.Name, " ", "_")))
 
-	err := r.db.QueryRow(query, roleID, role.Name, role.Description, role.CompanyID).
-		Scan(&role.CreatedAt, &role.UpdatedAt)
+	err := database.WithActor(r.db, actor, func(tx *sql.Tx) error {
+		return tx.QueryRow(query, roleID, role.Name, role.Description, role.CompanyID).
+			Scan(&role.CreatedAt, &role.UpdatedAt)
+	})
 	if err != nil {
 		return fmt.Errorf("error creating role: %w", err)
 	}
@@ -108,7 +113,7 @@ func (r *RoleRepository) Create(role *models.Role) error {
 }
 
 // Update updates an existing role
-func (r *RoleRepository) Update(role *models.Role) error {
+func (r *RoleRepository) Update(role *models.Role, actor database.Actor) error {
 	query := `
 		UPDATE roles
 		SET name = $1, description = $2, updated_at = NOW()
@@ -116,8 +121,10 @@ func (r *RoleRepository) Update(role *models.Role) error {
 		RETURNING updated_at
 	`
 
-	err := r.db.QueryRow(query, role.Name, role.Description, role.ID, role.CompanyID).
-		Scan(&role.UpdatedAt)
+	err := database.WithActor(r.db, actor, func(tx *sql.Tx) error {
+		return tx.QueryRow(query, role.Name, role.Description, role.ID, role.CompanyID).
+			Scan(&role.UpdatedAt)
+	})
 	if err != nil {
 		return fmt.Errorf("error updating role: %w", err)
 	}
@@ -125,27 +132,31 @@ func (r *RoleRepository) Update(role *models.Role) error {
 	return nil
 }
 
-// Delete deletes a role
-func (r *RoleRepository) Delete(id, companyID string) error {
+// Delete deletes a role of the actor's company
+func (r *RoleRepository) Delete(id string, actor database.Actor) error {
 	query := `DELETE FROM roles WHERE id = $1 AND company_id = $2`
-	_, err := r.db.Exec(query, id, companyID)
+	err := database.WithActor(r.db, actor, func(tx *sql.Tx) error {
+		_, err := tx.Exec(query, id, actor.CompanyID)
+		return err
+	})
 	if err != nil {
 		return fmt.Errorf("error deleting role: %w", err)
 	}
 	return nil
 }
 
-// GetRolePermissions gets all permissions for a role
-func (r *RoleRepository) GetRolePermissions(roleID string) ([]*models.Permission, error) {
+// GetRolePermissions gets all permissions for a role of the company
+func (r *RoleRepository) GetRolePermissions(roleID, companyID string) ([]*models.Permission, error) {
 	query := `
-		SELECT p.id, p.name, p.resource, p.action, p.description, p.created_at
+		SELECT p.id, p.name, p.resource, p.action, p.description, rp.scope, p.created_at
 		FROM permissions p
 		INNER JOIN role_permissions rp ON p.id = rp.permission_id
-		WHERE rp.role_id = $1
+		INNER JOIN roles r ON r.id = rp.role_id
+		WHERE rp.role_id = $1 AND r.company_id = $2
 		ORDER BY p.resource, p.action
 	`
 
-	rows, err := r.db.Query(query, roleID)
+	rows, err := database.Tenant(r.db, companyID).Query(query, roleID, companyID)
 	if err != nil {
 		return nil, fmt.Errorf("error getting role permissions: %w", err)
 	}
@@ -156,7 +167,7 @@ func (r *RoleRepository) GetRolePermissions(roleID string) ([]*models.Permission
 		perm := &models.Permission{}
 		err := rows.Scan(
 			&perm.ID, &perm.Name, &perm.Resource, &perm.Action,
-			&perm.Description, &perm.CreatedAt,
+			&perm.Description, &perm.Scope, &perm.CreatedAt,
 		)
 		if err != nil {
 			return nil, fmt.Errorf("error scanning permission: %w", err)
@@ -167,49 +178,57 @@ func (r *RoleRepository) GetRolePermissions(roleID string) ([]*models.Permission
 	return permissions, nil
 }
 
-// AssignPermissionToRole assigns a permission to a role
-func (r *RoleRepository) AssignPermissionToRole(roleID, permissionID string) error {
+// AssignPermissionToRole assigns a permission to a role of the company
+func (r *RoleRepository) AssignPermissionToRole(roleID, permissionID, companyID string) error {
 	query := `
 		INSERT INTO role_permissions (role_id, permission_id)
-		VALUES ($1, $2)
+		SELECT id, $2 FROM roles WHERE id = $1 AND company_id = $3
 		ON CONFLICT (role_id, permission_id) DO NOTHING
 	`
 
-	_, err := r.db.Exec(query, roleID, permissionID)
+	_, err := database.Tenant(r.db, companyID).Exec(query, roleID, permissionID, companyID)
 	if err != nil {
 		return fmt.Errorf("error assigning permission to role: %w", err)
 	}
 	return nil
 }
 
-// RemovePermissionFromRole removes a permission from a role
-func (r *RoleRepository) RemovePermissionFromRole(roleID, permissionID string) error {
-	query := `DELETE FROM role_permissions WHERE role_id = $1 AND permission_id = $2`
-	_, err := r.db.Exec(query, roleID, permissionID)
+// RemovePermissionFromRole removes a permission from a role of the company
+func (r *RoleRepository) RemovePermissionFromRole(roleID, permissionID, companyID string) error {
+	query := `DELETE FROM role_permissions WHERE role_id = $1 AND permission_id = $2
+		AND role_id IN (SELECT id FROM roles WHERE company_id = $3)`
+	_, err := database.Tenant(r.db, companyID).Exec(query, roleID, permissionID, companyID)
 	if err != nil {
 		return fmt.Errorf("error removing permission from role: %w", err)
 	}
 	return nil
 }
 
-// SetRolePermissions sets all permissions for a role (replaces existing)
-func (r *RoleRepository) SetRolePermissions(roleID string, permissionIDs []string) error {
+// SetRolePermissions sets all permissions for a role (replaces existing).
+// Permissions the role keeps retain their data scope; new ones get the default scope.
+func (r *RoleRepository) SetRolePermissions(roleID string, permissionIDs []string, actor database.Actor) error {
 	// Start transaction
-	tx, err := r.db.Begin()
+	tx, err := database.Tenant(r.db, actor.CompanyID).Begin()
 	if err != nil {
 		return fmt.Errorf("error starting transaction: %w", err)
 	}
 	defer tx.Rollback()
+	if err := database.SetActor(tx, actor); err != nil {
+		return err
+	}
 
-	// Delete existing permissions
-	_, err = tx.Exec(`DELETE FROM role_permissions WHERE role_id = $1`, roleID)
+	// Delete permissions that are no longer granted (a nil slice would compare as NULL)
+	if permissionIDs == nil {
+		permissionIDs = []string{}
+	}
+	_, err = tx.Exec(`DELETE FROM role_permissions WHERE role_id = $1 AND NOT (permission_id = ANY($2))`, roleID, pq.Array(permissionIDs))
 	if err != nil {
 		return fmt.Errorf("error deleting existing permissions: %w", err)
 	}
 
 	// Insert new permissions
 	if len(permissionIDs) > 0 {
-		query := `INSERT INTO role_permissions (role_id, permission_id) VALUES ($1, $2)`
+		query := `INSERT INTO role_permissions (role_id, permission_id) VALUES ($1, $2) ON CONFLICT (role_id, permission_id) DO NOTHING`
 		stmt, err := tx.Prepare(query)
 		if err != nil {
 			return fmt.Errorf("error preparing statement: %w", err)
@@ -227,17 +246,91 @@ func (r *RoleRepository) SetRolePermissions(roleID string, permissionIDs []strin
 	return tx.Commit()
 }
 
+// SetPermissionScopes changes the data scope of permissions the role already holds,
+// keyed by permission ID. Permissions the role does not hold are ignored.
+func (r *RoleRepository) SetPermissionScopes(roleID string, scopes map[string]string, actor database.Actor) error {
+	tx, err := database.Tenant(r.db, actor.CompanyID).Begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+	if err := database.SetActor(tx, actor); err != nil {
+		return err
+	}
+
+	for permID, scope := range scopes {
+		_, err = tx.Exec(`UPDATE role_permissions SET scope = $3 WHERE role_id = $1 AND permission_id = $2 AND scope <> $3`, roleID, permID, scope)
+		if err != nil {
+			return fmt.Errorf("error updating permission scope: %w", err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+// GetTwoFactorRoleIDs returns the roles of a company whose holders must use 2FA
+func (r *RoleRepository) GetTwoFactorRoleIDs(companyID string) ([]string, error) {
+	rows, err := database.Tenant(r.db, companyID).Query(`SELECT id FROM roles WHERE company_id = $1 AND require_two_factor ORDER BY name`, companyID)
+	if err != nil {
+		return nil, fmt.Errorf("error getting two-factor roles: %w", err)
+	}
+	defer rows.Close()
+
+	roleIDs := []string{}
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("error scanning two-factor role: %w", err)
+		}
+		roleIDs = append(roleIDs, id)
+	}
+	return roleIDs, rows.Err()
+}
+
+// SetTwoFactorRoles replaces the company 2FA policy: exactly the given roles require 2FA
+func (r *RoleRepository) SetTwoFactorRoles(companyID string, roleIDs []string) error {
+	if roleIDs == nil {
+		roleIDs = []string{}
+	}
+	_, err := database.Tenant(r.db, companyID).Exec(`
+		UPDATE roles SET require_two_factor = (id = ANY($2)), updated_at = NOW()
+		WHERE company_id = $1 AND require_two_factor <> (id = ANY($2))`, companyID, pq.Array(roleIDs))
+	if err != nil {
+		return fmt.Errorf("error updating two-factor policy: %w", err)
+	}
+	return nil
+}
+
+// IsTwoFactorRequired reports whether any role the user holds in the company requires 2FA:
+// the primary role, company-wide roles or roles bound to branch assignments
+func (r *RoleRepository) IsTwoFactorRequired(userID int, companyID string) (bool, error) {
+	var required bool
+	err := database.Tenant(r.db, companyID).QueryRow(`
+		SELECT EXISTS (
+			SELECT 1 FROM roles r
+			WHERE r.company_id = $2 AND r.require_two_factor AND (
+				r.id = (SELECT role_id FROM users WHERE id = $1)
+				OR r.id IN (SELECT role_id FROM user_roles WHERE user_id = $1 AND company_id = $2)
+				OR r.id IN (SELECT role_id FROM user_branches WHERE user_id = $1 AND role_id IS NOT NULL)
+			)
+		)`, userID, companyID).Scan(&required)
+	if err != nil {
+		return false, fmt.Errorf("error checking two-factor policy: %w", err)
+	}
+	return required, nil
+}
+
 // GetUserRoles gets all roles for a user in a company
 func (r *RoleRepository) GetUserRoles(userID int, companyID string) ([]*models.Role, error) {
 	query := `
-		SELECT r.id, r.name, r.description, r.company_id, r.created_at, r.updated_at
+		SELECT r.id, r.name, r.description, r.company_id, r.require_two_factor, r.created_at, r.updated_at
 		FROM roles r
 		INNER JOIN user_roles ur ON r.id = ur.role_id
 		WHERE ur.user_id = $1 AND ur.company_id = $2
 		ORDER BY r.name
 	`
 
-	rows, err := r.db.Query(query, userID, companyID)
+	rows, err := database.Tenant(r.db, companyID).Query(query, userID, companyID)
 	if err != nil {
 		return nil, fmt.Errorf("error getting user roles: %w", err)
 	}
@@ -248,7 +341,7 @@ func (r *RoleRepository) GetUserRoles(userID int, companyID string) ([]*models.R
 		role := &models.Role{}
 		err := rows.Scan(
 			&role.ID, &role.Name, &role.Description, &role.CompanyID,
-			&role.CreatedAt, &role.UpdatedAt,
+			&role.RequireTwoFactor, &role.CreatedAt, &role.UpdatedAt,
 		)
 		if err != nil {
 			return nil, fmt.Errorf("error scanning role: %w", err)
@@ -270,7 +363,7 @@ func (r *RoleRepository) GetUserPermissions(userID int, companyID string) ([]str
 		ORDER BY p.name
 	`
 
-	rows, err := r.db.Query(query, userID, companyID)
+	rows, err := database.Tenant(r.db, companyID).Query(query, userID, companyID)
 	if err != nil {
 		return nil, fmt.Errorf("error getting user permissions: %w", err)
 	}
@@ -289,6 +382,34 @@ func (r *RoleRepository) GetUserPermissions(userID int, companyID string) ([]str
 	return permissions, nil
 }
 
+// GetUserPermissionScopes returns the data scope of each permission granted through the
+// user's company-wide roles. When several roles grant a permission the widest scope wins.
+func (r *RoleRepository) GetUserPermissionScopes(userID int, companyID string) (map[string]string, error) {
+	query := `
+		SELECT p.name, rp.scope
+		FROM permissions p
+		INNER JOIN role_permissions rp ON p.id = rp.permission_id
+		INNER JOIN user_roles ur ON rp.role_id = ur.role_id
+		WHERE ur.user_id = $1 AND ur.company_id = $2
+	`
+
+	rows, err := database.Tenant(r.db, companyID).Query(query, userID, companyID)
+	if err != nil {
+		return nil, fmt.Errorf("error getting user permission scopes: %w", err)
+	}
+	defer rows.Close()
+
+	scopes := make(map[string]string)
+	for rows.Next() {
+		var permName, scope string
+		if err := rows.Scan(&permName, &scope); err != nil {
+			return nil, fmt.Errorf("error scanning permission scope: %w", err)
+		}
+		scopes[permName] = models.WiderScope(scopes[permName], scope)
+	}
+	return scopes, rows.Err()
+}
+
 // CheckUserPermission checks if a user has a specific permission
 func (r *RoleRepository) CheckUserPermission(userID int, companyID string, permissionName string) (bool, error) {
 	query := `
@@ -300,10 +421,49 @@ func (r *RoleRepository) CheckUserPermission(userID int, companyID string, permi
 	`
 
 	var hasPermission bool
-	err := r.db.QueryRow(query, userID, companyID, permissionName).Scan(&hasPermission)
+	err := database.Tenant(r.db, companyID).QueryRow(query, userID, companyID, permissionName).Scan(&hasPermission)
 	if err != nil {
 		return false, fmt.Errorf("error checking user permission: %w", err)
 	}
 
 	return hasPermission, nil
 }
+
+// GetUserBranchRoles returns, per branch, the role bound to the user's branch assignment
+// together with its permission names. Assignments without a role are omitted.
+func (r *RoleRepository) GetUserBranchRoles(userID int, companyID string) (map[string]*models.BranchRoleGrant, error) {
+	query := `
+		SELECT ub.branch_id, ro.id, ro.name, p.name, rp.scope
+		FROM user_branches ub
+		INNER JOIN roles ro ON ro.id = ub.role_id
+		LEFT JOIN role_permissions rp ON rp.role_id = ro.id
+		LEFT JOIN permissions p ON p.id = rp.permission_id
+		WHERE ub.user_id = $1 AND ub.company_id = $2
+		ORDER BY ub.branch_id, p.name
+	`
+
+	rows, err := database.Tenant(r.db, companyID).Query(query, userID, companyID)
+	if err != nil {
+		return nil, fmt.Errorf("error getting user branch roles: %w", err)
+	}
+	defer rows.Close()
+
+	grants := make(map[string]*models.BranchRoleGrant)
+	for rows.Next() {
+		var branchID, roleID, roleName string
+		var permName, scope sql.NullString
+		if err := rows.Scan(&branchID, &roleID, &roleName, &permName, &scope); err != nil {
+			return nil, fmt.Errorf("error scanning branch role: %w", err)
+		}
+		grant, ok := grants[branchID]
+		if !ok {
+			grant = &models.BranchRoleGrant{BranchID: branchID, RoleID: roleID, RoleName: roleName, Permissions: []string{}, Scopes: map[string]string{}}
+			grants[branchID] = grant
+		}
+		if permName.Valid {
+			grant.Permissions = append(grant.Permissions, permName.String)
+			grant.Scopes[permName.String] = scope.String
+		}
+	}
+	return grants, rows.Err()
+}
@@ -1,6 +1,7 @@
 package repository
 
 import (
+	"classmate-central/internal/database"
 	"classmate-central/internal/models"
 	"database/sql"
 	"fmt"
@@ -50,7 +51,7 @@ func (r *RoomRepository) GetAllByBranches(companyID string, branchIDs []string)
 			args[i+1] = bid
 		}
 	}
-	rows, err := r.db.Query(query, args...)
+	rows, err := database.Tenant(r.db, companyID).Query(query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -71,7 +72,7 @@ func (r *RoomRepository) GetAllByBranches(companyID string, branchIDs []string)
 func (r *RoomRepository) GetByID(id string, companyID string) (*models.Room, error) {
 	query := `SELECT id, name, capacity, color, status FROM rooms WHERE id = $1 AND company_id = $2`
 	var room models.Room
-	err := r.db.QueryRow(query, id, companyID).Scan(&room.ID, &room.Name, &room.Capacity, &room.Color, &room.Status)
+	err := database.Tenant(r.db, companyID).QueryRow(query, id, companyID).Scan(&room.ID, &room.Name, &room.Capacity, &room.Color, &room.Status)
 	if err != nil {
 		return nil, err
 	}
@@ -80,18 +81,18 @@ func (r *RoomRepository) GetByID(id string, companyID string) (*models.Room, err
 
 func (r *RoomRepository) Create(room *models.Room, companyID, branchID string) error {
 	query := `INSERT INTO rooms (id, name, capacity, color, status, company_id, branch_id) VALUES ($1, $2, $3, $4, $5, $6, $7)`
-	_, err := r.db.Exec(query, room.ID, room.Name, room.Capacity, room.Color, room.Status, companyID, branchID)
+	_, err := database.Tenant(r.db, companyID).Exec(query, room.ID, room.Name, room.Capacity, room.Color, room.Status, companyID, branchID)
 	return err
 }
 
 func (r *RoomRepository) Update(room *models.Room, companyID string) error {
 	query := `UPDATE rooms SET name = $1, capacity = $2, color = $3, status = $4 WHERE id = $5 AND company_id = $6`
-	_, err := r.db.Exec(query, room.Name, room.Capacity, room.Color, room.Status, room.ID, companyID)
+	_, err := database.Tenant(r.db, companyID).Exec(query, room.Name, room.Capacity, room.Color, room.Status, room.ID, companyID)
 	return err
 }
 
 func (r *RoomRepository) Delete(id string, companyID string) error {
 	query := `DELETE FROM rooms WHERE id = $1 AND company_id = $2`
-	_, err := r.db.Exec(query, id, companyID)
+	_, err := database.Tenant(r.db, companyID).Exec(query, id, companyID)
 	return err
 }
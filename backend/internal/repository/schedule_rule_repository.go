@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"time"
 
+	"classmate-central/internal/database"
 	"classmate-central/internal/models"
 )
 
@@ -22,7 +23,7 @@ func (r *ScheduleRuleRepository) Create(rule *models.ScheduleRule, companyID str
 		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
 		RETURNING id, created_at, updated_at
 	`
-	err := r.db.QueryRow(
+	err := database.Tenant(r.db, companyID).QueryRow(
 		query,
 		rule.OwnerType,
 		rule.OwnerID,
@@ -47,7 +48,7 @@ func (r *ScheduleRuleRepository) GetByID(id int64, companyID string) (*models.Sc
 
 	query := `SELECT id, owner_type, owner_id, rrule, dtstart, dtend, duration_minutes, timezone, location, company_id, created_at, updated_at 
 	          FROM schedule_rule WHERE id = $1 AND company_id = $2`
-	err := r.db.QueryRow(query, id, companyID).Scan(
+	err := database.Tenant(r.db, companyID).QueryRow(query, id, companyID).Scan(
 		&rule.ID,
 		&rule.OwnerType,
 		&rule.OwnerID,
@@ -85,7 +86,7 @@ func (r *ScheduleRuleRepository) GetByOwner(ownerType, ownerID string, companyID
 		WHERE owner_type = $1 AND owner_id = $2 AND company_id = $3
 		ORDER BY dtstart DESC
 	`
-	rows, err := r.db.Query(query, ownerType, ownerID, companyID)
+	rows, err := database.Tenant(r.db, companyID).Query(query, ownerType, ownerID, companyID)
 	if err != nil {
 		return nil, fmt.Errorf("error getting schedule rules: %w", err)
 	}
@@ -136,7 +137,7 @@ func (r *ScheduleRuleRepository) GetActiveRules(companyID string) ([]*models.Sch
 		WHERE company_id = $1 AND (dtend IS NULL OR dtend > $2)
 		ORDER BY dtstart DESC
 	`
-	rows, err := r.db.Query(query, companyID, now)
+	rows, err := database.Tenant(r.db, companyID).Query(query, companyID, now)
 	if err != nil {
 		return nil, fmt.Errorf("error getting active schedule rules: %w", err)
 	}
@@ -185,7 +186,7 @@ func (r *ScheduleRuleRepository) Update(rule *models.ScheduleRule, companyID str
 		SET owner_type = $2, owner_id = $3, rrule = $4, dtstart = $5, dtend = $6, duration_minutes = $7, timezone = $8, location = $9, updated_at = CURRENT_TIMESTAMP
 		WHERE id = $1 AND company_id = $10
 	`
-	_, err := r.db.Exec(
+	_, err := database.Tenant(r.db, companyID).Exec(
 		query,
 		rule.ID,
 		rule.OwnerType,
@@ -206,7 +207,7 @@ func (r *ScheduleRuleRepository) Update(rule *models.ScheduleRule, companyID str
 
 func (r *ScheduleRuleRepository) Delete(id int64, companyID string) error {
 	query := `DELETE FROM schedule_rule WHERE id = $1 AND company_id = $2`
-	_, err := r.db.Exec(query, id, companyID)
+	_, err := database.Tenant(r.db, companyID).Exec(query, id, companyID)
 	if err != nil {
 		return fmt.Errorf("error deleting schedule rule: %w", err)
 	}
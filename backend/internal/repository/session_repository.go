@@ -0,0 +1,398 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"classmate-central/internal/database"
+	"classmate-central/internal/models"
+)
+
+// ErrRefreshTokenInvalid is returned when a refresh token is unknown, expired or belongs to a closed session
+var ErrRefreshTokenInvalid = errors.New("refresh token is invalid")
+
+// ErrRefreshTokenReused is returned when an already rotated refresh token is presented again.
+// The whole session is revoked before this error is returned.
+var ErrRefreshTokenReused = errors.New("refresh token has already been used")
+
+// Session revoke reasons
+const (
+	SessionRevokeLogout = "logout"
+	SessionRevokeUser   = "revoked"
+	SessionRevokeAdmin  = "admin"
+	SessionRevokeReuse  = "token_reuse"
+	// SessionRevokePassword closes sessions after a password change or reset
+	SessionRevokePassword = "password_change"
+)
+
+// sessionTouchInterval limits how often last_seen_at is written for one session
+const sessionTouchInterval = time.Minute
+
+type SessionRepository struct {
+	db *sql.DB
+}
+
+func NewSessionRepository(db *sql.DB) *SessionRepository {
+	return &SessionRepository{db: db}
+}
+
+const sessionColumns = `id, user_id, company_id, current_branch_id, user_agent, ip,
+	created_at, last_seen_at, expires_at, revoked_at, revoke_reason, two_factor_verified_at,
+	impersonated_by, impersonation_reason`
+
+func scanSession(row interface{ Scan(...interface{}) error }) (*models.UserSession, error) {
+	session := &models.UserSession{}
+	var branchID, reason, impersonationReason sql.NullString
+	var revokedAt, twoFactorVerifiedAt sql.NullTime
+	var impersonatedBy sql.NullInt64
+	err := row.Scan(&session.ID, &session.UserID, &session.CompanyID, &branchID, &session.UserAgent, &session.IP,
+		&session.CreatedAt, &session.LastSeenAt, &session.ExpiresAt, &revokedAt, &reason, &twoFactorVerifiedAt,
+		&impersonatedBy, &impersonationReason)
+	if err != nil {
+		return nil, err
+	}
+	session.CurrentBranchID = nullStringPtr(branchID)
+	session.RevokeReason = nullStringPtr(reason)
+	if revokedAt.Valid {
+		session.RevokedAt = &revokedAt.Time
+	}
+	if twoFactorVerifiedAt.Valid {
+		session.TwoFactorVerifiedAt = &twoFactorVerifiedAt.Time
+	}
+	session.ImpersonatedBy = nullableInt(impersonatedBy)
+	session.ImpersonationReason = nullStringPtr(impersonationReason)
+	return session, nil
+}
+
+// Create stores a new session together with its first refresh token
+func (r *SessionRepository) Create(session *models.UserSession, tokenHash string) error {
+	dbTx, err := database.System(r.db).Begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer dbTx.Rollback()
+
+	err = dbTx.QueryRow(`
+		INSERT INTO user_sessions (id, user_id, company_id, current_branch_id, user_agent, ip, expires_at, two_factor_verified_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING created_at, last_seen_at, (SELECT context_version FROM users WHERE id = $2)`,
+		session.ID, session.UserID, session.CompanyID, session.CurrentBranchID, session.UserAgent, session.IP, session.ExpiresAt,
+		session.TwoFactorVerifiedAt,
+	).Scan(&session.CreatedAt, &session.LastSeenAt, &session.ContextVersion)
+	if err != nil {
+		return fmt.Errorf("error creating session: %w", err)
+	}
+
+	if err := insertRefreshToken(dbTx, session.ID, tokenHash, session.ExpiresAt); err != nil {
+		return err
+	}
+
+	if err := dbTx.Commit(); err != nil {
+		return fmt.Errorf("error committing session: %w", err)
+	}
+	return nil
+}
+
+// CreateImpersonation stores a session a platform admin (actor.UserID) opens to act as a user of
+// actor.CompanyID, and records it in that company's audit log. Impersonation sessions have no
+// refresh token.
+func (r *SessionRepository) CreateImpersonation(session *models.UserSession, actor database.Actor) error {
+	return database.WithActor(r.db, actor, func(tx *sql.Tx) error {
+		err := tx.QueryRow(`
+			INSERT INTO user_sessions (id, user_id, company_id, user_agent, ip, expires_at, impersonated_by, impersonation_reason)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+			RETURNING created_at, last_seen_at, (SELECT context_version FROM users WHERE id = $2)`,
+			session.ID, session.UserID, session.CompanyID, session.UserAgent, session.IP, session.ExpiresAt,
+			session.ImpersonatedBy, session.ImpersonationReason,
+		).Scan(&session.CreatedAt, &session.LastSeenAt, &session.ContextVersion)
+		if err != nil {
+			return fmt.Errorf("error creating impersonation session: %w", err)
+		}
+
+		entry := companyDataAuditEntry(actor, "impersonate_user", map[string]interface{}{
+			"sessionId": session.ID,
+			"reason":    session.ImpersonationReason,
+			"expiresAt": session.ExpiresAt,
+		})
+		userID := strconv.Itoa(session.UserID)
+		entry.EntityType = "user"
+		entry.EntityID = &userID
+		return recordAudit(tx, entry)
+	})
+}
+
+func insertRefreshToken(dbTx *sql.Tx, sessionID, tokenHash string, expiresAt time.Time) error {
+	_, err := dbTx.Exec(`INSERT INTO refresh_tokens (session_id, token_hash, expires_at) VALUES ($1, $2, $3)`,
+		sessionID, tokenHash, expiresAt)
+	if err != nil {
+		return fmt.Errorf("error storing refresh token: %w", err)
+	}
+	return nil
+}
+
+// Rotate exchanges a refresh token for a new one and extends the session.
+// Presenting a token that was already rotated revokes the session and returns ErrRefreshTokenReused.
+func (r *SessionRepository) Rotate(oldHash, newHash string, expiresAt time.Time, ip string) (*models.UserSession, error) {
+	dbTx, err := database.System(r.db).Begin()
+	if err != nil {
+		return nil, fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer dbTx.Rollback()
+
+	var tokenID int
+	var sessionID string
+	var usedAt sql.NullTime
+	var tokenExpiresAt time.Time
+	err = dbTx.QueryRow(`
+		SELECT id, session_id, used_at, expires_at FROM refresh_tokens
+		WHERE token_hash = $1
+		FOR UPDATE`, oldHash).Scan(&tokenID, &sessionID, &usedAt, &tokenExpiresAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrRefreshTokenInvalid
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error loading refresh token: %w", err)
+	}
+
+	session, err := scanSession(dbTx.QueryRow(`SELECT `+sessionColumns+` FROM user_sessions WHERE id = $1 FOR UPDATE`, sessionID))
+	if err != nil {
+		return nil, fmt.Errorf("error loading session: %w", err)
+	}
+	now := time.Now()
+	if session.RevokedAt != nil || !session.ExpiresAt.After(now) {
+		return nil, ErrRefreshTokenInvalid
+	}
+
+	if usedAt.Valid {
+		// The token was stolen or replayed: close the whole session so that neither copy works
+		if _, err := dbTx.Exec(`UPDATE user_sessions SET revoked_at = CURRENT_TIMESTAMP, revoke_reason = $2 WHERE id = $1`,
+			sessionID, SessionRevokeReuse); err != nil {
+			return nil, fmt.Errorf("error revoking session: %w", err)
+		}
+		if err := dbTx.Commit(); err != nil {
+			return nil, fmt.Errorf("error committing session revocation: %w", err)
+		}
+		return session, ErrRefreshTokenReused
+	}
+	if !tokenExpiresAt.After(now) {
+		return nil, ErrRefreshTokenInvalid
+	}
+
+	if _, err := dbTx.Exec(`UPDATE refresh_tokens SET used_at = CURRENT_TIMESTAMP WHERE id = $1`, tokenID); err != nil {
+		return nil, fmt.Errorf("error marking refresh token as used: %w", err)
+	}
+	if err := insertRefreshToken(dbTx, sessionID, newHash, expiresAt); err != nil {
+		return nil, err
+	}
+	err = dbTx.QueryRow(`
+		UPDATE user_sessions
+		SET expires_at = $2, ip = $3, last_seen_at = CURRENT_TIMESTAMP
+		WHERE id = $1
+		RETURNING last_seen_at, (SELECT context_version FROM users WHERE id = user_id)`, sessionID, expiresAt, ip).Scan(&session.LastSeenAt, &session.ContextVersion)
+	if err != nil {
+		return nil, fmt.Errorf("error extending session: %w", err)
+	}
+	session.ExpiresAt = expiresAt
+	session.IP = ip
+
+	if err := dbTx.Commit(); err != nil {
+		return nil, fmt.Errorf("error committing refresh token rotation: %w", err)
+	}
+	return session, nil
+}
+
+// SwitchBranch stores the current branch of a session and replaces its unused refresh tokens.
+// Impersonation sessions are switched with SwitchImpersonationBranch.
+func (r *SessionRepository) SwitchBranch(id string, userID int, branchID, tokenHash string, expiresAt time.Time) error {
+	dbTx, err := database.System(r.db).Begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer dbTx.Rollback()
+
+	result, err := dbTx.Exec(`
+		UPDATE user_sessions SET current_branch_id = $3, expires_at = $4
+		WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL AND expires_at > CURRENT_TIMESTAMP
+		  AND impersonated_by IS NULL`,
+		id, userID, branchID, expiresAt)
+	if err != nil {
+		return fmt.Errorf("error updating session branch: %w", err)
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error checking session update: %w", err)
+	}
+	if rows == 0 {
+		return sql.ErrNoRows
+	}
+
+	if _, err := dbTx.Exec(`DELETE FROM refresh_tokens WHERE session_id = $1 AND used_at IS NULL`, id); err != nil {
+		return fmt.Errorf("error removing previous refresh tokens: %w", err)
+	}
+	if err := insertRefreshToken(dbTx, id, tokenHash, expiresAt); err != nil {
+		return err
+	}
+
+	if err := dbTx.Commit(); err != nil {
+		return fmt.Errorf("error committing branch switch: %w", err)
+	}
+	return nil
+}
+
+// SessionState is what AuthMiddleware needs to know about a session on every request
+type SessionState struct {
+	Active          bool
+	CurrentBranchID *string
+	ContextVersion  int // users.context_version, bumped when roles or branches change
+	// TwoFactorVerifiedAt is when the session last confirmed the second factor; nil if never
+	TwoFactorVerifiedAt *time.Time
+	// ImpersonatedBy is the platform admin using the session; nil for the user's own sessions
+	ImpersonatedBy *int
+}
+
+// Touch returns the state of a session (nil if it does not exist) and records activity
+// at most once per sessionTouchInterval
+func (r *SessionRepository) Touch(id string, userID int) (*SessionState, error) {
+	state := &SessionState{}
+	var branchID sql.NullString
+	var twoFactorVerifiedAt sql.NullTime
+	var impersonatedBy sql.NullInt64
+	var stale bool
+	err := database.System(r.db).QueryRow(`
+		SELECT s.revoked_at IS NULL AND s.expires_at > CURRENT_TIMESTAMP,
+		       s.last_seen_at < CURRENT_TIMESTAMP - $3 * INTERVAL '1 second',
+		       s.current_branch_id, u.context_version, s.two_factor_verified_at, s.impersonated_by
+		FROM user_sessions s
+		JOIN users u ON u.id = s.user_id
+		WHERE s.id = $1 AND s.user_id = $2`, id, userID, int(sessionTouchInterval.Seconds())).
+		Scan(&state.Active, &stale, &branchID, &state.ContextVersion, &twoFactorVerifiedAt, &impersonatedBy)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error loading session: %w", err)
+	}
+	state.CurrentBranchID = nullStringPtr(branchID)
+	if twoFactorVerifiedAt.Valid {
+		state.TwoFactorVerifiedAt = &twoFactorVerifiedAt.Time
+	}
+	state.ImpersonatedBy = nullableInt(impersonatedBy)
+	if state.Active && stale {
+		if _, err := database.System(r.db).Exec(`UPDATE user_sessions SET last_seen_at = CURRENT_TIMESTAMP WHERE id = $1`, id); err != nil {
+			return nil, fmt.Errorf("error updating session activity: %w", err)
+		}
+	}
+	return state, nil
+}
+
+// SwitchImpersonationBranch stores the current branch of an open impersonation session and
+// returns when the session expires; the expiry is never extended
+func (r *SessionRepository) SwitchImpersonationBranch(id string, userID int, branchID string) (time.Time, error) {
+	var expiresAt time.Time
+	err := database.System(r.db).QueryRow(`
+		UPDATE user_sessions SET current_branch_id = $3
+		WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL AND expires_at > CURRENT_TIMESTAMP
+		  AND impersonated_by IS NOT NULL
+		RETURNING expires_at`, id, userID, branchID).Scan(&expiresAt)
+	if err == sql.ErrNoRows {
+		return time.Time{}, err
+	}
+	if err != nil {
+		return time.Time{}, fmt.Errorf("error updating session branch: %w", err)
+	}
+	return expiresAt, nil
+}
+
+// MarkTwoFactorVerified records that an open session has just confirmed the second factor
+func (r *SessionRepository) MarkTwoFactorVerified(id string, userID int) error {
+	result, err := database.System(r.db).Exec(`
+		UPDATE user_sessions SET two_factor_verified_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL AND expires_at > CURRENT_TIMESTAMP`, id, userID)
+	if err != nil {
+		return fmt.Errorf("error recording two-factor verification: %w", err)
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error checking session update: %w", err)
+	}
+	if rows == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// ListActive returns the open sessions of a user, most recently used first
+func (r *SessionRepository) ListActive(userID int, companyID string) ([]*models.UserSession, error) {
+	rows, err := database.Tenant(r.db, companyID).Query(`
+		SELECT `+sessionColumns+` FROM user_sessions
+		WHERE user_id = $1 AND company_id = $2 AND revoked_at IS NULL AND expires_at > CURRENT_TIMESTAMP
+		ORDER BY last_seen_at DESC`, userID, companyID)
+	if err != nil {
+		return nil, fmt.Errorf("error listing sessions: %w", err)
+	}
+	defer rows.Close()
+
+	sessions := []*models.UserSession{}
+	for rows.Next() {
+		session, err := scanSession(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning session: %w", err)
+		}
+		sessions = append(sessions, session)
+	}
+	return sessions, rows.Err()
+}
+
+// Revoke closes one open session of a user
+func (r *SessionRepository) Revoke(id string, userID int, companyID, reason string) error {
+	result, err := database.Tenant(r.db, companyID).Exec(`
+		UPDATE user_sessions SET revoked_at = CURRENT_TIMESTAMP, revoke_reason = $4
+		WHERE id = $1 AND user_id = $2 AND company_id = $3 AND revoked_at IS NULL`, id, userID, companyID, reason)
+	if err != nil {
+		return fmt.Errorf("error revoking session: %w", err)
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error checking revoke result: %w", err)
+	}
+	if rows == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// RevokeAllForUser closes every open session of a user except exceptID (may be empty)
+func (r *SessionRepository) RevokeAllForUser(userID int, companyID, exceptID, reason string) (int64, error) {
+	result, err := database.Tenant(r.db, companyID).Exec(`
+		UPDATE user_sessions SET revoked_at = CURRENT_TIMESTAMP, revoke_reason = $4
+		WHERE user_id = $1 AND company_id = $2 AND id <> $3 AND revoked_at IS NULL`, userID, companyID, exceptID, reason)
+	if err != nil {
+		return 0, fmt.Errorf("error revoking sessions: %w", err)
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("error checking revoke result: %w", err)
+	}
+	return rows, nil
+}
+
+// DeleteExpired removes sessions that were closed or expired before the given time,
+// and rotated refresh tokens that have expired anyway.
+func (r *SessionRepository) DeleteExpired(before time.Time) (int64, error) {
+	result, err := database.System(r.db).Exec(`DELETE FROM user_sessions WHERE COALESCE(revoked_at, expires_at) < $1`, before)
+	if err != nil {
+		return 0, fmt.Errorf("error deleting expired sessions: %w", err)
+	}
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("error checking delete result: %w", err)
+	}
+
+	if _, err := database.System(r.db).Exec(`DELETE FROM refresh_tokens WHERE expires_at < CURRENT_TIMESTAMP`); err != nil {
+		return deleted, fmt.Errorf("error deleting expired refresh tokens: %w", err)
+	}
+	return deleted, nil
+}
@@ -0,0 +1,221 @@
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"classmate-central/internal/database"
+	"classmate-central/internal/models"
+
+	"github.com/lib/pq"
+)
+
+type SSORepository struct {
+	db *sql.DB
+}
+
+func NewSSORepository(db *sql.DB) *SSORepository {
+	return &SSORepository{db: db}
+}
+
+const ssoConfigColumns = `company_id, issuer, client_id, client_secret, allowed_domains, default_role_id,
+	default_branch_id, enabled, created_at, updated_at`
+
+func scanSSOConfig(row interface{ Scan(...interface{}) error }) (*models.SSOConfig, error) {
+	cfg := &models.SSOConfig{}
+	var roleID, branchID sql.NullString
+	err := row.Scan(&cfg.CompanyID, &cfg.Issuer, &cfg.ClientID, &cfg.ClientSecret, pq.Array(&cfg.AllowedDomains),
+		&roleID, &branchID, &cfg.Enabled, &cfg.CreatedAt, &cfg.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	cfg.DefaultRoleID = nullStringPtr(roleID)
+	cfg.DefaultBranchID = nullStringPtr(branchID)
+	cfg.HasClientSecret = cfg.ClientSecret != ""
+	return cfg, nil
+}
+
+// GetConfig returns the SSO configuration of a company, nil if it has none
+func (r *SSORepository) GetConfig(companyID string) (*models.SSOConfig, error) {
+	cfg, err := scanSSOConfig(database.Tenant(r.db, companyID).QueryRow(`SELECT `+ssoConfigColumns+` FROM company_sso_configs WHERE company_id = $1`, companyID))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error getting SSO config: %w", err)
+	}
+	return cfg, nil
+}
+
+// GetEnabledConfigByDomain returns the enabled SSO configuration that allows the email domain
+func (r *SSORepository) GetEnabledConfigByDomain(domain string) (*models.SSOConfig, error) {
+	cfg, err := scanSSOConfig(database.System(r.db).QueryRow(`
+		SELECT `+ssoConfigColumns+` FROM company_sso_configs
+		WHERE enabled AND $1 = ANY(allowed_domains)
+		ORDER BY created_at
+		LIMIT 1`, domain))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error getting SSO config by domain: %w", err)
+	}
+	return cfg, nil
+}
+
+// DomainsClaimedByOthers returns which of the domains another company already uses for SSO
+func (r *SSORepository) DomainsClaimedByOthers(companyID string, domains []string) ([]string, error) {
+	rows, err := database.Tenant(r.db, companyID).Query(`
+		SELECT DISTINCT domain
+		FROM company_sso_configs, unnest(allowed_domains) AS domain
+		WHERE company_id <> $1 AND domain = ANY($2)`, companyID, pq.Array(domains))
+	if err != nil {
+		return nil, fmt.Errorf("error checking SSO domains: %w", err)
+	}
+	defer rows.Close()
+
+	claimed := []string{}
+	for rows.Next() {
+		var domain string
+		if err := rows.Scan(&domain); err != nil {
+			return nil, fmt.Errorf("error scanning SSO domain: %w", err)
+		}
+		claimed = append(claimed, domain)
+	}
+	return claimed, rows.Err()
+}
+
+// SaveConfig creates or replaces the SSO configuration of a company
+func (r *SSORepository) SaveConfig(cfg *models.SSOConfig) error {
+	err := database.Tenant(r.db, cfg.CompanyID).QueryRow(`
+		INSERT INTO company_sso_configs (company_id, issuer, client_id, client_secret, allowed_domains,
+			default_role_id, default_branch_id, enabled)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		ON CONFLICT (company_id) DO UPDATE SET
+			issuer = EXCLUDED.issuer,
+			client_id = EXCLUDED.client_id,
+			client_secret = EXCLUDED.client_secret,
+			allowed_domains = EXCLUDED.allowed_domains,
+			default_role_id = EXCLUDED.default_role_id,
+			default_branch_id = EXCLUDED.default_branch_id,
+			enabled = EXCLUDED.enabled,
+			updated_at = CURRENT_TIMESTAMP
+		RETURNING created_at, updated_at`,
+		cfg.CompanyID, cfg.Issuer, cfg.ClientID, cfg.ClientSecret, pq.Array(cfg.AllowedDomains),
+		cfg.DefaultRoleID, cfg.DefaultBranchID, cfg.Enabled,
+	).Scan(&cfg.CreatedAt, &cfg.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("error saving SSO config: %w", err)
+	}
+	cfg.HasClientSecret = cfg.ClientSecret != ""
+	return nil
+}
+
+// DeleteConfig removes the SSO configuration of a company; linked identities stay so that
+// re-enabling SSO finds the same users
+func (r *SSORepository) DeleteConfig(companyID string) error {
+	result, err := database.Tenant(r.db, companyID).Exec(`DELETE FROM company_sso_configs WHERE company_id = $1`, companyID)
+	if err != nil {
+		return fmt.Errorf("error deleting SSO config: %w", err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error checking delete result: %w", err)
+	}
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// CreateLoginState stores an authorization request by the hash of its state parameter
+func (r *SSORepository) CreateLoginState(stateHash string, state *models.SSOLoginState) error {
+	_, err := database.System(r.db).Exec(`
+		INSERT INTO sso_login_states (state_hash, company_id, nonce, code_verifier, expires_at)
+		VALUES ($1, $2, $3, $4, $5)`,
+		stateHash, state.CompanyID, state.Nonce, state.CodeVerifier, state.ExpiresAt)
+	if err != nil {
+		return fmt.Errorf("error creating SSO login state: %w", err)
+	}
+	return nil
+}
+
+// ConsumeLoginState deletes an authorization request and returns it; unknown and expired
+// states yield nil
+func (r *SSORepository) ConsumeLoginState(stateHash string) (*models.SSOLoginState, error) {
+	state := &models.SSOLoginState{}
+	err := database.System(r.db).QueryRow(`
+		DELETE FROM sso_login_states
+		WHERE state_hash = $1
+		RETURNING company_id, nonce, code_verifier, expires_at`, stateHash).
+		Scan(&state.CompanyID, &state.Nonce, &state.CodeVerifier, &state.ExpiresAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error consuming SSO login state: %w", err)
+	}
+	if !state.ExpiresAt.After(time.Now()) {
+		return nil, nil
+	}
+	return state, nil
+}
+
+// DeleteExpiredLoginStates removes authorization requests that were never completed
+func (r *SSORepository) DeleteExpiredLoginStates(before time.Time) (int64, error) {
+	result, err := database.System(r.db).Exec(`DELETE FROM sso_login_states WHERE expires_at < $1`, before)
+	if err != nil {
+		return 0, fmt.Errorf("error deleting expired SSO login states: %w", err)
+	}
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("error checking delete result: %w", err)
+	}
+	return deleted, nil
+}
+
+// GetIdentity returns the link of a provider account to a user, nil if there is none
+func (r *SSORepository) GetIdentity(issuer, subject string) (*models.UserIdentity, error) {
+	identity := &models.UserIdentity{}
+	var lastLoginAt sql.NullTime
+	err := database.System(r.db).QueryRow(`
+		SELECT id, user_id, company_id, issuer, subject, email, created_at, last_login_at
+		FROM user_identities
+		WHERE issuer = $1 AND subject = $2`, issuer, subject).
+		Scan(&identity.ID, &identity.UserID, &identity.CompanyID, &identity.Issuer, &identity.Subject,
+			&identity.Email, &identity.CreatedAt, &lastLoginAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error getting user identity: %w", err)
+	}
+	if lastLoginAt.Valid {
+		identity.LastLoginAt = &lastLoginAt.Time
+	}
+	return identity, nil
+}
+
+// CreateIdentity links a provider account to a user
+func (r *SSORepository) CreateIdentity(identity *models.UserIdentity) error {
+	err := database.System(r.db).QueryRow(`
+		INSERT INTO user_identities (user_id, company_id, issuer, subject, email, last_login_at)
+		VALUES ($1, $2, $3, $4, $5, CURRENT_TIMESTAMP)
+		RETURNING id, created_at, last_login_at`,
+		identity.UserID, identity.CompanyID, identity.Issuer, identity.Subject, identity.Email,
+	).Scan(&identity.ID, &identity.CreatedAt, &identity.LastLoginAt)
+	if err != nil {
+		return fmt.Errorf("error creating user identity: %w", err)
+	}
+	return nil
+}
+
+// TouchIdentity records a sign-in through the identity and the email the provider reported
+func (r *SSORepository) TouchIdentity(id int, email string) error {
+	_, err := database.System(r.db).Exec(`UPDATE user_identities SET last_login_at = CURRENT_TIMESTAMP, email = $2 WHERE id = $1`, id, email)
+	if err != nil {
+		return fmt.Errorf("error updating user identity: %w", err)
+	}
+	return nil
+}
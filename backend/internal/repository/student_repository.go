@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"strings"
 
+	"classmate-central/internal/database"
 	"classmate-central/internal/models"
 )
 
@@ -17,7 +18,7 @@ func NewStudentRepository(db *sql.DB) *StudentRepository {
 }
 
 func (r *StudentRepository) Create(student *models.Student, companyID string, branchID string) error {
-	tx, err := r.db.Begin()
+	tx, err := database.Tenant(r.db, companyID).Begin()
 	if err != nil {
 		return fmt.Errorf("error starting transaction: %w", err)
 	}
@@ -93,17 +94,17 @@ func (r *StudentRepository) GetAll(companyID string, branchID string) ([]*models
 	var args []interface{}
 	if branchID == "" {
 		// Get data from all branches for the company
-		query = `SELECT id, name, age, email, phone, status, avatar, created_at FROM students WHERE company_id = $1 ORDER BY name`
+		query = `SELECT id, name, age, email, phone, status, avatar, created_at FROM students WHERE company_id = $1 AND deleted_at IS NULL ORDER BY name`
 		args = []interface{}{companyID}
 	} else if branchID == companyID {
-		query = `SELECT id, name, age, email, phone, status, avatar, created_at FROM students WHERE company_id = $1 ORDER BY name`
+		query = `SELECT id, name, age, email, phone, status, avatar, created_at FROM students WHERE company_id = $1 AND deleted_at IS NULL ORDER BY name`
 		args = []interface{}{companyID}
 	} else {
-		query = `SELECT id, name, age, email, phone, status, avatar, created_at FROM students WHERE company_id = $1 AND branch_id = $2 ORDER BY name`
+		query = `SELECT id, name, age, email, phone, status, avatar, created_at FROM students WHERE company_id = $1 AND branch_id = $2 AND deleted_at IS NULL ORDER BY name`
 		args = []interface{}{companyID, branchID}
 	}
 
-	return r.getAllWithQuery(query, args)
+	return r.getAllWithQuery(companyID, query, args)
 }
 
 // GetAllByBranches gets students from specified accessible branches (for branch isolation)
@@ -122,7 +123,7 @@ func (r *StudentRepository) GetAllByBranches(companyID string, branchIDs []strin
 
 	if hasFallback && len(branchIDs) == 1 {
 		// Fallback mode: don't filter by branch_id
-		query = `SELECT id, name, age, email, phone, status, avatar, created_at FROM students WHERE company_id = $1 ORDER BY name`
+		query = `SELECT id, name, age, email, phone, status, avatar, created_at FROM students WHERE company_id = $1 AND deleted_at IS NULL ORDER BY name`
 		args = []interface{}{companyID}
 	} else {
 		// Filter by accessible branches only
@@ -130,7 +131,7 @@ func (r *StudentRepository) GetAllByBranches(companyID string, branchIDs []strin
 		for i := range branchIDs {
 			placeholders[i] = fmt.Sprintf("$%d", i+2)
 		}
-		query = fmt.Sprintf(`SELECT id, name, age, email, phone, status, avatar, created_at FROM students WHERE company_id = $1 AND branch_id IN (%s) ORDER BY name`, strings.Join(placeholders, ","))
+		query = fmt.Sprintf(`SELECT id, name, age, email, phone, status, avatar, created_at FROM students WHERE company_id = $1 AND branch_id IN (%s) AND deleted_at IS NULL ORDER BY name`, strings.Join(placeholders, ","))
 		args = make([]interface{}, len(branchIDs)+1)
 		args[0] = companyID
 		for i, bid := range branchIDs {
@@ -138,13 +139,13 @@ func (r *StudentRepository) GetAllByBranches(companyID string, branchIDs []strin
 		}
 	}
 
-	return r.getAllWithQuery(query, args)
+	return r.getAllWithQuery(companyID, query, args)
 }
 
 // getAllWithQuery is a helper to execute query and scan results
-func (r *StudentRepository) getAllWithQuery(query string, args []interface{}) ([]*models.Student, error) {
+func (r *StudentRepository) getAllWithQuery(companyID, query string, args []interface{}) ([]*models.Student, error) {
 
-	rows, err := r.db.Query(query, args...)
+	rows, err := database.Tenant(r.db, companyID).Query(query, args...)
 	if err != nil {
 		return nil, fmt.Errorf("error getting students: %w", err)
 	}
@@ -186,7 +187,7 @@ func (r *StudentRepository) getAllWithQuery(query string, args []interface{}) ([
 		student.GroupIds = []string{}
 
 		// Get subjects
-		subjectRows, err := r.db.Query(`SELECT subject FROM student_subjects WHERE student_id = $1`, student.ID)
+		subjectRows, err := database.Tenant(r.db, companyID).Query(`SELECT subject FROM student_subjects WHERE student_id = $1`, student.ID)
 		if err == nil {
 			defer subjectRows.Close()
 			for subjectRows.Next() {
@@ -198,7 +199,7 @@ func (r *StudentRepository) getAllWithQuery(query string, args []interface{}) ([
 		}
 
 		// Get groups from enrollment (active enrollments only)
-		groupRows, err := r.db.Query(`SELECT group_id FROM enrollment WHERE student_id = $1 AND left_at IS NULL`, student.ID)
+		groupRows, err := database.Tenant(r.db, companyID).Query(`SELECT group_id FROM enrollment WHERE student_id = $1 AND left_at IS NULL`, student.ID)
 		if err == nil {
 			defer groupRows.Close()
 			for groupRows.Next() {
@@ -222,49 +223,85 @@ func (r *StudentRepository) GetPaged(companyID, branchID, search string, page, p
 
 // GetPagedByBranches returns students from accessible branches with pagination
 func (r *StudentRepository) GetPagedByBranches(companyID string, branchIDs []string, search string, page, pageSize int) ([]*models.Student, int, error) {
-	offset := (page - 1) * pageSize
-	// Base where - filter by accessible branches
-	var where string
-	var args []interface{}
+	where, args := studentBranchWhere(companyID, branchIDs)
+	return r.getPaged(companyID, where, args, search, page, pageSize)
+}
 
-	// Check if branchIDs contains companyID (fallback mode)
-	hasFallback := false
-	for _, bid := range branchIDs {
-		if bid == companyID {
-			hasFallback = true
-			break
-		}
-	}
+// GetPagedForTeacher returns, with pagination, only the students the teacher teaches
+func (r *StudentRepository) GetPagedForTeacher(companyID string, branchIDs []string, teacherID, search string, page, pageSize int) ([]*models.Student, int, error) {
+	where, args := studentBranchWhere(companyID, branchIDs)
+	where += " AND " + taughtStudentsCondition(len(args)+1)
+	args = append(args, teacherID)
+	return r.getPaged(companyID, where, args, search, page, pageSize)
+}
 
-	if hasFallback && len(branchIDs) == 1 {
-		// Fallback mode: don't filter by branch_id
-		where = "WHERE company_id = $1"
-		args = []interface{}{companyID}
-	} else {
-		// Filter by accessible branches only
-		placeholders := make([]string, len(branchIDs))
-		for i := range branchIDs {
-			placeholders[i] = fmt.Sprintf("$%d", i+2)
-		}
-		where = fmt.Sprintf("WHERE company_id = $1 AND branch_id IN (%s)", strings.Join(placeholders, ","))
-		args = make([]interface{}, len(branchIDs)+1)
-		args[0] = companyID
-		for i, bid := range branchIDs {
-			args[i+1] = bid
-		}
+// GetAllForTeacher returns the students of the given branches the teacher teaches
+func (r *StudentRepository) GetAllForTeacher(companyID string, branchIDs []string, teacherID string) ([]*models.Student, error) {
+	where, args := studentBranchWhere(companyID, branchIDs)
+	where += " AND " + taughtStudentsCondition(len(args)+1)
+	args = append(args, teacherID)
+	return r.getAllWithQuery(companyID, `SELECT id, name, age, email, phone, status, avatar, created_at FROM students `+where+` ORDER BY name`, args)
+}
+
+// IsTaughtBy reports whether the teacher teaches the student (group, individual enrollment or lesson)
+func (r *StudentRepository) IsTaughtBy(studentID, teacherID, companyID string) (bool, error) {
+	var taught bool
+	query := `SELECT EXISTS (SELECT 1 FROM students WHERE id = $1 AND company_id = $2 AND deleted_at IS NULL AND ` + taughtStudentsCondition(3) + `)`
+	if err := database.Tenant(r.db, companyID).QueryRow(query, studentID, companyID, teacherID).Scan(&taught); err != nil {
+		return false, fmt.Errorf("error checking teacher of student: %w", err)
 	}
+	return taught, nil
+}
+
+// studentBranchWhere builds the WHERE clause limiting students to the company and branches,
+// leaving out deleted students.
+// A single branch equal to the company ID (fallback mode) does not filter by branch.
+func studentBranchWhere(companyID string, branchIDs []string) (string, []interface{}) {
+	if len(branchIDs) == 1 && branchIDs[0] == companyID {
+		return "WHERE company_id = $1 AND deleted_at IS NULL", []interface{}{companyID}
+	}
+	placeholders := make([]string, len(branchIDs))
+	args := make([]interface{}, len(branchIDs)+1)
+	args[0] = companyID
+	for i, bid := range branchIDs {
+		placeholders[i] = fmt.Sprintf("$%d", i+2)
+		args[i+1] = bid
+	}
+	return fmt.Sprintf("WHERE company_id = $1 AND branch_id IN (%s) AND deleted_at IS NULL", strings.Join(placeholders, ",")), args
+}
+
+// taughtStudentsCondition limits students to those taught by the teacher bound to
+// placeholder $param: active enrollments in the teacher's groups, active individual
+// enrollments with the teacher and students booked into the teacher's lessons.
+func taughtStudentsCondition(param int) string {
+	return fmt.Sprintf(`id IN (
+		SELECT e.student_id FROM enrollment e JOIN groups g ON g.id = e.group_id
+		WHERE g.teacher_id = $%[1]d AND e.left_at IS NULL
+		UNION
+		SELECT ie.student_id FROM individual_enrollment ie
+		WHERE ie.teacher_id = $%[1]d AND ie.ended_at IS NULL
+		UNION
+		SELECT ls.student_id FROM lesson_students ls JOIN lessons l ON l.id = ls.lesson_id
+		WHERE l.teacher_id = $%[1]d
+	)`, param)
+}
+
+// getPaged runs a paged, optionally searched student query over the given WHERE clause
+func (r *StudentRepository) getPaged(companyID, where string, args []interface{}, search string, page, pageSize int) ([]*models.Student, int, error) {
+	offset := (page - 1) * pageSize
 	if search != "" {
 		// Prepare LIKE for name/email and normalized digits-only for phone
 		like := "%" + strings.ToLower(search) + "%"
 		normalized := strings.NewReplacer(" ", "", "-", "", "(", "", ")", "").Replace(search)
-		where += " AND (LOWER(name) LIKE $3 OR LOWER(email) LIKE $3 OR REPLACE(REPLACE(REPLACE(REPLACE(phone,' ',''),'-',''),'(', ''),')','') LIKE $4)"
+		likeParam, phoneParam := len(args)+1, len(args)+2
+		where += fmt.Sprintf(" AND (LOWER(name) LIKE $%[1]d OR LOWER(email) LIKE $%[1]d OR REPLACE(REPLACE(REPLACE(REPLACE(phone,' ',''),'-',''),'(', ''),')','') LIKE $%[2]d)", likeParam, phoneParam)
 		args = append(args, like, "%"+normalized+"%")
 	}
 
 	// Total count
 	totalQuery := "SELECT COUNT(*) FROM students " + where
 	var total int
-	if err := r.db.QueryRow(totalQuery, args...).Scan(&total); err != nil {
+	if err := database.Tenant(r.db, companyID).QueryRow(totalQuery, args...).Scan(&total); err != nil {
 		return nil, 0, fmt.Errorf("error counting students: %w", err)
 	}
 
@@ -272,7 +309,7 @@ func (r *StudentRepository) GetPagedByBranches(companyID string, branchIDs []str
 	selectQuery := "SELECT id, name, age, email, phone, status, avatar, created_at FROM students " + where + " ORDER BY name LIMIT $" + fmt.Sprint(len(args)+1) + " OFFSET $" + fmt.Sprint(len(args)+2)
 	args = append(args, pageSize, offset)
 
-	rows, err := r.db.Query(selectQuery, args...)
+	rows, err := database.Tenant(r.db, companyID).Query(selectQuery, args...)
 	if err != nil {
 		return nil, 0, fmt.Errorf("error getting students: %w", err)
 	}
@@ -318,46 +355,28 @@ func (r *StudentRepository) GetCounts(companyID, branchID string) (active int, i
 
 // GetCountsByBranches gets counts from accessible branches
 func (r *StudentRepository) GetCountsByBranches(companyID string, branchIDs []string) (active int, inactive int, total int, err error) {
-	// Filter by accessible branches
-	var whereClause string
-	var args []interface{}
-
-	// Check if branchIDs contains companyID (fallback mode)
-	hasFallback := false
-	for _, bid := range branchIDs {
-		if bid == companyID {
-			hasFallback = true
-			break
-		}
-	}
+	whereClause, args := studentBranchWhere(companyID, branchIDs)
+	return r.getCounts(companyID, whereClause, args)
+}
 
-	if hasFallback && len(branchIDs) == 1 {
-		// Fallback mode: don't filter by branch_id
-		whereClause = "WHERE company_id = $1"
-		args = []interface{}{companyID}
-	} else {
-		// Filter by accessible branches only
-		placeholders := make([]string, len(branchIDs))
-		for i := range branchIDs {
-			placeholders[i] = fmt.Sprintf("$%d", i+2)
-		}
-		whereClause = fmt.Sprintf("WHERE company_id = $1 AND branch_id IN (%s)", strings.Join(placeholders, ","))
-		args = make([]interface{}, len(branchIDs)+1)
-		args[0] = companyID
-		for i, bid := range branchIDs {
-			args[i+1] = bid
-		}
-	}
+// GetCountsForTeacher counts only the students the teacher teaches
+func (r *StudentRepository) GetCountsForTeacher(companyID string, branchIDs []string, teacherID string) (active int, inactive int, total int, err error) {
+	whereClause, args := studentBranchWhere(companyID, branchIDs)
+	whereClause += " AND " + taughtStudentsCondition(len(args)+1)
+	args = append(args, teacherID)
+	return r.getCounts(companyID, whereClause, args)
+}
 
+func (r *StudentRepository) getCounts(companyID, whereClause string, args []interface{}) (active int, inactive int, total int, err error) {
 	// Total
-	if err = r.db.QueryRow(`SELECT COUNT(*) FROM students `+whereClause, args...).Scan(&total); err != nil {
+	if err = database.Tenant(r.db, companyID).QueryRow(`SELECT COUNT(*) FROM students `+whereClause, args...).Scan(&total); err != nil {
 		return
 	}
 	// Active (has upcoming lessons OR status active?) — per request, use status column
-	if err = r.db.QueryRow(`SELECT COUNT(*) FROM students `+whereClause+` AND status = 'active'`, args...).Scan(&active); err != nil {
+	if err = database.Tenant(r.db, companyID).QueryRow(`SELECT COUNT(*) FROM students `+whereClause+` AND status = 'active'`, args...).Scan(&active); err != nil {
 		return
 	}
-	if err = r.db.QueryRow(`SELECT COUNT(*) FROM students `+whereClause+` AND status != 'active'`, args...).Scan(&inactive); err != nil {
+	if err = database.Tenant(r.db, companyID).QueryRow(`SELECT COUNT(*) FROM students `+whereClause+` AND status != 'active'`, args...).Scan(&inactive); err != nil {
 		return
 	}
 	return
@@ -369,9 +388,9 @@ func (r *StudentRepository) GetByID(id string, companyID string) (*models.Studen
 	var age sql.NullInt32
 	var status sql.NullString
 
-	query := `SELECT id, name, age, email, phone, status, avatar FROM students WHERE id = $1 AND company_id = $2`
+	query := `SELECT id, name, age, email, phone, status, avatar FROM students WHERE id = $1 AND company_id = $2 AND deleted_at IS NULL`
 
-	err := r.db.QueryRow(query, id, companyID).Scan(&student.ID, &student.Name, &age, &student.Email, &student.Phone, &status, &avatar)
+	err := database.Tenant(r.db, companyID).QueryRow(query, id, companyID).Scan(&student.ID, &student.Name, &age, &student.Email, &student.Phone, &status, &avatar)
 	if err == sql.ErrNoRows {
 		return nil, nil
 	}
@@ -398,7 +417,7 @@ func (r *StudentRepository) GetByID(id string, companyID string) (*models.Studen
 	student.GroupIds = []string{}
 
 	// Get subjects
-	subjectRows, err := r.db.Query(`SELECT subject FROM student_subjects WHERE student_id = $1`, student.ID)
+	subjectRows, err := database.Tenant(r.db, companyID).Query(`SELECT subject FROM student_subjects WHERE student_id = $1`, student.ID)
 	if err == nil {
 		defer subjectRows.Close()
 		for subjectRows.Next() {
@@ -410,7 +429,7 @@ func (r *StudentRepository) GetByID(id string, companyID string) (*models.Studen
 	}
 
 	// Get groups from enrollment (active enrollments only)
-	groupRows, err := r.db.Query(`SELECT group_id FROM enrollment WHERE student_id = $1 AND left_at IS NULL`, student.ID)
+	groupRows, err := database.Tenant(r.db, companyID).Query(`SELECT group_id FROM enrollment WHERE student_id = $1 AND left_at IS NULL`, student.ID)
 	if err == nil {
 		defer groupRows.Close()
 		for groupRows.Next() {
@@ -425,7 +444,7 @@ func (r *StudentRepository) GetByID(id string, companyID string) (*models.Studen
 }
 
 func (r *StudentRepository) Update(student *models.Student, companyID string) error {
-	tx, err := r.db.Begin()
+	tx, err := database.Tenant(r.db, companyID).Begin()
 	if err != nil {
 		return fmt.Errorf("error starting transaction: %w", err)
 	}
@@ -435,7 +454,7 @@ func (r *StudentRepository) Update(student *models.Student, companyID string) er
 	query := `
 		UPDATE students 
 		SET name = $2, age = $3, email = $4, phone = $5, status = $6, avatar = $7
-		WHERE id = $1 AND company_id = $8
+		WHERE id = $1 AND company_id = $8 AND deleted_at IS NULL
 	`
 	status := student.Status
 	if status == "" {
@@ -494,10 +513,16 @@ func (r *StudentRepository) Update(student *models.Student, companyID string) er
 	return tx.Commit()
 }
 
-func (r *StudentRepository) Delete(id string, companyID string) error {
-	query := `DELETE FROM students WHERE id = $1 AND company_id = $2`
-
-	_, err := r.db.Exec(query, id, companyID)
+// Delete moves a student to the trash. Payments, attendance and balances stay in place.
+func (r *StudentRepository) Delete(id string, actor database.Actor) error {
+	query := `
+		UPDATE students SET deleted_at = NOW(), deleted_by = NULLIF($3, 0)
+		WHERE id = $1 AND company_id = $2 AND deleted_at IS NULL
+	`
+	err := database.WithActor(r.db, actor, func(tx *sql.Tx) error {
+		_, err := tx.Exec(query, id, actor.CompanyID, actor.UserID)
+		return err
+	})
 	if err != nil {
 		return fmt.Errorf("error deleting student: %w", err)
 	}
@@ -507,66 +532,72 @@ func (r *StudentRepository) Delete(id string, companyID string) error {
 
 // UpdateStatus updates the status of a student
 func (r *StudentRepository) UpdateStatus(studentID, status, companyID string) error {
-	query := `UPDATE students SET status = $1 WHERE id = $2 AND company_id = $3`
-	_, err := r.db.Exec(query, status, studentID, companyID)
+	query := `UPDATE students SET status = $1 WHERE id = $2 AND company_id = $3 AND deleted_at IS NULL`
+	_, err := database.Tenant(r.db, companyID).Exec(query, status, studentID, companyID)
 	if err != nil {
 		return fmt.Errorf("error updating student status: %w", err)
 	}
 	return nil
 }
 
-// AddNote adds a note about a student
-func (r *StudentRepository) AddNote(note *models.StudentNote) error {
+// AddNote adds a note about a company's student
+func (r *StudentRepository) AddNote(note *models.StudentNote, companyID string) error {
 	query := `
 		INSERT INTO student_notes (student_id, note, created_by, created_at)
 		VALUES ($1, $2, $3, CURRENT_TIMESTAMP)
 		RETURNING id, created_at
 	`
-	err := r.db.QueryRow(query, note.StudentID, note.Note, note.CreatedBy).Scan(&note.ID, &note.CreatedAt)
+	err := database.Tenant(r.db, companyID).QueryRow(query, note.StudentID, note.Note, note.CreatedBy).Scan(&note.ID, &note.CreatedAt)
 	if err != nil {
 		return fmt.Errorf("error adding student note: %w", err)
 	}
 	return nil
 }
 
-// GetNotes retrieves all notes for a student
-func (r *StudentRepository) GetNotes(studentID string) ([]*models.StudentNote, error) {
+// GetNotes retrieves all notes for a company's student
+func (r *StudentRepository) GetNotes(studentID, companyID string) ([]*models.StudentNote, error) {
 	query := `
 		SELECT id, student_id, note, created_by, created_at
 		FROM student_notes
-		WHERE student_id = $1
+		WHERE student_id = $1 AND company_id = $2
 		ORDER BY created_at DESC
 	`
 
-	rows, err := r.db.Query(query, studentID)
-	if err != nil {
-		return nil, fmt.Errorf("error getting student notes: %w", err)
-	}
-	defer rows.Close()
-
 	notes := []*models.StudentNote{}
-	for rows.Next() {
-		note := &models.StudentNote{}
-		var createdBy sql.NullInt32
-
-		err := rows.Scan(&note.ID, &note.StudentID, &note.Note, &createdBy, &note.CreatedAt)
+	err := database.WithTenant(r.db, companyID, func(tx *sql.Tx) error {
+		rows, err := tx.Query(query, studentID, companyID)
 		if err != nil {
-			return nil, fmt.Errorf("error scanning note: %w", err)
+			return fmt.Errorf("error getting student notes: %w", err)
 		}
+		defer rows.Close()
 
-		if createdBy.Valid {
-			val := int(createdBy.Int32)
-			note.CreatedBy = &val
-		}
+		for rows.Next() {
+			note := &models.StudentNote{}
+			var createdBy sql.NullInt32
+
+			err := rows.Scan(&note.ID, &note.StudentID, &note.Note, &createdBy, &note.CreatedAt)
+			if err != nil {
+				return fmt.Errorf("error scanning note: %w", err)
+			}
 
-		notes = append(notes, note)
+			if createdBy.Valid {
+				val := int(createdBy.Int32)
+				note.CreatedBy = &val
+			}
+
+			notes = append(notes, note)
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, err
 	}
 
 	return notes, nil
 }
 
-// GetAttendanceStats returns attendance statistics for a student
-func (r *StudentRepository) GetAttendanceStats(studentID string) (*models.AttendanceStats, error) {
+// GetAttendanceStats returns attendance statistics for a company's student
+func (r *StudentRepository) GetAttendanceStats(studentID, companyID string) (*models.AttendanceStats, error) {
 	query := `
 		SELECT 
 			COUNT(*) as total_lessons,
@@ -574,13 +605,13 @@ func (r *StudentRepository) GetAttendanceStats(studentID string) (*models.Attend
 			COUNT(CASE WHEN status = 'missed' THEN 1 END) as missed,
 			COUNT(CASE WHEN status = 'cancelled' THEN 1 END) as cancelled
 		FROM lesson_attendance
-		WHERE student_id = $1
+		WHERE student_id = $1 AND company_id = $2
 	`
 
 	stats := &models.AttendanceStats{}
 	var total, attended, missed, cancelled int
 
-	err := r.db.QueryRow(query, studentID).Scan(&total, &attended, &missed, &cancelled)
+	err := database.Tenant(r.db, companyID).QueryRow(query, studentID, companyID).Scan(&total, &attended, &missed, &cancelled)
 	if err != nil {
 		return nil, fmt.Errorf("error getting attendance stats: %w", err)
 	}
@@ -599,8 +630,8 @@ func (r *StudentRepository) GetAttendanceStats(studentID string) (*models.Attend
 	return stats, nil
 }
 
-// GetAttendanceJournal retrieves detailed attendance journal for a student
-func (r *StudentRepository) GetAttendanceJournal(studentID string) ([]*models.AttendanceJournalEntry, error) {
+// GetAttendanceJournal retrieves detailed attendance journal for a company's student
+func (r *StudentRepository) GetAttendanceJournal(studentID, companyID string) ([]*models.AttendanceJournalEntry, error) {
 	query := `
 		SELECT 
 			la.id,
@@ -620,11 +651,11 @@ func (r *StudentRepository) GetAttendanceJournal(studentID string) ([]*models.At
 		JOIN lessons l ON la.lesson_id = l.id
 		JOIN teachers t ON l.teacher_id = t.id
 		LEFT JOIN groups g ON l.group_id = g.id
-		WHERE la.student_id = $1
+		WHERE la.student_id = $1 AND la.company_id = $2
 		ORDER BY l.start_time DESC
 	`
 
-	rows, err := r.db.Query(query, studentID)
+	rows, err := database.Tenant(r.db, companyID).Query(query, studentID, companyID)
 	if err != nil {
 		return nil, fmt.Errorf("error getting attendance journal: %w", err)
 	}
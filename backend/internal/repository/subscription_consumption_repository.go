@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"time"
 
+	"classmate-central/internal/database"
 	"classmate-central/internal/models"
 )
 
@@ -22,7 +23,7 @@ func (r *SubscriptionConsumptionRepository) Create(consumption *models.Subscript
 		VALUES ($1, $2, $3, $4)
 		RETURNING id, created_at
 	`
-	err := r.db.QueryRow(
+	err := database.Tenant(r.db, companyID).QueryRow(
 		query,
 		consumption.SubscriptionID,
 		consumption.AttendanceID,
@@ -40,7 +41,7 @@ func (r *SubscriptionConsumptionRepository) GetByID(id int64, companyID string)
 
 	query := `SELECT id, subscription_id, attendance_id, units, company_id, created_at 
 	          FROM subscription_consumption WHERE id = $1 AND company_id = $2`
-	err := r.db.QueryRow(query, id, companyID).Scan(
+	err := database.Tenant(r.db, companyID).QueryRow(query, id, companyID).Scan(
 		&consumption.ID,
 		&consumption.SubscriptionID,
 		&consumption.AttendanceID,
@@ -65,7 +66,7 @@ func (r *SubscriptionConsumptionRepository) GetBySubscriptionID(subscriptionID s
 		WHERE subscription_id = $1 AND company_id = $2
 		ORDER BY created_at DESC
 	`
-	rows, err := r.db.Query(query, subscriptionID, companyID)
+	rows, err := database.Tenant(r.db, companyID).Query(query, subscriptionID, companyID)
 	if err != nil {
 		return nil, fmt.Errorf("error getting subscription consumptions: %w", err)
 	}
@@ -98,7 +99,7 @@ func (r *SubscriptionConsumptionRepository) GetByAttendanceID(attendanceID int,
 
 	query := `SELECT id, subscription_id, attendance_id, units, company_id, created_at 
 	          FROM subscription_consumption WHERE attendance_id = $1 AND company_id = $2`
-	err := r.db.QueryRow(query, attendanceID, companyID).Scan(
+	err := database.Tenant(r.db, companyID).QueryRow(query, attendanceID, companyID).Scan(
 		&consumption.ID,
 		&consumption.SubscriptionID,
 		&consumption.AttendanceID,
@@ -123,7 +124,7 @@ func (r *SubscriptionConsumptionRepository) GetTotalUnitsBySubscription(subscrip
 		FROM subscription_consumption
 		WHERE subscription_id = $1 AND company_id = $2
 	`
-	err := r.db.QueryRow(query, subscriptionID, companyID).Scan(&total)
+	err := database.Tenant(r.db, companyID).QueryRow(query, subscriptionID, companyID).Scan(&total)
 	if err != nil {
 		return 0, fmt.Errorf("error getting total units: %w", err)
 	}
@@ -137,7 +138,7 @@ func (r *SubscriptionConsumptionRepository) GetInRange(start, end time.Time, com
 		WHERE company_id = $1 AND created_at >= $2 AND created_at < $3
 		ORDER BY created_at DESC
 	`
-	rows, err := r.db.Query(query, companyID, start, end)
+	rows, err := database.Tenant(r.db, companyID).Query(query, companyID, start, end)
 	if err != nil {
 		return nil, fmt.Errorf("error getting subscription consumptions in range: %w", err)
 	}
@@ -167,7 +168,7 @@ func (r *SubscriptionConsumptionRepository) GetInRange(start, end time.Time, com
 
 func (r *SubscriptionConsumptionRepository) Delete(id int64, companyID string) error {
 	query := `DELETE FROM subscription_consumption WHERE id = $1 AND company_id = $2`
-	_, err := r.db.Exec(query, id, companyID)
+	_, err := database.Tenant(r.db, companyID).Exec(query, id, companyID)
 	if err != nil {
 		return fmt.Errorf("error deleting subscription consumption: %w", err)
 	}
@@ -1,6 +1,7 @@
 package repository
 
 import (
+	"classmate-central/internal/database"
 	"classmate-central/internal/models"
 	"database/sql"
 	"time"
@@ -18,15 +19,17 @@ func NewSubscriptionRepository(db *sql.DB) *SubscriptionRepository {
 
 func (r *SubscriptionRepository) CreateType(subType *models.SubscriptionType, companyID string) error {
 	query := `INSERT INTO subscription_types (id, name, lessons_count, validity_days, price, can_freeze, billing_type, description, company_id) 
-	          VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9) RETURNING created_at`
-	return r.db.QueryRow(query, subType.ID, subType.Name, subType.LessonsCount, subType.ValidityDays, subType.Price, subType.CanFreeze, subType.BillingType, subType.Description, companyID).
-		Scan(&subType.CreatedAt)
+	          VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9) RETURNING created_at, currency`
+	err := database.Tenant(r.db, companyID).QueryRow(query, subType.ID, subType.Name, subType.LessonsCount, subType.ValidityDays, subType.Price, subType.CanFreeze, subType.BillingType, subType.Description, companyID).
+		Scan(&subType.CreatedAt, &subType.Currency)
+	subType.ApplyCurrency()
+	return err
 }
 
 func (r *SubscriptionRepository) GetAllTypes(companyID string) ([]models.SubscriptionType, error) {
-	query := `SELECT id, name, lessons_count, validity_days, price, can_freeze, billing_type, description, created_at, company_id 
+	query := `SELECT id, name, lessons_count, validity_days, price, can_freeze, billing_type, description, created_at, company_id, currency
 	          FROM subscription_types WHERE company_id = $1 ORDER BY created_at DESC`
-	rows, err := r.db.Query(query, companyID)
+	rows, err := database.Tenant(r.db, companyID).Query(query, companyID)
 	if err != nil {
 		return nil, err
 	}
@@ -35,52 +38,58 @@ func (r *SubscriptionRepository) GetAllTypes(companyID string) ([]models.Subscri
 	types := []models.SubscriptionType{}
 	for rows.Next() {
 		var subType models.SubscriptionType
-		if err := rows.Scan(&subType.ID, &subType.Name, &subType.LessonsCount, &subType.ValidityDays, &subType.Price, &subType.CanFreeze, &subType.BillingType, &subType.Description, &subType.CreatedAt, &subType.CompanyID); err != nil {
+		if err := rows.Scan(&subType.ID, &subType.Name, &subType.LessonsCount, &subType.ValidityDays, &subType.Price, &subType.CanFreeze, &subType.BillingType, &subType.Description, &subType.CreatedAt, &subType.CompanyID, &subType.Currency); err != nil {
 			return nil, err
 		}
+		subType.ApplyCurrency()
 		types = append(types, subType)
 	}
 	return types, nil
 }
 
 func (r *SubscriptionRepository) GetTypeByID(id string, companyID string) (*models.SubscriptionType, error) {
-	query := `SELECT id, name, lessons_count, validity_days, price, can_freeze, billing_type, description, created_at, company_id 
+	query := `SELECT id, name, lessons_count, validity_days, price, can_freeze, billing_type, description, created_at, company_id, currency
 	          FROM subscription_types WHERE id = $1 AND company_id = $2`
 	var subType models.SubscriptionType
-	err := r.db.QueryRow(query, id, companyID).Scan(&subType.ID, &subType.Name, &subType.LessonsCount, &subType.ValidityDays, &subType.Price, &subType.CanFreeze, &subType.BillingType, &subType.Description, &subType.CreatedAt, &subType.CompanyID)
+	err := database.Tenant(r.db, companyID).QueryRow(query, id, companyID).Scan(&subType.ID, &subType.Name, &subType.LessonsCount, &subType.ValidityDays, &subType.Price, &subType.CanFreeze, &subType.BillingType, &subType.Description, &subType.CreatedAt, &subType.CompanyID, &subType.Currency)
 	if err != nil {
 		return nil, err
 	}
+	subType.ApplyCurrency()
 	return &subType, nil
 }
 
 func (r *SubscriptionRepository) UpdateType(subType *models.SubscriptionType, companyID string) error {
 	query := `UPDATE subscription_types SET name = $1, lessons_count = $2, validity_days = $3, price = $4, can_freeze = $5, billing_type = $6, description = $7 
 	          WHERE id = $8 AND company_id = $9`
-	_, err := r.db.Exec(query, subType.Name, subType.LessonsCount, subType.ValidityDays, subType.Price, subType.CanFreeze, subType.BillingType, subType.Description, subType.ID, companyID)
+	_, err := database.Tenant(r.db, companyID).Exec(query, subType.Name, subType.LessonsCount, subType.ValidityDays, subType.Price, subType.CanFreeze, subType.BillingType, subType.Description, subType.ID, companyID)
 	return err
 }
 
 func (r *SubscriptionRepository) DeleteType(id string, companyID string) error {
 	query := `DELETE FROM subscription_types WHERE id = $1 AND company_id = $2`
-	_, err := r.db.Exec(query, id, companyID)
+	_, err := database.Tenant(r.db, companyID).Exec(query, id, companyID)
 	return err
 }
 
 // ============= Student Subscriptions =============
 
 func (r *SubscriptionRepository) CreateStudentSubscription(sub *models.StudentSubscription, companyID string) error {
+	sub.DerivePricePerLesson()
 	query := `INSERT INTO student_subscriptions (
 		id, student_id, subscription_type_id, group_id, teacher_id,
 		total_lessons, used_lessons, total_price, price_per_lesson,
-		start_date, end_date, paid_till, status, freeze_days_remaining, company_id, version
-	) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, 0) 
-	RETURNING created_at, updated_at`
-	return r.db.QueryRow(query,
+		start_date, end_date, paid_till, status, freeze_days_remaining, company_id, version, currency
+	) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, 0,
+		effective_currency($15, (SELECT branch_id FROM students WHERE id = $2)))
+	RETURNING created_at, updated_at, currency`
+	err := database.Tenant(r.db, companyID).QueryRow(query,
 		sub.ID, sub.StudentID, sub.SubscriptionTypeID, sub.GroupID, sub.TeacherID,
 		sub.TotalLessons, sub.UsedLessons, sub.TotalPrice, sub.PricePerLesson,
 		sub.StartDate, sub.EndDate, sub.PaidTill, sub.Status, sub.FreezeDaysRemaining, companyID,
-	).Scan(&sub.CreatedAt, &sub.UpdatedAt)
+	).Scan(&sub.CreatedAt, &sub.UpdatedAt, &sub.Currency)
+	sub.ApplyCurrency()
+	return err
 }
 
 func (r *SubscriptionRepository) GetStudentSubscriptions(studentID string, companyID string) ([]models.StudentSubscription, error) {
@@ -89,12 +98,12 @@ func (r *SubscriptionRepository) GetStudentSubscriptions(studentID string, compa
 		ss.group_id, ss.teacher_id,
 		ss.total_lessons, ss.used_lessons, ss.remaining_lessons, ss.total_price, ss.price_per_lesson,
 		ss.start_date, ss.end_date, ss.paid_till, ss.status, ss.freeze_days_remaining, 
-		ss.created_at, ss.updated_at, ss.company_id, ss.version
+		ss.created_at, ss.updated_at, ss.company_id, ss.version, ss.currency
 	FROM student_subscriptions ss
 	LEFT JOIN subscription_types st ON ss.subscription_type_id = st.id
 	WHERE ss.student_id = $1 AND ss.company_id = $2
 	ORDER BY ss.created_at DESC`
-	rows, err := r.db.Query(query, studentID, companyID)
+	rows, err := database.Tenant(r.db, companyID).Query(query, studentID, companyID)
 	if err != nil {
 		return nil, err
 	}
@@ -109,10 +118,11 @@ func (r *SubscriptionRepository) GetStudentSubscriptions(studentID string, compa
 			&groupID, &teacherID,
 			&sub.TotalLessons, &sub.UsedLessons, &sub.LessonsRemaining, &sub.TotalPrice, &sub.PricePerLesson,
 			&sub.StartDate, &sub.EndDate, &sub.PaidTill, &sub.Status, &sub.FreezeDaysRemaining,
-			&sub.CreatedAt, &sub.UpdatedAt, &sub.CompanyID, &sub.Version,
+			&sub.CreatedAt, &sub.UpdatedAt, &sub.CompanyID, &sub.Version, &sub.Currency,
 		); err != nil {
 			return nil, err
 		}
+		sub.ApplyCurrency()
 		if typeName.Valid {
 			sub.SubscriptionTypeName = typeName.String
 		}
@@ -138,22 +148,23 @@ func (r *SubscriptionRepository) GetSubscriptionByID(id string, companyID string
 		ss.group_id, ss.teacher_id,
 		ss.total_lessons, ss.used_lessons, ss.remaining_lessons, ss.total_price, ss.price_per_lesson,
 		ss.start_date, ss.end_date, ss.paid_till, ss.status, ss.freeze_days_remaining,
-		ss.created_at, ss.updated_at, ss.company_id, ss.version
+		ss.created_at, ss.updated_at, ss.company_id, ss.version, ss.currency
 	FROM student_subscriptions ss
 	LEFT JOIN subscription_types st ON ss.subscription_type_id = st.id
 	WHERE ss.id = $1 AND ss.company_id = $2`
 	var sub models.StudentSubscription
 	var typeName, billingType sql.NullString
-	err := r.db.QueryRow(query, id, companyID).Scan(
+	err := database.Tenant(r.db, companyID).QueryRow(query, id, companyID).Scan(
 		&sub.ID, &sub.StudentID, &sub.SubscriptionTypeID, &typeName, &billingType,
 		&sub.GroupID, &sub.TeacherID,
 		&sub.TotalLessons, &sub.UsedLessons, &sub.LessonsRemaining, &sub.TotalPrice, &sub.PricePerLesson,
 		&sub.StartDate, &sub.EndDate, &sub.PaidTill, &sub.Status, &sub.FreezeDaysRemaining,
-		&sub.CreatedAt, &sub.UpdatedAt, &sub.CompanyID, &sub.Version,
+		&sub.CreatedAt, &sub.UpdatedAt, &sub.CompanyID, &sub.Version, &sub.Currency,
 	)
 	if err != nil {
 		return nil, err
 	}
+	sub.ApplyCurrency()
 	if typeName.Valid {
 		sub.SubscriptionTypeName = typeName.String
 	}
@@ -164,11 +175,12 @@ func (r *SubscriptionRepository) GetSubscriptionByID(id string, companyID string
 }
 
 func (r *SubscriptionRepository) UpdateSubscription(sub *models.StudentSubscription, companyID string) error {
+	sub.DerivePricePerLesson()
 	query := `UPDATE student_subscriptions SET 
 		total_lessons = $1, used_lessons = $2, total_price = $3, price_per_lesson = $4,
 		end_date = $5, paid_till = $6, status = $7, freeze_days_remaining = $8, updated_at = CURRENT_TIMESTAMP
 		WHERE id = $9 AND company_id = $10`
-	_, err := r.db.Exec(query,
+	_, err := database.Tenant(r.db, companyID).Exec(query,
 		sub.TotalLessons, sub.UsedLessons, sub.TotalPrice, sub.PricePerLesson,
 		sub.EndDate, sub.PaidTill, sub.Status, sub.FreezeDaysRemaining, sub.ID, companyID,
 	)
@@ -177,7 +189,7 @@ func (r *SubscriptionRepository) UpdateSubscription(sub *models.StudentSubscript
 
 func (r *SubscriptionRepository) DeleteSubscription(id string, companyID string) error {
 	query := `DELETE FROM student_subscriptions WHERE id = $1 AND company_id = $2`
-	_, err := r.db.Exec(query, id, companyID)
+	_, err := database.Tenant(r.db, companyID).Exec(query, id, companyID)
 	return err
 }
 
@@ -193,10 +205,11 @@ func (r *SubscriptionRepository) GetAllSubscriptions(companyID string, branchID
 			ss.group_id, ss.teacher_id,
 			ss.total_lessons, ss.used_lessons, ss.remaining_lessons, ss.total_price, ss.price_per_lesson,
 			ss.start_date, ss.end_date, ss.paid_till, ss.status, ss.freeze_days_remaining,
-			ss.created_at, ss.updated_at, ss.company_id, ss.version
+			ss.created_at, ss.updated_at, ss.company_id, ss.version, ss.currency
 		FROM student_subscriptions ss
 		LEFT JOIN subscription_types st ON ss.subscription_type_id = st.id
-		WHERE ss.company_id = $1
+		LEFT JOIN students s ON ss.student_id = s.id
+		WHERE ss.company_id = $1 AND s.deleted_at IS NULL
 		ORDER BY ss.created_at DESC`
 		args = []interface{}{companyID}
 	} else {
@@ -206,16 +219,16 @@ func (r *SubscriptionRepository) GetAllSubscriptions(companyID string, branchID
 			ss.group_id, ss.teacher_id,
 			ss.total_lessons, ss.used_lessons, ss.remaining_lessons, ss.total_price, ss.price_per_lesson,
 			ss.start_date, ss.end_date, ss.paid_till, ss.status, ss.freeze_days_remaining,
-			ss.created_at, ss.updated_at, ss.company_id, ss.version
+			ss.created_at, ss.updated_at, ss.company_id, ss.version, ss.currency
 		FROM student_subscriptions ss
 		LEFT JOIN subscription_types st ON ss.subscription_type_id = st.id
 		LEFT JOIN students s ON ss.student_id = s.id
-		WHERE ss.company_id = $1 AND COALESCE(ss.branch_id, s.branch_id) = $2
+		WHERE ss.company_id = $1 AND COALESCE(ss.branch_id, s.branch_id) = $2 AND s.deleted_at IS NULL
 		ORDER BY ss.created_at DESC`
 		args = []interface{}{companyID, branchID}
 	}
 	
-	rows, err := r.db.Query(query, args...)
+	rows, err := database.Tenant(r.db, companyID).Query(query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -230,10 +243,11 @@ func (r *SubscriptionRepository) GetAllSubscriptions(companyID string, branchID
 			&groupID, &teacherID,
 			&sub.TotalLessons, &sub.UsedLessons, &sub.LessonsRemaining, &sub.TotalPrice, &sub.PricePerLesson,
 			&sub.StartDate, &sub.EndDate, &sub.PaidTill, &sub.Status, &sub.FreezeDaysRemaining,
-			&sub.CreatedAt, &sub.UpdatedAt, &sub.CompanyID, &sub.Version,
+			&sub.CreatedAt, &sub.UpdatedAt, &sub.CompanyID, &sub.Version, &sub.Currency,
 		); err != nil {
 			return nil, err
 		}
+		sub.ApplyCurrency()
 		if typeName.Valid {
 			sub.SubscriptionTypeName = typeName.String
 		} else {
@@ -262,22 +276,23 @@ func (r *SubscriptionRepository) GetSubscriptionByIDInternal(id string) (*models
 		ss.group_id, ss.teacher_id,
 		ss.total_lessons, ss.used_lessons, ss.remaining_lessons, ss.total_price, ss.price_per_lesson,
 		ss.start_date, ss.end_date, ss.paid_till, ss.status, ss.freeze_days_remaining,
-		ss.created_at, ss.updated_at, ss.company_id, ss.version
+		ss.created_at, ss.updated_at, ss.company_id, ss.version, ss.currency
 	FROM student_subscriptions ss
 	LEFT JOIN subscription_types st ON ss.subscription_type_id = st.id
 	WHERE ss.id = $1`
 	var sub models.StudentSubscription
 	var typeName, billingType sql.NullString
-	err := r.db.QueryRow(query, id).Scan(
+	err := database.System(r.db).QueryRow(query, id).Scan(
 		&sub.ID, &sub.StudentID, &sub.SubscriptionTypeID, &typeName, &billingType,
 		&sub.GroupID, &sub.TeacherID,
 		&sub.TotalLessons, &sub.UsedLessons, &sub.LessonsRemaining, &sub.TotalPrice, &sub.PricePerLesson,
 		&sub.StartDate, &sub.EndDate, &sub.PaidTill, &sub.Status, &sub.FreezeDaysRemaining,
-		&sub.CreatedAt, &sub.UpdatedAt, &sub.CompanyID, &sub.Version,
+		&sub.CreatedAt, &sub.UpdatedAt, &sub.CompanyID, &sub.Version, &sub.Currency,
 	)
 	if err != nil {
 		return nil, err
 	}
+	sub.ApplyCurrency()
 	if typeName.Valid {
 		sub.SubscriptionTypeName = typeName.String
 	}
@@ -293,7 +308,7 @@ func (r *SubscriptionRepository) UpdateSubscriptionInternal(sub *models.StudentS
 		total_lessons = $1, used_lessons = $2, total_price = $3, price_per_lesson = $4,
 		end_date = $5, paid_till = $6, status = $7, freeze_days_remaining = $8, updated_at = CURRENT_TIMESTAMP
 		WHERE id = $9`
-	_, err := r.db.Exec(query,
+	_, err := database.System(r.db).Exec(query,
 		sub.TotalLessons, sub.UsedLessons, sub.TotalPrice, sub.PricePerLesson,
 		sub.EndDate, sub.PaidTill, sub.Status, sub.FreezeDaysRemaining, sub.ID,
 	)
@@ -302,14 +317,27 @@ func (r *SubscriptionRepository) UpdateSubscriptionInternal(sub *models.StudentS
 
 // ============= Subscription Freezes =============
 
-func (r *SubscriptionRepository) CreateFreeze(freeze *models.SubscriptionFreeze) error {
+// CreateFreeze freezes a subscription of the company. Returns sql.ErrNoRows if the company has
+// no such subscription.
+func (r *SubscriptionRepository) CreateFreeze(freeze *models.SubscriptionFreeze, companyID string) error {
 	// Start transaction
-	tx, err := r.db.Begin()
+	tx, err := database.Tenant(r.db, companyID).Begin()
 	if err != nil {
 		return err
 	}
 	defer tx.Rollback()
 
+	// Update subscription status to 'frozen'
+	result, err := tx.Exec(`UPDATE student_subscriptions SET status = 'frozen' WHERE id = $1 AND company_id = $2`, freeze.SubscriptionID, companyID)
+	if err != nil {
+		return err
+	}
+	if rows, err := result.RowsAffected(); err != nil {
+		return err
+	} else if rows == 0 {
+		return sql.ErrNoRows
+	}
+
 	// Insert freeze record
 	query := `INSERT INTO subscription_freezes (subscription_id, freeze_start, freeze_end, reason) 
 	          VALUES ($1, $2, $3, $4) RETURNING id, created_at`
@@ -319,20 +347,15 @@ func (r *SubscriptionRepository) CreateFreeze(freeze *models.SubscriptionFreeze)
 		return err
 	}
 
-	// Update subscription status to 'frozen'
-	updateQuery := `UPDATE student_subscriptions SET status = 'frozen' WHERE id = $1`
-	_, err = tx.Exec(updateQuery, freeze.SubscriptionID)
-	if err != nil {
-		return err
-	}
-
 	return tx.Commit()
 }
 
-func (r *SubscriptionRepository) GetFreezesBySubscription(subscriptionID string) ([]models.SubscriptionFreeze, error) {
+func (r *SubscriptionRepository) GetFreezesBySubscription(subscriptionID, companyID string) ([]models.SubscriptionFreeze, error) {
 	query := `SELECT id, subscription_id, freeze_start, freeze_end, reason, created_at 
-	          FROM subscription_freezes WHERE subscription_id = $1 ORDER BY created_at DESC`
-	rows, err := r.db.Query(query, subscriptionID)
+	          FROM subscription_freezes
+	          WHERE subscription_id = $1 AND subscription_id IN (SELECT id FROM student_subscriptions WHERE company_id = $2)
+	          ORDER BY created_at DESC`
+	rows, err := database.Tenant(r.db, companyID).Query(query, subscriptionID, companyID)
 	if err != nil {
 		return nil, err
 	}
@@ -362,9 +385,11 @@ func (r *SubscriptionRepository) GetFreezesBySubscription(subscriptionID string)
 	return freezes, nil
 }
 
-func (r *SubscriptionRepository) UpdateFreeze(freeze *models.SubscriptionFreeze) error {
+// UpdateFreeze changes a freeze of a subscription of the company. Returns sql.ErrNoRows if the
+// company has no such freeze.
+func (r *SubscriptionRepository) UpdateFreeze(freeze *models.SubscriptionFreeze, companyID string) error {
 	// Start transaction
-	tx, err := r.db.Begin()
+	tx, err := database.Tenant(r.db, companyID).Begin()
 	if err != nil {
 		return err
 	}
@@ -373,7 +398,9 @@ func (r *SubscriptionRepository) UpdateFreeze(freeze *models.SubscriptionFreeze)
 	// Get freeze details to calculate days frozen
 	var freezeStart time.Time
 	var subscriptionID string
-	err = tx.QueryRow(`SELECT freeze_start, subscription_id FROM subscription_freezes WHERE id = $1`, freeze.ID).
+	err = tx.QueryRow(`SELECT f.freeze_start, f.subscription_id FROM subscription_freezes f
+		JOIN student_subscriptions ss ON ss.id = f.subscription_id
+		WHERE f.id = $1 AND ss.company_id = $2`, freeze.ID, companyID).
 		Scan(&freezeStart, &subscriptionID)
 	if err != nil {
 		return err
@@ -433,34 +460,42 @@ func (r *SubscriptionRepository) MarkAttendance(attendance *models.LessonAttenda
 	          ON CONFLICT (lesson_id, student_id) DO UPDATE 
 	          SET subscription_id = EXCLUDED.subscription_id, status = EXCLUDED.status, marked_at = CURRENT_TIMESTAMP, marked_by = EXCLUDED.marked_by, company_id = EXCLUDED.company_id
 	          RETURNING id, marked_at`
-	return r.db.QueryRow(query, attendance.LessonID, attendance.StudentID, attendance.SubscriptionID, attendance.Status, attendance.MarkedBy, attendance.CompanyID).
+	return database.Tenant(r.db, attendance.CompanyID).QueryRow(query, attendance.LessonID, attendance.StudentID, attendance.SubscriptionID, attendance.Status, attendance.MarkedBy, attendance.CompanyID).
 		Scan(&attendance.ID, &attendance.MarkedAt)
 }
 
-func (r *SubscriptionRepository) GetAttendanceByLesson(lessonID string) ([]models.LessonAttendance, error) {
+// GetAttendanceByLesson returns the attendance marked for a lesson of the company
+func (r *SubscriptionRepository) GetAttendanceByLesson(lessonID, companyID string) ([]models.LessonAttendance, error) {
 	query := `SELECT id, lesson_id, student_id, subscription_id, status, marked_at, marked_by, company_id 
-	          FROM lesson_attendance WHERE lesson_id = $1`
-	rows, err := r.db.Query(query, lessonID)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
+	          FROM lesson_attendance WHERE lesson_id = $1 AND company_id = $2`
 
 	attendances := []models.LessonAttendance{}
-	for rows.Next() {
-		var attendance models.LessonAttendance
-		if err := rows.Scan(&attendance.ID, &attendance.LessonID, &attendance.StudentID, &attendance.SubscriptionID, &attendance.Status, &attendance.MarkedAt, &attendance.MarkedBy, &attendance.CompanyID); err != nil {
-			return nil, err
+	err := database.WithTenant(r.db, companyID, func(tx *sql.Tx) error {
+		rows, err := tx.Query(query, lessonID, companyID)
+		if err != nil {
+			return err
 		}
-		attendances = append(attendances, attendance)
+		defer rows.Close()
+
+		for rows.Next() {
+			var attendance models.LessonAttendance
+			if err := rows.Scan(&attendance.ID, &attendance.LessonID, &attendance.StudentID, &attendance.SubscriptionID, &attendance.Status, &attendance.MarkedAt, &attendance.MarkedBy, &attendance.CompanyID); err != nil {
+				return err
+			}
+			attendances = append(attendances, attendance)
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, err
 	}
 	return attendances, nil
 }
 
-func (r *SubscriptionRepository) GetAttendanceByStudent(studentID string) ([]models.LessonAttendance, error) {
+func (r *SubscriptionRepository) GetAttendanceByStudent(studentID, companyID string) ([]models.LessonAttendance, error) {
 	query := `SELECT id, lesson_id, student_id, subscription_id, status, marked_at, marked_by, company_id 
-	          FROM lesson_attendance WHERE student_id = $1 ORDER BY marked_at DESC`
-	rows, err := r.db.Query(query, studentID)
+	          FROM lesson_attendance WHERE student_id = $1 AND company_id = $2 ORDER BY marked_at DESC`
+	rows, err := database.Tenant(r.db, companyID).Query(query, studentID, companyID)
 	if err != nil {
 		return nil, err
 	}
@@ -478,13 +513,13 @@ func (r *SubscriptionRepository) GetAttendanceByStudent(studentID string) ([]mod
 }
 
 // DeductLesson deducts a lesson from a subscription
-func (r *SubscriptionRepository) DeductLesson(subscriptionID string) error {
+func (r *SubscriptionRepository) DeductLesson(subscriptionID, companyID string) error {
 	query := `
 		UPDATE student_subscriptions 
 		SET used_lessons = used_lessons + 1, updated_at = CURRENT_TIMESTAMP
-		WHERE id = $1 AND remaining_lessons > 0
+		WHERE id = $1 AND company_id = $2 AND remaining_lessons > 0
 	`
-	result, err := r.db.Exec(query, subscriptionID)
+	result, err := database.Tenant(r.db, companyID).Exec(query, subscriptionID, companyID)
 	if err != nil {
 		return err
 	}
@@ -502,28 +537,28 @@ func (r *SubscriptionRepository) DeductLesson(subscriptionID string) error {
 }
 
 // GetActiveSubscription retrieves the active subscription for a student
-func (r *SubscriptionRepository) GetActiveSubscription(studentID string) (*models.StudentSubscription, error) {
+func (r *SubscriptionRepository) GetActiveSubscription(studentID, companyID string) (*models.StudentSubscription, error) {
 	query := `
 		SELECT 
 			ss.id, ss.student_id, ss.subscription_type_id, st.name as subscription_type_name, st.billing_type,
 			ss.group_id, ss.teacher_id,
 			ss.total_lessons, ss.used_lessons, ss.remaining_lessons, ss.total_price, ss.price_per_lesson,
 			ss.start_date, ss.end_date, ss.paid_till, ss.status, ss.freeze_days_remaining,
-			ss.created_at, ss.updated_at, ss.company_id
+			ss.created_at, ss.updated_at, ss.company_id, ss.currency
 		FROM student_subscriptions ss
 		LEFT JOIN subscription_types st ON ss.subscription_type_id = st.id
-		WHERE ss.student_id = $1 AND ss.status = 'active' AND ss.remaining_lessons > 0
+		WHERE ss.student_id = $1 AND ss.company_id = $2 AND ss.status = 'active' AND ss.remaining_lessons > 0
 		ORDER BY ss.created_at DESC
 		LIMIT 1
 	`
 	var sub models.StudentSubscription
 	var typeName, billingType sql.NullString
-	err := r.db.QueryRow(query, studentID).Scan(
+	err := database.Tenant(r.db, companyID).QueryRow(query, studentID, companyID).Scan(
 		&sub.ID, &sub.StudentID, &sub.SubscriptionTypeID, &typeName, &billingType,
 		&sub.GroupID, &sub.TeacherID,
 		&sub.TotalLessons, &sub.UsedLessons, &sub.LessonsRemaining, &sub.TotalPrice, &sub.PricePerLesson,
 		&sub.StartDate, &sub.EndDate, &sub.PaidTill, &sub.Status, &sub.FreezeDaysRemaining,
-		&sub.CreatedAt, &sub.UpdatedAt, &sub.CompanyID,
+		&sub.CreatedAt, &sub.UpdatedAt, &sub.CompanyID, &sub.Currency,
 	)
 	if err == sql.ErrNoRows {
 		return nil, nil
@@ -531,6 +566,7 @@ func (r *SubscriptionRepository) GetActiveSubscription(studentID string) (*model
 	if err != nil {
 		return nil, err
 	}
+	sub.ApplyCurrency()
 	if typeName.Valid {
 		sub.SubscriptionTypeName = typeName.String
 	} else {
@@ -547,14 +583,15 @@ func (r *SubscriptionRepository) CheckExpiringSubscriptions() ([]*models.Student
 			ss.group_id, ss.teacher_id,
 			ss.total_lessons, ss.used_lessons, ss.remaining_lessons, ss.total_price, ss.price_per_lesson,
 			ss.start_date, ss.end_date, ss.paid_till, ss.status, ss.freeze_days_remaining,
-			ss.created_at, ss.updated_at, ss.company_id
+			ss.created_at, ss.updated_at, ss.company_id, ss.currency
 		FROM student_subscriptions ss
 		LEFT JOIN subscription_types st ON ss.subscription_type_id = st.id
+		JOIN students s ON s.id = ss.student_id AND s.deleted_at IS NULL
 		WHERE ss.status = 'active' 
 		AND ss.end_date IS NOT NULL 
 		AND ss.end_date BETWEEN CURRENT_TIMESTAMP AND CURRENT_TIMESTAMP + INTERVAL '7 days'
 	`
-	rows, err := r.db.Query(query)
+	rows, err := database.System(r.db).Query(query)
 	if err != nil {
 		return nil, err
 	}
@@ -569,10 +606,11 @@ func (r *SubscriptionRepository) CheckExpiringSubscriptions() ([]*models.Student
 			&sub.GroupID, &sub.TeacherID,
 			&sub.TotalLessons, &sub.UsedLessons, &sub.LessonsRemaining, &sub.TotalPrice, &sub.PricePerLesson,
 			&sub.StartDate, &sub.EndDate, &sub.PaidTill, &sub.Status, &sub.FreezeDaysRemaining,
-			&sub.CreatedAt, &sub.UpdatedAt, &sub.CompanyID,
+			&sub.CreatedAt, &sub.UpdatedAt, &sub.CompanyID, &sub.Currency,
 		); err != nil {
 			return nil, err
 		}
+		sub.ApplyCurrency()
 		if typeName.Valid {
 			sub.SubscriptionTypeName = typeName.String
 		} else {
@@ -590,7 +628,7 @@ func (r *SubscriptionRepository) CheckExpiringSubscriptions() ([]*models.Student
 func (r *SubscriptionRepository) GetAllAttendance(companyID string) ([]models.LessonAttendance, error) {
 	query := `SELECT id, lesson_id, student_id, subscription_id, status, marked_at, marked_by, company_id 
 	          FROM lesson_attendance WHERE company_id = $1 ORDER BY marked_at DESC`
-	rows, err := r.db.Query(query, companyID)
+	rows, err := database.Tenant(r.db, companyID).Query(query, companyID)
 	if err != nil {
 		return nil, err
 	}
@@ -2,12 +2,20 @@ package repository
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
 	"strings"
 
+	"classmate-central/internal/database"
 	"classmate-central/internal/models"
 )
 
+// ErrTeacherUserNotInCompany is returned when linking a teacher to a user of another company
+var ErrTeacherUserNotInCompany = errors.New("user does not belong to the company")
+
+// ErrTeacherUserAlreadyLinked is returned when the user is already linked to another teacher
+var ErrTeacherUserAlreadyLinked = errors.New("user is already linked to another teacher")
+
 type TeacherRepository struct {
 	db *sql.DB
 }
@@ -27,13 +35,26 @@ func (r *TeacherRepository) Create(teacher *models.Teacher, companyID string, br
 		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
 	`
 
-	_, err := r.db.Exec(query, teacher.ID, teacher.Name, teacher.Subject,
+	tx, err := database.Tenant(r.db, companyID).Begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(query, teacher.ID, teacher.Name, teacher.Subject,
 		teacher.Email, teacher.Phone, teacher.Status, teacher.Avatar, teacher.Workload, companyID, branchID)
 	if err != nil {
 		return fmt.Errorf("error creating teacher: %w", err)
 	}
 
-	return nil
+	// The primary branch is the first branch the teacher works in
+	_, err = tx.Exec(`INSERT INTO teacher_branches (teacher_id, branch_id, company_id)
+		SELECT $1, id, company_id FROM branches WHERE id = $2 AND company_id = $3`, teacher.ID, branchID, companyID)
+	if err != nil {
+		return fmt.Errorf("error adding teacher branch: %w", err)
+	}
+
+	return tx.Commit()
 }
 
 func (r *TeacherRepository) GetAll(companyID string, branchID string) ([]*models.Teacher, error) {
@@ -56,7 +77,7 @@ func (r *TeacherRepository) GetAllByBranches(companyID string, branchIDs []strin
 	
 	if hasFallback && len(branchIDs) == 1 {
 		// Fallback mode: don't filter by branch_id
-		query = `SELECT id, name, subject, email, phone, status, avatar, workload, company_id FROM teachers WHERE company_id = $1 ORDER BY name`
+		query = `SELECT id, name, subject, email, phone, status, avatar, workload, company_id, user_id FROM teachers WHERE company_id = $1 AND deleted_at IS NULL ORDER BY name`
 		args = []interface{}{companyID}
 	} else {
 		// Filter by accessible branches only
@@ -64,7 +85,9 @@ func (r *TeacherRepository) GetAllByBranches(companyID string, branchIDs []strin
 		for i := range branchIDs {
 			placeholders[i] = fmt.Sprintf("$%d", i+2)
 		}
-		query = fmt.Sprintf(`SELECT id, name, subject, email, phone, status, avatar, workload, company_id FROM teachers WHERE company_id = $1 AND branch_id IN (%s) ORDER BY name`, strings.Join(placeholders, ","))
+		// Teachers shared with a branch are listed there too
+		inBranches := strings.Join(placeholders, ",")
+		query = fmt.Sprintf(`SELECT id, name, subject, email, phone, status, avatar, workload, company_id, user_id FROM teachers WHERE company_id = $1 AND (branch_id IN (%s) OR id IN (SELECT teacher_id FROM teacher_branches WHERE branch_id IN (%s))) AND deleted_at IS NULL ORDER BY name`, inBranches, inBranches)
 		args = make([]interface{}, len(branchIDs)+1)
 		args[0] = companyID
 		for i, bid := range branchIDs {
@@ -72,7 +95,7 @@ func (r *TeacherRepository) GetAllByBranches(companyID string, branchIDs []strin
 		}
 	}
 
-	rows, err := r.db.Query(query, args...)
+	rows, err := database.Tenant(r.db, companyID).Query(query, args...)
 	if err != nil {
 		return nil, fmt.Errorf("error getting teachers: %w", err)
 	}
@@ -83,9 +106,10 @@ func (r *TeacherRepository) GetAllByBranches(companyID string, branchIDs []strin
 		teacher := &models.Teacher{}
 		var avatar sql.NullString
 		var phone sql.NullString
+		var userID sql.NullInt64
 
 		err := rows.Scan(&teacher.ID, &teacher.Name, &teacher.Subject, &teacher.Email,
-			&phone, &teacher.Status, &avatar, &teacher.Workload, &teacher.CompanyID)
+			&phone, &teacher.Status, &avatar, &teacher.Workload, &teacher.CompanyID, &userID)
 		if err != nil {
 			return nil, fmt.Errorf("error scanning teacher: %w", err)
 		}
@@ -96,6 +120,10 @@ func (r *TeacherRepository) GetAllByBranches(companyID string, branchIDs []strin
 		if phone.Valid {
 			teacher.Phone = phone.String
 		}
+		if userID.Valid {
+			id := int(userID.Int64)
+			teacher.UserID = &id
+		}
 
 		teachers = append(teachers, teacher)
 	}
@@ -107,11 +135,12 @@ func (r *TeacherRepository) GetByID(id string, companyID string) (*models.Teache
 	teacher := &models.Teacher{}
 	var avatar sql.NullString
 	var phone sql.NullString
+	var userID sql.NullInt64
 
-	query := `SELECT id, name, subject, email, phone, status, avatar, workload, company_id FROM teachers WHERE id = $1 AND company_id = $2`
+	query := `SELECT id, name, subject, email, phone, status, avatar, workload, company_id, user_id FROM teachers WHERE id = $1 AND company_id = $2 AND deleted_at IS NULL`
 
-	err := r.db.QueryRow(query, id, companyID).Scan(&teacher.ID, &teacher.Name, &teacher.Subject,
-		&teacher.Email, &phone, &teacher.Status, &avatar, &teacher.Workload, &teacher.CompanyID)
+	err := database.Tenant(r.db, companyID).QueryRow(query, id, companyID).Scan(&teacher.ID, &teacher.Name, &teacher.Subject,
+		&teacher.Email, &phone, &teacher.Status, &avatar, &teacher.Workload, &teacher.CompanyID, &userID)
 	if err == sql.ErrNoRows {
 		return nil, nil
 	}
@@ -125,18 +154,75 @@ func (r *TeacherRepository) GetByID(id string, companyID string) (*models.Teache
 	if phone.Valid {
 		teacher.Phone = phone.String
 	}
+	if userID.Valid {
+		id := int(userID.Int64)
+		teacher.UserID = &id
+	}
 
 	return teacher, nil
 }
 
+// GetIDByUser returns the ID of the teacher linked to a user account, or "" when none is linked
+func (r *TeacherRepository) GetIDByUser(userID int, companyID string) (string, error) {
+	var id string
+	err := database.Tenant(r.db, companyID).QueryRow(`SELECT id FROM teachers WHERE user_id = $1 AND company_id = $2 AND deleted_at IS NULL`, userID, companyID).Scan(&id)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("error getting teacher by user: %w", err)
+	}
+	return id, nil
+}
+
+// LinkUser links a teacher to a user account of the same company, or unlinks it when userID is nil.
+// Returns sql.ErrNoRows if the teacher does not exist.
+func (r *TeacherRepository) LinkUser(teacherID string, userID *int, companyID string) error {
+	tx, err := database.Tenant(r.db, companyID).Begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if userID != nil {
+		var userCompany sql.NullString
+		err = tx.QueryRow(`SELECT company_id FROM users WHERE id = $1`, *userID).Scan(&userCompany)
+		if err == sql.ErrNoRows || (err == nil && userCompany.String != companyID) {
+			return ErrTeacherUserNotInCompany
+		}
+		if err != nil {
+			return fmt.Errorf("error checking user: %w", err)
+		}
+
+		var linkedTo string
+		err = tx.QueryRow(`SELECT id FROM teachers WHERE user_id = $1 AND id <> $2`, *userID, teacherID).Scan(&linkedTo)
+		if err == nil {
+			return ErrTeacherUserAlreadyLinked
+		}
+		if err != sql.ErrNoRows {
+			return fmt.Errorf("error checking teacher link: %w", err)
+		}
+	}
+
+	result, err := tx.Exec(`UPDATE teachers SET user_id = $1 WHERE id = $2 AND company_id = $3 AND deleted_at IS NULL`, userID, teacherID, companyID)
+	if err != nil {
+		return fmt.Errorf("error linking teacher to user: %w", err)
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return sql.ErrNoRows
+	}
+
+	return tx.Commit()
+}
+
 func (r *TeacherRepository) Update(teacher *models.Teacher, companyID string) error {
 	query := `
 		UPDATE teachers 
 		SET name = $2, subject = $3, email = $4, phone = $5, status = $6, avatar = $7, workload = $8
-		WHERE id = $1 AND company_id = $9
+		WHERE id = $1 AND company_id = $9 AND deleted_at IS NULL
 	`
 
-	_, err := r.db.Exec(query, teacher.ID, teacher.Name, teacher.Subject,
+	_, err := database.Tenant(r.db, companyID).Exec(query, teacher.ID, teacher.Name, teacher.Subject,
 		teacher.Email, teacher.Phone, teacher.Status, teacher.Avatar, teacher.Workload, companyID)
 	if err != nil {
 		return fmt.Errorf("error updating teacher: %w", err)
@@ -145,10 +231,17 @@ func (r *TeacherRepository) Update(teacher *models.Teacher, companyID string) er
 	return nil
 }
 
-func (r *TeacherRepository) Delete(id string, companyID string) error {
-	query := `DELETE FROM teachers WHERE id = $1 AND company_id = $2`
+// Delete moves a teacher to the trash; lessons and groups keep referring to it
+func (r *TeacherRepository) Delete(id string, actor database.Actor) error {
+	query := `
+		UPDATE teachers SET deleted_at = NOW(), deleted_by = NULLIF($3, 0)
+		WHERE id = $1 AND company_id = $2 AND deleted_at IS NULL
+	`
 
-	_, err := r.db.Exec(query, id, companyID)
+	err := database.WithActor(r.db, actor, func(tx *sql.Tx) error {
+		_, err := tx.Exec(query, id, actor.CompanyID, actor.UserID)
+		return err
+	})
 	if err != nil {
 		return fmt.Errorf("error deleting teacher: %w", err)
 	}
@@ -167,11 +260,11 @@ func (r *TeacherRepository) GetGroupsByTeacher(teacherID string, companyID strin
 		FROM groups g
 		LEFT JOIN teachers t ON g.teacher_id = t.id
 		LEFT JOIN rooms rm ON g.room_id = rm.id
-		WHERE g.teacher_id = $1 AND g.company_id = $2
+		WHERE g.teacher_id = $1 AND g.company_id = $2 AND g.deleted_at IS NULL
 		ORDER BY g.name
 	`
 
-	rows, err := r.db.Query(query, teacherID, companyID)
+	rows, err := database.Tenant(r.db, companyID).Query(query, teacherID, companyID)
 	if err != nil {
 		return nil, fmt.Errorf("error getting teacher groups: %w", err)
 	}
@@ -227,7 +320,7 @@ func (r *TeacherRepository) GetGroupsByTeacher(teacherID string, companyID strin
 		group.StudentIds = []string{}
 
 		// Get students from enrollment table (active enrollments only)
-		studentRows, err := r.db.Query(`SELECT student_id FROM enrollment WHERE group_id = $1 AND left_at IS NULL`, group.ID)
+		studentRows, err := database.Tenant(r.db, companyID).Query(`SELECT student_id FROM enrollment WHERE group_id = $1 AND left_at IS NULL`, group.ID)
 		if err == nil {
 			defer studentRows.Close()
 			for studentRows.Next() {
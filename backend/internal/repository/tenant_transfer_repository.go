@@ -0,0 +1,521 @@
+package repository
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	"classmate-central/internal/database"
+	"classmate-central/internal/models"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+// maxImportErrors caps the number of problems reported for one archive
+const maxImportErrors = 50
+
+// replacedOnImport are tables whose imported rows replace the target company's own instead of
+// being added to them
+var replacedOnImport = map[string]bool{"settings": true, "exchange_rates": true}
+
+// implicitRefs are ID columns that have no foreign key constraint
+var implicitRefs = map[string]map[string]string{
+	"groups": {"room_id": "rooms"},
+}
+
+// scheduleOwnerTables maps schedule_rule.owner_type to the table owner_id points into
+var scheduleOwnerTables = map[string]string{"group": "groups", "individual": "individual_enrollment"}
+
+// exportTables are the tables of a company archive, parents before children: the wiped
+// business data plus branches, settings and exchange rates. Users and roles are not moved.
+func exportTables() []tenantTable {
+	tables := []tenantTable{byCompany("branches"), byCompany("settings"), byCompany("exchange_rates")}
+	for i := len(wipeTables) - 1; i >= 0; i-- {
+		tables = append(tables, wipeTables[i])
+	}
+	return tables
+}
+
+// IsExportTable reports whether a table belongs in a company archive
+func IsExportTable(name string) bool {
+	for _, t := range exportTables() {
+		if t.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+type TenantTransferRepository struct {
+	db *sql.DB
+}
+
+func NewTenantTransferRepository(db *sql.DB) *TenantTransferRepository {
+	return &TenantTransferRepository{db: db}
+}
+
+// Dump reads every export table of the company in one consistent read. It returns the table
+// names in import order and their rows.
+func (r *TenantTransferRepository) Dump(companyID string) ([]string, map[string][]json.RawMessage, error) {
+	tx, err := database.Tenant(r.db, companyID).BeginTx(context.Background(), &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return nil, nil, fmt.Errorf("error starting export: %w", err)
+	}
+	defer tx.Rollback()
+	if err := database.SetActor(tx, database.Actor{CompanyID: companyID}); err != nil {
+		return nil, nil, err
+	}
+
+	var names []string
+	tables := map[string][]json.RawMessage{}
+	for _, t := range exportTables() {
+		rows, err := dumpTable(tx, t, companyID)
+		if err != nil {
+			return nil, nil, err
+		}
+		names = append(names, t.name)
+		tables[t.name] = rows
+	}
+	return names, tables, nil
+}
+
+// SchemaVersion returns the last migration applied to the database, e.g. 046_company_data_jobs
+func (r *TenantTransferRepository) SchemaVersion() (string, error) {
+	var migration string
+	if err := database.System(r.db).QueryRow(`SELECT COALESCE(MAX(migration_name), '') FROM schema_migrations`).Scan(&migration); err != nil {
+		return "", fmt.Errorf("error reading schema version: %w", err)
+	}
+	return strings.TrimSuffix(path.Base(migration), ".up.sql"), nil
+}
+
+// Import adds archived tables to the actor's company under new IDs, rewriting every reference
+// between them. Problems with the data - unknown tables, references to rows that are not in
+// the archive, constraint violations such as a duplicate email, more students, branches or
+// users than allowed has room for (by plan resource; a missing resource is unlimited) - go to
+// report.Errors and leave the database unchanged. A dry run rolls back even a clean import. A
+// real import first snapshots the company and writes one audit entry.
+func (r *TenantTransferRepository) Import(tables map[string][]json.RawMessage, actor database.Actor, dryRun bool, allowed map[string]int64, report *models.TenantImportReport) error {
+	for name := range tables {
+		if !IsExportTable(name) {
+			report.Errors = append(report.Errors, fmt.Sprintf("unknown table %s", name))
+		}
+	}
+	if len(report.Errors) > 0 {
+		return nil
+	}
+
+	tx, err := database.Tenant(r.db, actor.CompanyID).Begin()
+	if err != nil {
+		return fmt.Errorf("error starting import: %w", err)
+	}
+	defer tx.Rollback()
+	if err := database.SetActor(tx, actor); err != nil {
+		return err
+	}
+	if err := database.SuppressAudit(tx); err != nil {
+		return err
+	}
+
+	if !dryRun {
+		snapshot, err := createSnapshot(tx, actor, "before_import")
+		if err != nil {
+			return err
+		}
+		report.SnapshotID = &snapshot.ID
+	}
+
+	var names []string
+	for _, t := range exportTables() {
+		names = append(names, t.name)
+	}
+	schema, err := loadImportSchema(tx, names)
+	if err != nil {
+		return err
+	}
+
+	before := map[string]int64{}
+	for resource := range allowed {
+		if before[resource], err = countUsage(tx, actor.CompanyID, resource); err != nil {
+			return err
+		}
+	}
+
+	imp := &importer{tx: tx, companyID: actor.CompanyID, schema: schema, ids: map[string]map[string]interface{}{}, report: report}
+	for _, name := range names {
+		if err := imp.importTable(name, tables[name]); err != nil {
+			return err
+		}
+		if len(report.Errors) > 0 {
+			report.SnapshotID = nil // rolled back with the import
+			return nil
+		}
+	}
+
+	for _, resource := range []string{models.PlanResourceStudents, models.PlanResourceBranches, models.PlanResourceUsers} {
+		max, ok := allowed[resource]
+		if !ok {
+			continue
+		}
+		after, err := countUsage(tx, actor.CompanyID, resource)
+		if err != nil {
+			return err
+		}
+		if added := after - before[resource]; added > max {
+			report.Errors = append(report.Errors, fmt.Sprintf("plan limit: the archive adds %d %s, the plan allows %d more", added, resource, max))
+		}
+	}
+	if len(report.Errors) > 0 {
+		report.SnapshotID = nil
+		return nil
+	}
+	if dryRun {
+		return nil
+	}
+
+	err = recordAudit(tx, companyDataAuditEntry(actor, "import_company_data", map[string]interface{}{
+		"after": report.Rows, "sourceCompany": report.SourceCompany, "checksum": report.Checksum, "snapshotId": report.SnapshotID,
+	}))
+	if err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing import: %w", err)
+	}
+	return nil
+}
+
+// tableSchema is what the importer needs to know about a table
+type tableSchema struct {
+	pk       string            // single-column primary key that gets a new value; empty if none
+	pkIsInt  bool              // the new value comes from the table's sequence
+	refs     map[string]string // column -> referenced table
+	nullable map[string]bool
+}
+
+func loadImportSchema(tx *sql.Tx, tables []string) (map[string]*tableSchema, error) {
+	schema := map[string]*tableSchema{}
+	for _, t := range tables {
+		schema[t] = &tableSchema{refs: map[string]string{}, nullable: map[string]bool{}}
+	}
+
+	rows, err := tx.Query(`
+		SELECT c.relname, a.attname, r.relname
+		FROM pg_constraint k
+		JOIN pg_class c ON c.oid = k.conrelid
+		JOIN pg_class r ON r.oid = k.confrelid
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		JOIN pg_attribute a ON a.attrelid = k.conrelid AND a.attnum = k.conkey[1]
+		WHERE k.contype = 'f' AND cardinality(k.conkey) = 1 AND n.nspname = 'public' AND c.relname = ANY($1)`,
+		pq.Array(tables))
+	if err != nil {
+		return nil, fmt.Errorf("error reading foreign keys: %w", err)
+	}
+	for rows.Next() {
+		var table, column, ref string
+		if err := rows.Scan(&table, &column, &ref); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("error reading foreign keys: %w", err)
+		}
+		schema[table].refs[column] = ref
+	}
+	rows.Close()
+	for table, refs := range implicitRefs {
+		for column, ref := range refs {
+			schema[table].refs[column] = ref
+		}
+	}
+
+	rows, err = tx.Query(`
+		SELECT c.relname, a.attname, format_type(a.atttypid, a.atttypmod)
+		FROM pg_index i
+		JOIN pg_class c ON c.oid = i.indrelid
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		JOIN pg_attribute a ON a.attrelid = i.indrelid AND a.attnum = ANY(i.indkey)
+		WHERE i.indisprimary AND n.nspname = 'public' AND c.relname = ANY($1)`,
+		pq.Array(tables))
+	if err != nil {
+		return nil, fmt.Errorf("error reading primary keys: %w", err)
+	}
+	pkColumns := map[string]int{}
+	for rows.Next() {
+		var table, column, dataType string
+		if err := rows.Scan(&table, &column, &dataType); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("error reading primary keys: %w", err)
+		}
+		pkColumns[table]++
+		schema[table].pk = column
+		schema[table].pkIsInt = dataType == "integer" || dataType == "bigint" || dataType == "smallint"
+	}
+	rows.Close()
+	for table, count := range pkColumns {
+		// Composite keys and keys that are references themselves are rewritten as references
+		if _, isRef := schema[table].refs[schema[table].pk]; count > 1 || isRef {
+			schema[table].pk = ""
+		}
+	}
+
+	rows, err = tx.Query(`
+		SELECT table_name, column_name, is_nullable = 'YES'
+		FROM information_schema.columns
+		WHERE table_schema = 'public' AND table_name = ANY($1)`, pq.Array(tables))
+	if err != nil {
+		return nil, fmt.Errorf("error reading columns: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var table, column string
+		var nullable bool
+		if err := rows.Scan(&table, &column, &nullable); err != nil {
+			return nil, fmt.Errorf("error reading columns: %w", err)
+		}
+		schema[table].nullable[column] = nullable
+	}
+	return schema, rows.Err()
+}
+
+// importer keeps the old -> new ID of every imported row, per table
+type importer struct {
+	tx        *sql.Tx
+	companyID string
+	schema    map[string]*tableSchema
+	ids       map[string]map[string]interface{}
+	report    *models.TenantImportReport
+}
+
+func (imp *importer) fail(format string, args ...interface{}) {
+	if len(imp.report.Errors) == maxImportErrors {
+		imp.report.Errors = append(imp.report.Errors, "too many errors, the rest are not listed")
+	}
+	if len(imp.report.Errors) <= maxImportErrors {
+		imp.report.Errors = append(imp.report.Errors, fmt.Sprintf(format, args...))
+	}
+}
+
+func (imp *importer) importTable(table string, raw []json.RawMessage) error {
+	ts := imp.schema[table]
+	imp.ids[table] = map[string]interface{}{}
+	if len(raw) == 0 {
+		return nil
+	}
+
+	rows := make([]map[string]interface{}, 0, len(raw))
+	for i, data := range raw {
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.UseNumber()
+		var row map[string]interface{}
+		if err := dec.Decode(&row); err != nil {
+			imp.fail("%s row %d: %v", table, i+1, err)
+			return nil
+		}
+		rows = append(rows, row)
+	}
+
+	if replacedOnImport[table] {
+		if _, err := imp.tx.Exec(fmt.Sprintf(`DELETE FROM %s WHERE company_id = $1`, pq.QuoteIdentifier(table)), imp.companyID); err != nil {
+			return fmt.Errorf("error replacing %s: %w", table, err)
+		}
+	}
+	if table == "branches" {
+		var err error
+		if rows, err = imp.mergeBranches(rows); err != nil {
+			return err
+		}
+	}
+
+	if ts.pk != "" {
+		newIDs, err := imp.newIDs(table, ts, len(rows))
+		if err != nil {
+			return err
+		}
+		for i, row := range rows {
+			if row[ts.pk] == nil {
+				imp.fail("%s row %d has no %s", table, i+1, ts.pk)
+				continue
+			}
+			imp.ids[table][idKey(row[ts.pk])] = newIDs[i]
+			row[ts.pk] = newIDs[i]
+		}
+	}
+
+	for i, row := range rows {
+		for column, value := range row {
+			if value == nil {
+				continue
+			}
+			ref := ts.refs[column]
+			if table == "schedule_rule" && column == "owner_id" {
+				ref = scheduleOwnerTables[fmt.Sprint(row["owner_type"])]
+			}
+			switch {
+			case ref == "companies":
+				row[column] = imp.companyID
+			case ref == "":
+			case imp.ids[ref] != nil:
+				newID, ok := imp.ids[ref][idKey(value)]
+				if !ok {
+					imp.fail("%s row %d: %s %v is not in the archive", table, i+1, column, value)
+					continue
+				}
+				row[column] = newID
+			case ts.nullable[column]:
+				// Users, roles and the like are not part of the archive
+				row[column] = nil
+			default:
+				imp.fail("%s row %d: %s refers to %s, which is not part of the archive", table, i+1, column, ref)
+			}
+		}
+		if _, ok := ts.nullable["company_id"]; ok {
+			row["company_id"] = imp.companyID
+		}
+	}
+	if len(imp.report.Errors) > 0 || len(rows) == 0 {
+		return nil
+	}
+
+	encoded := make([]json.RawMessage, len(rows))
+	for i, row := range rows {
+		data, err := json.Marshal(row)
+		if err != nil {
+			return fmt.Errorf("error encoding %s row: %w", table, err)
+		}
+		encoded[i] = data
+	}
+	count, err := insertSnapshotRows(imp.tx, table, encoded)
+	if err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) {
+			message := pqErr.Message
+			if pqErr.Detail != "" {
+				message += ": " + pqErr.Detail
+			}
+			imp.fail("%s: %s", table, message)
+			return nil
+		}
+		return err
+	}
+	imp.report.Rows[table] = count
+	return nil
+}
+
+// mergeBranches maps imported branches to the target company's branches of the same name and
+// returns the ones that have to be created
+func (imp *importer) mergeBranches(rows []map[string]interface{}) ([]map[string]interface{}, error) {
+	existing := map[string]string{}
+	result, err := imp.tx.Query(`SELECT id, name FROM branches WHERE company_id = $1 AND deleted_at IS NULL`, imp.companyID)
+	if err != nil {
+		return nil, fmt.Errorf("error reading branches: %w", err)
+	}
+	defer result.Close()
+	for result.Next() {
+		var id, name string
+		if err := result.Scan(&id, &name); err != nil {
+			return nil, fmt.Errorf("error reading branches: %w", err)
+		}
+		existing[name] = id
+	}
+	if err := result.Err(); err != nil {
+		return nil, fmt.Errorf("error reading branches: %w", err)
+	}
+
+	created := rows[:0]
+	for _, row := range rows {
+		if id, ok := existing[fmt.Sprint(row["name"])]; ok && row["id"] != nil {
+			imp.ids["branches"][idKey(row["id"])] = id
+			imp.report.MergedBranches++
+			continue
+		}
+		created = append(created, row)
+	}
+	return created, nil
+}
+
+// newIDs returns n fresh primary key values for a table
+func (imp *importer) newIDs(table string, ts *tableSchema, n int) ([]interface{}, error) {
+	ids := make([]interface{}, 0, n)
+	if !ts.pkIsInt {
+		for i := 0; i < n; i++ {
+			ids = append(ids, uuid.New().String())
+		}
+		return ids, nil
+	}
+
+	rows, err := imp.tx.Query(`SELECT nextval(pg_get_serial_sequence($1, $2)) FROM generate_series(1, $3)`,
+		pq.QuoteIdentifier(table), ts.pk, n)
+	if err != nil {
+		return nil, fmt.Errorf("error allocating %s IDs: %w", table, err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id sql.NullInt64
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("error allocating %s IDs: %w", table, err)
+		}
+		if !id.Valid {
+			return nil, fmt.Errorf("table %s has no sequence for %s", table, ts.pk)
+		}
+		ids = append(ids, id.Int64)
+	}
+	return ids, rows.Err()
+}
+
+// idKey makes IDs comparable whatever JSON type they were read as
+func idKey(value interface{}) string {
+	return fmt.Sprint(value)
+}
+
+// SaveDryRun records a valid dry run of an archive for the actor's company until expiresAt. A
+// repeated dry run of the same archive replaces the previous one.
+func (r *TenantTransferRepository) SaveDryRun(actor database.Actor, report *models.TenantImportReport, expiresAt time.Time) error {
+	data, err := json.Marshal(report)
+	if err != nil {
+		return fmt.Errorf("error encoding dry run report: %w", err)
+	}
+	_, err = database.Tenant(r.db, actor.CompanyID).Exec(`
+		INSERT INTO tenant_import_dry_runs (company_id, checksum, report, created_by, expires_at)
+		VALUES ($1, $2, $3, NULLIF($4, 0), $5)
+		ON CONFLICT (company_id, checksum) DO UPDATE
+		SET report = EXCLUDED.report, created_by = EXCLUDED.created_by, created_at = NOW(), expires_at = EXCLUDED.expires_at`,
+		actor.CompanyID, report.Checksum, string(data), actor.UserID, expiresAt)
+	if err != nil {
+		return fmt.Errorf("error saving dry run: %w", err)
+	}
+	return nil
+}
+
+// ConsumeDryRun removes the unexpired dry run of the archive with the checksum and returns its
+// report, or nil if the company has none. Each dry run allows applying its archive once.
+func (r *TenantTransferRepository) ConsumeDryRun(companyID, checksum string) (*models.TenantImportReport, error) {
+	var data []byte
+	err := database.Tenant(r.db, companyID).QueryRow(`
+		DELETE FROM tenant_import_dry_runs
+		WHERE company_id = $1 AND checksum = $2 AND expires_at > NOW()
+		RETURNING report`, companyID, checksum).Scan(&data)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error loading dry run: %w", err)
+	}
+	var report models.TenantImportReport
+	if err := json.Unmarshal(data, &report); err != nil {
+		return nil, fmt.Errorf("error decoding dry run report: %w", err)
+	}
+	return &report, nil
+}
+
+// DeleteExpiredDryRuns removes dry runs whose archive was not applied in time (all companies)
+func (r *TenantTransferRepository) DeleteExpiredDryRuns() (int64, error) {
+	result, err := database.System(r.db).Exec(`DELETE FROM tenant_import_dry_runs WHERE expires_at <= NOW()`)
+	if err != nil {
+		return 0, fmt.Errorf("error deleting expired dry runs: %w", err)
+	}
+	return result.RowsAffected()
+}
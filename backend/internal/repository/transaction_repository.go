@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"time"
 
+	"classmate-central/internal/database"
 	"classmate-central/internal/models"
 )
 
@@ -18,11 +19,14 @@ func NewTransactionRepository(db *sql.DB) *TransactionRepository {
 
 func (r *TransactionRepository) Create(transaction *models.Transaction, companyID string) error {
 	query := `
-		INSERT INTO transaction (payment_id, invoice_id, subscription_id, amount, kind, company_id)
-		VALUES ($1, $2, $3, $4, $5, $6)
-		RETURNING id, created_at
+		INSERT INTO transaction (payment_id, invoice_id, subscription_id, amount, kind, company_id, currency)
+		VALUES ($1, $2, $3, $4, $5, $6, COALESCE(
+			(SELECT currency FROM payment_transactions WHERE id = $1),
+			(SELECT currency FROM invoice WHERE id = $2),
+			(SELECT currency FROM student_subscriptions WHERE id = $3)))
+		RETURNING id, created_at, currency
 	`
-	err := r.db.QueryRow(
+	err := database.Tenant(r.db, companyID).QueryRow(
 		query,
 		transaction.PaymentID,
 		transaction.InvoiceID,
@@ -30,7 +34,7 @@ func (r *TransactionRepository) Create(transaction *models.Transaction, companyI
 		transaction.Amount,
 		transaction.Kind,
 		companyID,
-	).Scan(&transaction.ID, &transaction.CreatedAt)
+	).Scan(&transaction.ID, &transaction.CreatedAt, &transaction.Currency)
 	if err != nil {
 		return fmt.Errorf("error creating transaction: %w", err)
 	}
@@ -43,9 +47,9 @@ func (r *TransactionRepository) GetByID(id int64, companyID string) (*models.Tra
 	var invoiceID sql.NullInt64
 	var subscriptionID sql.NullString
 
-	query := `SELECT id, payment_id, invoice_id, subscription_id, amount, kind, company_id, created_at 
+	query := `SELECT id, payment_id, invoice_id, subscription_id, amount, kind, company_id, created_at, currency
 	          FROM transaction WHERE id = $1 AND company_id = $2`
-	err := r.db.QueryRow(query, id, companyID).Scan(
+	err := database.Tenant(r.db, companyID).QueryRow(query, id, companyID).Scan(
 		&transaction.ID,
 		&paymentID,
 		&invoiceID,
@@ -54,6 +58,7 @@ func (r *TransactionRepository) GetByID(id int64, companyID string) (*models.Tra
 		&transaction.Kind,
 		&transaction.CompanyID,
 		&transaction.CreatedAt,
+		&transaction.Currency,
 	)
 	if err == sql.ErrNoRows {
 		return nil, nil
@@ -73,18 +78,19 @@ func (r *TransactionRepository) GetByID(id int64, companyID string) (*models.Tra
 	if subscriptionID.Valid {
 		transaction.SubscriptionID = &subscriptionID.String
 	}
+	transaction.ApplyCurrency()
 
 	return transaction, nil
 }
 
 func (r *TransactionRepository) GetByPaymentID(paymentID int, companyID string) ([]*models.Transaction, error) {
 	query := `
-		SELECT id, payment_id, invoice_id, subscription_id, amount, kind, company_id, created_at 
+		SELECT id, payment_id, invoice_id, subscription_id, amount, kind, company_id, created_at, currency
 		FROM transaction 
 		WHERE payment_id = $1 AND company_id = $2
 		ORDER BY created_at DESC
 	`
-	rows, err := r.db.Query(query, paymentID, companyID)
+	rows, err := database.Tenant(r.db, companyID).Query(query, paymentID, companyID)
 	if err != nil {
 		return nil, fmt.Errorf("error getting transactions: %w", err)
 	}
@@ -95,12 +101,12 @@ func (r *TransactionRepository) GetByPaymentID(paymentID int, companyID string)
 
 func (r *TransactionRepository) GetByInvoiceID(invoiceID int64, companyID string) ([]*models.Transaction, error) {
 	query := `
-		SELECT id, payment_id, invoice_id, subscription_id, amount, kind, company_id, created_at 
+		SELECT id, payment_id, invoice_id, subscription_id, amount, kind, company_id, created_at, currency
 		FROM transaction 
 		WHERE invoice_id = $1 AND company_id = $2
 		ORDER BY created_at DESC
 	`
-	rows, err := r.db.Query(query, invoiceID, companyID)
+	rows, err := database.Tenant(r.db, companyID).Query(query, invoiceID, companyID)
 	if err != nil {
 		return nil, fmt.Errorf("error getting transactions: %w", err)
 	}
@@ -111,12 +117,12 @@ func (r *TransactionRepository) GetByInvoiceID(invoiceID int64, companyID string
 
 func (r *TransactionRepository) GetBySubscriptionID(subscriptionID string, companyID string) ([]*models.Transaction, error) {
 	query := `
-		SELECT id, payment_id, invoice_id, subscription_id, amount, kind, company_id, created_at 
+		SELECT id, payment_id, invoice_id, subscription_id, amount, kind, company_id, created_at, currency
 		FROM transaction 
 		WHERE subscription_id = $1 AND company_id = $2
 		ORDER BY created_at DESC
 	`
-	rows, err := r.db.Query(query, subscriptionID, companyID)
+	rows, err := database.Tenant(r.db, companyID).Query(query, subscriptionID, companyID)
 	if err != nil {
 		return nil, fmt.Errorf("error getting transactions: %w", err)
 	}
@@ -127,12 +133,12 @@ func (r *TransactionRepository) GetBySubscriptionID(subscriptionID string, compa
 
 func (r *TransactionRepository) GetInRange(start, end time.Time, companyID string) ([]*models.Transaction, error) {
 	query := `
-		SELECT id, payment_id, invoice_id, subscription_id, amount, kind, company_id, created_at 
+		SELECT id, payment_id, invoice_id, subscription_id, amount, kind, company_id, created_at, currency
 		FROM transaction 
 		WHERE company_id = $1 AND created_at >= $2 AND created_at < $3
 		ORDER BY created_at DESC
 	`
-	rows, err := r.db.Query(query, companyID, start, end)
+	rows, err := database.Tenant(r.db, companyID).Query(query, companyID, start, end)
 	if err != nil {
 		return nil, fmt.Errorf("error getting transactions in range: %w", err)
 	}
@@ -158,6 +164,7 @@ func (r *TransactionRepository) scanTransactions(rows *sql.Rows) ([]*models.Tran
 			&transaction.Kind,
 			&transaction.CompanyID,
 			&transaction.CreatedAt,
+			&transaction.Currency,
 		)
 		if err != nil {
 			return nil, fmt.Errorf("error scanning transaction: %w", err)
@@ -174,6 +181,7 @@ func (r *TransactionRepository) scanTransactions(rows *sql.Rows) ([]*models.Tran
 		if subscriptionID.Valid {
 			transaction.SubscriptionID = &subscriptionID.String
 		}
+		transaction.ApplyCurrency()
 
 		transactions = append(transactions, transaction)
 	}
@@ -183,7 +191,7 @@ func (r *TransactionRepository) scanTransactions(rows *sql.Rows) ([]*models.Tran
 
 func (r *TransactionRepository) Delete(id int64, companyID string) error {
 	query := `DELETE FROM transaction WHERE id = $1 AND company_id = $2`
-	_, err := r.db.Exec(query, id, companyID)
+	_, err := database.Tenant(r.db, companyID).Exec(query, id, companyID)
 	if err != nil {
 		return fmt.Errorf("error deleting transaction: %w", err)
 	}
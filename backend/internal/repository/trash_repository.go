@@ -0,0 +1,206 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"classmate-central/internal/database"
+	"classmate-central/internal/models"
+
+	"github.com/lib/pq"
+)
+
+// ErrRestoreConflict is returned when a restored record would clash with an active one (e.g. the same email)
+var ErrRestoreConflict = errors.New("an active record with the same unique data exists")
+
+// ErrUnknownTrashType is returned for a type that has no trash
+var ErrUnknownTrashType = errors.New("unknown trash type")
+
+// trashTable describes a soft-deletable table. financialRefs is a condition on alias x that
+// is true while financial records (or rows that a hard delete would cascade into) refer to
+// the row; such rows are never purged.
+type trashTable struct {
+	table         string
+	nameColumn    string
+	financialRefs string
+}
+
+var trashTables = map[string]trashTable{
+	models.TrashLesson: {
+		table:         "lessons",
+		nameColumn:    "title",
+		financialRefs: `EXISTS (SELECT 1 FROM lesson_attendance la WHERE la.lesson_id = x.id)`,
+	},
+	models.TrashGroup: {
+		table:      "groups",
+		nameColumn: "name",
+		financialRefs: `EXISTS (SELECT 1 FROM student_subscriptions ss WHERE ss.group_id = x.id)
+			OR EXISTS (SELECT 1 FROM lessons l JOIN lesson_attendance la ON la.lesson_id = l.id WHERE l.group_id = x.id)`,
+	},
+	models.TrashStudent: {
+		table:      "students",
+		nameColumn: "name",
+		financialRefs: `EXISTS (SELECT 1 FROM payment_transactions pt WHERE pt.student_id = x.id)
+			OR EXISTS (SELECT 1 FROM student_subscriptions ss WHERE ss.student_id = x.id)
+			OR EXISTS (SELECT 1 FROM debt_records d WHERE d.student_id = x.id)
+			OR EXISTS (SELECT 1 FROM invoice i WHERE i.student_id = x.id)
+			OR EXISTS (SELECT 1 FROM installment_plans ip WHERE ip.student_id = x.id)
+			OR EXISTS (SELECT 1 FROM payment_intents pi WHERE pi.student_id = x.id)
+			OR EXISTS (SELECT 1 FROM lesson_attendance la WHERE la.student_id = x.id)`,
+	},
+	// Lessons cascade with their teacher, so any lesson keeps the teacher
+	models.TrashTeacher: {
+		table:      "teachers",
+		nameColumn: "name",
+		financialRefs: `EXISTS (SELECT 1 FROM student_subscriptions ss WHERE ss.teacher_id = x.id)
+			OR EXISTS (SELECT 1 FROM lessons l WHERE l.teacher_id = x.id)`,
+	},
+	// Almost every table cascades with its branch, so any data keeps the branch
+	models.TrashBranch: {
+		table:      "branches",
+		nameColumn: "name",
+		financialRefs: `EXISTS (SELECT 1 FROM students s WHERE s.branch_id = x.id)
+			OR EXISTS (SELECT 1 FROM teachers t WHERE t.branch_id = x.id)
+			OR EXISTS (SELECT 1 FROM groups g WHERE g.branch_id = x.id)
+			OR EXISTS (SELECT 1 FROM lessons l WHERE l.branch_id = x.id)
+			OR EXISTS (SELECT 1 FROM payment_transactions pt WHERE pt.branch_id = x.id)
+			OR EXISTS (SELECT 1 FROM debt_records d WHERE d.branch_id = x.id)
+			OR EXISTS (SELECT 1 FROM student_subscriptions ss WHERE ss.branch_id = x.id)
+			OR EXISTS (SELECT 1 FROM cash_shifts cs WHERE cs.branch_id = x.id)
+			OR EXISTS (SELECT 1 FROM invoice i WHERE i.branch_id = x.id)`,
+	},
+}
+
+// trashPurgeOrder purges children before the rows they point to
+var trashPurgeOrder = []string{models.TrashLesson, models.TrashGroup, models.TrashStudent, models.TrashTeacher, models.TrashBranch}
+
+type TrashRepository struct {
+	db *sql.DB
+}
+
+func NewTrashRepository(db *sql.DB) *TrashRepository {
+	return &TrashRepository{db: db}
+}
+
+// IsTrashType reports whether records of the type can be in the trash
+func IsTrashType(entityType string) bool {
+	_, ok := trashTables[entityType]
+	return ok
+}
+
+// List returns the company's records deleted at or after since, newest first. An empty
+// entityType lists every type.
+func (r *TrashRepository) List(companyID, entityType string, since time.Time) ([]*models.TrashItem, error) {
+	types := trashPurgeOrder
+	if entityType != "" {
+		if !IsTrashType(entityType) {
+			return nil, ErrUnknownTrashType
+		}
+		types = []string{entityType}
+	}
+
+	selects := make([]string, len(types))
+	for i, t := range types {
+		tt := trashTables[t]
+		selects[i] = fmt.Sprintf(`SELECT '%s' AS type, id, %s AS name, deleted_at, deleted_by FROM %s
+			WHERE company_id = $1 AND deleted_at IS NOT NULL AND deleted_at >= $2`, t, tt.nameColumn, tt.table)
+	}
+	query := `
+		SELECT x.type, x.id, COALESCE(x.name, ''), x.deleted_at, x.deleted_by, COALESCE(u.name, '')
+		FROM (` + strings.Join(selects, " UNION ALL ") + `) x
+		LEFT JOIN users u ON u.id = x.deleted_by
+		ORDER BY x.deleted_at DESC, x.id`
+
+	rows, err := database.Tenant(r.db, companyID).Query(query, companyID, since)
+	if err != nil {
+		return nil, fmt.Errorf("error listing trash: %w", err)
+	}
+	defer rows.Close()
+
+	items := []*models.TrashItem{}
+	for rows.Next() {
+		item := &models.TrashItem{}
+		var deletedBy sql.NullInt64
+		if err := rows.Scan(&item.Type, &item.ID, &item.Name, &item.DeletedAt, &deletedBy, &item.DeletedByName); err != nil {
+			return nil, fmt.Errorf("error scanning trash item: %w", err)
+		}
+		if deletedBy.Valid {
+			id := int(deletedBy.Int64)
+			item.DeletedBy = &id
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+// Restore brings back a record deleted at or after since. Restoring a group also restores
+// the lessons deleted with it. Returns sql.ErrNoRows if there is no such record in the trash.
+func (r *TrashRepository) Restore(entityType, id string, since time.Time, actor database.Actor) error {
+	tt, ok := trashTables[entityType]
+	if !ok {
+		return ErrUnknownTrashType
+	}
+
+	err := database.WithActor(r.db, actor, func(tx *sql.Tx) error {
+		var deletedAt time.Time
+		err := tx.QueryRow(fmt.Sprintf(`
+			SELECT deleted_at FROM %s
+			WHERE id = $1 AND company_id = $2 AND deleted_at IS NOT NULL AND deleted_at >= $3
+			FOR UPDATE`, tt.table), id, actor.CompanyID, since).Scan(&deletedAt)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(fmt.Sprintf(`UPDATE %s SET deleted_at = NULL, deleted_by = NULL WHERE id = $1 AND company_id = $2`, tt.table),
+			id, actor.CompanyID)
+		if err != nil {
+			return err
+		}
+
+		if entityType == models.TrashGroup {
+			_, err = tx.Exec(`
+				UPDATE lessons SET deleted_at = NULL, deleted_by = NULL
+				WHERE group_id = $1 AND company_id = $2 AND deleted_at = $3`, id, actor.CompanyID, deletedAt)
+		}
+		return err
+	})
+	if err == sql.ErrNoRows {
+		return err
+	}
+	if err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+			return ErrRestoreConflict
+		}
+		return fmt.Errorf("error restoring %s: %w", entityType, err)
+	}
+	return nil
+}
+
+// Purge permanently deletes records deleted before the given time, except those financial
+// records still refer to. An empty companyID purges all companies.
+func (r *TrashRepository) Purge(before time.Time, companyID string) (map[string]int64, error) {
+	purged := map[string]int64{}
+	for _, t := range trashPurgeOrder {
+		tt := trashTables[t]
+		result, err := database.TenantOrSystem(r.db, companyID).Exec(fmt.Sprintf(`
+			DELETE FROM %s x
+			WHERE x.deleted_at IS NOT NULL AND x.deleted_at < $1
+			  AND ($2 = '' OR x.company_id = $2)
+			  AND NOT (%s)`, tt.table, tt.financialRefs), before, companyID)
+		if err != nil {
+			return purged, fmt.Errorf("error purging %s: %w", tt.table, err)
+		}
+		rows, err := result.RowsAffected()
+		if err != nil {
+			return purged, fmt.Errorf("error checking purge result: %w", err)
+		}
+		if rows > 0 {
+			purged[t] = rows
+		}
+	}
+	return purged, nil
+}
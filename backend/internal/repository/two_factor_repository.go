@@ -0,0 +1,271 @@
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"classmate-central/internal/database"
+	"classmate-central/internal/models"
+)
+
+type TwoFactorRepository struct {
+	db *sql.DB
+}
+
+func NewTwoFactorRepository(db *sql.DB) *TwoFactorRepository {
+	return &TwoFactorRepository{db: db}
+}
+
+// Get returns the 2FA enrollment of a user, or nil if the user never started one
+func (r *TwoFactorRepository) Get(userID int) (*models.UserTwoFactor, error) {
+	tf := &models.UserTwoFactor{}
+	var enabledAt, lockedUntil sql.NullTime
+	err := database.System(r.db).QueryRow(`
+		SELECT user_id, secret_encrypted, enabled_at, last_used_step, failed_attempts, locked_until, created_at, updated_at
+		FROM user_two_factor WHERE user_id = $1`, userID).
+		Scan(&tf.UserID, &tf.SecretEncrypted, &enabledAt, &tf.LastUsedStep, &tf.FailedAttempts, &lockedUntil, &tf.CreatedAt, &tf.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error getting two-factor settings: %w", err)
+	}
+	if enabledAt.Valid {
+		tf.EnabledAt = &enabledAt.Time
+	}
+	if lockedUntil.Valid {
+		tf.LockedUntil = &lockedUntil.Time
+	}
+	return tf, nil
+}
+
+// SavePendingSecret stores a new, not yet confirmed secret. An enabled enrollment is
+// never overwritten: the call returns sql.ErrNoRows instead.
+func (r *TwoFactorRepository) SavePendingSecret(userID int, secretEncrypted string) error {
+	result, err := database.System(r.db).Exec(`
+		INSERT INTO user_two_factor (user_id, secret_encrypted)
+		VALUES ($1, $2)
+		ON CONFLICT (user_id) DO UPDATE
+		SET secret_encrypted = EXCLUDED.secret_encrypted, last_used_step = 0, updated_at = CURRENT_TIMESTAMP
+		WHERE user_two_factor.enabled_at IS NULL`, userID, secretEncrypted)
+	if err != nil {
+		return fmt.Errorf("error saving two-factor secret: %w", err)
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error checking two-factor secret update: %w", err)
+	}
+	if rows == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// Enable confirms a pending enrollment, records the TOTP step that confirmed it and
+// replaces the recovery codes
+func (r *TwoFactorRepository) Enable(userID int, step int64, recoveryCodeHashes []string) error {
+	tx, err := database.System(r.db).Begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`
+		UPDATE user_two_factor
+		SET enabled_at = CURRENT_TIMESTAMP, last_used_step = $2, updated_at = CURRENT_TIMESTAMP
+		WHERE user_id = $1 AND enabled_at IS NULL`, userID, step)
+	if err != nil {
+		return fmt.Errorf("error enabling two-factor authentication: %w", err)
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error checking two-factor update: %w", err)
+	}
+	if rows == 0 {
+		return sql.ErrNoRows
+	}
+
+	if err := replaceRecoveryCodes(tx, userID, recoveryCodeHashes); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Delete removes the enrollment and the recovery codes of a user
+func (r *TwoFactorRepository) Delete(userID int) error {
+	tx, err := database.System(r.db).Begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM two_factor_recovery_codes WHERE user_id = $1`, userID); err != nil {
+		return fmt.Errorf("error deleting recovery codes: %w", err)
+	}
+	if _, err := tx.Exec(`DELETE FROM user_two_factor WHERE user_id = $1`, userID); err != nil {
+		return fmt.Errorf("error deleting two-factor settings: %w", err)
+	}
+	return tx.Commit()
+}
+
+// AcceptStep records a used TOTP step. It returns false when the same or a later step was
+// already accepted, so a code cannot be replayed even by concurrent requests.
+func (r *TwoFactorRepository) AcceptStep(userID int, step int64) (bool, error) {
+	result, err := database.System(r.db).Exec(`
+		UPDATE user_two_factor SET last_used_step = $2, updated_at = CURRENT_TIMESTAMP
+		WHERE user_id = $1 AND enabled_at IS NOT NULL AND last_used_step < $2`, userID, step)
+	if err != nil {
+		return false, fmt.Errorf("error recording two-factor code: %w", err)
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("error checking two-factor code update: %w", err)
+	}
+	return rows > 0, nil
+}
+
+// RecordFailedAttempt counts an invalid code and returns the number of consecutive failures
+func (r *TwoFactorRepository) RecordFailedAttempt(userID int) (int, error) {
+	var count int
+	err := database.System(r.db).QueryRow(`
+		UPDATE user_two_factor SET failed_attempts = failed_attempts + 1
+		WHERE user_id = $1
+		RETURNING failed_attempts`, userID).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("error recording failed two-factor code: %w", err)
+	}
+	return count, nil
+}
+
+// LockUntil refuses further codes of the user until the given time
+func (r *TwoFactorRepository) LockUntil(userID int, until time.Time) error {
+	_, err := database.System(r.db).Exec(`UPDATE user_two_factor SET locked_until = $2 WHERE user_id = $1`, userID, until)
+	if err != nil {
+		return fmt.Errorf("error locking two-factor codes: %w", err)
+	}
+	return nil
+}
+
+// ResetFailedAttempts clears the failed code counter and any lock
+func (r *TwoFactorRepository) ResetFailedAttempts(userID int) error {
+	_, err := database.System(r.db).Exec(`
+		UPDATE user_two_factor SET failed_attempts = 0, locked_until = NULL
+		WHERE user_id = $1 AND (failed_attempts <> 0 OR locked_until IS NOT NULL)`, userID)
+	if err != nil {
+		return fmt.Errorf("error resetting failed two-factor codes: %w", err)
+	}
+	return nil
+}
+
+// ReplaceRecoveryCodes invalidates all recovery codes of a user and stores new ones
+func (r *TwoFactorRepository) ReplaceRecoveryCodes(userID int, codeHashes []string) error {
+	tx, err := database.System(r.db).Begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := replaceRecoveryCodes(tx, userID, codeHashes); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func replaceRecoveryCodes(tx *sql.Tx, userID int, codeHashes []string) error {
+	if _, err := tx.Exec(`DELETE FROM two_factor_recovery_codes WHERE user_id = $1`, userID); err != nil {
+		return fmt.Errorf("error deleting recovery codes: %w", err)
+	}
+	for _, hash := range codeHashes {
+		if _, err := tx.Exec(`INSERT INTO two_factor_recovery_codes (user_id, code_hash) VALUES ($1, $2)`, userID, hash); err != nil {
+			return fmt.Errorf("error storing recovery code: %w", err)
+		}
+	}
+	return nil
+}
+
+// UseRecoveryCode marks an unused recovery code as used; it returns false if there is none
+func (r *TwoFactorRepository) UseRecoveryCode(userID int, codeHash string) (bool, error) {
+	result, err := database.System(r.db).Exec(`
+		UPDATE two_factor_recovery_codes SET used_at = CURRENT_TIMESTAMP
+		WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL`, userID, codeHash)
+	if err != nil {
+		return false, fmt.Errorf("error using recovery code: %w", err)
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("error checking recovery code update: %w", err)
+	}
+	return rows > 0, nil
+}
+
+// CountRecoveryCodes returns how many unused recovery codes a user has left
+func (r *TwoFactorRepository) CountRecoveryCodes(userID int) (int, error) {
+	var count int
+	err := database.System(r.db).QueryRow(`SELECT COUNT(*) FROM two_factor_recovery_codes WHERE user_id = $1 AND used_at IS NULL`, userID).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("error counting recovery codes: %w", err)
+	}
+	return count, nil
+}
+
+// CreateChallenge stores a login challenge by the hash of its token
+func (r *TwoFactorRepository) CreateChallenge(tokenHash string, userID int, expiresAt time.Time, ip string) error {
+	_, err := database.System(r.db).Exec(`
+		INSERT INTO two_factor_challenges (token_hash, user_id, expires_at, ip)
+		VALUES ($1, $2, $3, $4)`, tokenHash, userID, expiresAt, ip)
+	if err != nil {
+		return fmt.Errorf("error creating two-factor challenge: %w", err)
+	}
+	return nil
+}
+
+// AttemptChallenge counts an attempt to answer a challenge and returns its state after
+// the attempt, or nil if the token is unknown
+func (r *TwoFactorRepository) AttemptChallenge(tokenHash string) (*models.TwoFactorChallenge, error) {
+	challenge := &models.TwoFactorChallenge{}
+	var consumedAt sql.NullTime
+	err := database.System(r.db).QueryRow(`
+		UPDATE two_factor_challenges SET attempts = attempts + 1
+		WHERE token_hash = $1
+		RETURNING user_id, attempts, expires_at, consumed_at`, tokenHash).
+		Scan(&challenge.UserID, &challenge.Attempts, &challenge.ExpiresAt, &consumedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error loading two-factor challenge: %w", err)
+	}
+	if consumedAt.Valid {
+		challenge.ConsumedAt = &consumedAt.Time
+	}
+	return challenge, nil
+}
+
+// ConsumeChallenge marks a challenge as answered; it returns false if it already was
+func (r *TwoFactorRepository) ConsumeChallenge(tokenHash string) (bool, error) {
+	result, err := database.System(r.db).Exec(`
+		UPDATE two_factor_challenges SET consumed_at = CURRENT_TIMESTAMP
+		WHERE token_hash = $1 AND consumed_at IS NULL`, tokenHash)
+	if err != nil {
+		return false, fmt.Errorf("error consuming two-factor challenge: %w", err)
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("error checking two-factor challenge update: %w", err)
+	}
+	return rows > 0, nil
+}
+
+// DeleteExpiredChallenges removes challenges that expired before the given time
+func (r *TwoFactorRepository) DeleteExpiredChallenges(before time.Time) (int64, error) {
+	result, err := database.System(r.db).Exec(`DELETE FROM two_factor_challenges WHERE expires_at < $1`, before)
+	if err != nil {
+		return 0, fmt.Errorf("error deleting expired two-factor challenges: %w", err)
+	}
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("error checking delete result: %w", err)
+	}
+	return deleted, nil
+}
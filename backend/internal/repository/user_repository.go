@@ -4,6 +4,7 @@ import (
 	"database/sql"
 	"fmt"
 
+	"classmate-central/internal/database"
 	"classmate-central/internal/models"
 )
 
@@ -22,7 +23,7 @@ func (r *UserRepository) Create(user *models.User) error {
 		RETURNING id, created_at, updated_at
 	`
 
-	err := r.db.QueryRow(query, user.Email, user.Password, user.Name, user.CompanyID, user.RoleID, user.IsEmailVerified, user.EmailVerificationToken).
+	err := database.Tenant(r.db, user.CompanyID).QueryRow(query, user.Email, user.Password, user.Name, user.CompanyID, user.RoleID, user.IsEmailVerified, user.EmailVerificationToken).
 		Scan(&user.ID, &user.CreatedAt, &user.UpdatedAt)
 	if err != nil {
 		return fmt.Errorf("error creating user: %w", err)
@@ -36,7 +37,7 @@ func (r *UserRepository) GetByEmail(email string) (*models.User, error) {
 	query := `SELECT id, email, password, name, company_id, role_id, is_email_verified, created_at, updated_at FROM users WHERE email = $1`
 
 	var roleID sql.NullString
-	err := r.db.QueryRow(query, email).Scan(
+	err := database.System(r.db).QueryRow(query, email).Scan(
 		&user.ID, &user.Email, &user.Password, &user.Name, &user.CompanyID, &roleID, &user.IsEmailVerified, &user.CreatedAt, &user.UpdatedAt,
 	)
 	if err == sql.ErrNoRows {
@@ -58,7 +59,7 @@ func (r *UserRepository) GetByID(id int) (*models.User, error) {
 	query := `SELECT id, email, password, name, company_id, role_id, is_email_verified, created_at, updated_at FROM users WHERE id = $1`
 
 	var roleID sql.NullString
-	err := r.db.QueryRow(query, id).Scan(
+	err := database.System(r.db).QueryRow(query, id).Scan(
 		&user.ID, &user.Email, &user.Password, &user.Name, &user.CompanyID, &roleID, &user.IsEmailVerified, &user.CreatedAt, &user.UpdatedAt,
 	)
 	if err == sql.ErrNoRows {
@@ -100,75 +101,61 @@ func (r *UserRepository) GetUserWithRoles(id int, companyID string) (*models.Use
 	return user, nil
 }
 
-// UpdateRoleID updates the primary role ID for a user
-func (r *UserRepository) UpdateRoleID(userID int, roleID *string) error {
-	query := `UPDATE users SET role_id = $1, updated_at = NOW() WHERE id = $2`
-	_, err := r.db.Exec(query, roleID, userID)
+// UpdateRoleID updates the primary role ID for a user of the company
+func (r *UserRepository) UpdateRoleID(userID int, roleID *string, companyID string) error {
+	query := `UPDATE users SET role_id = $1, updated_at = NOW() WHERE id = $2 AND company_id = $3`
+	_, err := database.Tenant(r.db, companyID).Exec(query, roleID, userID, companyID)
 	if err != nil {
 		return fmt.Errorf("error updating user role: %w", err)
 	}
 	return nil
 }
 
-// AssignRoleToUser assigns a role to a user
-func (r *UserRepository) AssignRoleToUser(userID int, roleID string, companyID string, assignedBy *int) error {
-	query := `
-		INSERT INTO user_roles (user_id, role_id, company_id, assigned_by, assigned_at)
-		VALUES ($1, $2, $3, $4, NOW())
-		ON CONFLICT (user_id, role_id, company_id) DO NOTHING
-	`
-
-	_, err := r.db.Exec(query, userID, roleID, companyID, assignedBy)
-	if err != nil {
-		return fmt.Errorf("error assigning role to user: %w", err)
-	}
+// AssignRoleToUser assigns a role of the actor's company to a user
+func (r *UserRepository) AssignRoleToUser(userID int, roleID string, assignedBy *int, actor database.Actor) error {
+	return database.WithActor(r.db, actor, func(tx *sql.Tx) error {
+		query := `
+			INSERT INTO user_roles (user_id, role_id, company_id, assigned_by, assigned_at)
+			VALUES ($1, $2, $3, $4, NOW())
+			ON CONFLICT (user_id, role_id, company_id) DO NOTHING
+		`
+		if _, err := tx.Exec(query, userID, roleID, actor.CompanyID, assignedBy); err != nil {
+			return fmt.Errorf("error assigning role to user: %w", err)
+		}
 
-	// Update primary role_id if this is the first role
-	user, err := r.GetByID(userID)
-	if err != nil {
-		return err
-	}
-	if user != nil && user.RoleID == nil {
-		err = r.UpdateRoleID(userID, &roleID)
+		// Update primary role_id if this is the first role
+		_, err := tx.Exec(`UPDATE users SET role_id = $1, updated_at = NOW() WHERE id = $2 AND role_id IS NULL`, roleID, userID)
 		if err != nil {
-			return err
+			return fmt.Errorf("error updating user role: %w", err)
 		}
-	}
-
-	return nil
+		return nil
+	})
 }
 
-// RemoveRoleFromUser removes a role from a user
-func (r *UserRepository) RemoveRoleFromUser(userID int, roleID string, companyID string) error {
-	query := `DELETE FROM user_roles WHERE user_id = $1 AND role_id = $2 AND company_id = $3`
-	_, err := r.db.Exec(query, userID, roleID, companyID)
-	if err != nil {
-		return fmt.Errorf("error removing role from user: %w", err)
-	}
-
-	// If this was the primary role, update primary role_id
-	user, err := r.GetByID(userID)
-	if err != nil {
-		return err
-	}
-	if user != nil && user.RoleID != nil && *user.RoleID == roleID {
-		// Get remaining roles and set first one as primary
-		roleRepo := NewRoleRepository(r.db)
-		roles, err := roleRepo.GetUserRoles(userID, companyID)
-		if err != nil {
-			return err
+// RemoveRoleFromUser removes a role of the actor's company from a user
+func (r *UserRepository) RemoveRoleFromUser(userID int, roleID string, actor database.Actor) error {
+	return database.WithActor(r.db, actor, func(tx *sql.Tx) error {
+		query := `DELETE FROM user_roles WHERE user_id = $1 AND role_id = $2 AND company_id = $3`
+		if _, err := tx.Exec(query, userID, roleID, actor.CompanyID); err != nil {
+			return fmt.Errorf("error removing role from user: %w", err)
 		}
-		if len(roles) > 0 {
-			err = r.UpdateRoleID(userID, &roles[0].ID)
-		} else {
-			err = r.UpdateRoleID(userID, nil)
-		}
-		if err != nil {
-			return err
-		}
-	}
 
-	return nil
+		// If this was the primary role, the first remaining role (by name) becomes primary
+		query = `
+			UPDATE users SET role_id = (
+				SELECT r.id FROM roles r
+				INNER JOIN user_roles ur ON r.id = ur.role_id
+				WHERE ur.user_id = $1 AND ur.company_id = $3
+				ORDER BY r.name
+				LIMIT 1
+			), updated_at = NOW()
+			WHERE id = $1 AND role_id = $2
+		`
+		if _, err := tx.Exec(query, userID, roleID, actor.CompanyID); err != nil {
+			return fmt.Errorf("error updating user role: %w", err)
+		}
+		return nil
+	})
 }
 
 // GetAll gets all users for a company with their roles
@@ -180,7 +167,7 @@ func (r *UserRepository) GetAll(companyID string) ([]*models.User, error) {
 		ORDER BY created_at DESC
 	`
 
-	rows, err := r.db.Query(query, companyID)
+	rows, err := database.Tenant(r.db, companyID).Query(query, companyID)
 	if err != nil {
 		return nil, fmt.Errorf("error getting users: %w", err)
 	}
@@ -2,15 +2,23 @@ package repository
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
+	"time"
 
+	"classmate-central/internal/database"
 	"classmate-central/internal/models"
+
+	"github.com/lib/pq"
 )
 
+// ErrEmailTaken is returned when changing a user's email to an address another user has
+var ErrEmailTaken = errors.New("email is already in use")
+
 // VerifyEmail verifies a user's email by code
 func (r *UserRepository) VerifyEmail(email, code string) error {
 	query := `UPDATE users SET is_email_verified = TRUE, email_verification_token = NULL WHERE email = $1 AND email_verification_token = $2`
-	result, err := r.db.Exec(query, email, code)
+	result, err := database.System(r.db).Exec(query, email, code)
 	if err != nil {
 		return fmt.Errorf("error verifying email: %w", err)
 	}
@@ -34,7 +42,7 @@ func (r *UserRepository) GetByVerificationToken(token string) (*models.User, err
 
 // UpdateVerificationCode sets a new verification code for a user
 func (r *UserRepository) UpdateVerificationCode(userID int, code string) error {
-	_, err := r.db.Exec(`UPDATE users SET email_verification_token = $1, updated_at = NOW() WHERE id = $2`, code, userID)
+	_, err := database.System(r.db).Exec(`UPDATE users SET email_verification_token = $1, updated_at = NOW() WHERE id = $2`, code, userID)
 	if err != nil {
 		return fmt.Errorf("error updating verification code: %w", err)
 	}
@@ -55,7 +63,7 @@ func (r *UserRepository) CompleteInvite(email, code, passwordHash string) (*mode
 	`
 
 	var roleID sql.NullString
-	err := r.db.QueryRow(query, passwordHash, email, code).Scan(
+	err := database.System(r.db).QueryRow(query, passwordHash, email, code).Scan(
 		&user.ID, &user.Email, &user.Name, &user.CompanyID, &roleID, &user.IsEmailVerified, &user.CreatedAt, &user.UpdatedAt,
 	)
 	if err == sql.ErrNoRows {
@@ -72,13 +80,157 @@ func (r *UserRepository) CompleteInvite(email, code, passwordHash string) (*mode
 	return user, nil
 }
 
+// UpdatePassword stores a new password hash, records when the password was changed, clears any
+// login lock and revokes every open session of the user. It runs as one transaction, so a new
+// password never leaves the sessions opened with the old one alive. It returns the number of
+// revoked sessions.
+func (r *UserRepository) UpdatePassword(userID int, passwordHash string) (int64, error) {
+	tx, err := database.System(r.db).Begin()
+	if err != nil {
+		return 0, fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Whoever set a new password controls the account, so a lockout no longer serves a purpose
+	result, err := tx.Exec(`
+		UPDATE users SET password = $1, password_changed_at = NOW(), updated_at = NOW(),
+			failed_login_count = 0, locked_until = NULL
+		WHERE id = $2`, passwordHash, userID)
+	if err != nil {
+		return 0, fmt.Errorf("error updating password: %w", err)
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("error checking rows affected: %w", err)
+	}
+	if rows == 0 {
+		return 0, sql.ErrNoRows
+	}
+
+	result, err = tx.Exec(`
+		UPDATE user_sessions SET revoked_at = CURRENT_TIMESTAMP, revoke_reason = $2
+		WHERE user_id = $1 AND revoked_at IS NULL`, userID, SessionRevokePassword)
+	if err != nil {
+		return 0, fmt.Errorf("error revoking sessions: %w", err)
+	}
+	revoked, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("error checking revoke result: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("error committing password change: %w", err)
+	}
+	return revoked, nil
+}
+
+// UpdateEmail changes a user's email to an address that has just been verified
+func (r *UserRepository) UpdateEmail(userID int, email string) error {
+	result, err := database.System(r.db).Exec(`
+		UPDATE users SET email = $1, is_email_verified = TRUE, email_verification_token = NULL, updated_at = NOW()
+		WHERE id = $2`, email, userID)
+	if err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+			return ErrEmailTaken
+		}
+		return fmt.Errorf("error updating email: %w", err)
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error checking rows affected: %w", err)
+	}
+	if rows == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// MarkEmailVerified records that the user's current email was verified elsewhere (an SSO provider)
+func (r *UserRepository) MarkEmailVerified(userID int) error {
+	_, err := database.System(r.db).Exec(`
+		UPDATE users SET is_email_verified = TRUE, email_verification_token = NULL, updated_at = NOW()
+		WHERE id = $1 AND NOT is_email_verified`, userID)
+	if err != nil {
+		return fmt.Errorf("error marking email verified: %w", err)
+	}
+	return nil
+}
+
+// GetLockedUntil returns until when the account is locked after failed logins, or nil
+func (r *UserRepository) GetLockedUntil(userID int) (*time.Time, error) {
+	var lockedUntil sql.NullTime
+	err := database.System(r.db).QueryRow(`SELECT locked_until FROM users WHERE id = $1 AND locked_until > NOW()`, userID).Scan(&lockedUntil)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error checking account lock: %w", err)
+	}
+	if !lockedUntil.Valid {
+		return nil, nil
+	}
+	return &lockedUntil.Time, nil
+}
+
+// RecordFailedLogin counts a failed login and returns the number of consecutive failures
+func (r *UserRepository) RecordFailedLogin(userID int) (int, error) {
+	var count int
+	err := database.System(r.db).QueryRow(`
+		UPDATE users SET failed_login_count = failed_login_count + 1, last_failed_login_at = NOW()
+		WHERE id = $1
+		RETURNING failed_login_count`, userID).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("error recording failed login: %w", err)
+	}
+	return count, nil
+}
+
+// LockUntil locks the account against logins until the given time
+func (r *UserRepository) LockUntil(userID int, until time.Time) error {
+	_, err := database.System(r.db).Exec(`UPDATE users SET locked_until = $2 WHERE id = $1`, userID, until)
+	if err != nil {
+		return fmt.Errorf("error locking account: %w", err)
+	}
+	return nil
+}
+
+// ResetFailedLogins clears the failed login counter and any lock
+func (r *UserRepository) ResetFailedLogins(userID int) error {
+	_, err := database.System(r.db).Exec(`
+		UPDATE users SET failed_login_count = 0, locked_until = NULL
+		WHERE id = $1 AND (failed_login_count <> 0 OR locked_until IS NOT NULL)`, userID)
+	if err != nil {
+		return fmt.Errorf("error resetting failed logins: %w", err)
+	}
+	return nil
+}
+
+// Unlock clears the lock of a user of the company (admin action)
+func (r *UserRepository) Unlock(userID int, companyID string) error {
+	result, err := database.Tenant(r.db, companyID).Exec(`
+		UPDATE users SET failed_login_count = 0, locked_until = NULL
+		WHERE id = $1 AND company_id = $2`, userID, companyID)
+	if err != nil {
+		return fmt.Errorf("error unlocking account: %w", err)
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error checking rows affected: %w", err)
+	}
+	if rows == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
 // getByToken is an internal helper retained for compatibility
 func (r *UserRepository) getByToken(token string) (*models.User, error) {
 	user := &models.User{}
 	query := `SELECT id, email, password, name, company_id, role_id, is_email_verified, created_at, updated_at FROM users WHERE email_verification_token = $1`
 
 	var roleID sql.NullString
-	err := r.db.QueryRow(query, token).Scan(
+	err := database.System(r.db).QueryRow(query, token).Scan(
 		&user.ID, &user.Email, &user.Password, &user.Name, &user.CompanyID, &roleID, &user.IsEmailVerified, &user.CreatedAt, &user.UpdatedAt,
 	)
 	if err == sql.ErrNoRows {
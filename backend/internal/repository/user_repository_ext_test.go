@@ -0,0 +1,69 @@
+package repository
+
+import (
+	"testing"
+	"time"
+
+	"classmate-central/internal/database"
+	"classmate-central/internal/models"
+	"classmate-central/internal/testutil"
+)
+
+// TestUpdatePassword_RevokesSessionsAndClearsLock checks that a new password closes every open
+// session of the user and lifts a login lock together with the password change
+func TestUpdatePassword_RevokesSessionsAndClearsLock(t *testing.T) {
+	db := testutil.SetupTestDB(t)
+	defer db.Close()
+	defer testutil.CleanupTestDB(t, db)
+
+	const companyID = "password-company"
+	if _, err := database.System(db).Exec(`INSERT INTO companies (id, name) VALUES ($1, $1)`, companyID); err != nil {
+		t.Fatal(err)
+	}
+	users := NewUserRepository(db)
+	sessions := NewSessionRepository(db)
+
+	user := &models.User{Email: "password@example.com", Password: "old-hash", Name: "Password User", CompanyID: companyID}
+	if err := users.Create(user); err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []string{"password-session-1", "password-session-2"} {
+		session := &models.UserSession{ID: id, UserID: user.ID, CompanyID: companyID, ExpiresAt: time.Now().Add(time.Hour)}
+		if err := sessions.Create(session, id+"-refresh"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := users.LockUntil(user.ID, time.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+
+	revoked, err := users.UpdatePassword(user.ID, "new-hash")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if revoked != 2 {
+		t.Errorf("revoked %d sessions, want 2", revoked)
+	}
+
+	active, err := sessions.ListActive(user.ID, companyID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(active) != 0 {
+		t.Errorf("%d sessions still active after the password change", len(active))
+	}
+	lockedUntil, err := users.GetLockedUntil(user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lockedUntil != nil {
+		t.Errorf("account still locked until %v after the password change", lockedUntil)
+	}
+	stored, err := users.GetByID(user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.Password != "new-hash" {
+		t.Errorf("password = %q, want the new hash", stored.Password)
+	}
+}
@@ -0,0 +1,555 @@
+// Package server wires the repositories, services and handlers of the API and mounts its routes.
+// cmd/api serves the router and runs the jobs; tests walk the same router, so they cover every
+// route that is served.
+package server
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"classmate-central/internal/fiscal"
+	"classmate-central/internal/gateway"
+	"classmate-central/internal/handlers"
+	"classmate-central/internal/logger"
+	"classmate-central/internal/middleware"
+	"classmate-central/internal/models"
+	"classmate-central/internal/repository"
+	"classmate-central/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Server is the assembled API: its router and the background jobs that share its services
+type Server struct {
+	Router    *gin.Engine
+	Scheduler *services.Scheduler
+}
+
+// New builds the API on a migrated database. The scheduler is not started.
+func New(db *sql.DB) (*Server, error) {
+	// Initialize repositories
+	userRepo := repository.NewUserRepository(db)
+	companyRepo := repository.NewCompanyRepository(db)
+	teacherRepo := repository.NewTeacherRepository(db)
+	studentRepo := repository.NewStudentRepository(db)
+	groupRepo := repository.NewGroupRepository(db)
+	lessonRepo := repository.NewLessonRepository(db)
+	settingsRepo := repository.NewSettingsRepository(db)
+	roomRepo := repository.NewRoomRepository(db)
+	leadRepo := repository.NewLeadRepository(db)
+	paymentRepo := repository.NewPaymentRepository(db)
+	tariffRepo := repository.NewTariffRepository(db)
+	discountRepo := repository.NewDiscountRepository(db)
+	debtRepo := repository.NewDebtRepository(db)
+	cashShiftRepo := repository.NewCashShiftRepository(db)
+	subscriptionRepo := repository.NewSubscriptionRepository(db)
+	consumptionRepo := repository.NewSubscriptionConsumptionRepository(db)
+	activityRepo := repository.NewActivityRepository(db)
+	notificationRepo := repository.NewNotificationRepository(db)
+	roleRepo := repository.NewRoleRepository(db)
+	permRepo := repository.NewPermissionRepository(db)
+	currencyRepo := repository.NewCurrencyRepository(db)
+	installmentRepo := repository.NewInstallmentRepository(db)
+	paymentIntentRepo := repository.NewPaymentIntentRepository(db)
+	invoiceRepo := repository.NewInvoiceRepository(db)
+	fiscalReceiptRepo := repository.NewFiscalReceiptRepository(db)
+	sessionRepo := repository.NewSessionRepository(db)
+
+	// Initialize services
+	activityService := services.NewActivityService(activityRepo)
+	emailService := services.NewEmailService()
+	notificationService := services.NewNotificationService(notificationRepo, debtRepo, subscriptionRepo)
+	attendanceService := services.NewAttendanceService(subscriptionRepo, consumptionRepo, activityRepo, notificationRepo, emailService, studentRepo, lessonRepo, db)
+	subscriptionService := services.NewSubscriptionService(subscriptionRepo, lessonRepo, activityRepo, db)
+	exportService := services.NewExportService()
+	currencyService := services.NewCurrencyService(currencyRepo)
+	installmentService := services.NewInstallmentService(installmentRepo, subscriptionRepo, studentRepo, notificationRepo, emailService)
+	onlinePaymentService := services.NewOnlinePaymentService(paymentIntentRepo, invoiceRepo, studentRepo, gateway.NewRegistryFromEnv())
+	fiscalService := services.NewFiscalService(fiscalReceiptRepo, fiscal.NewOperatorFromEnv())
+	sessionService := services.NewSessionService(sessionRepo)
+	twoFactorService := services.NewTwoFactorService(repository.NewTwoFactorRepository(db))
+	accountService := services.NewAccountService(userRepo, repository.NewAccountTokenRepository(db), emailService)
+	loginSecurityService := services.NewLoginSecurityService(userRepo, repository.NewLoginEventRepository(db), emailService)
+	planService := services.NewPlanService(repository.NewPlanRepository(db), companyRepo)
+	ssoService := services.NewSSOService(repository.NewSSORepository(db), userRepo, roleRepo, repository.NewBranchRepository(db), repository.NewAccountTokenRepository(db), planService)
+	auditService := services.NewAuditService(repository.NewAuditRepository(db))
+	trashService := services.NewTrashService(repository.NewTrashRepository(db))
+	companyDataService := services.NewCompanyDataService(repository.NewCompanyDataRepository(db), companyRepo)
+	tenantTransferService := services.NewTenantTransferService(repository.NewTenantTransferRepository(db), companyRepo, planService)
+	if err := companyDataService.FailInterrupted(); err != nil {
+		logger.Warn("Failed to mark interrupted company data jobs", logger.ErrorField(err))
+	}
+
+	// Initialize handlers
+	branchRepo := repository.NewBranchRepository(db)
+	debtService := services.NewDebtService(debtRepo, branchRepo, currencyService)
+	authHandler := handlers.NewAuthHandler(userRepo, companyRepo, roleRepo, settingsRepo, emailService, branchRepo, sessionService, twoFactorService, accountService, loginSecurityService, ssoService, planService, db)
+	teacherHandler := handlers.NewTeacherHandler(teacherRepo)
+	studentHandler := handlers.NewStudentHandler(studentRepo, activityRepo, notificationRepo, activityService, planService)
+	groupHandler := handlers.NewGroupHandler(groupRepo, lessonRepo)
+	lessonHandler := handlers.NewLessonHandler(lessonRepo, roomRepo)
+	settingsHandler := handlers.NewSettingsHandler(settingsRepo)
+	roomHandler := handlers.NewRoomHandler(roomRepo)
+	leadHandler := handlers.NewLeadHandler(leadRepo)
+	paymentHandler := handlers.NewPaymentHandler(paymentRepo, activityService, emailService, studentRepo)
+	tariffHandler := handlers.NewTariffHandler(tariffRepo)
+	discountHandler := handlers.NewDiscountHandler(discountRepo)
+	debtHandler := handlers.NewDebtHandler(debtRepo, debtService, exportService)
+	branchReportHandler := handlers.NewBranchReportHandler(services.NewBranchReportService(repository.NewBranchReportRepository(db), branchRepo, currencyService), exportService)
+	cashShiftHandler := handlers.NewCashShiftHandler(cashShiftRepo, studentRepo, exportService)
+	subscriptionHandler := handlers.NewSubscriptionHandler(subscriptionRepo, lessonRepo, studentRepo, attendanceService, activityService, subscriptionService)
+	migrationHandler := handlers.NewMigrationHandler(teacherRepo, studentRepo, groupRepo, roomRepo, lessonRepo, subscriptionRepo, branchRepo, companyDataService, planService)
+	dashboardHandler := handlers.NewDashboardHandler(lessonRepo, paymentRepo, subscriptionRepo, studentRepo, leadRepo, debtRepo, cashShiftRepo, currencyService)
+	roleHandler := handlers.NewRoleHandler(roleRepo, permRepo)
+	userRoleHandler := handlers.NewUserRoleHandler(userRepo, roleRepo)
+	exportHandler := handlers.NewExportHandler(exportService, paymentRepo, studentRepo, lessonRepo)
+	branchHandler := handlers.NewBranchHandler(db, sessionService, planService)
+	currencyHandler := handlers.NewCurrencyHandler(currencyRepo)
+	installmentHandler := handlers.NewInstallmentHandler(installmentRepo, installmentService)
+	onlinePaymentHandler := handlers.NewOnlinePaymentHandler(paymentIntentRepo, onlinePaymentService)
+	fiscalHandler := handlers.NewFiscalHandler(fiscalReceiptRepo)
+	auditHandler := handlers.NewAuditHandler(auditService)
+	trashHandler := handlers.NewTrashHandler(trashService, planService)
+	tenantTransferHandler := handlers.NewTenantTransferHandler(tenantTransferService, planService)
+	planHandler := handlers.NewPlanHandler(planService)
+	platformHandler := handlers.NewPlatformHandler(services.NewPlatformService(repository.NewPlatformRepository(db), planService, sessionService, trashService, companyDataService, debtService))
+	branchTransferHandler := handlers.NewBranchTransferHandler(services.NewBranchTransferService(repository.NewBranchTransferRepository(db), currencyService), studentRepo)
+	personalDataHandler := handlers.NewPersonalDataHandler(services.NewPersonalDataService(repository.NewPersonalDataRepository(db)))
+
+	// Background jobs
+	scheduler := services.NewScheduler()
+	scheduler.AddJob("overdue_invoice_debts", time.Hour, debtService.GenerateFromOverdueInvoices)
+	scheduler.AddJob("daily_notifications", 24*time.Hour, notificationService.SendDailyNotificationCheck)
+	scheduler.AddJob("installments", time.Hour, installmentService.ProcessInstallments)
+	scheduler.AddJob("online_payments_reconcile", 10*time.Minute, onlinePaymentService.ReconcilePending)
+	scheduler.AddJob("fiscal_receipts", time.Minute, fiscalService.ProcessQueue)
+	scheduler.AddJob("expired_sessions", 24*time.Hour, sessionService.CleanupExpired)
+	scheduler.AddJob("expired_two_factor_challenges", time.Hour, twoFactorService.CleanupExpiredChallenges)
+	scheduler.AddJob("expired_account_tokens", 24*time.Hour, accountService.CleanupExpiredTokens)
+	scheduler.AddJob("old_login_events", 24*time.Hour, loginSecurityService.CleanupOldEvents)
+	scheduler.AddJob("expired_sso_login_states", time.Hour, ssoService.CleanupExpiredStates)
+	scheduler.AddJob("old_audit_log", 24*time.Hour, auditService.CleanupOld)
+	scheduler.AddJob("trash_purge", 24*time.Hour, trashService.PurgeExpired)
+	scheduler.AddJob("old_company_snapshots", 24*time.Hour, companyDataService.CleanupOldSnapshots)
+	scheduler.AddJob("expired_import_dry_runs", time.Hour, tenantTransferService.CleanupExpiredDryRuns)
+	scheduler.AddJob("usage_metering", 24*time.Hour, planService.MeterUsage)
+
+	// Initialize Gin
+	router := gin.Default()
+	// X-Forwarded-For / X-Real-IP are only honoured from the proxies in TRUSTED_PROXIES
+	if err := router.SetTrustedProxies(middleware.TrustedProxies()); err != nil {
+		return nil, fmt.Errorf("invalid TRUSTED_PROXIES: %w", err)
+	}
+
+	// Middleware
+	router.Use(middleware.CORSMiddleware())
+	router.Use(middleware.RequestLoggerMiddleware()) // Request logging with request ID
+	router.Use(middleware.ErrorHandlerMiddleware())  // Centralized error handling
+	router.Use(middleware.MetricsMiddleware())       // Prometheus metrics
+
+	// Public routes with rate limiting for auth endpoints (brute-force protection)
+	// The same limiter guards the password and email routes of signed-in users below
+	authRateLimit := middleware.AuthRateLimitMiddleware()
+	auth := router.Group("/api/auth")
+	auth.Use(authRateLimit)
+	{
+		auth.POST("/register", authHandler.Register)
+		auth.POST("/login", authHandler.Login)
+		auth.POST("/login/2fa", authHandler.LoginTwoFactor)
+		auth.POST("/sso/discover", authHandler.DiscoverSSO)
+		auth.GET("/sso/:companyId/login", authHandler.StartSSO)
+		auth.GET("/sso/callback", authHandler.SSOCallback)
+		auth.POST("/sso/exchange", authHandler.ExchangeSSOCode)
+		auth.POST("/refresh", authHandler.RefreshToken)
+		auth.POST("/verify-email", authHandler.VerifyEmail)
+		auth.POST("/resend-verification", authHandler.ResendVerificationEmail)
+		auth.POST("/accept-invite", authHandler.AcceptInvite)
+		auth.POST("/password/forgot", authHandler.ForgotPassword)
+		auth.POST("/password/reset", authHandler.ResetPassword)
+		auth.POST("/email/confirm", authHandler.ConfirmEmailChange)
+	}
+
+	// Payment provider webhooks (public, verified by signature)
+	router.POST("/api/webhooks/payments/:provider", onlinePaymentHandler.Webhook)
+
+	// Protected routes
+	api := router.Group("/api")
+	api.Use(middleware.AuthMiddleware(db))
+	api.Use(middleware.CompanyMiddleware(db))
+	// Sensitive actions need a recent 2FA confirmation of the session
+	stepUp := middleware.RequireTwoFactorStepUp()
+	// Features only some plans include
+	exportsFeature := middleware.RequirePlanFeature(models.PlanFeatureExports)
+	migrationFeature := middleware.RequirePlanFeature(models.PlanFeatureMigration)
+	{
+		// Auth
+		api.GET("/auth/me", authHandler.Me)
+		api.GET("/auth/users", middleware.RequirePermission("users", "manage"), authHandler.GetUsers)
+		api.POST("/auth/invite", middleware.RequirePermission("users", "manage"), stepUp, authHandler.InviteUser)
+		api.POST("/auth/logout", authHandler.Logout)
+		api.POST("/auth/password/change", authRateLimit, authHandler.ChangePassword)
+		api.POST("/auth/email/change", authRateLimit, authHandler.RequestEmailChange)
+		api.GET("/auth/sessions", authHandler.GetSessions)
+		api.DELETE("/auth/sessions", authHandler.RevokeOtherSessions)
+		api.DELETE("/auth/sessions/:id", authHandler.RevokeSession)
+		api.GET("/auth/users/:userId/sessions", middleware.RequirePermission("users", "manage"), authHandler.GetUserSessions)
+		api.DELETE("/auth/users/:userId/sessions", middleware.RequirePermission("users", "manage"), authHandler.RevokeUserSessions)
+		api.DELETE("/auth/users/:userId/sessions/:id", middleware.RequirePermission("users", "manage"), authHandler.RevokeUserSession)
+		api.GET("/auth/login-events", authHandler.GetLoginEvents)
+		api.GET("/auth/users/:userId/login-events", middleware.RequirePermission("users", "manage"), authHandler.GetUserLoginEvents)
+		api.POST("/auth/users/:userId/unlock", middleware.RequirePermission("users", "manage"), stepUp, authHandler.UnlockUser)
+		api.GET("/auth/sso/config", middleware.RequirePermission("users", "manage"), authHandler.GetSSOConfig)
+		api.PUT("/auth/sso/config", middleware.RequirePermission("users", "manage"), middleware.RequirePlanFeature(models.PlanFeatureSSO), stepUp, authHandler.UpdateSSOConfig)
+		api.DELETE("/auth/sso/config", middleware.RequirePermission("users", "manage"), stepUp, authHandler.DeleteSSOConfig)
+		api.GET("/audit-log", middleware.RequirePermission("users", "manage"), auditHandler.GetAuditLog)
+
+		// Two-factor authentication
+		api.GET("/auth/2fa", authHandler.GetTwoFactorStatus)
+		api.POST("/auth/2fa/setup", authHandler.SetupTwoFactor)
+		api.POST("/auth/2fa/enable", authHandler.EnableTwoFactor)
+		api.POST("/auth/2fa/disable", authRateLimit, authHandler.DisableTwoFactor)
+		api.POST("/auth/2fa/recovery-codes", authRateLimit, authHandler.RegenerateRecoveryCodes)
+		api.POST("/auth/2fa/verify", authRateLimit, authHandler.VerifyTwoFactor) // step-up for sensitive actions
+		api.GET("/auth/2fa/policy", middleware.RequirePermission("roles", "manage"), authHandler.GetTwoFactorPolicy)
+		api.PUT("/auth/2fa/policy", middleware.RequirePermission("roles", "manage"), stepUp, authHandler.UpdateTwoFactorPolicy)
+
+		// ============= RBAC MODULE =============
+
+		// Permissions
+		api.GET("/permissions", roleHandler.GetAllPermissions)
+
+		// Roles
+		api.GET("/roles", roleHandler.GetAll)
+		api.GET("/roles/:id", roleHandler.GetByID)
+		api.POST("/roles", middleware.RequirePermission("roles", "manage"), stepUp, roleHandler.Create)
+		api.PUT("/roles/:id", middleware.RequirePermission("roles", "manage"), stepUp, roleHandler.Update)
+		api.DELETE("/roles/:id", middleware.RequirePermission("roles", "manage"), stepUp, roleHandler.Delete)
+		api.GET("/roles/:id/permissions", roleHandler.GetRolePermissions)
+
+		// User Roles
+		api.GET("/users/:userId/roles", userRoleHandler.GetUserRoles)
+		api.POST("/users/roles/assign", middleware.RequirePermission("users", "manage"), stepUp, userRoleHandler.AssignRole)
+		api.POST("/users/roles/remove", middleware.RequirePermission("users", "manage"), stepUp, userRoleHandler.RemoveRole)
+
+		// ============= BRANCH MODULE =============
+
+		// Branches
+		api.GET("/branches", branchHandler.GetBranches)
+		api.GET("/branches/:id", branchHandler.GetBranch)
+		api.POST("/branches", middleware.RequirePermission("settings", "update"), branchHandler.CreateBranch)
+		api.PUT("/branches/:id", middleware.RequirePermission("settings", "update"), branchHandler.UpdateBranch)
+		api.DELETE("/branches/:id", middleware.RequirePermission("settings", "update"), branchHandler.DeleteBranch)
+		api.POST("/branches/switch", branchHandler.SwitchBranch)
+
+		// Branch Users
+		api.GET("/branches/:id/users", middleware.RequirePermission("users", "manage"), branchHandler.GetBranchUsers)
+		api.POST("/branches/:id/users", middleware.RequirePermission("users", "manage"), stepUp, branchHandler.AssignUserToBranch)
+		api.DELETE("/branches/:id/users/:userId", middleware.RequirePermission("users", "manage"), stepUp, branchHandler.RemoveUserFromBranch)
+		api.GET("/branches/:id/users/:userId/permissions", branchHandler.GetUserBranchPermissions) // self or users.manage
+
+		// Teachers
+		api.GET("/teachers", middleware.RequirePermission("teachers", "view"), teacherHandler.GetAll)
+		api.GET("/teachers/:id", middleware.RequirePermission("teachers", "view"), teacherHandler.GetByID)
+		api.POST("/teachers", middleware.RequirePermission("teachers", "create"), teacherHandler.Create)
+		api.PUT("/teachers/:id", middleware.RequirePermission("teachers", "update"), teacherHandler.Update)
+		api.DELETE("/teachers/:id", middleware.RequirePermission("teachers", "delete"), teacherHandler.Delete)
+		api.GET("/teachers/:id/branches", middleware.RequirePermission("teachers", "view"), branchTransferHandler.GetTeacherBranches)
+		api.PUT("/teachers/:id/branches", middleware.RequirePermission("teachers", "update"), branchTransferHandler.SetTeacherBranches)
+		api.PUT("/teachers/:id/user", middleware.RequirePermission("users", "manage"), stepUp, teacherHandler.LinkUser)
+
+		// Students
+		api.GET("/students", middleware.RequirePermission("students", "view"), studentHandler.GetAll)
+		api.POST("/students", middleware.RequirePermission("students", "create"), studentHandler.Create)
+
+		// Student-specific routes (must be before /students/:id)
+		api.GET("/students/:id/activities", middleware.RequirePermission("students", "view"), studentHandler.GetActivities)
+		api.POST("/students/:id/notes", middleware.RequirePermission("students", "update"), studentHandler.AddNote)
+		api.GET("/students/:id/notes", middleware.RequirePermission("students", "view"), studentHandler.GetNotes)
+		api.PUT("/students/:id/status", middleware.RequirePermission("students", "update"), studentHandler.UpdateStatus)
+		api.GET("/students/:id/attendance", middleware.RequirePermission("students", "view"), studentHandler.GetAttendanceJournal)
+		api.GET("/students/:id/notifications", middleware.RequirePermission("students", "view"), studentHandler.GetNotifications)
+		api.GET("/students/:id/discounts", middleware.RequirePermission("students", "view"), discountHandler.GetStudentDiscounts)
+		api.POST("/students/:id/discounts", middleware.RequirePermission("students", "update"), discountHandler.ApplyToStudent)
+		api.DELETE("/students/:id/discounts/:discountId", middleware.RequirePermission("students", "update"), discountHandler.RemoveStudentDiscount)
+
+		// General student routes
+		api.GET("/students/:id", middleware.RequirePermission("students", "view"), studentHandler.GetByID)
+		api.PUT("/students/:id", middleware.RequirePermission("students", "update"), studentHandler.Update)
+		api.DELETE("/students/:id", middleware.RequirePermission("students", "delete"), studentHandler.Delete)
+		api.POST("/students/:id/transfer", middleware.RequirePermission("students", "update"), branchTransferHandler.TransferStudent)
+		api.GET("/students/:id/transfers", middleware.RequirePermission("students", "view"), branchTransferHandler.GetStudentTransfers)
+
+		api.PUT("/notifications/:notificationId/read", middleware.RequirePermission("students", "view"), studentHandler.MarkNotificationRead)
+
+		// Groups
+		api.GET("/groups", middleware.RequirePermission("groups", "view"), groupHandler.GetAll)
+		api.GET("/groups/:id", middleware.RequirePermission("groups", "view"), groupHandler.GetByID)
+		api.POST("/groups", middleware.RequirePermission("groups", "create"), groupHandler.Create)
+		api.PUT("/groups/:id", middleware.RequirePermission("groups", "update"), groupHandler.Update)
+		api.DELETE("/groups/:id", middleware.RequirePermission("groups", "delete"), groupHandler.Delete)
+		api.POST("/groups/:id/generate-lessons", middleware.RequirePermission("lessons", "create"), groupHandler.GenerateLessons)
+		api.POST("/groups/:id/extend", middleware.RequirePermission("groups", "update"), groupHandler.ExtendGroup)
+
+		// Lessons
+		api.GET("/lessons", middleware.RequirePermission("lessons", "view"), lessonHandler.GetAll)
+		api.GET("/lessons/individual", middleware.RequirePermission("lessons", "view"), lessonHandler.GetIndividual)
+		api.GET("/lessons/:id", middleware.RequirePermission("lessons", "view"), lessonHandler.GetByID)
+		api.POST("/lessons", middleware.RequirePermission("lessons", "create"), lessonHandler.Create)
+		api.PUT("/lessons/:id", middleware.RequirePermission("lessons", "update"), lessonHandler.Update)
+		api.DELETE("/lessons/:id", middleware.RequirePermission("lessons", "delete"), lessonHandler.Delete)
+		api.POST("/lessons/check-conflicts", middleware.RequirePermission("lessons", "create"), lessonHandler.CheckConflicts)
+		api.GET("/lessons/teacher/:teacherId", middleware.RequirePermission("lessons", "view"), lessonHandler.GetByTeacher)
+		api.POST("/lessons/bulk", middleware.RequirePermission("lessons", "create"), lessonHandler.CreateBulk)
+
+		// Trash (permission is checked per record type)
+		api.GET("/trash", trashHandler.GetTrash)
+		api.POST("/trash/:type/:id/restore", trashHandler.Restore)
+
+		// Personal data requests (permission is checked per subject type)
+		api.GET("/personal-data/:type/:id", personalDataHandler.ExportPersonalData)
+		api.POST("/personal-data/:type/:id/erase", stepUp, personalDataHandler.ErasePersonalData)
+
+		// Settings
+		api.GET("/settings", middleware.RequirePermission("settings", "view"), settingsHandler.Get)
+		api.PUT("/settings", middleware.RequirePermission("settings", "update"), settingsHandler.Update)
+
+		// Rooms
+		api.GET("/rooms", middleware.RequirePermission("rooms", "view"), roomHandler.GetAll)
+		api.GET("/rooms/:id", middleware.RequirePermission("rooms", "view"), roomHandler.GetByID)
+		api.POST("/rooms", middleware.RequirePermission("rooms", "create"), roomHandler.Create)
+		api.PUT("/rooms/:id", middleware.RequirePermission("rooms", "update"), roomHandler.Update)
+		api.DELETE("/rooms/:id", middleware.RequirePermission("rooms", "delete"), roomHandler.Delete)
+
+		// Leads
+		api.GET("/leads", middleware.RequirePermission("leads", "view"), leadHandler.GetAll)
+		api.GET("/leads/stats", middleware.RequirePermission("leads", "view"), leadHandler.GetConversionStats)
+		api.GET("/leads/:id", middleware.RequirePermission("leads", "view"), leadHandler.GetByID)
+		api.POST("/leads", middleware.RequirePermission("leads", "create"), leadHandler.Create)
+		api.PUT("/leads/:id", middleware.RequirePermission("leads", "update"), leadHandler.Update)
+		api.DELETE("/leads/:id", middleware.RequirePermission("leads", "delete"), leadHandler.Delete)
+
+		// Lead Activities
+		api.GET("/leads/:id/activities", middleware.RequirePermission("leads", "view"), leadHandler.GetActivities)
+		api.POST("/leads/:id/activities", middleware.RequirePermission("leads", "update"), leadHandler.AddActivity)
+
+		// Lead Tasks
+		api.GET("/leads/:id/tasks", middleware.RequirePermission("leads", "view"), leadHandler.GetTasks)
+		api.POST("/leads/:id/tasks", middleware.RequirePermission("leads", "update"), leadHandler.CreateTask)
+		api.PUT("/leads/:id/tasks/:taskId", middleware.RequirePermission("leads", "update"), leadHandler.UpdateTask)
+
+		// ============= CURRENCY MODULE =============
+		api.GET("/currency", middleware.RequirePermission("settings", "view"), currencyHandler.GetSettings)
+		api.PUT("/currency/company", middleware.RequirePermission("settings", "update"), currencyHandler.UpdateCompanyCurrency)
+		api.PUT("/currency/branches/:id", middleware.RequirePermission("settings", "update"), currencyHandler.UpdateBranchCurrency)
+		api.GET("/exchange-rates", middleware.RequirePermission("finance", "view"), currencyHandler.GetRates) // supports ?from=&to=
+		api.POST("/exchange-rates", middleware.RequirePermission("settings", "update"), currencyHandler.CreateRate)
+		api.DELETE("/exchange-rates/:id", middleware.RequirePermission("settings", "update"), currencyHandler.DeleteRate)
+
+		// ============= FINANCE MODULE =============
+
+		// Payments & Transactions
+		api.POST("/payments/transactions", middleware.RequirePermission("finance", "transactions"), paymentHandler.CreateTransaction)
+		api.GET("/payments/transactions", middleware.RequirePermission("finance", "view"), paymentHandler.GetAllTransactions)
+		api.GET("/payments/transactions/student/:studentId", middleware.RequirePermission("finance", "view"), paymentHandler.GetTransactionsByStudent)
+		api.PUT("/payments/transactions/:id", middleware.RequirePermission("finance", "transactions"), paymentHandler.UpdateTransaction)
+
+		// Student Balances
+		api.GET("/payments/balance/:studentId", middleware.RequirePermission("finance", "view"), paymentHandler.GetStudentBalance)
+		api.GET("/payments/balances", middleware.RequirePermission("finance", "view"), paymentHandler.GetAllBalances)
+
+		// Online payments
+		api.POST("/payments/online", middleware.RequirePermission("finance", "transactions"), onlinePaymentHandler.CreateIntent)
+		api.GET("/payments/online", middleware.RequirePermission("finance", "view"), onlinePaymentHandler.GetIntents) // supports ?status=&studentId=&branchId=
+		api.GET("/payments/online/:id", middleware.RequirePermission("finance", "view"), onlinePaymentHandler.GetIntent)
+		api.POST("/payments/online/:id/cancel", middleware.RequirePermission("finance", "transactions"), onlinePaymentHandler.CancelIntent)
+		api.POST("/payments/online/:id/accept", middleware.RequirePermission("finance", "transactions"), onlinePaymentHandler.AcceptIntent)
+		api.POST("/payments/online/:id/refund", middleware.RequirePermission("finance", "transactions"), stepUp, onlinePaymentHandler.RefundIntent)
+
+		// Fiscal receipts
+		api.GET("/fiscal/receipts", middleware.RequirePermission("finance", "view"), fiscalHandler.GetReceipts) // supports ?status=&branchId=
+		api.GET("/fiscal/receipts/stats", middleware.RequirePermission("finance", "view"), fiscalHandler.GetStats)
+		api.POST("/fiscal/receipts/:id/retry", middleware.RequirePermission("finance", "transactions"), fiscalHandler.RetryReceipt)
+
+		// Tariffs
+		api.GET("/tariffs", middleware.RequirePermission("finance", "tariffs"), tariffHandler.GetAll)
+		api.GET("/tariffs/:id", middleware.RequirePermission("finance", "tariffs"), tariffHandler.GetByID)
+		api.POST("/tariffs", middleware.RequirePermission("finance", "tariffs"), tariffHandler.Create)
+		api.PUT("/tariffs/:id", middleware.RequirePermission("finance", "tariffs"), tariffHandler.Update)
+		api.DELETE("/tariffs/:id", middleware.RequirePermission("finance", "tariffs"), tariffHandler.Delete)
+
+		// Discounts
+		api.GET("/discounts", middleware.RequirePermission("finance", "tariffs"), discountHandler.GetAll)
+		api.GET("/discounts/:id", middleware.RequirePermission("finance", "tariffs"), discountHandler.GetByID)
+		api.POST("/discounts", middleware.RequirePermission("finance", "tariffs"), discountHandler.Create)
+		api.PUT("/discounts/:id", middleware.RequirePermission("finance", "tariffs"), discountHandler.Update)
+		api.DELETE("/discounts/:id", middleware.RequirePermission("finance", "tariffs"), discountHandler.Delete)
+
+		// Debts
+		api.GET("/debts", middleware.RequirePermission("finance", "debts"), debtHandler.GetAll) // supports ?status= query param
+		api.GET("/debts/student/:studentId", middleware.RequirePermission("finance", "debts"), debtHandler.GetByStudent)
+		api.POST("/debts", middleware.RequirePermission("finance", "debts"), debtHandler.Create)
+		api.PUT("/debts/:id", middleware.RequirePermission("finance", "debts"), debtHandler.Update)
+		api.DELETE("/debts/:id", middleware.RequirePermission("finance", "debts"), debtHandler.Delete)
+		api.GET("/debts/:id/payments", middleware.RequirePermission("finance", "debts"), debtHandler.GetPayments)
+		api.GET("/debts/aging", middleware.RequirePermission("finance", "debts"), debtHandler.GetAgingReport) // supports ?branchId=
+
+		// Cash Register Shifts
+		api.GET("/cash-shifts", middleware.RequirePermission("finance", "view"), cashShiftHandler.GetAll)
+		api.GET("/cash-shifts/current", middleware.RequirePermission("finance", "view"), cashShiftHandler.GetCurrent)
+		api.POST("/cash-shifts/open", middleware.RequirePermission("finance", "transactions"), cashShiftHandler.Open)
+		api.POST("/cash-shifts/movements", middleware.RequirePermission("finance", "transactions"), cashShiftHandler.AddMovement)
+		api.POST("/cash-shifts/:id/close", middleware.RequirePermission("finance", "transactions"), cashShiftHandler.Close)
+		api.GET("/cash-shifts/:id/report", middleware.RequirePermission("finance", "view"), cashShiftHandler.GetReport)
+
+		// ============= EXPORT MODULE =============
+
+		// Export Transactions
+		api.GET("/export/transactions/pdf", middleware.RequirePermission("finance", "view"), exportsFeature, exportHandler.ExportTransactionsPDF)
+		api.GET("/export/transactions/excel", middleware.RequirePermission("finance", "view"), exportsFeature, exportHandler.ExportTransactionsExcel)
+
+		// Export Debt Aging Report
+		api.GET("/export/debts/aging/pdf", middleware.RequirePermission("finance", "debts"), exportsFeature, debtHandler.ExportAgingPDF)
+		api.GET("/export/debts/aging/excel", middleware.RequirePermission("finance", "debts"), exportsFeature, debtHandler.ExportAgingExcel)
+		api.GET("/export/reports/branches/excel", middleware.RequirePermission("finance", "view"), exportsFeature, branchReportHandler.ExportBranchReportExcel)
+		api.GET("/export/audit-log/csv", middleware.RequirePermission("users", "manage"), auditHandler.ExportAuditLog)
+
+		// Export Cash Shift Report
+		api.GET("/export/cash-shifts/:id/pdf", middleware.RequirePermission("finance", "view"), exportsFeature, cashShiftHandler.ExportReportPDF)
+		api.GET("/export/cash-shifts/:id/excel", middleware.RequirePermission("finance", "view"), exportsFeature, cashShiftHandler.ExportReportExcel)
+
+		// Export Students
+		api.GET("/export/students/pdf", middleware.RequirePermission("students", "view"), exportsFeature, exportHandler.ExportStudentsPDF)
+		api.GET("/export/students/excel", middleware.RequirePermission("students", "view"), exportsFeature, exportHandler.ExportStudentsExcel)
+
+		// Export Schedule
+		api.GET("/export/schedule/pdf", middleware.RequirePermission("lessons", "view"), exportsFeature, exportHandler.ExportSchedulePDF)
+		api.GET("/export/schedule/excel", middleware.RequirePermission("lessons", "view"), exportsFeature, exportHandler.ExportScheduleExcel)
+
+		// ============= SUBSCRIPTION MODULE =============
+
+		// Subscription Types
+		api.GET("/subscriptions/types", middleware.RequirePermission("subscriptions", "view"), subscriptionHandler.GetAllTypes)
+		api.GET("/subscriptions/types/:id", middleware.RequirePermission("subscriptions", "view"), subscriptionHandler.GetTypeByID)
+		api.POST("/subscriptions/types", middleware.RequirePermission("subscriptions", "create"), subscriptionHandler.CreateType)
+		api.PUT("/subscriptions/types/:id", middleware.RequirePermission("subscriptions", "update"), subscriptionHandler.UpdateType)
+		api.DELETE("/subscriptions/types/:id", middleware.RequirePermission("subscriptions", "delete"), subscriptionHandler.DeleteType)
+
+		// Student Subscriptions
+		api.GET("/subscriptions", middleware.RequirePermission("subscriptions", "view"), subscriptionHandler.GetAllSubscriptions)
+		api.GET("/subscriptions/student/:studentId", middleware.RequirePermission("subscriptions", "view"), subscriptionHandler.GetStudentSubscriptions)
+		api.GET("/subscriptions/:id", middleware.RequirePermission("subscriptions", "view"), subscriptionHandler.GetSubscriptionByID)
+		api.POST("/subscriptions", middleware.RequirePermission("subscriptions", "create"), subscriptionHandler.CreateStudentSubscription)
+		api.PUT("/subscriptions/:id", middleware.RequirePermission("subscriptions", "update"), subscriptionHandler.UpdateSubscription)
+		api.DELETE("/subscriptions/:id", middleware.RequirePermission("subscriptions", "delete"), subscriptionHandler.DeleteSubscription)
+
+		// Subscription Freezes
+		api.GET("/subscriptions/:id/freezes", middleware.RequirePermission("subscriptions", "view"), subscriptionHandler.GetFreezes)
+		api.POST("/subscriptions/:id/freezes", middleware.RequirePermission("subscriptions", "freeze"), subscriptionHandler.CreateFreeze)
+		api.POST("/subscriptions/:id/freeze", middleware.RequirePermission("subscriptions", "freeze"), subscriptionHandler.FreezeSubscription)
+		api.PUT("/subscriptions/freezes", middleware.RequirePermission("subscriptions", "freeze"), subscriptionHandler.UpdateFreeze)
+
+		// Installment plans
+		api.GET("/subscriptions/:id/installments", middleware.RequirePermission("subscriptions", "view"), installmentHandler.GetPlan)
+		api.POST("/subscriptions/:id/installments", middleware.RequirePermission("finance", "debts"), installmentHandler.CreatePlan)
+		api.DELETE("/subscriptions/:id/installments", middleware.RequirePermission("finance", "debts"), installmentHandler.CancelPlan)
+		api.GET("/installments", middleware.RequirePermission("finance", "view"), installmentHandler.List) // supports ?status=&branchId=
+
+		// Lesson Attendance
+		api.POST("/attendance", middleware.RequirePermission("attendance", "mark"), subscriptionHandler.MarkAttendance)
+		api.GET("/attendance/lesson/:lessonId", middleware.RequirePermission("attendance", "view"), subscriptionHandler.GetAttendanceByLesson)
+		api.GET("/attendance/student/:studentId", middleware.RequirePermission("attendance", "view"), subscriptionHandler.GetAttendanceByStudent)
+
+		// ============= MIGRATION MODULE =============
+
+		// Migration from AlfaCRM and archive import need the migration feature; a company can
+		// always clear, restore and export its own data
+		api.POST("/migration/start", middleware.RequirePermission("migration", "manage"), migrationFeature, stepUp, migrationHandler.StartMigration)
+		api.GET("/migration/status", middleware.RequirePermission("migration", "manage"), migrationFeature, migrationHandler.GetMigrationStatus)
+		api.POST("/migration/test-connection", middleware.RequirePermission("migration", "manage"), migrationFeature, migrationHandler.TestAlfaCRMConnection)
+		api.POST("/migration/clear-data", middleware.RequirePermission("migration", "manage"), stepUp, migrationHandler.ClearCompanyData)
+		api.GET("/migration/data-jobs", middleware.RequirePermission("migration", "manage"), migrationHandler.GetDataJobs)
+		api.GET("/migration/data-jobs/:id", middleware.RequirePermission("migration", "manage"), migrationHandler.GetDataJob)
+		api.GET("/migration/snapshots", middleware.RequirePermission("migration", "manage"), migrationHandler.GetSnapshots)
+		api.POST("/migration/snapshots/:id/restore", middleware.RequirePermission("migration", "manage"), stepUp, migrationHandler.RestoreSnapshot)
+		api.GET("/migration/export", middleware.RequirePermission("migration", "manage"), stepUp, tenantTransferHandler.ExportCompanyData)
+		api.POST("/migration/import", middleware.RequirePermission("migration", "manage"), migrationFeature, stepUp, tenantTransferHandler.ImportCompanyData)
+
+		// ============= DASHBOARD MODULE =============
+
+		// Consolidated report across the selected accessible branches
+		api.GET("/reports/branches", middleware.RequirePermission("finance", "view"), branchReportHandler.GetBranchReport)
+
+		// Dashboard analytics
+		api.GET("/dashboard/stats", middleware.RequirePermission("dashboard", "view"), dashboardHandler.GetStats)
+		api.GET("/dashboard/today-lessons", middleware.RequirePermission("dashboard", "view"), dashboardHandler.GetTodayLessons)
+		api.GET("/dashboard/revenue-chart", middleware.RequirePermission("dashboard", "view"), dashboardHandler.GetRevenueChart)
+		api.GET("/dashboard/attendance-stats", middleware.RequirePermission("dashboard", "view"), dashboardHandler.GetAttendanceStats)
+
+		// ============= PLATFORM MODULE =============
+
+		// Plans and usage across companies (platform admins only)
+		platform := api.Group("/platform", middleware.RequirePlatformAdmin())
+		platform.GET("/plans", planHandler.GetPlans)
+		platform.PUT("/plans/:id", planHandler.UpdatePlan)
+		platform.GET("/usage", planHandler.GetCompaniesUsage)
+		platform.GET("/companies/:id/usage", planHandler.GetCompanyUsage)
+		platform.PUT("/companies/:id/plan", planHandler.SetCompanyPlan)
+
+		// Company console: search, suspension, support sign-in and per-company maintenance.
+		// Acting on a company needs a fresh 2FA confirmation and is recorded in its audit log.
+		platform.GET("/companies", platformHandler.GetCompanies)
+		platform.GET("/companies/:id", platformHandler.GetCompany)
+		platform.POST("/companies/:id/suspend", stepUp, platformHandler.SuspendCompany)
+		platform.POST("/companies/:id/reactivate", stepUp, platformHandler.ReactivateCompany)
+		platform.POST("/companies/:id/impersonate", stepUp, platformHandler.Impersonate)
+		platform.GET("/jobs", platformHandler.GetMaintenanceJobs)
+		platform.POST("/companies/:id/jobs/:job", stepUp, platformHandler.RunMaintenanceJob)
+	}
+
+	// Health check endpoint
+	router.GET("/health", func(c *gin.Context) {
+		// Check database connection
+		if err := db.Ping(); err != nil {
+			c.JSON(503, gin.H{
+				"status":   "unhealthy",
+				"database": "disconnected",
+				"error":    err.Error(),
+			})
+			return
+		}
+
+		c.JSON(200, gin.H{
+			"status":   "ok",
+			"database": "connected",
+		})
+	})
+
+	// Readiness check (more detailed)
+	router.GET("/ready", func(c *gin.Context) {
+		health := gin.H{
+			"status": "ready",
+			"checks": gin.H{},
+		}
+
+		// Database check
+		if err := db.Ping(); err != nil {
+			health["status"] = "not ready"
+			health["checks"].(gin.H)["database"] = gin.H{
+				"status": "failed",
+				"error":  err.Error(),
+			}
+			c.JSON(503, health)
+			return
+		}
+		health["checks"].(gin.H)["database"] = gin.H{"status": "ok"}
+
+		c.JSON(200, health)
+	})
+
+	// Prometheus metrics endpoint
+	router.GET("/metrics", gin.WrapH(promhttp.Handler()))
+
+	return &Server{Router: router, Scheduler: scheduler}, nil
+}
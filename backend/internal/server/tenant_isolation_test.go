@@ -0,0 +1,289 @@
+package server
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"classmate-central/internal/database"
+	"classmate-central/internal/models"
+	"classmate-central/internal/money"
+	"classmate-central/internal/repository"
+	"classmate-central/internal/testutil"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// tenantRequest sends an authenticated JSON request and returns the recorder
+func tenantRequest(router *gin.Engine, token, method, path string, body interface{}) *httptest.ResponseRecorder {
+	var reader *bytes.Reader
+	if body != nil {
+		jsonBody, _ := json.Marshal(body)
+		reader = bytes.NewReader(jsonBody)
+	} else {
+		reader = bytes.NewReader(nil)
+	}
+	req, _ := http.NewRequest(method, path, reader)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+// registerTenant creates a company with its owner and returns the owner's access token
+func registerTenant(t *testing.T, router *gin.Engine, email string) string {
+	t.Helper()
+	jsonBody, _ := json.Marshal(models.RegisterRequest{
+		Email:       email,
+		Password:    "password123",
+		Name:        "Owner " + email,
+		CompanyName: "Company " + email,
+	})
+	req, _ := http.NewRequest("POST", "/api/auth/register", bytes.NewBuffer(jsonBody))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+
+	var response models.AuthResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	return response.Token
+}
+
+// createdID decodes the "id" of a 201 response
+func createdID(t *testing.T, w *httptest.ResponseRecorder) string {
+	t.Helper()
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var created struct {
+		ID json.RawMessage `json:"id"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+	var id string
+	if err := json.Unmarshal(created.ID, &id); err != nil {
+		id = string(created.ID) // numeric IDs
+	}
+	return id
+}
+
+// userOf returns the ID and company of the user with the email
+func userOf(t *testing.T, db *sql.DB, email string) (int, string) {
+	t.Helper()
+	var userID int
+	var companyID string
+	require.NoError(t, database.System(db).QueryRow(`SELECT id, company_id FROM users WHERE email = $1`, email).Scan(&userID, &companyID))
+	return userID, companyID
+}
+
+// TestTenantIsolation_ForeignIDsOnEveryRoute walks every route of the router cmd/api serves and
+// calls it as company B with the IDs of company A's rows. Every record of company A is named
+// "CompanyA ...", so no response to company B may mention it, and company A's rows must be
+// unchanged afterwards.
+func TestTenantIsolation_ForeignIDsOnEveryRoute(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := testutil.SetupTestDB(t)
+	defer db.Close()
+	defer testutil.CleanupTestDB(t, db)
+
+	srv, err := New(db)
+	require.NoError(t, err)
+	router := srv.Router
+
+	tokenA := registerTenant(t, router, "owner-routes-a@example.com")
+	tokenB := registerTenant(t, router, "owner-routes-b@example.com")
+	ownerA, companyA := userOf(t, db, "owner-routes-a@example.com")
+	_, companyB := userOf(t, db, "owner-routes-b@example.com")
+	branchA := companyA + "_default_branch"
+
+	// Company A's data
+	studentID := createdID(t, tenantRequest(router, tokenA, "POST", "/api/students", gin.H{"name": "CompanyA Student", "age": 12}))
+	trashedID := createdID(t, tenantRequest(router, tokenA, "POST", "/api/students", gin.H{"name": "CompanyA Trashed", "age": 13}))
+	w := tenantRequest(router, tokenA, "DELETE", "/api/students/"+trashedID, nil)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	leadID := createdID(t, tenantRequest(router, tokenA, "POST", "/api/leads", gin.H{"name": "CompanyA Lead", "phone": "+77001234567", "source": "call"}))
+	taskID := createdID(t, tenantRequest(router, tokenA, "POST", "/api/leads/"+leadID+"/tasks", gin.H{"title": "CompanyA Task"}))
+	w = tenantRequest(router, tokenA, "PUT", "/api/settings", gin.H{"centerName": "CompanyA Center", "themeColor": "#000000", "timezone": "Asia/Almaty"})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	w = tenantRequest(router, tokenA, "PUT", "/api/branches/"+branchA, gin.H{"name": "CompanyA Branch", "status": "active"})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	shiftID := createdID(t, tenantRequest(router, tokenA, "POST", "/api/cash-shifts/open", gin.H{"openingFloat": "1000.00", "notes": "CompanyA Shift"}))
+	rateID := createdID(t, tenantRequest(router, tokenA, "POST", "/api/exchange-rates", gin.H{"fromCurrency": "USD", "toCurrency": "KZT", "rate": "470.50", "effectiveDate": time.Now().Format("2006-01-02")}))
+	_, err = database.Tenant(db, companyA).Exec(`INSERT INTO roles (id, name, company_id) VALUES ('iso-role', 'CompanyA Role', $1)`, companyA)
+	require.NoError(t, err)
+
+	require.NoError(t, repository.NewTeacherRepository(db).Create(&models.Teacher{ID: "iso-teacher", Name: "CompanyA Teacher", Subject: "Math", Email: "teacher-a@example.com", Status: "active"}, companyA, branchA))
+	require.NoError(t, repository.NewRoomRepository(db).Create(&models.Room{ID: "iso-room", Name: "CompanyA Room", Capacity: 10, Status: "active"}, companyA, branchA))
+	require.NoError(t, repository.NewGroupRepository(db).Create(&models.Group{ID: "iso-group", Name: "CompanyA Group", Subject: "Math", TeacherID: "iso-teacher", RoomID: "iso-room", Status: "active"}, companyA, branchA))
+	start := time.Now().Add(24 * time.Hour).Truncate(time.Hour)
+	require.NoError(t, repository.NewLessonRepository(db).Create(&models.Lesson{ID: "iso-lesson", Title: "CompanyA Lesson", TeacherID: "iso-teacher", GroupID: "iso-group", Subject: "Math", Start: start, End: start.Add(time.Hour), RoomID: "iso-room", Status: "scheduled"}, companyA, branchA))
+	require.NoError(t, repository.NewTariffRepository(db).Create(&models.Tariff{ID: "iso-tariff", Name: "CompanyA Tariff", Price: money.MustParse("10000", money.DefaultCurrency)}, database.Actor{CompanyID: companyA}))
+	require.NoError(t, repository.NewDiscountRepository(db).Create(&models.Discount{ID: "iso-discount", Name: "CompanyA Discount", Type: "fixed", Value: 100, IsActive: true}, companyA))
+
+	subscriptionRepo := repository.NewSubscriptionRepository(db)
+	price := money.MustParse("40000", money.DefaultCurrency)
+	require.NoError(t, subscriptionRepo.CreateType(&models.SubscriptionType{ID: "iso-type", Name: "CompanyA Type", LessonsCount: 8, Price: price, CanFreeze: true, BillingType: "per_lesson"}, companyA))
+	require.NoError(t, subscriptionRepo.CreateStudentSubscription(&models.StudentSubscription{ID: "iso-sub", StudentID: studentID, SubscriptionTypeID: "iso-type", TotalLessons: 8, TotalPrice: price, StartDate: time.Now(), Status: "active"}, companyA))
+	require.NoError(t, repository.NewInstallmentRepository(db).CreatePlan(&models.InstallmentPlan{SubscriptionID: "iso-sub", TotalAmount: price, BillingMode: "debt", ReminderDays: 3,
+		Installments: []models.Installment{{Seq: 1, DueDate: time.Now().AddDate(0, 1, 0), Amount: price}}}, companyA))
+
+	transaction := &models.PaymentTransaction{StudentID: studentID, Amount: money.MustParse("5000", money.DefaultCurrency), Type: "payment", PaymentMethod: "cash", Description: "CompanyA Payment"}
+	require.NoError(t, repository.NewPaymentRepository(db).CreateTransaction(transaction, companyA))
+	var receiptID int64
+	require.NoError(t, database.Tenant(db, companyA).QueryRow(`SELECT id FROM fiscal_receipts WHERE transaction_id = $1`, transaction.ID).Scan(&receiptID))
+	debt := &models.DebtRecord{StudentID: studentID, Amount: money.MustParse("3000", money.DefaultCurrency), Notes: "CompanyA Debt"}
+	require.NoError(t, repository.NewDebtRepository(db).Create(debt, companyA))
+	invoice := &models.Invoice{StudentID: studentID, IssuedAt: time.Now(), Status: "unpaid"}
+	require.NoError(t, repository.NewInvoiceRepository(db).Create(invoice, companyA))
+	intent := &models.PaymentIntent{ID: "iso-intent", StudentID: studentID, Amount: money.MustParse("2000", money.DefaultCurrency), Description: "CompanyA Intent", Provider: "test"}
+	require.NoError(t, repository.NewPaymentIntentRepository(db).Create(intent, companyA))
+
+	notification := &models.Notification{StudentID: studentID, Type: "debt_reminder", Message: "CompanyA Notification"}
+	require.NoError(t, repository.NewNotificationRepository(db).CreateNotification(notification))
+
+	// :id is resolved by the segment in front of it, named parameters directly
+	ids := map[string]string{
+		"students":       studentID,
+		"student":        studentID, // trash and personal data requests by type
+		"leads":          leadID,
+		"lead":           leadID,
+		"teachers":       "iso-teacher",
+		"rooms":          "iso-room",
+		"groups":         "iso-group",
+		"lessons":        "iso-lesson",
+		"tariffs":        "iso-tariff",
+		"discounts":      "iso-discount",
+		"types":          "iso-type",
+		"subscriptions":  "iso-sub",
+		"transactions":   fmt.Sprint(transaction.ID),
+		"debts":          fmt.Sprint(debt.ID),
+		"branches":       branchA,
+		"cash-shifts":    shiftID,
+		"online":         intent.ID,
+		"receipts":       fmt.Sprint(receiptID),
+		"companies":      companyA,
+		"plans":          "pro",
+		"roles":          "iso-role",
+		"exchange-rates": rateID,
+	}
+	params := map[string]string{
+		":studentId":      studentID,
+		":teacherId":      "iso-teacher",
+		":lessonId":       "iso-lesson",
+		":taskId":         taskID,
+		":notificationId": fmt.Sprint(notification.ID),
+		":discountId":     "iso-discount",
+		":userId":         fmt.Sprint(ownerA),
+		":type":           "student",
+		":job":            "trash_purge",
+	}
+	hijack := gin.H{
+		"name": "Hijacked", "title": "Hijacked", "note": "Hijacked", "notes": "Hijacked", "description": "Hijacked",
+		"status": "inactive", "centerName": "Hijacked", "amount": "1.00", "subject": "Hijacked", "reason": "Hijacked",
+	}
+
+	walked := map[string]bool{}
+	for _, route := range router.Routes() {
+		if !strings.HasPrefix(route.Path, "/api/") || strings.HasPrefix(route.Path, "/api/auth") {
+			continue
+		}
+		segments := strings.Split(route.Path, "/")
+		resolved := true
+		for i, segment := range segments {
+			if !strings.HasPrefix(segment, ":") {
+				continue
+			}
+			if segment == ":id" {
+				segments[i] = ids[segments[i-1]]
+			} else {
+				segments[i] = params[segment]
+			}
+			resolved = resolved && segments[i] != ""
+		}
+		hasParam := strings.Contains(route.Path, ":")
+		if !resolved || (!hasParam && route.Method != "GET" && route.Path != "/api/settings") {
+			continue
+		}
+
+		var body interface{}
+		if route.Method != "GET" && route.Method != "DELETE" {
+			body = hijack
+		}
+		path := strings.Join(segments, "/")
+		w := tenantRequest(router, tokenB, route.Method, path, body)
+		assert.NotContains(t, w.Body.String(), "CompanyA", "%s %s leaks company A: %s", route.Method, path, w.Body.String())
+		walked[route.Method+" "+route.Path] = true
+	}
+	assert.Greater(t, len(walked), 140, "the route walk must cover the mounted routes")
+	for _, route := range []string{
+		"GET /api/cash-shifts/:id/report",
+		"POST /api/cash-shifts/:id/close",
+		"GET /api/installments",
+		"POST /api/subscriptions/:id/installments",
+		"GET /api/payments/online/:id",
+		"POST /api/payments/online/:id/refund",
+		"POST /api/fiscal/receipts/:id/retry",
+		"GET /api/audit-log",
+		"GET /api/trash",
+		"POST /api/trash/:type/:id/restore",
+		"GET /api/migration/data-jobs",
+		"POST /api/personal-data/:type/:id/erase",
+		"POST /api/students/:id/transfer",
+		"GET /api/reports/branches",
+		"PUT /api/platform/plans/:id",
+		"POST /api/platform/companies/:id/impersonate",
+	} {
+		assert.True(t, walked[route], "%s was not walked", route)
+	}
+
+	// Company A still sees its records unchanged
+	for path, name := range map[string]string{
+		"/api/students/" + studentID:                      "CompanyA Student",
+		"/api/leads/" + leadID:                            "CompanyA Lead",
+		"/api/leads/" + leadID + "/tasks":                 "CompanyA Task",
+		"/api/teachers/iso-teacher":                       "CompanyA Teacher",
+		"/api/rooms/iso-room":                             "CompanyA Room",
+		"/api/groups/iso-group":                           "CompanyA Group",
+		"/api/lessons/iso-lesson":                         "CompanyA Lesson",
+		"/api/tariffs/iso-tariff":                         "CompanyA Tariff",
+		"/api/discounts/iso-discount":                     "CompanyA Discount",
+		"/api/subscriptions/types/iso-type":               "CompanyA Type",
+		"/api/subscriptions/iso-sub":                      "CompanyA Type",
+		"/api/payments/transactions/student/" + studentID: "CompanyA Payment",
+		"/api/payments/online/" + intent.ID:               "CompanyA Intent",
+		"/api/debts/student/" + studentID:                 "CompanyA Debt",
+		"/api/settings":                                   "CompanyA Center",
+		"/api/branches/" + branchA:                        "CompanyA Branch",
+		"/api/cash-shifts/current":                        "CompanyA Shift",
+		"/api/trash":                                      "CompanyA Trashed",
+		"/api/roles/iso-role":                             "CompanyA Role",
+		"/api/exchange-rates":                             "470.5",
+	} {
+		w := tenantRequest(router, tokenA, "GET", path, nil)
+		require.Equal(t, http.StatusOK, w.Code, "%s: %s", path, w.Body.String())
+		assert.Contains(t, w.Body.String(), name, path)
+		assert.NotContains(t, w.Body.String(), "Hijacked", path)
+	}
+	w = tenantRequest(router, tokenA, "GET", "/api/subscriptions/iso-sub/installments", nil)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Contains(t, w.Body.String(), `"status":"active"`)
+
+	var isRead bool
+	require.NoError(t, database.Tenant(db, companyA).QueryRow(`SELECT is_read FROM notifications WHERE id = $1`, notification.ID).Scan(&isRead))
+	assert.False(t, isRead)
+
+	// Invoices have no route: company B can neither load company A's invoice nor see it through
+	// row-level security
+	foreign, err := repository.NewInvoiceRepository(db).GetByID(invoice.ID, companyB)
+	assert.True(t, foreign == nil || err != nil, "company B must not load company A's invoice")
+	var visible int
+	require.NoError(t, database.Tenant(db, companyB).QueryRow(`SELECT COUNT(*) FROM invoice WHERE id = $1`, invoice.ID).Scan(&visible))
+	assert.Equal(t, 0, visible)
+}
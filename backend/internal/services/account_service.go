@@ -0,0 +1,242 @@
+package services
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+
+	"classmate-central/internal/logger"
+	"classmate-central/internal/models"
+	"classmate-central/internal/repository"
+
+	"go.uber.org/zap"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	// PasswordResetTTL is how long a password reset link works
+	PasswordResetTTL = time.Hour
+	// EmailChangeTTL is how long a link confirming a new email address works
+	EmailChangeTTL = 24 * time.Hour
+)
+
+var (
+	// ErrAccountTokenInvalid is returned for unknown, expired or already used reset and email change tokens
+	ErrAccountTokenInvalid = errors.New("link is invalid or has expired")
+	// ErrWrongPassword is returned when the current password does not match
+	ErrWrongPassword = errors.New("current password is incorrect")
+	// ErrPasswordUnchanged is returned when the new password equals the current one
+	ErrPasswordUnchanged = errors.New("new password must differ from the current one")
+	// ErrEmailUnchanged is returned when the new email equals the current one
+	ErrEmailUnchanged = errors.New("new email must differ from the current one")
+)
+
+// AccountService implements the self-service credential flows: password reset, password
+// change and email change with verification of the new address
+type AccountService struct {
+	userRepo     *repository.UserRepository
+	tokenRepo    *repository.AccountTokenRepository
+	emailService *EmailService
+}
+
+func NewAccountService(userRepo *repository.UserRepository, tokenRepo *repository.AccountTokenRepository, emailService *EmailService) *AccountService {
+	return &AccountService{
+		userRepo:     userRepo,
+		tokenRepo:    tokenRepo,
+		emailService: emailService,
+	}
+}
+
+// newAccountToken returns a random token for an email link
+func newAccountToken() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// RequestPasswordReset emails a reset link if the address belongs to a user. It succeeds
+// for unknown addresses too and sends in the background, so the response does not reveal
+// which emails are registered.
+func (s *AccountService) RequestPasswordReset(email string) error {
+	user, err := s.userRepo.GetByEmail(strings.TrimSpace(email))
+	if err != nil {
+		return err
+	}
+	if user == nil {
+		logger.Info("Password reset requested for unknown email")
+		return nil
+	}
+
+	token, err := newAccountToken()
+	if err != nil {
+		return err
+	}
+	if err := s.tokenRepo.Create(hashToken(token), user.ID, repository.AccountTokenPasswordReset, nil, time.Now().Add(PasswordResetTTL)); err != nil {
+		return err
+	}
+
+	go func() {
+		if err := s.emailService.SendPasswordResetEmail(user.Email, token, PasswordResetTTL); err != nil {
+			logger.Error("Failed to send password reset email", logger.ErrorField(err), zap.Int("userId", user.ID))
+		}
+	}()
+	logger.Info("Password reset requested", zap.Int("userId", user.ID))
+	return nil
+}
+
+// ResetPassword sets a new password with a reset token and closes every session of the user
+func (s *AccountService) ResetPassword(token, password string) error {
+	accountToken, err := s.tokenRepo.Consume(hashToken(token), repository.AccountTokenPasswordReset)
+	if err != nil {
+		return err
+	}
+	if accountToken == nil {
+		return ErrAccountTokenInvalid
+	}
+	user, err := s.userRepo.GetByID(accountToken.UserID)
+	if err != nil {
+		return err
+	}
+	if user == nil {
+		return ErrAccountTokenInvalid
+	}
+
+	if err := s.setPassword(user, password); err != nil {
+		return err
+	}
+	logger.Info("Password reset completed", zap.Int("userId", user.ID))
+	return nil
+}
+
+// ChangePassword replaces the password of a signed-in user after checking the current one.
+// Every session of the user is closed; the caller issues a new one for the current device.
+func (s *AccountService) ChangePassword(userID int, currentPassword, newPassword string) (*models.User, error) {
+	user, err := s.userRepo.GetByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, ErrWrongPassword
+	}
+	if bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(currentPassword)) != nil {
+		return nil, ErrWrongPassword
+	}
+	if currentPassword == newPassword {
+		return nil, ErrPasswordUnchanged
+	}
+
+	if err := s.setPassword(user, newPassword); err != nil {
+		return nil, err
+	}
+	logger.Info("Password changed", zap.Int("userId", user.ID))
+	return user, nil
+}
+
+// setPassword stores a new password together with revoking all sessions and notifies the owner
+func (s *AccountService) setPassword(user *models.User, password string) error {
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	revoked, err := s.userRepo.UpdatePassword(user.ID, string(hashedPassword))
+	if err != nil {
+		return err
+	}
+	logger.Info("Sessions revoked after password change", zap.Int("userId", user.ID), zap.Int64("count", revoked))
+
+	go func() {
+		if err := s.emailService.SendSecurityNotification(user.Email, "Пароль вашей учётной записи был изменён. Все активные сеансы завершены."); err != nil {
+			logger.Error("Failed to send password change notification", logger.ErrorField(err), zap.Int("userId", user.ID))
+		}
+	}()
+	return nil
+}
+
+// RequestEmailChange checks the password and sends a confirmation link to the new address.
+// The email is only changed once the link is opened.
+func (s *AccountService) RequestEmailChange(userID int, password, newEmail string) error {
+	newEmail = strings.TrimSpace(newEmail)
+	user, err := s.userRepo.GetByID(userID)
+	if err != nil {
+		return err
+	}
+	if user == nil || bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)) != nil {
+		return ErrWrongPassword
+	}
+	if strings.EqualFold(user.Email, newEmail) {
+		return ErrEmailUnchanged
+	}
+	existing, err := s.userRepo.GetByEmail(newEmail)
+	if err != nil {
+		return err
+	}
+	if existing != nil {
+		return repository.ErrEmailTaken
+	}
+
+	token, err := newAccountToken()
+	if err != nil {
+		return err
+	}
+	if err := s.tokenRepo.Create(hashToken(token), user.ID, repository.AccountTokenEmailChange, &newEmail, time.Now().Add(EmailChangeTTL)); err != nil {
+		return err
+	}
+
+	go func() {
+		if err := s.emailService.SendEmailChangeConfirmation(newEmail, token, EmailChangeTTL); err != nil {
+			logger.Error("Failed to send email change confirmation", logger.ErrorField(err), zap.Int("userId", user.ID))
+		}
+	}()
+	logger.Info("Email change requested", zap.Int("userId", user.ID))
+	return nil
+}
+
+// ConfirmEmailChange switches the user to the address the token was sent to and notifies
+// the previous address
+func (s *AccountService) ConfirmEmailChange(token string) (*models.User, error) {
+	accountToken, err := s.tokenRepo.Consume(hashToken(token), repository.AccountTokenEmailChange)
+	if err != nil {
+		return nil, err
+	}
+	if accountToken == nil || accountToken.NewEmail == nil {
+		return nil, ErrAccountTokenInvalid
+	}
+	user, err := s.userRepo.GetByID(accountToken.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, ErrAccountTokenInvalid
+	}
+
+	previousEmail := user.Email
+	if err := s.userRepo.UpdateEmail(user.ID, *accountToken.NewEmail); err != nil {
+		return nil, err
+	}
+	user.Email = *accountToken.NewEmail
+	user.IsEmailVerified = true
+
+	go func() {
+		if err := s.emailService.SendSecurityNotification(previousEmail, "Email для входа в вашу учётную запись был изменён на "+user.Email+"."); err != nil {
+			logger.Error("Failed to send email change notification", logger.ErrorField(err), zap.Int("userId", user.ID))
+		}
+	}()
+	logger.Info("Email changed", zap.Int("userId", user.ID))
+	return user, nil
+}
+
+// CleanupExpiredTokens deletes reset and email change tokens that have expired
+func (s *AccountService) CleanupExpiredTokens() error {
+	deleted, err := s.tokenRepo.DeleteExpired(time.Now())
+	if err != nil {
+		return err
+	}
+	if deleted > 0 {
+		logger.Info("Expired account tokens deleted", zap.Int64("count", deleted))
+	}
+	return nil
+}
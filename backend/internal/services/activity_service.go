@@ -33,13 +33,13 @@ func (s *ActivityService) LogPayment(transaction *models.PaymentTransaction) err
 	var description string
 	switch transaction.Type {
 	case "payment":
-		description = fmt.Sprintf("Оплата: %.2f ₸", transaction.Amount)
+		description = fmt.Sprintf("Оплата: %s", transaction.Amount.Format())
 	case "refund":
-		description = fmt.Sprintf("Возврат: %.2f ₸", transaction.Amount)
+		description = fmt.Sprintf("Возврат: %s", transaction.Amount.Format())
 	case "debt":
-		description = fmt.Sprintf("Долг: %.2f ₸", transaction.Amount)
+		description = fmt.Sprintf("Долг: %s", transaction.Amount.Format())
 	default:
-		description = fmt.Sprintf("Транзакция: %.2f ₸", transaction.Amount)
+		description = fmt.Sprintf("Транзакция: %s", transaction.Amount.Format())
 	}
 
 	activity := &models.StudentActivityLog{
@@ -136,7 +136,7 @@ func (s *ActivityService) LogDebtCreated(debt *models.DebtRecord, createdBy *int
 	metadataJSON, _ := json.Marshal(metadata)
 	metadataStr := string(metadataJSON)
 
-	description := fmt.Sprintf("Создан долг: %.2f ₸", debt.Amount)
+	description := fmt.Sprintf("Создан долг: %s", debt.Amount.Format())
 
 	activity := &models.StudentActivityLog{
 		StudentID:    debt.StudentID,
@@ -6,7 +6,9 @@ import (
 	"fmt"
 	"time"
 
+	"classmate-central/internal/database"
 	"classmate-central/internal/models"
+	"classmate-central/internal/money"
 	"classmate-central/internal/repository"
 )
 
@@ -46,7 +48,7 @@ func NewAttendanceService(
 // MarkAttendanceWithDeduction marks attendance and deducts from subscription if attended
 func (s *AttendanceService) MarkAttendanceWithDeduction(req *models.MarkAttendanceRequest, markedBy *int, companyID string) (*models.LessonAttendance, error) {
 	// Start transaction
-	tx, err := s.db.Begin()
+	tx, err := database.Tenant(s.db, companyID).Begin()
 	if err != nil {
 		return nil, fmt.Errorf("error starting transaction: %w", err)
 	}
@@ -101,13 +103,13 @@ func (s *AttendanceService) MarkAttendanceWithDeduction(req *models.MarkAttendan
 		// Get active subscription with billing type and price using transaction
 		var activeSub models.StudentSubscription
 		var billingType string
-		var pricePerLesson float64
+		var pricePerLesson money.Money
 		query := `
 			SELECT 
 				ss.id, ss.student_id, ss.subscription_type_id,
 				ss.total_lessons, ss.used_lessons, ss.remaining_lessons,
 				ss.start_date, ss.end_date, ss.status, ss.freeze_days_remaining, ss.created_at,
-				ss.price_per_lesson,
+				ss.total_price, ss.price_per_lesson,
 				st.billing_type
 			FROM student_subscriptions ss
 			JOIN subscription_types st ON ss.subscription_type_id = st.id
@@ -120,7 +122,7 @@ func (s *AttendanceService) MarkAttendanceWithDeduction(req *models.MarkAttendan
 			&activeSub.TotalLessons, &activeSub.UsedLessons, &activeSub.LessonsRemaining,
 			&activeSub.StartDate, &activeSub.EndDate,
 			&activeSub.Status, &activeSub.FreezeDaysRemaining, &activeSub.CreatedAt,
-			&pricePerLesson,
+			&activeSub.TotalPrice, &pricePerLesson,
 			&billingType,
 		)
 
@@ -166,8 +168,10 @@ func (s *AttendanceService) MarkAttendanceWithDeduction(req *models.MarkAttendan
 					return nil, fmt.Errorf("error getting updated subscription: %w", err)
 				}
 
-				// Deduct money from student balance
-				if pricePerLesson > 0 {
+				// Deduct money from student balance: the lesson's exact share of the subscription price
+				activeSub.PricePerLesson = pricePerLesson
+				pricePerLesson = activeSub.LessonCharge(activeSub.UsedLessons)
+				if pricePerLesson.IsPositive() {
 					// Ensure student_balance record exists
 					_, err = tx.Exec(`
 						INSERT INTO student_balance (student_id, balance)
@@ -179,15 +183,31 @@ func (s *AttendanceService) MarkAttendanceWithDeduction(req *models.MarkAttendan
 					}
 
 					// Deduct from balance
-					_, err = tx.Exec(`
+					var newBalance money.Money
+					err = tx.QueryRow(`
 						UPDATE student_balance 
 						SET balance = balance - $1
 						WHERE student_id = $2
-					`, pricePerLesson, req.StudentID)
+						RETURNING balance
+					`, pricePerLesson, req.StudentID).Scan(&newBalance)
 					if err != nil {
 						return nil, fmt.Errorf("error deducting from balance: %w", err)
 					}
 
+					// Open a debt for the part of the lesson not covered by the balance, unless the
+					// subscription is paid in installments: those already bill its price
+					billed, err := repository.BilledByInstallments(tx, activeSub.ID)
+					if err != nil {
+						return nil, err
+					}
+					if !billed {
+						_, err = repository.CreateNegativeBalanceDebt(tx, req.StudentID, pricePerLesson, newBalance,
+							fmt.Sprintf("Долг за занятие (Урок ID: %s)", req.LessonID), companyID)
+						if err != nil {
+							return nil, err
+						}
+					}
+
 					// Create deduction transaction for history
 					_, err = tx.Exec(`
                     INSERT INTO payment_transactions (
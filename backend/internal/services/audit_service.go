@@ -0,0 +1,99 @@
+package services
+
+import (
+	"bytes"
+	"encoding/csv"
+	"os"
+	"strconv"
+	"time"
+
+	"classmate-central/internal/logger"
+	"classmate-central/internal/models"
+	"classmate-central/internal/repository"
+
+	"go.uber.org/zap"
+)
+
+// DefaultAuditRetention is how long audit entries are kept unless AUDIT_LOG_RETENTION_DAYS says otherwise
+const DefaultAuditRetention = 365 * 24 * time.Hour
+
+// AuditExportLimit caps the number of entries in one export
+const AuditExportLimit = 50000
+
+type AuditService struct {
+	repo      *repository.AuditRepository
+	retention time.Duration
+}
+
+func NewAuditService(repo *repository.AuditRepository) *AuditService {
+	retention := DefaultAuditRetention
+	if days, err := strconv.Atoi(os.Getenv("AUDIT_LOG_RETENTION_DAYS")); err == nil && days > 0 {
+		retention = time.Duration(days) * 24 * time.Hour
+	}
+	return &AuditService{repo: repo, retention: retention}
+}
+
+// List returns the company's audit entries matching the filter
+func (s *AuditService) List(companyID string, filter models.AuditFilter) ([]*models.AuditEntry, error) {
+	return s.repo.List(companyID, filter)
+}
+
+// ExportCSV returns the entries matching the filter as CSV, newest first
+func (s *AuditService) ExportCSV(companyID string, filter models.AuditFilter) ([]byte, error) {
+	filter.Limit = AuditExportLimit
+	filter.Offset = 0
+	entries, err := s.repo.List(companyID, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	w.Write([]string{"created_at", "user_id", "user_name", "action", "entity_type", "entity_id", "changes", "ip_address", "request_id", "impersonated_by"})
+	for _, entry := range entries {
+		userID := ""
+		if entry.UserID != nil {
+			userID = strconv.Itoa(*entry.UserID)
+		}
+		impersonatedBy := ""
+		if entry.ImpersonatedBy != nil {
+			impersonatedBy = strconv.Itoa(*entry.ImpersonatedBy)
+		}
+		w.Write([]string{
+			entry.CreatedAt.Format(time.RFC3339),
+			userID,
+			entry.UserName,
+			entry.Action,
+			entry.EntityType,
+			stringValue(entry.EntityID),
+			string(entry.Changes),
+			stringValue(entry.IPAddress),
+			stringValue(entry.RequestID),
+			impersonatedBy,
+		})
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// CleanupOld deletes audit entries older than the retention period
+func (s *AuditService) CleanupOld() error {
+	deleted, err := s.repo.DeleteOlderThan(time.Now().Add(-s.retention))
+	if err != nil {
+		return err
+	}
+	if deleted > 0 {
+		logger.Info("Old audit log entries deleted", zap.Int64("count", deleted))
+	}
+	return nil
+}
+
+func stringValue(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
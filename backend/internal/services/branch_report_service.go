@@ -0,0 +1,175 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"classmate-central/internal/logger"
+	"classmate-central/internal/models"
+	"classmate-central/internal/money"
+	"classmate-central/internal/repository"
+
+	"go.uber.org/zap"
+)
+
+// BranchReportService builds consolidated reports across branches for network owners
+type BranchReportService struct {
+	repo            *repository.BranchReportRepository
+	branchRepo      *repository.BranchRepository
+	currencyService *CurrencyService
+}
+
+func NewBranchReportService(repo *repository.BranchReportRepository, branchRepo *repository.BranchRepository, currencyService *CurrencyService) *BranchReportService {
+	return &BranchReportService{repo: repo, branchRepo: branchRepo, currencyService: currencyService}
+}
+
+// GetReport returns revenue, attendance, occupancy and lead conversion for [from, to) per branch
+// and summed. With branchIDs the report has a row for each of those branches, otherwise for
+// every branch of the company. Amounts are converted into currency (the company base currency
+// if empty) at the rate of the day. Revenue without a rate is left out of the figures and
+// returned in Unconverted, so one missing rate does not fail the whole report.
+func (s *BranchReportService) GetReport(companyID string, branchIDs []string, from, to time.Time, currency money.Currency) (*models.BranchReport, error) {
+	converter, err := s.currencyService.Converter(companyID, currency)
+	if err != nil {
+		return nil, err
+	}
+	revenue, err := s.repo.GetRevenue(companyID, branchIDs, from, to)
+	if err != nil {
+		return nil, err
+	}
+	revenue, unconverted, err := ConvertBranchRevenue(revenue, converter)
+	if err != nil {
+		return nil, err
+	}
+	activity, err := s.repo.GetActivity(companyID, branchIDs, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	branches, err := s.branchRepo.GetBranchesByCompany(companyID)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching branches: %w", err)
+	}
+	branchNames := make(map[string]string, len(branches))
+	for _, b := range branches {
+		branchNames[b.ID] = b.Name
+	}
+	selected := branchIDs
+	if len(selected) == 0 {
+		for _, b := range branches {
+			selected = append(selected, b.ID)
+		}
+	}
+
+	report := BuildBranchReport(selected, branchNames, revenue, activity, converter.Currency())
+	report.From, report.To = from, to
+	report.Unconverted = unconverted
+	return report, nil
+}
+
+// ConvertBranchRevenue converts each revenue row into the converter's currency at the rate of its
+// day. Rows in a currency without an exchange rate are left out and returned summed per currency,
+// refunds subtracted.
+func ConvertBranchRevenue(revenue []models.BranchRevenue, converter *CurrencyConverter) ([]models.BranchRevenue, []money.Money, error) {
+	converted := make([]models.BranchRevenue, 0, len(revenue))
+	var unconverted []money.Money
+	for _, r := range revenue {
+		amount, err := converter.Convert(r.Amount, r.Day)
+		if errors.Is(err, ErrNoExchangeRate) {
+			logger.Warn("Revenue left out of branch report", logger.ErrorField(err), zap.String("branch_id", r.BranchID))
+			if r.Type == "refund" {
+				unconverted = addUnconverted(unconverted, r.Amount.Neg())
+			} else {
+				unconverted = addUnconverted(unconverted, r.Amount)
+			}
+			continue
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		r.Amount = amount
+		converted = append(converted, r)
+	}
+	return converted, unconverted, nil
+}
+
+// BuildBranchReport puts the per-branch figures together, with a row for every selected branch
+// and for any other branch (such as data without a branch) that has figures, and sums them
+func BuildBranchReport(branchIDs []string, branchNames map[string]string, revenue []models.BranchRevenue, activity map[string]*models.BranchReportMetrics, currency money.Currency) *models.BranchReport {
+	zero := money.New(0, currency)
+	byBranch := map[string]*models.BranchReportMetrics{}
+	get := func(branchID string) *models.BranchReportMetrics {
+		m, ok := byBranch[branchID]
+		if !ok {
+			m = &models.BranchReportMetrics{Payments: zero, Refunds: zero}
+			byBranch[branchID] = m
+		}
+		return m
+	}
+	for _, id := range branchIDs {
+		get(id)
+	}
+	for _, r := range revenue {
+		m := get(r.BranchID)
+		switch r.Type {
+		case "payment":
+			m.Payments = m.Payments.Add(r.Amount)
+			m.PaymentCount += r.Count
+		case "refund":
+			m.Refunds = m.Refunds.Add(r.Amount)
+		}
+	}
+	for branchID, a := range activity {
+		m := get(branchID)
+		m.AttendanceMarked, m.Attended, m.Missed = a.AttendanceMarked, a.Attended, a.Missed
+		m.Lessons, m.Seats, m.SeatsTaken = a.Lessons, a.Seats, a.SeatsTaken
+		m.Leads, m.LeadsEnrolled = a.Leads, a.LeadsEnrolled
+	}
+
+	report := &models.BranchReport{Currency: currency, Branches: []models.BranchReportRow{}}
+	total := models.BranchReportMetrics{Payments: zero, Refunds: zero}
+	for branchID, m := range byBranch {
+		finishBranchMetrics(m)
+		name := branchNames[branchID]
+		if name == "" {
+			name = "Без филиала"
+		}
+		report.Branches = append(report.Branches, models.BranchReportRow{BranchID: branchID, BranchName: name, Metrics: *m})
+
+		total.Payments = total.Payments.Add(m.Payments)
+		total.Refunds = total.Refunds.Add(m.Refunds)
+		total.PaymentCount += m.PaymentCount
+		total.AttendanceMarked += m.AttendanceMarked
+		total.Attended += m.Attended
+		total.Missed += m.Missed
+		total.Lessons += m.Lessons
+		total.Seats += m.Seats
+		total.SeatsTaken += m.SeatsTaken
+		total.Leads += m.Leads
+		total.LeadsEnrolled += m.LeadsEnrolled
+	}
+	finishBranchMetrics(&total)
+	report.Total = total
+
+	sort.Slice(report.Branches, func(i, j int) bool {
+		return report.Branches[i].BranchName < report.Branches[j].BranchName
+	})
+	return report
+}
+
+// finishBranchMetrics computes the revenue and the rates from the sums
+func finishBranchMetrics(m *models.BranchReportMetrics) {
+	m.Revenue = m.Payments.Sub(m.Refunds)
+	m.AttendanceRate = percent(m.Attended, m.AttendanceMarked)
+	m.Occupancy = percent(m.SeatsTaken, m.Seats)
+	m.LeadConversion = percent(m.LeadsEnrolled, m.Leads)
+}
+
+func percent(part, whole int) float64 {
+	if whole == 0 {
+		return 0
+	}
+	return float64(part) / float64(whole) * 100
+}
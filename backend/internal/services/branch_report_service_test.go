@@ -0,0 +1,118 @@
+package services
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"classmate-central/internal/models"
+	"classmate-central/internal/money"
+
+	"github.com/xuri/excelize/v2"
+)
+
+func TestBuildBranchReport_PerBranchAndTotal(t *testing.T) {
+	day := time.Date(2025, 3, 10, 0, 0, 0, 0, time.UTC)
+	revenue := []models.BranchRevenue{
+		{BranchID: "b1", Day: day, Type: "payment", Amount: money.FromMajor(1000, money.KZT), Count: 2},
+		{BranchID: "b1", Day: day, Type: "refund", Amount: money.FromMajor(200, money.KZT), Count: 1},
+		{BranchID: "b2", Day: day, Type: "payment", Amount: money.FromMajor(500, money.KZT), Count: 1},
+	}
+	activity := map[string]*models.BranchReportMetrics{
+		"b1": {AttendanceMarked: 10, Attended: 8, Missed: 2, Lessons: 4, Seats: 40, SeatsTaken: 30, Leads: 4, LeadsEnrolled: 1},
+		"b2": {AttendanceMarked: 10, Attended: 4, Missed: 6, Leads: 1, LeadsEnrolled: 1},
+	}
+	names := map[string]string{"b1": "Центр", "b2": "Север", "b3": "Юг"}
+
+	report := BuildBranchReport([]string{"b1", "b2", "b3"}, names, revenue, activity, money.KZT)
+
+	if len(report.Branches) != 3 {
+		t.Fatalf("expected 3 branches, got %d", len(report.Branches))
+	}
+	// Sorted by branch name: Север, Центр, Юг; a selected branch without data still gets a row
+	north, center, south := report.Branches[0].Metrics, report.Branches[1].Metrics, report.Branches[2].Metrics
+	if report.Branches[0].BranchID != "b2" || report.Branches[1].BranchID != "b1" || report.Branches[2].BranchID != "b3" {
+		t.Fatalf("unexpected branch order: %+v", report.Branches)
+	}
+	if center.Revenue.Minor() != 80000 || center.PaymentCount != 2 || center.AttendanceRate != 80 || center.Occupancy != 75 || center.LeadConversion != 25 {
+		t.Errorf("unexpected center metrics: %+v", center)
+	}
+	if north.Revenue.Minor() != 50000 || north.Occupancy != 0 {
+		t.Errorf("unexpected north metrics: %+v", north)
+	}
+	if !south.Revenue.IsZero() || south.Revenue.Currency() != money.KZT {
+		t.Errorf("unexpected south metrics: %+v", south)
+	}
+
+	// Rates of the total come from the summed counts, not from averaging the branch rates
+	total := report.Total
+	if total.Revenue.Minor() != 130000 || total.AttendanceRate != 60 || total.LeadConversion != 40 || total.Occupancy != 75 {
+		t.Errorf("unexpected totals: %+v", total)
+	}
+}
+
+func TestBuildBranchReport_DataWithoutBranch(t *testing.T) {
+	activity := map[string]*models.BranchReportMetrics{"": {Leads: 2}}
+	report := BuildBranchReport([]string{"b1"}, map[string]string{"b1": "Центр"}, nil, activity, money.KZT)
+
+	if len(report.Branches) != 2 || report.Branches[0].BranchName != "Без филиала" || report.Total.Leads != 2 {
+		t.Errorf("unexpected report: %+v", report)
+	}
+}
+
+func TestConvertBranchRevenue_LeavesOutRowsWithoutRate(t *testing.T) {
+	day := time.Date(2025, 3, 10, 0, 0, 0, 0, time.UTC)
+	conv := NewCurrencyConverter(money.KZT, []models.ExchangeRate{
+		exchangeRate(money.USD, money.KZT, "500", day.AddDate(0, -1, 0)),
+	})
+	revenue := []models.BranchRevenue{
+		{BranchID: "b1", Day: day, Type: "payment", Amount: money.FromMajor(1000, money.KZT), Count: 1},
+		{BranchID: "b2", Day: day, Type: "payment", Amount: money.FromMajor(10, money.USD), Count: 1},
+		{BranchID: "b3", Day: day, Type: "payment", Amount: money.FromMajor(50000, money.UZS), Count: 2},
+		{BranchID: "b3", Day: day, Type: "refund", Amount: money.FromMajor(10000, money.UZS), Count: 1},
+	}
+
+	converted, unconverted, err := ConvertBranchRevenue(revenue, conv)
+	if err != nil {
+		t.Fatalf("ConvertBranchRevenue: %v", err)
+	}
+	if len(converted) != 2 || converted[0].Amount.Minor() != 100000 || converted[1].Amount.Minor() != 500000 {
+		t.Errorf("unexpected converted revenue: %+v", converted)
+	}
+	if len(unconverted) != 1 || !unconverted[0].Equal(money.FromMajor(40000, money.UZS)) {
+		t.Errorf("unconverted = %v, want 40000 UZS", unconverted)
+	}
+}
+
+func TestExportBranchReportExcel_SheetPerBranch(t *testing.T) {
+	names := map[string]string{"b1": "Центр", "b2": "Центр", "b3": "Филиал: [север]/2025 с очень длинным названием"}
+	report := BuildBranchReport([]string{"b1", "b2", "b3"}, names, nil, nil, money.KZT)
+	report.From = time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)
+	report.To = time.Date(2025, 4, 1, 0, 0, 0, 0, time.UTC)
+
+	data, err := NewExportService().ExportBranchReportExcel(report)
+	if err != nil {
+		t.Fatalf("export failed: %v", err)
+	}
+	f, err := excelize.OpenReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("invalid workbook: %v", err)
+	}
+	defer f.Close()
+
+	sheets := f.GetSheetList()
+	if len(sheets) != 4 || sheets[0] != "Сводка" {
+		t.Fatalf("unexpected sheets: %v", sheets)
+	}
+	if sheets[1] == sheets[2] {
+		t.Errorf("branches with the same name share a sheet: %v", sheets)
+	}
+	for _, sheet := range sheets {
+		if len([]rune(sheet)) > 31 {
+			t.Errorf("sheet name too long: %q", sheet)
+		}
+	}
+	if value, _ := f.GetCellValue("Сводка", "A7"); value != "Итого" {
+		t.Errorf("expected the total row after the branches, got %q", value)
+	}
+}
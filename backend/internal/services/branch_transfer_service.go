@@ -0,0 +1,146 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"classmate-central/internal/database"
+	"classmate-central/internal/logger"
+	"classmate-central/internal/models"
+	"classmate-central/internal/money"
+	"classmate-central/internal/repository"
+
+	"go.uber.org/zap"
+)
+
+// ErrInvalidSubscriptionPolicy is returned for a transfer policy other than move, refund and keep
+var ErrInvalidSubscriptionPolicy = errors.New("subscriptionPolicy must be move, refund or keep")
+
+// ErrInvalidTeacherBranches is returned when the branches or working hours of a teacher are inconsistent
+var ErrInvalidTeacherBranches = errors.New("invalid teacher branches")
+
+// BranchTransferService transfers students between branches and shares teachers across branches
+type BranchTransferService struct {
+	repo            *repository.BranchTransferRepository
+	currencyService *CurrencyService
+}
+
+func NewBranchTransferService(repo *repository.BranchTransferRepository, currencyService *CurrencyService) *BranchTransferService {
+	return &BranchTransferService{repo: repo, currencyService: currencyService}
+}
+
+// TransferStudent moves a student of the actor's company to another branch. Money moving to a
+// branch with another currency is converted at today's rate; a missing rate returns
+// ErrNoExchangeRate. Returns nil if the company has no such student.
+func (s *BranchTransferService) TransferStudent(actor database.Actor, studentID string, req models.StudentTransferRequest) (*models.StudentTransfer, error) {
+	switch req.SubscriptionPolicy {
+	case models.TransferMoveSubscriptions, models.TransferRefundSubscriptions, models.TransferKeepSubscriptions:
+	default:
+		return nil, ErrInvalidSubscriptionPolicy
+	}
+
+	currency, found, err := s.currencyService.BranchCurrency(actor.CompanyID, req.BranchID)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, repository.ErrBranchUnavailable
+	}
+	converter, err := s.currencyService.Converter(actor.CompanyID, currency)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	convert := func(m money.Money) (money.Money, error) {
+		return converter.Convert(m, now)
+	}
+
+	transfer, err := s.repo.TransferStudent(actor, studentID, req, currency, convert)
+	if err == nil && transfer != nil {
+		logger.Info("Student transferred to another branch",
+			zap.String("company_id", actor.CompanyID),
+			zap.String("student_id", studentID),
+			zap.String("to_branch_id", req.BranchID),
+			zap.String("subscription_policy", req.SubscriptionPolicy),
+			zap.Int("user_id", actor.UserID))
+	}
+	return transfer, err
+}
+
+// GetStudentTransfers returns the transfers of a student, newest first
+func (s *BranchTransferService) GetStudentTransfers(studentID, companyID string) ([]models.StudentTransfer, error) {
+	return s.repo.GetStudentTransfers(studentID, companyID)
+}
+
+// GetTeacherBranches returns the branches a teacher works in, or nil if the company has no such teacher
+func (s *BranchTransferService) GetTeacherBranches(teacherID, companyID string) ([]models.TeacherBranch, error) {
+	return s.repo.GetTeacherBranches(teacherID, companyID)
+}
+
+// SetTeacherBranches replaces the branches a teacher works in and the working hours there
+func (s *BranchTransferService) SetTeacherBranches(actor database.Actor, teacherID string, req models.SetTeacherBranchesRequest) error {
+	if err := ValidateTeacherBranches(req); err != nil {
+		return err
+	}
+	for i := range req.Branches {
+		if req.Branches[i].Schedule == nil {
+			req.Branches[i].Schedule = []models.TeacherWorkingHours{}
+		}
+	}
+	return s.repo.SetTeacherBranches(actor, teacherID, req.PrimaryBranchID, req.Branches)
+}
+
+// ValidateTeacherBranches checks that the primary branch is one of the branches, that no branch
+// is listed twice and that the working hours are valid. A teacher cannot be in two places at once,
+// so slots on the same weekday must not overlap, whichever branch they are in.
+func ValidateTeacherBranches(req models.SetTeacherBranchesRequest) error {
+	type slot struct {
+		branchID   string
+		start, end time.Time
+	}
+	byWeekday := map[int][]slot{}
+	seen := map[string]bool{}
+	for _, b := range req.Branches {
+		if b.BranchID == "" {
+			return fmt.Errorf("%w: branchId is required", ErrInvalidTeacherBranches)
+		}
+		if seen[b.BranchID] {
+			return fmt.Errorf("%w: branch %s is listed twice", ErrInvalidTeacherBranches, b.BranchID)
+		}
+		seen[b.BranchID] = true
+
+		for _, h := range b.Schedule {
+			if h.Weekday < 0 || h.Weekday > 6 {
+				return fmt.Errorf("%w: weekday must be 0 (Sunday) to 6", ErrInvalidTeacherBranches)
+			}
+			start, err := time.Parse("15:04", h.Start)
+			if err != nil {
+				return fmt.Errorf("%w: start %q is not HH:MM", ErrInvalidTeacherBranches, h.Start)
+			}
+			end, err := time.Parse("15:04", h.End)
+			if err != nil {
+				return fmt.Errorf("%w: end %q is not HH:MM", ErrInvalidTeacherBranches, h.End)
+			}
+			if !end.After(start) {
+				return fmt.Errorf("%w: working hours must end after they start", ErrInvalidTeacherBranches)
+			}
+			byWeekday[h.Weekday] = append(byWeekday[h.Weekday], slot{branchID: b.BranchID, start: start, end: end})
+		}
+	}
+	if !seen[req.PrimaryBranchID] {
+		return fmt.Errorf("%w: the primary branch must be one of the branches", ErrInvalidTeacherBranches)
+	}
+
+	for weekday, slots := range byWeekday {
+		sort.Slice(slots, func(i, j int) bool { return slots[i].start.Before(slots[j].start) })
+		for i := 1; i < len(slots); i++ {
+			if slots[i].start.Before(slots[i-1].end) {
+				return fmt.Errorf("%w: working hours on weekday %d overlap (branches %s and %s)",
+					ErrInvalidTeacherBranches, weekday, slots[i-1].branchID, slots[i].branchID)
+			}
+		}
+	}
+	return nil
+}
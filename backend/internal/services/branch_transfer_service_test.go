@@ -0,0 +1,74 @@
+package services
+
+import (
+	"errors"
+	"testing"
+
+	"classmate-central/internal/database"
+	"classmate-central/internal/models"
+	"classmate-central/internal/money"
+)
+
+func TestValidateTeacherBranches(t *testing.T) {
+	hours := func(weekday int, start, end string) models.TeacherWorkingHours {
+		return models.TeacherWorkingHours{Weekday: weekday, Start: start, End: end}
+	}
+	valid := models.SetTeacherBranchesRequest{
+		PrimaryBranchID: "b1",
+		Branches: []models.TeacherBranch{
+			{BranchID: "b1", Schedule: []models.TeacherWorkingHours{hours(1, "09:00", "13:00"), hours(3, "09:00", "18:00")}},
+			// Afternoons in the second branch, right after the morning in the first one
+			{BranchID: "b2", Schedule: []models.TeacherWorkingHours{hours(1, "13:00", "18:00")}},
+		},
+	}
+	if err := ValidateTeacherBranches(valid); err != nil {
+		t.Fatalf("expected valid branches, got %v", err)
+	}
+
+	cases := map[string]models.SetTeacherBranchesRequest{
+		"primary not listed": {PrimaryBranchID: "b3", Branches: valid.Branches},
+		"no branches":        {PrimaryBranchID: "b1"},
+		"branch twice": {PrimaryBranchID: "b1", Branches: []models.TeacherBranch{
+			{BranchID: "b1"}, {BranchID: "b1"},
+		}},
+		"bad weekday": {PrimaryBranchID: "b1", Branches: []models.TeacherBranch{
+			{BranchID: "b1", Schedule: []models.TeacherWorkingHours{hours(7, "09:00", "10:00")}},
+		}},
+		"bad time": {PrimaryBranchID: "b1", Branches: []models.TeacherBranch{
+			{BranchID: "b1", Schedule: []models.TeacherWorkingHours{hours(1, "9am", "10:00")}},
+		}},
+		"ends before start": {PrimaryBranchID: "b1", Branches: []models.TeacherBranch{
+			{BranchID: "b1", Schedule: []models.TeacherWorkingHours{hours(1, "10:00", "09:00")}},
+		}},
+		"overlap across branches": {PrimaryBranchID: "b1", Branches: []models.TeacherBranch{
+			{BranchID: "b1", Schedule: []models.TeacherWorkingHours{hours(2, "09:00", "14:00")}},
+			{BranchID: "b2", Schedule: []models.TeacherWorkingHours{hours(2, "13:00", "18:00")}},
+		}},
+	}
+	for name, req := range cases {
+		if err := ValidateTeacherBranches(req); !errors.Is(err, ErrInvalidTeacherBranches) {
+			t.Errorf("%s: expected ErrInvalidTeacherBranches, got %v", name, err)
+		}
+	}
+}
+
+func TestTransferStudentRejectsUnknownPolicy(t *testing.T) {
+	s := NewBranchTransferService(nil, nil)
+	_, err := s.TransferStudent(database.Actor{CompanyID: "c1"}, "s1", models.StudentTransferRequest{BranchID: "b2", SubscriptionPolicy: "split"})
+	if !errors.Is(err, ErrInvalidSubscriptionPolicy) {
+		t.Fatalf("expected ErrInvalidSubscriptionPolicy, got %v", err)
+	}
+}
+
+func TestStudentSubscriptionUnusedValue(t *testing.T) {
+	// 10 000 ₸ for 3 lessons is charged 3333.34 + 3333.33 + 3333.33
+	sub := models.StudentSubscription{TotalLessons: 3, UsedLessons: 1, TotalPrice: money.FromMajor(10000, money.KZT), Currency: money.KZT}
+	if got := sub.UnusedValue(); got.Minor() != 666666 {
+		t.Errorf("expected 6666.66 unused, got %s", got)
+	}
+
+	sub.UsedLessons = 3
+	if got := sub.UnusedValue(); !got.IsZero() {
+		t.Errorf("expected nothing unused, got %s", got)
+	}
+}
@@ -0,0 +1,189 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"classmate-central/internal/database"
+	"classmate-central/internal/logger"
+	"classmate-central/internal/models"
+	"classmate-central/internal/repository"
+
+	"go.uber.org/zap"
+)
+
+// ErrConfirmationMismatch is returned when the typed confirmation is not the company name
+var ErrConfirmationMismatch = errors.New("confirmation does not match the company name")
+
+// DefaultSnapshotRetention is how long company snapshots are kept unless COMPANY_SNAPSHOT_RETENTION_DAYS says otherwise
+const DefaultSnapshotRetention = 30 * 24 * time.Hour
+
+// dataJobHistory is the number of jobs returned by ListJobs
+const dataJobHistory = 20
+
+// CompanyDataService wipes and restores a company's data as background jobs. Every job stores
+// a snapshot of the data it is about to change, in the same transaction as the change.
+type CompanyDataService struct {
+	repo        *repository.CompanyDataRepository
+	companyRepo *repository.CompanyRepository
+	retention   time.Duration
+}
+
+func NewCompanyDataService(repo *repository.CompanyDataRepository, companyRepo *repository.CompanyRepository) *CompanyDataService {
+	retention := DefaultSnapshotRetention
+	if days, err := strconv.Atoi(os.Getenv("COMPANY_SNAPSHOT_RETENTION_DAYS")); err == nil && days > 0 {
+		retention = time.Duration(days) * 24 * time.Hour
+	}
+	return &CompanyDataService{repo: repo, companyRepo: companyRepo, retention: retention}
+}
+
+// StartWipe checks the confirmation and starts clearing the actor's company data in the
+// background. Returns ErrDataJobActive if another wipe or restore is running.
+func (s *CompanyDataService) StartWipe(actor database.Actor, confirmation string) (*models.CompanyDataJob, error) {
+	if err := s.confirm(actor.CompanyID, confirmation); err != nil {
+		return nil, err
+	}
+	return s.start(&models.CompanyDataJob{Kind: models.DataJobWipe}, actor)
+}
+
+// StartRestore checks the confirmation and starts replacing the company's data with a
+// snapshot in the background. Returns sql.ErrNoRows if the company has no such snapshot.
+func (s *CompanyDataService) StartRestore(actor database.Actor, snapshotID int64, confirmation string) (*models.CompanyDataJob, error) {
+	if err := s.confirm(actor.CompanyID, confirmation); err != nil {
+		return nil, err
+	}
+	snapshot, err := s.repo.GetSnapshot(actor.CompanyID, snapshotID)
+	if err != nil {
+		return nil, err
+	}
+	if snapshot == nil {
+		return nil, sql.ErrNoRows
+	}
+	return s.start(&models.CompanyDataJob{Kind: models.DataJobRestore, SourceSnapshotID: &snapshot.ID}, actor)
+}
+
+// confirm requires the company name to be typed, so a stray request cannot destroy data
+func (s *CompanyDataService) confirm(companyID, confirmation string) error {
+	company, err := s.companyRepo.GetByID(companyID)
+	if err != nil {
+		return err
+	}
+	if company == nil || !confirmationMatches(company.Name, confirmation) {
+		return ErrConfirmationMismatch
+	}
+	return nil
+}
+
+func confirmationMatches(companyName, confirmation string) bool {
+	name := strings.TrimSpace(companyName)
+	return name != "" && strings.TrimSpace(confirmation) == name
+}
+
+func (s *CompanyDataService) start(job *models.CompanyDataJob, actor database.Actor) (*models.CompanyDataJob, error) {
+	job.CompanyID = actor.CompanyID
+	if actor.UserID != 0 {
+		job.CreatedBy = &actor.UserID
+	}
+	if err := s.repo.CreateJob(job); err != nil {
+		return nil, err
+	}
+	go s.run(*job, actor)
+	return job, nil
+}
+
+// run executes a job and records its outcome; the job row is the only place its result is kept
+func (s *CompanyDataService) run(job models.CompanyDataJob, actor database.Actor) {
+	fields := []zap.Field{zap.Int64("job_id", job.ID), zap.String("company_id", job.CompanyID), zap.String("kind", job.Kind)}
+	defer func() {
+		if r := recover(); r != nil {
+			logger.Error("Company data job panicked", append(fields, zap.Any("panic", r))...)
+			s.fail(job.ID, fmt.Sprintf("internal error: %v", r))
+		}
+	}()
+
+	progress := func(step string) {
+		if err := s.repo.SetJobStep(job.ID, step); err != nil {
+			logger.Warn("Failed to update company data job", append(fields, logger.ErrorField(err))...)
+		}
+	}
+
+	var snapshotID int64
+	var result map[string]map[string]int64
+	var err error
+	switch job.Kind {
+	case models.DataJobWipe:
+		var deleted map[string]int64
+		snapshotID, deleted, err = s.repo.Wipe(actor, progress)
+		result = map[string]map[string]int64{"deleted": deleted}
+	case models.DataJobRestore:
+		var deleted, restored map[string]int64
+		snapshotID, deleted, restored, err = s.repo.Restore(*job.SourceSnapshotID, actor, progress)
+		result = map[string]map[string]int64{"deleted": deleted, "restored": restored}
+	default:
+		err = fmt.Errorf("unknown job kind %q", job.Kind)
+	}
+	if err != nil {
+		logger.Error("Company data job failed", append(fields, logger.ErrorField(err))...)
+		s.fail(job.ID, err.Error())
+		return
+	}
+
+	if err := s.repo.CompleteJob(job.ID, snapshotID, result); err != nil {
+		logger.Error("Failed to complete company data job", append(fields, logger.ErrorField(err))...)
+		return
+	}
+	logger.Info("Company data job completed", append(fields, zap.Int64("snapshot_id", snapshotID))...)
+}
+
+func (s *CompanyDataService) fail(jobID int64, message string) {
+	if err := s.repo.FailJob(jobID, message); err != nil {
+		logger.Error("Failed to record company data job failure", zap.Int64("job_id", jobID), logger.ErrorField(err))
+	}
+}
+
+// GetJob returns a job of the company, or nil if there is none with that ID
+func (s *CompanyDataService) GetJob(companyID string, id int64) (*models.CompanyDataJob, error) {
+	return s.repo.GetJob(companyID, id)
+}
+
+// ListJobs returns the company's latest jobs
+func (s *CompanyDataService) ListJobs(companyID string) ([]*models.CompanyDataJob, error) {
+	return s.repo.ListJobs(companyID, dataJobHistory)
+}
+
+// ListSnapshots returns the company's snapshots that can be restored
+func (s *CompanyDataService) ListSnapshots(companyID string) ([]*models.CompanySnapshot, error) {
+	return s.repo.ListSnapshots(companyID)
+}
+
+// FailInterrupted marks jobs left unfinished by a previous run of the server as failed. Their
+// transaction was rolled back, so the data is as it was before the job.
+func (s *CompanyDataService) FailInterrupted() error {
+	failed, err := s.repo.FailUnfinishedJobs("interrupted by a server restart; no data was changed")
+	if failed > 0 {
+		logger.Warn("Interrupted company data jobs marked failed", zap.Int64("count", failed))
+	}
+	return err
+}
+
+// CleanupOldSnapshots deletes snapshots older than the retention period
+func (s *CompanyDataService) CleanupOldSnapshots() error {
+	deleted, err := s.repo.DeleteSnapshotsOlderThan(time.Now().Add(-s.retention), "")
+	if err != nil {
+		return err
+	}
+	if deleted > 0 {
+		logger.Info("Old company snapshots deleted", zap.Int64("count", deleted))
+	}
+	return nil
+}
+
+// CleanupCompanySnapshots is CleanupOldSnapshots for one company. Returns the number of snapshots deleted.
+func (s *CompanyDataService) CleanupCompanySnapshots(companyID string) (int64, error) {
+	return s.repo.DeleteSnapshotsOlderThan(time.Now().Add(-s.retention), companyID)
+}
@@ -0,0 +1,15 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConfirmationMatches(t *testing.T) {
+	assert.True(t, confirmationMatches("Acme School", "Acme School"))
+	assert.True(t, confirmationMatches("Acme School", "  Acme School\n"))
+	assert.False(t, confirmationMatches("Acme School", "acme school"))
+	assert.False(t, confirmationMatches("Acme School", ""))
+	assert.False(t, confirmationMatches("", ""))
+}
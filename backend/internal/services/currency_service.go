@@ -0,0 +1,128 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"classmate-central/internal/models"
+	"classmate-central/internal/money"
+	"classmate-central/internal/repository"
+)
+
+// ErrNoExchangeRate is returned when an amount cannot be converted because no rate is effective at that date
+var ErrNoExchangeRate = errors.New("no exchange rate")
+
+type CurrencyService struct {
+	currencyRepo *repository.CurrencyRepository
+}
+
+func NewCurrencyService(currencyRepo *repository.CurrencyRepository) *CurrencyService {
+	return &CurrencyService{currencyRepo: currencyRepo}
+}
+
+// BaseCurrency returns the base currency of the company
+func (s *CurrencyService) BaseCurrency(companyID string) (money.Currency, error) {
+	return s.currencyRepo.GetBaseCurrency(companyID)
+}
+
+// BranchCurrency returns the effective currency of a branch of the company, and false if the
+// company has no such branch
+func (s *CurrencyService) BranchCurrency(companyID, branchID string) (money.Currency, bool, error) {
+	settings, err := s.currencyRepo.GetSettings(companyID)
+	if err != nil {
+		return "", false, err
+	}
+	for _, b := range settings.Branches {
+		if b.BranchID == branchID {
+			return b.EffectiveCurrency, true, nil
+		}
+	}
+	return "", false, nil
+}
+
+// Converter returns a converter into the given currency (company base currency when empty)
+// loaded with every rate of the company effective up to now
+func (s *CurrencyService) Converter(companyID string, to money.Currency) (*CurrencyConverter, error) {
+	if to == "" {
+		base, err := s.currencyRepo.GetBaseCurrency(companyID)
+		if err != nil {
+			return nil, err
+		}
+		to = base
+	}
+	rates, err := s.currencyRepo.GetRatesUntil(time.Now(), companyID)
+	if err != nil {
+		return nil, err
+	}
+	return NewCurrencyConverter(to, rates), nil
+}
+
+// CurrencyConverter converts amounts into a single report currency using the rate effective at a date
+type CurrencyConverter struct {
+	to    money.Currency
+	rates map[[2]money.Currency][]models.ExchangeRate // sorted by effective date
+}
+
+// NewCurrencyConverter builds a converter into the given currency from the company's rates
+func NewCurrencyConverter(to money.Currency, rates []models.ExchangeRate) *CurrencyConverter {
+	if to == "" {
+		to = money.DefaultCurrency
+	}
+	c := &CurrencyConverter{to: to, rates: make(map[[2]money.Currency][]models.ExchangeRate)}
+	for _, rate := range rates {
+		key := [2]money.Currency{rate.FromCurrency, rate.ToCurrency}
+		c.rates[key] = append(c.rates[key], rate)
+	}
+	for key := range c.rates {
+		list := c.rates[key]
+		sort.Slice(list, func(i, j int) bool { return list[i].EffectiveDate.Before(list[j].EffectiveDate) })
+	}
+	return c
+}
+
+// Currency returns the target currency of the converter
+func (c *CurrencyConverter) Currency() money.Currency {
+	return c.to
+}
+
+// latest returns the last rate of the pair effective on or before at
+func (c *CurrencyConverter) latest(from, to money.Currency, at time.Time) (money.Rate, bool) {
+	list := c.rates[[2]money.Currency{from, to}]
+	i := sort.Search(len(list), func(i int) bool { return list[i].EffectiveDate.After(at) })
+	if i == 0 {
+		return money.Rate{}, false
+	}
+	return list[i-1].Rate, true
+}
+
+// Convert converts the amount into the target currency with the rate effective at the given time.
+// A direct rate is preferred; otherwise the inverse of the opposite pair is used.
+func (c *CurrencyConverter) Convert(m money.Money, at time.Time) (money.Money, error) {
+	from := m.Currency()
+	if from == c.to {
+		return m, nil
+	}
+	rate, ok := c.latest(from, c.to, at)
+	if !ok {
+		inverse, found := c.latest(c.to, from, at)
+		if !found {
+			return money.Money{}, fmt.Errorf("%w: %s to %s on %s", ErrNoExchangeRate, from, c.to, at.Format("2006-01-02"))
+		}
+		rate = inverse.Inverse()
+	}
+	return m.Convert(rate, c.to, money.DefaultRounding)
+}
+
+// addUnconverted adds an amount that has no exchange rate into the report currency to the
+// per-currency sums a report shows next to its totals
+func addUnconverted(sums []money.Money, amount money.Money) []money.Money {
+	for i := range sums {
+		if sums[i].Currency() == amount.Currency() {
+			sums[i] = sums[i].Add(amount)
+			return sums
+		}
+	}
+	return append(sums, amount)
+}
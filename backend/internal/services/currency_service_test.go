@@ -0,0 +1,74 @@
+package services
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"classmate-central/internal/models"
+	"classmate-central/internal/money"
+)
+
+func exchangeRate(from, to money.Currency, rate string, effective time.Time) models.ExchangeRate {
+	r, err := money.ParseRate(rate)
+	if err != nil {
+		panic(err)
+	}
+	return models.ExchangeRate{FromCurrency: from, ToCurrency: to, Rate: r, EffectiveDate: effective}
+}
+
+func TestCurrencyConverter_UsesRateEffectiveAtDate(t *testing.T) {
+	jan := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	feb := time.Date(2025, 2, 1, 0, 0, 0, 0, time.UTC)
+	conv := NewCurrencyConverter(money.KZT, []models.ExchangeRate{
+		exchangeRate(money.USD, money.KZT, "520", feb),
+		exchangeRate(money.USD, money.KZT, "500", jan),
+	})
+
+	cases := []struct {
+		at   time.Time
+		want int64
+	}{
+		{jan.AddDate(0, 0, 10), 5000000},
+		{feb, 5200000},
+		{feb.AddDate(0, 3, 0), 5200000},
+	}
+	for _, tc := range cases {
+		got, err := conv.Convert(money.FromMajor(100, money.USD), tc.at)
+		if err != nil {
+			t.Fatalf("Convert at %s: %v", tc.at.Format("2006-01-02"), err)
+		}
+		if got.Minor() != tc.want || got.Currency() != money.KZT {
+			t.Errorf("Convert at %s = %s %s, want %d KZT", tc.at.Format("2006-01-02"), got, got.Currency(), tc.want)
+		}
+	}
+
+	if _, err := conv.Convert(money.FromMajor(100, money.USD), jan.AddDate(0, 0, -1)); !errors.Is(err, ErrNoExchangeRate) {
+		t.Errorf("expected ErrNoExchangeRate before the first rate, got %v", err)
+	}
+}
+
+func TestCurrencyConverter_InverseAndSameCurrency(t *testing.T) {
+	jan := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	conv := NewCurrencyConverter(money.UZS, []models.ExchangeRate{
+		exchangeRate(money.UZS, money.KZT, "0.04", jan),
+	})
+
+	// Only UZS→KZT is known: KZT→UZS uses the inverse (25 сўм per tenge)
+	got, err := conv.Convert(money.FromMajor(1000, money.KZT), jan)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Minor() != 2500000 {
+		t.Errorf("inverse conversion = %s, want 25000.00", got)
+	}
+
+	same := money.FromMajor(42, money.UZS)
+	if got, err := conv.Convert(same, jan); err != nil || !got.Equal(same) {
+		t.Errorf("same currency conversion = %s, %v", got, err)
+	}
+
+	if _, err := conv.Convert(money.FromMajor(1, money.EUR), jan); !errors.Is(err, ErrNoExchangeRate) {
+		t.Errorf("expected ErrNoExchangeRate for unknown pair, got %v", err)
+	}
+}
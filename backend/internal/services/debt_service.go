@@ -0,0 +1,165 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"classmate-central/internal/logger"
+	"classmate-central/internal/models"
+	"classmate-central/internal/money"
+	"classmate-central/internal/repository"
+
+	"go.uber.org/zap"
+)
+
+type DebtService struct {
+	debtRepo        *repository.DebtRepository
+	branchRepo      *repository.BranchRepository
+	currencyService *CurrencyService
+}
+
+func NewDebtService(debtRepo *repository.DebtRepository, branchRepo *repository.BranchRepository, currencyService *CurrencyService) *DebtService {
+	return &DebtService{
+		debtRepo:        debtRepo,
+		branchRepo:      branchRepo,
+		currencyService: currencyService,
+	}
+}
+
+// GenerateFromOverdueInvoices opens debts for invoices that passed their due date (background task)
+func (s *DebtService) GenerateFromOverdueInvoices() error {
+	created, err := s.debtRepo.CreateFromOverdueInvoices(time.Now(), "")
+	if err != nil {
+		return err
+	}
+	if created > 0 {
+		logger.Info("Debts created from overdue invoices", zap.Int64("count", created))
+	}
+	return nil
+}
+
+// GenerateCompanyOverdueDebts is GenerateFromOverdueInvoices for one company. Returns the number of debts opened.
+func (s *DebtService) GenerateCompanyOverdueDebts(companyID string) (int64, error) {
+	return s.debtRepo.CreateFromOverdueInvoices(time.Now(), companyID)
+}
+
+// GetAgingReport returns outstanding debts bucketed by days overdue for the given branches.
+// Amounts are converted into the report currency (company base currency when empty) at the asOf rate.
+func (s *DebtService) GetAgingReport(companyID string, branchIDs []string, asOf time.Time, currency money.Currency) (*models.DebtAgingReport, error) {
+	debts, err := s.debtRepo.GetOutstanding(companyID, branchIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	converter, err := s.currencyService.Converter(companyID, currency)
+	if err != nil {
+		return nil, err
+	}
+	debts, unconverted, err := ConvertDebts(debts, converter, asOf)
+	if err != nil {
+		return nil, err
+	}
+
+	branches, err := s.branchRepo.GetBranchesByCompany(companyID)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching branches: %w", err)
+	}
+	branchNames := make(map[string]string, len(branches))
+	for _, b := range branches {
+		branchNames[b.ID] = b.Name
+	}
+
+	report := BuildDebtAgingReport(debts, branchNames, asOf)
+	report.Currency = converter.Currency()
+	report.Unconverted = unconverted
+	return report, nil
+}
+
+// ConvertDebts sets the amount of each debt to its remaining amount in the converter's currency at
+// asOf. Debts in a currency without an exchange rate are left out and their remaining amounts are
+// returned summed per currency, so one missing rate does not fail the whole report.
+func ConvertDebts(debts []models.DebtRecord, converter *CurrencyConverter, asOf time.Time) ([]models.DebtRecord, []money.Money, error) {
+	converted := make([]models.DebtRecord, 0, len(debts))
+	var unconverted []money.Money
+	for _, debt := range debts {
+		remaining, err := converter.Convert(debt.Remaining(), asOf)
+		if errors.Is(err, ErrNoExchangeRate) {
+			logger.Warn("Debt left out of aging report", logger.ErrorField(err), zap.Int("debt_id", debt.ID))
+			unconverted = addUnconverted(unconverted, debt.Remaining())
+			continue
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		debt.Amount = remaining
+		debt.PaidAmount = money.Money{}
+		debt.Currency = converter.Currency()
+		converted = append(converted, debt)
+	}
+	return converted, unconverted, nil
+}
+
+// DebtDaysOverdue returns how many days the debt is past its due date (creation date if no due date)
+func DebtDaysOverdue(debt models.DebtRecord, asOf time.Time) int {
+	ref := debt.CreatedAt
+	if debt.DueDate != nil {
+		ref = *debt.DueDate
+	}
+	if !asOf.After(ref) {
+		return 0
+	}
+	return int(asOf.Sub(ref).Hours() / 24)
+}
+
+func addToAgingBuckets(b *models.DebtAgingBuckets, days int, amount money.Money) {
+	switch {
+	case days <= 30:
+		b.Days0To30 = b.Days0To30.Add(amount)
+	case days <= 60:
+		b.Days31To60 = b.Days31To60.Add(amount)
+	case days <= 90:
+		b.Days61To90 = b.Days61To90.Add(amount)
+	default:
+		b.Days90Plus = b.Days90Plus.Add(amount)
+	}
+	b.Total = b.Total.Add(amount)
+	b.DebtCount++
+}
+
+// BuildDebtAgingReport buckets the remaining amount of each debt (0-30, 31-60, 61-90, 90+ days) per branch
+func BuildDebtAgingReport(debts []models.DebtRecord, branchNames map[string]string, asOf time.Time) *models.DebtAgingReport {
+	report := &models.DebtAgingReport{AsOf: asOf, Branches: []models.DebtAgingBranch{}}
+	byBranch := make(map[string]*models.DebtAgingBranch)
+
+	for _, debt := range debts {
+		remaining := debt.Remaining()
+		if !remaining.IsPositive() {
+			continue
+		}
+
+		branch, ok := byBranch[debt.BranchID]
+		if !ok {
+			name := branchNames[debt.BranchID]
+			if name == "" {
+				name = "Без филиала"
+			}
+			branch = &models.DebtAgingBranch{BranchID: debt.BranchID, BranchName: name}
+			byBranch[debt.BranchID] = branch
+		}
+
+		days := DebtDaysOverdue(debt, asOf)
+		addToAgingBuckets(&branch.Buckets, days, remaining)
+		addToAgingBuckets(&report.Total, days, remaining)
+	}
+
+	for _, branch := range byBranch {
+		report.Branches = append(report.Branches, *branch)
+	}
+	sort.Slice(report.Branches, func(i, j int) bool {
+		return report.Branches[i].BranchName < report.Branches[j].BranchName
+	})
+
+	return report
+}
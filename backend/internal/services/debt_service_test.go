@@ -0,0 +1,81 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"classmate-central/internal/models"
+	"classmate-central/internal/money"
+)
+
+func TestBuildDebtAgingReport_Buckets(t *testing.T) {
+	asOf := time.Date(2025, 6, 30, 12, 0, 0, 0, time.UTC)
+	due := func(daysAgo int) *time.Time {
+		d := asOf.AddDate(0, 0, -daysAgo)
+		return &d
+	}
+
+	debts := []models.DebtRecord{
+		{ID: 1, Amount: money.FromMajor(1000, money.KZT), DueDate: due(5), BranchID: "b1"},
+		{ID: 2, Amount: money.FromMajor(2000, money.KZT), PaidAmount: money.FromMajor(500, money.KZT), DueDate: due(45), BranchID: "b1"},
+		{ID: 3, Amount: money.FromMajor(3000, money.KZT), DueDate: due(75), BranchID: "b2"},
+		{ID: 4, Amount: money.FromMajor(4000, money.KZT), DueDate: due(120), BranchID: "b2"},
+		{ID: 5, Amount: money.FromMajor(500, money.KZT), PaidAmount: money.FromMajor(500, money.KZT), DueDate: due(10), BranchID: "b1"}, // fully paid, ignored
+		{ID: 6, Amount: money.FromMajor(700, money.KZT), DueDate: due(-10), BranchID: "b1"},                  // not yet due
+	}
+	names := map[string]string{"b1": "Центр", "b2": "Север"}
+
+	report := BuildDebtAgingReport(debts, names, asOf)
+
+	if len(report.Branches) != 2 {
+		t.Fatalf("expected 2 branches, got %d", len(report.Branches))
+	}
+	// Sorted by branch name: Север, Центр
+	north, center := report.Branches[0], report.Branches[1]
+	if north.BranchID != "b2" || center.BranchID != "b1" {
+		t.Fatalf("unexpected branch order: %s, %s", north.BranchID, center.BranchID)
+	}
+
+	if center.Buckets.Days0To30.Minor() != 170000 || center.Buckets.Days31To60.Minor() != 150000 {
+		t.Errorf("unexpected center buckets: %+v", center.Buckets)
+	}
+	if north.Buckets.Days61To90.Minor() != 300000 || north.Buckets.Days90Plus.Minor() != 400000 {
+		t.Errorf("unexpected north buckets: %+v", north.Buckets)
+	}
+	if report.Total.Total.Minor() != 1020000 || report.Total.DebtCount != 5 {
+		t.Errorf("unexpected totals: %+v", report.Total)
+	}
+}
+
+func TestDebtDaysOverdue_FallsBackToCreatedAt(t *testing.T) {
+	asOf := time.Date(2025, 6, 30, 0, 0, 0, 0, time.UTC)
+	debt := models.DebtRecord{CreatedAt: asOf.AddDate(0, 0, -31)}
+
+	if days := DebtDaysOverdue(debt, asOf); days != 31 {
+		t.Errorf("expected 31 days overdue, got %d", days)
+	}
+}
+
+func TestConvertDebts_LeavesOutDebtsWithoutRate(t *testing.T) {
+	asOf := time.Date(2025, 6, 30, 0, 0, 0, 0, time.UTC)
+	conv := NewCurrencyConverter(money.KZT, []models.ExchangeRate{
+		exchangeRate(money.USD, money.KZT, "500", asOf.AddDate(0, -1, 0)),
+	})
+	debts := []models.DebtRecord{
+		{ID: 1, Amount: money.FromMajor(1000, money.KZT), Currency: money.KZT},
+		{ID: 2, Amount: money.FromMajor(10, money.USD), Currency: money.USD},
+		{ID: 3, Amount: money.FromMajor(50000, money.UZS), Currency: money.UZS},
+		{ID: 4, Amount: money.FromMajor(30000, money.UZS), PaidAmount: money.FromMajor(10000, money.UZS), Currency: money.UZS},
+	}
+
+	converted, unconverted, err := ConvertDebts(debts, conv, asOf)
+	if err != nil {
+		t.Fatalf("ConvertDebts: %v", err)
+	}
+	if len(converted) != 2 || converted[0].Amount.Minor() != 100000 || converted[1].Amount.Minor() != 500000 {
+		t.Errorf("unexpected converted debts: %+v", converted)
+	}
+	if len(unconverted) != 1 || !unconverted[0].Equal(money.FromMajor(70000, money.UZS)) {
+		t.Errorf("unconverted = %v, want 70000 UZS", unconverted)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"crypto/tls"
 	"encoding/json"
 	"fmt"
+	"html"
 	"io"
 	"net"
 	"net/http"
@@ -14,6 +15,7 @@ import (
 	"time"
 
 	"classmate-central/internal/logger"
+	"classmate-central/internal/money"
 
 	"go.uber.org/zap"
 )
@@ -212,17 +214,130 @@ func (s *EmailService) SendInviteEmail(toEmail, code string) error {
 	return nil
 }
 
+// frontendURL returns the base URL used in links sent by email
+func frontendURL() string {
+	if url := os.Getenv("FRONTEND_URL"); url != "" {
+		return url
+	}
+	return "http://localhost:8081"
+}
+
+// SendPasswordResetEmail sends a single-use password reset link
+func (s *EmailService) SendPasswordResetEmail(toEmail, token string, ttl time.Duration) error {
+	link := fmt.Sprintf("%s/reset-password?token=%s", frontendURL(), token)
+	subject := "Восстановление пароля - SmartCRM"
+	htmlBody := fmt.Sprintf(`
+		<h1>Восстановление пароля</h1>
+		<p>Чтобы задать новый пароль, перейдите по ссылке:</p>
+		<p><a href="%s">%s</a></p>
+		<p>Ссылка действует %d мин. и может быть использована один раз.</p>
+		<p>Если вы не запрашивали восстановление пароля, просто проигнорируйте это письмо.</p>
+	`, link, link, int(ttl.Minutes()))
+	return s.sendAccountEmail(toEmail, subject, htmlBody, "password reset", link)
+}
+
+// SendEmailChangeConfirmation sends a link confirming a new email address to that address
+func (s *EmailService) SendEmailChangeConfirmation(toEmail, token string, ttl time.Duration) error {
+	link := fmt.Sprintf("%s/confirm-email?token=%s", frontendURL(), token)
+	subject := "Подтверждение нового email - SmartCRM"
+	htmlBody := fmt.Sprintf(`
+		<h1>Подтверждение email</h1>
+		<p>Чтобы использовать этот адрес для входа в SmartCRM, перейдите по ссылке:</p>
+		<p><a href="%s">%s</a></p>
+		<p>Ссылка действует %d ч.</p>
+		<p>Если вы не меняли email, просто проигнорируйте это письмо.</p>
+	`, link, link, int(ttl.Hours()))
+	return s.sendAccountEmail(toEmail, subject, htmlBody, "email change confirmation", link)
+}
+
+// SendSecurityNotification tells the account owner about a change to their credentials
+func (s *EmailService) SendSecurityNotification(toEmail, message string) error {
+	subject := "Изменение данных входа - SmartCRM"
+	htmlBody := fmt.Sprintf(`
+		<h1>Изменение данных входа</h1>
+		<p>%s</p>
+		<p>Если это были не вы, срочно восстановите пароль и сообщите администратору.</p>
+	`, message)
+	return s.sendAccountEmail(toEmail, subject, htmlBody, "security notification", message)
+}
+
+// SendNewLoginAlert tells the account owner about a login from a device or country not seen before
+func (s *EmailService) SendNewLoginAlert(toEmail, device, ip, country string, at time.Time) error {
+	location := ip
+	if country != "" {
+		location = ip + " (" + country + ")"
+	}
+	subject := "Новый вход в учётную запись - SmartCRM"
+	htmlBody := fmt.Sprintf(`
+		<h1>Новый вход в учётную запись</h1>
+		<p>В вашу учётную запись выполнен вход с нового устройства или из новой страны.</p>
+		<p>Устройство: %s<br>IP-адрес: %s<br>Время: %s</p>
+		<p>Если это были не вы, срочно смените пароль и завершите остальные сеансы.</p>
+	`, html.EscapeString(device), html.EscapeString(location), at.Format("02.01.2006 15:04 MST"))
+	return s.sendAccountEmail(toEmail, subject, htmlBody, "new login alert", device+" from "+location)
+}
+
+// SendAccountLockedAlert tells the account owner that failed logins locked the account. Login
+// responses do not reveal the lock, so this email is how the owner learns about it.
+func (s *EmailService) SendAccountLockedAlert(toEmail, ip string, lockedFor time.Duration) error {
+	subject := "Вход в учётную запись заблокирован - SmartCRM"
+	htmlBody := fmt.Sprintf(`
+		<h1>Вход в учётную запись заблокирован</h1>
+		<p>После нескольких неудачных попыток входа ваша учётная запись заблокирована на %d мин.</p>
+		<p>IP-адрес последней попытки: %s</p>
+		<p>Если это были не вы, смените пароль после окончания блокировки или обратитесь к администратору.</p>
+	`, int(lockedFor.Minutes()), html.EscapeString(ip))
+	return s.sendAccountEmail(toEmail, subject, htmlBody, "account locked alert", "locked for "+lockedFor.String()+" after failed logins from "+ip)
+}
+
+// sendAccountEmail delivers an account security email; without email configuration the
+// essential part (link or message) is logged instead
+func (s *EmailService) sendAccountEmail(toEmail, subject, htmlBody, kind, essential string) error {
+	if !s.enabled {
+		logger.Info("SMTP not configured - "+kind+" email logged to console",
+			zap.String("email", toEmail),
+			zap.String("content", essential),
+		)
+		fmt.Printf("⚠️  SMTP not configured. %s for %s: %s\n", kind, toEmail, essential)
+		return nil
+	}
+
+	if s.useResend {
+		if err := s.sendEmailViaResend(toEmail, subject, htmlBody); err != nil {
+			logger.Error("Failed to send "+kind+" email via Resend", logger.ErrorField(err), zap.String("to", toEmail))
+			return fmt.Errorf("failed to send %s email: %w", kind, err)
+		}
+		logger.Info(kind+" email sent successfully via Resend", zap.String("to", toEmail))
+		return nil
+	}
+
+	msg := "From: " + s.fromEmail + "\n" +
+		"To: " + toEmail + "\n" +
+		"Subject: " + subject + "\n" +
+		"MIME-Version: 1.0\n" +
+		"Content-Type: text/html; charset=UTF-8\n\n" +
+		htmlBody
+
+	auth := smtp.PlainAuth("", s.smtpUser, s.smtpPassword, s.smtpHost)
+	if err := s.sendEmailWithTLS(toEmail, msg, auth); err != nil {
+		logger.Error("Failed to send "+kind+" email", logger.ErrorField(err), zap.String("to", toEmail))
+		return fmt.Errorf("failed to send %s email: %w", kind, err)
+	}
+	logger.Info(kind+" email sent successfully", zap.String("to", toEmail))
+	return nil
+}
+
 // SendPaymentNotification sends a payment notification email
-func (s *EmailService) SendPaymentNotification(toEmail, studentName string, amount float64, paymentType, paymentMethod, description string) error {
+func (s *EmailService) SendPaymentNotification(toEmail, studentName string, amount money.Money, paymentType, paymentMethod, description string) error {
 	// If SMTP is not configured, just log (for dev/test)
 	if !s.enabled {
 		logger.Info("SMTP not configured - payment notification logged to console",
 			zap.String("email", toEmail),
 			zap.String("student", studentName),
-			zap.Float64("amount", amount),
+			zap.String("amount", amount.String()),
 			zap.String("type", paymentType),
 		)
-		fmt.Printf("⚠️  SMTP not configured. Payment notification for %s: %.2f ₸ (%s)\n", toEmail, amount, paymentType)
+		fmt.Printf("⚠️  SMTP not configured. Payment notification for %s: %s (%s)\n", toEmail, amount.Format(), paymentType)
 		return nil
 	}
 
@@ -234,25 +349,25 @@ func (s *EmailService) SendPaymentNotification(toEmail, studentName string, amou
 			<h1>Уважаемый(ая) %s!</h1>
 			<p>Мы получили ваш платеж:</p>
 			<ul>
-				<li><strong>Сумма:</strong> %.2f ₸</li>
+				<li><strong>Сумма:</strong> %s</li>
 				<li><strong>Способ оплаты:</strong> %s</li>
 				%s
 			</ul>
 			<p>Спасибо за оплату!</p>
 			<p>С уважением,<br>SmartCRM</p>
-		`, studentName, amount, s.translatePaymentMethod(paymentMethod), s.formatDescription(description))
+		`, studentName, amount.Format(), s.translatePaymentMethod(paymentMethod), s.formatDescription(description))
 	} else if paymentType == "refund" {
 		subject = "Возврат средств - SmartCRM"
 		htmlBody = fmt.Sprintf(`
 			<h1>Уважаемый(ая) %s!</h1>
 			<p>Был произведен возврат средств:</p>
 			<ul>
-				<li><strong>Сумма возврата:</strong> %.2f ₸</li>
+				<li><strong>Сумма возврата:</strong> %s</li>
 				<li><strong>Способ:</strong> %s</li>
 				%s
 			</ul>
 			<p>С уважением,<br>SmartCRM</p>
-		`, studentName, amount, s.translatePaymentMethod(paymentMethod), s.formatDescription(description))
+		`, studentName, amount.Format(), s.translatePaymentMethod(paymentMethod), s.formatDescription(description))
 	} else {
 		// Other types (debt, deduction) - don't send email
 		return nil
@@ -296,6 +411,60 @@ func (s *EmailService) SendPaymentNotification(toEmail, studentName string, amou
 	return nil
 }
 
+// SendInstallmentReminder reminds about an upcoming installment payment
+func (s *EmailService) SendInstallmentReminder(toEmail, studentName string, amount money.Money, dueDate time.Time) error {
+	// If SMTP is not configured, just log (for dev/test)
+	if !s.enabled {
+		logger.Info("SMTP not configured - installment reminder logged to console",
+			zap.String("email", toEmail),
+			zap.String("student", studentName),
+			zap.String("amount", amount.String()),
+			zap.String("dueDate", dueDate.Format("02.01.2006")),
+		)
+		fmt.Printf("⚠️  SMTP not configured. Installment reminder for %s: %s due %s\n", toEmail, amount.Format(), dueDate.Format("02.01.2006"))
+		return nil
+	}
+
+	subject := "Напоминание о платеже по рассрочке - SmartCRM"
+	htmlBody := fmt.Sprintf(`
+		<h1>Уважаемый(ая) %s!</h1>
+		<p>Напоминаем о предстоящем платеже по рассрочке:</p>
+		<ul>
+			<li><strong>Сумма:</strong> %s</li>
+			<li><strong>Срок оплаты:</strong> %s</li>
+		</ul>
+		<p>С уважением,<br>SmartCRM</p>
+	`, studentName, amount.Format(), dueDate.Format("02.01.2006"))
+
+	if s.useResend {
+		err := s.sendEmailViaResend(toEmail, subject, htmlBody)
+		if err != nil {
+			logger.Error("Failed to send installment reminder via Resend", logger.ErrorField(err), zap.String("to", toEmail))
+			return fmt.Errorf("failed to send installment reminder: %w", err)
+		}
+		logger.Info("Installment reminder sent successfully via Resend", zap.String("to", toEmail))
+		return nil
+	}
+
+	// Fallback to SMTP
+	msg := "From: " + s.fromEmail + "\n" +
+		"To: " + toEmail + "\n" +
+		"Subject: " + subject + "\n" +
+		"MIME-Version: 1.0\n" +
+		"Content-Type: text/html; charset=UTF-8\n\n" +
+		htmlBody
+
+	auth := smtp.PlainAuth("", s.smtpUser, s.smtpPassword, s.smtpHost)
+
+	if err := s.sendEmailWithTLS(toEmail, msg, auth); err != nil {
+		logger.Error("Failed to send installment reminder", logger.ErrorField(err), zap.String("to", toEmail))
+		return fmt.Errorf("failed to send installment reminder: %w", err)
+	}
+
+	logger.Info("Installment reminder sent successfully", zap.String("to", toEmail))
+	return nil
+}
+
 // SendAbsenceNotification sends an absence notification email
 func (s *EmailService) SendAbsenceNotification(toEmail, studentName, lessonSubject, reason, notes string, lessonDate time.Time) error {
 	// If SMTP is not configured, just log (for dev/test)
@@ -4,6 +4,8 @@ import (
 	"os"
 	"testing"
 	"time"
+
+	"classmate-central/internal/money"
 )
 
 func TestEmailService_SendVerificationCode(t *testing.T) {
@@ -31,19 +33,19 @@ func TestEmailService_SendPaymentNotification(t *testing.T) {
 	service := NewEmailService()
 	
 	// Test payment notification
-	err := service.SendPaymentNotification("test@example.com", "Иван Иванов", 5000.0, "payment", "cash", "Оплата за месяц")
+	err := service.SendPaymentNotification("test@example.com", "Иван Иванов", money.FromMajor(5000, money.KZT), "payment", "cash", "Оплата за месяц")
 	if err != nil {
 		t.Errorf("SendPaymentNotification should not error when SMTP not configured, got: %v", err)
 	}
 
 	// Test refund notification
-	err = service.SendPaymentNotification("test@example.com", "Иван Иванов", 2000.0, "refund", "card", "Возврат")
+	err = service.SendPaymentNotification("test@example.com", "Иван Иванов", money.FromMajor(2000, money.KZT), "refund", "card", "Возврат")
 	if err != nil {
 		t.Errorf("SendPaymentNotification should not error for refund, got: %v", err)
 	}
 
 	// Test other types (should return nil without sending)
-	err = service.SendPaymentNotification("test@example.com", "Иван Иванов", 1000.0, "debt", "cash", "")
+	err = service.SendPaymentNotification("test@example.com", "Иван Иванов", money.FromMajor(1000, money.KZT), "debt", "cash", "")
 	if err != nil {
 		t.Errorf("SendPaymentNotification should return nil for non-payment types, got: %v", err)
 	}
@@ -3,9 +3,12 @@ package services
 import (
 	"bytes"
 	"fmt"
+	"math"
+	"strings"
 	"time"
 
 	"classmate-central/internal/models"
+	"classmate-central/internal/money"
 
 	"github.com/jung-kurt/gofpdf/v2"
 	"github.com/xuri/excelize/v2"
@@ -27,6 +30,50 @@ func setupCyrillicFont(pdf *gofpdf.Fpdf) {
 	// For production, embed DejaVu or Arial Unicode font files
 }
 
+// currencyTotals sums income and expense of transactions separately for each currency
+type currencyTotals struct {
+	currencies []money.Currency // in order of first appearance
+	income     map[money.Currency]money.Money
+	expense    map[money.Currency]money.Money
+}
+
+func newCurrencyTotals() *currencyTotals {
+	return &currencyTotals{
+		income:  make(map[money.Currency]money.Money),
+		expense: make(map[money.Currency]money.Money),
+	}
+}
+
+func (t *currencyTotals) add(tx models.PaymentTransaction) {
+	cur := tx.Amount.Currency()
+	if _, ok := t.income[cur]; !ok {
+		t.currencies = append(t.currencies, cur)
+		t.income[cur] = money.New(0, cur)
+		t.expense[cur] = money.New(0, cur)
+	}
+	if tx.Type == "payment" {
+		t.income[cur] = t.income[cur].Add(tx.Amount)
+	} else {
+		t.expense[cur] = t.expense[cur].Add(tx.Amount)
+	}
+}
+
+// list returns the currencies to print totals for (the default currency when there are no transactions)
+func (t *currencyTotals) list() []money.Currency {
+	if len(t.currencies) == 0 {
+		return []money.Currency{money.DefaultCurrency}
+	}
+	return t.currencies
+}
+
+// labelSuffix names the currency in total labels when the report mixes currencies
+func (t *currencyTotals) labelSuffix(cur money.Currency) string {
+	if len(t.currencies) < 2 {
+		return ""
+	}
+	return " (" + string(cur) + ")"
+}
+
 // ExportTransactionsPDF exports transactions to PDF
 func (s *ExportService) ExportTransactionsPDF(transactions []models.PaymentTransaction, students map[string]string) ([]byte, error) {
 	pdf := gofpdf.New("P", "mm", "A4", "")
@@ -61,7 +108,7 @@ func (s *ExportService) ExportTransactionsPDF(transactions []models.PaymentTrans
 
 	// Table rows
 	SetFontSafe(pdf, fontName, "", 9)
-	var totalIncome, totalExpense float64
+	totals := newCurrencyTotals()
 	for _, tx := range transactions {
 		studentName := students[tx.StudentID]
 		if studentName == "" {
@@ -79,12 +126,8 @@ func (s *ExportService) ExportTransactionsPDF(transactions []models.PaymentTrans
 			typeStr = "Долг"
 		}
 
-		amountStr := fmt.Sprintf("%.2f ₸", tx.Amount)
-		if tx.Type == "payment" {
-			totalIncome += tx.Amount
-		} else {
-			totalExpense += tx.Amount
-		}
+		amountStr := tx.Amount.Format()
+		totals.add(tx)
 
 		pdf.CellFormat(40, 6, dateStr, "1", 0, "L", false, 0, "")
 		pdf.CellFormat(50, 6, studentName, "1", 0, "L", false, 0, "")
@@ -94,17 +137,21 @@ func (s *ExportService) ExportTransactionsPDF(transactions []models.PaymentTrans
 		pdf.Ln(6)
 	}
 
-	// Totals
-	pdf.Ln(5)
+	// Totals (one block per currency, amounts in different currencies are not added up)
 	SetFontSafe(pdf, fontName, "B", 10)
-	pdf.Cell(100, 6, "Итого доходов:")
-	pdf.Cell(40, 6, fmt.Sprintf("%.2f ₸", totalIncome))
-	pdf.Ln(6)
-	pdf.Cell(100, 6, "Итого расходов:")
-	pdf.Cell(40, 6, fmt.Sprintf("%.2f ₸", totalExpense))
-	pdf.Ln(6)
-	pdf.Cell(100, 6, "Баланс:")
-	pdf.Cell(40, 6, fmt.Sprintf("%.2f ₸", totalIncome-totalExpense))
+	for _, cur := range totals.list() {
+		suffix := totals.labelSuffix(cur)
+		pdf.Ln(5)
+		pdf.Cell(100, 6, "Итого доходов"+suffix+":")
+		pdf.Cell(40, 6, totals.income[cur].Format())
+		pdf.Ln(6)
+		pdf.Cell(100, 6, "Итого расходов"+suffix+":")
+		pdf.Cell(40, 6, totals.expense[cur].Format())
+		pdf.Ln(6)
+		pdf.Cell(100, 6, "Баланс"+suffix+":")
+		pdf.Cell(40, 6, totals.income[cur].Sub(totals.expense[cur]).Format())
+		pdf.Ln(1)
+	}
 
 	var buf bytes.Buffer
 	err := OutputPDFSafe(pdf, &buf)
@@ -124,7 +171,7 @@ func (s *ExportService) ExportTransactionsExcel(transactions []models.PaymentTra
 	f.DeleteSheet("Sheet1")
 
 	// Headers
-	headers := []string{"Дата", "Студент", "Тип", "Способ оплаты", "Описание", "Сумма"}
+	headers := []string{"Дата", "Студент", "Тип", "Способ оплаты", "Описание", "Сумма", "Валюта"}
 	for i, header := range headers {
 		cell := fmt.Sprintf("%c1", 'A'+i)
 		f.SetCellValue(sheetName, cell, header)
@@ -138,7 +185,7 @@ func (s *ExportService) ExportTransactionsExcel(transactions []models.PaymentTra
 	f.SetCellStyle(sheetName, "A1", fmt.Sprintf("%c1", 'A'+len(headers)-1), headerStyle)
 
 	// Data
-	var totalIncome, totalExpense float64
+	totals := newCurrencyTotals()
 	for i, tx := range transactions {
 		row := i + 2
 		studentName := students[tx.StudentID]
@@ -157,30 +204,36 @@ func (s *ExportService) ExportTransactionsExcel(transactions []models.PaymentTra
 			typeStr = "Долг"
 		}
 
-		if tx.Type == "payment" {
-			totalIncome += tx.Amount
-		} else {
-			totalExpense += tx.Amount
-		}
+		totals.add(tx)
 
 		f.SetCellValue(sheetName, fmt.Sprintf("A%d", row), dateStr)
 		f.SetCellValue(sheetName, fmt.Sprintf("B%d", row), studentName)
 		f.SetCellValue(sheetName, fmt.Sprintf("C%d", row), typeStr)
 		f.SetCellValue(sheetName, fmt.Sprintf("D%d", row), tx.PaymentMethod)
 		f.SetCellValue(sheetName, fmt.Sprintf("E%d", row), tx.Description)
-		f.SetCellValue(sheetName, fmt.Sprintf("F%d", row), tx.Amount)
+		f.SetCellValue(sheetName, fmt.Sprintf("F%d", row), tx.Amount.Float64())
+		f.SetCellValue(sheetName, fmt.Sprintf("G%d", row), string(tx.Amount.Currency()))
 	}
 
-	// Totals row
+	// Totals rows, one block per currency
 	totalRow := len(transactions) + 3
-	f.SetCellValue(sheetName, fmt.Sprintf("A%d", totalRow), "Итого доходов:")
-	f.SetCellValue(sheetName, fmt.Sprintf("F%d", totalRow), totalIncome)
-	totalRow++
-	f.SetCellValue(sheetName, fmt.Sprintf("A%d", totalRow), "Итого расходов:")
-	f.SetCellValue(sheetName, fmt.Sprintf("F%d", totalRow), totalExpense)
-	totalRow++
-	f.SetCellValue(sheetName, fmt.Sprintf("A%d", totalRow), "Баланс:")
-	f.SetCellValue(sheetName, fmt.Sprintf("F%d", totalRow), totalIncome-totalExpense)
+	for _, cur := range totals.list() {
+		income, expense := totals.income[cur], totals.expense[cur]
+		for _, line := range []struct {
+			label  string
+			amount money.Money
+		}{
+			{"Итого доходов:", income},
+			{"Итого расходов:", expense},
+			{"Баланс:", income.Sub(expense)},
+		} {
+			f.SetCellValue(sheetName, fmt.Sprintf("A%d", totalRow), line.label)
+			f.SetCellValue(sheetName, fmt.Sprintf("F%d", totalRow), line.amount.Float64())
+			f.SetCellValue(sheetName, fmt.Sprintf("G%d", totalRow), string(cur))
+			totalRow++
+		}
+		totalRow++
+	}
 
 	// Auto-size columns
 	for i := 0; i < len(headers); i++ {
@@ -442,3 +495,433 @@ func (s *ExportService) ExportScheduleExcel(lessons []*models.Lesson, startDate,
 	}
 	return buf.Bytes(), nil
 }
+
+type cashShiftSummaryRow struct {
+	label  string
+	amount money.Money
+}
+
+// cashShiftSummaryRows returns the rows of the shift reconciliation summary
+func cashShiftSummaryRows(report *models.CashShiftReport) []cashShiftSummaryRow {
+	rows := []cashShiftSummaryRow{
+		{"Размен на начало:", report.Shift.OpeningFloat},
+		{"Оплаты наличными:", report.CashPayments},
+		{"Возвраты наличными:", report.CashRefunds},
+		{"Внесения:", report.CashIns},
+		{"Изъятия:", report.CashOuts},
+		{"Ожидается в кассе:", report.ExpectedCash},
+	}
+	if report.Shift.CountedCash != nil {
+		rows = append(rows, cashShiftSummaryRow{"Фактически в кассе:", *report.Shift.CountedCash})
+	}
+	if report.Shift.Discrepancy != nil {
+		rows = append(rows, cashShiftSummaryRow{"Расхождение:", *report.Shift.Discrepancy})
+	}
+	return rows
+}
+
+func cashShiftPeriod(shift models.CashShift) string {
+	period := "с " + shift.OpenedAt.Format("02.01.2006 15:04")
+	if shift.ClosedAt != nil {
+		period += " по " + shift.ClosedAt.Format("02.01.2006 15:04")
+	}
+	return period
+}
+
+func cashMovementTypeLabel(movementType string) string {
+	if movementType == "cash_out" {
+		return "Изъятие"
+	}
+	return "Внесение"
+}
+
+// ExportCashShiftPDF exports a cash shift report to PDF
+func (s *ExportService) ExportCashShiftPDF(report *models.CashShiftReport, students map[string]string) ([]byte, error) {
+	pdf := gofpdf.New("P", "mm", "A4", "")
+	pdf.SetTitle("Отчет по кассовой смене", false)
+	pdf.SetAuthor("Classmate Central", false)
+
+	SetupCyrillicFonts(pdf)
+	fontName := GetCyrillicFontName(pdf)
+
+	pdf.AddPage()
+
+	SetFontSafe(pdf, fontName, "B", 16)
+	pdf.Cell(40, 10, fmt.Sprintf("Кассовая смена №%d", report.Shift.ID))
+	pdf.Ln(12)
+
+	SetFontSafe(pdf, fontName, "", 10)
+	pdf.Cell(40, 6, fmt.Sprintf("Период: %s", cashShiftPeriod(report.Shift)))
+	pdf.Ln(10)
+
+	// Summary
+	SetFontSafe(pdf, fontName, "B", 10)
+	for _, row := range cashShiftSummaryRows(report) {
+		pdf.Cell(100, 6, row.label)
+		pdf.Cell(40, 6, row.amount.Format())
+		pdf.Ln(6)
+	}
+	pdf.Ln(6)
+
+	// Cash transactions
+	SetFontSafe(pdf, fontName, "B", 10)
+	pdf.SetFillColor(240, 240, 240)
+	pdf.CellFormat(40, 7, "Дата", "1", 0, "L", true, 0, "")
+	pdf.CellFormat(70, 7, "Студент", "1", 0, "L", true, 0, "")
+	pdf.CellFormat(30, 7, "Тип", "1", 0, "L", true, 0, "")
+	pdf.CellFormat(40, 7, "Сумма", "1", 0, "R", true, 0, "")
+	pdf.Ln(-1)
+
+	SetFontSafe(pdf, fontName, "", 9)
+	for _, tx := range report.Transactions {
+		studentName := students[tx.StudentID]
+		if studentName == "" {
+			studentName = tx.StudentID
+		}
+		typeStr := "Платеж"
+		if tx.Type == "refund" {
+			typeStr = "Возврат"
+		}
+		pdf.CellFormat(40, 6, tx.CreatedAt.Format("02.01.2006 15:04"), "1", 0, "L", false, 0, "")
+		pdf.CellFormat(70, 6, studentName, "1", 0, "L", false, 0, "")
+		pdf.CellFormat(30, 6, typeStr, "1", 0, "L", false, 0, "")
+		pdf.CellFormat(40, 6, tx.Amount.Format(), "1", 0, "R", false, 0, "")
+		pdf.Ln(6)
+	}
+
+	// Cash movements
+	if len(report.Movements) > 0 {
+		pdf.Ln(6)
+		SetFontSafe(pdf, fontName, "B", 10)
+		pdf.CellFormat(40, 7, "Дата", "1", 0, "L", true, 0, "")
+		pdf.CellFormat(30, 7, "Тип", "1", 0, "L", true, 0, "")
+		pdf.CellFormat(70, 7, "Основание", "1", 0, "L", true, 0, "")
+		pdf.CellFormat(40, 7, "Сумма", "1", 0, "R", true, 0, "")
+		pdf.Ln(-1)
+
+		SetFontSafe(pdf, fontName, "", 9)
+		for _, m := range report.Movements {
+			pdf.CellFormat(40, 6, m.CreatedAt.Format("02.01.2006 15:04"), "1", 0, "L", false, 0, "")
+			pdf.CellFormat(30, 6, cashMovementTypeLabel(m.Type), "1", 0, "L", false, 0, "")
+			pdf.CellFormat(70, 6, m.Reason, "1", 0, "L", false, 0, "")
+			pdf.CellFormat(40, 6, m.Amount.Format(), "1", 0, "R", false, 0, "")
+			pdf.Ln(6)
+		}
+	}
+
+	var buf bytes.Buffer
+	err := OutputPDFSafe(pdf, &buf)
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// ExportCashShiftExcel exports a cash shift report to Excel
+func (s *ExportService) ExportCashShiftExcel(report *models.CashShiftReport, students map[string]string) ([]byte, error) {
+	f := excelize.NewFile()
+	defer f.Close()
+
+	headerStyle, _ := f.NewStyle(&excelize.Style{
+		Font: &excelize.Font{Bold: true},
+		Fill: excelize.Fill{Type: "pattern", Color: []string{"#F0F0F0"}, Pattern: 1},
+	})
+
+	// Summary sheet
+	summarySheet := "Смена"
+	f.NewSheet(summarySheet)
+	f.DeleteSheet("Sheet1")
+
+	f.SetCellValue(summarySheet, "A1", fmt.Sprintf("Кассовая смена №%d", report.Shift.ID))
+	f.SetCellValue(summarySheet, "A2", cashShiftPeriod(report.Shift))
+	f.SetCellStyle(summarySheet, "A1", "A1", headerStyle)
+	for i, row := range cashShiftSummaryRows(report) {
+		f.SetCellValue(summarySheet, fmt.Sprintf("A%d", i+4), row.label)
+		f.SetCellValue(summarySheet, fmt.Sprintf("B%d", i+4), row.amount.Float64())
+	}
+	f.SetColWidth(summarySheet, "A", "A", 25)
+	f.SetColWidth(summarySheet, "B", "B", 15)
+
+	// Transactions sheet
+	txSheet := "Операции"
+	f.NewSheet(txSheet)
+	headers := []string{"Дата", "Студент", "Тип", "Описание", "Сумма"}
+	for i, header := range headers {
+		f.SetCellValue(txSheet, fmt.Sprintf("%c1", 'A'+i), header)
+	}
+	f.SetCellStyle(txSheet, "A1", fmt.Sprintf("%c1", 'A'+len(headers)-1), headerStyle)
+
+	for i, tx := range report.Transactions {
+		row := i + 2
+		studentName := students[tx.StudentID]
+		if studentName == "" {
+			studentName = tx.StudentID
+		}
+		typeStr := "Платеж"
+		if tx.Type == "refund" {
+			typeStr = "Возврат"
+		}
+		f.SetCellValue(txSheet, fmt.Sprintf("A%d", row), tx.CreatedAt.Format("02.01.2006 15:04"))
+		f.SetCellValue(txSheet, fmt.Sprintf("B%d", row), studentName)
+		f.SetCellValue(txSheet, fmt.Sprintf("C%d", row), typeStr)
+		f.SetCellValue(txSheet, fmt.Sprintf("D%d", row), tx.Description)
+		f.SetCellValue(txSheet, fmt.Sprintf("E%d", row), tx.Amount.Float64())
+	}
+
+	// Movements sheet
+	mvSheet := "Внесения и изъятия"
+	f.NewSheet(mvSheet)
+	mvHeaders := []string{"Дата", "Тип", "Основание", "Сумма"}
+	for i, header := range mvHeaders {
+		f.SetCellValue(mvSheet, fmt.Sprintf("%c1", 'A'+i), header)
+	}
+	f.SetCellStyle(mvSheet, "A1", fmt.Sprintf("%c1", 'A'+len(mvHeaders)-1), headerStyle)
+
+	for i, m := range report.Movements {
+		row := i + 2
+		f.SetCellValue(mvSheet, fmt.Sprintf("A%d", row), m.CreatedAt.Format("02.01.2006 15:04"))
+		f.SetCellValue(mvSheet, fmt.Sprintf("B%d", row), cashMovementTypeLabel(m.Type))
+		f.SetCellValue(mvSheet, fmt.Sprintf("C%d", row), m.Reason)
+		f.SetCellValue(mvSheet, fmt.Sprintf("D%d", row), m.Amount.Float64())
+	}
+
+	for _, sheet := range []string{txSheet, mvSheet} {
+		f.SetColWidth(sheet, "A", "E", 18)
+	}
+
+	buf, err := f.WriteToBuffer()
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// ExportDebtAgingPDF exports the debt aging report to PDF
+func (s *ExportService) ExportDebtAgingPDF(report *models.DebtAgingReport) ([]byte, error) {
+	pdf := gofpdf.New("L", "mm", "A4", "")
+	pdf.SetTitle("Отчет по задолженностям", false)
+	pdf.SetAuthor("Classmate Central", false)
+
+	SetupCyrillicFonts(pdf)
+	fontName := GetCyrillicFontName(pdf)
+
+	pdf.AddPage()
+
+	SetFontSafe(pdf, fontName, "B", 16)
+	pdf.Cell(40, 10, "Отчет по задолженностям")
+	pdf.Ln(12)
+
+	SetFontSafe(pdf, fontName, "", 10)
+	pdf.Cell(40, 6, fmt.Sprintf("На дату: %s", report.AsOf.Format("02.01.2006")))
+	pdf.Ln(10)
+
+	SetFontSafe(pdf, fontName, "B", 10)
+	pdf.SetFillColor(240, 240, 240)
+	pdf.CellFormat(60, 7, "Филиал", "1", 0, "L", true, 0, "")
+	pdf.CellFormat(35, 7, "0-30 дней", "1", 0, "R", true, 0, "")
+	pdf.CellFormat(35, 7, "31-60 дней", "1", 0, "R", true, 0, "")
+	pdf.CellFormat(35, 7, "61-90 дней", "1", 0, "R", true, 0, "")
+	pdf.CellFormat(35, 7, "90+ дней", "1", 0, "R", true, 0, "")
+	pdf.CellFormat(40, 7, "Итого", "1", 0, "R", true, 0, "")
+	pdf.Ln(-1)
+
+	writeRow := func(name string, b models.DebtAgingBuckets) {
+		pdf.CellFormat(60, 6, name, "1", 0, "L", false, 0, "")
+		pdf.CellFormat(35, 6, b.Days0To30.Format(), "1", 0, "R", false, 0, "")
+		pdf.CellFormat(35, 6, b.Days31To60.Format(), "1", 0, "R", false, 0, "")
+		pdf.CellFormat(35, 6, b.Days61To90.Format(), "1", 0, "R", false, 0, "")
+		pdf.CellFormat(35, 6, b.Days90Plus.Format(), "1", 0, "R", false, 0, "")
+		pdf.CellFormat(40, 6, b.Total.Format(), "1", 0, "R", false, 0, "")
+		pdf.Ln(6)
+	}
+
+	SetFontSafe(pdf, fontName, "", 9)
+	for _, branch := range report.Branches {
+		writeRow(branch.BranchName, branch.Buckets)
+	}
+
+	SetFontSafe(pdf, fontName, "B", 9)
+	writeRow("Итого", report.Total)
+
+	var buf bytes.Buffer
+	err := OutputPDFSafe(pdf, &buf)
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// ExportDebtAgingExcel exports the debt aging report to Excel
+func (s *ExportService) ExportDebtAgingExcel(report *models.DebtAgingReport) ([]byte, error) {
+	f := excelize.NewFile()
+	defer f.Close()
+
+	sheetName := "Задолженности"
+	f.NewSheet(sheetName)
+	f.DeleteSheet("Sheet1")
+
+	headers := []string{"Филиал", "0-30 дней", "31-60 дней", "61-90 дней", "90+ дней", "Итого", "Кол-во долгов"}
+	for i, header := range headers {
+		cell := fmt.Sprintf("%c1", 'A'+i)
+		f.SetCellValue(sheetName, cell, header)
+	}
+
+	headerStyle, _ := f.NewStyle(&excelize.Style{
+		Font: &excelize.Font{Bold: true},
+		Fill: excelize.Fill{Type: "pattern", Color: []string{"#F0F0F0"}, Pattern: 1},
+	})
+	f.SetCellStyle(sheetName, "A1", fmt.Sprintf("%c1", 'A'+len(headers)-1), headerStyle)
+
+	writeRow := func(row int, name string, b models.DebtAgingBuckets) {
+		f.SetCellValue(sheetName, fmt.Sprintf("A%d", row), name)
+		f.SetCellValue(sheetName, fmt.Sprintf("B%d", row), b.Days0To30.Float64())
+		f.SetCellValue(sheetName, fmt.Sprintf("C%d", row), b.Days31To60.Float64())
+		f.SetCellValue(sheetName, fmt.Sprintf("D%d", row), b.Days61To90.Float64())
+		f.SetCellValue(sheetName, fmt.Sprintf("E%d", row), b.Days90Plus.Float64())
+		f.SetCellValue(sheetName, fmt.Sprintf("F%d", row), b.Total.Float64())
+		f.SetCellValue(sheetName, fmt.Sprintf("G%d", row), b.DebtCount)
+	}
+
+	for i, branch := range report.Branches {
+		writeRow(i+2, branch.BranchName, branch.Buckets)
+	}
+	totalRow := len(report.Branches) + 3
+	writeRow(totalRow, "Итого", report.Total)
+	f.SetCellStyle(sheetName, fmt.Sprintf("A%d", totalRow), fmt.Sprintf("G%d", totalRow), headerStyle)
+
+	f.SetColWidth(sheetName, "A", "A", 25)
+	f.SetColWidth(sheetName, "B", "G", 15)
+
+	buf, err := f.WriteToBuffer()
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// ExportBranchReportExcel exports the consolidated branch report to Excel: a summary sheet with
+// a row per branch and the total, then one sheet per branch
+func (s *ExportService) ExportBranchReportExcel(report *models.BranchReport) ([]byte, error) {
+	f := excelize.NewFile()
+	defer f.Close()
+
+	headerStyle, _ := f.NewStyle(&excelize.Style{
+		Font: &excelize.Font{Bold: true},
+		Fill: excelize.Fill{Type: "pattern", Color: []string{"#F0F0F0"}, Pattern: 1},
+	})
+	period := fmt.Sprintf("%s – %s", report.From.Format("02.01.2006"), report.To.AddDate(0, 0, -1).Format("02.01.2006"))
+
+	type metric struct {
+		label string
+		value func(m models.BranchReportMetrics) interface{}
+	}
+	metrics := []metric{
+		{"Выручка, " + string(report.Currency), func(m models.BranchReportMetrics) interface{} { return m.Revenue.Float64() }},
+		{"Платежи", func(m models.BranchReportMetrics) interface{} { return m.Payments.Float64() }},
+		{"Возвраты", func(m models.BranchReportMetrics) interface{} { return m.Refunds.Float64() }},
+		{"Кол-во платежей", func(m models.BranchReportMetrics) interface{} { return m.PaymentCount }},
+		{"Отмечено посещений", func(m models.BranchReportMetrics) interface{} { return m.AttendanceMarked }},
+		{"Присутствовали", func(m models.BranchReportMetrics) interface{} { return m.Attended }},
+		{"Пропустили", func(m models.BranchReportMetrics) interface{} { return m.Missed }},
+		{"Посещаемость, %", func(m models.BranchReportMetrics) interface{} { return roundPercent(m.AttendanceRate) }},
+		{"Занятий", func(m models.BranchReportMetrics) interface{} { return m.Lessons }},
+		{"Мест", func(m models.BranchReportMetrics) interface{} { return m.Seats }},
+		{"Занято мест", func(m models.BranchReportMetrics) interface{} { return m.SeatsTaken }},
+		{"Заполняемость, %", func(m models.BranchReportMetrics) interface{} { return roundPercent(m.Occupancy) }},
+		{"Лидов", func(m models.BranchReportMetrics) interface{} { return m.Leads }},
+		{"Записались", func(m models.BranchReportMetrics) interface{} { return m.LeadsEnrolled }},
+		{"Конверсия лидов, %", func(m models.BranchReportMetrics) interface{} { return roundPercent(m.LeadConversion) }},
+	}
+
+	// Summary: branches in rows, metrics in columns
+	summary := "Сводка"
+	f.NewSheet(summary)
+	f.DeleteSheet("Sheet1")
+	f.SetCellValue(summary, "A1", "Период: "+period)
+	lastCol, _ := excelize.ColumnNumberToName(len(metrics) + 1)
+	f.SetCellValue(summary, "A2", "Филиал")
+	for i, m := range metrics {
+		col, _ := excelize.ColumnNumberToName(i + 2)
+		f.SetCellValue(summary, fmt.Sprintf("%s2", col), m.label)
+	}
+	f.SetCellStyle(summary, "A2", lastCol+"2", headerStyle)
+	writeRow := func(row int, name string, values models.BranchReportMetrics) {
+		f.SetCellValue(summary, fmt.Sprintf("A%d", row), name)
+		for i, m := range metrics {
+			col, _ := excelize.ColumnNumberToName(i + 2)
+			f.SetCellValue(summary, fmt.Sprintf("%s%d", col, row), m.value(values))
+		}
+	}
+	for i, branch := range report.Branches {
+		writeRow(i+3, branch.BranchName, branch.Metrics)
+	}
+	totalRow := len(report.Branches) + 4
+	writeRow(totalRow, "Итого", report.Total)
+	f.SetCellStyle(summary, fmt.Sprintf("A%d", totalRow), fmt.Sprintf("%s%d", lastCol, totalRow), headerStyle)
+	if len(report.Unconverted) > 0 {
+		amounts := make([]string, len(report.Unconverted))
+		for i, amount := range report.Unconverted {
+			amounts[i] = amount.Format()
+		}
+		f.SetCellValue(summary, fmt.Sprintf("A%d", totalRow+2), "Без курса валюты, не вошло в выручку: "+strings.Join(amounts, ", "))
+	}
+	f.SetColWidth(summary, "A", "A", 25)
+	f.SetColWidth(summary, "B", lastCol, 16)
+
+	// One sheet per branch: metrics in rows
+	used := map[string]bool{summary: true}
+	for _, branch := range report.Branches {
+		sheet := uniqueSheetName(branch.BranchName, used)
+		f.NewSheet(sheet)
+		f.SetCellValue(sheet, "A1", branch.BranchName)
+		f.SetCellValue(sheet, "A2", "Период: "+period)
+		f.SetCellValue(sheet, "A4", "Показатель")
+		f.SetCellValue(sheet, "B4", "Значение")
+		f.SetCellStyle(sheet, "A4", "B4", headerStyle)
+		for i, m := range metrics {
+			f.SetCellValue(sheet, fmt.Sprintf("A%d", i+5), m.label)
+			f.SetCellValue(sheet, fmt.Sprintf("B%d", i+5), m.value(branch.Metrics))
+		}
+		f.SetColWidth(sheet, "A", "A", 25)
+		f.SetColWidth(sheet, "B", "B", 16)
+	}
+
+	buf, err := f.WriteToBuffer()
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func roundPercent(p float64) float64 {
+	return math.Round(p*10) / 10
+}
+
+// uniqueSheetName makes a valid Excel sheet name (at most 31 characters, none of []:*?/\)
+// that is not used yet
+func uniqueSheetName(name string, used map[string]bool) string {
+	clean := strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`[]:*?/\`, r) {
+			return '_'
+		}
+		return r
+	}, strings.TrimSpace(name))
+	if clean == "" {
+		clean = "Филиал"
+	}
+	base := []rune(clean)
+	if len(base) > 31 {
+		base = base[:31]
+	}
+	candidate := string(base)
+	for n := 2; used[candidate]; n++ {
+		suffix := fmt.Sprintf(" (%d)", n)
+		trimmed := base
+		if len(trimmed)+len(suffix) > 31 {
+			trimmed = trimmed[:31-len(suffix)]
+		}
+		candidate = string(trimmed) + suffix
+	}
+	used[candidate] = true
+	return candidate
+}
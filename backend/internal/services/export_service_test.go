@@ -5,6 +5,7 @@ import (
 	"time"
 
 	"classmate-central/internal/models"
+	"classmate-central/internal/money"
 )
 
 func TestExportService_ExportStudentsPDF(t *testing.T) {
@@ -69,7 +70,7 @@ func TestExportService_ExportTransactionsPDF(t *testing.T) {
 		{
 			ID:            1,
 			StudentID:     "1",
-			Amount:        5000.0,
+			Amount:        money.FromMajor(5000, money.KZT),
 			Type:          "payment",
 			PaymentMethod: "cash",
 			Description:   "Оплата за месяц",
@@ -99,7 +100,7 @@ func TestExportService_ExportTransactionsExcel(t *testing.T) {
 		{
 			ID:            1,
 			StudentID:     "1",
-			Amount:        5000.0,
+			Amount:        money.FromMajor(5000, money.KZT),
 			Type:          "payment",
 			PaymentMethod: "cash",
 		},
@@ -120,3 +121,45 @@ func TestExportService_ExportTransactionsExcel(t *testing.T) {
 	}
 }
 
+
+func TestExportService_ExportCashShiftExcel(t *testing.T) {
+	service := NewExportService()
+
+	counted := money.FromMajor(14500, money.KZT)
+	discrepancy := money.FromMajor(-500, money.KZT)
+	report := &models.CashShiftReport{
+		Shift: models.CashShift{
+			ID:           1,
+			Status:       "closed",
+			OpeningFloat: money.FromMajor(5000, money.KZT),
+			CountedCash:  &counted,
+			Discrepancy:  &discrepancy,
+			OpenedAt:     time.Now().Add(-8 * time.Hour),
+		},
+		CashPayments: money.FromMajor(12000, money.KZT),
+		CashRefunds:  money.FromMajor(1000, money.KZT),
+		CashOuts:     money.FromMajor(1000, money.KZT),
+		ExpectedCash: money.FromMajor(15000, money.KZT),
+		Transactions: []models.PaymentTransaction{
+			{ID: 1, StudentID: "1", Amount: money.FromMajor(12000, money.KZT), Type: "payment", PaymentMethod: "cash", CreatedAt: time.Now()},
+			{ID: 2, StudentID: "1", Amount: money.FromMajor(1000, money.KZT), Type: "refund", PaymentMethod: "cash", CreatedAt: time.Now()},
+		},
+		Movements: []models.CashMovement{
+			{ID: 1, ShiftID: 1, Type: "cash_out", Amount: money.FromMajor(1000, money.KZT), Reason: "Инкассация", CreatedAt: time.Now()},
+		},
+	}
+
+	students := map[string]string{
+		"1": "Иван Иванов",
+	}
+
+	excel, err := service.ExportCashShiftExcel(report, students)
+	if err != nil {
+		t.Errorf("ExportCashShiftExcel failed: %v", err)
+		return
+	}
+
+	if len(excel) == 0 {
+		t.Error("ExportCashShiftExcel returned empty Excel file")
+	}
+}
@@ -0,0 +1,115 @@
+package services
+
+import (
+	"errors"
+	"strconv"
+	"time"
+
+	"classmate-central/internal/fiscal"
+	"classmate-central/internal/logger"
+	"classmate-central/internal/models"
+	"classmate-central/internal/repository"
+
+	"go.uber.org/zap"
+)
+
+// Fiscal queue processing
+const (
+	MaxFiscalAttempts  = 12              // then the receipt waits for a manual retry
+	fiscalBatchSize    = 100             // receipts registered per run
+	fiscalClaimLease   = 5 * time.Minute // a crashed worker's receipts are retried after this
+	fiscalMaxRetryWait = 6 * time.Hour   // upper bound of the backoff
+	fiscalFirstRetry   = 1 * time.Minute
+)
+
+type FiscalService struct {
+	receiptRepo *repository.FiscalReceiptRepository
+	operator    fiscal.Operator
+}
+
+// NewFiscalService creates the service; with a nil operator receipts stay queued until one is configured
+func NewFiscalService(receiptRepo *repository.FiscalReceiptRepository, operator fiscal.Operator) *FiscalService {
+	if operator == nil {
+		logger.Warn("Fiscal operator is not configured. Receipts will be queued but not registered.")
+	}
+	return &FiscalService{
+		receiptRepo: receiptRepo,
+		operator:    operator,
+	}
+}
+
+// FiscalRetryDelay returns how long to wait after the given failed attempt (1-based):
+// 1, 2, 4, 8... minutes, at most 6 hours
+func FiscalRetryDelay(attempt int) time.Duration {
+	delay := fiscalFirstRetry
+	for i := 1; i < attempt; i++ {
+		delay *= 2
+		if delay >= fiscalMaxRetryWait {
+			return fiscalMaxRetryWait
+		}
+	}
+	return delay
+}
+
+// ProcessQueue registers due receipts with the fiscal operator (background task)
+func (s *FiscalService) ProcessQueue() error {
+	if s.operator == nil {
+		return nil
+	}
+
+	now := time.Now()
+	receipts, err := s.receiptRepo.ClaimDue(now, fiscalBatchSize, fiscalClaimLease)
+	if err != nil {
+		return err
+	}
+
+	registered := 0
+	for _, receipt := range receipts {
+		if s.register(receipt, now) {
+			registered++
+		}
+	}
+	if len(receipts) > 0 {
+		logger.Info("Fiscal receipts processed", zap.Int("claimed", len(receipts)), zap.Int("registered", registered))
+	}
+	return nil
+}
+
+func (s *FiscalService) register(receipt models.FiscalReceipt, now time.Time) bool {
+	reg, err := s.operator.Register(fiscal.Receipt{
+		Reference:     receiptReference(receipt),
+		Operation:     fiscal.Operation(receipt.Operation),
+		Amount:        receipt.Amount,
+		PaymentMethod: receipt.PaymentMethod,
+		Description:   receipt.Description,
+		BranchID:      receipt.BranchID,
+	})
+	if err == nil {
+		if err := s.receiptRepo.MarkRegistered(receipt.ID, s.operator.Name(), reg); err != nil {
+			// Registered at the operator; the retry returns the same registration
+			logger.Error("Failed to store fiscal registration", logger.ErrorField(err), zap.Int("receiptId", receipt.ID))
+			return false
+		}
+		return true
+	}
+
+	fields := []zap.Field{logger.ErrorField(err), zap.Int("receiptId", receipt.ID), zap.Int("attempt", receipt.Attempts)}
+	if errors.Is(err, fiscal.ErrRejected) || receipt.Attempts >= MaxFiscalAttempts {
+		logger.Error("Fiscal receipt failed", fields...)
+		if err := s.receiptRepo.MarkFailed(receipt.ID, err.Error()); err != nil {
+			logger.Error("Failed to mark fiscal receipt failed", logger.ErrorField(err), zap.Int("receiptId", receipt.ID))
+		}
+		return false
+	}
+
+	logger.Warn("Fiscal receipt registration will be retried", fields...)
+	if err := s.receiptRepo.MarkRetry(receipt.ID, err.Error(), now.Add(FiscalRetryDelay(receipt.Attempts))); err != nil {
+		logger.Error("Failed to schedule fiscal receipt retry", logger.ErrorField(err), zap.Int("receiptId", receipt.ID))
+	}
+	return false
+}
+
+// receiptReference is the idempotency key sent to the operator
+func receiptReference(receipt models.FiscalReceipt) string {
+	return receipt.CompanyID + ":" + strconv.Itoa(receipt.ID)
+}
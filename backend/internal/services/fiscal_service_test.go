@@ -0,0 +1,25 @@
+package services
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFiscalRetryDelay_BacksOffUpToCap(t *testing.T) {
+	cases := []struct {
+		attempt int
+		want    time.Duration
+	}{
+		{1, time.Minute},
+		{2, 2 * time.Minute},
+		{4, 8 * time.Minute},
+		{9, 256 * time.Minute},
+		{10, 6 * time.Hour},
+		{MaxFiscalAttempts, 6 * time.Hour},
+	}
+	for _, tc := range cases {
+		if got := FiscalRetryDelay(tc.attempt); got != tc.want {
+			t.Errorf("FiscalRetryDelay(%d) = %s, want %s", tc.attempt, got, tc.want)
+		}
+	}
+}
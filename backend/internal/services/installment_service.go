@@ -0,0 +1,291 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"classmate-central/internal/logger"
+	"classmate-central/internal/models"
+	"classmate-central/internal/money"
+	"classmate-central/internal/repository"
+
+	"go.uber.org/zap"
+)
+
+var (
+	// ErrInvalidSchedule is returned for installment schedules that do not add up or are not in date order
+	ErrInvalidSchedule = errors.New("invalid installment schedule")
+	// ErrSubscriptionNotPayable is returned when the subscription has no price to split
+	ErrSubscriptionNotPayable = errors.New("subscription has no price to split into installments")
+)
+
+// Defaults of a new plan
+const (
+	DefaultInstallmentReminderDays = 3
+	MaxInstallments                = 24
+)
+
+type InstallmentService struct {
+	installmentRepo  *repository.InstallmentRepository
+	subscriptionRepo *repository.SubscriptionRepository
+	studentRepo      *repository.StudentRepository
+	notificationRepo *repository.NotificationRepository
+	emailService     *EmailService
+}
+
+func NewInstallmentService(
+	installmentRepo *repository.InstallmentRepository,
+	subscriptionRepo *repository.SubscriptionRepository,
+	studentRepo *repository.StudentRepository,
+	notificationRepo *repository.NotificationRepository,
+	emailService *EmailService,
+) *InstallmentService {
+	return &InstallmentService{
+		installmentRepo:  installmentRepo,
+		subscriptionRepo: subscriptionRepo,
+		studentRepo:      studentRepo,
+		notificationRepo: notificationRepo,
+		emailService:     emailService,
+	}
+}
+
+// CreatePlan builds and stores an installment plan for a subscription. The installments must add up
+// exactly to the subscription price.
+func (s *InstallmentService) CreatePlan(subscriptionID string, req models.CreateInstallmentPlanRequest, createdBy *int, companyID string) (*models.InstallmentPlan, error) {
+	sub, err := s.subscriptionRepo.GetSubscriptionByID(subscriptionID, companyID)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && sub == nil) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !sub.TotalPrice.IsPositive() {
+		return nil, ErrSubscriptionNotPayable
+	}
+
+	var installments []models.Installment
+	if len(req.Installments) > 0 {
+		installments, err = ParseInstallmentSchedule(req.Installments, sub.TotalPrice)
+	} else {
+		var first time.Time
+		first, err = time.Parse("2006-01-02", req.FirstDueDate)
+		if err != nil {
+			return nil, fmt.Errorf("%w: firstDueDate must be YYYY-MM-DD", ErrInvalidSchedule)
+		}
+		installments, err = BuildInstallmentSchedule(sub.TotalPrice, req.Count, first, req.IntervalMonths)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	plan := &models.InstallmentPlan{
+		SubscriptionID: subscriptionID,
+		TotalAmount:    sub.TotalPrice,
+		BillingMode:    req.BillingMode,
+		ReminderDays:   DefaultInstallmentReminderDays,
+		GraceDays:      req.GraceDays,
+		CreatedBy:      createdBy,
+		Installments:   installments,
+	}
+	if plan.BillingMode == "" {
+		plan.BillingMode = "debt"
+	}
+	if req.ReminderDays != nil {
+		plan.ReminderDays = *req.ReminderDays
+	}
+
+	if err := s.installmentRepo.CreatePlan(plan, companyID); err != nil {
+		return nil, err
+	}
+	return plan, nil
+}
+
+// BuildInstallmentSchedule splits total into count installments due every intervalMonths months
+// (monthly when 0) starting at first. The parts add up exactly to total; remainders go to the first ones.
+func BuildInstallmentSchedule(total money.Money, count int, first time.Time, intervalMonths int) ([]models.Installment, error) {
+	if count < 1 || count > MaxInstallments {
+		return nil, fmt.Errorf("%w: count must be between 1 and %d", ErrInvalidSchedule, MaxInstallments)
+	}
+	if intervalMonths < 0 {
+		return nil, fmt.Errorf("%w: intervalMonths must not be negative", ErrInvalidSchedule)
+	}
+	if intervalMonths == 0 {
+		intervalMonths = 1
+	}
+	if !total.IsPositive() {
+		return nil, ErrSubscriptionNotPayable
+	}
+
+	parts := total.Split(count)
+	installments := make([]models.Installment, count)
+	for i := range installments {
+		installments[i] = models.Installment{
+			Seq:     i + 1,
+			DueDate: addMonthsClamped(first, i*intervalMonths),
+			Amount:  parts[i],
+		}
+	}
+	return installments, nil
+}
+
+// addMonthsClamped adds months keeping the day of month, clamped to the last day of shorter months
+// (31 Jan + 1 month = 28/29 Feb instead of 3 Mar)
+func addMonthsClamped(t time.Time, months int) time.Time {
+	firstOfMonth := time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, t.Location()).AddDate(0, months, 0)
+	lastDay := firstOfMonth.AddDate(0, 1, -1).Day()
+	day := t.Day()
+	if day > lastDay {
+		day = lastDay
+	}
+	return time.Date(firstOfMonth.Year(), firstOfMonth.Month(), day, 0, 0, 0, 0, t.Location())
+}
+
+// ParseInstallmentSchedule validates explicit installments: positive amounts, strictly increasing
+// due dates and an exact total
+func ParseInstallmentSchedule(inputs []models.InstallmentInput, total money.Money) ([]models.Installment, error) {
+	if len(inputs) > MaxInstallments {
+		return nil, fmt.Errorf("%w: at most %d installments", ErrInvalidSchedule, MaxInstallments)
+	}
+
+	installments := make([]models.Installment, len(inputs))
+	sum := money.New(0, total.Currency())
+	for i, in := range inputs {
+		due, err := time.Parse("2006-01-02", in.DueDate)
+		if err != nil {
+			return nil, fmt.Errorf("%w: dueDate must be YYYY-MM-DD", ErrInvalidSchedule)
+		}
+		if i > 0 && !due.After(installments[i-1].DueDate) {
+			return nil, fmt.Errorf("%w: due dates must be in increasing order", ErrInvalidSchedule)
+		}
+		amount := in.Amount.WithCurrency(total.Currency())
+		if !amount.IsPositive() {
+			return nil, fmt.Errorf("%w: amounts must be positive", ErrInvalidSchedule)
+		}
+		sum = sum.Add(amount)
+		installments[i] = models.Installment{Seq: i + 1, DueDate: due, Amount: amount}
+	}
+	if !sum.Equal(total) {
+		return nil, fmt.Errorf("%w: installments add up to %s, subscription price is %s", ErrInvalidSchedule, sum, total)
+	}
+	return installments, nil
+}
+
+// InstallmentStatus derives the status of a charged installment from what was paid against it
+func InstallmentStatus(inst models.Installment, today time.Time) string {
+	switch {
+	case !inst.Remaining().IsPositive():
+		return "paid"
+	case inst.DueDate.Before(dateOnly(today)):
+		return "overdue"
+	case inst.PaidAmount.IsPositive():
+		return "partially_paid"
+	default:
+		return "due"
+	}
+}
+
+func dateOnly(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
+
+// ProcessInstallments charges installments that reached their due date, updates statuses from payments,
+// sends reminders and suspends or reactivates subscriptions (background task)
+func (s *InstallmentService) ProcessInstallments() error {
+	now := time.Now()
+	today := dateOnly(now)
+
+	due, err := s.installmentRepo.GetDueForCharge(today)
+	if err != nil {
+		return err
+	}
+	for _, inst := range due {
+		if err := s.installmentRepo.Charge(inst.ID); err != nil {
+			logger.Error("Failed to charge installment", logger.ErrorField(err), zap.Int("installmentId", inst.ID))
+		}
+	}
+	if len(due) > 0 {
+		logger.Info("Installments charged", zap.Int("count", len(due)))
+	}
+
+	charged, err := s.installmentRepo.GetCharged()
+	if err != nil {
+		return err
+	}
+	for _, inst := range charged {
+		status := InstallmentStatus(inst, today)
+		if err := s.installmentRepo.UpdateStatus(inst.ID, inst.PaidAmount, status); err != nil {
+			logger.Error("Failed to update installment status", logger.ErrorField(err), zap.Int("installmentId", inst.ID))
+		}
+	}
+	if _, err := s.installmentRepo.CompletePlans(); err != nil {
+		return err
+	}
+
+	s.sendReminders(today)
+	return s.applySuspensions(today)
+}
+
+func (s *InstallmentService) sendReminders(today time.Time) {
+	installments, err := s.installmentRepo.GetToRemind(today)
+	if err != nil {
+		logger.Error("Failed to get installments to remind", logger.ErrorField(err))
+		return
+	}
+
+	for _, inst := range installments {
+		days := int(inst.DueDate.Sub(today).Hours() / 24)
+		message := fmt.Sprintf("Напоминание: платеж по рассрочке %s до %s (через %d дн.)",
+			inst.Amount.Format(), inst.DueDate.Format("02.01.2006"), days)
+		notification := &models.Notification{
+			StudentID: inst.StudentID,
+			Type:      "installment_reminder",
+			Message:   message,
+		}
+		if err := s.notificationRepo.CreateNotification(notification); err != nil {
+			logger.Error("Failed to create installment reminder", logger.ErrorField(err), zap.Int("installmentId", inst.ID))
+			continue
+		}
+
+		if student, err := s.studentRepo.GetByID(inst.StudentID, inst.CompanyID); err == nil && student != nil && student.Email != "" {
+			_ = s.emailService.SendInstallmentReminder(student.Email, student.Name, inst.Amount, inst.DueDate)
+		}
+
+		if err := s.installmentRepo.MarkReminded(inst.ID); err != nil {
+			logger.Error("Failed to mark installment reminded", logger.ErrorField(err), zap.Int("installmentId", inst.ID))
+		}
+	}
+}
+
+func (s *InstallmentService) applySuspensions(today time.Time) error {
+	toSuspend, err := s.installmentRepo.GetPlansToSuspend(today)
+	if err != nil {
+		return err
+	}
+	for _, plan := range toSuspend {
+		if err := s.installmentRepo.SetSuspended(plan, true); err != nil {
+			logger.Error("Failed to suspend subscription", logger.ErrorField(err), zap.String("subscriptionId", plan.SubscriptionID))
+			continue
+		}
+		logger.Info("Subscription suspended for overdue installment", zap.String("subscriptionId", plan.SubscriptionID))
+		_ = s.notificationRepo.CreateNotification(&models.Notification{
+			StudentID: plan.StudentID,
+			Type:      "subscription_suspended",
+			Message:   "Абонемент приостановлен: платеж по рассрочке просрочен",
+		})
+	}
+
+	toResume, err := s.installmentRepo.GetPlansToResume(today)
+	if err != nil {
+		return err
+	}
+	for _, plan := range toResume {
+		if err := s.installmentRepo.SetSuspended(plan, false); err != nil {
+			logger.Error("Failed to reactivate subscription", logger.ErrorField(err), zap.String("subscriptionId", plan.SubscriptionID))
+			continue
+		}
+		logger.Info("Subscription reactivated after installment payment", zap.String("subscriptionId", plan.SubscriptionID))
+	}
+	return nil
+}
@@ -0,0 +1,101 @@
+package services
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"classmate-central/internal/models"
+	"classmate-central/internal/money"
+)
+
+func TestBuildInstallmentSchedule_AddsUpAndClampsMonthEnd(t *testing.T) {
+	total := money.MustParse("100000", money.KZT)
+	first := time.Date(2024, 1, 31, 0, 0, 0, 0, time.UTC)
+
+	installments, err := BuildInstallmentSchedule(total, 3, first, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sum := money.New(0, money.KZT)
+	for _, inst := range installments {
+		sum = sum.Add(inst.Amount)
+	}
+	if !sum.Equal(total) {
+		t.Errorf("installments add up to %s, want %s", sum, total)
+	}
+
+	wantDates := []string{"2024-01-31", "2024-02-29", "2024-03-31"}
+	for i, inst := range installments {
+		if inst.Seq != i+1 {
+			t.Errorf("installment %d: seq = %d", i, inst.Seq)
+		}
+		if got := inst.DueDate.Format("2006-01-02"); got != wantDates[i] {
+			t.Errorf("installment %d: due %s, want %s", i+1, got, wantDates[i])
+		}
+	}
+
+	if _, err := BuildInstallmentSchedule(total, 0, first, 1); !errors.Is(err, ErrInvalidSchedule) {
+		t.Errorf("expected ErrInvalidSchedule for zero count, got %v", err)
+	}
+	if _, err := BuildInstallmentSchedule(total, MaxInstallments+1, first, 1); !errors.Is(err, ErrInvalidSchedule) {
+		t.Errorf("expected ErrInvalidSchedule above the limit, got %v", err)
+	}
+}
+
+func TestParseInstallmentSchedule(t *testing.T) {
+	total := money.MustParse("90000", money.KZT)
+	valid := []models.InstallmentInput{
+		{DueDate: "2025-01-10", Amount: money.MustParse("50000", "")},
+		{DueDate: "2025-02-10", Amount: money.MustParse("40000", "")},
+	}
+
+	installments, err := ParseInstallmentSchedule(valid, total)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(installments) != 2 || installments[1].Amount.Currency() != money.KZT {
+		t.Errorf("unexpected schedule: %+v", installments)
+	}
+
+	wrongSum := []models.InstallmentInput{
+		{DueDate: "2025-01-10", Amount: money.MustParse("50000", "")},
+		{DueDate: "2025-02-10", Amount: money.MustParse("30000", "")},
+	}
+	if _, err := ParseInstallmentSchedule(wrongSum, total); !errors.Is(err, ErrInvalidSchedule) {
+		t.Errorf("expected ErrInvalidSchedule for wrong total, got %v", err)
+	}
+
+	outOfOrder := []models.InstallmentInput{
+		{DueDate: "2025-02-10", Amount: money.MustParse("50000", "")},
+		{DueDate: "2025-01-10", Amount: money.MustParse("40000", "")},
+	}
+	if _, err := ParseInstallmentSchedule(outOfOrder, total); !errors.Is(err, ErrInvalidSchedule) {
+		t.Errorf("expected ErrInvalidSchedule for dates out of order, got %v", err)
+	}
+}
+
+func TestInstallmentStatus(t *testing.T) {
+	today := time.Date(2025, 3, 15, 14, 0, 0, 0, time.UTC)
+	due := time.Date(2025, 3, 15, 0, 0, 0, 0, time.UTC)
+	amount := money.MustParse("10000", money.KZT)
+
+	cases := []struct {
+		name    string
+		dueDate time.Time
+		paid    string
+		want    string
+	}{
+		{"due today", due, "0", "due"},
+		{"partially paid", due, "4000", "partially_paid"},
+		{"paid", due.AddDate(0, 0, -10), "10000", "paid"},
+		{"overdue", due.AddDate(0, 0, -1), "4000", "overdue"},
+	}
+	for _, tc := range cases {
+		inst := models.Installment{DueDate: tc.dueDate, Amount: amount, PaidAmount: money.MustParse(tc.paid, money.KZT)}
+		if got := InstallmentStatus(inst, today); got != tc.want {
+			t.Errorf("%s: status = %s, want %s", tc.name, got, tc.want)
+		}
+	}
+}
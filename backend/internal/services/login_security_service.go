@@ -0,0 +1,191 @@
+package services
+
+import (
+	"time"
+
+	"classmate-central/internal/logger"
+	"classmate-central/internal/models"
+	"classmate-central/internal/repository"
+
+	"go.uber.org/zap"
+)
+
+// Failure reasons recorded in the login audit trail
+const (
+	LoginFailureUnknownEmail = "unknown_email"
+	LoginFailurePassword     = "invalid_password"
+	LoginFailureTwoFactor    = "invalid_two_factor"
+	LoginFailureLocked       = "locked"
+)
+
+const (
+	// LockoutThreshold is the number of consecutive failed logins that locks an account
+	LockoutThreshold = 5
+	// LoginEventRetention is how long login attempts are kept in the audit trail
+	LoginEventRetention = 180 * 24 * time.Hour
+
+	lockoutBase = time.Minute
+	lockoutMax  = time.Hour
+)
+
+// LoginAttempt describes where a login comes from
+type LoginAttempt struct {
+	Email     string
+	IP        string
+	UserAgent string
+	Country   string // ISO code reported by a trusted proxy, "" if unknown
+}
+
+// LoginSecurityService locks accounts after repeated failed logins, keeps the login audit
+// trail and alerts users about logins from new devices or countries
+type LoginSecurityService struct {
+	userRepo     *repository.UserRepository
+	eventRepo    *repository.LoginEventRepository
+	emailService *EmailService
+}
+
+func NewLoginSecurityService(userRepo *repository.UserRepository, eventRepo *repository.LoginEventRepository, emailService *EmailService) *LoginSecurityService {
+	return &LoginSecurityService{userRepo: userRepo, eventRepo: eventRepo, emailService: emailService}
+}
+
+// LockoutDuration returns how long an account is locked after the given number of
+// consecutive failures: one minute at LockoutThreshold, doubling with every further
+// failure up to an hour
+func LockoutDuration(failures int) time.Duration {
+	if failures < LockoutThreshold {
+		return 0
+	}
+	lock := lockoutBase
+	for i := LockoutThreshold; i < failures && lock < lockoutMax; i++ {
+		lock *= 2
+	}
+	if lock > lockoutMax {
+		lock = lockoutMax
+	}
+	return lock
+}
+
+// LockedFor returns how much longer the account stays locked; 0 if it is not locked.
+// A login attempt against a locked account is recorded.
+func (s *LoginSecurityService) LockedFor(user *models.User, attempt LoginAttempt) (time.Duration, error) {
+	lockedUntil, err := s.userRepo.GetLockedUntil(user.ID)
+	if err != nil || lockedUntil == nil {
+		return 0, err
+	}
+	remaining := time.Until(*lockedUntil)
+	if remaining <= 0 {
+		return 0, nil
+	}
+	s.record(user, attempt, false, LoginFailureLocked, false, false)
+	return remaining, nil
+}
+
+// RecordFailure records a failed login of a known user and locks the account once the
+// failures reach LockoutThreshold, emailing the owner. It returns the lock duration, 0 if not locked.
+func (s *LoginSecurityService) RecordFailure(user *models.User, attempt LoginAttempt, reason string) (time.Duration, error) {
+	s.record(user, attempt, false, reason, false, false)
+
+	failures, err := s.userRepo.RecordFailedLogin(user.ID)
+	if err != nil {
+		return 0, err
+	}
+	lock := LockoutDuration(failures)
+	if lock == 0 {
+		return 0, nil
+	}
+	if err := s.userRepo.LockUntil(user.ID, time.Now().Add(lock)); err != nil {
+		return 0, err
+	}
+	logger.Warn("Account locked after failed logins",
+		zap.Int("userId", user.ID), zap.Int("failures", failures), zap.Duration("lockedFor", lock), zap.String("ip", attempt.IP))
+	// Login responses do not reveal the lock, so the owner hears about it by email
+	go func() {
+		if err := s.emailService.SendAccountLockedAlert(user.Email, attempt.IP, lock); err != nil {
+			logger.Error("Failed to send account lock alert", logger.ErrorField(err), zap.Int("userId", user.ID))
+		}
+	}()
+	return lock, nil
+}
+
+// RecordUnknownEmail records a login attempt for an email that is not registered
+func (s *LoginSecurityService) RecordUnknownEmail(attempt LoginAttempt) {
+	s.record(nil, attempt, false, LoginFailureUnknownEmail, false, false)
+}
+
+// RecordSuccess resets the failure counter, records the login and emails the user when
+// it comes from a device or country not seen in earlier logins
+func (s *LoginSecurityService) RecordSuccess(user *models.User, attempt LoginAttempt) error {
+	if err := s.userRepo.ResetFailedLogins(user.ID); err != nil {
+		return err
+	}
+
+	device := DeviceName(attempt.UserAgent)
+	history, err := s.eventRepo.GetHistory(user.ID, device, attempt.Country)
+	if err != nil {
+		return err
+	}
+	// The first recorded login has nothing to compare against
+	newDevice := history.HasLogins && !history.KnownDevice
+	newCountry := history.HasLogins && attempt.Country != "" && !history.KnownCountry
+	s.record(user, attempt, true, "", newDevice, newCountry)
+
+	if newDevice || newCountry {
+		logger.Info("Login from a new device or country",
+			zap.Int("userId", user.ID), zap.String("device", device), zap.String("country", attempt.Country), zap.String("ip", attempt.IP))
+		go func() {
+			if err := s.emailService.SendNewLoginAlert(user.Email, device, attempt.IP, attempt.Country, time.Now()); err != nil {
+				logger.Error("Failed to send new login alert", logger.ErrorField(err), zap.Int("userId", user.ID))
+			}
+		}()
+	}
+	return nil
+}
+
+// ListEvents returns the latest login attempts of a user of the company
+func (s *LoginSecurityService) ListEvents(userID int, companyID string, limit int) ([]*models.LoginEvent, error) {
+	return s.eventRepo.ListByUser(userID, companyID, limit)
+}
+
+// Unlock lifts a lockout of a user of the company
+func (s *LoginSecurityService) Unlock(userID int, companyID string) error {
+	return s.userRepo.Unlock(userID, companyID)
+}
+
+// CleanupOldEvents deletes login attempts older than LoginEventRetention
+func (s *LoginSecurityService) CleanupOldEvents() error {
+	deleted, err := s.eventRepo.DeleteOlderThan(time.Now().Add(-LoginEventRetention))
+	if err != nil {
+		return err
+	}
+	if deleted > 0 {
+		logger.Info("Old login events deleted", zap.Int64("count", deleted))
+	}
+	return nil
+}
+
+// record writes a login event; the audit trail must never block a login, so failures are only logged
+func (s *LoginSecurityService) record(user *models.User, attempt LoginAttempt, success bool, reason string, newDevice, newCountry bool) {
+	event := &models.LoginEvent{
+		Email:      attempt.Email,
+		Success:    success,
+		IP:         attempt.IP,
+		UserAgent:  attempt.UserAgent,
+		Device:     DeviceName(attempt.UserAgent),
+		Country:    attempt.Country,
+		NewDevice:  newDevice,
+		NewCountry: newCountry,
+	}
+	if user != nil {
+		event.UserID = &user.ID
+		event.Email = user.Email
+		if user.CompanyID != "" {
+			event.CompanyID = &user.CompanyID
+		}
+	}
+	if reason != "" {
+		event.FailureReason = &reason
+	}
+	if err := s.eventRepo.Create(event); err != nil {
+		logger.Error("Failed to record login event", logger.ErrorField(err), zap.String("email", event.Email))
+	}
+}
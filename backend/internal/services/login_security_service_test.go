@@ -0,0 +1,22 @@
+package services
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLockoutDuration(t *testing.T) {
+	for failures, want := range map[int]time.Duration{
+		0:                      0,
+		LockoutThreshold - 1:   0,
+		LockoutThreshold:       time.Minute,
+		LockoutThreshold + 1:   2 * time.Minute,
+		LockoutThreshold + 3:   8 * time.Minute,
+		LockoutThreshold + 6:   time.Hour, // 64 minutes is capped
+		LockoutThreshold + 100: time.Hour,
+	} {
+		if got := LockoutDuration(failures); got != want {
+			t.Errorf("LockoutDuration(%d) = %v, want %v", failures, got, want)
+		}
+	}
+}
@@ -37,6 +37,10 @@ type MigrationConfig struct {
 	DBUser     string
 	DBPassword string
 	ScriptPath string // Путь к скрипту миграции
+	// MaxStudents and MaxBranches are the company's plan limits; nil means unlimited. The script
+	// checks them before it writes anything
+	MaxStudents *int64
+	MaxBranches *int64
 }
 
 type MigrationResult struct {
@@ -80,6 +84,13 @@ func (s *MigrationService) RunMigration(config MigrationConfig, progressCallback
 		fmt.Sprintf("DB_PASSWORD=%s", config.DBPassword),
 	}
 
+	if config.MaxStudents != nil {
+		envVars = append(envVars, fmt.Sprintf("PLAN_MAX_STUDENTS=%d", *config.MaxStudents))
+	}
+	if config.MaxBranches != nil {
+		envVars = append(envVars, fmt.Sprintf("PLAN_MAX_BRANCHES=%d", *config.MaxBranches))
+	}
+
 	// Also pass DATABASE_URL for Railway (Node.js can parse it directly)
 	if databaseURL := os.Getenv("DATABASE_URL"); databaseURL != "" {
 		envVars = append(envVars, fmt.Sprintf("DATABASE_URL=%s", databaseURL))
@@ -28,11 +28,16 @@ func NewNotificationService(
 
 // CheckAndCreateDebtNotifications checks for pending debts and creates notifications
 func (s *NotificationService) CheckAndCreateDebtNotifications() error {
-	// Get all pending debts (across all companies for background task)
+	// Get all outstanding debts (across all companies for background task)
 	debts, err := s.debtRepo.GetByStatusAllCompanies("pending")
 	if err != nil {
 		return fmt.Errorf("error getting pending debts: %w", err)
 	}
+	partiallyPaid, err := s.debtRepo.GetByStatusAllCompanies("partially_paid")
+	if err != nil {
+		return fmt.Errorf("error getting partially paid debts: %w", err)
+	}
+	debts = append(debts, partiallyPaid...)
 
 	now := time.Now()
 	for _, debt := range debts {
@@ -47,10 +52,10 @@ func (s *NotificationService) CheckAndCreateDebtNotifications() error {
 			var message string
 			if debt.DueDate.Before(now) {
 				daysOverdue := int(now.Sub(*debt.DueDate).Hours() / 24)
-				message = fmt.Sprintf("Просроченный долг: %.2f ₸ (просрочен на %d дней)", debt.Amount, daysOverdue)
+				message = fmt.Sprintf("Просроченный долг: %s (просрочен на %d дней)", debt.Remaining().Format(), daysOverdue)
 			} else {
 				daysUntilDue := int(debt.DueDate.Sub(now).Hours() / 24)
-				message = fmt.Sprintf("Напоминание о долге: %.2f ₸ (срок: %d дней)", debt.Amount, daysUntilDue)
+				message = fmt.Sprintf("Напоминание о долге: %s (срок: %d дней)", debt.Remaining().Format(), daysUntilDue)
 			}
 
 			notification := &models.Notification{
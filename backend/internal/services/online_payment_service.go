@@ -0,0 +1,277 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"classmate-central/internal/gateway"
+	"classmate-central/internal/logger"
+	"classmate-central/internal/models"
+	"classmate-central/internal/money"
+	"classmate-central/internal/repository"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+var (
+	// ErrNothingToPay is returned for payment links without a positive amount
+	ErrNothingToPay = errors.New("nothing to pay")
+	// ErrInvoiceNotPayable is returned for invoices of another student, or already paid or void
+	ErrInvoiceNotPayable = errors.New("invoice cannot be paid")
+	// ErrProviderFailed is returned when the payment provider rejects or does not answer a request
+	ErrProviderFailed = errors.New("payment provider request failed")
+)
+
+// Reconciliation of intents the provider never reported on
+const (
+	PendingReconcileAfter = 15 * time.Minute // give the webhook a chance first
+	PendingIntentExpiry   = 24 * time.Hour   // unknown to the provider after this long: abandoned
+)
+
+type OnlinePaymentService struct {
+	intentRepo  *repository.PaymentIntentRepository
+	invoiceRepo *repository.InvoiceRepository
+	studentRepo *repository.StudentRepository
+	providers   *gateway.Registry
+}
+
+func NewOnlinePaymentService(
+	intentRepo *repository.PaymentIntentRepository,
+	invoiceRepo *repository.InvoiceRepository,
+	studentRepo *repository.StudentRepository,
+	providers *gateway.Registry,
+) *OnlinePaymentService {
+	return &OnlinePaymentService{
+		intentRepo:  intentRepo,
+		invoiceRepo: invoiceRepo,
+		studentRepo: studentRepo,
+		providers:   providers,
+	}
+}
+
+// CreateIntent creates a payment link at the provider. Returns nil, nil if the student or invoice is not found.
+func (s *OnlinePaymentService) CreateIntent(req models.CreatePaymentIntentRequest, createdBy *int, companyID string) (*models.PaymentIntent, error) {
+	provider, err := s.providers.Get(req.Provider)
+	if err != nil {
+		return nil, err
+	}
+
+	amount := req.Amount
+	if req.InvoiceID != nil {
+		invoice, due, err := s.invoiceRepo.GetBalanceDue(*req.InvoiceID, companyID)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if invoice.StudentID != req.StudentID || (invoice.Status != "unpaid" && invoice.Status != "partially") {
+			return nil, ErrInvoiceNotPayable
+		}
+		if amount.IsZero() {
+			amount = due
+		}
+	}
+	if !amount.IsPositive() {
+		return nil, ErrNothingToPay
+	}
+
+	intent := &models.PaymentIntent{
+		ID:          uuid.New().String(),
+		StudentID:   req.StudentID,
+		InvoiceID:   req.InvoiceID,
+		Amount:      amount,
+		Description: req.Description,
+		Provider:    provider.Name(),
+		CreatedBy:   createdBy,
+	}
+	if err := s.intentRepo.Create(intent, companyID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	email := ""
+	if student, err := s.studentRepo.GetByID(req.StudentID, companyID); err == nil && student != nil {
+		email = student.Email
+	}
+	payment, err := provider.CreatePayment(gateway.PaymentRequest{
+		Reference:   intent.ID,
+		Amount:      intent.Amount,
+		Description: intent.Description,
+		AccountID:   intent.StudentID,
+		Email:       email,
+		ReturnURL:   req.ReturnURL,
+	})
+	if err != nil {
+		logger.Error("Failed to create payment at provider", logger.ErrorField(err),
+			zap.String("provider", provider.Name()), zap.String("intentId", intent.ID))
+		_ = s.intentRepo.MarkFailed(intent.ID, provider.Name())
+		return nil, fmt.Errorf("%w: %v", ErrProviderFailed, err)
+	}
+
+	if err := s.intentRepo.SetProviderPayment(intent.ID, payment.ProviderPaymentID, payment.PaymentURL, companyID); err != nil {
+		return nil, err
+	}
+	if payment.ProviderPaymentID != "" {
+		intent.ProviderPaymentID = &payment.ProviderPaymentID
+	}
+	if payment.PaymentURL != "" {
+		intent.PaymentURL = &payment.PaymentURL
+	}
+	return intent, nil
+}
+
+// HandleWebhook verifies and applies a provider notification. Redelivered notifications are no-ops.
+func (s *OnlinePaymentService) HandleWebhook(providerName string, header http.Header, body []byte) error {
+	if providerName == "" {
+		return gateway.ErrUnknownProvider
+	}
+	provider, err := s.providers.Get(providerName)
+	if err != nil {
+		return err
+	}
+	payment, err := provider.ParseWebhook(header, body)
+	if err != nil {
+		return err
+	}
+	return s.apply(provider.Name(), payment)
+}
+
+// apply moves the intent to the state reported by the provider. A confirmation from another provider
+// than the one of the intent is rejected.
+func (s *OnlinePaymentService) apply(providerName string, payment *gateway.Payment) error {
+	switch payment.Status {
+	case gateway.StatusSucceeded:
+		intent, applied, err := s.intentRepo.Confirm(payment.Reference, providerName, payment.ProviderPaymentID, payment.Amount)
+		if errors.Is(err, sql.ErrNoRows) {
+			logger.Warn("Payment notification for unknown intent", zap.String("reference", payment.Reference))
+			return nil
+		}
+		if errors.Is(err, repository.ErrProviderMismatch) {
+			logger.Warn("Payment notification from another provider than the intent",
+				zap.String("reference", payment.Reference), zap.String("provider", providerName))
+			return err
+		}
+		if err != nil {
+			return err
+		}
+		switch {
+		case applied:
+			logger.Info("Online payment confirmed", zap.String("intentId", intent.ID), zap.String("amount", payment.Amount.Format()))
+		case intent.Status == "review":
+			logger.Warn("Online payment amount differs from the intent, held for review",
+				zap.String("intentId", intent.ID), zap.String("expected", intent.Amount.Format()), zap.String("paid", intent.Paid().Format()))
+		}
+	case gateway.StatusFailed:
+		return s.intentRepo.MarkFailed(payment.Reference, providerName)
+	case gateway.StatusRefunded:
+		// Refunds are booked when they are requested through the API
+		logger.Info("Refund notification received", zap.String("reference", payment.Reference))
+	}
+	return nil
+}
+
+// ReconcilePending resolves intents stuck in pending by querying the provider (background task)
+func (s *OnlinePaymentService) ReconcilePending() error {
+	now := time.Now()
+	intents, err := s.intentRepo.GetStalePending(now.Add(-PendingReconcileAfter))
+	if err != nil {
+		return err
+	}
+
+	resolved := 0
+	for _, intent := range intents {
+		provider, err := s.providers.Get(intent.Provider)
+		if err != nil {
+			logger.Warn("Pending intent of a provider that is not configured", zap.String("intentId", intent.ID), zap.String("provider", intent.Provider))
+			continue
+		}
+
+		payment, err := provider.GetPayment(intent.ID)
+		if errors.Is(err, gateway.ErrPaymentNotFound) {
+			// Never paid: the payer did not finish the payment page
+			if now.Sub(intent.CreatedAt) > PendingIntentExpiry {
+				if err := s.intentRepo.MarkFailed(intent.ID, intent.Provider); err == nil {
+					resolved++
+				}
+			}
+			continue
+		}
+		if err != nil {
+			logger.Error("Failed to query payment status", logger.ErrorField(err), zap.String("intentId", intent.ID))
+			continue
+		}
+
+		if payment.Status == gateway.StatusPending {
+			if now.Sub(intent.CreatedAt) > PendingIntentExpiry {
+				logger.Warn("Online payment still pending at provider", zap.String("intentId", intent.ID))
+			}
+			continue
+		}
+		payment.Reference = intent.ID
+		if err := s.apply(intent.Provider, payment); err != nil {
+			logger.Error("Failed to reconcile payment intent", logger.ErrorField(err), zap.String("intentId", intent.ID))
+			continue
+		}
+		resolved++
+	}
+
+	if resolved > 0 {
+		logger.Info("Pending online payments reconciled", zap.Int("count", resolved))
+	}
+	return nil
+}
+
+// AcceptReview books an online payment held in review for the amount the payer actually paid.
+// Returns nil, nil if the intent is not found.
+func (s *OnlinePaymentService) AcceptReview(id, companyID string) (*models.PaymentIntent, error) {
+	intent, err := s.intentRepo.AcceptReview(id, companyID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	logger.Info("Online payment accepted after review", zap.String("intentId", intent.ID), zap.String("amount", intent.Paid().Format()))
+	return intent, nil
+}
+
+// Refund returns the amount (the whole rest when zero) to the payer through the provider and books the
+// refund. Returns nil, nil if the intent is not found.
+func (s *OnlinePaymentService) Refund(id string, amount money.Money, createdBy *int, companyID string) (*models.PaymentIntent, error) {
+	intent, err := s.intentRepo.GetByID(id, companyID)
+	if err != nil || intent == nil {
+		return nil, err
+	}
+
+	amount = amount.WithCurrency(intent.Currency)
+	if amount.IsZero() {
+		amount = intent.Refundable()
+	}
+	if !amount.IsPositive() {
+		return nil, ErrNothingToPay
+	}
+	if err := repository.CheckRefundable(intent, amount); err != nil {
+		return nil, err
+	}
+	if intent.ProviderPaymentID == nil {
+		return nil, repository.ErrIntentNotConfirmed
+	}
+
+	provider, err := s.providers.Get(intent.Provider)
+	if err != nil {
+		return nil, err
+	}
+	if err := provider.Refund(*intent.ProviderPaymentID, amount); err != nil {
+		logger.Error("Provider refused refund", logger.ErrorField(err), zap.String("intentId", intent.ID))
+		return nil, fmt.Errorf("%w: %v", ErrProviderFailed, err)
+	}
+
+	return s.intentRepo.RecordRefund(id, amount, createdBy, companyID)
+}
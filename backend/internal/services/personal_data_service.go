@@ -0,0 +1,38 @@
+package services
+
+import (
+	"classmate-central/internal/database"
+	"classmate-central/internal/logger"
+	"classmate-central/internal/models"
+	"classmate-central/internal/repository"
+
+	"go.uber.org/zap"
+)
+
+// PersonalDataService answers data subject requests for students and leads: an export of
+// everything held about the person, and erasure of their personal data
+type PersonalDataService struct {
+	repo *repository.PersonalDataRepository
+}
+
+func NewPersonalDataService(repo *repository.PersonalDataRepository) *PersonalDataService {
+	return &PersonalDataService{repo: repo}
+}
+
+// Export returns the data held about a student or lead of the actor's company, or nil if there is none with that ID
+func (s *PersonalDataService) Export(actor database.Actor, subjectType, id string) (*models.PersonalDataExport, error) {
+	return s.repo.Export(actor, subjectType, id)
+}
+
+// Erase anonymizes a student or lead of the actor's company, or returns nil if there is none with that ID
+func (s *PersonalDataService) Erase(actor database.Actor, subjectType, id string) (*models.PersonalDataErasure, error) {
+	erasure, err := s.repo.Erase(actor, subjectType, id)
+	if err == nil && erasure != nil {
+		logger.Info("Personal data erased",
+			zap.String("company_id", actor.CompanyID),
+			zap.String("subject_type", subjectType),
+			zap.String("subject_id", id),
+			zap.Int("user_id", actor.UserID))
+	}
+	return erasure, err
+}
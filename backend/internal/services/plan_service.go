@@ -0,0 +1,226 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"classmate-central/internal/database"
+	"classmate-central/internal/logger"
+	"classmate-central/internal/models"
+	"classmate-central/internal/repository"
+
+	"go.uber.org/zap"
+)
+
+// ErrPlanNotFound is returned when a company is moved to a plan that does not exist
+var ErrPlanNotFound = errors.New("plan not found")
+
+// ErrInvalidPlan is returned for negative limits and unknown features
+var ErrInvalidPlan = errors.New("invalid plan")
+
+// PlanLimitError is returned when a company has used up a resource of its plan
+type PlanLimitError struct {
+	Resource string // students, branches, users or storage
+	Limit    int64  // storage in bytes
+	Used     int64
+}
+
+func (e *PlanLimitError) Error() string {
+	if e.Resource == models.PlanResourceStorage {
+		return fmt.Sprintf("plan limit reached: storage (%d of %d MB used)", e.Used/(1024*1024), e.Limit/(1024*1024))
+	}
+	return fmt.Sprintf("plan limit reached: %s (%d of %d)", e.Resource, e.Used, e.Limit)
+}
+
+// PlanService enforces the limits of company plans and meters what companies use
+type PlanService struct {
+	repo        *repository.PlanRepository
+	companyRepo *repository.CompanyRepository
+}
+
+func NewPlanService(repo *repository.PlanRepository, companyRepo *repository.CompanyRepository) *PlanService {
+	return &PlanService{repo: repo, companyRepo: companyRepo}
+}
+
+// CheckLimit returns a *PlanLimitError if the company's plan does not allow one more of a
+// resource. For storage, the last metered usage must be under the limit.
+func (s *PlanService) CheckLimit(companyID, resource string) error {
+	plan, err := s.repo.GetCompanyPlan(companyID)
+	if err != nil || plan == nil {
+		return err
+	}
+	limit := plan.Limit(resource)
+	if limit == nil {
+		return nil
+	}
+	used, err := s.repo.CountUsage(companyID, resource)
+	if err != nil {
+		return err
+	}
+	if used >= *limit {
+		return &PlanLimitError{Resource: resource, Limit: *limit, Used: used}
+	}
+	return nil
+}
+
+// Remaining returns how many more of a resource the company's plan allows, or nil if the plan
+// has no limit on it. Bulk imports check what they add against it.
+func (s *PlanService) Remaining(companyID, resource string) (*int64, error) {
+	plan, err := s.repo.GetCompanyPlan(companyID)
+	if err != nil || plan == nil {
+		return nil, err
+	}
+	limit := plan.Limit(resource)
+	if limit == nil {
+		return nil, nil
+	}
+	used, err := s.repo.CountUsage(companyID, resource)
+	if err != nil {
+		return nil, err
+	}
+	remaining := *limit - used
+	if remaining < 0 {
+		remaining = 0
+	}
+	return &remaining, nil
+}
+
+// GetPlans returns every plan with the number of companies on it
+func (s *PlanService) GetPlans() ([]*models.Plan, error) {
+	return s.repo.GetPlans()
+}
+
+// GetCompanyPlan returns the plan of a company, or nil if the company does not exist
+func (s *PlanService) GetCompanyPlan(companyID string) (*models.Plan, error) {
+	return s.repo.GetCompanyPlan(companyID)
+}
+
+// UpdatePlan replaces the limits and features of a plan. Returns nil if it does not exist.
+func (s *PlanService) UpdatePlan(id string, req models.UpdatePlanRequest) (*models.Plan, error) {
+	if err := ValidatePlan(req); err != nil {
+		return nil, err
+	}
+	plan := &models.Plan{
+		ID:           id,
+		Name:         req.Name,
+		MaxStudents:  req.MaxStudents,
+		MaxBranches:  req.MaxBranches,
+		MaxUsers:     req.MaxUsers,
+		MaxStorageMB: req.MaxStorageMB,
+		Features:     req.Features,
+	}
+	if plan.Features == nil {
+		plan.Features = []string{}
+	}
+	if err := s.repo.UpdatePlan(plan); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	logger.Info("Plan updated", zap.String("plan_id", id))
+	return plan, nil
+}
+
+// ValidatePlan checks that limits are not negative and that the features are known and listed once
+func ValidatePlan(req models.UpdatePlanRequest) error {
+	for name, limit := range map[string]*int{
+		"maxStudents":  req.MaxStudents,
+		"maxBranches":  req.MaxBranches,
+		"maxUsers":     req.MaxUsers,
+		"maxStorageMb": req.MaxStorageMB,
+	} {
+		if limit != nil && *limit < 0 {
+			return fmt.Errorf("%w: %s must not be negative", ErrInvalidPlan, name)
+		}
+	}
+	seen := map[string]bool{}
+	for _, feature := range req.Features {
+		known := false
+		for _, f := range models.PlanFeatures {
+			known = known || f == feature
+		}
+		if !known {
+			return fmt.Errorf("%w: unknown feature %q", ErrInvalidPlan, feature)
+		}
+		if seen[feature] {
+			return fmt.Errorf("%w: feature %q is listed twice", ErrInvalidPlan, feature)
+		}
+		seen[feature] = true
+	}
+	return nil
+}
+
+// SetCompanyPlan moves the actor's company to another plan. Returns sql.ErrNoRows if the
+// company does not exist.
+func (s *PlanService) SetCompanyPlan(actor database.Actor, planID string) error {
+	plan, err := s.repo.GetPlan(planID)
+	if err != nil {
+		return err
+	}
+	if plan == nil {
+		return ErrPlanNotFound
+	}
+	if err := s.repo.SetCompanyPlan(actor, planID); err != nil {
+		return err
+	}
+	logger.Info("Company plan changed",
+		zap.String("company_id", actor.CompanyID),
+		zap.String("plan_id", planID),
+		zap.Int("user_id", actor.UserID))
+	return nil
+}
+
+// GetCompaniesUsage returns every company with its plan and current usage
+func (s *PlanService) GetCompaniesUsage() ([]*models.CompanyPlanUsage, error) {
+	return s.repo.GetCompaniesUsage()
+}
+
+// GetCompanyUsage returns a company's plan, current usage and the usage metered in the last
+// days, or nil if the company does not exist
+func (s *PlanService) GetCompanyUsage(companyID string, days int) (*models.CompanyPlanUsage, error) {
+	company, err := s.companyRepo.GetByID(companyID)
+	if err != nil || company == nil {
+		return nil, err
+	}
+	plan, err := s.repo.GetCompanyPlan(companyID)
+	if err != nil {
+		return nil, err
+	}
+	current, err := s.repo.GetCurrentUsage(companyID)
+	if err != nil {
+		return nil, err
+	}
+	history, err := s.repo.GetUsageHistory(companyID, dateOnly(time.Now()).AddDate(0, 0, -days))
+	if err != nil {
+		return nil, err
+	}
+	return &models.CompanyPlanUsage{Company: company, Plan: plan, Current: current, History: history}, nil
+}
+
+// MeterUsage records today's usage of every company. A company that cannot be measured is
+// logged and skipped.
+func (s *PlanService) MeterUsage() error {
+	companies, err := s.repo.GetMeteredCompanies()
+	if err != nil {
+		return err
+	}
+	today := dateOnly(time.Now())
+	metered := 0
+	for _, companyID := range companies {
+		if _, err := s.repo.MeterUsage(companyID, today); err != nil {
+			logger.Error("Failed to meter company usage", logger.ErrorField(err), zap.String("company_id", companyID))
+			continue
+		}
+		metered++
+	}
+	logger.Info("Company usage metered", zap.Int("count", metered))
+	return nil
+}
+
+// MeterCompanyUsage records today's usage of one company, or returns nil if it does not exist
+func (s *PlanService) MeterCompanyUsage(companyID string) (*models.CompanyUsage, error) {
+	return s.repo.MeterUsage(companyID, dateOnly(time.Now()))
+}
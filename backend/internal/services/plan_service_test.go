@@ -0,0 +1,62 @@
+package services
+
+import (
+	"errors"
+	"testing"
+
+	"classmate-central/internal/models"
+)
+
+func TestValidatePlan(t *testing.T) {
+	limit := func(v int) *int { return &v }
+	valid := models.UpdatePlanRequest{
+		Name:        "Standard",
+		MaxStudents: limit(500),
+		MaxBranches: limit(0), // nothing can be added, but the limit is valid
+		Features:    []string{models.PlanFeatureExports, models.PlanFeatureSSO},
+	}
+	if err := ValidatePlan(valid); err != nil {
+		t.Fatalf("expected a valid plan, got %v", err)
+	}
+
+	cases := map[string]models.UpdatePlanRequest{
+		"negative limit":    {Name: "x", MaxUsers: limit(-1)},
+		"unknown feature":   {Name: "x", Features: []string{"api"}},
+		"duplicate feature": {Name: "x", Features: []string{models.PlanFeatureExports, models.PlanFeatureExports}},
+	}
+	for name, req := range cases {
+		if err := ValidatePlan(req); !errors.Is(err, ErrInvalidPlan) {
+			t.Errorf("%s: expected ErrInvalidPlan, got %v", name, err)
+		}
+	}
+}
+
+func TestPlanLimit(t *testing.T) {
+	students, storage := 50, 100
+	plan := &models.Plan{MaxStudents: &students, MaxStorageMB: &storage}
+
+	if got := plan.Limit(models.PlanResourceStudents); got == nil || *got != 50 {
+		t.Errorf("students limit = %v, want 50", got)
+	}
+	if got := plan.Limit(models.PlanResourceStorage); got == nil || *got != 100*1024*1024 {
+		t.Errorf("storage limit = %v, want 100 MB in bytes", got)
+	}
+	if got := plan.Limit(models.PlanResourceBranches); got != nil {
+		t.Errorf("branches limit = %d, want unlimited", *got)
+	}
+}
+
+func TestPlanLimitError(t *testing.T) {
+	err := error(&PlanLimitError{Resource: models.PlanResourceStudents, Limit: 50, Used: 50})
+	var limitErr *PlanLimitError
+	if !errors.As(err, &limitErr) || limitErr.Limit != 50 {
+		t.Fatalf("errors.As did not find the limit error")
+	}
+	if got, want := err.Error(), "plan limit reached: students (50 of 50)"; got != want {
+		t.Errorf("Error() = %q, want %q", got, want)
+	}
+	storage := &PlanLimitError{Resource: models.PlanResourceStorage, Limit: 100 << 20, Used: 120 << 20}
+	if got, want := storage.Error(), "plan limit reached: storage (120 of 100 MB used)"; got != want {
+		t.Errorf("Error() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,193 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"classmate-central/internal/database"
+	"classmate-central/internal/logger"
+	"classmate-central/internal/middleware"
+	"classmate-central/internal/models"
+	"classmate-central/internal/repository"
+
+	"go.uber.org/zap"
+)
+
+// ErrImpersonationNotAllowed is returned when a platform admin tries to sign in as another platform admin
+var ErrImpersonationNotAllowed = errors.New("platform admins cannot be impersonated")
+
+// ErrUnknownMaintenanceJob is returned for a job name that is not in MaintenanceJobs
+var ErrUnknownMaintenanceJob = errors.New("unknown maintenance job")
+
+// Maintenance jobs platform admins can run for one company; the names are those of the scheduled jobs
+const (
+	JobUsageMetering       = "usage_metering"
+	JobTrashPurge          = "trash_purge"
+	JobOldCompanySnapshots = "old_company_snapshots"
+	JobOverdueInvoiceDebts = "overdue_invoice_debts"
+)
+
+// MaintenanceJobs lists every job that can be run for one company
+var MaintenanceJobs = []string{JobUsageMetering, JobTrashPurge, JobOldCompanySnapshots, JobOverdueInvoiceDebts}
+
+// PlatformService runs the platform console: finding companies, suspending them, signing in as
+// their users for support and running maintenance for one company. Every change is recorded in
+// the audit log of the company it affects.
+type PlatformService struct {
+	repo        *repository.PlatformRepository
+	plans       *PlanService
+	sessions    *SessionService
+	trash       *TrashService
+	companyData *CompanyDataService
+	debts       *DebtService
+}
+
+func NewPlatformService(repo *repository.PlatformRepository, plans *PlanService, sessions *SessionService,
+	trash *TrashService, companyData *CompanyDataService, debts *DebtService) *PlatformService {
+	return &PlatformService{
+		repo:        repo,
+		plans:       plans,
+		sessions:    sessions,
+		trash:       trash,
+		companyData: companyData,
+		debts:       debts,
+	}
+}
+
+// SearchCompanies returns one page of the companies matching the filter with their usage
+func (s *PlatformService) SearchCompanies(filter models.PlatformCompanyFilter) (*models.PlatformCompanyList, error) {
+	return s.repo.SearchCompanies(filter)
+}
+
+// GetCompany returns a company with its plan, usage, figures and users, or nil if it does not exist
+func (s *PlatformService) GetCompany(id string) (*models.PlatformCompanyDetails, error) {
+	company, err := s.repo.GetCompany(id)
+	if err != nil || company == nil {
+		return nil, err
+	}
+	plan, err := s.plans.GetCompanyPlan(id)
+	if err != nil {
+		return nil, err
+	}
+	stats, err := s.repo.GetCompanyStats(id)
+	if err != nil {
+		return nil, err
+	}
+	users, err := s.repo.GetCompanyUsers(id)
+	if err != nil {
+		return nil, err
+	}
+	return &models.PlatformCompanyDetails{PlatformCompany: company, Plan: plan, Stats: stats, Users: users}, nil
+}
+
+// SuspendCompany makes the actor's company read-only. Its users see the change on their next
+// request. Returns sql.ErrNoRows if the company does not exist and
+// repository.ErrCompanyStatusUnchanged if it is already suspended.
+func (s *PlatformService) SuspendCompany(actor database.Actor, reason string) error {
+	if err := s.repo.SetCompanyStatus(actor, models.CompanyStatusSuspended, reason); err != nil {
+		return err
+	}
+	logger.Info("Company suspended",
+		zap.String("company_id", actor.CompanyID),
+		zap.Int("user_id", actor.UserID))
+	return nil
+}
+
+// ReactivateCompany makes a suspended or deleted (inactive) company active again
+func (s *PlatformService) ReactivateCompany(actor database.Actor) error {
+	if err := s.repo.SetCompanyStatus(actor, models.CompanyStatusActive, ""); err != nil {
+		return err
+	}
+	logger.Info("Company reactivated",
+		zap.String("company_id", actor.CompanyID),
+		zap.Int("user_id", actor.UserID))
+	return nil
+}
+
+// Impersonate opens a support session in which the platform admin (actor.UserID) acts as a user
+// of actor.CompanyID, and returns its access token. Returns nil if the company has no such user.
+func (s *PlatformService) Impersonate(actor database.Actor, userID int, reason, userAgent string) (*models.ImpersonationResponse, error) {
+	user, err := s.repo.GetCompanyUser(actor.CompanyID, userID)
+	if err != nil || user == nil {
+		return nil, err
+	}
+	if user.PlatformAdmin {
+		return nil, ErrImpersonationNotAllowed
+	}
+
+	session, err := s.sessions.StartImpersonation(actor, user.ID, userAgent, reason)
+	if err != nil {
+		return nil, err
+	}
+	token, err := middleware.GenerateImpersonationToken(user.ID, user.Email, session.ID, session.ContextVersion, session.ExpiresAt)
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Info("Impersonation started",
+		zap.String("company_id", actor.CompanyID),
+		zap.Int("user_id", user.ID),
+		zap.Int("platform_admin_id", actor.UserID),
+		zap.String("session_id", session.ID))
+	return &models.ImpersonationResponse{
+		AccessToken: token,
+		ExpiresAt:   session.ExpiresAt,
+		SessionID:   session.ID,
+		User:        user,
+	}, nil
+}
+
+// RunMaintenanceJob runs one of MaintenanceJobs for the actor's company now and records the
+// run in the company's audit log. Returns nil if the company does not exist.
+func (s *PlatformService) RunMaintenanceJob(actor database.Actor, job string) (*models.MaintenanceRun, error) {
+	known := false
+	for _, j := range MaintenanceJobs {
+		known = known || j == job
+	}
+	if !known {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownMaintenanceJob, job)
+	}
+
+	company, err := s.repo.GetCompany(actor.CompanyID)
+	if err != nil || company == nil {
+		return nil, err
+	}
+
+	run := &models.MaintenanceRun{Job: job, CompanyID: company.ID, StartedAt: time.Now()}
+	run.Result, err = s.runJob(job, company.ID)
+	if err != nil {
+		return nil, err
+	}
+	run.FinishedAt = time.Now()
+
+	if err := s.repo.RecordAction(actor, "run_maintenance", map[string]interface{}{
+		"job":    job,
+		"result": run.Result,
+	}); err != nil {
+		return nil, err
+	}
+	logger.Info("Maintenance job run for company",
+		zap.String("job", job),
+		zap.String("company_id", company.ID),
+		zap.Int("user_id", actor.UserID))
+	return run, nil
+}
+
+func (s *PlatformService) runJob(job, companyID string) (map[string]interface{}, error) {
+	switch job {
+	case JobUsageMetering:
+		usage, err := s.plans.MeterCompanyUsage(companyID)
+		return map[string]interface{}{"usage": usage}, err
+	case JobTrashPurge:
+		purged, err := s.trash.PurgeCompanyExpired(companyID)
+		return map[string]interface{}{"purged": purged}, err
+	case JobOldCompanySnapshots:
+		deleted, err := s.companyData.CleanupCompanySnapshots(companyID)
+		return map[string]interface{}{"deleted": deleted}, err
+	case JobOverdueInvoiceDebts:
+		created, err := s.debts.GenerateCompanyOverdueDebts(companyID)
+		return map[string]interface{}{"created": created}, err
+	}
+	return nil, fmt.Errorf("%w: %q", ErrUnknownMaintenanceJob, job)
+}
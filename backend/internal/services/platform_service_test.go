@@ -0,0 +1,15 @@
+package services
+
+import (
+	"errors"
+	"testing"
+
+	"classmate-central/internal/database"
+)
+
+func TestRunMaintenanceJobRejectsUnknownJob(t *testing.T) {
+	s := NewPlatformService(nil, nil, nil, nil, nil, nil)
+	if _, err := s.RunMaintenanceJob(database.Actor{CompanyID: "c1", UserID: 1}, "vacuum"); !errors.Is(err, ErrUnknownMaintenanceJob) {
+		t.Errorf("expected ErrUnknownMaintenanceJob, got %v", err)
+	}
+}
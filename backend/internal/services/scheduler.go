@@ -0,0 +1,73 @@
+package services
+
+import (
+	"time"
+
+	"classmate-central/internal/logger"
+
+	"go.uber.org/zap"
+)
+
+// ScheduledJob is a periodic background task
+type ScheduledJob struct {
+	Name     string
+	Interval time.Duration
+	Run      func() error
+}
+
+// Scheduler runs background jobs periodically (debt generation, reminders, etc.)
+type Scheduler struct {
+	jobs []ScheduledJob
+	stop chan struct{}
+}
+
+func NewScheduler() *Scheduler {
+	return &Scheduler{stop: make(chan struct{})}
+}
+
+// AddJob registers a job; it runs once at start and then every interval
+func (s *Scheduler) AddJob(name string, interval time.Duration, run func() error) {
+	s.jobs = append(s.jobs, ScheduledJob{Name: name, Interval: interval, Run: run})
+}
+
+// Start launches every registered job in its own goroutine
+func (s *Scheduler) Start() {
+	for _, job := range s.jobs {
+		go s.loop(job)
+	}
+}
+
+// Stop stops all jobs
+func (s *Scheduler) Stop() {
+	close(s.stop)
+}
+
+func (s *Scheduler) loop(job ScheduledJob) {
+	ticker := time.NewTicker(job.Interval)
+	defer ticker.Stop()
+
+	s.runJob(job)
+	for {
+		select {
+		case <-ticker.C:
+			s.runJob(job)
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+func (s *Scheduler) runJob(job ScheduledJob) {
+	defer func() {
+		if r := recover(); r != nil {
+			logger.Error("Scheduled job panicked", zap.String("job", job.Name), zap.Any("panic", r))
+		}
+	}()
+
+	start := time.Now()
+	if err := job.Run(); err != nil {
+		logger.Error("Scheduled job failed", zap.String("job", job.Name), logger.ErrorField(err))
+		return
+	}
+	logger.Debug("Scheduled job completed", zap.String("job", job.Name), zap.Duration("duration", time.Since(start)))
+}
@@ -0,0 +1,223 @@
+package services
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+
+	"classmate-central/internal/database"
+	"classmate-central/internal/logger"
+	"classmate-central/internal/middleware"
+	"classmate-central/internal/models"
+	"classmate-central/internal/repository"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// SessionRetention is how long closed and expired sessions are kept for the session history
+const SessionRetention = 30 * 24 * time.Hour
+
+type SessionService struct {
+	sessionRepo *repository.SessionRepository
+}
+
+func NewSessionService(sessionRepo *repository.SessionRepository) *SessionService {
+	return &SessionService{sessionRepo: sessionRepo}
+}
+
+// hashToken returns the hex SHA-256 of a refresh token; only hashes are stored
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// Start opens a session for a fresh login and returns it with its first refresh token.
+// twoFactorVerified marks logins that already passed the second factor.
+func (s *SessionService) Start(userID int, companyID string, currentBranchID *string, userAgent, ip string, twoFactorVerified bool) (*models.UserSession, string, error) {
+	session := &models.UserSession{
+		ID:              uuid.New().String(),
+		UserID:          userID,
+		CompanyID:       companyID,
+		CurrentBranchID: currentBranchID,
+		UserAgent:       userAgent,
+		IP:              ip,
+		ExpiresAt:       time.Now().Add(middleware.RefreshTokenTTL()),
+	}
+	if twoFactorVerified {
+		now := time.Now()
+		session.TwoFactorVerifiedAt = &now
+	}
+
+	refreshToken, err := middleware.GenerateRefreshToken(userID, session.ID)
+	if err != nil {
+		return nil, "", err
+	}
+	if err := s.sessionRepo.Create(session, hashToken(refreshToken)); err != nil {
+		return nil, "", err
+	}
+
+	session.Device = DeviceName(userAgent)
+	return session, refreshToken, nil
+}
+
+// StartImpersonation opens a session in which a platform admin (actor.UserID) acts as a user of
+// actor.CompanyID, and records it in the company's audit log. The session has no refresh token
+// and ends after ImpersonationTTL.
+func (s *SessionService) StartImpersonation(actor database.Actor, userID int, userAgent, reason string) (*models.UserSession, error) {
+	impersonatedBy := actor.UserID
+	session := &models.UserSession{
+		ID:                  uuid.New().String(),
+		UserID:              userID,
+		CompanyID:           actor.CompanyID,
+		UserAgent:           userAgent,
+		IP:                  actor.IP,
+		ExpiresAt:           time.Now().Add(middleware.ImpersonationTTL()),
+		ImpersonatedBy:      &impersonatedBy,
+		ImpersonationReason: &reason,
+	}
+	if err := s.sessionRepo.CreateImpersonation(session, actor); err != nil {
+		return nil, err
+	}
+
+	session.Device = DeviceName(userAgent)
+	return session, nil
+}
+
+// Refresh rotates a refresh token. A token that was already rotated revokes its session
+// and yields repository.ErrRefreshTokenReused.
+func (s *SessionService) Refresh(refreshToken, ip string) (*models.UserSession, string, error) {
+	claims, err := middleware.ValidateRefreshToken(refreshToken)
+	if err != nil {
+		return nil, "", repository.ErrRefreshTokenInvalid
+	}
+
+	newToken, err := middleware.GenerateRefreshToken(claims.UserID, claims.SessionID)
+	if err != nil {
+		return nil, "", err
+	}
+
+	session, err := s.sessionRepo.Rotate(hashToken(refreshToken), hashToken(newToken), time.Now().Add(middleware.RefreshTokenTTL()), ip)
+	if errors.Is(err, repository.ErrRefreshTokenReused) {
+		logger.Warn("Refresh token reuse detected, session revoked",
+			zap.String("sessionId", session.ID), zap.Int("userId", session.UserID), zap.String("ip", ip))
+		return nil, "", err
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	if session.ID != claims.SessionID || session.UserID != claims.UserID {
+		return nil, "", repository.ErrRefreshTokenInvalid
+	}
+
+	session.Device = DeviceName(session.UserAgent)
+	return session, newToken, nil
+}
+
+// SwitchBranch stores the new current branch on the session and issues a replacement refresh token
+func (s *SessionService) SwitchBranch(sessionID string, userID int, branchID string) (string, error) {
+	refreshToken, err := middleware.GenerateRefreshToken(userID, sessionID)
+	if err != nil {
+		return "", err
+	}
+	expiresAt := time.Now().Add(middleware.RefreshTokenTTL())
+	if err := s.sessionRepo.SwitchBranch(sessionID, userID, branchID, hashToken(refreshToken), expiresAt); err != nil {
+		return "", err
+	}
+	return refreshToken, nil
+}
+
+// SwitchImpersonationBranch stores the new current branch on an impersonation session and
+// returns when the session expires. Impersonation sessions get no refresh token.
+func (s *SessionService) SwitchImpersonationBranch(sessionID string, userID int, branchID string) (time.Time, error) {
+	return s.sessionRepo.SwitchImpersonationBranch(sessionID, userID, branchID)
+}
+
+// MarkTwoFactorVerified records a step-up confirmation of the second factor on a session
+func (s *SessionService) MarkTwoFactorVerified(sessionID string, userID int) error {
+	return s.sessionRepo.MarkTwoFactorVerified(sessionID, userID)
+}
+
+// List returns the active sessions of a user and marks the one making the request
+func (s *SessionService) List(userID int, companyID, currentSessionID string) ([]*models.UserSession, error) {
+	sessions, err := s.sessionRepo.ListActive(userID, companyID)
+	if err != nil {
+		return nil, err
+	}
+	for _, session := range sessions {
+		session.Device = DeviceName(session.UserAgent)
+		session.Current = session.ID == currentSessionID
+	}
+	return sessions, nil
+}
+
+// Revoke closes one session of a user
+func (s *SessionService) Revoke(sessionID string, userID int, companyID, reason string) error {
+	return s.sessionRepo.Revoke(sessionID, userID, companyID, reason)
+}
+
+// RevokeAll closes every session of a user except exceptID (pass "" to close all)
+func (s *SessionService) RevokeAll(userID int, companyID, exceptID, reason string) (int64, error) {
+	return s.sessionRepo.RevokeAllForUser(userID, companyID, exceptID, reason)
+}
+
+// CleanupExpired deletes sessions closed or expired longer than SessionRetention ago
+func (s *SessionService) CleanupExpired() error {
+	deleted, err := s.sessionRepo.DeleteExpired(time.Now().Add(-SessionRetention))
+	if err != nil {
+		return err
+	}
+	if deleted > 0 {
+		logger.Info("Expired sessions deleted", zap.Int64("count", deleted))
+	}
+	return nil
+}
+
+// DeviceName summarises a User-Agent header as "Browser on OS" for the session list
+func DeviceName(userAgent string) string {
+	if userAgent == "" {
+		return "Unknown device"
+	}
+
+	browser := ""
+	for _, candidate := range []struct{ token, name string }{
+		{"Edg/", "Edge"},
+		{"OPR/", "Opera"},
+		{"YaBrowser/", "Yandex Browser"},
+		{"Firefox/", "Firefox"},
+		{"Chrome/", "Chrome"},
+		{"Safari/", "Safari"},
+	} {
+		if strings.Contains(userAgent, candidate.token) {
+			browser = candidate.name
+			break
+		}
+	}
+
+	os := ""
+	for _, candidate := range []struct{ token, name string }{
+		{"Android", "Android"},
+		{"iPhone", "iOS"},
+		{"iPad", "iPadOS"},
+		{"Windows", "Windows"},
+		{"Mac OS X", "macOS"},
+		{"Linux", "Linux"},
+	} {
+		if strings.Contains(userAgent, candidate.token) {
+			os = candidate.name
+			break
+		}
+	}
+
+	switch {
+	case browser != "" && os != "":
+		return browser + " on " + os
+	case browser != "":
+		return browser
+	case os != "":
+		return os
+	}
+	return userAgent
+}
@@ -0,0 +1,98 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"classmate-central/internal/middleware"
+	"classmate-central/internal/repository"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestRefreshRejectsNonRefreshTokens(t *testing.T) {
+	t.Setenv("JWT_SECRET", "test-secret")
+	// Rejected before the repository is touched, so no database is needed
+	service := NewSessionService(nil)
+
+	access, err := middleware.GenerateToken(1, "user@example.com", "session-1", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Token issued before sessions existed: no typ and no sid
+	legacy := jwt.NewWithClaims(jwt.SigningMethodHS256, &middleware.Claims{
+		UserID: 1,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+		},
+	})
+	legacyToken, err := legacy.SignedString([]byte("test-secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, token := range map[string]string{"access": access, "legacy": legacyToken, "garbage": "not-a-jwt"} {
+		if _, _, err := service.Refresh(token, "127.0.0.1"); err != repository.ErrRefreshTokenInvalid {
+			t.Errorf("%s token: expected ErrRefreshTokenInvalid, got %v", name, err)
+		}
+	}
+}
+
+func TestTokenTypesAreNotInterchangeable(t *testing.T) {
+	t.Setenv("JWT_SECRET", "test-secret")
+
+	refresh, err := middleware.GenerateRefreshToken(7, "session-7")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := middleware.ValidateAccessToken(refresh); err == nil {
+		t.Error("refresh token accepted as access token")
+	}
+	claims, err := middleware.ValidateRefreshToken(refresh)
+	if err != nil {
+		t.Fatalf("refresh token rejected: %v", err)
+	}
+	if claims.UserID != 7 || claims.SessionID != "session-7" || claims.ID == "" {
+		t.Errorf("unexpected claims %+v", claims)
+	}
+
+	// Two refresh tokens issued in the same second must still hash differently
+	again, err := middleware.GenerateRefreshToken(7, "session-7")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hashToken(refresh) == hashToken(again) {
+		t.Error("refresh tokens are not unique")
+	}
+}
+
+func TestTokenLifetimesFromEnv(t *testing.T) {
+	t.Setenv("JWT_EXPIRATION", "")
+	if got := middleware.AccessTokenTTL(); got != 15*time.Minute {
+		t.Errorf("default access TTL = %v", got)
+	}
+	t.Setenv("JWT_EXPIRATION", "5m")
+	if got := middleware.AccessTokenTTL(); got != 5*time.Minute {
+		t.Errorf("access TTL = %v, want 5m", got)
+	}
+	t.Setenv("JWT_REFRESH_EXPIRATION", "bogus")
+	if got := middleware.RefreshTokenTTL(); got != 7*24*time.Hour {
+		t.Errorf("invalid refresh TTL should fall back to default, got %v", got)
+	}
+}
+
+func TestDeviceName(t *testing.T) {
+	cases := map[string]string{
+		"": "Unknown device",
+		"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0 Safari/537.36":               "Chrome on Windows",
+		"Mozilla/5.0 (iPhone; CPU iPhone OS 17_0 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.0 Safari/604.1": "Safari on iOS",
+		"Mozilla/5.0 (X11; Linux x86_64; rv:121.0) Gecko/20100101 Firefox/121.0":                                                    "Firefox on Linux",
+		"curl/8.4.0": "curl/8.4.0",
+	}
+	for ua, want := range cases {
+		if got := DeviceName(ua); got != want {
+			t.Errorf("DeviceName(%q) = %q, want %q", ua, got, want)
+		}
+	}
+}
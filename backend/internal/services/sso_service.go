@@ -0,0 +1,512 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"classmate-central/internal/database"
+	"classmate-central/internal/logger"
+	"classmate-central/internal/models"
+	"classmate-central/internal/oidc"
+	"classmate-central/internal/repository"
+	"classmate-central/internal/totp"
+
+	"go.uber.org/zap"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	// SSOLoginStateTTL is how long a user has to finish signing in at the provider
+	SSOLoginStateTTL = 10 * time.Minute
+	// SSOLoginCodeTTL is how long the one-time code handed to the frontend after SSO works
+	SSOLoginCodeTTL = time.Minute
+
+	ssoProviderCacheTTL = time.Hour
+)
+
+var (
+	// ErrSSONotConfigured is returned when the company has no enabled SSO provider
+	ErrSSONotConfigured = errors.New("single sign-on is not configured")
+	// ErrSSOLoginInvalid is returned for unknown or expired sign-in states and login codes
+	ErrSSOLoginInvalid = errors.New("single sign-on request is invalid or has expired")
+	// ErrSSOEmailNotVerified is returned when the provider does not vouch for the email
+	ErrSSOEmailNotVerified = errors.New("the provider did not confirm a verified email")
+	// ErrSSODomainNotAllowed is returned for emails outside the allowed domains of the company
+	ErrSSODomainNotAllowed = errors.New("email domain is not allowed for single sign-on")
+	// ErrSSOAccountInOtherCompany is returned when the email or identity belongs to another company
+	ErrSSOAccountInOtherCompany = errors.New("account belongs to another company")
+	// ErrSSOProvisioningDisabled is returned for unknown users when no default role and branch are set
+	ErrSSOProvisioningDisabled = errors.New("account does not exist and automatic provisioning is disabled")
+	// ErrSSODomainTaken is returned when another company already signs in users of a domain
+	ErrSSODomainTaken = errors.New("domain is already used for single sign-on by another company")
+	// ErrSSOInvalidConfig is returned for configurations that cannot work
+	ErrSSOInvalidConfig = errors.New("invalid single sign-on configuration")
+)
+
+type cachedProvider struct {
+	provider  *oidc.Provider
+	fetchedAt time.Time
+}
+
+// SSOService signs users in through the OpenID Connect provider of their company and
+// provisions accounts just in time
+type SSOService struct {
+	repo       *repository.SSORepository
+	userRepo   *repository.UserRepository
+	roleRepo   *repository.RoleRepository
+	branchRepo *repository.BranchRepository
+	tokenRepo  *repository.AccountTokenRepository
+	plans      *PlanService
+	sealer     *totp.Sealer
+	httpClient *http.Client
+	callback   string
+
+	mu        sync.Mutex
+	providers map[string]cachedProvider
+}
+
+func NewSSOService(repo *repository.SSORepository, userRepo *repository.UserRepository, roleRepo *repository.RoleRepository, branchRepo *repository.BranchRepository, tokenRepo *repository.AccountTokenRepository, plans *PlanService) *SSOService {
+	key := os.Getenv("SSO_ENCRYPTION_KEY")
+	if key == "" {
+		key = os.Getenv("JWT_SECRET")
+	}
+	// Cannot fail: the key is always a 32 byte SHA-256 digest
+	sealer, _ := totp.NewSealer(key)
+	return &SSOService{
+		repo:       repo,
+		userRepo:   userRepo,
+		roleRepo:   roleRepo,
+		branchRepo: branchRepo,
+		tokenRepo:  tokenRepo,
+		plans:      plans,
+		sealer:     sealer,
+		httpClient: &http.Client{Timeout: 10 * time.Second},
+		callback:   ssoCallbackURL(),
+		providers:  make(map[string]cachedProvider),
+	}
+}
+
+// ssoCallbackURL is the redirect URI registered at the providers (SSO_CALLBACK_URL)
+func ssoCallbackURL() string {
+	if callback := os.Getenv("SSO_CALLBACK_URL"); callback != "" {
+		return callback
+	}
+	port := os.Getenv("SERVER_PORT")
+	if port == "" {
+		port = "8080"
+	}
+	return "http://localhost:" + port + "/api/auth/sso/callback"
+}
+
+// normalizeDomains lowercases the domains, strips a leading "@" and drops blanks and duplicates
+func normalizeDomains(domains []string) []string {
+	seen := make(map[string]bool, len(domains))
+	normalized := make([]string, 0, len(domains))
+	for _, domain := range domains {
+		domain = strings.TrimPrefix(strings.ToLower(strings.TrimSpace(domain)), "@")
+		if domain == "" || seen[domain] {
+			continue
+		}
+		seen[domain] = true
+		normalized = append(normalized, domain)
+	}
+	return normalized
+}
+
+// emailDomain returns the lowercased domain of an email address, "" if there is none
+func emailDomain(email string) string {
+	at := strings.LastIndex(email, "@")
+	if at < 0 || at == len(email)-1 {
+		return ""
+	}
+	return strings.ToLower(strings.TrimSpace(email[at+1:]))
+}
+
+// domainAllowed reports whether the email belongs to one of the domains
+func domainAllowed(email string, domains []string) bool {
+	domain := emailDomain(email)
+	if domain == "" {
+		return false
+	}
+	for _, allowed := range domains {
+		if domain == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+// GetConfig returns the SSO configuration of the company, nil if there is none
+func (s *SSOService) GetConfig(companyID string) (*models.SSOConfig, error) {
+	return s.repo.GetConfig(companyID)
+}
+
+// SaveConfig validates and stores the SSO configuration of the company. The issuer must be a
+// reachable OpenID provider; an empty client secret keeps the stored one.
+func (s *SSOService) SaveConfig(ctx context.Context, companyID string, req *models.SSOConfigRequest) (*models.SSOConfig, error) {
+	existing, err := s.repo.GetConfig(companyID)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := &models.SSOConfig{
+		CompanyID:       companyID,
+		Issuer:          strings.TrimSuffix(strings.TrimSpace(req.Issuer), "/"),
+		ClientID:        strings.TrimSpace(req.ClientID),
+		AllowedDomains:  normalizeDomains(req.AllowedDomains),
+		DefaultRoleID:   req.DefaultRoleID,
+		DefaultBranchID: req.DefaultBranchID,
+		Enabled:         req.Enabled,
+	}
+	if len(cfg.AllowedDomains) == 0 {
+		return nil, fmt.Errorf("%w: at least one allowed domain is required", ErrSSOInvalidConfig)
+	}
+	claimed, err := s.repo.DomainsClaimedByOthers(companyID, cfg.AllowedDomains)
+	if err != nil {
+		return nil, err
+	}
+	if len(claimed) > 0 {
+		return nil, fmt.Errorf("%w: %s", ErrSSODomainTaken, strings.Join(claimed, ", "))
+	}
+
+	if cfg.DefaultRoleID != nil {
+		role, err := s.roleRepo.GetByID(*cfg.DefaultRoleID, companyID)
+		if err != nil {
+			return nil, err
+		}
+		if role == nil {
+			return nil, fmt.Errorf("%w: default role not found", ErrSSOInvalidConfig)
+		}
+	}
+	if cfg.DefaultBranchID != nil {
+		branch, err := s.branchRepo.GetBranchByID(*cfg.DefaultBranchID, companyID)
+		if err != nil {
+			return nil, err
+		}
+		if branch == nil {
+			return nil, fmt.Errorf("%w: default branch not found", ErrSSOInvalidConfig)
+		}
+	}
+
+	switch {
+	case req.ClientSecret != "":
+		if cfg.ClientSecret, err = s.sealer.Seal(req.ClientSecret); err != nil {
+			return nil, err
+		}
+	case existing != nil:
+		cfg.ClientSecret = existing.ClientSecret
+	default:
+		return nil, fmt.Errorf("%w: client secret is required", ErrSSOInvalidConfig)
+	}
+
+	if _, err := oidc.Discover(ctx, s.httpClient, cfg.Issuer); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrSSOInvalidConfig, err)
+	}
+	if err := s.repo.SaveConfig(cfg); err != nil {
+		return nil, err
+	}
+	s.forgetProvider(cfg.Issuer)
+	if existing != nil {
+		s.forgetProvider(existing.Issuer)
+	}
+	logger.Info("SSO configuration saved", zap.String("companyId", companyID), zap.String("issuer", cfg.Issuer),
+		zap.Strings("domains", cfg.AllowedDomains), zap.Bool("enabled", cfg.Enabled))
+	return cfg, nil
+}
+
+// DeleteConfig turns SSO off for the company; sql.ErrNoRows if it was not configured
+func (s *SSOService) DeleteConfig(companyID string) error {
+	return s.repo.DeleteConfig(companyID)
+}
+
+// CompanyForEmail returns the company whose SSO signs in the email, "" if none does
+func (s *SSOService) CompanyForEmail(email string) (string, error) {
+	domain := emailDomain(email)
+	if domain == "" {
+		return "", nil
+	}
+	cfg, err := s.repo.GetEnabledConfigByDomain(domain)
+	if err != nil || cfg == nil {
+		return "", err
+	}
+	return cfg.CompanyID, nil
+}
+
+// enabledConfig returns the enabled SSO configuration of the company and its provider
+func (s *SSOService) enabledConfig(ctx context.Context, companyID string) (*models.SSOConfig, *oidc.Provider, oidc.Config, error) {
+	cfg, err := s.repo.GetConfig(companyID)
+	if err != nil {
+		return nil, nil, oidc.Config{}, err
+	}
+	if cfg == nil || !cfg.Enabled {
+		return nil, nil, oidc.Config{}, ErrSSONotConfigured
+	}
+	secret, err := s.sealer.Open(cfg.ClientSecret)
+	if err != nil {
+		return nil, nil, oidc.Config{}, fmt.Errorf("error decrypting SSO client secret: %w", err)
+	}
+	provider, err := s.provider(ctx, cfg.Issuer)
+	if err != nil {
+		return nil, nil, oidc.Config{}, err
+	}
+	return cfg, provider, oidc.Config{ClientID: cfg.ClientID, ClientSecret: secret, RedirectURL: s.callback}, nil
+}
+
+// provider returns the discovered provider of an issuer; discovery results and signing keys
+// are cached for ssoProviderCacheTTL
+func (s *SSOService) provider(ctx context.Context, issuer string) (*oidc.Provider, error) {
+	s.mu.Lock()
+	cached, ok := s.providers[issuer]
+	s.mu.Unlock()
+	if ok && time.Since(cached.fetchedAt) < ssoProviderCacheTTL {
+		return cached.provider, nil
+	}
+
+	provider, err := oidc.Discover(ctx, s.httpClient, issuer)
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	s.providers[issuer] = cachedProvider{provider: provider, fetchedAt: time.Now()}
+	s.mu.Unlock()
+	return provider, nil
+}
+
+func (s *SSOService) forgetProvider(issuer string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.providers, issuer)
+}
+
+// Start begins a sign-in at the company's provider and returns the URL to send the browser to
+func (s *SSOService) Start(ctx context.Context, companyID string) (string, error) {
+	_, provider, clientCfg, err := s.enabledConfig(ctx, companyID)
+	if err != nil {
+		return "", err
+	}
+
+	state, err := oidc.NewState()
+	if err != nil {
+		return "", err
+	}
+	nonce, err := oidc.NewState()
+	if err != nil {
+		return "", err
+	}
+	verifier, err := oidc.NewCodeVerifier()
+	if err != nil {
+		return "", err
+	}
+	err = s.repo.CreateLoginState(hashToken(state), &models.SSOLoginState{
+		CompanyID:    companyID,
+		Nonce:        nonce,
+		CodeVerifier: verifier,
+		ExpiresAt:    time.Now().Add(SSOLoginStateTTL),
+	})
+	if err != nil {
+		return "", err
+	}
+	return provider.AuthCodeURL(clientCfg, state, nonce, verifier), nil
+}
+
+// Callback finishes a sign-in with the code the provider redirected back with and returns the
+// signed-in user, linking or provisioning the account as needed
+func (s *SSOService) Callback(ctx context.Context, state, code string) (*models.User, error) {
+	loginState, err := s.repo.ConsumeLoginState(hashToken(state))
+	if err != nil {
+		return nil, err
+	}
+	if loginState == nil {
+		return nil, ErrSSOLoginInvalid
+	}
+
+	cfg, provider, clientCfg, err := s.enabledConfig(ctx, loginState.CompanyID)
+	if err != nil {
+		return nil, err
+	}
+	rawIDToken, err := provider.Exchange(ctx, clientCfg, code, loginState.CodeVerifier)
+	if err != nil {
+		return nil, err
+	}
+	claims, err := provider.VerifyIDToken(ctx, clientCfg, rawIDToken, loginState.Nonce)
+	if err != nil {
+		return nil, err
+	}
+
+	if claims.Email == "" || !claims.EmailVerified {
+		return nil, ErrSSOEmailNotVerified
+	}
+	if !domainAllowed(claims.Email, cfg.AllowedDomains) {
+		logger.Warn("SSO login from a domain that is not allowed",
+			zap.String("companyId", cfg.CompanyID), zap.String("domain", emailDomain(claims.Email)))
+		return nil, ErrSSODomainNotAllowed
+	}
+	return s.resolveUser(cfg, provider.Issuer, claims)
+}
+
+// resolveUser finds the user of a provider account: by a linked identity, else by verified
+// email within the company, else by creating one with the default role and branch
+func (s *SSOService) resolveUser(cfg *models.SSOConfig, issuer string, claims *oidc.Claims) (*models.User, error) {
+	identity, err := s.repo.GetIdentity(issuer, claims.Subject)
+	if err != nil {
+		return nil, err
+	}
+	if identity != nil {
+		if identity.CompanyID != cfg.CompanyID {
+			return nil, ErrSSOAccountInOtherCompany
+		}
+		user, err := s.userRepo.GetByID(identity.UserID)
+		if err != nil {
+			return nil, err
+		}
+		if user == nil || user.CompanyID != cfg.CompanyID {
+			return nil, ErrSSOAccountInOtherCompany
+		}
+		if err := s.repo.TouchIdentity(identity.ID, claims.Email); err != nil {
+			return nil, err
+		}
+		return user, nil
+	}
+
+	user, err := s.userRepo.GetByEmail(claims.Email)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		// Emails are stored as typed, the provider may report another case
+		user, err = s.userRepo.GetByEmail(strings.ToLower(claims.Email))
+		if err != nil {
+			return nil, err
+		}
+	}
+	if user != nil {
+		if user.CompanyID != cfg.CompanyID {
+			return nil, ErrSSOAccountInOtherCompany
+		}
+		if err := s.userRepo.MarkEmailVerified(user.ID); err != nil {
+			return nil, err
+		}
+		logger.Info("SSO identity linked to existing user", zap.Int("userId", user.ID), zap.String("companyId", cfg.CompanyID))
+	} else {
+		if user, err = s.provisionUser(cfg, claims); err != nil {
+			return nil, err
+		}
+	}
+
+	err = s.repo.CreateIdentity(&models.UserIdentity{
+		UserID:    user.ID,
+		CompanyID: cfg.CompanyID,
+		Issuer:    issuer,
+		Subject:   claims.Subject,
+		Email:     claims.Email,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// provisionUser creates the account of a first-time SSO user with the default role and branch.
+// The account gets a random password: it signs in through SSO or after a password reset.
+// Like an invite, it counts against the users limit of the company's plan.
+func (s *SSOService) provisionUser(cfg *models.SSOConfig, claims *oidc.Claims) (*models.User, error) {
+	if cfg.DefaultRoleID == nil || cfg.DefaultBranchID == nil {
+		return nil, ErrSSOProvisioningDisabled
+	}
+	if err := s.plans.CheckLimit(cfg.CompanyID, models.PlanResourceUsers); err != nil {
+		return nil, err
+	}
+
+	randomPassword := make([]byte, 32)
+	if _, err := rand.Read(randomPassword); err != nil {
+		return nil, err
+	}
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(hex.EncodeToString(randomPassword)), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, err
+	}
+
+	name := strings.TrimSpace(claims.Name)
+	if name == "" {
+		name = claims.Email[:strings.LastIndex(claims.Email, "@")]
+	}
+	user := &models.User{
+		Email:           claims.Email,
+		Password:        string(hashedPassword),
+		Name:            name,
+		CompanyID:       cfg.CompanyID,
+		RoleID:          cfg.DefaultRoleID,
+		IsEmailVerified: true,
+	}
+	if err := s.userRepo.Create(user); err != nil {
+		return nil, err
+	}
+	actor := database.Actor{CompanyID: cfg.CompanyID}
+	if err := s.userRepo.AssignRoleToUser(user.ID, *cfg.DefaultRoleID, nil, actor); err != nil {
+		return nil, err
+	}
+	if err := s.branchRepo.AssignUserToBranch(user.ID, *cfg.DefaultBranchID, cfg.DefaultRoleID, nil, actor); err != nil {
+		return nil, err
+	}
+	logger.Info("User provisioned through SSO", zap.Int("userId", user.ID), zap.String("companyId", cfg.CompanyID),
+		zap.String("roleId", *cfg.DefaultRoleID), zap.String("branchId", *cfg.DefaultBranchID))
+	return user, nil
+}
+
+// IssueLoginCode returns a one-time code the frontend trades for a session after the redirect
+func (s *SSOService) IssueLoginCode(userID int) (string, error) {
+	code, err := newAccountToken()
+	if err != nil {
+		return "", err
+	}
+	if err := s.tokenRepo.Create(hashToken(code), userID, repository.AccountTokenSSOLogin, nil, time.Now().Add(SSOLoginCodeTTL)); err != nil {
+		return "", err
+	}
+	return code, nil
+}
+
+// RedeemLoginCode consumes a login code and returns its user
+func (s *SSOService) RedeemLoginCode(code string) (*models.User, error) {
+	token, err := s.tokenRepo.Consume(hashToken(code), repository.AccountTokenSSOLogin)
+	if err != nil {
+		return nil, err
+	}
+	if token == nil {
+		return nil, ErrSSOLoginInvalid
+	}
+	user, err := s.userRepo.GetByID(token.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, ErrSSOLoginInvalid
+	}
+	return user, nil
+}
+
+// FrontendCallbackURL is the page of the frontend that finishes an SSO sign-in, with the login
+// code or an error code
+func FrontendCallbackURL(params url.Values) string {
+	return frontendURL() + "/sso/callback?" + params.Encode()
+}
+
+// CleanupExpiredStates deletes sign-ins that were started but never finished
+func (s *SSOService) CleanupExpiredStates() error {
+	deleted, err := s.repo.DeleteExpiredLoginStates(time.Now())
+	if err != nil {
+		return err
+	}
+	if deleted > 0 {
+		logger.Info("Expired SSO login states deleted", zap.Int64("count", deleted))
+	}
+	return nil
+}
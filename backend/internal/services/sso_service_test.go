@@ -0,0 +1,31 @@
+package services
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNormalizeDomains(t *testing.T) {
+	got := normalizeDomains([]string{" Example.com ", "@example.com", "", "school.example.org"})
+	want := []string{"example.com", "school.example.org"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("normalizeDomains = %v, want %v", got, want)
+	}
+}
+
+func TestDomainAllowed(t *testing.T) {
+	domains := []string{"example.com"}
+	for email, want := range map[string]bool{
+		"anna@example.com":      true,
+		"Anna@EXAMPLE.com":      true,
+		"anna@sub.example.com":  false,
+		"anna@example.com.evil": false,
+		"anna@evil.com":         false,
+		"example.com":           false,
+		"anna@":                 false,
+	} {
+		if got := domainAllowed(email, domains); got != want {
+			t.Errorf("domainAllowed(%q) = %v, want %v", email, got, want)
+		}
+	}
+}
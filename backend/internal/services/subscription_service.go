@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"time"
 
+	"classmate-central/internal/database"
 	"classmate-central/internal/models"
 	"classmate-central/internal/repository"
 )
@@ -43,7 +44,7 @@ func (s *SubscriptionService) FreezeSubscription(
 	companyID string,
 ) (*models.StudentSubscription, error) {
 	// Start transaction
-	tx, err := s.db.Begin()
+	tx, err := database.Tenant(s.db, companyID).Begin()
 	if err != nil {
 		return nil, fmt.Errorf("error starting transaction: %w", err)
 	}
@@ -88,6 +89,7 @@ func (s *SubscriptionService) FreezeSubscription(
 		LEFT JOIN groups g ON l.group_id = g.id
 		LEFT JOIN enrollment e ON g.id = e.group_id
 		WHERE l.company_id = $1
+		  AND l.deleted_at IS NULL
 		  AND l.status != 'cancelled'
 		  AND l.start_time >= $2
 		  AND l.start_time <= $3
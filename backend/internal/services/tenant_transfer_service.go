@@ -0,0 +1,158 @@
+package services
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"time"
+
+	"classmate-central/internal/database"
+	"classmate-central/internal/logger"
+	"classmate-central/internal/models"
+	"classmate-central/internal/repository"
+	"classmate-central/internal/tenantarchive"
+
+	"go.uber.org/zap"
+)
+
+// ErrDryRunRequired is returned when an archive is applied without a recent valid dry run of it
+var ErrDryRunRequired = errors.New("run a dry run of this archive first")
+
+// ImportDryRunTTL is how long a valid dry run allows applying its archive
+const ImportDryRunTTL = time.Hour
+
+// TenantTransferService moves a company's data between installations as a versioned archive
+// (see package tenantarchive). An archive is always checked with a dry run before it is applied:
+// valid dry runs are recorded per company and archive checksum, and applying consumes one.
+type TenantTransferService struct {
+	repo        *repository.TenantTransferRepository
+	companyRepo *repository.CompanyRepository
+	planService *PlanService
+}
+
+func NewTenantTransferService(repo *repository.TenantTransferRepository, companyRepo *repository.CompanyRepository, planService *PlanService) *TenantTransferService {
+	return &TenantTransferService{repo: repo, companyRepo: companyRepo, planService: planService}
+}
+
+// Export builds the archive of a company's data and returns it with a file name for it
+func (s *TenantTransferService) Export(companyID string) ([]byte, string, error) {
+	company, err := s.companyRepo.GetByID(companyID)
+	if err != nil {
+		return nil, "", err
+	}
+	if company == nil {
+		return nil, "", fmt.Errorf("company %s not found", companyID)
+	}
+	schemaVersion, err := s.repo.SchemaVersion()
+	if err != nil {
+		return nil, "", err
+	}
+	names, tables, err := s.repo.Dump(companyID)
+	if err != nil {
+		return nil, "", err
+	}
+
+	now := time.Now().UTC()
+	var buf bytes.Buffer
+	w := tenantarchive.NewWriter(&buf, tenantarchive.Manifest{
+		ExportedAt:    now,
+		CompanyID:     companyID,
+		CompanyName:   company.Name,
+		SchemaVersion: schemaVersion,
+	})
+	for _, name := range names {
+		if err := w.AddTable(name, tables[name]); err != nil {
+			return nil, "", err
+		}
+	}
+	if err := w.Close(); err != nil {
+		return nil, "", err
+	}
+	return buf.Bytes(), "company_" + companyID + "_" + now.Format("20060102_150405") + ".zip", nil
+}
+
+// Import checks an archive and, unless it is a dry run, adds its data to the actor's company.
+// Applying requires the checksum returned by a valid dry run of the same archive in the same
+// company within ImportDryRunTTL; the dry run is used up even if the data changed since and the
+// apply reports errors. A damaged archive returns an error wrapping
+// tenantarchive.ErrInvalidArchive; problems with its data, including more students, branches or
+// users than the company's plan has room for, are returned in the report, and nothing is imported
+// when there are any.
+func (s *TenantTransferService) Import(actor database.Actor, data []byte, dryRun bool, checksum string) (*models.TenantImportReport, error) {
+	archive, err := tenantarchive.Read(data)
+	if err != nil {
+		return nil, err
+	}
+	if !dryRun {
+		if checksum != archive.Checksum {
+			return nil, ErrDryRunRequired
+		}
+		checked, err := s.repo.ConsumeDryRun(actor.CompanyID, archive.Checksum)
+		if err != nil {
+			return nil, err
+		}
+		if checked == nil {
+			return nil, ErrDryRunRequired
+		}
+	}
+
+	report := &models.TenantImportReport{
+		DryRun:        dryRun,
+		Checksum:      archive.Checksum,
+		SourceCompany: archive.Manifest.CompanyName,
+		SchemaVersion: archive.Manifest.SchemaVersion,
+		Rows:          map[string]int64{},
+		Warnings:      []string{},
+		Errors:        []string{},
+	}
+	schemaVersion, err := s.repo.SchemaVersion()
+	if err != nil {
+		return nil, err
+	}
+	if report.SchemaVersion != schemaVersion {
+		report.Warnings = append(report.Warnings, fmt.Sprintf("archive was exported at schema %s, this server is at %s", report.SchemaVersion, schemaVersion))
+	}
+	if archive.Manifest.CompanyID == actor.CompanyID {
+		report.Warnings = append(report.Warnings, "archive was exported from this company; importing it adds a second copy of its data")
+	}
+
+	allowed := map[string]int64{}
+	for _, resource := range []string{models.PlanResourceStudents, models.PlanResourceBranches, models.PlanResourceUsers} {
+		remaining, err := s.planService.Remaining(actor.CompanyID, resource)
+		if err != nil {
+			return nil, err
+		}
+		if remaining != nil {
+			allowed[resource] = *remaining
+		}
+	}
+
+	if err := s.repo.Import(archive.Tables, actor, dryRun, allowed, report); err != nil {
+		return nil, err
+	}
+	report.Valid = len(report.Errors) == 0
+	if dryRun && report.Valid {
+		if err := s.repo.SaveDryRun(actor, report, time.Now().Add(ImportDryRunTTL)); err != nil {
+			return nil, err
+		}
+	}
+	if !dryRun && report.Valid {
+		logger.Info("Company data imported",
+			zap.String("company_id", actor.CompanyID),
+			zap.String("source_company", report.SourceCompany),
+			zap.String("checksum", report.Checksum))
+	}
+	return report, nil
+}
+
+// CleanupExpiredDryRuns removes dry runs whose archive was not applied in time
+func (s *TenantTransferService) CleanupExpiredDryRuns() error {
+	deleted, err := s.repo.DeleteExpiredDryRuns()
+	if err != nil {
+		return err
+	}
+	if deleted > 0 {
+		logger.Info("Expired import dry runs deleted", zap.Int64("count", deleted))
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+package services
+
+import (
+	"os"
+	"strconv"
+	"time"
+
+	"classmate-central/internal/database"
+	"classmate-central/internal/logger"
+	"classmate-central/internal/models"
+	"classmate-central/internal/repository"
+
+	"go.uber.org/zap"
+)
+
+// DefaultTrashRetention is how long deleted records can be restored unless TRASH_RETENTION_DAYS says otherwise
+const DefaultTrashRetention = 30 * 24 * time.Hour
+
+type TrashService struct {
+	repo      *repository.TrashRepository
+	retention time.Duration
+}
+
+func NewTrashService(repo *repository.TrashRepository) *TrashService {
+	retention := DefaultTrashRetention
+	if days, err := strconv.Atoi(os.Getenv("TRASH_RETENTION_DAYS")); err == nil && days > 0 {
+		retention = time.Duration(days) * 24 * time.Hour
+	}
+	return &TrashService{repo: repo, retention: retention}
+}
+
+// List returns the company's deleted records that can still be restored. An empty entityType lists every type.
+func (s *TrashService) List(companyID, entityType string) ([]*models.TrashItem, error) {
+	items, err := s.repo.List(companyID, entityType, time.Now().Add(-s.retention))
+	if err != nil {
+		return nil, err
+	}
+	for _, item := range items {
+		item.RestorableUntil = item.DeletedAt.Add(s.retention)
+	}
+	return items, nil
+}
+
+// Restore brings back a deleted record of the actor's company. Returns sql.ErrNoRows when the
+// record is not in the trash or its restore period has passed.
+func (s *TrashService) Restore(entityType, id string, actor database.Actor) error {
+	return s.repo.Restore(entityType, id, time.Now().Add(-s.retention), actor)
+}
+
+// PurgeExpired permanently deletes records whose restore period has passed. Records that
+// financial history refers to stay hidden instead.
+func (s *TrashService) PurgeExpired() error {
+	purged, err := s.repo.Purge(time.Now().Add(-s.retention), "")
+	for entityType, count := range purged {
+		logger.Info("Deleted records purged", zap.String("type", entityType), zap.Int64("count", count))
+	}
+	return err
+}
+
+// PurgeCompanyExpired is PurgeExpired for one company. Returns the number of records purged by type.
+func (s *TrashService) PurgeCompanyExpired(companyID string) (map[string]int64, error) {
+	return s.repo.Purge(time.Now().Add(-s.retention), companyID)
+}
@@ -0,0 +1,368 @@
+package services
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"math/big"
+	"os"
+	"strings"
+	"time"
+
+	"classmate-central/internal/logger"
+	"classmate-central/internal/models"
+	"classmate-central/internal/repository"
+	"classmate-central/internal/totp"
+
+	"go.uber.org/zap"
+)
+
+const (
+	// TwoFactorChallengeTTL is how long the second step of a login may take
+	TwoFactorChallengeTTL = 5 * time.Minute
+	// TwoFactorChallengeAttempts is how many codes may be tried against one login challenge
+	TwoFactorChallengeAttempts = 5
+	// RecoveryCodeCount is the number of recovery codes issued at once
+	RecoveryCodeCount = 10
+
+	defaultTwoFactorIssuer = "Classmate Central"
+	recoveryCodeAlphabet   = "abcdefghjkmnpqrstuvwxyz23456789"
+	recoveryCodeLength     = 10
+)
+
+var (
+	// ErrTwoFactorNotSetUp is returned when enabling 2FA before a secret was generated
+	ErrTwoFactorNotSetUp = errors.New("two-factor authentication has not been set up")
+	// ErrTwoFactorNotEnabled is returned when 2FA is needed but the user has not enabled it
+	ErrTwoFactorNotEnabled = errors.New("two-factor authentication is not enabled")
+	// ErrTwoFactorAlreadyEnabled is returned when setting up 2FA that is already enabled
+	ErrTwoFactorAlreadyEnabled = errors.New("two-factor authentication is already enabled")
+	// ErrTwoFactorInvalidCode is returned for wrong, reused or missing codes
+	ErrTwoFactorInvalidCode = errors.New("invalid two-factor code")
+	// ErrTwoFactorChallengeInvalid is returned for unknown, expired, used or exhausted login challenges
+	ErrTwoFactorChallengeInvalid = errors.New("two-factor challenge is invalid or expired")
+)
+
+// TwoFactorLockedError is returned by Verify while codes are refused after too many invalid ones
+type TwoFactorLockedError struct {
+	Remaining time.Duration
+}
+
+func (e *TwoFactorLockedError) Error() string {
+	return "too many invalid two-factor codes"
+}
+
+type TwoFactorService struct {
+	repo   *repository.TwoFactorRepository
+	sealer *totp.Sealer
+	issuer string
+}
+
+// NewTwoFactorService encrypts TOTP secrets with TWO_FACTOR_ENCRYPTION_KEY, falling back
+// to JWT_SECRET. Changing the key makes existing enrollments unusable.
+func NewTwoFactorService(repo *repository.TwoFactorRepository) *TwoFactorService {
+	key := os.Getenv("TWO_FACTOR_ENCRYPTION_KEY")
+	if key == "" {
+		key = os.Getenv("JWT_SECRET")
+	}
+	issuer := os.Getenv("TWO_FACTOR_ISSUER")
+	if issuer == "" {
+		issuer = defaultTwoFactorIssuer
+	}
+	// Cannot fail: the key is always a 32 byte SHA-256 digest
+	sealer, _ := totp.NewSealer(key)
+	return &TwoFactorService{repo: repo, sealer: sealer, issuer: issuer}
+}
+
+// Status returns whether the user has 2FA enabled and how many recovery codes are left
+func (s *TwoFactorService) Status(userID int) (*models.TwoFactorStatus, error) {
+	status := &models.TwoFactorStatus{}
+	tf, err := s.repo.Get(userID)
+	if err != nil {
+		return nil, err
+	}
+	if tf == nil || tf.EnabledAt == nil {
+		return status, nil
+	}
+	status.Enabled = true
+	status.EnabledAt = tf.EnabledAt
+	status.RecoveryCodesRemaining, err = s.repo.CountRecoveryCodes(userID)
+	if err != nil {
+		return nil, err
+	}
+	return status, nil
+}
+
+// IsEnabled reports whether the user has confirmed a 2FA enrollment
+func (s *TwoFactorService) IsEnabled(userID int) (bool, error) {
+	tf, err := s.repo.Get(userID)
+	if err != nil {
+		return false, err
+	}
+	return tf != nil && tf.EnabledAt != nil, nil
+}
+
+// Setup generates a new secret for the authenticator app. 2FA is not active until Enable
+// confirms it with a code; calling Setup again replaces the pending secret.
+func (s *TwoFactorService) Setup(userID int, account string) (*models.TwoFactorSetupResponse, error) {
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return nil, err
+	}
+	sealed, err := s.sealer.Seal(secret)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.repo.SavePendingSecret(userID, sealed); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrTwoFactorAlreadyEnabled
+		}
+		return nil, err
+	}
+	return &models.TwoFactorSetupResponse{
+		Secret:          secret,
+		ProvisioningURI: totp.ProvisioningURI(s.issuer, account, secret),
+	}, nil
+}
+
+// Enable confirms the pending secret with a code from the app and returns the recovery codes
+func (s *TwoFactorService) Enable(userID int, code string) ([]string, error) {
+	tf, err := s.repo.Get(userID)
+	if err != nil {
+		return nil, err
+	}
+	if tf == nil {
+		return nil, ErrTwoFactorNotSetUp
+	}
+	if tf.EnabledAt != nil {
+		return nil, ErrTwoFactorAlreadyEnabled
+	}
+	secret, err := s.sealer.Open(tf.SecretEncrypted)
+	if err != nil {
+		return nil, err
+	}
+	step, ok := totp.Validate(secret, code, time.Now(), 0)
+	if !ok {
+		return nil, ErrTwoFactorInvalidCode
+	}
+
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.repo.Enable(userID, step, hashes); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrTwoFactorAlreadyEnabled
+		}
+		return nil, err
+	}
+	logger.Info("Two-factor authentication enabled", zap.Int("userId", userID))
+	return codes, nil
+}
+
+// Disable turns 2FA off after confirming it with a TOTP or recovery code
+func (s *TwoFactorService) Disable(userID int, code, recoveryCode string) error {
+	if err := s.Verify(userID, code, recoveryCode); err != nil {
+		return err
+	}
+	if err := s.repo.Delete(userID); err != nil {
+		return err
+	}
+	logger.Info("Two-factor authentication disabled", zap.Int("userId", userID))
+	return nil
+}
+
+// RegenerateRecoveryCodes replaces all recovery codes after confirming with a TOTP code
+func (s *TwoFactorService) RegenerateRecoveryCodes(userID int, code string) ([]string, error) {
+	if err := s.Verify(userID, code, ""); err != nil {
+		return nil, err
+	}
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.repo.ReplaceRecoveryCodes(userID, hashes); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// Verify checks a code of a signed-in user for step-up, disabling 2FA or new recovery codes.
+// Invalid codes lock further codes with the same backoff as failed logins, so a stolen
+// access token cannot be used to guess them.
+func (s *TwoFactorService) Verify(userID int, code, recoveryCode string) error {
+	tf, err := s.enabledTwoFactor(userID)
+	if err != nil {
+		return err
+	}
+	if tf.LockedUntil != nil {
+		if remaining := time.Until(*tf.LockedUntil); remaining > 0 {
+			return &TwoFactorLockedError{Remaining: remaining}
+		}
+	}
+
+	if err := s.checkCode(tf, code, recoveryCode); err != nil {
+		if errors.Is(err, ErrTwoFactorInvalidCode) {
+			return s.recordInvalidCode(userID)
+		}
+		return err
+	}
+	return s.repo.ResetFailedAttempts(userID)
+}
+
+// recordInvalidCode counts an invalid code and locks further codes once LockoutThreshold is reached
+func (s *TwoFactorService) recordInvalidCode(userID int) error {
+	failures, err := s.repo.RecordFailedAttempt(userID)
+	if err != nil {
+		return err
+	}
+	lockFor := LockoutDuration(failures)
+	if lockFor == 0 {
+		return ErrTwoFactorInvalidCode
+	}
+	if err := s.repo.LockUntil(userID, time.Now().Add(lockFor)); err != nil {
+		return err
+	}
+	logger.Warn("Two-factor codes locked after failed attempts",
+		zap.Int("userId", userID), zap.Int("failures", failures), zap.Duration("lockedFor", lockFor))
+	return &TwoFactorLockedError{Remaining: lockFor}
+}
+
+// enabledTwoFactor returns the enrollment of a user, or ErrTwoFactorNotEnabled
+func (s *TwoFactorService) enabledTwoFactor(userID int) (*models.UserTwoFactor, error) {
+	tf, err := s.repo.Get(userID)
+	if err != nil {
+		return nil, err
+	}
+	if tf == nil || tf.EnabledAt == nil {
+		return nil, ErrTwoFactorNotEnabled
+	}
+	return tf, nil
+}
+
+// checkCode checks a TOTP code or, if no code is given, a recovery code. Each TOTP code and
+// each recovery code is accepted only once.
+func (s *TwoFactorService) checkCode(tf *models.UserTwoFactor, code, recoveryCode string) error {
+	if code != "" {
+		secret, err := s.sealer.Open(tf.SecretEncrypted)
+		if err != nil {
+			return err
+		}
+		step, ok := totp.Validate(secret, code, time.Now(), tf.LastUsedStep)
+		if !ok {
+			return ErrTwoFactorInvalidCode
+		}
+		accepted, err := s.repo.AcceptStep(tf.UserID, step)
+		if err != nil {
+			return err
+		}
+		if !accepted {
+			return ErrTwoFactorInvalidCode
+		}
+		return nil
+	}
+
+	if normalized := normalizeRecoveryCode(recoveryCode); normalized != "" {
+		used, err := s.repo.UseRecoveryCode(tf.UserID, hashToken(normalized))
+		if err != nil {
+			return err
+		}
+		if !used {
+			return ErrTwoFactorInvalidCode
+		}
+		logger.Info("Two-factor recovery code used", zap.Int("userId", tf.UserID))
+		return nil
+	}
+	return ErrTwoFactorInvalidCode
+}
+
+// CreateChallenge starts the second step of a login and returns its token
+func (s *TwoFactorService) CreateChallenge(userID int, ip string) (string, time.Time, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", time.Time{}, err
+	}
+	token := hex.EncodeToString(buf)
+	expiresAt := time.Now().Add(TwoFactorChallengeTTL)
+	if err := s.repo.CreateChallenge(hashToken(token), userID, expiresAt, ip); err != nil {
+		return "", time.Time{}, err
+	}
+	return token, expiresAt, nil
+}
+
+// CompleteChallenge answers a login challenge and returns the user it was issued for.
+// A challenge can be answered once and allows TwoFactorChallengeAttempts tries. On
+// ErrTwoFactorInvalidCode the user is returned too, so the failure can count toward the
+// account lockout, which limits login codes instead of the lock Verify applies.
+func (s *TwoFactorService) CompleteChallenge(token, code, recoveryCode string) (int, error) {
+	tokenHash := hashToken(token)
+	challenge, err := s.repo.AttemptChallenge(tokenHash)
+	if err != nil {
+		return 0, err
+	}
+	if challenge == nil || challenge.ConsumedAt != nil || !challenge.ExpiresAt.After(time.Now()) ||
+		challenge.Attempts > TwoFactorChallengeAttempts {
+		return 0, ErrTwoFactorChallengeInvalid
+	}
+
+	tf, err := s.enabledTwoFactor(challenge.UserID)
+	if err != nil {
+		return 0, err
+	}
+	if err := s.checkCode(tf, code, recoveryCode); err != nil {
+		if errors.Is(err, ErrTwoFactorInvalidCode) {
+			logger.Warn("Invalid two-factor code at login",
+				zap.Int("userId", challenge.UserID), zap.Int("attempt", challenge.Attempts))
+			return challenge.UserID, err
+		}
+		return 0, err
+	}
+
+	consumed, err := s.repo.ConsumeChallenge(tokenHash)
+	if err != nil {
+		return 0, err
+	}
+	if !consumed {
+		return 0, ErrTwoFactorChallengeInvalid
+	}
+	return challenge.UserID, nil
+}
+
+// CleanupExpiredChallenges deletes login challenges that have expired
+func (s *TwoFactorService) CleanupExpiredChallenges() error {
+	deleted, err := s.repo.DeleteExpiredChallenges(time.Now())
+	if err != nil {
+		return err
+	}
+	if deleted > 0 {
+		logger.Info("Expired two-factor challenges deleted", zap.Int64("count", deleted))
+	}
+	return nil
+}
+
+// generateRecoveryCodes returns new recovery codes formatted for display and their hashes
+func generateRecoveryCodes() ([]string, []string, error) {
+	codes := make([]string, RecoveryCodeCount)
+	hashes := make([]string, RecoveryCodeCount)
+	max := big.NewInt(int64(len(recoveryCodeAlphabet)))
+	for i := range codes {
+		raw := make([]byte, recoveryCodeLength)
+		for j := range raw {
+			n, err := rand.Int(rand.Reader, max)
+			if err != nil {
+				return nil, nil, err
+			}
+			raw[j] = recoveryCodeAlphabet[n.Int64()]
+		}
+		half := recoveryCodeLength / 2
+		codes[i] = string(raw[:half]) + "-" + string(raw[half:])
+		hashes[i] = hashToken(string(raw))
+	}
+	return codes, hashes, nil
+}
+
+// normalizeRecoveryCode ignores case, spaces and dashes the way users type recovery codes
+func normalizeRecoveryCode(code string) string {
+	return strings.NewReplacer("-", "", " ", "").Replace(strings.ToLower(strings.TrimSpace(code)))
+}
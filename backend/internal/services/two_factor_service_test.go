@@ -0,0 +1,43 @@
+package services
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestGenerateRecoveryCodes(t *testing.T) {
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(codes) != RecoveryCodeCount || len(hashes) != RecoveryCodeCount {
+		t.Fatalf("got %d codes and %d hashes, want %d", len(codes), len(hashes), RecoveryCodeCount)
+	}
+
+	seen := map[string]bool{}
+	for i, code := range codes {
+		if len(code) != recoveryCodeLength+1 || code[recoveryCodeLength/2] != '-' {
+			t.Errorf("code %q is not formatted as xxxxx-xxxxx", code)
+		}
+		if seen[code] {
+			t.Errorf("duplicate code %q", code)
+		}
+		seen[code] = true
+		// Only the hash is stored; it must match what a user types back in any form
+		if got := hashToken(normalizeRecoveryCode(strings.ToUpper(code))); got != hashes[i] {
+			t.Errorf("hash of typed code %q does not match the stored hash", code)
+		}
+	}
+}
+
+func TestNormalizeRecoveryCode(t *testing.T) {
+	for input, want := range map[string]string{
+		"abcde-fghjk":   "abcdefghjk",
+		" ABCDE FGHJK ": "abcdefghjk",
+		"":              "",
+	} {
+		if got := normalizeRecoveryCode(input); got != want {
+			t.Errorf("normalizeRecoveryCode(%q) = %q, want %q", input, got, want)
+		}
+	}
+}
@@ -0,0 +1,239 @@
+// Package tenantarchive reads and writes the portable company data archive: a zip file with
+// manifest.json, one JSON Lines file per table (tables/<name>.jsonl) and SHA256SUMS. The
+// manifest carries the format version, the source schema version and a SHA-256 checksum and
+// row count for every table file.
+package tenantarchive
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+// FormatVersion is the archive format written by this version; Read accepts only this one
+const FormatVersion = 1
+
+const (
+	manifestFile  = "manifest.json"
+	checksumsFile = "SHA256SUMS"
+	tablesDir     = "tables/"
+)
+
+// ErrInvalidArchive is returned for an archive that is damaged, tampered with or not an archive at all
+var ErrInvalidArchive = errors.New("invalid company archive")
+
+// Manifest describes an archive
+type Manifest struct {
+	Format        int          `json:"format"`
+	ExportedAt    time.Time    `json:"exportedAt"`
+	CompanyID     string       `json:"companyId"`
+	CompanyName   string       `json:"companyName"`
+	SchemaVersion string       `json:"schemaVersion"` // last migration applied to the source database
+	Tables        []TableEntry `json:"tables"`
+}
+
+// TableEntry describes one table file
+type TableEntry struct {
+	Name   string `json:"name"`
+	File   string `json:"file"`
+	Rows   int    `json:"rows"`
+	SHA256 string `json:"sha256"`
+}
+
+// Archive is a verified archive
+type Archive struct {
+	Manifest Manifest
+	Tables   map[string][]json.RawMessage
+	// Checksum is the SHA-256 of the whole archive file
+	Checksum string
+}
+
+// Writer builds an archive. Tables are written in the order they are added.
+type Writer struct {
+	zw       *zip.Writer
+	manifest Manifest
+	sums     []string
+}
+
+func NewWriter(w io.Writer, manifest Manifest) *Writer {
+	manifest.Format = FormatVersion
+	manifest.Tables = nil
+	return &Writer{zw: zip.NewWriter(w), manifest: manifest}
+}
+
+// AddTable writes the rows of a table, one JSON object per line
+func (w *Writer) AddTable(name string, rows []json.RawMessage) error {
+	var buf bytes.Buffer
+	for _, row := range rows {
+		if err := json.Compact(&buf, row); err != nil {
+			return fmt.Errorf("error encoding %s row: %w", name, err)
+		}
+		buf.WriteByte('\n')
+	}
+
+	file := tablesDir + name + ".jsonl"
+	sum, err := w.writeFile(file, buf.Bytes())
+	if err != nil {
+		return err
+	}
+	w.manifest.Tables = append(w.manifest.Tables, TableEntry{Name: name, File: file, Rows: len(rows), SHA256: sum})
+	return nil
+}
+
+// Close writes the manifest and the checksums file and finishes the zip
+func (w *Writer) Close() error {
+	manifest, err := json.MarshalIndent(w.manifest, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error encoding manifest: %w", err)
+	}
+	if _, err := w.writeFile(manifestFile, manifest); err != nil {
+		return err
+	}
+
+	f, err := w.zw.Create(checksumsFile)
+	if err != nil {
+		return fmt.Errorf("error writing %s: %w", checksumsFile, err)
+	}
+	if _, err := io.WriteString(f, strings.Join(w.sums, "")); err != nil {
+		return fmt.Errorf("error writing %s: %w", checksumsFile, err)
+	}
+	return w.zw.Close()
+}
+
+func (w *Writer) writeFile(name string, data []byte) (string, error) {
+	f, err := w.zw.Create(name)
+	if err != nil {
+		return "", fmt.Errorf("error writing %s: %w", name, err)
+	}
+	if _, err := f.Write(data); err != nil {
+		return "", fmt.Errorf("error writing %s: %w", name, err)
+	}
+	sum := sha256Hex(data)
+	w.sums = append(w.sums, sum+"  "+name+"\n")
+	return sum, nil
+}
+
+// Read parses an archive and verifies its format and every checksum. Errors wrap ErrInvalidArchive.
+func Read(data []byte) (*Archive, error) {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidArchive, err)
+	}
+	files := map[string][]byte{}
+	for _, f := range zr.File {
+		content, err := readZipFile(f)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s: %v", ErrInvalidArchive, f.Name, err)
+		}
+		files[f.Name] = content
+	}
+
+	sums, err := parseChecksums(files[checksumsFile])
+	if err != nil {
+		return nil, err
+	}
+	for name, sum := range sums {
+		content, ok := files[name]
+		if !ok {
+			return nil, fmt.Errorf("%w: %s is listed in %s but missing", ErrInvalidArchive, name, checksumsFile)
+		}
+		if sha256Hex(content) != sum {
+			return nil, fmt.Errorf("%w: checksum mismatch for %s", ErrInvalidArchive, name)
+		}
+	}
+	if _, ok := sums[manifestFile]; !ok {
+		return nil, fmt.Errorf("%w: %s has no checksum", ErrInvalidArchive, manifestFile)
+	}
+
+	archive := &Archive{Tables: map[string][]json.RawMessage{}, Checksum: sha256Hex(data)}
+	if err := json.Unmarshal(files[manifestFile], &archive.Manifest); err != nil {
+		return nil, fmt.Errorf("%w: %s: %v", ErrInvalidArchive, manifestFile, err)
+	}
+	if archive.Manifest.Format != FormatVersion {
+		return nil, fmt.Errorf("%w: unsupported format %d", ErrInvalidArchive, archive.Manifest.Format)
+	}
+
+	for _, table := range archive.Manifest.Tables {
+		content, ok := files[table.File]
+		if !ok || sums[table.File] != table.SHA256 || sha256Hex(content) != table.SHA256 {
+			return nil, fmt.Errorf("%w: checksum mismatch for table %s", ErrInvalidArchive, table.Name)
+		}
+		if _, dup := archive.Tables[table.Name]; dup {
+			return nil, fmt.Errorf("%w: table %s appears twice", ErrInvalidArchive, table.Name)
+		}
+		rows, err := parseLines(content)
+		if err != nil {
+			return nil, fmt.Errorf("%w: table %s: %v", ErrInvalidArchive, table.Name, err)
+		}
+		if len(rows) != table.Rows {
+			return nil, fmt.Errorf("%w: table %s has %d rows, manifest says %d", ErrInvalidArchive, table.Name, len(rows), table.Rows)
+		}
+		archive.Tables[table.Name] = rows
+	}
+	return archive, nil
+}
+
+// TableNames returns the names of the tables in the archive, sorted
+func (a *Archive) TableNames() []string {
+	names := make([]string, 0, len(a.Tables))
+	for name := range a.Tables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func readZipFile(f *zip.File) ([]byte, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	return io.ReadAll(rc)
+}
+
+func parseChecksums(data []byte) (map[string]string, error) {
+	if data == nil {
+		return nil, fmt.Errorf("%w: %s is missing", ErrInvalidArchive, checksumsFile)
+	}
+	sums := map[string]string{}
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		sum, name, ok := strings.Cut(line, "  ")
+		if !ok || len(sum) != sha256.Size*2 {
+			return nil, fmt.Errorf("%w: malformed %s line %q", ErrInvalidArchive, checksumsFile, line)
+		}
+		sums[name] = sum
+	}
+	return sums, nil
+}
+
+func parseLines(data []byte) ([]json.RawMessage, error) {
+	rows := []json.RawMessage{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		text := bytes.TrimSpace(scanner.Bytes())
+		if len(text) == 0 {
+			continue
+		}
+		if !json.Valid(text) || text[0] != '{' {
+			return nil, fmt.Errorf("line %d is not a JSON object", line)
+		}
+		rows = append(rows, json.RawMessage(append([]byte(nil), text...)))
+	}
+	return rows, scanner.Err()
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,104 @@
+package tenantarchive
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func buildArchive(t *testing.T) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w := NewWriter(&buf, Manifest{ExportedAt: time.Unix(0, 0).UTC(), CompanyID: "c1", CompanyName: "Acme", SchemaVersion: "046_company_data_jobs"})
+	if err := w.AddTable("students", []json.RawMessage{json.RawMessage(`{"id": "s1", "name": "Ann"}`), json.RawMessage(`{"id":"s2","name":"Bob"}`)}); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.AddTable("rooms", nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestRoundTrip(t *testing.T) {
+	data := buildArchive(t)
+	archive, err := Read(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if archive.Manifest.Format != FormatVersion || archive.Manifest.CompanyName != "Acme" || archive.Manifest.SchemaVersion != "046_company_data_jobs" {
+		t.Errorf("unexpected manifest %+v", archive.Manifest)
+	}
+	if got := archive.TableNames(); strings.Join(got, ",") != "rooms,students" {
+		t.Errorf("TableNames = %v", got)
+	}
+	if len(archive.Tables["students"]) != 2 || string(archive.Tables["students"][0]) != `{"id":"s1","name":"Ann"}` {
+		t.Errorf("unexpected students %s", archive.Tables["students"])
+	}
+	if len(archive.Tables["rooms"]) != 0 {
+		t.Errorf("rooms should be empty")
+	}
+	if len(archive.Checksum) != 64 {
+		t.Errorf("Checksum = %q", archive.Checksum)
+	}
+}
+
+// rewrite copies an archive, letting edit change the content of each file
+func rewrite(t *testing.T, data []byte, edit func(name string, content []byte) []byte) []byte {
+	t.Helper()
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, f := range zr.File {
+		rc, _ := f.Open()
+		content, _ := io.ReadAll(rc)
+		rc.Close()
+		if content = edit(f.Name, content); content == nil {
+			continue
+		}
+		out, _ := zw.Create(f.Name)
+		out.Write(content)
+	}
+	zw.Close()
+	return buf.Bytes()
+}
+
+func TestReadRejectsDamagedArchives(t *testing.T) {
+	data := buildArchive(t)
+	cases := map[string][]byte{
+		"not a zip": []byte("hello"),
+		"tampered table": rewrite(t, data, func(name string, content []byte) []byte {
+			if name == "tables/students.jsonl" {
+				return bytes.Replace(content, []byte("Ann"), []byte("Eve"), 1)
+			}
+			return content
+		}),
+		"tampered manifest": rewrite(t, data, func(name string, content []byte) []byte {
+			if name == manifestFile {
+				return bytes.Replace(content, []byte("Acme"), []byte("Evil"), 1)
+			}
+			return content
+		}),
+		"missing checksums": rewrite(t, data, func(name string, content []byte) []byte {
+			if name == checksumsFile {
+				return nil
+			}
+			return content
+		}),
+	}
+	for name, archive := range cases {
+		if _, err := Read(archive); !errors.Is(err, ErrInvalidArchive) {
+			t.Errorf("%s: err = %v, want ErrInvalidArchive", name, err)
+		}
+	}
+}
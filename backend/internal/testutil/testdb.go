@@ -62,8 +62,15 @@ func CleanupTestDB(t *testing.T, db *sql.DB) {
 		"teachers",
 		"leads",
 		"rooms",
+		"fiscal_receipts",
+		"payment_intents",
+		"installments",
+		"installment_plans",
+		"debt_payments",
 		"debt_records",
+		"cash_movements",
 		"payment_transactions",
+		"cash_shifts",
 		"student_balance",
 		"tariffs",
 		"subscription_freezes",
@@ -72,7 +79,24 @@ func CleanupTestDB(t *testing.T, db *sql.DB) {
 		"student_activity_log",
 		"student_notes",
 		"notifications",
+		"exchange_rates",
 		"user_roles",
+		"refresh_tokens",
+		"user_sessions",
+		"two_factor_challenges",
+		"two_factor_recovery_codes",
+		"user_two_factor",
+		"account_tokens",
+		"login_events",
+		"student_transfers",
+		"teacher_branches",
+		"company_usage",
+		"company_data_jobs",
+		"company_snapshots",
+		"audit_log",
+		"company_sso_configs",
+		"sso_login_states",
+		"user_identities",
 		"users",
 		"companies",
 		"roles",
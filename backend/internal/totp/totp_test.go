@@ -0,0 +1,89 @@
+package totp
+
+import (
+	"encoding/base32"
+	"strings"
+	"testing"
+	"time"
+)
+
+// RFC 6238 appendix B test secret (ASCII "12345678901234567890")
+var rfcSecret = base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte("12345678901234567890"))
+
+func TestCodeMatchesRFC6238Vectors(t *testing.T) {
+	// The RFC lists 8 digit codes; a 6 digit code is their last six digits
+	vectors := map[int64]string{
+		59:          "287082",
+		1111111109:  "081804",
+		1111111111:  "050471",
+		1234567890:  "005924",
+		2000000000:  "279037",
+		20000000000: "353130",
+	}
+	for unix, want := range vectors {
+		got, err := Code(rfcSecret, time.Unix(unix, 0))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("Code at %d = %s, want %s", unix, got, want)
+		}
+	}
+}
+
+func TestValidateAcceptsDriftAndRejectsReplay(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	previous, _ := CodeAt(rfcSecret, Step(now)-1)
+
+	step, ok := Validate(rfcSecret, previous, now, 0)
+	if !ok || step != Step(now)-1 {
+		t.Fatalf("code of the previous step rejected (step %d, ok %v)", step, ok)
+	}
+	if _, ok := Validate(rfcSecret, previous, now, step); ok {
+		t.Error("code accepted twice")
+	}
+
+	old, _ := CodeAt(rfcSecret, Step(now)-3)
+	if _, ok := Validate(rfcSecret, old, now, 0); ok {
+		t.Error("code outside the drift window accepted")
+	}
+	if _, ok := Validate(rfcSecret, "12345", now, 0); ok {
+		t.Error("short code accepted")
+	}
+}
+
+func TestProvisioningURI(t *testing.T) {
+	uri := ProvisioningURI("Classmate Central", "admin@example.com", "JBSWY3DPEHPK3PXP")
+	for _, part := range []string{"otpauth://totp/Classmate%20Central:admin@example.com?", "secret=JBSWY3DPEHPK3PXP", "issuer=Classmate+Central", "digits=6", "period=30"} {
+		if !strings.Contains(uri, part) {
+			t.Errorf("URI %s lacks %s", uri, part)
+		}
+	}
+}
+
+func TestSealerRoundTrip(t *testing.T) {
+	sealer, err := NewSealer("passphrase")
+	if err != nil {
+		t.Fatal(err)
+	}
+	secret, err := GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sealed, err := sealer.Seal(secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(sealed, secret) {
+		t.Fatal("secret stored in plain text")
+	}
+	opened, err := sealer.Open(sealed)
+	if err != nil || opened != secret {
+		t.Fatalf("Open = %q, %v", opened, err)
+	}
+
+	other, _ := NewSealer("other passphrase")
+	if _, err := other.Open(sealed); err == nil {
+		t.Error("secret opened with a different key")
+	}
+}
@@ -1,6 +1,8 @@
 package validation
 
 import (
+	"classmate-central/internal/database"
+	"classmate-central/internal/money"
 	"database/sql"
 	"fmt"
 	"strings"
@@ -24,17 +26,28 @@ func RegisterCustomValidators(v *validator.Validate) {
 
 	// Positive amount validator
 	v.RegisterValidation("positive_amount", func(fl validator.FieldLevel) bool {
-		amount := fl.Field().Float()
-		return ValidatePositiveAmount(amount) == nil
+		amount, ok := fieldMoney(fl)
+		return ok && ValidatePositiveAmount(amount) == nil
 	})
 
 	// Non-negative amount validator
 	v.RegisterValidation("non_negative_amount", func(fl validator.FieldLevel) bool {
-		amount := fl.Field().Float()
-		return ValidateAmount(amount) == nil
+		amount, ok := fieldMoney(fl)
+		return ok && ValidateAmount(amount) == nil
 	})
 }
 
+// fieldMoney reads a money.Money field (float fields are accepted for backward compatibility)
+func fieldMoney(fl validator.FieldLevel) (money.Money, bool) {
+	switch v := fl.Field().Interface().(type) {
+	case money.Money:
+		return v, true
+	case float64:
+		return money.FromFloat(v, money.DefaultCurrency, money.DefaultRounding), true
+	}
+	return money.Money{}, false
+}
+
 // ValidateRecordExists checks if a record exists in the database
 func ValidateRecordExists(db *sql.DB, table, idColumn, idValue, companyID string) error {
 	var count int
@@ -42,7 +55,7 @@ func ValidateRecordExists(db *sql.DB, table, idColumn, idValue, companyID string
 		"SELECT COUNT(*) FROM %s WHERE %s = $1 AND company_id = $2",
 		table, idColumn,
 	)
-	err := db.QueryRow(query, idValue, companyID).Scan(&count)
+	err := database.Tenant(db, companyID).QueryRow(query, idValue, companyID).Scan(&count)
 	if err != nil {
 		return fmt.Errorf("error checking record existence: %w", err)
 	}
@@ -66,7 +79,7 @@ func ValidateNotExists(db *sql.DB, table, column, value, companyID string, exclu
 	}
 	
 	var count int
-	err := db.QueryRow(query, args...).Scan(&count)
+	err := database.Tenant(db, companyID).QueryRow(query, args...).Scan(&count)
 	if err != nil {
 		return fmt.Errorf("error checking uniqueness: %w", err)
 	}
@@ -1,6 +1,7 @@
 package validation
 
 import (
+	"classmate-central/internal/money"
 	"fmt"
 	"regexp"
 	"strings"
@@ -64,23 +65,26 @@ func ValidateAge(age int) error {
 	return nil
 }
 
+// maxAmount is the largest accepted amount (1 000 000 000 in major units)
+var maxAmount = money.FromMajor(1000000000, money.DefaultCurrency)
+
 // ValidateAmount validates monetary amount
-func ValidateAmount(amount float64) error {
-	if amount < 0 {
+func ValidateAmount(amount money.Money) error {
+	if amount.IsNegative() {
 		return fmt.Errorf("amount cannot be negative")
 	}
-	if amount > 1000000000 {
+	if amount.Minor() > maxAmount.Minor() {
 		return fmt.Errorf("amount is too large")
 	}
 	return nil
 }
 
 // ValidatePositiveAmount validates positive monetary amount
-func ValidatePositiveAmount(amount float64) error {
-	if amount <= 0 {
+func ValidatePositiveAmount(amount money.Money) error {
+	if !amount.IsPositive() {
 		return fmt.Errorf("amount must be positive")
 	}
-	if amount > 1000000000 {
+	if amount.Minor() > maxAmount.Minor() {
 		return fmt.Errorf("amount is too large")
 	}
 	return nil
@@ -0,0 +1,9 @@
+-- ============================================
+-- Migration 028 Rollback: Remove Cash Register Shifts
+-- ============================================
+
+DROP INDEX IF EXISTS idx_payment_transactions_shift;
+ALTER TABLE payment_transactions DROP COLUMN IF EXISTS shift_id;
+
+DROP TABLE IF EXISTS cash_movements;
+DROP TABLE IF EXISTS cash_shifts;
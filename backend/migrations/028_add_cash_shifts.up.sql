@@ -0,0 +1,46 @@
+-- ============================================
+-- Migration 028: Cash Register Shifts
+-- ============================================
+-- Adds per-branch cash register shifts with opening/closing float,
+-- cash-in/cash-out movements, and binds cash payments to the open shift.
+
+CREATE TABLE IF NOT EXISTS cash_shifts (
+    id SERIAL PRIMARY KEY,
+    company_id VARCHAR(255) NOT NULL REFERENCES companies(id) ON DELETE CASCADE,
+    branch_id VARCHAR(255) NOT NULL REFERENCES branches(id) ON DELETE CASCADE,
+    status VARCHAR(20) NOT NULL DEFAULT 'open' CHECK (status IN ('open', 'closed')),
+    opening_float NUMERIC(12,2) NOT NULL DEFAULT 0,
+    expected_cash NUMERIC(12,2),
+    counted_cash NUMERIC(12,2),
+    discrepancy NUMERIC(12,2),
+    opened_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    closed_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    opened_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    closed_at TIMESTAMP,
+    notes TEXT
+);
+
+-- Only one open shift per branch
+CREATE UNIQUE INDEX IF NOT EXISTS idx_cash_shifts_one_open_per_branch
+    ON cash_shifts(branch_id) WHERE status = 'open';
+CREATE INDEX IF NOT EXISTS idx_cash_shifts_company ON cash_shifts(company_id);
+CREATE INDEX IF NOT EXISTS idx_cash_shifts_branch ON cash_shifts(branch_id);
+
+CREATE TABLE IF NOT EXISTS cash_movements (
+    id SERIAL PRIMARY KEY,
+    shift_id INTEGER NOT NULL REFERENCES cash_shifts(id) ON DELETE CASCADE,
+    type VARCHAR(20) NOT NULL CHECK (type IN ('cash_in', 'cash_out')),
+    amount NUMERIC(12,2) NOT NULL CHECK (amount > 0),
+    reason TEXT,
+    created_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    company_id VARCHAR(255) NOT NULL REFERENCES companies(id) ON DELETE CASCADE,
+    branch_id VARCHAR(255) REFERENCES branches(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_cash_movements_shift ON cash_movements(shift_id);
+CREATE INDEX IF NOT EXISTS idx_cash_movements_company ON cash_movements(company_id);
+
+-- Bind payment transactions to the shift they were collected in
+ALTER TABLE payment_transactions ADD COLUMN IF NOT EXISTS shift_id INTEGER REFERENCES cash_shifts(id) ON DELETE SET NULL;
+CREATE INDEX IF NOT EXISTS idx_payment_transactions_shift ON payment_transactions(shift_id);
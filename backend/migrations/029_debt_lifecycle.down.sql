@@ -0,0 +1,13 @@
+-- ============================================
+-- Migration 029 Rollback: Debt Lifecycle
+-- ============================================
+
+DROP TABLE IF EXISTS debt_payments;
+
+DROP INDEX IF EXISTS idx_debt_records_company_status;
+DROP INDEX IF EXISTS idx_debt_records_invoice;
+
+ALTER TABLE debt_records DROP COLUMN IF EXISTS settled_at;
+ALTER TABLE debt_records DROP COLUMN IF EXISTS invoice_id;
+ALTER TABLE debt_records DROP COLUMN IF EXISTS source;
+ALTER TABLE debt_records DROP COLUMN IF EXISTS paid_amount;
@@ -0,0 +1,37 @@
+-- ============================================
+-- Migration 029: Debt Lifecycle
+-- ============================================
+-- Debts are generated automatically from negative balances and overdue invoices
+-- and are settled (partially) by incoming payments, oldest first.
+
+ALTER TABLE debt_records ADD COLUMN IF NOT EXISTS paid_amount DECIMAL(10, 2) NOT NULL DEFAULT 0;
+ALTER TABLE debt_records ADD COLUMN IF NOT EXISTS source VARCHAR(50) NOT NULL DEFAULT 'manual'; -- manual, negative_balance, invoice
+ALTER TABLE debt_records ADD COLUMN IF NOT EXISTS invoice_id BIGINT REFERENCES invoice(id) ON DELETE SET NULL;
+ALTER TABLE debt_records ADD COLUMN IF NOT EXISTS settled_at TIMESTAMP;
+
+-- Debts already marked as paid are fully settled
+UPDATE debt_records SET paid_amount = amount, settled_at = COALESCE(settled_at, created_at)
+WHERE status = 'paid' AND paid_amount = 0;
+
+-- Fill branch from the student for existing debts
+UPDATE debt_records d SET branch_id = s.branch_id
+FROM students s
+WHERE d.student_id = s.id AND d.branch_id IS NULL;
+
+-- One debt per overdue invoice
+CREATE UNIQUE INDEX IF NOT EXISTS idx_debt_records_invoice ON debt_records(invoice_id) WHERE invoice_id IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_debt_records_company_status ON debt_records(company_id, status);
+
+-- Allocation of payments to debts
+CREATE TABLE IF NOT EXISTS debt_payments (
+    id SERIAL PRIMARY KEY,
+    debt_id INTEGER NOT NULL REFERENCES debt_records(id) ON DELETE CASCADE,
+    payment_transaction_id INTEGER REFERENCES payment_transactions(id) ON DELETE SET NULL,
+    amount DECIMAL(10, 2) NOT NULL CHECK (amount > 0),
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    company_id VARCHAR(255) NOT NULL REFERENCES companies(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_debt_payments_debt ON debt_payments(debt_id);
+CREATE INDEX IF NOT EXISTS idx_debt_payments_payment ON debt_payments(payment_transaction_id);
+CREATE INDEX IF NOT EXISTS idx_debt_payments_company ON debt_payments(company_id);
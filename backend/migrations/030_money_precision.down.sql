@@ -0,0 +1,21 @@
+-- ============================================
+-- Migration 030 Rollback: Money Precision
+-- ============================================
+
+ALTER TABLE cash_movements ALTER COLUMN amount TYPE NUMERIC(12, 2);
+ALTER TABLE cash_shifts ALTER COLUMN discrepancy TYPE NUMERIC(12, 2);
+ALTER TABLE cash_shifts ALTER COLUMN counted_cash TYPE NUMERIC(12, 2);
+ALTER TABLE cash_shifts ALTER COLUMN expected_cash TYPE NUMERIC(12, 2);
+ALTER TABLE cash_shifts ALTER COLUMN opening_float TYPE NUMERIC(12, 2);
+ALTER TABLE transaction ALTER COLUMN amount TYPE NUMERIC(12, 2);
+ALTER TABLE invoice_item ALTER COLUMN unit_price TYPE NUMERIC(12, 2);
+ALTER TABLE lesson_attendance ALTER COLUMN commission_amount TYPE DECIMAL(10, 2);
+ALTER TABLE student_subscriptions ALTER COLUMN price_per_lesson TYPE DECIMAL(10, 2);
+ALTER TABLE student_subscriptions ALTER COLUMN total_price TYPE DECIMAL(10, 2);
+ALTER TABLE subscription_types ALTER COLUMN price TYPE DECIMAL(10, 2);
+ALTER TABLE debt_payments ALTER COLUMN amount TYPE DECIMAL(10, 2);
+ALTER TABLE debt_records ALTER COLUMN paid_amount TYPE DECIMAL(10, 2);
+ALTER TABLE debt_records ALTER COLUMN amount TYPE DECIMAL(10, 2);
+ALTER TABLE tariffs ALTER COLUMN price TYPE DECIMAL(10, 2);
+ALTER TABLE student_balance ALTER COLUMN balance TYPE DECIMAL(10, 2);
+ALTER TABLE payment_transactions ALTER COLUMN amount TYPE DECIMAL(10, 2);
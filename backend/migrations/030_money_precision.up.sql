@@ -0,0 +1,30 @@
+-- ============================================
+-- Migration 030: Money Precision
+-- ============================================
+-- All monetary columns become NUMERIC(14,2): amounts are handled as fixed-point
+-- minor units in the application, rounded half up to 2 decimal places.
+
+ALTER TABLE payment_transactions ALTER COLUMN amount TYPE NUMERIC(14, 2) USING ROUND(amount, 2);
+ALTER TABLE student_balance ALTER COLUMN balance TYPE NUMERIC(14, 2) USING ROUND(balance, 2);
+ALTER TABLE tariffs ALTER COLUMN price TYPE NUMERIC(14, 2) USING ROUND(price, 2);
+ALTER TABLE debt_records ALTER COLUMN amount TYPE NUMERIC(14, 2) USING ROUND(amount, 2);
+ALTER TABLE debt_records ALTER COLUMN paid_amount TYPE NUMERIC(14, 2) USING ROUND(paid_amount, 2);
+ALTER TABLE debt_payments ALTER COLUMN amount TYPE NUMERIC(14, 2) USING ROUND(amount, 2);
+ALTER TABLE subscription_types ALTER COLUMN price TYPE NUMERIC(14, 2) USING ROUND(price, 2);
+ALTER TABLE student_subscriptions ALTER COLUMN total_price TYPE NUMERIC(14, 2) USING ROUND(total_price, 2);
+ALTER TABLE student_subscriptions ALTER COLUMN price_per_lesson TYPE NUMERIC(14, 2) USING ROUND(price_per_lesson, 2);
+ALTER TABLE lesson_attendance ALTER COLUMN commission_amount TYPE NUMERIC(14, 2) USING ROUND(commission_amount, 2);
+ALTER TABLE invoice_item ALTER COLUMN unit_price TYPE NUMERIC(14, 2) USING ROUND(unit_price, 2);
+ALTER TABLE transaction ALTER COLUMN amount TYPE NUMERIC(14, 2) USING ROUND(amount, 2);
+ALTER TABLE cash_shifts ALTER COLUMN opening_float TYPE NUMERIC(14, 2) USING ROUND(opening_float, 2);
+ALTER TABLE cash_shifts ALTER COLUMN expected_cash TYPE NUMERIC(14, 2) USING ROUND(expected_cash, 2);
+ALTER TABLE cash_shifts ALTER COLUMN counted_cash TYPE NUMERIC(14, 2) USING ROUND(counted_cash, 2);
+ALTER TABLE cash_shifts ALTER COLUMN discrepancy TYPE NUMERIC(14, 2) USING ROUND(discrepancy, 2);
+ALTER TABLE cash_movements ALTER COLUMN amount TYPE NUMERIC(14, 2) USING ROUND(amount, 2);
+
+-- price_per_lesson used to be computed by the client; derive it from the total price
+UPDATE student_subscriptions
+SET price_per_lesson = ROUND(total_price / total_lessons, 2)
+WHERE total_lessons > 0 AND total_price > 0
+  AND price_per_lesson <> ROUND(total_price / total_lessons, 2);
+
@@ -0,0 +1,27 @@
+-- ============================================
+-- Migration 031 Rollback: Multi-Currency
+-- ============================================
+
+DROP TABLE IF EXISTS exchange_rates;
+
+DROP TRIGGER IF EXISTS trg_student_balance_currency ON student_balance;
+ALTER TABLE student_balance DROP COLUMN IF EXISTS currency;
+
+DO $$
+DECLARE
+    t TEXT;
+BEGIN
+    FOREACH t IN ARRAY ARRAY['payment_transactions', 'subscription_types', 'student_subscriptions',
+                             'debt_records', 'invoice', 'transaction', 'cash_shifts']
+    LOOP
+        EXECUTE format('DROP TRIGGER IF EXISTS trg_%s_currency ON %I', t, t);
+        EXECUTE format('ALTER TABLE %I DROP COLUMN IF EXISTS currency', t);
+    END LOOP;
+END $$;
+
+DROP FUNCTION IF EXISTS set_balance_currency();
+DROP FUNCTION IF EXISTS set_row_currency();
+DROP FUNCTION IF EXISTS effective_currency(VARCHAR, VARCHAR);
+
+ALTER TABLE branches DROP COLUMN IF EXISTS currency;
+ALTER TABLE companies DROP COLUMN IF EXISTS base_currency;
@@ -0,0 +1,84 @@
+-- ============================================
+-- Migration 031: Multi-Currency
+-- ============================================
+-- Base currency per company with an optional override per branch.
+-- Prices, balances and transactions store their currency; it is filled from
+-- the branch (or company) on insert. Exchange rates are maintained manually
+-- per company with effective dates and are used to convert reports.
+
+ALTER TABLE companies ADD COLUMN IF NOT EXISTS base_currency VARCHAR(3) NOT NULL DEFAULT 'KZT';
+ALTER TABLE branches ADD COLUMN IF NOT EXISTS currency VARCHAR(3);
+
+-- Effective currency of a branch: its own, else the company's base currency
+CREATE OR REPLACE FUNCTION effective_currency(p_company_id VARCHAR, p_branch_id VARCHAR)
+RETURNS VARCHAR AS $$
+    SELECT COALESCE(
+        (SELECT currency FROM branches WHERE id = p_branch_id),
+        (SELECT base_currency FROM companies WHERE id = p_company_id),
+        'KZT'
+    );
+$$ LANGUAGE sql STABLE;
+
+-- Fills NEW.currency from branch_id/company_id when the insert does not set it
+CREATE OR REPLACE FUNCTION set_row_currency()
+RETURNS TRIGGER AS $$
+BEGIN
+    IF NEW.currency IS NULL THEN
+        NEW.currency := effective_currency(NEW.company_id, NEW.branch_id);
+    END IF;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+-- Student balances take the currency of the student's branch
+CREATE OR REPLACE FUNCTION set_balance_currency()
+RETURNS TRIGGER AS $$
+BEGIN
+    IF NEW.currency IS NULL THEN
+        SELECT effective_currency(s.company_id, s.branch_id) INTO NEW.currency
+        FROM students s WHERE s.id = NEW.student_id;
+        NEW.currency := COALESCE(NEW.currency, 'KZT');
+    END IF;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+DO $$
+DECLARE
+    t TEXT;
+BEGIN
+    FOREACH t IN ARRAY ARRAY['payment_transactions', 'subscription_types', 'student_subscriptions',
+                             'debt_records', 'invoice', 'transaction', 'cash_shifts']
+    LOOP
+        EXECUTE format('ALTER TABLE %I ADD COLUMN IF NOT EXISTS currency VARCHAR(3)', t);
+        EXECUTE format('UPDATE %I SET currency = effective_currency(company_id, branch_id) WHERE currency IS NULL', t);
+        EXECUTE format('ALTER TABLE %I ALTER COLUMN currency SET NOT NULL', t);
+        EXECUTE format('DROP TRIGGER IF EXISTS trg_%s_currency ON %I', t, t);
+        EXECUTE format('CREATE TRIGGER trg_%s_currency BEFORE INSERT ON %I FOR EACH ROW EXECUTE FUNCTION set_row_currency()', t, t);
+    END LOOP;
+END $$;
+
+ALTER TABLE student_balance ADD COLUMN IF NOT EXISTS currency VARCHAR(3);
+UPDATE student_balance sb SET currency = effective_currency(s.company_id, s.branch_id)
+FROM students s WHERE s.id = sb.student_id AND sb.currency IS NULL;
+UPDATE student_balance SET currency = 'KZT' WHERE currency IS NULL;
+ALTER TABLE student_balance ALTER COLUMN currency SET NOT NULL;
+DROP TRIGGER IF EXISTS trg_student_balance_currency ON student_balance;
+CREATE TRIGGER trg_student_balance_currency BEFORE INSERT ON student_balance
+    FOR EACH ROW EXECUTE FUNCTION set_balance_currency();
+
+CREATE TABLE IF NOT EXISTS exchange_rates (
+    id SERIAL PRIMARY KEY,
+    company_id VARCHAR(255) NOT NULL REFERENCES companies(id) ON DELETE CASCADE,
+    from_currency VARCHAR(3) NOT NULL,
+    to_currency VARCHAR(3) NOT NULL,
+    rate NUMERIC(20, 8) NOT NULL CHECK (rate > 0),
+    effective_date DATE NOT NULL,
+    created_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    CHECK (from_currency <> to_currency),
+    UNIQUE (company_id, from_currency, to_currency, effective_date)
+);
+
+CREATE INDEX IF NOT EXISTS idx_exchange_rates_lookup
+    ON exchange_rates(company_id, from_currency, to_currency, effective_date DESC);
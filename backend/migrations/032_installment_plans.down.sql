@@ -0,0 +1,6 @@
+-- ============================================
+-- Migration 032 Rollback: Installment Plans
+-- ============================================
+
+DROP TABLE IF EXISTS installments;
+DROP TABLE IF EXISTS installment_plans;
@@ -0,0 +1,48 @@
+-- ============================================
+-- Migration 032: Installment Plans
+-- ============================================
+-- A subscription can be paid in parts. Each installment generates a debt or an
+-- invoice on its due date; its status follows what was paid against it.
+-- Plans with a grace period suspend the subscription while an installment stays overdue.
+
+CREATE TABLE IF NOT EXISTS installment_plans (
+    id SERIAL PRIMARY KEY,
+    subscription_id VARCHAR(255) NOT NULL REFERENCES student_subscriptions(id) ON DELETE CASCADE,
+    student_id VARCHAR(255) NOT NULL REFERENCES students(id) ON DELETE CASCADE,
+    total_amount NUMERIC(14, 2) NOT NULL CHECK (total_amount > 0),
+    currency VARCHAR(3) NOT NULL,
+    billing_mode VARCHAR(20) NOT NULL DEFAULT 'debt' CHECK (billing_mode IN ('debt', 'invoice')),
+    reminder_days INTEGER NOT NULL DEFAULT 3 CHECK (reminder_days >= 0),
+    grace_days INTEGER CHECK (grace_days >= 0), -- NULL: never suspend the subscription
+    status VARCHAR(20) NOT NULL DEFAULT 'active' CHECK (status IN ('active', 'completed', 'cancelled')),
+    suspended_at TIMESTAMP,
+    created_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    company_id VARCHAR(255) NOT NULL REFERENCES companies(id) ON DELETE CASCADE,
+    branch_id VARCHAR(255) REFERENCES branches(id) ON DELETE SET NULL
+);
+
+-- One live plan per subscription
+CREATE UNIQUE INDEX IF NOT EXISTS idx_installment_plans_subscription
+    ON installment_plans(subscription_id) WHERE status <> 'cancelled';
+CREATE INDEX IF NOT EXISTS idx_installment_plans_company ON installment_plans(company_id, status);
+
+CREATE TABLE IF NOT EXISTS installments (
+    id SERIAL PRIMARY KEY,
+    plan_id INTEGER NOT NULL REFERENCES installment_plans(id) ON DELETE CASCADE,
+    seq INTEGER NOT NULL,
+    due_date DATE NOT NULL,
+    amount NUMERIC(14, 2) NOT NULL CHECK (amount > 0),
+    paid_amount NUMERIC(14, 2) NOT NULL DEFAULT 0,
+    status VARCHAR(20) NOT NULL DEFAULT 'scheduled'
+        CHECK (status IN ('scheduled', 'due', 'partially_paid', 'paid', 'overdue', 'cancelled')),
+    debt_id INTEGER REFERENCES debt_records(id) ON DELETE SET NULL,
+    invoice_id BIGINT REFERENCES invoice(id) ON DELETE SET NULL,
+    reminded_at TIMESTAMP,
+    paid_at TIMESTAMP,
+    company_id VARCHAR(255) NOT NULL REFERENCES companies(id) ON DELETE CASCADE,
+    UNIQUE (plan_id, seq)
+);
+
+CREATE INDEX IF NOT EXISTS idx_installments_due ON installments(status, due_date);
+CREATE INDEX IF NOT EXISTS idx_installments_company ON installments(company_id);
@@ -0,0 +1,5 @@
+-- ============================================
+-- Migration 033 Rollback: Online Payments
+-- ============================================
+
+DROP TABLE IF EXISTS payment_intents;
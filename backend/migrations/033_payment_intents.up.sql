@@ -0,0 +1,34 @@
+-- ============================================
+-- Migration 033: Online Payments
+-- ============================================
+-- A payment intent is a payment link created at an online payment provider.
+-- The provider webhook confirms it; the confirmation creates the payment transaction once
+-- and marks the linked invoice paid.
+
+CREATE TABLE IF NOT EXISTS payment_intents (
+    id VARCHAR(255) PRIMARY KEY, -- also the reference sent to the provider
+    student_id VARCHAR(255) NOT NULL REFERENCES students(id) ON DELETE CASCADE,
+    invoice_id BIGINT REFERENCES invoice(id) ON DELETE SET NULL,
+    amount NUMERIC(14, 2) NOT NULL CHECK (amount > 0),
+    currency VARCHAR(3) NOT NULL,
+    description TEXT NOT NULL DEFAULT '',
+    provider VARCHAR(50) NOT NULL,
+    provider_payment_id VARCHAR(255),
+    payment_url TEXT,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending'
+        CHECK (status IN ('pending', 'succeeded', 'failed', 'cancelled', 'refunded')),
+    transaction_id INTEGER REFERENCES payment_transactions(id) ON DELETE SET NULL,
+    refunded_amount NUMERIC(14, 2) NOT NULL DEFAULT 0,
+    created_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    confirmed_at TIMESTAMP,
+    company_id VARCHAR(255) NOT NULL REFERENCES companies(id) ON DELETE CASCADE,
+    branch_id VARCHAR(255) REFERENCES branches(id) ON DELETE SET NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_payment_intents_company ON payment_intents(company_id, status);
+CREATE INDEX IF NOT EXISTS idx_payment_intents_student ON payment_intents(student_id);
+CREATE INDEX IF NOT EXISTS idx_payment_intents_pending ON payment_intents(created_at) WHERE status = 'pending';
+CREATE UNIQUE INDEX IF NOT EXISTS idx_payment_intents_provider_payment
+    ON payment_intents(provider, provider_payment_id) WHERE provider_payment_id IS NOT NULL;
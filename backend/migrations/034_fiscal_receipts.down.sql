@@ -0,0 +1,9 @@
+-- ============================================
+-- Migration 034 Rollback: Fiscal Receipts
+-- ============================================
+
+ALTER TABLE payment_transactions DROP COLUMN IF EXISTS fiscal_url;
+ALTER TABLE payment_transactions DROP COLUMN IF EXISTS fiscal_qr;
+ALTER TABLE payment_transactions DROP COLUMN IF EXISTS fiscal_number;
+
+DROP TABLE IF EXISTS fiscal_receipts;
@@ -0,0 +1,37 @@
+-- ============================================
+-- Migration 034: Fiscal Receipts
+-- ============================================
+-- Every cash and card payment or refund queues a fiscal receipt in the same
+-- database transaction. A background worker registers queued receipts with the
+-- fiscal data operator (OFD), retrying with backoff; the fiscal number, QR code
+-- and receipt URL are copied onto the payment transaction.
+
+CREATE TABLE IF NOT EXISTS fiscal_receipts (
+    id SERIAL PRIMARY KEY,
+    transaction_id INTEGER NOT NULL UNIQUE REFERENCES payment_transactions(id) ON DELETE CASCADE,
+    operation VARCHAR(20) NOT NULL CHECK (operation IN ('sale', 'refund')),
+    amount NUMERIC(14, 2) NOT NULL,
+    currency VARCHAR(3) NOT NULL,
+    payment_method VARCHAR(50) NOT NULL,
+    description TEXT NOT NULL DEFAULT '',
+    status VARCHAR(20) NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'registered', 'failed')),
+    attempts INTEGER NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    last_error TEXT,
+    operator VARCHAR(50),
+    fiscal_number VARCHAR(255),
+    qr_code TEXT,
+    receipt_url TEXT,
+    registered_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    company_id VARCHAR(255) NOT NULL REFERENCES companies(id) ON DELETE CASCADE,
+    branch_id VARCHAR(255) REFERENCES branches(id) ON DELETE SET NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_fiscal_receipts_queue ON fiscal_receipts(next_attempt_at) WHERE status = 'pending';
+CREATE INDEX IF NOT EXISTS idx_fiscal_receipts_company ON fiscal_receipts(company_id, status);
+
+ALTER TABLE payment_transactions ADD COLUMN IF NOT EXISTS fiscal_number VARCHAR(255);
+ALTER TABLE payment_transactions ADD COLUMN IF NOT EXISTS fiscal_qr TEXT;
+ALTER TABLE payment_transactions ADD COLUMN IF NOT EXISTS fiscal_url TEXT;
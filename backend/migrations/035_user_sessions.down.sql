@@ -0,0 +1,6 @@
+-- ============================================
+-- Migration 035 Rollback: User Sessions
+-- ============================================
+
+DROP TABLE IF EXISTS refresh_tokens;
+DROP TABLE IF EXISTS user_sessions;
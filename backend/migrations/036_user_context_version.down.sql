@@ -0,0 +1,17 @@
+-- ============================================
+-- Migration 036 Rollback: User Context Version
+-- ============================================
+
+DROP TRIGGER IF EXISTS trigger_users_context_version ON users;
+DROP TRIGGER IF EXISTS trigger_roles_context_version ON roles;
+DROP TRIGGER IF EXISTS trigger_branches_context_version ON branches;
+DROP TRIGGER IF EXISTS trigger_role_permissions_context_version ON role_permissions;
+DROP TRIGGER IF EXISTS trigger_user_branches_context_version ON user_branches;
+DROP TRIGGER IF EXISTS trigger_user_roles_context_version ON user_roles;
+
+DROP FUNCTION IF EXISTS bump_own_context_version();
+DROP FUNCTION IF EXISTS bump_company_context_version();
+DROP FUNCTION IF EXISTS bump_role_context_version();
+DROP FUNCTION IF EXISTS bump_user_context_version();
+
+ALTER TABLE users DROP COLUMN IF EXISTS context_version;
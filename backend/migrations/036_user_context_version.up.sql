@@ -0,0 +1,108 @@
+-- ============================================
+-- Migration 036: User Context Version
+-- ============================================
+-- CompanyMiddleware caches the resolved company, branches, roles and permissions of a user.
+-- Every change that affects them bumps users.context_version, which invalidates the cached entry.
+
+ALTER TABLE users ADD COLUMN IF NOT EXISTS context_version INTEGER NOT NULL DEFAULT 1;
+
+-- Bump the version of one user (role or branch assignment changed)
+CREATE OR REPLACE FUNCTION bump_user_context_version()
+RETURNS TRIGGER AS $$
+DECLARE
+    affected_user INTEGER;
+BEGIN
+    IF TG_OP = 'DELETE' THEN
+        affected_user := OLD.user_id;
+    ELSE
+        affected_user := NEW.user_id;
+    END IF;
+    UPDATE users SET context_version = context_version + 1 WHERE id = affected_user;
+    IF TG_OP = 'UPDATE' AND OLD.user_id <> NEW.user_id THEN
+        UPDATE users SET context_version = context_version + 1 WHERE id = OLD.user_id;
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS trigger_user_roles_context_version ON user_roles;
+CREATE TRIGGER trigger_user_roles_context_version
+    AFTER INSERT OR UPDATE OR DELETE ON user_roles
+    FOR EACH ROW
+    EXECUTE FUNCTION bump_user_context_version();
+
+DROP TRIGGER IF EXISTS trigger_user_branches_context_version ON user_branches;
+CREATE TRIGGER trigger_user_branches_context_version
+    AFTER INSERT OR UPDATE OR DELETE ON user_branches
+    FOR EACH ROW
+    EXECUTE FUNCTION bump_user_context_version();
+
+-- Bump every holder of a role (permissions of the role changed, or the role was renamed)
+CREATE OR REPLACE FUNCTION bump_role_context_version()
+RETURNS TRIGGER AS $$
+DECLARE
+    affected_role VARCHAR(255);
+BEGIN
+    IF TG_OP = 'DELETE' THEN
+        affected_role := OLD.role_id;
+    ELSE
+        affected_role := NEW.role_id;
+    END IF;
+    UPDATE users SET context_version = context_version + 1
+    WHERE role_id = affected_role
+       OR id IN (SELECT user_id FROM user_roles WHERE role_id = affected_role);
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS trigger_role_permissions_context_version ON role_permissions;
+CREATE TRIGGER trigger_role_permissions_context_version
+    AFTER INSERT OR UPDATE OR DELETE ON role_permissions
+    FOR EACH ROW
+    EXECUTE FUNCTION bump_role_context_version();
+
+-- Admins see every branch of the company, so adding or removing a branch changes their context
+CREATE OR REPLACE FUNCTION bump_company_context_version()
+RETURNS TRIGGER AS $$
+DECLARE
+    affected_company VARCHAR(255);
+BEGIN
+    IF TG_OP = 'DELETE' THEN
+        affected_company := OLD.company_id;
+    ELSE
+        affected_company := NEW.company_id;
+    END IF;
+    UPDATE users SET context_version = context_version + 1 WHERE company_id = affected_company;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS trigger_branches_context_version ON branches;
+CREATE TRIGGER trigger_branches_context_version
+    AFTER INSERT OR DELETE ON branches
+    FOR EACH ROW
+    EXECUTE FUNCTION bump_company_context_version();
+
+-- Role renames matter because admin access is granted by the role name
+DROP TRIGGER IF EXISTS trigger_roles_context_version ON roles;
+CREATE TRIGGER trigger_roles_context_version
+    AFTER UPDATE OF name ON roles
+    FOR EACH ROW
+    WHEN (OLD.name IS DISTINCT FROM NEW.name)
+    EXECUTE FUNCTION bump_company_context_version();
+
+-- Direct changes of a user's company or legacy role
+CREATE OR REPLACE FUNCTION bump_own_context_version()
+RETURNS TRIGGER AS $$
+BEGIN
+    NEW.context_version := OLD.context_version + 1;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS trigger_users_context_version ON users;
+CREATE TRIGGER trigger_users_context_version
+    BEFORE UPDATE OF company_id, role_id ON users
+    FOR EACH ROW
+    WHEN (OLD.company_id IS DISTINCT FROM NEW.company_id OR OLD.role_id IS DISTINCT FROM NEW.role_id)
+    EXECUTE FUNCTION bump_own_context_version();
@@ -0,0 +1,22 @@
+-- ============================================
+-- Migration 037 Rollback: Branch Scoped Roles
+-- ============================================
+
+DROP INDEX IF EXISTS idx_user_branches_role;
+
+CREATE OR REPLACE FUNCTION bump_role_context_version()
+RETURNS TRIGGER AS $$
+DECLARE
+    affected_role VARCHAR(255);
+BEGIN
+    IF TG_OP = 'DELETE' THEN
+        affected_role := OLD.role_id;
+    ELSE
+        affected_role := NEW.role_id;
+    END IF;
+    UPDATE users SET context_version = context_version + 1
+    WHERE role_id = affected_role
+       OR id IN (SELECT user_id FROM user_roles WHERE role_id = affected_role);
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
@@ -0,0 +1,26 @@
+-- ============================================
+-- Migration 037: Branch Scoped Roles
+-- ============================================
+-- user_branches.role_id now decides the permissions of a user inside that branch.
+-- Changing the permissions of a role must therefore also invalidate the cached context
+-- of users who hold the role only through a branch assignment.
+
+CREATE OR REPLACE FUNCTION bump_role_context_version()
+RETURNS TRIGGER AS $$
+DECLARE
+    affected_role VARCHAR(255);
+BEGIN
+    IF TG_OP = 'DELETE' THEN
+        affected_role := OLD.role_id;
+    ELSE
+        affected_role := NEW.role_id;
+    END IF;
+    UPDATE users SET context_version = context_version + 1
+    WHERE role_id = affected_role
+       OR id IN (SELECT user_id FROM user_roles WHERE role_id = affected_role)
+       OR id IN (SELECT user_id FROM user_branches WHERE role_id = affected_role);
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE INDEX IF NOT EXISTS idx_user_branches_role ON user_branches(role_id);
@@ -0,0 +1,13 @@
+-- ============================================
+-- Migration 038 Rollback: Permission Data Scopes
+-- ============================================
+
+DROP TRIGGER IF EXISTS trigger_teachers_context_version ON teachers;
+DROP FUNCTION IF EXISTS bump_teacher_user_context_version();
+DROP FUNCTION IF EXISTS apply_default_permission_scopes(VARCHAR);
+
+DROP INDEX IF EXISTS idx_teachers_user;
+ALTER TABLE teachers DROP COLUMN IF EXISTS user_id;
+
+ALTER TABLE role_permissions DROP CONSTRAINT IF EXISTS chk_role_permissions_scope;
+ALTER TABLE role_permissions DROP COLUMN IF EXISTS scope;
@@ -0,0 +1,70 @@
+-- ============================================
+-- Migration 038: Permission Data Scopes
+-- ============================================
+-- A permission now carries a data scope per role:
+--   all    - records of every branch the user can access
+--   branch - records of the current branch (previous behaviour)
+--   own    - only records of the teacher linked to the user (their groups, lessons, students)
+
+ALTER TABLE role_permissions ADD COLUMN IF NOT EXISTS scope VARCHAR(20) NOT NULL DEFAULT 'branch';
+
+DO $$
+BEGIN
+    IF NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conname = 'chk_role_permissions_scope') THEN
+        ALTER TABLE role_permissions ADD CONSTRAINT chk_role_permissions_scope
+            CHECK (scope IN ('all', 'branch', 'own'));
+    END IF;
+END $$;
+
+-- Teacher record of a user account (the "own" scope resolves through it)
+ALTER TABLE teachers ADD COLUMN IF NOT EXISTS user_id INTEGER REFERENCES users(id) ON DELETE SET NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_teachers_user ON teachers(user_id) WHERE user_id IS NOT NULL;
+
+-- Link existing teachers to the user with the same email in the company
+UPDATE teachers t
+SET user_id = matched.user_id
+FROM (
+    SELECT DISTINCT ON (u.id) u.id AS user_id, t2.id AS teacher_id
+    FROM users u
+    JOIN teachers t2 ON t2.company_id = u.company_id AND LOWER(t2.email) = LOWER(u.email)
+    WHERE u.email <> ''
+    ORDER BY u.id, t2.id
+) matched
+WHERE t.id = matched.teacher_id AND t.user_id IS NULL
+  AND NOT EXISTS (SELECT 1 FROM teachers linked WHERE linked.user_id = matched.user_id);
+
+-- Default scopes: teachers only see what they teach
+CREATE OR REPLACE FUNCTION apply_default_permission_scopes(company_id_param VARCHAR(255))
+RETURNS void AS $$
+BEGIN
+    UPDATE role_permissions
+    SET scope = 'own'
+    WHERE role_id = company_id_param || '_teacher'
+      AND permission_id IN (
+        'perm_students_view',
+        'perm_groups_view',
+        'perm_lessons_view',
+        'perm_attendance_view',
+        'perm_attendance_mark'
+      );
+END;
+$$ LANGUAGE plpgsql;
+
+SELECT apply_default_permission_scopes(id) FROM companies;
+
+-- Linking or unlinking a teacher changes what the user sees
+CREATE OR REPLACE FUNCTION bump_teacher_user_context_version()
+RETURNS TRIGGER AS $$
+BEGIN
+    UPDATE users SET context_version = context_version + 1
+    WHERE id IN (OLD.user_id, NEW.user_id);
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS trigger_teachers_context_version ON teachers;
+CREATE TRIGGER trigger_teachers_context_version
+    AFTER UPDATE OF user_id ON teachers
+    FOR EACH ROW
+    WHEN (OLD.user_id IS DISTINCT FROM NEW.user_id)
+    EXECUTE FUNCTION bump_teacher_user_context_version();
@@ -0,0 +1,14 @@
+-- ============================================
+-- Migration 039 Rollback: Two-Factor Authentication
+-- ============================================
+
+DROP TRIGGER IF EXISTS trigger_user_two_factor_context_version ON user_two_factor;
+DROP TRIGGER IF EXISTS trigger_roles_two_factor_context_version ON roles;
+DROP FUNCTION IF EXISTS bump_role_holders_context_version();
+
+ALTER TABLE user_sessions DROP COLUMN IF EXISTS two_factor_verified_at;
+ALTER TABLE roles DROP COLUMN IF EXISTS require_two_factor;
+
+DROP TABLE IF EXISTS two_factor_challenges;
+DROP TABLE IF EXISTS two_factor_recovery_codes;
+DROP TABLE IF EXISTS user_two_factor;
@@ -0,0 +1,68 @@
+-- ============================================
+-- Migration 039: Two-Factor Authentication
+-- ============================================
+-- TOTP second factor for staff accounts. Secrets are stored encrypted, recovery codes and
+-- login challenges only as SHA-256 hashes. Roles can require 2FA from their holders, and
+-- sessions remember when the second factor was last confirmed (step-up for sensitive actions).
+
+CREATE TABLE IF NOT EXISTS user_two_factor (
+    user_id INTEGER PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    secret_encrypted TEXT NOT NULL,
+    enabled_at TIMESTAMP, -- NULL while enrollment is not confirmed
+    last_used_step BIGINT NOT NULL DEFAULT 0, -- last accepted TOTP time step (replay protection)
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS two_factor_recovery_codes (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    code_hash CHAR(64) NOT NULL,
+    used_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (user_id, code_hash)
+);
+
+-- Second step of a login: issued after the password check, exchanged for a session
+CREATE TABLE IF NOT EXISTS two_factor_challenges (
+    token_hash CHAR(64) PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    expires_at TIMESTAMP NOT NULL,
+    consumed_at TIMESTAMP,
+    ip VARCHAR(64) NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_two_factor_challenges_expires ON two_factor_challenges(expires_at);
+
+-- Company policy: holders of these roles must use 2FA
+ALTER TABLE roles ADD COLUMN IF NOT EXISTS require_two_factor BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- Step-up: when the session last confirmed the second factor
+ALTER TABLE user_sessions ADD COLUMN IF NOT EXISTS two_factor_verified_at TIMESTAMP;
+
+-- The 2FA requirement and enrollment are part of the cached tenant context
+CREATE OR REPLACE FUNCTION bump_role_holders_context_version()
+RETURNS TRIGGER AS $$
+BEGIN
+    UPDATE users SET context_version = context_version + 1
+    WHERE role_id = NEW.id
+       OR id IN (SELECT user_id FROM user_roles WHERE role_id = NEW.id)
+       OR id IN (SELECT user_id FROM user_branches WHERE role_id = NEW.id);
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS trigger_roles_two_factor_context_version ON roles;
+CREATE TRIGGER trigger_roles_two_factor_context_version
+    AFTER UPDATE OF require_two_factor ON roles
+    FOR EACH ROW
+    WHEN (OLD.require_two_factor IS DISTINCT FROM NEW.require_two_factor)
+    EXECUTE FUNCTION bump_role_holders_context_version();
+
+DROP TRIGGER IF EXISTS trigger_user_two_factor_context_version ON user_two_factor;
+CREATE TRIGGER trigger_user_two_factor_context_version
+    AFTER INSERT OR UPDATE OF enabled_at OR DELETE ON user_two_factor
+    FOR EACH ROW
+    EXECUTE FUNCTION bump_user_context_version();
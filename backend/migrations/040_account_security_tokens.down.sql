@@ -0,0 +1,6 @@
+-- ============================================
+-- Migration 040 Rollback: Account Security Tokens
+-- ============================================
+
+ALTER TABLE users DROP COLUMN IF EXISTS password_changed_at;
+DROP TABLE IF EXISTS account_tokens;
@@ -0,0 +1,21 @@
+-- ============================================
+-- Migration 040: Account Security Tokens
+-- ============================================
+-- Single-use, time-limited tokens for password reset and email change. Only SHA-256
+-- hashes of the tokens are stored.
+
+CREATE TABLE IF NOT EXISTS account_tokens (
+    token_hash CHAR(64) PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    purpose VARCHAR(20) NOT NULL,
+    new_email VARCHAR(255), -- Address being verified by an email change token
+    expires_at TIMESTAMP NOT NULL,
+    used_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT chk_account_tokens_purpose CHECK (purpose IN ('password_reset', 'email_change'))
+);
+
+CREATE INDEX IF NOT EXISTS idx_account_tokens_user ON account_tokens(user_id, purpose);
+CREATE INDEX IF NOT EXISTS idx_account_tokens_expires ON account_tokens(expires_at);
+
+ALTER TABLE users ADD COLUMN IF NOT EXISTS password_changed_at TIMESTAMP;
@@ -0,0 +1,9 @@
+-- ============================================
+-- Migration 041 Rollback: Login Security
+-- ============================================
+
+DROP TABLE IF EXISTS login_events;
+
+ALTER TABLE users DROP COLUMN IF EXISTS locked_until;
+ALTER TABLE users DROP COLUMN IF EXISTS last_failed_login_at;
+ALTER TABLE users DROP COLUMN IF EXISTS failed_login_count;
@@ -0,0 +1,29 @@
+-- ============================================
+-- Migration 041: Login Security
+-- ============================================
+-- Per-account failed login counters with progressive lockout, and an audit trail of
+-- login attempts used to detect logins from new devices and countries.
+
+ALTER TABLE users ADD COLUMN IF NOT EXISTS failed_login_count INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS last_failed_login_at TIMESTAMP;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS locked_until TIMESTAMP;
+
+CREATE TABLE IF NOT EXISTS login_events (
+    id BIGSERIAL PRIMARY KEY,
+    user_id INTEGER REFERENCES users(id) ON DELETE SET NULL, -- NULL for unknown emails
+    company_id VARCHAR(255) REFERENCES companies(id) ON DELETE CASCADE,
+    email VARCHAR(255) NOT NULL,
+    success BOOLEAN NOT NULL,
+    failure_reason VARCHAR(40), -- unknown_email, invalid_password, invalid_two_factor, locked
+    ip VARCHAR(64) NOT NULL DEFAULT '',
+    user_agent TEXT NOT NULL DEFAULT '',
+    device VARCHAR(255) NOT NULL DEFAULT '',
+    country VARCHAR(2) NOT NULL DEFAULT '', -- ISO code from the trusted proxy, '' if unknown
+    new_device BOOLEAN NOT NULL DEFAULT FALSE,
+    new_country BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_login_events_user ON login_events(user_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_login_events_company ON login_events(company_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_login_events_created ON login_events(created_at);
@@ -0,0 +1,12 @@
+-- ============================================
+-- Migration 042 Rollback: OpenID Connect Single Sign-On
+-- ============================================
+
+DELETE FROM account_tokens WHERE purpose = 'sso_login';
+ALTER TABLE account_tokens DROP CONSTRAINT IF EXISTS chk_account_tokens_purpose;
+ALTER TABLE account_tokens ADD CONSTRAINT chk_account_tokens_purpose
+    CHECK (purpose IN ('password_reset', 'email_change'));
+
+DROP TABLE IF EXISTS user_identities;
+DROP TABLE IF EXISTS sso_login_states;
+DROP TABLE IF EXISTS company_sso_configs;
@@ -0,0 +1,51 @@
+-- ============================================
+-- Migration 042: OpenID Connect Single Sign-On
+-- ============================================
+-- Per-company OIDC provider (Google Workspace, Microsoft Entra ID, ...) with just-in-time
+-- provisioning, and the provider identities linked to users.
+
+CREATE TABLE IF NOT EXISTS company_sso_configs (
+    company_id VARCHAR(255) PRIMARY KEY REFERENCES companies(id) ON DELETE CASCADE,
+    issuer VARCHAR(500) NOT NULL,
+    client_id VARCHAR(255) NOT NULL,
+    client_secret TEXT NOT NULL, -- AES-GCM sealed
+    allowed_domains TEXT[] NOT NULL DEFAULT '{}',
+    default_role_id VARCHAR(255) REFERENCES roles(id) ON DELETE SET NULL,
+    default_branch_id VARCHAR(255) REFERENCES branches(id) ON DELETE SET NULL,
+    enabled BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_company_sso_configs_domains ON company_sso_configs USING GIN (allowed_domains);
+
+-- Sign-ins in progress: state, nonce and PKCE verifier of an authorization request
+CREATE TABLE IF NOT EXISTS sso_login_states (
+    state_hash CHAR(64) PRIMARY KEY,
+    company_id VARCHAR(255) NOT NULL REFERENCES companies(id) ON DELETE CASCADE,
+    nonce VARCHAR(100) NOT NULL,
+    code_verifier VARCHAR(100) NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_sso_login_states_expires ON sso_login_states(expires_at);
+
+CREATE TABLE IF NOT EXISTS user_identities (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    company_id VARCHAR(255) NOT NULL REFERENCES companies(id) ON DELETE CASCADE,
+    issuer VARCHAR(500) NOT NULL,
+    subject VARCHAR(255) NOT NULL,
+    email VARCHAR(255) NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    last_login_at TIMESTAMP,
+    CONSTRAINT uq_user_identities_subject UNIQUE (issuer, subject)
+);
+
+CREATE INDEX IF NOT EXISTS idx_user_identities_user ON user_identities(user_id);
+
+-- One-time codes handing a finished SSO sign-in from the browser redirect to the API
+ALTER TABLE account_tokens DROP CONSTRAINT IF EXISTS chk_account_tokens_purpose;
+ALTER TABLE account_tokens ADD CONSTRAINT chk_account_tokens_purpose
+    CHECK (purpose IN ('password_reset', 'email_change', 'sso_login'));
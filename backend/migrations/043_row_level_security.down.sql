@@ -0,0 +1,32 @@
+-- ============================================
+-- Migration 043 Rollback: Row-Level Security
+-- ============================================
+
+DO $$
+DECLARE
+    tbl TEXT;
+BEGIN
+    FOR tbl IN
+        SELECT tablename FROM pg_policies WHERE schemaname = 'public' AND policyname = 'tenant_isolation'
+    LOOP
+        EXECUTE format('DROP POLICY IF EXISTS tenant_isolation ON %I', tbl);
+        EXECUTE format('ALTER TABLE %I NO FORCE ROW LEVEL SECURITY', tbl);
+        EXECUTE format('ALTER TABLE %I DISABLE ROW LEVEL SECURITY', tbl);
+    END LOOP;
+END $$;
+
+DROP FUNCTION IF EXISTS app_tenant_visible(VARCHAR);
+
+DROP TRIGGER IF EXISTS set_company_id ON notifications;
+DROP TRIGGER IF EXISTS set_company_id ON student_activity_log;
+DROP TRIGGER IF EXISTS set_company_id ON student_notes;
+DROP TRIGGER IF EXISTS set_company_id ON lead_activities;
+DROP TRIGGER IF EXISTS set_company_id ON lead_tasks;
+DROP FUNCTION IF EXISTS app_company_from_student();
+DROP FUNCTION IF EXISTS app_company_from_lead();
+
+ALTER TABLE notifications DROP COLUMN IF EXISTS company_id;
+ALTER TABLE student_activity_log DROP COLUMN IF EXISTS company_id;
+ALTER TABLE student_notes DROP COLUMN IF EXISTS company_id;
+ALTER TABLE lead_activities DROP COLUMN IF EXISTS company_id;
+ALTER TABLE lead_tasks DROP COLUMN IF EXISTS company_id;
@@ -0,0 +1,87 @@
+-- ============================================
+-- Migration 043: Row-Level Security
+-- ============================================
+-- Tenant isolation backstop: every table with a company_id gets a policy that hides rows of
+-- other companies once a transaction sets app.company_id (see database.WithTenant). Without
+-- the setting all rows stay visible, so background jobs and the login flow keep working.
+
+-- 1. Child tables that were scoped only through their parent get their own company_id
+ALTER TABLE notifications ADD COLUMN IF NOT EXISTS company_id VARCHAR(255) REFERENCES companies(id) ON DELETE CASCADE;
+ALTER TABLE student_activity_log ADD COLUMN IF NOT EXISTS company_id VARCHAR(255) REFERENCES companies(id) ON DELETE CASCADE;
+ALTER TABLE student_notes ADD COLUMN IF NOT EXISTS company_id VARCHAR(255) REFERENCES companies(id) ON DELETE CASCADE;
+ALTER TABLE lead_activities ADD COLUMN IF NOT EXISTS company_id VARCHAR(255) REFERENCES companies(id) ON DELETE CASCADE;
+ALTER TABLE lead_tasks ADD COLUMN IF NOT EXISTS company_id VARCHAR(255) REFERENCES companies(id) ON DELETE CASCADE;
+
+UPDATE notifications n SET company_id = s.company_id FROM students s WHERE n.student_id = s.id AND n.company_id IS NULL;
+UPDATE student_activity_log a SET company_id = s.company_id FROM students s WHERE a.student_id = s.id AND a.company_id IS NULL;
+UPDATE student_notes sn SET company_id = s.company_id FROM students s WHERE sn.student_id = s.id AND sn.company_id IS NULL;
+UPDATE lead_activities la SET company_id = l.company_id FROM leads l WHERE la.lead_id = l.id AND la.company_id IS NULL;
+UPDATE lead_tasks lt SET company_id = l.company_id FROM leads l WHERE lt.lead_id = l.id AND lt.company_id IS NULL;
+
+CREATE INDEX IF NOT EXISTS idx_notifications_company ON notifications(company_id);
+CREATE INDEX IF NOT EXISTS idx_student_activity_log_company ON student_activity_log(company_id);
+CREATE INDEX IF NOT EXISTS idx_student_notes_company ON student_notes(company_id);
+CREATE INDEX IF NOT EXISTS idx_lead_activities_company ON lead_activities(company_id);
+CREATE INDEX IF NOT EXISTS idx_lead_tasks_company ON lead_tasks(company_id);
+
+-- Inserts always take the company of the parent row, whatever the caller passed
+CREATE OR REPLACE FUNCTION app_company_from_student() RETURNS TRIGGER AS $$
+BEGIN
+    SELECT company_id INTO NEW.company_id FROM students WHERE id = NEW.student_id;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE OR REPLACE FUNCTION app_company_from_lead() RETURNS TRIGGER AS $$
+BEGIN
+    SELECT company_id INTO NEW.company_id FROM leads WHERE id = NEW.lead_id;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS set_company_id ON notifications;
+CREATE TRIGGER set_company_id BEFORE INSERT ON notifications
+    FOR EACH ROW EXECUTE FUNCTION app_company_from_student();
+DROP TRIGGER IF EXISTS set_company_id ON student_activity_log;
+CREATE TRIGGER set_company_id BEFORE INSERT ON student_activity_log
+    FOR EACH ROW EXECUTE FUNCTION app_company_from_student();
+DROP TRIGGER IF EXISTS set_company_id ON student_notes;
+CREATE TRIGGER set_company_id BEFORE INSERT ON student_notes
+    FOR EACH ROW EXECUTE FUNCTION app_company_from_student();
+DROP TRIGGER IF EXISTS set_company_id ON lead_activities;
+CREATE TRIGGER set_company_id BEFORE INSERT ON lead_activities
+    FOR EACH ROW EXECUTE FUNCTION app_company_from_lead();
+DROP TRIGGER IF EXISTS set_company_id ON lead_tasks;
+CREATE TRIGGER set_company_id BEFORE INSERT ON lead_tasks
+    FOR EACH ROW EXECUTE FUNCTION app_company_from_lead();
+
+-- 2. Policy predicate. A local set_config reverts to '' (not NULL) after the transaction,
+-- so both mean "no tenant set".
+CREATE OR REPLACE FUNCTION app_tenant_visible(row_company_id VARCHAR) RETURNS BOOLEAN AS $$
+    SELECT COALESCE(current_setting('app.company_id', true), '') = ''
+        OR row_company_id = current_setting('app.company_id', true)
+$$ LANGUAGE sql STABLE;
+
+-- 3. One policy per tenant table. FORCE makes it apply to the table owner too; superusers and
+-- roles with BYPASSRLS are never subject to policies.
+DO $$
+DECLARE
+    tbl TEXT;
+BEGIN
+    FOR tbl IN
+        SELECT c.table_name
+        FROM information_schema.columns c
+        JOIN information_schema.tables t ON t.table_schema = c.table_schema AND t.table_name = c.table_name
+        WHERE c.table_schema = 'public' AND c.column_name = 'company_id' AND t.table_type = 'BASE TABLE'
+    LOOP
+        EXECUTE format('ALTER TABLE %I ENABLE ROW LEVEL SECURITY', tbl);
+        EXECUTE format('ALTER TABLE %I FORCE ROW LEVEL SECURITY', tbl);
+        EXECUTE format('DROP POLICY IF EXISTS tenant_isolation ON %I', tbl);
+        EXECUTE format('CREATE POLICY tenant_isolation ON %I USING (app_tenant_visible(company_id)) WITH CHECK (app_tenant_visible(company_id))', tbl);
+    END LOOP;
+END $$;
+
+ALTER TABLE companies ENABLE ROW LEVEL SECURITY;
+ALTER TABLE companies FORCE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS tenant_isolation ON companies;
+CREATE POLICY tenant_isolation ON companies USING (app_tenant_visible(id)) WITH CHECK (app_tenant_visible(id));
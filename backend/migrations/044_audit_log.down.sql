@@ -0,0 +1,19 @@
+-- ============================================
+-- Migration 044 Rollback: Audit Log
+-- ============================================
+
+DO $$
+DECLARE
+    tbl TEXT;
+BEGIN
+    FOR tbl IN
+        SELECT event_object_table FROM information_schema.triggers
+        WHERE trigger_schema = 'public' AND trigger_name = 'audit_row'
+        GROUP BY event_object_table
+    LOOP
+        EXECUTE format('DROP TRIGGER IF EXISTS audit_row ON %I', tbl);
+    END LOOP;
+END $$;
+
+DROP FUNCTION IF EXISTS app_audit_row();
+DROP TABLE IF EXISTS audit_log;
@@ -0,0 +1,125 @@
+-- ============================================
+-- Migration 044: Audit Log
+-- ============================================
+-- Company-wide audit trail. Triggers on the audited tables write an entry in the same
+-- transaction as the change; who made it comes from the transaction-local settings
+-- app.user_id, app.client_ip and app.request_id (see database.WithActor).
+
+-- No foreign keys: entries outlive the users and rows they describe and are removed by the
+-- retention job
+CREATE TABLE IF NOT EXISTS audit_log (
+    id BIGSERIAL PRIMARY KEY,
+    company_id VARCHAR(255) NOT NULL,
+    user_id INTEGER,
+    action VARCHAR(50) NOT NULL, -- create, update, delete, clear_company_data
+    entity_type VARCHAR(100) NOT NULL,
+    entity_id VARCHAR(255),
+    changes JSONB NOT NULL DEFAULT '{}', -- {"before": {...}, "after": {...}} with changed fields only
+    ip_address VARCHAR(64),
+    request_id VARCHAR(100),
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_audit_log_company_created ON audit_log(company_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_audit_log_entity ON audit_log(company_id, entity_type, entity_id);
+CREATE INDEX IF NOT EXISTS idx_audit_log_user ON audit_log(company_id, user_id);
+CREATE INDEX IF NOT EXISTS idx_audit_log_created ON audit_log(created_at);
+
+ALTER TABLE audit_log ENABLE ROW LEVEL SECURITY;
+ALTER TABLE audit_log FORCE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS tenant_isolation ON audit_log;
+CREATE POLICY tenant_isolation ON audit_log USING (app_tenant_visible(company_id)) WITH CHECK (app_tenant_visible(company_id));
+
+-- Row trigger: TG_ARGV[0] names the column used as entity_id. Bookkeeping columns and secrets
+-- never reach the log, and updates that only touched those are skipped. Bulk operations set
+-- app.audit_suppress and record one summary entry instead.
+CREATE OR REPLACE FUNCTION app_audit_row() RETURNS TRIGGER AS $$
+DECLARE
+    ignored TEXT[] := ARRAY['updated_at', 'version', 'context_version', 'password', 'client_secret',
+        'failed_login_count', 'last_failed_login_at', 'locked_until'];
+    old_row JSONB;
+    new_row JSONB;
+    row_data JSONB;
+    before_data JSONB := '{}';
+    after_data JSONB := '{}';
+    field TEXT;
+    entry_company VARCHAR;
+BEGIN
+    IF current_setting('app.audit_suppress', true) = 'on' THEN
+        RETURN NULL;
+    END IF;
+
+    IF TG_OP <> 'INSERT' THEN
+        old_row := to_jsonb(OLD) - ignored;
+    END IF;
+    IF TG_OP <> 'DELETE' THEN
+        new_row := to_jsonb(NEW) - ignored;
+    END IF;
+
+    IF TG_OP = 'UPDATE' THEN
+        FOR field IN SELECT jsonb_object_keys(new_row) LOOP
+            IF new_row -> field IS DISTINCT FROM old_row -> field THEN
+                before_data := before_data || jsonb_build_object(field, old_row -> field);
+                after_data := after_data || jsonb_build_object(field, new_row -> field);
+            END IF;
+        END LOOP;
+        IF after_data = '{}' THEN
+            RETURN NULL;
+        END IF;
+    ELSIF TG_OP = 'INSERT' THEN
+        after_data := new_row;
+    ELSE
+        before_data := old_row;
+    END IF;
+
+    row_data := COALESCE(new_row, old_row);
+    entry_company := COALESCE(row_data ->> 'company_id', NULLIF(current_setting('app.company_id', true), ''));
+    IF entry_company IS NULL THEN
+        RETURN NULL;
+    END IF;
+
+    INSERT INTO audit_log (company_id, user_id, action, entity_type, entity_id, changes, ip_address, request_id)
+    VALUES (
+        entry_company,
+        NULLIF(current_setting('app.user_id', true), '')::INTEGER,
+        CASE TG_OP WHEN 'INSERT' THEN 'create' WHEN 'UPDATE' THEN 'update' ELSE 'delete' END,
+        TG_TABLE_NAME,
+        row_data ->> TG_ARGV[0],
+        jsonb_build_object('before', before_data, 'after', after_data),
+        NULLIF(current_setting('app.client_ip', true), ''),
+        NULLIF(current_setting('app.request_id', true), '')
+    );
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+DO $$
+DECLARE
+    audited RECORD;
+BEGIN
+    FOR audited IN
+        SELECT * FROM (VALUES
+            ('roles', 'id'),
+            ('role_permissions', 'role_id'),
+            ('user_roles', 'user_id'),
+            ('user_branches', 'user_id'),
+            ('users', 'id'),
+            ('settings', 'id'),
+            ('branches', 'id'),
+            ('tariffs', 'id'),
+            ('subscription_types', 'id'),
+            ('payment_transactions', 'id'),
+            ('debt_records', 'id'),
+            ('student_subscriptions', 'id'),
+            ('students', 'id'),
+            ('teachers', 'id'),
+            ('groups', 'id'),
+            ('rooms', 'id'),
+            ('company_sso_configs', 'company_id')
+        ) AS t(table_name, id_column)
+    LOOP
+        EXECUTE format('DROP TRIGGER IF EXISTS audit_row ON %I', audited.table_name);
+        EXECUTE format('CREATE TRIGGER audit_row AFTER INSERT OR UPDATE OR DELETE ON %I FOR EACH ROW EXECUTE FUNCTION app_audit_row(%L)',
+            audited.table_name, audited.id_column);
+    END LOOP;
+END $$;
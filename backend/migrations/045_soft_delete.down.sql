@@ -0,0 +1,33 @@
+-- ============================================
+-- Migration 045 Rollback: Soft Delete
+-- ============================================
+-- Rows still in the trash are deleted for good.
+
+DROP TRIGGER IF EXISTS trigger_teachers_deleted_context_version ON teachers;
+DROP TRIGGER IF EXISTS trigger_branches_context_version ON branches;
+CREATE TRIGGER trigger_branches_context_version
+    AFTER INSERT OR DELETE ON branches
+    FOR EACH ROW
+    EXECUTE FUNCTION bump_company_context_version();
+
+DELETE FROM lessons WHERE deleted_at IS NOT NULL;
+DELETE FROM groups WHERE deleted_at IS NOT NULL;
+DELETE FROM students WHERE deleted_at IS NOT NULL;
+DELETE FROM teachers WHERE deleted_at IS NOT NULL;
+DELETE FROM branches WHERE deleted_at IS NOT NULL;
+
+DROP INDEX IF EXISTS idx_students_email_active;
+ALTER TABLE students ADD CONSTRAINT students_email_key UNIQUE (email);
+DROP INDEX IF EXISTS idx_teachers_email_active;
+ALTER TABLE teachers ADD CONSTRAINT teachers_email_key UNIQUE (email);
+
+DO $$
+DECLARE
+    tbl TEXT;
+BEGIN
+    FOREACH tbl IN ARRAY ARRAY['students', 'teachers', 'groups', 'lessons', 'branches'] LOOP
+        EXECUTE format('DROP INDEX IF EXISTS %I', 'idx_' || tbl || '_deleted');
+        EXECUTE format('ALTER TABLE %I DROP COLUMN IF EXISTS deleted_by', tbl);
+        EXECUTE format('ALTER TABLE %I DROP COLUMN IF EXISTS deleted_at', tbl);
+    END LOOP;
+END $$;
@@ -0,0 +1,39 @@
+-- ============================================
+-- Migration 045: Soft Delete
+-- ============================================
+-- Students, teachers, groups, lessons and branches are no longer deleted outright: deleting
+-- sets deleted_at/deleted_by, default queries skip such rows and the trash keeps them
+-- restorable. The purge job removes them later unless financial records refer to them.
+
+DO $$
+DECLARE
+    tbl TEXT;
+BEGIN
+    FOREACH tbl IN ARRAY ARRAY['students', 'teachers', 'groups', 'lessons', 'branches'] LOOP
+        EXECUTE format('ALTER TABLE %I ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP', tbl);
+        EXECUTE format('ALTER TABLE %I ADD COLUMN IF NOT EXISTS deleted_by INTEGER REFERENCES users(id) ON DELETE SET NULL', tbl);
+        EXECUTE format('CREATE INDEX IF NOT EXISTS %I ON %I(company_id, deleted_at) WHERE deleted_at IS NOT NULL',
+            'idx_' || tbl || '_deleted', tbl);
+    END LOOP;
+END $$;
+
+-- A deleted student or teacher must not block a new one with the same email
+ALTER TABLE students DROP CONSTRAINT IF EXISTS students_email_key;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_students_email_active ON students(email) WHERE deleted_at IS NULL;
+ALTER TABLE teachers DROP CONSTRAINT IF EXISTS teachers_email_key;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_teachers_email_active ON teachers(email) WHERE deleted_at IS NULL;
+
+-- Deleting or restoring a branch changes the branches admins see
+DROP TRIGGER IF EXISTS trigger_branches_context_version ON branches;
+CREATE TRIGGER trigger_branches_context_version
+    AFTER INSERT OR DELETE OR UPDATE OF deleted_at ON branches
+    FOR EACH ROW
+    EXECUTE FUNCTION bump_company_context_version();
+
+-- Deleting or restoring a linked teacher changes what its user sees
+DROP TRIGGER IF EXISTS trigger_teachers_deleted_context_version ON teachers;
+CREATE TRIGGER trigger_teachers_deleted_context_version
+    AFTER UPDATE OF deleted_at ON teachers
+    FOR EACH ROW
+    WHEN (NEW.user_id IS NOT NULL)
+    EXECUTE FUNCTION bump_teacher_user_context_version();
@@ -0,0 +1,6 @@
+-- ============================================
+-- Migration 046 Rollback: Company Data Snapshots and Jobs
+-- ============================================
+
+DROP TABLE IF EXISTS company_data_jobs;
+DROP TABLE IF EXISTS company_snapshots;
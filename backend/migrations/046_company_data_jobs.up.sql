@@ -0,0 +1,51 @@
+-- ============================================
+-- Migration 046: Company Data Snapshots and Jobs
+-- ============================================
+-- Clearing company data runs as a tracked background job that first stores a logical dump
+-- of the company's tables, so the wipe (and a restore) can be undone.
+
+-- data is a gzip-compressed JSON document with the rows of every tenant table
+CREATE TABLE IF NOT EXISTS company_snapshots (
+    id BIGSERIAL PRIMARY KEY,
+    company_id VARCHAR(255) NOT NULL REFERENCES companies(id) ON DELETE CASCADE,
+    reason VARCHAR(50) NOT NULL, -- before_wipe, before_restore
+    row_counts JSONB NOT NULL DEFAULT '{}', -- rows per table
+    size_bytes BIGINT NOT NULL DEFAULT 0,
+    data BYTEA NOT NULL,
+    created_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_company_snapshots_company ON company_snapshots(company_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_company_snapshots_created ON company_snapshots(created_at);
+
+CREATE TABLE IF NOT EXISTS company_data_jobs (
+    id BIGSERIAL PRIMARY KEY,
+    company_id VARCHAR(255) NOT NULL REFERENCES companies(id) ON DELETE CASCADE,
+    kind VARCHAR(20) NOT NULL CHECK (kind IN ('wipe', 'restore')),
+    status VARCHAR(20) NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'running', 'completed', 'failed')),
+    step VARCHAR(50) NOT NULL DEFAULT '',
+    source_snapshot_id BIGINT REFERENCES company_snapshots(id) ON DELETE SET NULL, -- restore: snapshot being restored
+    snapshot_id BIGINT REFERENCES company_snapshots(id) ON DELETE SET NULL, -- snapshot taken before the job changed data
+    result JSONB NOT NULL DEFAULT '{}', -- rows deleted and inserted per table
+    error TEXT,
+    created_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    started_at TIMESTAMP,
+    completed_at TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_company_data_jobs_company ON company_data_jobs(company_id, created_at DESC);
+-- At most one unfinished job per company
+CREATE UNIQUE INDEX IF NOT EXISTS idx_company_data_jobs_active ON company_data_jobs(company_id)
+    WHERE status IN ('pending', 'running');
+
+ALTER TABLE company_snapshots ENABLE ROW LEVEL SECURITY;
+ALTER TABLE company_snapshots FORCE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS tenant_isolation ON company_snapshots;
+CREATE POLICY tenant_isolation ON company_snapshots USING (app_tenant_visible(company_id)) WITH CHECK (app_tenant_visible(company_id));
+
+ALTER TABLE company_data_jobs ENABLE ROW LEVEL SECURITY;
+ALTER TABLE company_data_jobs FORCE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS tenant_isolation ON company_data_jobs;
+CREATE POLICY tenant_isolation ON company_data_jobs USING (app_tenant_visible(company_id)) WITH CHECK (app_tenant_visible(company_id));
@@ -0,0 +1,6 @@
+-- ============================================
+-- Migration 047 Rollback: Personal Data Erasure
+-- ============================================
+
+ALTER TABLE leads DROP COLUMN IF EXISTS anonymized_at;
+ALTER TABLE students DROP COLUMN IF EXISTS anonymized_at;
@@ -0,0 +1,8 @@
+-- ============================================
+-- Migration 047: Personal Data Erasure
+-- ============================================
+-- Students and leads can be anonymized on request. The row stays so that payments, debts,
+-- invoices and attendance keep pointing at it; anonymized_at marks it as erased.
+
+ALTER TABLE students ADD COLUMN IF NOT EXISTS anonymized_at TIMESTAMP;
+ALTER TABLE leads ADD COLUMN IF NOT EXISTS anonymized_at TIMESTAMP;
@@ -0,0 +1,6 @@
+-- ============================================
+-- Migration 048 Rollback: Branch Transfers
+-- ============================================
+
+DROP TABLE IF EXISTS teacher_branches;
+DROP TABLE IF EXISTS student_transfers;
@@ -0,0 +1,55 @@
+-- ============================================
+-- Migration 048: Branch Transfers
+-- ============================================
+-- Students can be transferred to another branch together with their balance, debts and
+-- subscriptions; every transfer is logged. Teachers can work in several branches, each with
+-- its own weekly working hours; teachers.branch_id stays their primary branch.
+
+CREATE TABLE IF NOT EXISTS student_transfers (
+    id BIGSERIAL PRIMARY KEY,
+    company_id VARCHAR(255) NOT NULL REFERENCES companies(id) ON DELETE CASCADE,
+    student_id VARCHAR(255) NOT NULL REFERENCES students(id) ON DELETE CASCADE,
+    from_branch_id VARCHAR(255) REFERENCES branches(id) ON DELETE SET NULL,
+    to_branch_id VARCHAR(255) REFERENCES branches(id) ON DELETE SET NULL,
+    subscription_policy VARCHAR(20) NOT NULL CHECK (subscription_policy IN ('move', 'refund', 'keep')),
+    reason TEXT,
+    details JSONB NOT NULL DEFAULT '{}', -- what the transfer changed
+    created_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_student_transfers_student ON student_transfers(student_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_student_transfers_company ON student_transfers(company_id, created_at DESC);
+
+-- schedule is a list of {"weekday": 0-6 (Sunday = 0), "start": "HH:MM", "end": "HH:MM"}
+CREATE TABLE IF NOT EXISTS teacher_branches (
+    teacher_id VARCHAR(255) NOT NULL REFERENCES teachers(id) ON DELETE CASCADE,
+    branch_id VARCHAR(255) NOT NULL REFERENCES branches(id) ON DELETE CASCADE,
+    company_id VARCHAR(255) NOT NULL REFERENCES companies(id) ON DELETE CASCADE,
+    schedule JSONB NOT NULL DEFAULT '[]',
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (teacher_id, branch_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_teacher_branches_branch ON teacher_branches(branch_id);
+
+-- Every teacher works in their primary branch
+INSERT INTO teacher_branches (teacher_id, branch_id, company_id)
+SELECT t.id, t.branch_id, t.company_id FROM teachers t
+JOIN branches b ON b.id = t.branch_id
+ON CONFLICT DO NOTHING;
+
+-- Branch assignments and working hours are audited like the teacher itself
+DROP TRIGGER IF EXISTS audit_row ON teacher_branches;
+CREATE TRIGGER audit_row AFTER INSERT OR UPDATE OR DELETE ON teacher_branches
+    FOR EACH ROW EXECUTE FUNCTION app_audit_row('teacher_id');
+
+ALTER TABLE student_transfers ENABLE ROW LEVEL SECURITY;
+ALTER TABLE student_transfers FORCE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS tenant_isolation ON student_transfers;
+CREATE POLICY tenant_isolation ON student_transfers USING (app_tenant_visible(company_id)) WITH CHECK (app_tenant_visible(company_id));
+
+ALTER TABLE teacher_branches ENABLE ROW LEVEL SECURITY;
+ALTER TABLE teacher_branches FORCE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS tenant_isolation ON teacher_branches;
+CREATE POLICY tenant_isolation ON teacher_branches USING (app_tenant_visible(company_id)) WITH CHECK (app_tenant_visible(company_id));
@@ -0,0 +1,20 @@
+-- ============================================
+-- Migration 049 Rollback: SaaS Plans and Usage Metering
+-- ============================================
+
+DROP TRIGGER IF EXISTS trigger_users_context_version ON users;
+CREATE TRIGGER trigger_users_context_version
+    BEFORE UPDATE OF company_id, role_id ON users
+    FOR EACH ROW
+    WHEN (OLD.company_id IS DISTINCT FROM NEW.company_id OR OLD.role_id IS DISTINCT FROM NEW.role_id)
+    EXECUTE FUNCTION bump_own_context_version();
+
+DROP TRIGGER IF EXISTS trigger_plans_context_version ON plans;
+DROP FUNCTION IF EXISTS bump_plan_users_context_version();
+DROP TRIGGER IF EXISTS trigger_companies_context_version ON companies;
+DROP FUNCTION IF EXISTS bump_company_users_context_version();
+
+ALTER TABLE users DROP COLUMN IF EXISTS is_platform_admin;
+DROP TABLE IF EXISTS company_usage;
+ALTER TABLE companies DROP COLUMN IF EXISTS plan_id;
+DROP TABLE IF EXISTS plans;
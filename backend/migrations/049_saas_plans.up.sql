@@ -0,0 +1,93 @@
+-- ============================================
+-- Migration 049: SaaS Plans and Usage Metering
+-- ============================================
+-- Every company is on a plan that caps its students, branches, users and storage and lists
+-- the features it may use. Usage is metered daily per company. A suspended company stays
+-- readable but cannot change anything. Platform admins (users.is_platform_admin) operate
+-- the service across companies; the flag is outside company RBAC and is granted in the
+-- database.
+
+-- A NULL limit is unlimited. features: exports, migration, sso
+CREATE TABLE IF NOT EXISTS plans (
+    id VARCHAR(50) PRIMARY KEY,
+    name VARCHAR(255) NOT NULL,
+    max_students INTEGER CHECK (max_students >= 0),
+    max_branches INTEGER CHECK (max_branches >= 0),
+    max_users INTEGER CHECK (max_users >= 0),
+    max_storage_mb INTEGER CHECK (max_storage_mb >= 0),
+    features TEXT[] NOT NULL DEFAULT '{}',
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+INSERT INTO plans (id, name, max_students, max_branches, max_users, max_storage_mb, features) VALUES
+    ('free', 'Free', 50, 1, 3, 100, '{}'),
+    ('standard', 'Standard', 500, 3, 15, 2048, '{exports}'),
+    ('pro', 'Pro', NULL, NULL, NULL, NULL, '{exports,migration,sso}')
+ON CONFLICT (id) DO NOTHING;
+
+-- Companies that existed before plans keep everything they had; new companies start on free
+ALTER TABLE companies ADD COLUMN IF NOT EXISTS plan_id VARCHAR(50) REFERENCES plans(id);
+UPDATE companies SET plan_id = 'pro' WHERE plan_id IS NULL;
+ALTER TABLE companies ALTER COLUMN plan_id SET DEFAULT 'free';
+ALTER TABLE companies ALTER COLUMN plan_id SET NOT NULL;
+
+-- One row per company and day, written by the usage metering job
+CREATE TABLE IF NOT EXISTS company_usage (
+    company_id VARCHAR(255) NOT NULL REFERENCES companies(id) ON DELETE CASCADE,
+    day DATE NOT NULL,
+    students INTEGER NOT NULL DEFAULT 0,
+    branches INTEGER NOT NULL DEFAULT 0,
+    users INTEGER NOT NULL DEFAULT 0,
+    storage_bytes BIGINT NOT NULL DEFAULT 0, -- company rows plus snapshots
+    measured_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (company_id, day)
+);
+
+ALTER TABLE company_usage ENABLE ROW LEVEL SECURITY;
+ALTER TABLE company_usage FORCE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS tenant_isolation ON company_usage;
+CREATE POLICY tenant_isolation ON company_usage USING (app_tenant_visible(company_id)) WITH CHECK (app_tenant_visible(company_id));
+
+ALTER TABLE users ADD COLUMN IF NOT EXISTS is_platform_admin BOOLEAN NOT NULL DEFAULT false;
+
+-- The status, plan and plan features of a company are part of its users' context
+CREATE OR REPLACE FUNCTION bump_company_users_context_version()
+RETURNS TRIGGER AS $$
+BEGIN
+    UPDATE users SET context_version = context_version + 1 WHERE company_id = NEW.id;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS trigger_companies_context_version ON companies;
+CREATE TRIGGER trigger_companies_context_version
+    AFTER UPDATE OF status, plan_id ON companies
+    FOR EACH ROW
+    WHEN (OLD.status IS DISTINCT FROM NEW.status OR OLD.plan_id IS DISTINCT FROM NEW.plan_id)
+    EXECUTE FUNCTION bump_company_users_context_version();
+
+CREATE OR REPLACE FUNCTION bump_plan_users_context_version()
+RETURNS TRIGGER AS $$
+BEGIN
+    UPDATE users SET context_version = context_version + 1
+    WHERE company_id IN (SELECT id FROM companies WHERE plan_id = NEW.id);
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS trigger_plans_context_version ON plans;
+CREATE TRIGGER trigger_plans_context_version
+    AFTER UPDATE OF features ON plans
+    FOR EACH ROW
+    WHEN (OLD.features IS DISTINCT FROM NEW.features)
+    EXECUTE FUNCTION bump_plan_users_context_version();
+
+-- Granting or revoking platform admin changes the user's own context
+DROP TRIGGER IF EXISTS trigger_users_context_version ON users;
+CREATE TRIGGER trigger_users_context_version
+    BEFORE UPDATE OF company_id, role_id, is_platform_admin ON users
+    FOR EACH ROW
+    WHEN (OLD.company_id IS DISTINCT FROM NEW.company_id OR OLD.role_id IS DISTINCT FROM NEW.role_id
+          OR OLD.is_platform_admin IS DISTINCT FROM NEW.is_platform_admin)
+    EXECUTE FUNCTION bump_own_context_version();
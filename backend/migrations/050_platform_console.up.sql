@@ -0,0 +1,80 @@
+-- ============================================
+-- Migration 050: Platform Console
+-- ============================================
+-- Platform admins suspend and reactivate companies and sign in as a company user for support.
+-- An impersonation is a session of the user marked with the platform admin who opened it; it
+-- has no refresh token and ends when its access token expires. Changes made through it are
+-- attributed to the user in the audit log with the platform admin in impersonated_by.
+
+ALTER TABLE companies ADD COLUMN IF NOT EXISTS suspended_at TIMESTAMP;
+ALTER TABLE companies ADD COLUMN IF NOT EXISTS suspension_reason TEXT;
+
+-- Removing the platform admin closes their impersonations instead of turning them into
+-- ordinary sessions
+ALTER TABLE user_sessions ADD COLUMN IF NOT EXISTS impersonated_by INTEGER REFERENCES users(id) ON DELETE CASCADE;
+ALTER TABLE user_sessions ADD COLUMN IF NOT EXISTS impersonation_reason TEXT;
+CREATE INDEX IF NOT EXISTS idx_user_sessions_impersonated_by ON user_sessions(impersonated_by) WHERE impersonated_by IS NOT NULL;
+
+ALTER TABLE audit_log ADD COLUMN IF NOT EXISTS impersonated_by INTEGER;
+
+-- Same as migration 044, plus impersonated_by from the transaction-local app.impersonated_by
+CREATE OR REPLACE FUNCTION app_audit_row() RETURNS TRIGGER AS $$
+DECLARE
+    ignored TEXT[] := ARRAY['updated_at', 'version', 'context_version', 'password', 'client_secret',
+        'failed_login_count', 'last_failed_login_at', 'locked_until'];
+    old_row JSONB;
+    new_row JSONB;
+    row_data JSONB;
+    before_data JSONB := '{}';
+    after_data JSONB := '{}';
+    field TEXT;
+    entry_company VARCHAR;
+BEGIN
+    IF current_setting('app.audit_suppress', true) = 'on' THEN
+        RETURN NULL;
+    END IF;
+
+    IF TG_OP <> 'INSERT' THEN
+        old_row := to_jsonb(OLD) - ignored;
+    END IF;
+    IF TG_OP <> 'DELETE' THEN
+        new_row := to_jsonb(NEW) - ignored;
+    END IF;
+
+    IF TG_OP = 'UPDATE' THEN
+        FOR field IN SELECT jsonb_object_keys(new_row) LOOP
+            IF new_row -> field IS DISTINCT FROM old_row -> field THEN
+                before_data := before_data || jsonb_build_object(field, old_row -> field);
+                after_data := after_data || jsonb_build_object(field, new_row -> field);
+            END IF;
+        END LOOP;
+        IF after_data = '{}' THEN
+            RETURN NULL;
+        END IF;
+    ELSIF TG_OP = 'INSERT' THEN
+        after_data := new_row;
+    ELSE
+        before_data := old_row;
+    END IF;
+
+    row_data := COALESCE(new_row, old_row);
+    entry_company := COALESCE(row_data ->> 'company_id', NULLIF(current_setting('app.company_id', true), ''));
+    IF entry_company IS NULL THEN
+        RETURN NULL;
+    END IF;
+
+    INSERT INTO audit_log (company_id, user_id, impersonated_by, action, entity_type, entity_id, changes, ip_address, request_id)
+    VALUES (
+        entry_company,
+        NULLIF(current_setting('app.user_id', true), '')::INTEGER,
+        NULLIF(current_setting('app.impersonated_by', true), '')::INTEGER,
+        CASE TG_OP WHEN 'INSERT' THEN 'create' WHEN 'UPDATE' THEN 'update' ELSE 'delete' END,
+        TG_TABLE_NAME,
+        row_data ->> TG_ARGV[0],
+        jsonb_build_object('before', before_data, 'after', after_data),
+        NULLIF(current_setting('app.client_ip', true), ''),
+        NULLIF(current_setting('app.request_id', true), '')
+    );
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
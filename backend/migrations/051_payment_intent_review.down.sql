@@ -0,0 +1,13 @@
+-- ============================================
+-- Migration 051 Rollback: Online Payment Review
+-- ============================================
+
+DROP INDEX IF EXISTS idx_payment_intents_review;
+
+UPDATE payment_intents SET status = 'failed' WHERE status = 'review';
+
+ALTER TABLE payment_intents DROP CONSTRAINT IF EXISTS payment_intents_status_check;
+ALTER TABLE payment_intents ADD CONSTRAINT payment_intents_status_check
+    CHECK (status IN ('pending', 'succeeded', 'failed', 'cancelled', 'refunded'));
+
+ALTER TABLE payment_intents DROP COLUMN IF EXISTS paid_amount;
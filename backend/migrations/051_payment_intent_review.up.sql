@@ -0,0 +1,13 @@
+-- ============================================
+-- Migration 051: Online Payment Review
+-- ============================================
+-- A provider confirmation for a different amount than the intent is not booked: the intent
+-- goes to review with the paid amount until staff accept it.
+
+ALTER TABLE payment_intents ADD COLUMN IF NOT EXISTS paid_amount NUMERIC(14, 2);
+
+ALTER TABLE payment_intents DROP CONSTRAINT IF EXISTS payment_intents_status_check;
+ALTER TABLE payment_intents ADD CONSTRAINT payment_intents_status_check
+    CHECK (status IN ('pending', 'review', 'succeeded', 'failed', 'cancelled', 'refunded'));
+
+CREATE INDEX IF NOT EXISTS idx_payment_intents_review ON payment_intents(company_id) WHERE status = 'review';
@@ -0,0 +1,8 @@
+-- ============================================
+-- Migration 052 Rollback: Fail-Closed Row-Level Security
+-- ============================================
+
+CREATE OR REPLACE FUNCTION app_tenant_visible(row_company_id VARCHAR) RETURNS BOOLEAN AS $$
+    SELECT COALESCE(current_setting('app.company_id', true), '') = ''
+        OR row_company_id = current_setting('app.company_id', true)
+$$ LANGUAGE sql STABLE;
@@ -0,0 +1,13 @@
+-- ============================================
+-- Migration 052: Fail-Closed Row-Level Security
+-- ============================================
+-- Migration 043 showed every row when app.company_id was not set, so a request that reached the
+-- database without a tenant saw all companies. Now an unscoped connection sees nothing: requests
+-- scope themselves with database.Tenant or WithTenant, and work that spans companies (background
+-- jobs, sign-in, provider webhooks, the platform console, migrations) opts out explicitly with
+-- database.System, which sets app.rls_bypass.
+
+CREATE OR REPLACE FUNCTION app_tenant_visible(row_company_id VARCHAR) RETURNS BOOLEAN AS $$
+    SELECT COALESCE(current_setting('app.rls_bypass', true), '') = 'on'
+        OR row_company_id = NULLIF(current_setting('app.company_id', true), '')
+$$ LANGUAGE sql STABLE;
@@ -0,0 +1,5 @@
+-- ============================================
+-- Migration 053 Rollback: Company Archive Dry Runs
+-- ============================================
+
+DROP TABLE IF EXISTS tenant_import_dry_runs;
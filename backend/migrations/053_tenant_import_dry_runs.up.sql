@@ -0,0 +1,23 @@
+-- ============================================
+-- Migration 053: Company Archive Dry Runs
+-- ============================================
+-- Applying a company archive requires a successful dry run of the same archive by the same
+-- company. The dry run is recorded here; the checksum alone can be computed by any client.
+
+CREATE TABLE IF NOT EXISTS tenant_import_dry_runs (
+    id BIGSERIAL PRIMARY KEY,
+    company_id VARCHAR(255) NOT NULL REFERENCES companies(id) ON DELETE CASCADE,
+    checksum VARCHAR(64) NOT NULL, -- SHA-256 of the archive
+    report JSONB NOT NULL DEFAULT '{}', -- report of the dry run
+    created_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    expires_at TIMESTAMP NOT NULL,
+    UNIQUE (company_id, checksum)
+);
+
+CREATE INDEX IF NOT EXISTS idx_tenant_import_dry_runs_expires ON tenant_import_dry_runs(expires_at);
+
+ALTER TABLE tenant_import_dry_runs ENABLE ROW LEVEL SECURITY;
+ALTER TABLE tenant_import_dry_runs FORCE ROW LEVEL SECURITY;
+DROP POLICY IF EXISTS tenant_isolation ON tenant_import_dry_runs;
+CREATE POLICY tenant_isolation ON tenant_import_dry_runs USING (app_tenant_visible(company_id)) WITH CHECK (app_tenant_visible(company_id));
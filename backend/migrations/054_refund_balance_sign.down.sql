@@ -0,0 +1,14 @@
+-- ============================================
+-- Migration 054 Rollback: Refunds Reduce the Balance
+-- ============================================
+
+UPDATE student_balance sb
+SET balance = sb.balance + 2 * r.total,
+    version = sb.version + 1
+FROM (
+    SELECT student_id, SUM(amount) AS total
+    FROM payment_transactions
+    WHERE type = 'refund'
+    GROUP BY student_id
+) r
+WHERE sb.student_id = r.student_id;
@@ -0,0 +1,17 @@
+-- ============================================
+-- Migration 054: Refunds Reduce the Balance
+-- ============================================
+-- Refunds were added to the student balance like payments, while the debts they reopened and
+-- the shift and branch reports counted them as money paid out. Every refund booked so far raised
+-- the balance by its amount instead of lowering it, so the balance is corrected by twice the sum.
+
+UPDATE student_balance sb
+SET balance = sb.balance - 2 * r.total,
+    version = sb.version + 1
+FROM (
+    SELECT student_id, SUM(amount) AS total
+    FROM payment_transactions
+    WHERE type = 'refund'
+    GROUP BY student_id
+) r
+WHERE sb.student_id = r.student_id;
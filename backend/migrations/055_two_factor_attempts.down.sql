@@ -0,0 +1,6 @@
+-- ============================================
+-- Migration 055 Rollback: Two-Factor Code Attempts
+-- ============================================
+
+ALTER TABLE user_two_factor DROP COLUMN IF EXISTS locked_until;
+ALTER TABLE user_two_factor DROP COLUMN IF EXISTS failed_attempts;
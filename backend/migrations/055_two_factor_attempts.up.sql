@@ -0,0 +1,8 @@
+-- ============================================
+-- Migration 055: Two-Factor Code Attempts
+-- ============================================
+-- Failed codes on step-up, disabling 2FA and regenerating recovery codes are counted per
+-- user and lock further codes with the same backoff as failed logins.
+
+ALTER TABLE user_two_factor ADD COLUMN IF NOT EXISTS failed_attempts INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE user_two_factor ADD COLUMN IF NOT EXISTS locked_until TIMESTAMP;
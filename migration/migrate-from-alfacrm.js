@@ -2282,6 +2282,50 @@ async function generateLessonsForBranch(schedules, branchId) {
 
 let DEFAULT_BRANCH_ID = null;
 
+// Лимиты тарифа компании (передаются бэкендом, пусто — без ограничений)
+const PLAN_MAX_STUDENTS = process.env.PLAN_MAX_STUDENTS ? parseInt(process.env.PLAN_MAX_STUDENTS) : null;
+const PLAN_MAX_BRANCHES = process.env.PLAN_MAX_BRANCHES ? parseInt(process.env.PLAN_MAX_BRANCHES) : null;
+
+// Проверяет лимиты тарифа до записи данных: считает, сколько студентов и филиалов будет
+// у компании после миграции (существующие записи, которые миграция не перезапишет, плюс
+// входящие из AlfaCRM), и останавливает миграцию, если лимит превышен
+async function checkPlanLimits() {
+  if (PLAN_MAX_STUDENTS === null && PLAN_MAX_BRANCHES === null) return;
+
+  console.log('\n📏 ПРОВЕРКА ЛИМИТОВ ТАРИФА\n');
+
+  const alfacrmBranches = await fetchAlfaCRMBranches();
+  const branchIds = alfacrmBranches.length > 0
+    ? alfacrmBranches.map(b => `${COMPANY_ID}_branch_${typeof b.id === 'string' ? parseInt(b.id) : b.id}`)
+    : [COMPANY_ID + '_default_branch'];
+
+  const customerIds = new Set();
+  const branchesToScan = alfacrmBranches.length > 0 ? alfacrmBranches.map(b => b.id) : [null];
+  for (const branchId of branchesToScan) {
+    const customers = await fetchAllPages('/v2api/customer/index', {}, branchId);
+    for (const customer of customers) {
+      if (customer.id !== undefined && customer.id !== null) customerIds.add(customer.id.toString());
+    }
+  }
+
+  const checks = [
+    { limit: PLAN_MAX_STUDENTS, name: 'students', ids: Array.from(customerIds),
+      query: 'SELECT COUNT(*) FROM students WHERE company_id = $1 AND deleted_at IS NULL AND anonymized_at IS NULL AND NOT id = ANY($2)' },
+    { limit: PLAN_MAX_BRANCHES, name: 'branches', ids: branchIds,
+      query: 'SELECT COUNT(*) FROM branches WHERE company_id = $1 AND deleted_at IS NULL AND NOT id = ANY($2)' },
+  ];
+  for (const check of checks) {
+    if (check.limit === null) continue;
+    const existing = await pool.query(check.query, [COMPANY_ID, check.ids]);
+    const total = parseInt(existing.rows[0].count) + check.ids.length;
+    console.log(`   ${check.name}: после миграции ${total}, лимит тарифа ${check.limit}`);
+    if (total > check.limit) {
+      throw new Error(`plan limit: the migration would leave ${total} ${check.name}, the plan allows ${check.limit}`);
+    }
+  }
+  console.log('✅ Лимиты тарифа не превышены\n');
+}
+
 async function createCompanyAndBranches() {
   console.log('\n🏢 СОЗДАНИЕ КОМПАНИИ И ФИЛИАЛОВ\n');
   
@@ -2879,6 +2923,7 @@ async function main() {
   console.log('╚═══════════════════════════════════════════════════════════╝\n');
   
   try {
+    await checkPlanLimits();
     const branchMapping = await createCompanyAndBranches();
     
     // Мигрировать базовые данные (тарифы - они общие для всех филиалов)